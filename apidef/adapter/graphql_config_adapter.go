@@ -17,9 +17,10 @@ import (
 var ErrUnsupportedGraphQLConfigVersion = errors.New("provided version of GraphQL config is not supported for this operation")
 
 type GraphQLConfigAdapter struct {
-	config     apidef.GraphQLConfig
-	httpClient *http.Client
-	schema     *graphql.Schema
+	config                apidef.GraphQLConfig
+	httpClient            *http.Client
+	dataSourceHttpClients map[string]*http.Client
+	schema                *graphql.Schema
 }
 
 func NewGraphQLConfigAdapter(config apidef.GraphQLConfig) GraphQLConfigAdapter {
@@ -97,8 +98,8 @@ func (g *GraphQLConfigAdapter) engineConfigV2DataSources() (planDataSources []pl
 			}
 
 			factory := &restDataSource.Factory{}
-			if g.httpClient != nil {
-				factory.Client = httpclient.NewNetHttpClient(g.httpClient)
+			if httpClient := g.dataSourceHttpClient(ds.Name); httpClient != nil {
+				factory.Client = httpclient.NewNetHttpClient(httpClient)
 			}
 			planDataSource.Factory = factory
 
@@ -120,8 +121,8 @@ func (g *GraphQLConfigAdapter) engineConfigV2DataSources() (planDataSources []pl
 			}
 
 			factory := &graphqlDataSource.Factory{}
-			if g.httpClient != nil {
-				factory.Client = httpclient.NewNetHttpClient(g.httpClient)
+			if httpClient := g.dataSourceHttpClient(ds.Name); httpClient != nil {
+				factory.Client = httpclient.NewNetHttpClient(httpClient)
 			}
 			planDataSource.Factory = factory
 
@@ -184,6 +185,19 @@ func (g *GraphQLConfigAdapter) SetHttpClient(httpClient *http.Client) {
 	g.httpClient = httpClient
 }
 
+// SetDataSourceHttpClients sets the clients of the data sources which don't
+// use the shared one, by data source name.
+func (g *GraphQLConfigAdapter) SetDataSourceHttpClients(httpClients map[string]*http.Client) {
+	g.dataSourceHttpClients = httpClients
+}
+
+func (g *GraphQLConfigAdapter) dataSourceHttpClient(name string) *http.Client {
+	if httpClient, ok := g.dataSourceHttpClients[name]; ok {
+		return httpClient
+	}
+	return g.httpClient
+}
+
 func (g *GraphQLConfigAdapter) convertURLQueriesToEngineV2Queries(apiDefQueries []apidef.QueryVariable) []restDataSource.QueryConfiguration {
 	if len(apiDefQueries) == 0 {
 		return nil
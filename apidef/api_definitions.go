@@ -94,6 +94,16 @@ type CacheMeta struct {
 	Path                   string `bson:"path" json:"path"`
 	CacheKeyRegex          string `bson:"cache_key_regex" json:"cache_key_regex"`
 	CacheOnlyResponseCodes []int  `bson:"cache_response_codes" json:"cache_response_codes"`
+	// CoalesceRequests makes identical safe requests, made while a first
+	// one is not cached yet, wait for its response instead of all calling
+	// the upstream, whatever their client. They call the upstream
+	// themselves if that response isn't cached, isn't successful or is
+	// private to its client, as are responses to authenticated requests
+	// that aren't explicitly public.
+	CoalesceRequests bool `bson:"coalesce_requests" json:"coalesce_requests"`
+	// CoalesceMaxWait is how long, in seconds, coalesced requests wait for
+	// the first one before calling the upstream themselves. No limit if 0.
+	CoalesceMaxWait float64 `bson:"coalesce_max_wait" json:"coalesce_max_wait"`
 }
 
 type RequestInputType string
@@ -109,6 +119,15 @@ type TemplateMeta struct {
 	TemplateData TemplateData `bson:"template_data" json:"template_data"`
 	Path         string       `bson:"path" json:"path"`
 	Method       string       `bson:"method" json:"method"`
+	// TierMetadata is the session metadata field holding the tier of
+	// callers, such as their plan, usually set by their policies.
+	TierMetadata string `bson:"tier_metadata" json:"tier_metadata"`
+	// TierTemplates are the templates used for callers of each tier. Other
+	// callers use TemplateData.
+	TierTemplates map[string]TemplateData `bson:"tier_templates" json:"tier_templates"`
+	// Condition is an expression over the request and session deciding
+	// whether the transform runs, see the condition package.
+	Condition string `bson:"condition" json:"condition"`
 }
 
 type TransformJQMeta struct {
@@ -123,6 +142,9 @@ type HeaderInjectionMeta struct {
 	Path          string            `bson:"path" json:"path"`
 	Method        string            `bson:"method" json:"method"`
 	ActOnResponse bool              `bson:"act_on" json:"act_on"`
+	// Condition is an expression over the request and session deciding
+	// whether the headers are injected, see the condition package.
+	Condition string `bson:"condition" json:"condition"`
 }
 
 type HardTimeoutMeta struct {
@@ -141,12 +163,75 @@ type InternalMeta struct {
 	Method string `bson:"method" json:"method"`
 }
 
+// CORSMeta overrides the API CORS options for an endpoint. Empty options
+// are inherited from the API, an empty method matches any method.
+type CORSMeta struct {
+	Path             string   `bson:"path" json:"path"`
+	Method           string   `bson:"method" json:"method"`
+	AllowedOrigins   []string `bson:"allowed_origins" json:"allowed_origins"`
+	AllowedMethods   []string `bson:"allowed_methods" json:"allowed_methods"`
+	AllowedHeaders   []string `bson:"allowed_headers" json:"allowed_headers"`
+	ExposedHeaders   []string `bson:"exposed_headers" json:"exposed_headers"`
+	AllowCredentials *bool    `bson:"allow_credentials" json:"allow_credentials"`
+	MaxAge           int      `bson:"max_age" json:"max_age"`
+}
+
 type RequestSizeMeta struct {
 	Path      string `bson:"path" json:"path"`
 	Method    string `bson:"method" json:"method"`
 	SizeLimit int64  `bson:"size_limit" json:"size_limit"`
 }
 
+// IdempotencyMeta makes an endpoint replay its first response to requests
+// retried with the same Idempotency-Key header and body. Requests with the
+// header are rejected with a 503 while Redis is unavailable.
+type IdempotencyMeta struct {
+	Path   string `bson:"path" json:"path"`
+	Method string `bson:"method" json:"method"`
+	// TTL is how long, in seconds, a response is replayed for. Defaults to 24 hours.
+	TTL int64 `bson:"ttl" json:"ttl"`
+	// InFlightStatusCode is returned to retries made while the first request
+	// is still being processed, either 409 or 425. Defaults to 409.
+	InFlightStatusCode int `bson:"in_flight_status_code" json:"in_flight_status_code"`
+}
+
+// FallbackMeta serves a fallback response for an endpoint when its circuit
+// breaker is open, its upstream can't be reached, or its upstream answers
+// with one of StatusCodes.
+type FallbackMeta struct {
+	Path        string `bson:"path" json:"path"`
+	Method      string `bson:"method" json:"method"`
+	StatusCodes []int  `bson:"status_codes" json:"status_codes"`
+	// Type is static, cached or redirect. Cached serves the last
+	// successful response to the same request, the upstream response or
+	// error is passed on when there is none.
+	Type string `bson:"type" json:"type"`
+	// Code is the status of static and redirect responses. Defaults to 200
+	// for static responses and 302 for redirects.
+	Code    int               `bson:"code" json:"code"`
+	Body    string            `bson:"body" json:"body"`
+	Headers map[string]string `bson:"headers" json:"headers"`
+	// RedirectURL is where redirect responses send clients.
+	RedirectURL string `bson:"redirect_url" json:"redirect_url"`
+	// MaxAge is how long, in seconds, successful responses are kept for
+	// cached responses. Defaults to an hour.
+	MaxAge int64 `bson:"max_age" json:"max_age"`
+}
+
+// StaticResponseMeta makes the gateway answer requests to an endpoint itself,
+// without proxying them, e.g. for health checks or robots.txt.
+type StaticResponseMeta struct {
+	Path   string `bson:"path" json:"path"`
+	Method string `bson:"method" json:"method"`
+	// Code is the status of the response. Defaults to 200.
+	Code    int               `bson:"code" json:"code"`
+	Headers map[string]string `bson:"headers" json:"headers"`
+	// Body is a Go template, rendered with the method, path, host, query,
+	// headers and remote_addr of the request, and its _tyk_context and
+	// _tyk_meta.
+	Body string `bson:"body" json:"body"`
+}
+
 type CircuitBreakerMeta struct {
 	Path                 string  `bson:"path" json:"path"`
 	Method               string  `bson:"method" json:"method"`
@@ -194,6 +279,16 @@ type VirtualMeta struct {
 	Method               string `bson:"method" json:"method"`
 	UseSession           bool   `bson:"use_session" json:"use_session"`
 	ProxyOnError         bool   `bson:"proxy_on_error" json:"proxy_on_error"`
+	// CacheTTL caches the responses of the function to identical requests
+	// for this many seconds, per key and per value of the cache by headers
+	// of the API. The session metadata isn't updated when serving cached
+	// responses.
+	CacheTTL int64 `bson:"cache_ttl" json:"cache_ttl"`
+	// Timeout overrides the JSVM timeout for the function, in seconds.
+	Timeout float64 `bson:"timeout" json:"timeout"`
+	// MaxConcurrency limits the concurrent runs of the function, requests
+	// above it are rejected.
+	MaxConcurrency int `bson:"max_concurrency" json:"max_concurrency"`
 }
 
 type MethodTransformMeta struct {
@@ -210,6 +305,9 @@ type ValidatePathMeta struct {
 	SchemaCache gojsonschema.JSONLoader `bson:"-" json:"-"`
 	// Allows override of default 422 Unprocessible Entity response code for validation errors.
 	ErrorResponseCode int `bson:"error_response_code" json:"error_response_code"`
+	// Condition is an expression over the request and session deciding
+	// whether the request is validated, see the condition package.
+	Condition string `bson:"condition" json:"condition"`
 }
 
 type GoPluginMeta struct {
@@ -242,6 +340,10 @@ type ExtendedPathsSet struct {
 	ValidateJSON            []ValidatePathMeta    `bson:"validate_json" json:"validate_json,omitempty"`
 	Internal                []InternalMeta        `bson:"internal" json:"internal,omitempty"`
 	GoPlugin                []GoPluginMeta        `bson:"go_plugin" json:"go_plugin,omitempty"`
+	CORS                    []CORSMeta            `bson:"cors" json:"cors,omitempty"`
+	Idempotency             []IdempotencyMeta     `bson:"idempotency" json:"idempotency,omitempty"`
+	Fallback                []FallbackMeta        `bson:"fallback" json:"fallback,omitempty"`
+	StaticResponse          []StaticResponseMeta  `bson:"static_response" json:"static_response,omitempty"`
 }
 
 type VersionInfo struct {
@@ -317,6 +419,15 @@ type CacheOptions struct {
 	EnableUpstreamCacheControl bool     `bson:"enable_upstream_cache_control" json:"enable_upstream_cache_control"`
 	CacheControlTTLHeader      string   `bson:"cache_control_ttl_header" json:"cache_control_ttl_header"`
 	CacheByHeaders             []string `bson:"cache_by_headers" json:"cache_by_headers"`
+	// BypassRangeRequests sends Range requests to the upstream instead of
+	// serving partial content from cached responses.
+	BypassRangeRequests bool `bson:"bypass_range_requests" json:"bypass_range_requests"`
+	// ServeStaleOnError serves the last cached 200 response, even expired,
+	// with a Warning header when the upstream fails, times out or answers
+	// with a 5xx status. Expired responses are kept for StaleGracePeriod
+	// seconds for this, which defaults to an hour.
+	ServeStaleOnError bool  `bson:"serve_stale_on_error" json:"serve_stale_on_error"`
+	StaleGracePeriod  int64 `bson:"stale_grace_period" json:"stale_grace_period"`
 }
 
 type ResponseProcessor struct {
@@ -333,6 +444,13 @@ type HostCheckObject struct {
 	Method              string            `bson:"method" json:"method"`
 	Headers             map[string]string `bson:"headers" json:"headers"`
 	Body                string            `bson:"body" json:"body"`
+	// Interval is the minimum number of seconds between two checks of this host,
+	// checks are never run more often than the global checker interval.
+	Interval int `bson:"interval" json:"interval,omitempty"`
+	// ExpectedStatusCodes are the response codes considered healthy, defaults to 200.
+	ExpectedStatusCodes []int `bson:"expected_status_codes" json:"expected_status_codes,omitempty"`
+	// BodyMatch is a regular expression the response body must match.
+	BodyMatch string `bson:"body_match" json:"body_match,omitempty"`
 }
 
 type CheckCommand struct {
@@ -383,6 +501,33 @@ type APIDefinition struct {
 		AllowedAccessTypes     []osin.AccessRequestType    `bson:"allowed_access_types" json:"allowed_access_types"`
 		AllowedAuthorizeTypes  []osin.AuthorizeRequestType `bson:"allowed_authorize_types" json:"allowed_authorize_types"`
 		AuthorizeLoginRedirect string                      `bson:"auth_login_redirect" json:"auth_login_redirect"`
+		// RefreshTokenExpire is how long, in seconds, refresh tokens are
+		// valid. Defaults to the gateway oauth_refresh_token_expire.
+		RefreshTokenExpire int64 `bson:"refresh_token_expire" json:"refresh_token_expire"`
+		// SessionLifetime is how long, in seconds, a session can be refreshed
+		// for after its first token was issued.
+		SessionLifetime int64 `bson:"session_lifetime" json:"session_lifetime"`
+		// IdleTimeout is how long, in seconds, a session can still be
+		// refreshed for once its access token expired.
+		IdleTimeout int64 `bson:"idle_timeout" json:"idle_timeout"`
+		// AccessTokenFormat is "jwt" to issue signed JWT access tokens
+		// instead of opaque ones.
+		AccessTokenFormat string `bson:"access_token_format" json:"access_token_format"`
+		// JWTSigningMethod is "hmac" or "rsa".
+		JWTSigningMethod string `bson:"jwt_signing_method" json:"jwt_signing_method"`
+		// JWTSigningKey is the HMAC secret, or the PEM encoded RSA private
+		// key, which may be base64 encoded. When no RSA key is set, the
+		// gateways generate one, store it in Redis encrypted with the node
+		// secret and publish it at /oauth/jwks. Tokens are issued once it
+		// is loaded.
+		JWTSigningKey string `bson:"jwt_signing_key" json:"jwt_signing_key"`
+		JWTIssuer     string `bson:"jwt_issuer" json:"jwt_issuer"`
+		// JWTClaims are added to the token claims. Their values are Go
+		// templates of the client, its policy and the session.
+		JWTClaims map[string]string `bson:"jwt_claims" json:"jwt_claims"`
+		// TokenExchange lets clients exchange the JWTs of an external
+		// identity provider for access tokens (RFC 8693).
+		TokenExchange OAuthTokenExchangeConfig `bson:"token_exchange" json:"token_exchange"`
 	} `bson:"oauth_meta" json:"oauth_meta"`
 	Auth         AuthConfig            `bson:"auth" json:"auth"` // Deprecated: Use AuthConfigs instead.
 	AuthConfigs  map[string]AuthConfig `bson:"auth_configs" json:"auth_configs"`
@@ -393,6 +538,9 @@ type APIDefinition struct {
 		ExtractFromBody    bool   `bson:"extract_from_body" json:"extract_from_body"`
 		BodyUserRegexp     string `bson:"body_user_regexp" json:"body_user_regexp"`
 		BodyPasswordRegexp string `bson:"body_password_regexp" json:"body_password_regexp"`
+		// LDAP validates credentials against a directory instead of the
+		// users stored in the gateway.
+		LDAP BasicAuthLDAPMeta `bson:"ldap" json:"ldap"`
 	} `bson:"basic_auth" json:"basic_auth"`
 	UseMutualTLSAuth           bool                 `bson:"use_mutual_tls_auth" json:"use_mutual_tls_auth"`
 	ClientCertificates         []string             `bson:"client_certificates" json:"client_certificates"`
@@ -414,6 +562,7 @@ type APIDefinition struct {
 	JWTSkipKid                 bool                 `bson:"jwt_skip_kid" json:"jwt_skip_kid"`
 	JWTScopeToPolicyMapping    map[string]string    `bson:"jwt_scope_to_policy_mapping" json:"jwt_scope_to_policy_mapping"`
 	JWTScopeClaimName          string               `bson:"jwt_scope_claim_name" json:"jwt_scope_claim_name"`
+	JWTDPoP                    DPoPMeta             `bson:"jwt_dpop" json:"jwt_dpop"`
 	NotificationsDetails       NotificationsManager `bson:"notifications" json:"notifications"`
 	EnableSignatureChecking    bool                 `bson:"enable_signature_checking" json:"enable_signature_checking"`
 	HmacAllowedClockSkew       float64              `bson:"hmac_allowed_clock_skew" json:"hmac_allowed_clock_skew"`
@@ -441,6 +590,7 @@ type APIDefinition struct {
 	Proxy                     ProxyConfig            `bson:"proxy" json:"proxy"`
 	DisableRateLimit          bool                   `bson:"disable_rate_limit" json:"disable_rate_limit"`
 	DisableQuota              bool                   `bson:"disable_quota" json:"disable_quota"`
+	EnableRateLimitHeaders    bool                   `bson:"enable_rate_limit_headers" json:"enable_rate_limit_headers"`
 	CustomMiddleware          MiddlewareSection      `bson:"custom_middleware" json:"custom_middleware"`
 	CustomMiddlewareBundle    string                 `bson:"custom_middleware_bundle" json:"custom_middleware_bundle"`
 	CacheOptions              CacheOptions           `bson:"cache_options" json:"cache_options"`
@@ -466,10 +616,54 @@ type APIDefinition struct {
 	EnableContextVars         bool                   `bson:"enable_context_vars" json:"enable_context_vars"`
 	ConfigData                map[string]interface{} `bson:"config_data" json:"config_data"`
 	TagHeaders                []string               `bson:"tag_headers" json:"tag_headers"`
+	TagListenPathParams       []string               `bson:"tag_listen_path_params" json:"tag_listen_path_params"`
 	GlobalRateLimit           GlobalRateLimit        `bson:"global_rate_limit" json:"global_rate_limit"`
 	StripAuthData             bool                   `bson:"strip_auth_data" json:"strip_auth_data"`
 	EnableDetailedRecording   bool                   `bson:"enable_detailed_recording" json:"enable_detailed_recording"`
 	GraphQL                   GraphQLConfig          `bson:"graphql" json:"graphql"`
+	Compression               CompressionConfig      `bson:"compression" json:"compression"`
+	StrictHeaders             StrictHeadersConfig    `bson:"strict_headers" json:"strict_headers"`
+	SecurityHeaders           SecurityHeadersConfig  `bson:"security_headers" json:"security_headers"`
+	TracePropagation          TracePropagationConfig `bson:"trace_propagation" json:"trace_propagation"`
+	JWSValidation             JWSValidationMeta      `bson:"jws_validation" json:"jws_validation"`
+	ExternalAuthz             ExternalAuthzMeta      `bson:"external_authz" json:"external_authz"`
+	ReplayProtection          ReplayProtectionMeta   `bson:"replay_protection" json:"replay_protection"`
+	JWE                       JWEMeta                `bson:"jwe" json:"jwe"`
+	FieldMasking              FieldMaskingMeta       `bson:"field_masking" json:"field_masking"`
+	// LoopLimit is the maximum number of internal loops (tyk:// targets)
+	// of requests entering the gateway through this API. Defaults to 5.
+	LoopLimit int `bson:"loop_limit" json:"loop_limit"`
+	// RateLimitKey counts the rate limit of keys per value of a request
+	// attribute, so that a key shared by the tenants of a partner is limited
+	// per tenant.
+	RateLimitKey RateLimitKeyMeta `bson:"rate_limit_key" json:"rate_limit_key"`
+	// AnonymousRateLimit rate limits the clients of keyless APIs by IP.
+	AnonymousRateLimit AnonymousRateLimitMeta `bson:"anonymous_rate_limit" json:"anonymous_rate_limit"`
+	// SlowRequests reports requests slower than its thresholds.
+	SlowRequests SlowRequestsMeta `bson:"slow_requests" json:"slow_requests"`
+	// TagRules derive analytics tags from request attributes.
+	TagRules []TagRuleMeta `bson:"tag_rules" json:"tag_rules"`
+	// SLO evaluates service level objectives against the traffic stats of
+	// the API.
+	SLO SLOMeta `bson:"slo" json:"slo"`
+	// PublishOAS publishes the public OpenAPI document of the API to the
+	// oas_publish path of the gateway, a directory, when the API changes.
+	// Internal and blacklisted endpoints are left out.
+	PublishOAS bool `bson:"publish_oas" json:"publish_oas"`
+	// TrafficSplit sends the requests matching a rule to an alternate
+	// upstream, instead of the targets of the API. The first rule matching
+	// a request applies.
+	TrafficSplit []TrafficSplitRule `bson:"traffic_split" json:"traffic_split"`
+	// Priority is the priority class of the requests to the API when the
+	// gateway sheds load, unless their policies or headers set one: high,
+	// normal or low. Defaults to normal.
+	Priority string `bson:"priority" json:"priority"`
+	// HeaderCasing keeps the case of header names set or proxied by the
+	// gateway, for upstreams expecting exact casing.
+	HeaderCasing HeaderCasingConfig `bson:"header_casing" json:"header_casing"`
+	// AccessLog writes a line for each request to the API, independently
+	// of analytics.
+	AccessLog AccessLogMeta `bson:"access_log" json:"access_log"`
 }
 
 type AuthConfig struct {
@@ -514,6 +708,336 @@ type RequestSigningMeta struct {
 	SignatureHeader string   `bson:"signature_header" json:"signature_header"`
 }
 
+// OAuthTokenExchangeConfig validates the subject tokens of token exchange
+// requests, which must be JWTs with an expiry, and maps their claims to the
+// policies of the issued access tokens.
+type OAuthTokenExchangeConfig struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// Source is the JWKS URL, or the base64 encoded public key or HMAC
+	// secret, that subject tokens are signed with.
+	Source string `bson:"source" json:"source"`
+	// SigningMethod is "rsa", "ecdsa" or "hmac".
+	SigningMethod string `bson:"signing_method" json:"signing_method"`
+	// Issuer and Audience, when set, must match the iss and aud claims.
+	Issuer   string `bson:"issuer" json:"issuer"`
+	Audience string `bson:"audience" json:"audience"`
+	// IdentityClaim identifies the subject. Defaults to sub.
+	IdentityClaim string `bson:"identity_claim" json:"identity_claim"`
+	// PolicyClaim holds the values, as a list or a space separated string,
+	// that PolicyMapping maps to policy IDs. Defaults to scope.
+	PolicyClaim   string            `bson:"policy_claim" json:"policy_claim"`
+	PolicyMapping map[string]string `bson:"policy_mapping" json:"policy_mapping"`
+}
+
+// JWSValidationMeta validates the detached JWS signatures of request bodies,
+// as used by Open Banking APIs. The signature is a compact JWS with an empty
+// payload, sent in Header, and is verified with a key of the JWKS at JWKSURL
+// or one of PinnedKeys. Unencoded payloads (RFC 7797) are supported.
+type JWSValidationMeta struct {
+	IsEnabled bool `bson:"is_enabled" json:"is_enabled"`
+	// Header carries the signature. Defaults to x-jws-signature.
+	Header string `bson:"header" json:"header"`
+	// AllowedAlgorithms lists the accepted "alg" of signatures. Defaults
+	// to PS256, RS256 and ES256.
+	AllowedAlgorithms []string `bson:"allowed_algorithms" json:"allowed_algorithms"`
+	// JWKSURL is the JWKS the key matching the "kid" of signatures is
+	// looked up in.
+	JWKSURL string `bson:"jwks_url" json:"jwks_url"`
+	// PinnedKeys are IDs of public keys of the certificate store, or paths
+	// to PEM public keys, tried in turn.
+	PinnedKeys []string `bson:"pinned_keys" json:"pinned_keys"`
+}
+
+// ReplayProtectionMeta rejects replays of requests signed with HMAC or
+// detached JWS signatures. Signatures must be recent, and their nonces are
+// remembered to reject them the second time they are seen.
+type ReplayProtectionMeta struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// NonceHeader carries the nonce of HMAC signed requests, and must be
+	// one of their signed headers. The signature is the nonce otherwise.
+	// JWS signatures use the "jti" of their protected header, or themselves.
+	NonceHeader string `bson:"nonce_header" json:"nonce_header"`
+	// Window is how far, in seconds, the date of signatures may be from the
+	// gateway clock. Defaults to 300. Nonces are remembered twice as long.
+	Window int64 `bson:"window" json:"window"`
+}
+
+// JWEMeta decrypts JWE encrypted request bodies, and encrypts the responses
+// of the consumers whose session metadata holds a public key, so upstreams
+// only deal with plaintext.
+type JWEMeta struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// DecryptionKeys are IDs of certificates of the certificate store with
+	// private keys, tried in turn.
+	DecryptionKeys []string `bson:"decryption_keys" json:"decryption_keys"`
+	// RequireEncryption rejects requests with a plaintext body.
+	RequireEncryption bool `bson:"require_encryption" json:"require_encryption"`
+	// ResponseKeyMetadata is the session metadata field holding the public
+	// key responses are encrypted with, as PEM or as the ID of a public key
+	// of the certificate store. Responses aren't encrypted when unset.
+	ResponseKeyMetadata string `bson:"response_key_metadata" json:"response_key_metadata"`
+	// KeyAlgorithm is the "alg" of encrypted responses. Defaults to
+	// RSA-OAEP-256 for RSA keys and ECDH-ES+A256KW for EC keys.
+	KeyAlgorithm string `bson:"key_algorithm" json:"key_algorithm"`
+	// ContentEncryption is the "enc" of encrypted responses. Defaults to
+	// A256GCM.
+	ContentEncryption string `bson:"content_encryption" json:"content_encryption"`
+}
+
+// FieldMaskingMeta masks fields of JSON responses depending on the caller,
+// whose masking profile is read from its session metadata, usually set by
+// its policies. Responses to callers with rules that aren't JSON are
+// blocked, as are APIs with an invalid rule.
+type FieldMaskingMeta struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// ProfileMetadata is the session metadata field holding the masking
+	// profile of callers. Defaults to masking_profile.
+	ProfileMetadata string             `bson:"profile_metadata" json:"profile_metadata"`
+	Rules           []FieldMaskingRule `bson:"rules" json:"rules"`
+}
+
+// FieldMaskingRule masks the fields matching a JSONPath, such as
+// $.customer.email or $.cards[*].number.
+type FieldMaskingRule struct {
+	Path string `bson:"path" json:"path"`
+	// Strategy is one of redact, hash, partial or remove. Defaults to
+	// redact.
+	Strategy string `bson:"strategy" json:"strategy"`
+	// VisibleChars is how many trailing characters partial masking keeps.
+	// Defaults to 4.
+	VisibleChars int `bson:"visible_chars" json:"visible_chars"`
+	// Profiles are the masking profiles the rule applies to. Rules without
+	// profiles apply to every caller, and callers without a profile get
+	// every rule.
+	Profiles []string `bson:"profiles" json:"profiles"`
+}
+
+// RateLimitKeyMeta reads the value the rate limit of a key is counted per
+// from requests.
+type RateLimitKeyMeta struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// Source is one of header, path_segment, path_param or jwt_claim. JWT
+	// claims are read from the context variables.
+	Source string `bson:"source" json:"source"`
+	// Name is the name of the header, listen path parameter or claim.
+	Name string `bson:"name" json:"name"`
+	// Index is the position of the path segment after the listen path,
+	// starting at 0.
+	Index int `bson:"index" json:"index"`
+	// Fallback is what happens to requests without a valid value: key
+	// counts them with the key, reject rejects them with a 400. Defaults to
+	// key. Values are valid up to 64 letters, digits, '-', '_' and '.'.
+	Fallback string `bson:"fallback" json:"fallback"`
+	// Rate and Per are the rate limit of each value. They default to the
+	// rate limit of the key, which also applies to all values together.
+	Rate float64 `bson:"rate" json:"rate"`
+	Per  float64 `bson:"per" json:"per"`
+}
+
+// TagRuleMeta derives an analytics tag from a request attribute, as
+// tag-value.
+type TagRuleMeta struct {
+	// Tag prefixes the tags. Defaults to the name of the attribute, or
+	// to segment-<index> for path segments.
+	Tag string `bson:"tag" json:"tag"`
+	// Source is one of header, path_segment, path_param, query_param or
+	// jwt_claim. JWT claims are read from the context variables.
+	Source string `bson:"source" json:"source"`
+	// Name is the name of the header, listen path or query parameter, or
+	// claim.
+	Name string `bson:"name" json:"name"`
+	// Index is the position of the path segment after the listen path,
+	// starting at 0.
+	Index int `bson:"index" json:"index"`
+	// Hash tags a hash of the value instead of the value, for sensitive
+	// values such as emails.
+	Hash bool `bson:"hash" json:"hash"`
+}
+
+// TrafficSplitRule sends the requests with a header or cookie, a random
+// percentage of them, or both, to an alternate upstream, such as a beta or
+// canary deployment. A rule without any condition matches all requests.
+type TrafficSplitRule struct {
+	// Variant names the rule, requests are tagged with variant-<name> in
+	// analytics.
+	Variant string `bson:"variant" json:"variant"`
+	// Target is the upstream URL of the matching requests.
+	Target string `bson:"target" json:"target"`
+	// Header and Cookie match the requests that have them, and with Value
+	// if it is set.
+	Header string `bson:"header" json:"header"`
+	Cookie string `bson:"cookie" json:"cookie"`
+	Value  string `bson:"value" json:"value"`
+	// Percentage, from 0 to 100, matches a random share of the requests.
+	// 0 disables the condition.
+	Percentage float64 `bson:"percentage" json:"percentage"`
+}
+
+// SLOMeta fires an SLABreach event when the API stops meeting one of its
+// objectives, as measured from the traffic stats of the gateway.
+type SLOMeta struct {
+	Enabled    bool          `bson:"enabled" json:"enabled"`
+	Objectives []SLObjective `bson:"objectives" json:"objectives"`
+}
+
+// SLObjective is a latency or error rate objective over a window, such as
+// 99% of requests under 300ms over 5 minutes. Percentages are from 0 to 100,
+// a target or threshold of 0 is disabled.
+type SLObjective struct {
+	Name string `bson:"name" json:"name"`
+	// Window is in seconds, up to 900. Defaults to 300.
+	Window int64 `bson:"window" json:"window"`
+	// LatencyThreshold, in milliseconds, is the latency LatencyTarget
+	// percent of requests must stay under.
+	LatencyThreshold int64   `bson:"latency_threshold" json:"latency_threshold"`
+	LatencyTarget    float64 `bson:"latency_target" json:"latency_target"`
+	// MaxErrorRate is the percentage of requests that may be answered
+	// with a 5xx status.
+	MaxErrorRate float64 `bson:"max_error_rate" json:"max_error_rate"`
+	// MinRequests is how many requests the window needs for the objective
+	// to be evaluated, not to breach on a handful of them.
+	MinRequests uint64 `bson:"min_requests" json:"min_requests"`
+}
+
+// AnonymousRateLimitMeta rate limits each client IP, or network of client
+// IPs, of a keyless API.
+type AnonymousRateLimitMeta struct {
+	Enabled bool    `bson:"enabled" json:"enabled"`
+	Rate    float64 `bson:"rate" json:"rate"`
+	Per     float64 `bson:"per" json:"per"`
+	// TrustedProxies are the IPs or CIDR ranges of the proxies in front of
+	// the gateway. The client IP is read from the X-Forwarded-For header
+	// of requests sent by them, and is the IP of the connection otherwise.
+	TrustedProxies []string `bson:"trusted_proxies" json:"trusted_proxies"`
+	// IPv4PrefixLength counts the clients of a network together, such as
+	// 24 for a /24. Defaults to 32.
+	IPv4PrefixLength int `bson:"ipv4_prefix_length" json:"ipv4_prefix_length"`
+	// IPv6PrefixLength counts the clients of a network together. Defaults
+	// to 64, as clients usually get a whole /64.
+	IPv6PrefixLength int `bson:"ipv6_prefix_length" json:"ipv6_prefix_length"`
+}
+
+// SlowRequestsMeta logs a warning and fires a SlowRequest event for requests
+// slower than its thresholds, in milliseconds. A threshold of 0 is disabled.
+type SlowRequestsMeta struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// Threshold applies to the whole request, from the gateway receiving
+	// it to the response being sent.
+	Threshold int64 `bson:"threshold" json:"threshold"`
+	// UpstreamThreshold applies to the time spent waiting on the upstream.
+	UpstreamThreshold int64 `bson:"upstream_threshold" json:"upstream_threshold"`
+}
+
+// AccessLogMeta writes the requests to an API to an access log.
+type AccessLogMeta struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// Format is common or combined, the formats of Apache, or a template of
+	// the fields of a request such as {{.Method}} {{.URI}} {{.Status}}.
+	// Defaults to combined.
+	Format string `bson:"format" json:"format"`
+	// Output is stdout, stderr or the path of a file relative to the
+	// access_log_dir of the gateway. Defaults to stdout.
+	Output string `bson:"output" json:"output"`
+	// MaxSize rotates the file once it reaches this size, in megabytes.
+	// Defaults to 100.
+	MaxSize int `bson:"max_size" json:"max_size"`
+	// MaxBackups is the number of rotated files kept. Defaults to 5.
+	MaxBackups int `bson:"max_backups" json:"max_backups"`
+	// SampleRate is the fraction of requests logged, from 0 to 1. 0 logs
+	// all requests.
+	SampleRate float64 `bson:"sample_rate" json:"sample_rate"`
+}
+
+// DPoPMeta validates the DPoP proofs (demonstrating proof-of-possession) of
+// requests authenticated with JWTs. Tokens with a "cnf" claim are bound to
+// the key of the proof, and can't be used without one.
+type DPoPMeta struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// Required rejects JWTs sent without a proof, as bearer tokens.
+	Required bool `bson:"required" json:"required"`
+	// AllowedAlgorithms lists the accepted "alg" of proofs. Defaults to
+	// RS256, PS256 and ES256.
+	AllowedAlgorithms []string `bson:"allowed_algorithms" json:"allowed_algorithms"`
+	// MaxAge is how old, in seconds, the "iat" of proofs may be. Defaults
+	// to 300. Proofs are remembered as long to reject replays.
+	MaxAge int64 `bson:"max_age" json:"max_age"`
+}
+
+// BasicAuthLDAPMeta validates basic auth credentials by binding to an LDAP or
+// Active Directory server as the user. The groups of the user are mapped to
+// the policies of its session. Successful binds are cached like the password
+// checks of gateway users.
+type BasicAuthLDAPMeta struct {
+	Enabled bool   `bson:"enabled" json:"enabled"`
+	Server  string `bson:"server" json:"server"`
+	// Port defaults to 636 with ldaps and to 389 otherwise.
+	Port uint16 `bson:"port" json:"port"`
+	// TLS is "starttls" or "ldaps". Connections are unencrypted otherwise.
+	TLS                string `bson:"tls" json:"tls"`
+	InsecureSkipVerify bool   `bson:"insecure_skip_verify" json:"insecure_skip_verify"`
+	// BindDN is the DN users bind as, where {username} is replaced by the
+	// username, such as "uid={username},ou=people,dc=example,dc=com", or
+	// "{username}@example.com" for Active Directory.
+	BindDN string `bson:"bind_dn" json:"bind_dn"`
+	// UserFilter, when set, looks up the entry of the user under BaseDN,
+	// such as "(sAMAccountName={username})". The BindDN entry is read
+	// otherwise.
+	BaseDN     string `bson:"base_dn" json:"base_dn"`
+	UserFilter string `bson:"user_filter" json:"user_filter"`
+	// GroupAttribute lists the groups of the user entry. Defaults to
+	// memberOf.
+	GroupAttribute string `bson:"group_attribute" json:"group_attribute"`
+	// GroupPolicies maps group DNs to policy IDs. Users in no mapped group
+	// get DefaultPolicy, or are denied when it isn't set.
+	GroupPolicies map[string]string `bson:"group_policies" json:"group_policies"`
+	DefaultPolicy string            `bson:"default_policy" json:"default_policy"`
+	// MaxConnections is the number of idle connections kept open to the
+	// server. Defaults to 5.
+	MaxConnections int `bson:"max_connections" json:"max_connections"`
+	// Timeout is in seconds. Defaults to 5.
+	Timeout float64 `bson:"timeout" json:"timeout"`
+}
+
+// ExternalAuthzMeta sends the metadata of requests to an external
+// authorization service, such as a policy decision point, which allows or
+// denies them and may return headers to add to them.
+//
+// HTTP services receive the metadata as a JSON POST and allow requests with
+// a 2xx response, whose JSON body may list headers. gRPC services implement
+// GRPCMethod, which takes the metadata and returns the decision as a
+// google.protobuf.Struct with "allowed", "status_code", "message" and
+// "headers" fields. Denials with a status code other than a 4xx are 403s.
+type ExternalAuthzMeta struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// Protocol is "http" or "grpc". Defaults to http.
+	Protocol string `bson:"protocol" json:"protocol"`
+	// URL is the URL of the HTTP service, or the host:port of the gRPC one.
+	URL string `bson:"url" json:"url"`
+	// GRPCMethod defaults to /tyk.ExternalAuthz/Check.
+	GRPCMethod string `bson:"grpc_method" json:"grpc_method"`
+	// Timeout is in seconds. Defaults to 2.
+	Timeout float64 `bson:"timeout" json:"timeout"`
+	// FailOpen allows requests when the service can't be reached or fails,
+	// which are otherwise denied.
+	FailOpen bool `bson:"fail_open" json:"fail_open"`
+	// CacheTTL caches the decisions for identical requests, in seconds.
+	CacheTTL int64 `bson:"cache_ttl" json:"cache_ttl"`
+	// CacheHeaders are the request headers the decisions depend on. When
+	// set, the other headers don't tell requests apart in the cache.
+	CacheHeaders []string `bson:"cache_headers" json:"cache_headers"`
+	// IncludeBody sends the request body too.
+	IncludeBody bool `bson:"include_body" json:"include_body"`
+	// Headers are sent to the service with each check, such as the
+	// credentials of the gateway. They are gRPC metadata for gRPC services.
+	Headers map[string]string `bson:"headers" json:"headers"`
+	// Certificate is the ID of the client certificate presented to the
+	// service.
+	Certificate string `bson:"certificate" json:"certificate"`
+	// GRPCInsecure connects to the gRPC service without TLS, which is used
+	// by default.
+	GRPCInsecure bool `bson:"grpc_insecure" json:"grpc_insecure"`
+}
+
 type ProxyConfig struct {
 	PreserveHostHeader          bool                          `bson:"preserve_host_header" json:"preserve_host_header"`
 	ListenPath                  string                        `bson:"listen_path" json:"listen_path"`
@@ -532,7 +1056,146 @@ type ProxyConfig struct {
 		SSLMaxVersion           uint16   `bson:"ssl_max_version" json:"ssl_max_version"`
 		SSLForceCommonNameCheck bool     `json:"ssl_force_common_name_check"`
 		ProxyURL                string   `bson:"proxy_url" json:"proxy_url"`
+		ForceHTTP2              bool     `bson:"force_http2" json:"force_http2"`
+		MaxConnsPerHost         int      `bson:"max_conns_per_host" json:"max_conns_per_host"`
+		MaxIdleConns            int      `bson:"max_idle_conns" json:"max_idle_conns"`
+		MaxIdleConnsPerHost     int      `bson:"max_idle_conns_per_host" json:"max_idle_conns_per_host"`
+		// IdleConnTimeout and TCPKeepAlive are in seconds, a negative
+		// TCPKeepAlive disables keep-alive probes.
+		IdleConnTimeout int64 `bson:"idle_conn_timeout" json:"idle_conn_timeout"`
+		TCPKeepAlive    int64 `bson:"tcp_keep_alive" json:"tcp_keep_alive"`
+		// ProxyUsername and ProxyPassword authenticate to the proxy of
+		// ProxyURL. The password can be a secret reference such as
+		// env://name.
+		ProxyUsername string `bson:"proxy_username" json:"proxy_username"`
+		ProxyPassword string `bson:"proxy_password" json:"proxy_password"`
+		// ProxyCertificateID is the client certificate presented to an
+		// HTTPS proxy.
+		ProxyCertificateID string `bson:"proxy_certificate_id" json:"proxy_certificate_id"`
+		// NoProxy are the upstreams reached without the proxy, with the
+		// semantics of NO_PROXY: host names matching their subdomains too,
+		// IP addresses and CIDR ranges, with an optional port, or *.
+		NoProxy []string `bson:"no_proxy" json:"no_proxy"`
 	} `bson:"transport" json:"transport"`
+	DNS DNSConfig `bson:"dns" json:"dns"`
+	// UpstreamProxyProtocol is the version, 1 or 2, of the PROXY protocol
+	// header sent to the upstream of TCP and TLS services, so that it can
+	// see the address of the client. No header is sent when it is 0.
+	UpstreamProxyProtocol int `bson:"upstream_proxy_protocol" json:"upstream_proxy_protocol,omitempty"`
+	// MaxResponseBodySize caps the size of upstream responses in bytes,
+	// overriding the limit of the gateway. A negative value disables it.
+	MaxResponseBodySize int64 `bson:"max_response_body_size" json:"max_response_body_size,omitempty"`
+}
+
+// DNSConfig holds the DNS resolution options used when dialing the upstream.
+type DNSConfig struct {
+	// Overrides are static host to IP mappings, taking precedence over DNS.
+	Overrides []DNSOverride `bson:"overrides" json:"overrides"`
+	// Resolver is the address (host:port) of the DNS server to use instead
+	// of the system resolver.
+	Resolver string `bson:"resolver" json:"resolver"`
+	// TTL overrides the global DNS cache TTL in seconds. Setting it enables
+	// DNS caching for the API even if disabled globally.
+	TTL int64 `bson:"ttl" json:"ttl"`
+	// NegativeTTL overrides the global negative DNS cache TTL in seconds.
+	NegativeTTL int64 `bson:"negative_ttl" json:"negative_ttl"`
+	// MaxEntries overrides the global limit of hosts in the DNS cache.
+	MaxEntries int `bson:"max_entries" json:"max_entries"`
+}
+
+type DNSOverride struct {
+	Host string   `bson:"host" json:"host"`
+	IPs  []string `bson:"ips" json:"ips"`
+}
+
+// Enabled returns true if any of the DNS options is set.
+func (d DNSConfig) Enabled() bool {
+	return len(d.Overrides) > 0 || d.Resolver != "" || d.TTL > 0 || d.NegativeTTL > 0 || d.MaxEntries > 0
+}
+
+// CompressionConfig controls how compressed upstream responses are handled
+// and whether responses are compressed for clients.
+type CompressionConfig struct {
+	// DecompressUpstream decodes gzip, deflate and brotli encoded upstream
+	// responses before the response middleware runs, so that body transforms
+	// work against the plain payload.
+	DecompressUpstream bool `bson:"decompress_upstream" json:"decompress_upstream"`
+	// Enabled compresses uncompressed responses for clients accepting one of
+	// the configured algorithms.
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// Algorithms lists the supported encodings ("br", "gzip") in order of
+	// preference. Defaults to brotli, then gzip.
+	Algorithms []string `bson:"algorithms" json:"algorithms"`
+	// MinSize is the minimum response size in bytes to compress. Responses
+	// of unknown length are always compressed.
+	MinSize int64 `bson:"min_size" json:"min_size"`
+	// ContentTypes limits compression to the listed media types, all types
+	// are compressed when empty.
+	ContentTypes []string `bson:"content_types" json:"content_types"`
+}
+
+// StrictHeadersConfig restricts the headers exchanged with the upstream to
+// allow lists. Hop-by-hop and message framing headers are always kept.
+type StrictHeadersConfig struct {
+	// Request limits the request headers sent to the upstream.
+	Request HeaderAllowList `bson:"request" json:"request"`
+	// Response limits the upstream response headers returned to clients,
+	// headers added by response middleware are not affected.
+	Response HeaderAllowList `bson:"response" json:"response"`
+}
+
+// SecurityHeadersConfig sets browser security headers on all responses, they
+// replace the ones set by the upstream. Options of an API override the non
+// empty options of the gateway configuration.
+type SecurityHeadersConfig struct {
+	Enabled bool       `bson:"enabled" json:"enabled"`
+	HSTS    HSTSConfig `bson:"hsts" json:"hsts"`
+	// ContentTypeOptions sets "X-Content-Type-Options: nosniff".
+	ContentTypeOptions    bool   `bson:"content_type_options" json:"content_type_options"`
+	ContentSecurityPolicy string `bson:"content_security_policy" json:"content_security_policy"`
+	FrameOptions          string `bson:"frame_options" json:"frame_options"`
+	ReferrerPolicy        string `bson:"referrer_policy" json:"referrer_policy"`
+	PermissionsPolicy     string `bson:"permissions_policy" json:"permissions_policy"`
+}
+
+// TracePropagationConfig selects the formats of the trace context headers
+// ("w3c", "b3", "b3-single", "jaeger") read from requests and sent upstream,
+// converting between them when they differ.
+type TracePropagationConfig struct {
+	// Inbound lists the formats the trace context of requests is read
+	// from, in order of preference. Defaults to the format of the tracer.
+	Inbound []string `bson:"inbound" json:"inbound"`
+	// Outbound lists the formats the trace context is sent upstream in,
+	// replacing the headers of the other formats. Defaults to the format
+	// of the tracer, or to forwarding the headers as received if tracing
+	// is disabled.
+	Outbound []string `bson:"outbound" json:"outbound"`
+}
+
+// HSTSConfig sets the Strict-Transport-Security header, when MaxAge, in
+// seconds, is set.
+type HSTSConfig struct {
+	MaxAge            int64 `bson:"max_age" json:"max_age"`
+	IncludeSubdomains bool  `bson:"include_subdomains" json:"include_subdomains"`
+	Preload           bool  `bson:"preload" json:"preload"`
+}
+
+// HeaderCasingConfig controls the canonicalization of header names for an
+// API, on top of ignore_canonical_mime_header_key in the gateway
+// configuration.
+type HeaderCasingConfig struct {
+	// IgnoreCanonical keeps the case of all header names set by middleware,
+	// as they are configured.
+	IgnoreCanonical bool `bson:"ignore_canonical" json:"ignore_canonical"`
+	// Preserve lists headers always written with the casing given here,
+	// such as SOAPAction, including those received from clients and
+	// upstreams.
+	Preserve []string `bson:"preserve" json:"preserve"`
+}
+
+type HeaderAllowList struct {
+	Enabled bool     `bson:"enabled" json:"enabled"`
+	Allowed []string `bson:"allowed" json:"allowed"`
 }
 
 type CORSConfig struct {
@@ -545,6 +1208,9 @@ type CORSConfig struct {
 	MaxAge             int      `bson:"max_age" json:"max_age"`
 	OptionsPassthrough bool     `bson:"options_passthrough" json:"options_passthrough"`
 	Debug              bool     `bson:"debug" json:"debug"`
+	// DeriveAllowedMethods answers preflight requests with the methods
+	// defined for the endpoint in the white list and ignored paths.
+	DeriveAllowedMethods bool `bson:"derive_allowed_methods" json:"derive_allowed_methods"`
 }
 
 // GraphQLConfig is the root config object for a GraphQL API.
@@ -606,6 +1272,35 @@ type GraphQLEngineDataSource struct {
 	Internal   bool                        `bson:"internal" json:"internal"`
 	RootFields []GraphQLTypeFields         `bson:"root_fields" json:"root_fields"`
 	Config     json.RawMessage             `bson:"config" json:"config"`
+	// UpstreamAuth is how the engine authenticates to the upstream of the
+	// data source.
+	UpstreamAuth GraphQLEngineDataSourceAuth `bson:"upstream_auth" json:"upstream_auth"`
+}
+
+// GraphQLEngineDataSourceAuth is the upstream authentication of a data
+// source. Options can be combined, such as OAuth2 over mutual TLS.
+type GraphQLEngineDataSourceAuth struct {
+	// OAuth2 sends an access token obtained with the client credentials
+	// grant.
+	OAuth2 ClientCredentialsConfig `bson:"oauth2" json:"oauth2"`
+	// RequestSigning signs requests, the same way as the request signing of
+	// APIs.
+	RequestSigning RequestSigningMeta `bson:"request_signing" json:"request_signing"`
+	// CertificateID is the client certificate presented for mutual TLS.
+	CertificateID string `bson:"certificate_id" json:"certificate_id"`
+}
+
+// ClientCredentialsConfig fetches access tokens with the OAuth2 client
+// credentials grant. Tokens are cached until they expire.
+type ClientCredentialsConfig struct {
+	Enabled      bool     `bson:"enabled" json:"enabled"`
+	ClientID     string   `bson:"client_id" json:"client_id"`
+	ClientSecret string   `bson:"client_secret" json:"client_secret"`
+	TokenURL     string   `bson:"token_url" json:"token_url"`
+	Scopes       []string `bson:"scopes" json:"scopes"`
+	// Header is the header the token is sent in, as a bearer token in
+	// Authorization by default.
+	Header string `bson:"header" json:"header"`
 }
 
 type GraphQLTypeFields struct {
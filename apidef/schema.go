@@ -69,6 +69,9 @@ const Schema = `{
         "disable_quota": {
             "type": "boolean"
         },
+        "enable_rate_limit_headers": {
+            "type": "boolean"
+        },
         "custom_middleware_bundle": {
             "type": "string"
         },
@@ -162,12 +165,102 @@ const Schema = `{
         "tag_headers": {
             "type": ["array", "null"]
         },
+        "tag_listen_path_params": {
+            "type": ["array", "null"]
+        },
+        "tag_rules": {
+            "type": ["array", "null"],
+            "items": {
+                "type": "object",
+                "properties": {
+                    "tag": {
+                        "type": "string"
+                    },
+                    "source": {
+                        "type": "string",
+                        "enum": ["header", "path_segment", "path_param", "query_param", "jwt_claim"]
+                    },
+                    "name": {
+                        "type": "string"
+                    },
+                    "index": {
+                        "type": "integer",
+                        "minimum": 0
+                    },
+                    "hash": {
+                        "type": "boolean"
+                    }
+                },
+                "required": ["source"]
+            }
+        },
         "basic_auth": {
             "type": ["object", "null"]
         },
         "CORS": {
             "type":["object", "null"]
         },
+        "strict_headers": {
+            "type": ["object", "null"],
+            "properties": {
+                "request": {
+                    "type": ["object", "null"]
+                },
+                "response": {
+                    "type": ["object", "null"]
+                }
+            }
+        },
+        "security_headers": {
+            "type": ["object", "null"],
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "hsts": {
+                    "type": ["object", "null"]
+                },
+                "content_type_options": {
+                    "type": "boolean"
+                },
+                "content_security_policy": {
+                    "type": "string"
+                },
+                "frame_options": {
+                    "type": "string"
+                },
+                "referrer_policy": {
+                    "type": "string"
+                },
+                "permissions_policy": {
+                    "type": "string"
+                }
+            }
+        },
+        "compression": {
+            "type": ["object", "null"],
+            "properties": {
+                "decompress_upstream": {
+                    "type": "boolean"
+                },
+                "enabled": {
+                    "type": "boolean"
+                },
+                "algorithms": {
+                    "type": ["array", "null"],
+                    "items": {
+                        "type": "string",
+                        "enum": ["br", "gzip"]
+                    }
+                },
+                "min_size": {
+                    "type": "number"
+                },
+                "content_types": {
+                    "type": ["array", "null"]
+                }
+            }
+        },
         "response_processors": {
             "type": ["array", "null"]
         },
@@ -232,6 +325,391 @@ const Schema = `{
         "internal": {
             "type": "boolean"
         },
+        "loop_limit": {
+            "type": "number"
+        },
+        "anonymous_rate_limit": {
+            "type": ["object", "null"],
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "rate": {
+                    "type": "number"
+                },
+                "per": {
+                    "type": "number"
+                },
+                "trusted_proxies": {
+                    "type": ["array", "null"],
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "ipv4_prefix_length": {
+                    "type": "integer",
+                    "minimum": 0,
+                    "maximum": 32
+                },
+                "ipv6_prefix_length": {
+                    "type": "integer",
+                    "minimum": 0,
+                    "maximum": 128
+                }
+            }
+        },
+        "slow_requests": {
+            "type": ["object", "null"],
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "threshold": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "upstream_threshold": {
+                    "type": "integer",
+                    "minimum": 0
+                }
+            }
+        },
+        "traffic_split": {
+            "type": ["array", "null"],
+            "items": {
+                "type": "object",
+                "properties": {
+                    "variant": {
+                        "type": "string"
+                    },
+                    "target": {
+                        "type": "string"
+                    },
+                    "header": {
+                        "type": "string"
+                    },
+                    "cookie": {
+                        "type": "string"
+                    },
+                    "value": {
+                        "type": "string"
+                    },
+                    "percentage": {
+                        "type": "number",
+                        "minimum": 0,
+                        "maximum": 100
+                    }
+                },
+                "required": ["target"]
+            }
+        },
+        "publish_oas": {
+            "type": "boolean"
+        },
+        "priority": {
+            "type": "string",
+            "enum": ["", "high", "normal", "low"]
+        },
+        "slo": {
+            "type": ["object", "null"],
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "objectives": {
+                    "type": ["array", "null"],
+                    "items": {
+                        "type": "object",
+                        "properties": {
+                            "name": {
+                                "type": "string"
+                            },
+                            "window": {
+                                "type": "integer",
+                                "minimum": 0,
+                                "maximum": 900
+                            },
+                            "latency_threshold": {
+                                "type": "integer",
+                                "minimum": 0
+                            },
+                            "latency_target": {
+                                "type": "number",
+                                "minimum": 0,
+                                "maximum": 100
+                            },
+                            "max_error_rate": {
+                                "type": "number",
+                                "minimum": 0,
+                                "maximum": 100
+                            },
+                            "min_requests": {
+                                "type": "integer",
+                                "minimum": 0
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "access_log": {
+            "type": ["object", "null"],
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "format": {
+                    "type": "string"
+                },
+                "output": {
+                    "type": "string"
+                },
+                "max_size": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "max_backups": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "sample_rate": {
+                    "type": "number",
+                    "minimum": 0,
+                    "maximum": 1
+                }
+            }
+        },
+        "header_casing": {
+            "type": ["object", "null"],
+            "properties": {
+                "ignore_canonical": {
+                    "type": "boolean"
+                },
+                "preserve": {
+                    "type": ["array", "null"],
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "rate_limit_key": {
+            "type": ["object", "null"],
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "source": {
+                    "type": "string",
+                    "enum": ["", "header", "path_segment", "path_param", "jwt_claim"]
+                },
+                "name": {
+                    "type": "string"
+                },
+                "index": {
+                    "type": "integer"
+                },
+                "fallback": {
+                    "type": "string",
+                    "enum": ["", "key", "reject"]
+                },
+                "rate": {
+                    "type": "number"
+                },
+                "per": {
+                    "type": "number"
+                }
+            }
+        },
+        "jwt_dpop": {
+            "type": ["object", "null"],
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "required": {
+                    "type": "boolean"
+                },
+                "allowed_algorithms": {
+                    "type": ["array", "null"],
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "max_age": {
+                    "type": "number"
+                }
+            }
+        },
+        "external_authz": {
+            "type": ["object", "null"],
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "protocol": {
+                    "type": "string",
+                    "enum": ["", "http", "grpc"]
+                },
+                "url": {
+                    "type": "string"
+                },
+                "grpc_method": {
+                    "type": "string"
+                },
+                "timeout": {
+                    "type": "number"
+                },
+                "fail_open": {
+                    "type": "boolean"
+                },
+                "cache_ttl": {
+                    "type": "number"
+                },
+                "cache_headers": {
+                    "type": ["array", "null"],
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "include_body": {
+                    "type": "boolean"
+                },
+                "headers": {
+                    "type": ["object", "null"],
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "certificate": {
+                    "type": "string"
+                },
+                "grpc_insecure": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "jws_validation": {
+            "type": ["object", "null"],
+            "properties": {
+                "is_enabled": {
+                    "type": "boolean"
+                },
+                "header": {
+                    "type": "string"
+                },
+                "allowed_algorithms": {
+                    "type": ["array", "null"],
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "jwks_url": {
+                    "type": "string"
+                },
+                "pinned_keys": {
+                    "type": ["array", "null"],
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "replay_protection": {
+            "type": ["object", "null"],
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "nonce_header": {
+                    "type": "string"
+                },
+                "window": {
+                    "type": "integer"
+                }
+            }
+        },
+        "jwe": {
+            "type": ["object", "null"],
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "decryption_keys": {
+                    "type": ["array", "null"],
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "require_encryption": {
+                    "type": "boolean"
+                },
+                "response_key_metadata": {
+                    "type": "string"
+                },
+                "key_algorithm": {
+                    "type": "string"
+                },
+                "content_encryption": {
+                    "type": "string"
+                }
+            }
+        },
+        "field_masking": {
+            "type": ["object", "null"],
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "profile_metadata": {
+                    "type": "string"
+                },
+                "rules": {
+                    "type": ["array", "null"],
+                    "items": {
+                        "type": "object",
+                        "properties": {
+                            "path": {
+                                "type": "string"
+                            },
+                            "strategy": {
+                                "type": "string",
+                                "enum": ["", "redact", "hash", "partial", "remove"]
+                            },
+                            "visible_chars": {
+                                "type": "integer"
+                            },
+                            "profiles": {
+                                "type": ["array", "null"],
+                                "items": {
+                                    "type": "string"
+                                }
+                            }
+                        },
+                        "required": ["path"]
+                    }
+                }
+            }
+        },
+        "trace_propagation": {
+            "type": ["object", "null"],
+            "properties": {
+                "inbound": {
+                    "type": ["array", "null"],
+                    "items": {
+                        "type": "string",
+                        "enum": ["w3c", "b3", "b3-single", "jaeger"]
+                    }
+                },
+                "outbound": {
+                    "type": ["array", "null"],
+                    "items": {
+                        "type": "string",
+                        "enum": ["w3c", "b3", "b3-single", "jaeger"]
+                    }
+                }
+            }
+        },
         "auth": {
             "type": ["object", "null"],
             "id": "http://jsonschema.net/auth",
@@ -328,8 +806,68 @@ const Schema = `{
                         },
                         "ssl_force_common_name_check": {
                             "type": "boolean"
+                        },
+                        "force_http2": {
+                            "type": "boolean"
+                        },
+                        "max_conns_per_host": {
+                            "type": "number"
+                        },
+                        "max_idle_conns": {
+                            "type": "number"
+                        },
+                        "max_idle_conns_per_host": {
+                            "type": "number"
+                        },
+                        "idle_conn_timeout": {
+                            "type": "number"
+                        },
+                        "tcp_keep_alive": {
+                            "type": "number"
+                        },
+                        "proxy_username": {
+                            "type": "string"
+                        },
+                        "proxy_password": {
+                            "type": "string"
+                        },
+                        "proxy_certificate_id": {
+                            "type": "string"
+                        },
+                        "no_proxy": {
+                            "type": ["array", "null"],
+                            "items": {
+                                "type": "string"
+                            }
                         }
                     }
+                },
+                "dns": {
+                    "type": ["object", "null"],
+                    "properties": {
+                        "overrides": {
+                            "type": ["array", "null"]
+                        },
+                        "resolver": {
+                            "type": "string"
+                        },
+                        "ttl": {
+                            "type": "number"
+                        },
+                        "negative_ttl": {
+                            "type": "number"
+                        },
+                        "max_entries": {
+                            "type": "integer"
+                        }
+                    }
+                },
+                "upstream_proxy_protocol": {
+                    "type": "integer",
+                    "enum": [0, 1, 2]
+                },
+                "max_response_body_size": {
+                    "type": "integer"
                 }
             },
             "required": [
@@ -550,6 +1088,40 @@ const Schema = `{
                                 },
                                 "config": {
                                     "type": ["object", "null"]
+                                },
+                                "upstream_auth": {
+                                    "type": ["object", "null"],
+                                    "properties": {
+                                        "oauth2": {
+                                            "type": ["object", "null"],
+                                            "properties": {
+                                                "enabled": {
+                                                    "type": "boolean"
+                                                },
+                                                "client_id": {
+                                                    "type": "string"
+                                                },
+                                                "client_secret": {
+                                                    "type": "string"
+                                                },
+                                                "token_url": {
+                                                    "type": "string"
+                                                },
+                                                "scopes": {
+                                                    "type": ["array", "null"]
+                                                },
+                                                "header": {
+                                                    "type": "string"
+                                                }
+                                            }
+                                        },
+                                        "request_signing": {
+                                            "type": ["object", "null"]
+                                        },
+                                        "certificate_id": {
+                                            "type": "string"
+                                        }
+                                    }
                                 }
                             },
                             "required": [
@@ -11,6 +11,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/hex"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"io/ioutil"
@@ -227,6 +228,36 @@ type CertificateMeta struct {
 	NotBefore     time.Time `json:"not_before,omitempty"`
 	NotAfter      time.Time `json:"not_after,omitempty"`
 	DNSNames      []string  `json:"dns_names,omitempty"`
+
+	Metadata *CertificateMetadata `json:"metadata,omitempty"`
+}
+
+// CertificateMetadata describes a certificate for the people managing it.
+type CertificateMetadata struct {
+	Name  string   `json:"name,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+	Owner string   `json:"owner,omitempty"`
+	Notes string   `json:"notes,omitempty"`
+}
+
+// Matches reports whether the metadata has the given name, owner and tag.
+// Empty values match any metadata.
+func (m CertificateMetadata) Matches(name, owner, tag string) bool {
+	if name != "" && m.Name != name {
+		return false
+	}
+	if owner != "" && m.Owner != owner {
+		return false
+	}
+	if tag == "" {
+		return true
+	}
+	for _, t := range m.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
 }
 
 func ExtractCertificateMeta(cert *tls.Certificate, certID string) *CertificateMeta {
@@ -332,6 +363,57 @@ func GetCertIDAndChainPEM(certData []byte, secret string) (string, []byte, error
 	return certID, certChainPEM, nil
 }
 
+// SplitPEMBundle splits a bundle of PEM encoded certificates and public keys
+// into one PEM per certificate or public key, so that each can be added on
+// its own. A private key goes with the certificate it matches. As each
+// certificate is split from the others, chains are not kept.
+func SplitPEMBundle(data []byte) ([][]byte, error) {
+	var certBlocks, keyBlocks, publicKeyBlocks [][]byte
+
+	rest := data
+	for {
+		var block *pem.Block
+
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		switch {
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			keyBlocks = append(keyBlocks, pem.EncodeToMemory(block))
+		case block.Type == "CERTIFICATE":
+			certBlocks = append(certBlocks, pem.EncodeToMemory(block))
+		case block.Type == "PUBLIC KEY":
+			publicKeyBlocks = append(publicKeyBlocks, pem.EncodeToMemory(block))
+		}
+	}
+
+	if len(certBlocks) == 0 && len(publicKeyBlocks) == 0 {
+		return nil, errors.New("Failed to decode certificate bundle. It should be PEM encoded.")
+	}
+
+	paired := make([]bool, len(certBlocks))
+	for _, keyPEM := range keyBlocks {
+		found := false
+		for i, certPEM := range certBlocks {
+			if paired[i] {
+				continue
+			}
+			if _, err := tls.X509KeyPair(certPEM, keyPEM); err == nil {
+				certBlocks[i] = append(append(certPEM, '\n'), keyPEM...)
+				paired[i], found = true, true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.New("Private key does not match any certificate of the bundle")
+		}
+	}
+
+	return append(certBlocks, publicKeyBlocks...), nil
+}
+
 func (c *CertificateManager) List(certIDs []string, mode CertificateType) (out []*tls.Certificate) {
 	var cert *tls.Certificate
 	var rawCert []byte
@@ -521,9 +603,38 @@ func (c *CertificateManager) Delete(certID string, orgID string) {
 	}
 
 	c.storage.DeleteKey("raw-" + certID)
+	c.storage.DeleteKey("meta-" + certID)
 	c.cache.Delete(certID)
 }
 
+// GetMetadata returns the metadata of a certificate, and false if it has none.
+func (c *CertificateManager) GetMetadata(certID string) (CertificateMetadata, bool) {
+	var meta CertificateMetadata
+
+	val, err := c.storage.GetKey("meta-" + certID)
+	if err != nil {
+		return meta, false
+	}
+	if err := json.Unmarshal([]byte(val), &meta); err != nil {
+		c.logger.Error("Error while parsing certificate metadata: ", certID, " ", err)
+		return meta, false
+	}
+	return meta, true
+}
+
+// SetMetadata replaces the metadata of an existing certificate.
+func (c *CertificateManager) SetMetadata(certID string, meta CertificateMetadata) error {
+	if _, err := c.storage.GetKey("raw-" + certID); err != nil {
+		return errors.New("Certificate with " + certID + " id not found")
+	}
+
+	val, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return c.storage.SetKey("meta-"+certID, string(val), 0)
+}
+
 func (c *CertificateManager) CertPool(certIDs []string) *x509.CertPool {
 	pool := x509.NewCertPool()
 
@@ -537,15 +648,21 @@ func (c *CertificateManager) CertPool(certIDs []string) *x509.CertPool {
 }
 
 func (c *CertificateManager) ValidateRequestCertificate(certIDs []string, r *http.Request) error {
-	if r.TLS == nil {
+	return c.ValidateConnectionCertificate(certIDs, r.TLS)
+}
+
+// ValidateConnectionCertificate checks that the client certificate of a TLS
+// connection is one of certIDs.
+func (c *CertificateManager) ValidateConnectionCertificate(certIDs []string, state *tls.ConnectionState) error {
+	if state == nil {
 		return errors.New("TLS not enabled")
 	}
 
-	if len(r.TLS.PeerCertificates) == 0 {
+	if len(state.PeerCertificates) == 0 {
 		return errors.New("Client TLS certificate is required")
 	}
 
-	leaf := r.TLS.PeerCertificates[0]
+	leaf := state.PeerCertificates[0]
 
 	certID := HexSHA256(leaf.Raw)
 	for _, cert := range c.List(certIDs, CertificatePublic) {
@@ -209,6 +209,64 @@ func TestAddCertificate(t *testing.T) {
 	}
 }
 
+func TestSplitPEMBundle(t *testing.T) {
+	certPem, _ := genCertificateFromCommonName("public", false)
+	cert2Pem, key2Pem := genCertificateFromCommonName("private", false)
+	_, otherKeyPem := genCertificateFromCommonName("other", false)
+	priv, _ := rsa.GenerateKey(rand.Reader, 512)
+	privDer, _ := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	pubPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: privDer})
+
+	// The private key comes first, it goes with the certificate it matches
+	bundle := bytes.Join([][]byte{key2Pem, certPem, pubPem, cert2Pem}, []byte("\n"))
+	parts, err := SplitPEMBundle(bundle)
+	assert.NoError(t, err)
+	assert.Len(t, parts, 3)
+
+	m := newManager()
+	var names []string
+	for _, part := range parts {
+		id, err := m.Add(part, "")
+		assert.NoError(t, err)
+		cert := m.List([]string{id}, CertificateAny)[0]
+		names = append(names, leafSubjectName(cert))
+		assert.Equal(t, leafSubjectName(cert) == "private", !isPrivateKeyEmpty(cert))
+	}
+	assert.Equal(t, []string{"public", "private", "Public Key: " + HexSHA256(privDer)}, names)
+
+	_, err = SplitPEMBundle(append(certPem, otherKeyPem...))
+	assert.EqualError(t, err, "Private key does not match any certificate of the bundle")
+
+	_, err = SplitPEMBundle([]byte("not a bundle"))
+	assert.Error(t, err)
+}
+
+func TestCertificateMetadata(t *testing.T) {
+	m := newManager()
+	certPem, _ := genCertificateFromCommonName("test", false)
+	certID, _ := m.Add(certPem, "")
+
+	_, ok := m.GetMetadata(certID)
+	assert.False(t, ok)
+
+	meta := CertificateMetadata{Name: "partner", Tags: []string{"mtls", "prod"}, Owner: "ops"}
+	assert.NoError(t, m.SetMetadata(certID, meta))
+	assert.Error(t, m.SetMetadata("missing", meta))
+
+	stored, ok := m.GetMetadata(certID)
+	assert.True(t, ok)
+	assert.Equal(t, meta, stored)
+
+	assert.True(t, stored.Matches("", "", ""))
+	assert.True(t, stored.Matches("partner", "ops", "prod"))
+	assert.False(t, stored.Matches("", "", "staging"))
+	assert.False(t, stored.Matches("other", "", ""))
+
+	m.Delete(certID, "")
+	_, ok = m.GetMetadata(certID)
+	assert.False(t, ok)
+}
+
 func TestCertificateStorage(t *testing.T) {
 	m := newManager()
 	dir, _ := ioutil.TempDir("", "certs")
@@ -38,6 +38,9 @@ var (
 	DebugMode *bool
 	// LogInstrumentation outputs instrumentation data to stdout.
 	LogInstrumentation *bool
+	// ValidateConfig validates the configuration, API definitions and
+	// policies, then exits.
+	ValidateConfig *bool
 
 	// DefaultMode is set when default command is used.
 	DefaultMode bool
@@ -64,6 +67,7 @@ func Init(version string, confPaths []string) {
 	HTTPProfile = startCmd.Flag("httpprofile", "expose runtime profiling data via HTTP").Bool()
 	DebugMode = startCmd.Flag("debug", "enable debug mode").Bool()
 	LogInstrumentation = startCmd.Flag("log-intrumentation", "output intrumentation output to stdout").Bool()
+	ValidateConfig = startCmd.Flag("validate-config", "validate the configuration, API definitions and policies, then exit").Bool()
 
 	startCmd.Action(func(ctx *kingpin.ParseContext) error {
 		DefaultMode = true
@@ -15,25 +15,41 @@ import (
 // config file that was checked, a list of warnings and an error, if any
 // happened.
 func Run(schm string, paths []string) (string, []string, error) {
-	addFormats(&schema.FormatCheckers)
 	var conf config.Config
 	if err := config.Load(paths, &conf); err != nil {
 		return "", nil, err
 	}
+	warns, err := Check(schm, conf.OriginalPath)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// ensure it's well formatted and the keys are all lowercase
+	if err := config.WriteConf(conf.OriginalPath, &conf); err != nil {
+		return "", nil, err
+	}
+
+	return conf.OriginalPath, warns, nil
+}
+
+// Check validates the configuration file at path against the schema, without
+// modifying it, and returns a list of warnings.
+func Check(schm string, path string) ([]string, error) {
+	addFormats(&schema.FormatCheckers)
 	schemaLoader := schema.NewBytesLoader([]byte(schm))
 
 	var orig map[string]interface{}
-	f, err := os.Open(conf.OriginalPath)
+	f, err := os.Open(path)
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
 	defer f.Close()
 	if err := json.NewDecoder(f).Decode(&orig); err != nil {
-		return "", nil, err
+		return nil, err
 	}
 	if v, ok := orig["Monitor"]; ok {
 		// As the old confs wrongly capitalized this key. Would
-		// be fixed by WriteConf below, but we want the JSON
+		// be fixed by WriteConf, but we want the JSON
 		// schema to not flag this error.
 		orig["monitor"] = v
 		delete(orig, "Monitor")
@@ -42,15 +58,9 @@ func Run(schm string, paths []string) (string, []string, error) {
 	fileLoader := schema.NewGoLoader(orig)
 	result, err := schema.Validate(schemaLoader, fileLoader)
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
-
-	// ensure it's well formatted and the keys are all lowercase
-	if err := config.WriteConf(conf.OriginalPath, &conf); err != nil {
-		return "", nil, err
-	}
-
-	return conf.OriginalPath, resultWarns(result), nil
+	return resultWarns(result), nil
 }
 
 type stringFormat func(string) bool
@@ -0,0 +1,364 @@
+// Package condition implements the expressions deciding whether a middleware
+// runs for a request.
+//
+// An expression compares attributes, referred to by name, with string
+// literals or other attributes:
+//
+//	header.X-Beta == "true" && (meta.tier != "free" || method =~ "^(GET|HEAD)$")
+//
+// Supported operators are == and != for equality, =~ for regular expression
+// matches, &&, || and ! for logic, and parentheses. An attribute on its own
+// holds when it isn't empty. Attribute names are made of letters, digits and
+// "_", "-" or ".", and are resolved by the caller.
+package condition
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Attributes resolves the attributes of a request by name.
+type Attributes func(name string) string
+
+// Condition is a parsed expression.
+type Condition struct {
+	expr       string
+	root       node
+	references []string
+}
+
+// Parse parses an expression.
+func Parse(expr string) (*Condition, error) {
+	p := &parser{lexer: lexer{input: expr}}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokenEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	return &Condition{expr: expr, root: root, references: p.references}, nil
+}
+
+// Eval reports whether the condition holds for attrs.
+func (c *Condition) Eval(attrs Attributes) bool {
+	return c.root.eval(attrs)
+}
+
+// References returns the names of the attributes the condition refers to.
+func (c *Condition) References() []string {
+	return c.references
+}
+
+func (c *Condition) String() string {
+	return c.expr
+}
+
+type node interface {
+	eval(Attributes) bool
+}
+
+type operand interface {
+	value(Attributes) string
+}
+
+type literal string
+
+func (l literal) value(Attributes) string {
+	return string(l)
+}
+
+type reference string
+
+func (r reference) value(attrs Attributes) string {
+	return attrs(string(r))
+}
+
+// present holds when an operand isn't empty.
+type present struct {
+	operand operand
+}
+
+func (n present) eval(attrs Attributes) bool {
+	return n.operand.value(attrs) != ""
+}
+
+type equal struct {
+	left, right operand
+	negate      bool
+}
+
+func (n equal) eval(attrs Attributes) bool {
+	return (n.left.value(attrs) == n.right.value(attrs)) != n.negate
+}
+
+type match struct {
+	operand operand
+	re      *regexp.Regexp
+}
+
+func (n match) eval(attrs Attributes) bool {
+	return n.re.MatchString(n.operand.value(attrs))
+}
+
+type not struct {
+	node node
+}
+
+func (n not) eval(attrs Attributes) bool {
+	return !n.node.eval(attrs)
+}
+
+type and struct {
+	left, right node
+}
+
+func (n and) eval(attrs Attributes) bool {
+	return n.left.eval(attrs) && n.right.eval(attrs)
+}
+
+type or struct {
+	left, right node
+}
+
+func (n or) eval(attrs Attributes) bool {
+	return n.left.eval(attrs) || n.right.eval(attrs)
+}
+
+type parser struct {
+	lexer
+	tok        token
+	references []string
+}
+
+func (p *parser) next() error {
+	tok, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("condition %q at %d: %s", p.input, p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokenOr {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = or{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokenAnd {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = and{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	switch p.tok.kind {
+	case tokenNot:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return not{n}, nil
+	case tokenLParen:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokenRParen {
+			return nil, p.errorf("expected ), got %s", p.tok)
+		}
+		return n, p.next()
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.tok.kind {
+	case tokenEqual, tokenNotEqual:
+		negate := p.tok.kind == tokenNotEqual
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return equal{left, right, negate}, nil
+	case tokenMatch:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokenString {
+			return nil, p.errorf("expected a regular expression string, got %s", p.tok)
+		}
+		re, err := regexp.Compile(p.tok.text)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		return match{left, re}, p.next()
+	}
+	return present{left}, nil
+}
+
+func (p *parser) parseOperand() (operand, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokenString:
+		return literal(tok.text), p.next()
+	case tokenIdent:
+		p.references = append(p.references, tok.text)
+		return reference(tok.text), p.next()
+	}
+	return nil, p.errorf("expected an attribute or a string, got %s", tok)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenEqual
+	tokenNotEqual
+	tokenMatch
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of condition"
+	case tokenString:
+		return fmt.Sprintf("%q", t.text)
+	}
+	return t.text
+}
+
+var errUnterminatedString = errors.New("unterminated string")
+
+type lexer struct {
+	input string
+	pos   int
+}
+
+// operators are the operators by their text, longest first.
+var operators = []struct {
+	text string
+	kind tokenKind
+}{
+	{"==", tokenEqual},
+	{"!=", tokenNotEqual},
+	{"=~", tokenMatch},
+	{"&&", tokenAnd},
+	{"||", tokenOr},
+	{"!", tokenNot},
+	{"(", tokenLParen},
+	{")", tokenRParen},
+}
+
+func isIdentStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func isIdent(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9' || c == '-' || c == '.'
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.input) && strings.IndexByte(" \t\r\n", l.input[l.pos]) >= 0 {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos == len(l.input) {
+		return token{kind: tokenEOF, pos: start}, nil
+	}
+
+	rest := l.input[l.pos:]
+	for _, op := range operators {
+		if strings.HasPrefix(rest, op.text) {
+			l.pos += len(op.text)
+			return token{kind: op.kind, text: op.text, pos: start}, nil
+		}
+	}
+
+	switch c := rest[0]; {
+	case c == '"' || c == '\'':
+		var text strings.Builder
+		for i := 1; i < len(rest); i++ {
+			switch rest[i] {
+			case c:
+				l.pos += i + 1
+				return token{kind: tokenString, text: text.String(), pos: start}, nil
+			case '\\':
+				if i+1 < len(rest) {
+					i++
+				}
+			}
+			text.WriteByte(rest[i])
+		}
+		return token{}, fmt.Errorf("condition %q at %d: %v", l.input, start, errUnterminatedString)
+	case isIdentStart(c):
+		end := 1
+		for end < len(rest) && isIdent(rest[end]) {
+			end++
+		}
+		l.pos += end
+		return token{kind: tokenIdent, text: rest[:end], pos: start}, nil
+	}
+	return token{}, fmt.Errorf("condition %q at %d: unexpected %q", l.input, start, rest[0])
+}
@@ -0,0 +1,71 @@
+package condition
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditionEval(t *testing.T) {
+	attrs := map[string]string{
+		"method":        "GET",
+		"header.X-Beta": "true",
+		"meta.tier":     "gold",
+		"query.q":       `say "hi"`,
+	}
+	lookup := func(name string) string { return attrs[name] }
+
+	tests := []struct {
+		expr  string
+		holds bool
+	}{
+		{`header.X-Beta == "true"`, true},
+		{`header.X-Beta != "true"`, false},
+		{`"gold" == meta.tier`, true},
+		{`meta.tier == 'silver'`, false},
+		{`header.X-Beta`, true},
+		{`header.X-Other`, false},
+		{`!header.X-Other`, true},
+		{`method =~ "^(GET|HEAD)$"`, true},
+		{`meta.tier =~ "^s"`, false},
+		{`header.X-Beta == "true" && meta.tier == "silver"`, false},
+		{`header.X-Beta == "true" || meta.tier == "silver"`, true},
+		{`meta.tier == "silver" || header.X-Beta == "true" && method == "GET"`, true},
+		{`(meta.tier == "silver" || header.X-Beta == "true") && method == "POST"`, false},
+		{`!(method == "POST")`, true},
+		{`query.q == "say \"hi\""`, true},
+		{`method == method`, true},
+	}
+	for _, tc := range tests {
+		c, err := Parse(tc.expr)
+		if !assert.NoError(t, err, tc.expr) {
+			continue
+		}
+		assert.Equal(t, tc.holds, c.Eval(lookup), tc.expr)
+		assert.Equal(t, tc.expr, c.String())
+	}
+}
+
+func TestConditionReferences(t *testing.T) {
+	c, err := Parse(`header.X-Beta == "true" && (meta.tier || !ctx.flag)`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"header.X-Beta", "meta.tier", "ctx.flag"}, c.References())
+}
+
+func TestConditionParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`header.X-Beta ==`,
+		`header.X-Beta == "true`,
+		`(method == "GET"`,
+		`method == "GET")`,
+		`method =~ path`,
+		`method =~ "("`,
+		`method = "GET"`,
+		`"a" "b"`,
+		`1method`,
+	} {
+		_, err := Parse(expr)
+		assert.Error(t, err, expr)
+	}
+}
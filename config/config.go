@@ -68,6 +68,13 @@ type PoliciesConfig struct {
 	PolicyConnectionString string `json:"policy_connection_string"`
 	PolicyRecordName       string `json:"policy_record_name"`
 	AllowExplicitPolicyID  bool   `json:"allow_explicit_policy_id"`
+	// DefaultPolicies are applied to the keys of each org, by org ID,
+	// created without any policies or access rights. The default_policies
+	// metadata of an org session takes precedence.
+	DefaultPolicies map[string][]string `json:"default_policies"`
+	// KeyTemplateRecordName is the JSON file of the key templates by ID,
+	// which keys can be created from with /tyk/keys/create?template=ID.
+	KeyTemplateRecordName string `json:"key_template_record_name"`
 }
 
 type DBAppConfOptionsConfig struct {
@@ -93,6 +100,21 @@ type StorageOptionsConf struct {
 	EnableCluster         bool              `json:"enable_cluster"`
 	UseSSL                bool              `json:"use_ssl"`
 	SSLInsecureSkipVerify bool              `json:"ssl_insecure_skip_verify"`
+	// MaxRetries is how many times commands failing with transient errors,
+	// such as during failovers, are retried. Defaults to 3, -1 disables
+	// retries.
+	MaxRetries int `json:"max_retries"`
+	// MinRetryBackoff and MaxRetryBackoff bound the backoff between
+	// retries, in milliseconds. Default to 8 and 512, -1 disables backoff.
+	MinRetryBackoff int `json:"min_retry_backoff"`
+	MaxRetryBackoff int `json:"max_retry_backoff"`
+	// MaxRedirects is how many MOVED and ASK redirects of a cluster are
+	// followed. Defaults to 3.
+	MaxRedirects int `json:"max_redirects"`
+	// CounterBufferSize is how many rate limit and quota counter updates are
+	// kept in memory while Redis is unavailable, to be written once it
+	// recovers. 0 disables the buffer.
+	CounterBufferSize int `json:"counter_buffer_size"`
 }
 
 type NormalisedURLConfig struct {
@@ -138,6 +160,12 @@ type DnsCacheConfig struct {
 	TTL                       int64             `json:"ttl"`
 	CheckInterval             int64             `json:"-" ignored:"true"` //controls cache cleanup interval. By convention shouldn't be exposed to config or env_variable_setup
 	MultipleIPsHandleStrategy IPsHandleStrategy `json:"multiple_ips_handle_strategy"`
+	// NegativeTTL caches hosts which don't resolve for this many seconds.
+	// 0 disables negative caching.
+	NegativeTTL int64 `json:"negative_ttl"`
+	// MaxEntries limits the number of hosts in cache, evicting the least
+	// recently used ones. 0 means no limit.
+	MaxEntries int `json:"max_entries"`
 }
 
 type MonitorConfig struct {
@@ -148,6 +176,76 @@ type MonitorConfig struct {
 	MonitorOrgKeys        bool               `json:"monitor_org_keys"`
 }
 
+// KeyExpiryAuditConfig configures the daily report of keys that are about to expire.
+type KeyExpiryAuditConfig struct {
+	// EnableWebhook sends the report to Webhook once a day.
+	EnableWebhook bool `json:"enable_webhook"`
+	// Window is how far ahead, in seconds, the report looks. Defaults to 72 hours.
+	Window  int64              `json:"window"`
+	Webhook WebHookHandlerConf `json:"webhook"`
+}
+
+// CertificateExpiryConfig configures the checks of certificates about to expire.
+type CertificateExpiryConfig struct {
+	// Enabled fires a CertificateExpiring event when a client CA or upstream
+	// certificate used by an API is about to expire.
+	Enabled bool `json:"enabled"`
+	// WarningDays are the lead times, in days, at which the event is fired,
+	// once each per certificate. Defaults to 30, 7 and 1.
+	WarningDays []int `json:"warning_days"`
+	// CheckInterval is how often, in seconds, certificates are checked. Defaults to an hour.
+	CheckInterval int64 `json:"check_interval"`
+}
+
+// BackupConfig configures the snapshots of API definitions, policies and
+// certificate metadata taken through the backup API.
+type BackupConfig struct {
+	// Path is the directory snapshots are written to when they are stored
+	// rather than downloaded, e.g. a mounted object storage bucket.
+	Path string `json:"path"`
+}
+
+// OASPublishConfig configures the publishing of the public OpenAPI documents
+// of APIs, for developer portals and documentation sites.
+type OASPublishConfig struct {
+	// Path is the directory the documents of APIs with publish_oas are
+	// written to, as <api id>.json, when they change. The documents aren't
+	// uploaded to object storage by the gateway: to publish them to an S3 or
+	// GCS bucket, the directory has to be a mount of the bucket or synced to
+	// it.
+	Path string `json:"path"`
+}
+
+// KeyspaceEventsConfig configures the stream of key changes sent to an external system.
+type KeyspaceEventsConfig struct {
+	// Enabled sends the key creations, updates and deletions made through
+	// the Gateway API and TykSetKeyData, and the OAuth access tokens issued
+	// and revoked, in batches to TargetURL. Changes synced from RPC, key
+	// rehashing and the session updates made while proxying requests, such
+	// as quota counters, aren't sent.
+	Enabled   bool              `json:"enabled"`
+	TargetURL string            `json:"target_url"`
+	Headers   map[string]string `json:"headers"`
+	// OrgIDs limits the events to the listed organisations.
+	OrgIDs []string `json:"org_ids"`
+	// BatchSize is the maximum number of events per request. Defaults to 100.
+	BatchSize int `json:"batch_size"`
+	// FlushInterval is how often, in seconds, pending events are sent. Defaults to 5.
+	FlushInterval int64 `json:"flush_interval"`
+}
+
+// OauthTokenPurgeConfig configures the background purge of lapsed tokens from the OAuth client token lists.
+type OauthTokenPurgeConfig struct {
+	// Enabled purges, on one gateway of the cluster at a time, the tokens
+	// that expired more than oauth_token_expired_retain_period seconds ago.
+	Enabled bool `json:"enabled"`
+	// Interval is how often, in seconds, tokens are purged. Defaults to 1 hour.
+	Interval int64 `json:"interval"`
+	// BatchSize is the number of client token lists purged before pausing
+	// briefly, to limit the load on Redis. Defaults to 100.
+	BatchSize int `json:"batch_size"`
+}
+
 type WebHookHandlerConf struct {
 	Method       string            `bson:"method" json:"method"`
 	TargetPath   string            `bson:"target_path" json:"target_path"`
@@ -186,6 +284,9 @@ type HttpServerOptionsConfig struct {
 	UseSSL                 bool       `json:"use_ssl"`
 	UseLE_SSL              bool       `json:"use_ssl_le"`
 	EnableHttp2            bool       `json:"enable_http2"`
+	EnableHttp3            bool       `json:"enable_http3"`
+	Http3Domains           []string   `json:"http3_domains"`
+	Http3AltSvcMaxAge      int        `json:"http3_alt_svc_max_age"`
 	SSLInsecureSkipVerify  bool       `json:"ssl_insecure_skip_verify"`
 	EnableWebSockets       bool       `json:"enable_websockets"`
 	Certificates           []CertData `json:"certificates"`
@@ -197,6 +298,117 @@ type HttpServerOptionsConfig struct {
 	SkipURLCleaning        bool       `json:"skip_url_cleaning"`
 	SkipTargetPathEscaping bool       `json:"skip_target_path_escaping"`
 	Ciphers                []string   `json:"ssl_ciphers"`
+
+	// ConnectionLimits are the client connection limits of every listen
+	// port, unless overridden in PortConnectionLimits.
+	ConnectionLimits ConnectionLimitsConfig `json:"connection_limits"`
+	// PortConnectionLimits overrides ConnectionLimits for single listen
+	// ports, keyed by the port number.
+	PortConnectionLimits map[string]ConnectionLimitsConfig `json:"port_connection_limits"`
+	// CertificateReloadInterval is how often, in seconds, the certificate
+	// and key files are checked for changes, which are then served without
+	// a restart. 0 disables the check.
+	CertificateReloadInterval int `json:"certificate_reload_interval"`
+	// RequestHardening rejects ambiguous requests that could be used to
+	// smuggle requests past the gateway.
+	RequestHardening RequestHardeningConfig `json:"request_hardening"`
+}
+
+// RequestHardeningConfig rejects requests with a 400 status before they are
+// proxied. The framing and header checks read the raw HTTP/1 requests, once
+// decrypted on TLS listeners. Connections are closed after a request asking
+// for a protocol upgrade that is refused.
+type RequestHardeningConfig struct {
+	// RejectConflictingFraming rejects requests with both Transfer-Encoding
+	// and Content-Length headers, and HTTP/1.0 requests with a
+	// Transfer-Encoding header.
+	RejectConflictingFraming bool `json:"reject_conflicting_framing"`
+	// RejectObsFold rejects requests with header values folded over
+	// several lines.
+	RejectObsFold bool `json:"reject_obs_fold"`
+	// AllowedMethods rejects requests with other methods. Empty allows all
+	// methods.
+	AllowedMethods []string `json:"allowed_methods"`
+}
+
+// ConnectionLimitsConfig limits the client connections of a listen port, so
+// that a single client can't exhaust the file descriptors of the node.
+type ConnectionLimitsConfig struct {
+	// MaxConnections is the maximum number of concurrent connections.
+	// Further connections wait to be accepted. 0 means no limit.
+	MaxConnections int `json:"max_connections"`
+	// MaxRequestsPerConnection closes a connection after it served this
+	// many requests. 0 means no limit.
+	MaxRequestsPerConnection int `json:"max_requests_per_connection"`
+	// IdleTimeout closes keep-alive connections idle for this many
+	// seconds. 0 falls back to the read timeout.
+	IdleTimeout int `json:"idle_timeout"`
+}
+
+// LoadSheddingConfig configures the shedding of requests by priority class
+// when the node is under load: low priority requests are shed first, high
+// priority ones never.
+type LoadSheddingConfig struct {
+	Enabled bool `json:"enabled"`
+	// Elevated is the load from which low priority requests are shed.
+	Elevated LoadThresholds `json:"elevated"`
+	// Overloaded is the load from which normal priority requests are shed
+	// too.
+	Overloaded LoadThresholds `json:"overloaded"`
+	// LowPriorityDelay is how long, in milliseconds, low priority requests
+	// wait for the load to drop before they are shed. 0 sheds them at once.
+	LowPriorityDelay int `json:"low_priority_delay"`
+	// PriorityHeader is the request header a priority class is read from.
+	// Clients setting it may only lower the priority of their requests.
+	PriorityHeader string `json:"priority_header"`
+	// PriorityHeaderValues maps values of the priority header to priority
+	// classes. When empty, the value is the class itself.
+	PriorityHeaderValues map[string]string `json:"priority_header_values"`
+}
+
+// LoadThresholds are the thresholds of a load state, any of which puts the
+// node in that state. 0 disables a threshold.
+type LoadThresholds struct {
+	// InFlight is the number of requests being served.
+	InFlight int64 `json:"in_flight"`
+	// Latency is the moving average of the latency of requests, in
+	// milliseconds.
+	Latency float64 `json:"latency"`
+}
+
+// SelfProtectionConfig configures the self-protection mode, which the node
+// enters when its heap or goroutines grow past a limit rather than being
+// killed for running out of memory. New requests are then rejected, but for
+// the control API and health check, and the in-memory caches trimmed, until
+// usage drops below 90% of the limits.
+type SelfProtectionConfig struct {
+	Enabled bool `json:"enabled"`
+	// MaxHeapMB is the heap in use, in megabytes, from which the node
+	// protects itself. 0 disables the limit.
+	MaxHeapMB int `json:"max_heap_mb"`
+	// MaxGoroutines is the number of goroutines from which the node
+	// protects itself. 0 disables the limit.
+	MaxGoroutines int `json:"max_goroutines"`
+	// CheckInterval is how often, in seconds, usage is checked. Defaults
+	// to 1.
+	CheckInterval int `json:"check_interval"`
+	// RetryAfter is the Retry-After, in seconds, of rejected requests.
+	// Defaults to 5.
+	RetryAfter int `json:"retry_after"`
+}
+
+// SessionFallbackConfig configures the session fallback, which keeps the
+// sessions recently validated in memory so that their keys keep working
+// while Redis is unavailable. Keys never seen by the node, or not used
+// within the TTL, are still rejected during an outage.
+type SessionFallbackConfig struct {
+	Enabled bool `json:"enabled"`
+	// TTL is how long, in seconds, a validated session is kept. Defaults
+	// to 300.
+	TTL int `json:"ttl"`
+	// MaxSize is how many sessions are kept, the least recently used are
+	// evicted first. Defaults to 10000.
+	MaxSize int `json:"max_size"`
 }
 
 type AuthOverrideConf struct {
@@ -244,6 +456,39 @@ type SecurityConfig struct {
 	ControlAPIUseMutualTLS           bool               `json:"control_api_use_mutual_tls"`
 	PinnedPublicKeys                 map[string]string  `json:"pinned_public_keys"`
 	Certificates                     CertificatesConfig `json:"certificates"`
+
+	// ControlAPIProtection rate limits the control API and locks out
+	// clients guessing the secret.
+	ControlAPIProtection ControlAPIProtectionConfig `json:"control_api_protection"`
+	// ControlAPIAllowList restricts the control API to clients of a list of
+	// networks.
+	ControlAPIAllowList ControlAPIAllowListConfig `json:"control_api_allow_list"`
+}
+
+// ControlAPIAllowListConfig restricts the /tyk/ endpoints to client IPs.
+type ControlAPIAllowListConfig struct {
+	// CIDRs are the networks, or single IPs, allowed to use the control
+	// API. Empty allows all clients.
+	CIDRs []string `json:"cidrs"`
+	// TrustedProxies are the networks of the proxies, such as internal
+	// load balancers, whose X-Forwarded-For header is honored to find the
+	// client IP.
+	TrustedProxies []string `json:"trusted_proxies"`
+}
+
+// ControlAPIProtectionConfig limits the control API requests of a client IP.
+type ControlAPIProtectionConfig struct {
+	// RateLimit is the number of requests a client can make every
+	// RateLimitPer seconds, which must then be positive. 0 disables the
+	// rate limit.
+	RateLimit    int `json:"rate_limit"`
+	RateLimitPer int `json:"rate_limit_per"`
+	// MaxFailedAttempts locks out a client after this many requests with an
+	// invalid secret within FailureWindow seconds. 0 disables the lockout.
+	MaxFailedAttempts int `json:"max_failed_attempts"`
+	FailureWindow     int `json:"failure_window"`
+	// LockoutDuration is the number of seconds a client stays locked out.
+	LockoutDuration int `json:"lockout_duration"`
 }
 
 type NewRelicConfig struct {
@@ -305,6 +550,22 @@ func (r PortRange) Match(port int) bool {
 	return r.From <= port && r.To >= port
 }
 
+// UnmatchedRequestConfig sets the response to requests matching no API. The
+// first of APIID and RedirectURL set is used, or else the status and body.
+type UnmatchedRequestConfig struct {
+	// StatusCode is the status of the response, 404 by default, or of the
+	// redirect, 302 by default.
+	StatusCode int `json:"status_code"`
+	// Body is the JSON body of the response.
+	Body string `json:"body"`
+	// Headers are added to the response.
+	Headers map[string]string `json:"headers"`
+	// RedirectURL redirects the requests to a URL, such as documentation.
+	RedirectURL string `json:"redirect_url"`
+	// APIID forwards the requests to a catch-all API.
+	APIID string `json:"api_id"`
+}
+
 // Config is the configuration object used by tyk to set up various parameters.
 type Config struct {
 	// OriginalPath is the path to the config file that was read. If
@@ -317,6 +578,8 @@ type Config struct {
 	ListenPort                int                     `json:"listen_port"`
 	ControlAPIHostname        string                  `json:"control_api_hostname"`
 	ControlAPIPort            int                     `json:"control_api_port"`
+	ControlAPISocket          string                  `json:"control_api_socket"`
+	ControlAPISocketOnly      bool                    `json:"control_api_socket_only"`
 	Secret                    string                  `json:"secret"`
 	NodeSecret                string                  `json:"node_secret"`
 	PIDFileLocation           string                  `json:"pid_file_location"`
@@ -334,6 +597,7 @@ type Config struct {
 	HashKeyFunction         string         `json:"hash_key_function"`
 	HashKeyFunctionFallback []string       `json:"hash_key_function_fallback"`
 	EnableHashedKeysListing bool           `json:"enable_hashed_keys_listing"`
+	UniqueKeyAliases        bool           `json:"unique_key_aliases"`
 	MinTokenLength          int            `json:"min_token_length"`
 	EnableAPISegregation    bool           `json:"enable_api_segregation"`
 	TemplatePath            string         `json:"template_path"`
@@ -343,6 +607,9 @@ type Config struct {
 	// This is a map of protocol to PortWhiteList. This allows per protocol
 	// configurations.
 	PortWhiteList map[string]PortWhiteList `json:"ports_whitelist"`
+	// DetectKeyHashes makes the keys endpoints tell key hashes from raw keys
+	// by their format when the hashed parameter isn't set.
+	DetectKeyHashes bool `json:"detect_key_hashes"`
 
 	// CE Configurations
 	AppPath string `json:"app_path"`
@@ -373,6 +640,20 @@ type Config struct {
 	ExperimentalProcessOrgOffThread bool          `json:"experimental_process_org_off_thread"`
 	Monitor                         MonitorConfig `json:"monitor"`
 
+	KeyExpiryAudit    KeyExpiryAuditConfig    `json:"key_expiry_audit"`
+	KeyspaceEvents    KeyspaceEventsConfig    `json:"keyspace_events"`
+	CertificateExpiry CertificateExpiryConfig `json:"certificate_expiry"`
+
+	OauthTokenPurge OauthTokenPurgeConfig `json:"oauth_token_purge"`
+	Backup          BackupConfig          `json:"backup"`
+	OASPublish      OASPublishConfig      `json:"oas_publish"`
+	LoadShedding    LoadSheddingConfig    `json:"load_shedding"`
+	SelfProtection  SelfProtectionConfig  `json:"self_protection"`
+	SessionFallback SessionFallbackConfig `json:"session_fallback"`
+
+	// SecurityHeaders sets browser security headers on the responses of all APIs, APIs can override them.
+	SecurityHeaders apidef.SecurityHeadersConfig `json:"security_headers"`
+
 	// Client-Gateway Configuration
 	MaxIdleConns         int   `bson:"max_idle_connections" json:"max_idle_connections"`
 	MaxIdleConnsPerHost  int   `bson:"max_idle_connections_per_host" json:"max_idle_connections_per_host"`
@@ -435,6 +716,7 @@ type Config struct {
 
 	// Monitoring, Logging & Profiling
 	LogLevel                string         `json:"log_level"`
+	LogFormat               string         `json:"log_format"`
 	HealthCheckEndpointName string         `json:"health_check_endpoint_name"`
 	Tracer                  Tracer         `json:"tracing"`
 	NewRelic                NewRelicConfig `json:"newrelic"`
@@ -477,9 +759,39 @@ type Config struct {
 	// Secrets are key-value pairs that can be accessed in the dashboard via "secrets://"
 	Secrets map[string]string `json:"secrets"`
 
+	// ExpandAPIDefinitions expands ${name} references in the string fields
+	// of API definitions when they are loaded, such as target URLs, headers
+	// and listen paths. ${name:-default} falls back to a default value, and
+	// $${ is a literal ${.
+	ExpandAPIDefinitions bool `json:"expand_api_definitions"`
+
+	// APIDefinitionVariables are the values of the references in API
+	// definitions, such as the region or cluster of the gateway. References
+	// not defined here are read from the environment, only for variables
+	// prefixed with TYK_SECRET_.
+	APIDefinitionVariables map[string]string `json:"api_definition_variables"`
+
 	// OverrideMessages is used to override returned API error codes and messages.
 	OverrideMessages map[string]TykError `bson:"override_messages" json:"override_messages"`
 
+	// UnmatchedRequests sets the response to requests matching no API by the
+	// domain they are sent to. The empty domain applies to the others.
+	UnmatchedRequests map[string]UnmatchedRequestConfig `json:"unmatched_requests"`
+
+	// MaxResponseBodySize caps the size of upstream responses in bytes, so
+	// that a misbehaving upstream can't stream unbounded data through the
+	// gateway. APIs can override it. 0 means no limit.
+	MaxResponseBodySize int64 `json:"max_response_body_size"`
+
+	// ClientIP sets how the IP of clients is found behind proxies, for IP
+	// allow and deny lists, rate limits, analytics and logs.
+	ClientIP ClientIPConfig `json:"client_ip"`
+
+	// AccessLogDir is the directory the access logs of APIs are written to,
+	// their output being a file name relative to it. Access logs are only
+	// written to stdout and stderr when it isn't set.
+	AccessLogDir string `json:"access_log_dir"`
+
 	// Cloud flag shows that gateway runs in Tyk-cloud.
 	Cloud bool `json:"cloud"`
 
@@ -487,6 +799,20 @@ type Config struct {
 	JWTSSLInsecureSkipVerify bool `json:"jwt_ssl_insecure_skip_verify"`
 }
 
+// ClientIPConfig sets how the IP of clients is found. When disabled, the
+// X-Real-IP and X-Forwarded-For headers of all requests are trusted.
+type ClientIPConfig struct {
+	Enabled bool `json:"enabled"`
+	// TrustedProxies are the networks, or single IPs, of the proxies in
+	// front of the gateway, such as a CDN or load balancers. Forwarding
+	// headers are only honored on requests from them.
+	TrustedProxies []string `json:"trusted_proxies"`
+	// Header is the forwarding header the trusted proxies set: Forwarded,
+	// X-Forwarded-For or X-Real-IP. The others are ignored. Defaults to
+	// X-Forwarded-For.
+	Header string `json:"header"`
+}
+
 type TykError struct {
 	Message string `json:"message"`
 	Code    int    `json:"code"`
@@ -3,6 +3,7 @@ package ctx
 import (
 	"context"
 	"net/http"
+	"net/url"
 
 	"github.com/TykTechnologies/tyk/apidef"
 
@@ -39,6 +40,13 @@ const (
 	RequestStatus
 	GraphQLRequest
 	GraphQLIsWebSocketUpgrade
+	LoopTrace
+	UpstreamTarget
+	AnalyticsTags
+	GraphQLIsSSE
+	RequestTiming
+	StaleResponse
+	TrafficSplitVariant
 )
 
 func setContext(r *http.Request, ctx context.Context) {
@@ -100,3 +108,41 @@ func GetDefinition(r *http.Request) *apidef.APIDefinition {
 	}
 	return nil
 }
+
+// GetUpstreamTarget returns the target replacing the one of the API for this
+// request, nil if it is not replaced.
+func GetUpstreamTarget(r *http.Request) *url.URL {
+	if v := r.Context().Value(UpstreamTarget); v != nil {
+		return v.(*url.URL)
+	}
+	return nil
+}
+
+// SetUpstreamTarget replaces the target of the API for this request. The
+// request path is appended to the path of target, as for the API target.
+func SetUpstreamTarget(r *http.Request, target *url.URL) {
+	ctx := r.Context()
+	ctx = context.WithValue(ctx, UpstreamTarget, target)
+	setContext(r, ctx)
+}
+
+// GetAnalyticsTags returns the tags added to the analytics record of this
+// request.
+func GetAnalyticsTags(r *http.Request) []string {
+	if v := r.Context().Value(AnalyticsTags); v != nil {
+		return v.([]string)
+	}
+	return nil
+}
+
+// AddAnalyticsTags adds tags to the analytics record of this request.
+func AddAnalyticsTags(r *http.Request, tags ...string) {
+	current := GetAnalyticsTags(r)
+	all := make([]string, 0, len(current)+len(tags))
+	all = append(all, current...)
+	all = append(all, tags...)
+
+	ctx := r.Context()
+	ctx = context.WithValue(ctx, AnalyticsTags, all)
+	setContext(r, ctx)
+}
@@ -46,14 +46,33 @@ type DnsCacheManager struct {
 	cacheStorage IDnsCacheStorage
 	strategy     config.IPsHandleStrategy
 	rand         *rand.Rand
+	overrides    map[string][]string
 }
 
 // NewDnsCacheManager returns new empty/non-initialized DnsCacheManager
 func NewDnsCacheManager(multipleIPsHandleStrategy config.IPsHandleStrategy) *DnsCacheManager {
-	manager := &DnsCacheManager{nil, multipleIPsHandleStrategy, nil}
+	manager := &DnsCacheManager{nil, multipleIPsHandleStrategy, nil, nil}
 	return manager
 }
 
+// NewResolver returns a resolver which sends all dns queries to the given
+// server address (host:port) instead of the servers configured on the system.
+func NewResolver(address string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, address)
+		},
+	}
+}
+
+// SetOverrides sets static host to ip mappings, which take precedence over both
+// cached and resolved records.
+func (m *DnsCacheManager) SetOverrides(overrides map[string][]string) {
+	m.overrides = overrides
+}
+
 func (m *DnsCacheManager) SetCacheStorage(cache IDnsCacheStorage) {
 	m.cacheStorage = cache
 }
@@ -85,6 +104,10 @@ func (m *DnsCacheManager) doCachedDial(d *net.Dialer, ctx context.Context, netwo
 		return conn, err
 	}
 
+	if ips, port, ok := m.overridden(address); ok {
+		return safeDial(m.pickIp(ips)+":"+port, "")
+	}
+
 	if !m.IsCacheEnabled() {
 		return safeDial(address, "")
 	}
@@ -99,6 +122,10 @@ func (m *DnsCacheManager) doCachedDial(d *net.Dialer, ctx context.Context, netwo
 	}
 
 	ips, err := m.cacheStorage.FetchItem(host)
+	if IsNotFound(err) {
+		// dialing would only fail on resolving the host again
+		return nil, err
+	}
 	if err != nil {
 		logger.WithError(err).WithFields(logrus.Fields{
 			"network": network,
@@ -126,6 +153,28 @@ func (m *DnsCacheManager) doCachedDial(d *net.Dialer, ctx context.Context, netwo
 	return safeDial(ips[0]+":"+port, host)
 }
 
+func (m *DnsCacheManager) overridden(address string) ([]string, string, bool) {
+	if len(m.overrides) == 0 {
+		return nil, "", false
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, "", false
+	}
+
+	ips := m.overrides[host]
+	return ips, port, len(ips) > 0
+}
+
+func (m *DnsCacheManager) pickIp(ips []string) string {
+	if m.strategy == config.RandomStrategy && len(ips) > 1 {
+		ip, _ := m.getRandomIp(ips)
+		return ip
+	}
+	return ips[0]
+}
+
 func (m *DnsCacheManager) getRandomIp(ips []string) (string, error) {
 	if m.strategy != config.RandomStrategy {
 		return "", fmt.Errorf(
@@ -139,3 +139,35 @@ func TestWrapDialerDialContextFunc(t *testing.T) {
 		})
 	}
 }
+
+func TestWrapDialerOverrides(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	fetchItemCalled := false
+	storage := &MockStorage{func(key string) ([]string, error) {
+		fetchItemCalled = true
+		return nil, nil
+	}, func(key string) (DnsCacheItem, bool) {
+		return DnsCacheItem{}, false
+	}, func(key string, addrs []string) {}, func(key string) {}, func() {}}
+
+	dnsManager := NewDnsCacheManager(config.PickFirstStrategy)
+	dnsManager.SetCacheStorage(storage)
+	dnsManager.SetOverrides(map[string][]string{"internal.example": {"127.0.0.1"}})
+
+	conn, err := dnsManager.WrapDialer(&net.Dialer{Timeout: time.Second})(context.TODO(), "tcp", "internal.example:"+port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	if fetchItemCalled {
+		t.Error("overridden host should not be looked up")
+	}
+}
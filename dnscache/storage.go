@@ -1,7 +1,12 @@
 package dnscache
 
 import (
+	"container/list"
+	"context"
+	"errors"
 	"net"
+	"sort"
+	"sync"
 	"time"
 
 	"fmt"
@@ -10,21 +15,122 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-// DnsCacheItem represents single record in cache
+// DnsCacheItem represents single record in cache. NotFound records hosts
+// which didn't resolve, when negative results are cached.
 type DnsCacheItem struct {
-	Addrs []string
+	Addrs    []string
+	NotFound bool
+}
+
+// DnsCacheEntry is a record in cache along with its host and expiry time,
+// zero if it never expires.
+type DnsCacheEntry struct {
+	Host     string    `json:"host"`
+	Addrs    []string  `json:"addrs"`
+	NotFound bool      `json:"not_found"`
+	Expires  time.Time `json:"expires,omitempty"`
 }
 
 // DnsCacheStorage is an in-memory cache of auto-purged dns query ip responses
 type DnsCacheStorage struct {
-	cache *cache.Cache
+	cache       *cache.Cache
+	resolver    *net.Resolver
+	negativeTTL time.Duration
+
+	// lru orders hosts from the most to the least recently used, when the
+	// number of entries is limited.
+	mu         sync.Mutex
+	maxEntries int
+	lru        *list.List
+	lruItems   map[string]*list.Element
 }
 
 func NewDnsCacheStorage(expiration, checkInterval time.Duration) *DnsCacheStorage {
-	storage := DnsCacheStorage{cache.New(expiration, checkInterval)}
+	return NewDnsCacheStorageWithResolver(expiration, checkInterval, nil)
+}
+
+// NewDnsCacheStorageWithResolver returns a cache storage resolving records with
+// the given resolver, or the default resolver if nil.
+func NewDnsCacheStorageWithResolver(expiration, checkInterval time.Duration, resolver *net.Resolver) *DnsCacheStorage {
+	storage := DnsCacheStorage{cache: cache.New(expiration, checkInterval), resolver: resolver}
 	return &storage
 }
 
+// SetNegativeTTL caches hosts which don't resolve for ttl, so that requests
+// to them fail without a query each. 0 disables negative caching.
+func (dc *DnsCacheStorage) SetNegativeTTL(ttl time.Duration) {
+	dc.negativeTTL = ttl
+}
+
+// SetMaxEntries limits the number of entries in cache, evicting the least
+// recently used ones past it. 0 means no limit. It must be set before the
+// storage is used.
+func (dc *DnsCacheStorage) SetMaxEntries(maxEntries int) {
+	dc.maxEntries = maxEntries
+	if maxEntries <= 0 {
+		return
+	}
+	dc.lru = list.New()
+	dc.lruItems = map[string]*list.Element{}
+	dc.cache.OnEvicted(func(key string, _ interface{}) {
+		dc.mu.Lock()
+		defer dc.mu.Unlock()
+		if e, ok := dc.lruItems[key]; ok {
+			dc.lru.Remove(e)
+			delete(dc.lruItems, key)
+		}
+	})
+}
+
+// touch marks a host as the most recently used, and evicts the least
+// recently used entry if there are too many.
+func (dc *DnsCacheStorage) touch(key string) {
+	if dc.maxEntries <= 0 {
+		return
+	}
+
+	dc.mu.Lock()
+	if e, ok := dc.lruItems[key]; ok {
+		dc.lru.MoveToFront(e)
+		dc.mu.Unlock()
+		return
+	}
+	dc.lruItems[key] = dc.lru.PushFront(key)
+	var evicted string
+	if dc.lru.Len() > dc.maxEntries {
+		oldest := dc.lru.Back()
+		evicted = oldest.Value.(string)
+		dc.lru.Remove(oldest)
+		delete(dc.lruItems, evicted)
+	}
+	dc.mu.Unlock()
+
+	// deleting calls OnEvicted, which takes the lock
+	if evicted != "" {
+		logger.WithField("hostName", evicted).Debug("Evicting least recently used dns record")
+		dc.cache.Delete(evicted)
+	}
+}
+
+// Entries returns the records in cache, including the expired ones not purged
+// yet, by host.
+func (dc *DnsCacheStorage) Entries() []DnsCacheEntry {
+	items := dc.cache.Items()
+	entries := make([]DnsCacheEntry, 0, len(items))
+	for host, item := range items {
+		record := item.Object.(DnsCacheItem)
+		entry := DnsCacheEntry{Host: host, Addrs: record.Addrs, NotFound: record.NotFound}
+		if item.Expiration > 0 {
+			entry.Expires = time.Unix(0, item.Expiration)
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Host < entries[j].Host
+	})
+	return entries
+}
+
 // Items returns map of non expired dns cache items
 func (dc *DnsCacheStorage) Items(includeExpired bool) map[string]DnsCacheItem {
 	var allItems = dc.cache.Items()
@@ -47,6 +153,7 @@ func (dc *DnsCacheStorage) Get(key string) (DnsCacheItem, bool) {
 	if !found {
 		return DnsCacheItem{}, false
 	}
+	dc.touch(key)
 	return item.(DnsCacheItem), found
 }
 
@@ -62,6 +169,10 @@ func (dc *DnsCacheStorage) FetchItem(hostName string) ([]string, error) {
 
 	item, ok := dc.Get(hostName)
 	if ok {
+		if item.NotFound {
+			logger.WithField("hostName", hostName).Debug("Dns record was found missing in cache")
+			return nil, &net.DNSError{Err: "no such host (cached)", Name: hostName, IsNotFound: true}
+		}
 		logger.WithFields(logrus.Fields{
 			"hostName": hostName,
 			"addrs":    item.Addrs,
@@ -71,6 +182,11 @@ func (dc *DnsCacheStorage) FetchItem(hostName string) ([]string, error) {
 
 	addrs, err := dc.resolveDNSRecord(hostName)
 	if err != nil {
+		if dc.negativeTTL > 0 && IsNotFound(err) {
+			logger.WithField("hostName", hostName).Debug("Adding missing dns record to cache")
+			dc.cache.Set(hostName, DnsCacheItem{NotFound: true}, dc.negativeTTL)
+			dc.touch(hostName)
+		}
 		return nil, err
 	}
 
@@ -80,14 +196,31 @@ func (dc *DnsCacheStorage) FetchItem(hostName string) ([]string, error) {
 
 func (dc *DnsCacheStorage) Set(key string, addrs []string) {
 	logger.Debugf("Adding dns record to cache: key=%q, addrs=%q", key, addrs)
-	dc.cache.Set(key, DnsCacheItem{addrs}, cache.DefaultExpiration)
+	dc.cache.Set(key, DnsCacheItem{Addrs: addrs}, cache.DefaultExpiration)
+	dc.touch(key)
 }
 
 // Clear deletes all records from cache
 func (dc *DnsCacheStorage) Clear() {
 	dc.cache.Flush()
+	if dc.maxEntries > 0 {
+		dc.mu.Lock()
+		dc.lru.Init()
+		dc.lruItems = map[string]*list.Element{}
+		dc.mu.Unlock()
+	}
+}
+
+// IsNotFound reports whether err tells that a host doesn't resolve, rather
+// than that it couldn't be resolved.
+func IsNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
 }
 
 func (dc *DnsCacheStorage) resolveDNSRecord(host string) ([]string, error) {
+	if dc.resolver != nil {
+		return dc.resolver.LookupHost(context.Background(), host)
+	}
 	return net.LookupHost(host)
 }
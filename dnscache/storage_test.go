@@ -286,3 +286,74 @@ func TestStorageRecordExpiration(t *testing.T) {
 		})
 	}
 }
+
+func TestStorageNegativeCaching(t *testing.T) {
+	const missingHost = "missing.orig-host.com."
+	tearDown := setupTestStorageFetchItem(&configTestStorageFetchItem{t, etcHostsMap, map[string]int{
+		missingHost:   dns.RcodeNameError,
+		hostErrorable: dns.RcodeServerFailure,
+	}})
+	defer tearDown()
+
+	dnsCache := NewDnsCacheStorage(time.Duration(expiration)*time.Second, time.Duration(checkInterval)*time.Second)
+	dnsCache.SetNegativeTTL(time.Second)
+
+	if _, err := dnsCache.FetchItem(missingHost); !IsNotFound(err) {
+		t.Fatalf("wanted not found error, got %v", err)
+	}
+	item, ok := dnsCache.Get(missingHost)
+	if !ok || !item.NotFound {
+		t.Fatalf("wanted missing host cached, got %#v, ok=%t", item, ok)
+	}
+	if _, err := dnsCache.FetchItem(missingHost); !IsNotFound(err) {
+		t.Fatalf("wanted cached not found error, got %v", err)
+	}
+
+	// failures other than missing hosts aren't cached
+	if _, err := dnsCache.FetchItem(hostErrorable); err == nil || IsNotFound(err) {
+		t.Fatalf("wanted server failure, got %v", err)
+	}
+	if _, ok := dnsCache.Get(hostErrorable); ok {
+		t.Fatal("wanted server failure not to be cached")
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	if _, ok := dnsCache.Get(missingHost); ok {
+		t.Fatal("wanted missing host to expire after the negative TTL")
+	}
+}
+
+func TestStorageMaxEntries(t *testing.T) {
+	dnsCache := NewDnsCacheStorage(time.Duration(expiration)*time.Second, time.Duration(checkInterval)*time.Second)
+	dnsCache.SetMaxEntries(2)
+
+	dnsCache.Set(host, etcHostsMap[host])
+	dnsCache.Set(host2, etcHostsMap[host2])
+	// host is now the most recently used
+	if _, ok := dnsCache.Get(host); !ok {
+		t.Fatalf("wanted %s in cache", host)
+	}
+	dnsCache.Set(host3, etcHostsMap[host3])
+
+	if _, ok := dnsCache.Get(host2); ok {
+		t.Fatalf("wanted least recently used %s evicted", host2)
+	}
+	entries := dnsCache.Entries()
+	if len(entries) != 2 || entries[0].Host != host || entries[1].Host != host3 {
+		t.Fatalf("wanted %s and %s in cache, got %+v", host, host3, entries)
+	}
+
+	// deleted entries don't count
+	dnsCache.Delete(host)
+	dnsCache.Set(host4, etcHostsMap[host4])
+	if len(dnsCache.Entries()) != 2 {
+		t.Fatalf("wanted 2 entries, got %+v", dnsCache.Entries())
+	}
+
+	dnsCache.Clear()
+	dnsCache.Set(host, etcHostsMap[host])
+	dnsCache.Set(host2, etcHostsMap[host2])
+	if len(dnsCache.Entries()) != 2 {
+		t.Fatalf("wanted 2 entries after clear, got %+v", dnsCache.Entries())
+	}
+}
@@ -0,0 +1,396 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/request"
+)
+
+const (
+	accessLogCommon   = "common"
+	accessLogCombined = "combined"
+
+	accessLogDefaultMaxSize    = 100 // MB
+	accessLogDefaultMaxBackups = 5
+
+	// accessLogTimeFormat is the time format of Apache access logs.
+	accessLogTimeFormat = "02/Jan/2006:15:04:05 -0700"
+)
+
+// accessLogEntry is a request as written to an access log, custom formats
+// are templates of its fields.
+type accessLogEntry struct {
+	RemoteAddr string
+	// User is the alias of the key of the request, - if it has none.
+	User      string
+	Time      time.Time
+	Method    string
+	URI       string
+	Proto     string
+	Status    int
+	Size      int64
+	Referer   string
+	UserAgent string
+	// LatencyMs is the time the request took, UpstreamMs the part of it
+	// spent waiting on the upstream.
+	LatencyMs  int64
+	UpstreamMs int64
+	APIID      string
+	APIName    string
+	Host       string
+}
+
+// TimeLocal is the time of the request in the format of Apache.
+func (e *accessLogEntry) TimeLocal() string {
+	return e.Time.Format(accessLogTimeFormat)
+}
+
+// Bytes is the size of the response body, - if it was empty.
+func (e *accessLogEntry) Bytes() string {
+	if e.Size == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(e.Size, 10)
+}
+
+func (e *accessLogEntry) common() string {
+	return fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s`,
+		e.RemoteAddr, escapeLogItem(e.User), e.TimeLocal(),
+		escapeLogItem(e.Method), escapeLogItem(e.URI), escapeLogItem(e.Proto),
+		e.Status, e.Bytes())
+}
+
+func (e *accessLogEntry) combined() string {
+	return fmt.Sprintf(`%s "%s" "%s"`, e.common(),
+		escapeLogItem(orDash(e.Referer)), escapeLogItem(orDash(e.UserAgent)))
+}
+
+// escapeLogItem escapes the quotes, backslashes and non-printable bytes of
+// a field sent by the client, as Apache does, for it not to forge or break
+// the fields of the line.
+func escapeLogItem(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\b':
+			b.WriteString(`\b`)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c == '\v':
+			b.WriteString(`\v`)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// accessLogger writes the access log of an API.
+type accessLogger struct {
+	format     string
+	tmpl       *template.Template
+	out        io.Writer
+	sampleRate float64
+}
+
+func newAccessLogger(conf apidef.AccessLogMeta) (*accessLogger, error) {
+	l := &accessLogger{format: conf.Format, sampleRate: conf.SampleRate}
+	switch l.format {
+	case "":
+		l.format = accessLogCombined
+	case accessLogCommon, accessLogCombined:
+	default:
+		tmpl, err := template.New("").Parse(l.format)
+		if err != nil {
+			return nil, err
+		}
+		l.tmpl = tmpl
+	}
+
+	switch conf.Output {
+	case "", "stdout":
+		l.out = os.Stdout
+	case "stderr":
+		l.out = os.Stderr
+	default:
+		path, err := accessLogPath(conf.Output)
+		if err != nil {
+			return nil, err
+		}
+		l.out = accessLogFile(path, conf.MaxSize, conf.MaxBackups)
+	}
+	return l, nil
+}
+
+// accessLogPath returns the path of the access log file of an API, which
+// must be in the access_log_dir of the gateway as API definitions aren't
+// trusted to write anywhere else.
+func accessLogPath(output string) (string, error) {
+	dir := config.Global().AccessLogDir
+	if dir == "" {
+		return "", errors.New("access logs can't be written to files without access_log_dir")
+	}
+	if filepath.IsAbs(output) {
+		return "", fmt.Errorf("access log output %q must be relative to access_log_dir", output)
+	}
+	for _, elem := range strings.Split(filepath.ToSlash(output), "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("access log output %q must be in access_log_dir", output)
+		}
+	}
+	return filepath.Join(dir, output), nil
+}
+
+// sampled reports whether a request is to be logged.
+func (l *accessLogger) sampled() bool {
+	return l.sampleRate <= 0 || l.sampleRate >= 1 || rand.Float64() < l.sampleRate
+}
+
+func (l *accessLogger) log(entry *accessLogEntry) {
+	var line bytes.Buffer
+	switch {
+	case l.tmpl != nil:
+		if err := l.tmpl.Execute(&line, entry); err != nil {
+			log.WithError(err).Debug("Couldn't format the access log of a request")
+			return
+		}
+	case l.format == accessLogCommon:
+		line.WriteString(entry.common())
+	default:
+		line.WriteString(entry.combined())
+	}
+	line.WriteByte('\n')
+
+	if _, err := l.out.Write(line.Bytes()); err != nil {
+		log.WithError(err).Debug("Couldn't write the access log of a request")
+	}
+}
+
+// accessLogHandler writes a line to the access log of an API for each of
+// its requests, after they are answered.
+func accessLogHandler(spec *APISpec, next http.Handler) http.Handler {
+	logger, err := newAccessLogger(spec.AccessLog)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "main",
+			"api_id": spec.APIID,
+		}).WithError(err).Error("Invalid access log, access log disabled")
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !logger.sampled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		timing := withRequestTiming(r)
+		lw := &accessLogResponseWriter{ResponseWriter: w}
+		start := time.Now()
+		// the request is changed by the middleware, such as when stripping
+		// the listen path
+		method, uri, proto := r.Method, r.RequestURI, r.Proto
+		if uri == "" {
+			uri = r.URL.RequestURI()
+		}
+
+		next.ServeHTTP(lw, r)
+
+		user := "-"
+		if session := ctxGetSession(r); session != nil && session.Alias != "" {
+			user = session.Alias
+		}
+		logger.log(&accessLogEntry{
+			RemoteAddr: request.RealIP(r),
+			User:       user,
+			Time:       start,
+			Method:     method,
+			URI:        uri,
+			Proto:      proto,
+			Status:     lw.status(),
+			Size:       lw.size,
+			Referer:    r.Header.Get(headers.Referer),
+			UserAgent:  r.Header.Get(headers.UserAgent),
+			LatencyMs:  int64(DurationToMillisecond(time.Since(start))),
+			UpstreamMs: int64(DurationToMillisecond(timing.Upstream)),
+			APIID:      spec.APIID,
+			APIName:    spec.Name,
+			Host:       r.Host,
+		})
+	})
+}
+
+// accessLogResponseWriter records the status and size of a response.
+type accessLogResponseWriter struct {
+	http.ResponseWriter
+	code int
+	size int64
+}
+
+func (w *accessLogResponseWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *accessLogResponseWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *accessLogResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *accessLogResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer doesn't support hijacking")
+	}
+	if w.code == 0 {
+		w.code = http.StatusSwitchingProtocols
+	}
+	return hj.Hijack()
+}
+
+func (w *accessLogResponseWriter) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+var (
+	accessLogFilesMu sync.Mutex
+	accessLogFiles   = map[string]*rotatingFile{}
+)
+
+// accessLogFile returns the file at path, shared by the APIs logging to it
+// and kept open across reloads.
+func accessLogFile(path string, maxSize, maxBackups int) *rotatingFile {
+	if maxSize <= 0 {
+		maxSize = accessLogDefaultMaxSize
+	}
+	if maxBackups <= 0 {
+		maxBackups = accessLogDefaultMaxBackups
+	}
+
+	accessLogFilesMu.Lock()
+	defer accessLogFilesMu.Unlock()
+	f, ok := accessLogFiles[path]
+	if !ok {
+		f = &rotatingFile{path: path}
+		accessLogFiles[path] = f
+	}
+	f.setLimits(int64(maxSize)<<20, maxBackups)
+	return f
+}
+
+// rotatingFile is a file moved to path.1 once it reaches its maximum size,
+// the previous path.1 to path.2, and so on up to its maximum backups.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func (f *rotatingFile) setLimits(maxSize int64, maxBackups int) {
+	f.mu.Lock()
+	f.maxSize, f.maxBackups = maxSize, maxBackups
+	f.mu.Unlock()
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *rotatingFile) rotate() error {
+	f.file.Close()
+	f.file = nil
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		os.Rename(f.backup(i), f.backup(i+1))
+	}
+	if err := os.Rename(f.path, f.backup(1)); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+func (f *rotatingFile) backup(i int) string {
+	return f.path + "." + strconv.Itoa(i)
+}
@@ -0,0 +1,145 @@
+package gateway
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestAccessLogFormats(t *testing.T) {
+	entry := &accessLogEntry{
+		RemoteAddr: "127.0.0.1",
+		User:       "-",
+		Time:       time.Date(2020, time.October, 10, 13, 55, 36, 0, time.UTC),
+		Method:     http.MethodGet,
+		URI:        "/apache_pb.gif",
+		Proto:      "HTTP/1.0",
+		Status:     http.StatusOK,
+		Size:       2326,
+		UserAgent:  "Mozilla/4.08",
+	}
+
+	expected := `127.0.0.1 - - [10/Oct/2020:13:55:36 +0000] "GET /apache_pb.gif HTTP/1.0" 200 2326`
+	if got := entry.common(); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+	expected += ` "-" "Mozilla/4.08"`
+	if got := entry.combined(); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
+
+func TestAccessLogEscaping(t *testing.T) {
+	entry := &accessLogEntry{
+		RemoteAddr: "127.0.0.1",
+		User:       `a"b`,
+		Time:       time.Date(2020, time.October, 10, 13, 55, 36, 0, time.UTC),
+		Method:     http.MethodGet,
+		URI:        `/a\b`,
+		Proto:      "HTTP/1.1",
+		Status:     http.StatusOK,
+		Referer:    "x\n127.0.0.1 - - [forged]",
+		UserAgent:  "ua\x01\xff\"",
+	}
+
+	expected := `127.0.0.1 - a\"b [10/Oct/2020:13:55:36 +0000] "GET /a\\b HTTP/1.1" 200 - "x\n127.0.0.1 - - [forged]" "ua\x01\xff\""`
+	if got := entry.combined(); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "access-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	f := &rotatingFile{path: path, maxSize: 10, maxBackups: 2}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.file.Close()
+
+	for name, expected := range map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"} {
+		data, _ := ioutil.ReadFile(name)
+		if string(data) != expected {
+			t.Errorf("Expected %s to hold %q, got %q", name, expected, data)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("Expected only 2 backups to be kept")
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "access-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+
+	globalConf := config.Global()
+	globalConf.AccessLogDir = dir
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/logged/"
+		spec.AccessLog = apidef.AccessLogMeta{
+			Enabled: true,
+			Format:  "{{.APIID}} {{.Method}} {{.URI}} {{.Status}}",
+			Output:  "access.log",
+		}
+	})
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/logged/get?q=1", Code: http.StatusOK},
+		{Method: http.MethodPost, Path: "/logged/post", Code: http.StatusOK},
+	}...)
+
+	data, _ := ioutil.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	expected := []string{"test GET /logged/get?q=1 200", "test POST /logged/post 200"}
+	if len(lines) != len(expected) || lines[0] != expected[0] || lines[1] != expected[1] {
+		t.Errorf("Expected the access log to hold %q, got %q", expected, lines)
+	}
+}
+
+func TestAccessLogPath(t *testing.T) {
+	globalConf := config.Global()
+	defer config.SetGlobal(globalConf)
+
+	conf := globalConf
+	conf.AccessLogDir = ""
+	config.SetGlobal(conf)
+	if _, err := accessLogPath("access.log"); err == nil {
+		t.Error("Expected files to be rejected without access_log_dir")
+	}
+
+	conf.AccessLogDir = "/var/log/tyk"
+	config.SetGlobal(conf)
+	for _, output := range []string{"/etc/passwd", "../tyk.conf", "apis/../../tyk.conf"} {
+		if _, err := accessLogPath(output); err == nil {
+			t.Errorf("Expected %s to be rejected", output)
+		}
+	}
+	if path, err := accessLogPath("apis/orders.log"); err != nil || path != "/var/log/tyk/apis/orders.log" {
+		t.Errorf("Unexpected path %s: %v", path, err)
+	}
+}
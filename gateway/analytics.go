@@ -73,7 +73,38 @@ type AnalyticsRecord struct {
 	Tags          []string
 	Alias         string
 	TrackPath     bool
-	ExpireAt      time.Time `bson:"expireAt" json:"expireAt"`
+	LoopTrace     []LoopHop
+	// ThrottleRetries is the number of times the request was retried by
+	// throttling after being rate limited.
+	ThrottleRetries int
+	ExpireAt        time.Time `bson:"expireAt" json:"expireAt"`
+}
+
+// analyticsRecords recycles the records of requests once they are encoded, as
+// one is allocated for each request.
+var analyticsRecords = sync.Pool{
+	New: func() interface{} {
+		return new(AnalyticsRecord)
+	},
+}
+
+// newAnalyticsRecord returns an empty record, to be passed to RecordHit which
+// releases it.
+func newAnalyticsRecord() *AnalyticsRecord {
+	return analyticsRecords.Get().(*AnalyticsRecord)
+}
+
+func releaseAnalyticsRecord(record *AnalyticsRecord) {
+	*record = AnalyticsRecord{}
+	analyticsRecords.Put(record)
+}
+
+// LoopHop is an internal loop of a request to an API.
+type LoopHop struct {
+	APIID   string
+	APIName string
+	// Path is the path requested from the API.
+	Path string
 }
 
 type GeoData struct {
@@ -228,10 +259,12 @@ func (r *RedisAnalyticsHandler) Stop() {
 	r.poolWg.Wait()
 }
 
-// RecordHit will store an AnalyticsRecord in Redis
+// RecordHit will store an AnalyticsRecord in Redis. The record is released
+// once stored, it mustn't be used afterwards.
 func (r *RedisAnalyticsHandler) RecordHit(record *AnalyticsRecord) error {
 	// check if we should stop sending records 1st
 	if atomic.LoadUint32(&r.shouldStop) > 0 {
+		releaseAnalyticsRecord(record)
 		return nil
 	}
 
@@ -308,6 +341,7 @@ func (r *RedisAnalyticsHandler) recordWorker() {
 			} else {
 				recordsBuffer = append(recordsBuffer, encoded)
 			}
+			releaseAnalyticsRecord(record)
 
 			// identify that buffer is ready to be sent
 			readyToSend = uint64(len(recordsBuffer)) == r.workerBufferSize
@@ -1,9 +1,14 @@
 package gateway
 
 import (
+	"reflect"
 	"testing"
 
+	"github.com/gorilla/mux"
+
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
 )
 
 func TestGeoIPLookup(t *testing.T) {
@@ -156,6 +161,44 @@ func TestTagHeaders(t *testing.T) {
 
 }
 
+func TestTagListenPathParams(t *testing.T) {
+	req := TestReq(t, "GET", "/tenants/acme/api", nil)
+	req = mux.SetURLVars(req, map[string]string{"tenantID": "acme", "region": "eu"})
+
+	tags := tagListenPathParams(req, []string{"tenantID", "missing"}, []string{"first"})
+	if !reflect.DeepEqual(tags, []string{"first", "tenantID-acme"}) {
+		t.Fatalf("Listen path parameters not properly tagged, got: %v", tags)
+	}
+}
+
+func TestTagRules(t *testing.T) {
+	spec := &APISpec{APIDefinition: &apidef.APIDefinition{}}
+	spec.Proxy.ListenPath = "/api/"
+	spec.TagRules = []apidef.TagRuleMeta{
+		{Source: attributeHeader, Name: "X-Customer"},
+		{Source: attributePathSegment, Index: 1},
+		{Source: attributeQueryParam, Name: "feature", Tag: "feat"},
+		{Source: attributeJWTClaim, Name: "email", Hash: true},
+		{Source: attributeHeader, Name: "X-Missing"},
+	}
+
+	req := TestReq(t, "GET", "/api/tenants/acme/orders?feature=export", nil)
+	req.Header.Set("X-Customer", "globex")
+	ctxSetData(req, map[string]interface{}{"jwt_claims_email": "jane@example.com"})
+
+	tags := tagRules(req, spec, []string{"first"})
+	expected := []string{
+		"first",
+		"x-customer-globex",
+		"segment-1-acme",
+		"feat-export",
+		"email-" + storage.HashStr("jane@example.com", storage.HashSha256),
+	}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Fatalf("Tag rules not properly applied, got: %v", tags)
+	}
+}
+
 func BenchmarkTagHeaders(b *testing.B) {
 	b.ReportAllocs()
 
@@ -184,3 +227,26 @@ func BenchmarkTagHeaders(b *testing.B) {
 		}
 	}
 }
+
+func TestReleaseAnalyticsRecord(t *testing.T) {
+	record := newAnalyticsRecord()
+	record.APIID = "test"
+	record.Tags = []string{"tag"}
+	record.LoopTrace = []LoopHop{{APIID: "test"}}
+
+	releaseAnalyticsRecord(record)
+	if !reflect.DeepEqual(*record, AnalyticsRecord{}) {
+		t.Fatalf("Released record wasn't reset, got: %+v", *record)
+	}
+}
+
+func BenchmarkAnalyticsRecord(b *testing.B) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		record := newAnalyticsRecord()
+		record.APIID = "test"
+		record.Path = "/path"
+		releaseAnalyticsRecord(record)
+	}
+}
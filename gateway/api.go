@@ -37,6 +37,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -87,6 +88,45 @@ func apiError(msg string) apiStatusMessage {
 	return apiStatusMessage{"error", msg}
 }
 
+// apiPolicyError is returned when the policies of a key cannot be applied.
+// Reason is one of policy_not_found, org_mismatch or incompatible_partitions.
+//
+// swagger:model apiPolicyError
+type apiPolicyError struct {
+	Status    string   `json:"status"`
+	Message   string   `json:"message"`
+	Reason    string   `json:"reason"`
+	PolicyIDs []string `json:"policy_ids"`
+}
+
+// applyKeyPolicies applies the policies of a key being created or updated.
+// Unless the request sets strict=false, policy errors are returned as an
+// error response.
+func applyKeyPolicies(session *user.SessionState, r *http.Request) (interface{}, int) {
+	mw := BaseMiddleware{}
+	err := mw.ApplyPolicies(session)
+	if err == nil || r.URL.Query().Get("strict") == "false" {
+		return nil, http.StatusOK
+	}
+
+	resp := apiPolicyError{
+		Status:  "error",
+		Message: err.Error(),
+	}
+	if policyErr, ok := err.(*policyApplyError); ok {
+		resp.Reason = policyErr.Reason
+		resp.PolicyIDs = policyErr.PolicyIDs
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix":   "api",
+		"status":   "fail",
+		"policies": resp.PolicyIDs,
+	}).Error("Failed to apply policies: ", err)
+
+	return resp, http.StatusBadRequest
+}
+
 // paginationStatus provides more information about a paginated data set
 type paginationStatus struct {
 	PageNum   int `json:"page_num"`
@@ -334,9 +374,16 @@ func handleAddOrUpdate(keyName string, r *http.Request, isHashed bool) (interfac
 		return apiError("Request malformed"), http.StatusBadRequest
 	}
 
-	mw := BaseMiddleware{}
-	// TODO: handle apply policies error
-	mw.ApplyPolicies(newSession)
+	if r.Method == http.MethodPost {
+		applyOrgDefaultPolicies(newSession)
+	}
+	if obj, code := applyKeyPolicies(newSession, r); code != http.StatusOK {
+		return obj, code
+	}
+
+	if err := validateAllowedIPs(newSession.AllowedIPs); err != nil {
+		return apiError(err.Error()), http.StatusBadRequest
+	}
 
 	// DO ADD OR UPDATE
 
@@ -369,6 +416,11 @@ func handleAddOrUpdate(keyName string, r *http.Request, isHashed bool) (interfac
 		// preserve the creation date
 		newSession.DateCreated = originalKey.DateCreated
 
+		// limit overrides are managed through their own endpoint
+		if newSession.LimitOverride == nil {
+			newSession.LimitOverride = originalKey.LimitOverride
+		}
+
 		// don't change fields related to quota and rate limiting if was passed as "suppress_reset=1"
 		if suppressReset {
 			// save existing quota_renews and last_updated if suppress_reset was passed
@@ -424,13 +476,8 @@ func handleAddOrUpdate(keyName string, r *http.Request, isHashed bool) (interfac
 		newSession.BasicAuthData.Password = originalKey.BasicAuthData.Password
 	}
 
-	if r.Method == http.MethodPost || storage.TokenOrg(keyName) != "" {
-		// use new key format if key gets created or updating key with new format
-		if err := doAddOrUpdate(keyName, newSession, suppressReset, isHashed); err != nil {
-			return apiError("Failed to create key, ensure security settings are correct."), http.StatusInternalServerError
-		}
-	} else {
-
+	// use new key format if key gets created or updating key with new format
+	if r.Method != http.MethodPost && storage.TokenOrg(keyName) == "" {
 		newFormatKey := generateToken(newSession.OrgID, keyName)
 		// search as a custom key
 		_, err := GlobalSessionManager.Store().GetKey(newFormatKey)
@@ -439,11 +486,18 @@ func handleAddOrUpdate(keyName string, r *http.Request, isHashed bool) (interfac
 			// update new format key for custom keys, as it was found then its a customKey
 			keyName = newFormatKey
 		}
+	}
 
-		if err := doAddOrUpdate(keyName, newSession, suppressReset, isHashed); err != nil {
-			return apiError("Failed to create key, ensure security settings are correct."), http.StatusInternalServerError
-		}
+	storedName := storedKeyName(keyName, isHashed)
+	if !claimKeyAlias(storedName, newSession) {
+		return apiError("Alias is already used by another key"), http.StatusConflict
+	}
+
+	if err := doAddOrUpdate(keyName, newSession, suppressReset, isHashed); err != nil {
+		releaseKeyAlias(storedName, newSession)
+		return apiError("Failed to create key, ensure security settings are correct."), http.StatusInternalServerError
 	}
+	indexKeyAlias(storedName, newSession, originalKey.Alias)
 
 	action := "modified"
 	event := EventTokenUpdated
@@ -457,6 +511,12 @@ func handleAddOrUpdate(keyName string, r *http.Request, isHashed bool) (interfac
 		Key:              keyName,
 	})
 
+	keyspaceAction := KeyspaceEventUpdated
+	if r.Method == http.MethodPost {
+		keyspaceAction = KeyspaceEventCreated
+	}
+	emitKeyspaceEvent(keyspaceAction, newSession.OrgID, keyName, isHashed)
+
 	response := apiModifyKeySuccess{
 		Key:    keyName,
 		Status: "ok",
@@ -502,7 +562,16 @@ func handleGetDetail(sessionKey, apiID string, byHash bool) (interface{}, int) {
 			quotaKey = QuotaKeyPrefix + sessionKey
 		}
 
-		if usedQuota, err := GlobalSessionManager.Store().GetRawKey(quotaKey); err == nil {
+		limit := &user.APILimit{
+			QuotaMax:           session.QuotaMax,
+			QuotaRenewalPeriod: session.QuotaRenewalPeriod,
+			QuotaTimezone:      session.QuotaTimezone,
+			QuotaCarryOver:     session.QuotaCarryOver,
+		}
+		if start, end, ok := quotaPeriod(limit, time.Now()); ok {
+			session.QuotaRemaining = calendarQuotaRemaining(GlobalSessionManager.Store(), quotaKey, limit, start, end)
+			session.QuotaRenews = end.Unix()
+		} else if usedQuota, err := GlobalSessionManager.Store().GetRawKey(quotaKey); err == nil {
 			qInt, _ := strconv.Atoi(usedQuota)
 			remaining := session.QuotaMax - int64(qInt)
 
@@ -537,7 +606,11 @@ func handleGetDetail(sessionKey, apiID string, byHash bool) (interface{}, int) {
 			limQuotaKey = QuotaKeyPrefix + quotaScope + sessionKey
 		}
 
-		if usedQuota, err := GlobalSessionManager.Store().GetRawKey(limQuotaKey); err == nil {
+		if start, end, ok := quotaPeriod(access.Limit, time.Now()); ok {
+			access.Limit.QuotaRemaining = calendarQuotaRemaining(GlobalSessionManager.Store(), limQuotaKey, access.Limit, start, end)
+			access.Limit.QuotaRenews = end.Unix()
+			session.AccessRights[id] = access
+		} else if usedQuota, err := GlobalSessionManager.Store().GetRawKey(limQuotaKey); err == nil {
 			qInt, _ := strconv.Atoi(usedQuota)
 			remaining := access.Limit.QuotaMax - int64(qInt)
 
@@ -582,13 +655,17 @@ type apiAllKeys struct {
 	APIKeys []string `json:"keys"`
 }
 
+// orgIDFilterB64 is the prefix of the base64 encoded keys of an org.
+func orgIDFilterB64(orgID string) string {
+	filterB64 := base64.StdEncoding.WithPadding(base64.NoPadding).EncodeToString([]byte(fmt.Sprintf(`{"org":"%s"`, orgID)))
+	// Remove last 2 digits to look exact match
+	return filterB64[0 : len(filterB64)-2]
+}
+
 func handleGetAllKeys(filter string) (interface{}, int) {
 	sessions := GlobalSessionManager.Sessions(filter)
 	if filter != "" {
-		filterB64 := base64.StdEncoding.WithPadding(base64.NoPadding).EncodeToString([]byte(fmt.Sprintf(`{"org":"%s"`, filter)))
-		// Remove last 2 digits to look exact match
-		filterB64 = filterB64[0 : len(filterB64)-2]
-		orgIDB64Sessions := GlobalSessionManager.Sessions(filterB64)
+		orgIDB64Sessions := GlobalSessionManager.Sessions(orgIDFilterB64(filter))
 		sessions = append(sessions, orgIDB64Sessions...)
 	}
 
@@ -640,6 +717,11 @@ func handleDeleteKey(keyName, apiID string, resetQuota bool) (interface{}, int)
 		orgID = spec.OrgID
 	}
 
+	if config.Global().UniqueKeyAliases {
+		deleted, _ := GlobalSessionManager.SessionDetail(orgID, keyName, false)
+		defer unindexKeyAlias(&deleted)
+	}
+
 	if apiID == "-1" {
 		// Go through ALL managed API's and delete the key
 		apisMu.RLock()
@@ -665,6 +747,7 @@ func handleDeleteKey(keyName, apiID string, resetQuota bool) (interface{}, int)
 			"key":    keyName,
 			"status": "ok",
 		}).Info("Deleted key across all APIs.")
+		emitKeyspaceEvent(KeyspaceEventDeleted, orgID, keyspaceEventKey(orgID, keyName), false)
 
 		return nil, http.StatusOK
 	}
@@ -696,6 +779,7 @@ func handleDeleteKey(keyName, apiID string, resetQuota bool) (interface{}, int)
 		Org:              orgID,
 		Key:              keyName,
 	})
+	emitKeyspaceEvent(KeyspaceEventDeleted, orgID, keyspaceEventKey(orgID, keyName), false)
 
 	log.WithFields(logrus.Fields{
 		"prefix": "api",
@@ -733,6 +817,11 @@ func handleDeleteHashedKey(keyName, apiID string, resetQuota bool) (interface{},
 		orgID = spec.OrgID
 	}
 
+	if config.Global().UniqueKeyAliases {
+		deleted, _ := GlobalSessionManager.SessionDetail(orgID, keyName, true)
+		defer unindexKeyAlias(&deleted)
+	}
+
 	if apiID == "-1" {
 		// Go through ALL managed API's and delete the key
 		apisMu.RLock()
@@ -742,6 +831,7 @@ func handleDeleteHashedKey(keyName, apiID string, resetQuota bool) (interface{},
 		if !removed {
 			return apiError("Failed to remove the key"), http.StatusBadRequest
 		}
+		emitKeyspaceEvent(KeyspaceEventDeleted, orgID, keyName, true)
 
 		return nil, http.StatusOK
 	}
@@ -756,6 +846,7 @@ func handleDeleteHashedKey(keyName, apiID string, resetQuota bool) (interface{},
 			user.NewSessionState(),
 			true)
 	}
+	emitKeyspaceEvent(KeyspaceEventDeleted, orgID, keyName, true)
 
 	statusObj := apiModifyKeySuccess{
 		Key:    keyName,
@@ -778,21 +869,89 @@ func handleRemoveSortedSetRange(keyName, scoreFrom, scoreTo string) error {
 	return GlobalSessionManager.Store().RemoveSortedSetRange(keyName, scoreFrom, scoreTo)
 }
 
-func handleGetAPIList() (interface{}, int) {
+func handleGetAPIList(tag, category string) (interface{}, int) {
 	apisMu.RLock()
 	defer apisMu.RUnlock()
-	apiIDList := make([]*apidef.APIDefinition, len(apisByID))
-	c := 0
+	apiIDList := make([]*apidef.APIDefinition, 0, len(apisByID))
 	for _, apiSpec := range apisByID {
-		apiIDList[c] = apiSpec.APIDefinition
-		c++
+		if specMatchesTags(apiSpec, tag, category) {
+			apiIDList = append(apiIDList, apiSpec.storedDefinition())
+		}
 	}
 	return apiIDList, http.StatusOK
 }
 
+// specMatchesTags checks whether the API has the given tag and category. An
+// empty tag or category matches any API.
+func specMatchesTags(spec *APISpec, tag, category string) bool {
+	if tag != "" && !contains(spec.Tags, tag) {
+		return false
+	}
+	if category != "" && !contains(apiCategories(spec.Name), category) {
+		return false
+	}
+	return true
+}
+
+// specsByTags returns the loaded APIs that have the given tag and category.
+func specsByTags(tag, category string) []*APISpec {
+	apisMu.RLock()
+	defer apisMu.RUnlock()
+
+	var specs []*APISpec
+	for _, spec := range apisByID {
+		if specMatchesTags(spec, tag, category) {
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
+
+// apiTagSummary lists the IDs of the APIs in each category and with each tag
+// swagger:model
+type apiTagSummary struct {
+	Categories map[string][]string `json:"categories"`
+	Tags       map[string][]string `json:"tags"`
+}
+
+// List API categories and tags
+// Lists the categories and tags of the loaded APIs, with the IDs of the APIs
+// in each of them. Categories are the words of the API name starting with "#".
+//
+//---
+// responses:
+//   200:
+//     description: Categories and tags summary
+//     schema:
+//       "$ref": "#/definitions/apiTagSummary"
+func apiCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	summary := apiTagSummary{
+		Categories: map[string][]string{},
+		Tags:       map[string][]string{},
+	}
+
+	for _, spec := range specsByTags("", "") {
+		for _, category := range apiCategories(spec.Name) {
+			summary.Categories[category] = append(summary.Categories[category], spec.APIID)
+		}
+		for _, tag := range spec.Tags {
+			summary.Tags[tag] = append(summary.Tags[tag], spec.APIID)
+		}
+	}
+
+	for _, apiIDs := range summary.Categories {
+		sort.Strings(apiIDs)
+	}
+	for _, apiIDs := range summary.Tags {
+		sort.Strings(apiIDs)
+	}
+
+	doJSONWrite(w, http.StatusOK, summary)
+}
+
 func handleGetAPI(apiID string) (interface{}, int) {
 	if spec := getApiSpec(apiID); spec != nil {
-		return spec.APIDefinition, http.StatusOK
+		return spec.storedDefinition(), http.StatusOK
 	}
 
 	log.WithFields(logrus.Fields{
@@ -830,6 +989,16 @@ func handleAddOrUpdateApi(apiID string, r *http.Request, fs afero.Fs) (interface
 		return apiError(fmt.Sprintf("Validation of API Definition failed. Reason: %s.", reason)), http.StatusBadRequest
 	}
 
+	if config.Global().ExpandAPIDefinitions {
+		// check the references on a copy, the file keeps them unexpanded
+		var expanded apidef.APIDefinition
+		raw, _ := json.Marshal(newDef)
+		json.Unmarshal(raw, &expanded)
+		if err := expandAPIDefinition(&expanded); err != nil {
+			return apiError(fmt.Sprintf("Validation of API Definition failed. Reason: %s.", err)), http.StatusBadRequest
+		}
+	}
+
 	// Create a filename
 	defFilePath := filepath.Join(config.Global().AppPath, newDef.APIID+".json")
 
@@ -897,9 +1066,17 @@ func apiHandler(w http.ResponseWriter, r *http.Request) {
 		if apiID != "" {
 			log.Debug("Requesting API definition for", apiID)
 			obj, code = handleGetAPI(apiID)
+		} else if archive := r.URL.Query().Get("archive"); archive != "" {
+			log.Debug("Requesting API archive")
+			writeAPIArchive(w, archive, r.URL.Query().Get("tag"), r.URL.Query().Get("category"))
+			return
+		} else if wantsNDJSON(r) {
+			log.Debug("Streaming API list")
+			streamAPIList(w, r, r.URL.Query().Get("tag"), r.URL.Query().Get("category"))
+			return
 		} else {
 			log.Debug("Requesting API list")
-			obj, code = handleGetAPIList()
+			obj, code = handleGetAPIList(r.URL.Query().Get("tag"), r.URL.Query().Get("category"))
 		}
 	case "POST":
 		log.Debug("Creating new definition file")
@@ -923,17 +1100,39 @@ func apiHandler(w http.ResponseWriter, r *http.Request) {
 	doJSONWrite(w, code, obj)
 }
 
+// usernameKey returns the key of a user name generated with the current hash
+// algorithm or, while migrating from one, with the first fallback algorithm
+// the user has a key for.
+func usernameKey(orgID, username string) string {
+	keyName := generateToken(orgID, username)
+	if exists, _ := GlobalSessionManager.Store().Exists(keyName); exists {
+		return keyName
+	}
+
+	for _, fallback := range config.Global().HashKeyFunctionFallback {
+		fallbackKeyName := generateToken(orgID, username, fallback)
+		if exists, _ := GlobalSessionManager.Store().Exists(fallbackKeyName); exists {
+			return fallbackKeyName
+		}
+	}
+
+	return keyName
+}
+
 func keyHandler(w http.ResponseWriter, r *http.Request) {
 	keyName := mux.Vars(r)["keyName"]
 	apiID := r.URL.Query().Get("api_id")
-	isHashed := r.URL.Query().Get("hashed") != ""
 	isUserName := r.URL.Query().Get("username") == "true"
 	orgID := r.URL.Query().Get("org_id")
+	isHashed := r.URL.Query().Get("hashed") != ""
+	if r.Method != http.MethodPost && !isUserName {
+		isHashed = keyIdentifierHashed(r, keyName, orgID)
+	}
 
 	// check if passed key is user name and convert it to real key with respect to current hashing algorithm
 	origKeyName := keyName
 	if r.Method != http.MethodPost && isUserName {
-		keyName = generateToken(orgID, keyName)
+		keyName = usernameKey(orgID, keyName)
 	}
 
 	var obj interface{}
@@ -971,9 +1170,17 @@ func keyHandler(w http.ResponseWriter, r *http.Request) {
 				}
 
 				// we don't use filter for hashed keys
+				if wantsNDJSON(r) {
+					streamAllKeys(w, r, "")
+					return
+				}
 				obj, code = handleGetAllKeys("")
 			} else {
 				filter := r.URL.Query().Get("filter")
+				if wantsNDJSON(r) {
+					streamAllKeys(w, r, filter)
+					return
+				}
 				obj, code = handleGetAllKeys(filter)
 			}
 		}
@@ -1056,6 +1263,7 @@ func handleUpdateHashedKey(keyName string, applyPolicies []string) (interface{},
 
 		return apiError("Could not write key data"), http.StatusInternalServerError
 	}
+	emitKeyspaceEvent(KeyspaceEventUpdated, sess.OrgID, keyName, true)
 
 	statusObj := apiModifyKeySuccess{
 		Key:    keyName,
@@ -1241,6 +1449,142 @@ func handleDeleteOrgKey(orgID string) (interface{}, int) {
 	return statusObj, http.StatusOK
 }
 
+// apiOrgUsage represents the current quota consumption and rate limit state
+// of an organisation. QuotaRemaining is -1 when the quota is unlimited.
+// swagger:model
+type apiOrgUsage struct {
+	OrgID            string  `json:"org_id"`
+	QuotaMax         int64   `json:"quota_max"`
+	QuotaUsed        int64   `json:"quota_used"`
+	QuotaRemaining   int64   `json:"quota_remaining"`
+	QuotaRenews      int64   `json:"quota_renews"`
+	QuotaRenewalRate int64   `json:"quota_renewal_rate"`
+	Rate             float64 `json:"rate"`
+	Per              float64 `json:"per"`
+	RateUsed         int     `json:"rate_used"`
+	RateLimited      bool    `json:"rate_limited"`
+}
+
+// Get organisation usage
+// Returns the current quota consumption and rate limit state of an organisation.
+//
+//---
+// responses:
+//   200:
+//     description: Organisation usage
+//     schema:
+//       "$ref": "#/definitions/apiOrgUsage"
+//   404:
+//     description: Org not found
+func orgUsageHandler(w http.ResponseWriter, r *http.Request) {
+	obj, code := handleGetOrgUsage(mux.Vars(r)["keyName"])
+	doJSONWrite(w, code, obj)
+}
+
+func handleGetOrgUsage(orgID string) (interface{}, int) {
+	spec := getSpecForOrg(orgID)
+	if spec == nil {
+		return apiError("Org not found"), http.StatusNotFound
+	}
+
+	session, ok := spec.OrgSessionManager.SessionDetail(orgID, orgID, false)
+	if !ok {
+		return apiError("Org not found"), http.StatusNotFound
+	}
+
+	store := spec.OrgSessionManager.Store()
+	keyHash := storage.HashKey(orgID)
+
+	usage := apiOrgUsage{
+		OrgID:            orgID,
+		QuotaMax:         session.QuotaMax,
+		QuotaRemaining:   -1,
+		QuotaRenews:      session.QuotaRenews,
+		QuotaRenewalRate: session.QuotaRenewalRate,
+		Rate:             session.Rate,
+		Per:              session.Per,
+	}
+
+	if used, err := store.GetRawKey(QuotaKeyPrefix + keyHash); err == nil {
+		usage.QuotaUsed, _ = strconv.ParseInt(used, 10, 64)
+	}
+	if usage.QuotaMax > 0 {
+		usage.QuotaRemaining = usage.QuotaMax - usage.QuotaUsed
+		if usage.QuotaRemaining < 0 {
+			usage.QuotaRemaining = 0
+		}
+	}
+
+	if session.Per > 0 {
+		usage.RateUsed, _ = store.GetRollingWindow(RateLimitKeyPrefix+keyHash, int64(session.Per),
+			config.Global().EnableNonTransactionalRateLimiter)
+	}
+	_, err := store.GetRawKey(RateLimitKeyPrefix + keyHash + ".BLOCKED")
+	usage.RateLimited = err == nil || (session.Rate > 0 && float64(usage.RateUsed) >= session.Rate)
+
+	log.WithFields(logrus.Fields{
+		"prefix": "api",
+		"org":    orgID,
+		"status": "ok",
+	}).Info("Retrieved usage for ORG ID.")
+
+	return usage, http.StatusOK
+}
+
+// Reset organisation quota
+// Resets the quota counters of an organisation without changing its session,
+// so that the quota period can be aligned with a billing cycle.
+//
+//---
+// responses:
+//   200:
+//     description: Quota reset
+//     schema:
+//       "$ref": "#/definitions/apiModifyKeySuccess"
+//   404:
+//     description: Org not found
+func orgResetQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	obj, code := handleOrgResetQuota(mux.Vars(r)["keyName"])
+	doJSONWrite(w, code, obj)
+}
+
+func handleOrgResetQuota(orgID string) (interface{}, int) {
+	spec := getSpecForOrg(orgID)
+	if spec == nil {
+		return apiError("Org not found"), http.StatusNotFound
+	}
+
+	session, ok := spec.OrgSessionManager.SessionDetail(orgID, orgID, false)
+	if !ok {
+		return apiError("Org not found"), http.StatusNotFound
+	}
+
+	store := spec.OrgSessionManager.Store()
+	keyHash := storage.HashKey(orgID)
+	rawKey := QuotaKeyPrefix + keyHash
+
+	store.DeleteRawKey(rawKey)
+	for _, acl := range session.GetAccessRights() {
+		if acl.AllowanceScope != "" {
+			store.DeleteRawKey(QuotaKeyPrefix + acl.AllowanceScope + "-" + keyHash)
+		}
+	}
+	// manage quotas separately
+	DefaultQuotaStore.RemoveSession(orgID, rawKey, false)
+
+	log.WithFields(logrus.Fields{
+		"prefix": "api",
+		"org":    orgID,
+		"status": "ok",
+	}).Info("Org quota reset.")
+
+	return apiModifyKeySuccess{
+		Key:    orgID,
+		Status: "ok",
+		Action: "quota reset",
+	}, http.StatusOK
+}
+
 func groupResetHandler(w http.ResponseWriter, r *http.Request) {
 	log.WithFields(logrus.Fields{
 		"prefix": "api",
@@ -1294,6 +1638,18 @@ func createKeyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if templateID := r.URL.Query().Get("template"); templateID != "" {
+		tpl, ok := getKeyTemplate(templateID)
+		if !ok {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Key template not found"))
+			return
+		}
+		if err := applyKeyTemplate(newSession, tpl); err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+			return
+		}
+	}
+
 	newKey := keyGen.GenerateAuthKey(newSession.OrgID)
 	if newSession.HMACEnabled {
 		newSession.HmacSecret = keyGen.GenerateHMACSecret()
@@ -1311,9 +1667,24 @@ func createKeyHandler(w http.ResponseWriter, r *http.Request) {
 	newSession.LastUpdated = strconv.Itoa(int(time.Now().Unix()))
 	newSession.DateCreated = time.Now()
 
-	mw := BaseMiddleware{}
-	// TODO: handle apply policies error
-	mw.ApplyPolicies(newSession)
+	applyOrgDefaultPolicies(newSession)
+	if obj, code := applyKeyPolicies(newSession, r); code != http.StatusOK {
+		doJSONWrite(w, code, obj)
+		return
+	}
+
+	storedName := storedKeyName(newKey, false)
+	if !claimKeyAlias(storedName, newSession) {
+		doJSONWrite(w, http.StatusConflict, apiError("Alias is already used by another key"))
+		return
+	}
+	// the alias is released if the key isn't stored
+	aliasIndexed := false
+	defer func() {
+		if !aliasIndexed {
+			releaseKeyAlias(storedName, newSession)
+		}
+	}()
 
 	if len(newSession.GetAccessRights()) > 0 {
 		// reset API-level limit to nil if any has a zero-value
@@ -1393,6 +1764,8 @@ func createKeyHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 	}
+	indexKeyAlias(storedName, newSession, "")
+	aliasIndexed = true
 
 	obj := apiModifyKeySuccess{
 		Action: "added",
@@ -1410,6 +1783,7 @@ func createKeyHandler(w http.ResponseWriter, r *http.Request) {
 		Org:              newSession.OrgID,
 		Key:              newKey,
 	})
+	emitKeyspaceEvent(KeyspaceEventCreated, newSession.OrgID, newKey, false)
 
 	log.WithFields(logrus.Fields{
 		"prefix":      "api",
@@ -1426,6 +1800,118 @@ func createKeyHandler(w http.ResponseWriter, r *http.Request) {
 	doJSONWrite(w, http.StatusOK, obj)
 }
 
+// apiEffectiveLimit is the limit that applies to a key for one API once its
+// policies are merged.
+//
+// swagger:model apiEffectiveLimit
+type apiEffectiveLimit struct {
+	APIID              string            `json:"api_id"`
+	APIName            string            `json:"api_name"`
+	Versions           []string          `json:"versions"`
+	AllowanceScope     string            `json:"allowance_scope,omitempty"`
+	Rate               float64           `json:"rate"`
+	Per                float64           `json:"per"`
+	ThrottleInterval   float64           `json:"throttle_interval"`
+	ThrottleRetryLimit int               `json:"throttle_retry_limit"`
+	MaxQueryDepth      int               `json:"max_query_depth"`
+	QuotaMax           int64             `json:"quota_max"`
+	QuotaRenewalRate   int64             `json:"quota_renewal_rate"`
+	QuotaRenewalPeriod string            `json:"quota_renewal_period,omitempty"`
+	AllowedURLs        []user.AccessSpec `json:"allowed_urls"`
+}
+
+// apiKeyPreview is the key as it would be created, with the limits that
+// apply per API and warnings about access rights that cannot be used.
+//
+// swagger:model apiKeyPreview
+type apiKeyPreview struct {
+	*user.SessionState
+	EffectiveLimits []apiEffectiveLimit `json:"effective_limits"`
+	Warnings        []string            `json:"warnings"`
+}
+
+// previewKey lists the limits the session gets for each API of its access
+// rights, the way the rate limiting and quota middleware reads them.
+func previewKey(session *user.SessionState) apiKeyPreview {
+	preview := apiKeyPreview{
+		SessionState:    session,
+		EffectiveLimits: []apiEffectiveLimit{},
+		Warnings:        []string{},
+	}
+
+	accessRights := session.GetAccessRights()
+	if len(accessRights) == 0 {
+		preview.Warnings = append(preview.Warnings, "key has no access rights")
+	}
+
+	apiIDs := make([]string, 0, len(accessRights))
+	for apiID := range accessRights {
+		apiIDs = append(apiIDs, apiID)
+	}
+	sort.Strings(apiIDs)
+
+	for _, apiID := range apiIDs {
+		access := accessRights[apiID]
+		spec := getApiSpec(apiID)
+		if spec == nil {
+			spec = &APISpec{APIDefinition: &apidef.APIDefinition{APIID: apiID}}
+			preview.Warnings = append(preview.Warnings, fmt.Sprintf("API %s is not loaded", apiID))
+		} else {
+			if !spec.VersionData.NotVersioned {
+				for _, version := range access.Versions {
+					if _, ok := spec.VersionData.Versions[version]; !ok {
+						preview.Warnings = append(preview.Warnings, fmt.Sprintf("version %q of API %s does not exist", version, apiID))
+					}
+				}
+			}
+			if spec.DisableRateLimit {
+				preview.Warnings = append(preview.Warnings, fmt.Sprintf("rate limiting is disabled for API %s", apiID))
+			}
+			if spec.DisableQuota {
+				preview.Warnings = append(preview.Warnings, fmt.Sprintf("quotas are disabled for API %s", apiID))
+			}
+		}
+
+		accessDef, allowanceScope, err := GetAccessDefinitionByAPIIDOrSession(session, spec)
+		if err != nil {
+			continue
+		}
+
+		preview.EffectiveLimits = append(preview.EffectiveLimits, apiEffectiveLimit{
+			APIID:              apiID,
+			APIName:            access.APIName,
+			Versions:           access.Versions,
+			AllowanceScope:     allowanceScope,
+			Rate:               accessDef.Limit.Rate,
+			Per:                accessDef.Limit.Per,
+			ThrottleInterval:   accessDef.Limit.ThrottleInterval,
+			ThrottleRetryLimit: accessDef.Limit.ThrottleRetryLimit,
+			MaxQueryDepth:      accessDef.Limit.MaxQueryDepth,
+			QuotaMax:           accessDef.Limit.QuotaMax,
+			QuotaRenewalRate:   accessDef.Limit.QuotaRenewalRate,
+			QuotaRenewalPeriod: accessDef.Limit.QuotaRenewalPeriod,
+			AllowedURLs:        access.AllowedURLs,
+		})
+	}
+
+	return preview
+}
+
+// Preview a key
+// Applies the policies of the key without saving it. Along with the key, the
+// response lists the limits that apply per API and warnings about access
+// rights that cannot be used, such as APIs or versions that are not loaded.
+//
+//---
+// responses:
+//   200:
+//     description: Key preview
+//     schema:
+//       "$ref": "#/definitions/apiKeyPreview"
+//   400:
+//     description: Policies cannot be applied
+//     schema:
+//       "$ref": "#/definitions/apiPolicyError"
 func previewKeyHandler(w http.ResponseWriter, r *http.Request) {
 	newSession := user.NewSessionState()
 	if err := json.NewDecoder(r.Body).Decode(newSession); err != nil {
@@ -1441,11 +1927,12 @@ func previewKeyHandler(w http.ResponseWriter, r *http.Request) {
 	newSession.LastUpdated = strconv.Itoa(int(time.Now().Unix()))
 	newSession.DateCreated = time.Now()
 
-	mw := BaseMiddleware{}
-	// TODO: handle apply policies error
-	mw.ApplyPolicies(newSession)
+	if obj, code := applyKeyPolicies(newSession, r); code != http.StatusOK {
+		doJSONWrite(w, code, obj)
+		return
+	}
 
-	doJSONWrite(w, http.StatusOK, newSession)
+	doJSONWrite(w, http.StatusOK, previewKey(newSession))
 }
 
 // NewClientRequest is an outward facing JSON object translated from osin OAuthClients
@@ -1581,7 +2068,8 @@ func createOauthClient(w http.ResponseWriter, r *http.Request) {
 								storageManager,
 								GlobalSessionManager,
 								&storage.RedisCluster{KeyPrefix: prefix, HashKeys: false},
-								apiSpec.OrgID}),
+								apiSpec.OrgID,
+								apiSpec}),
 					}
 				}
 				err := apiSpec.OAuthManager.OsinServer.Storage.SetClient(storageID, apiSpec.APIDefinition.OrgID, &newClient, true)
@@ -1965,7 +2453,8 @@ func getOauthClientDetails(keyName, apiID string) (interface{}, int) {
 					storageManager,
 					GlobalSessionManager,
 					&storage.RedisCluster{KeyPrefix: prefix, HashKeys: false},
-					apiSpec.OrgID}),
+					apiSpec.OrgID,
+					apiSpec}),
 		}
 	}
 
@@ -2162,6 +2651,49 @@ func userRatesCheck(w http.ResponseWriter, r *http.Request) {
 func invalidateCacheHandler(w http.ResponseWriter, r *http.Request) {
 	apiID := mux.Vars(r)["apiID"]
 
+	if !invalidateAPICache(apiID, r) {
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Cache invalidation failed"))
+		return
+	}
+
+	doJSONWrite(w, http.StatusOK, apiOk("cache invalidated"))
+}
+
+// Invalidate the cache of tagged APIs
+// Invalidates the cache of all APIs with the given tag and/or category.
+//
+//---
+// parameters:
+// - name: tag
+//   in: query
+//   type: string
+// - name: category
+//   in: query
+//   type: string
+// responses:
+//   200:
+//     description: Cache invalidated
+//   400:
+//     description: No tag or category given
+func invalidateTaggedCacheHandler(w http.ResponseWriter, r *http.Request) {
+	tag, category := r.URL.Query().Get("tag"), r.URL.Query().Get("category")
+	if tag == "" && category == "" {
+		doJSONWrite(w, http.StatusBadRequest, apiError("A tag or category is required"))
+		return
+	}
+
+	specs := specsByTags(tag, category)
+	for _, spec := range specs {
+		if !invalidateAPICache(spec.APIID, r) {
+			doJSONWrite(w, http.StatusInternalServerError, apiError("Cache invalidation failed"))
+			return
+		}
+	}
+
+	doJSONWrite(w, http.StatusOK, apiOk(fmt.Sprintf("cache invalidated for %d APIs", len(specs))))
+}
+
+func invalidateAPICache(apiID string, r *http.Request) bool {
 	keyPrefix := "cache-" + apiID
 	matchPattern := keyPrefix + "*"
 	store := storage.RedisCluster{KeyPrefix: keyPrefix, IsCache: true}
@@ -2183,12 +2715,10 @@ func invalidateCacheHandler(w http.ResponseWriter, r *http.Request) {
 			"path":        "--",
 			"server_name": "system",
 		}).Error("Failed to delete cache: ", err)
-
-		doJSONWrite(w, http.StatusInternalServerError, apiError("Cache invalidation failed"))
-		return
+		return false
 	}
 
-	doJSONWrite(w, http.StatusOK, apiOk("cache invalidated"))
+	return true
 }
 
 func RevokeTokenHandler(w http.ResponseWriter, r *http.Request) {
@@ -2293,7 +2823,6 @@ func RevokeAllTokensHandler(w http.ResponseWriter, r *http.Request) {
 			tokens = append(tokens, tokensRevoked...)
 		}
 	}
-
 	n := Notification{
 		Command: KeySpaceUpdateNotification,
 		Payload: strings.Join(tokens, ","),
@@ -2503,6 +3032,62 @@ func ctxGetGraphQLIsWebSocketUpgrade(r *http.Request) (isWebSocketUpgrade bool)
 	return false
 }
 
+func ctxSetGraphQLIsSSE(r *http.Request, isSSE bool) {
+	setCtxValue(r, ctx.GraphQLIsSSE, isSSE)
+}
+
+func ctxGetGraphQLIsSSE(r *http.Request) (isSSE bool) {
+	if v := r.Context().Value(ctx.GraphQLIsSSE); v != nil {
+		if isSSE, ok := v.(bool); ok {
+			return isSSE
+		}
+	}
+
+	return false
+}
+
+func ctxSetTrafficSplitVariant(r *http.Request, variant string) {
+	setCtxValue(r, ctx.TrafficSplitVariant, variant)
+}
+
+func ctxGetTrafficSplitVariant(r *http.Request) string {
+	if v := r.Context().Value(ctx.TrafficSplitVariant); v != nil {
+		if variant, ok := v.(string); ok {
+			return variant
+		}
+	}
+
+	return ""
+}
+
+func ctxSetStaleResponse(r *http.Request, serve staleResponse) {
+	setCtxValue(r, ctx.StaleResponse, serve)
+}
+
+func ctxGetStaleResponse(r *http.Request) staleResponse {
+	if v := r.Context().Value(ctx.StaleResponse); v != nil {
+		if serve, ok := v.(staleResponse); ok {
+			return serve
+		}
+	}
+
+	return nil
+}
+
+func ctxSetRequestTiming(r *http.Request, timing *requestTiming) {
+	setCtxValue(r, ctx.RequestTiming, timing)
+}
+
+func ctxGetRequestTiming(r *http.Request) *requestTiming {
+	if v := r.Context().Value(ctx.RequestTiming); v != nil {
+		if timing, ok := v.(*requestTiming); ok {
+			return timing
+		}
+	}
+
+	return nil
+}
+
 func ctxGetDefaultVersion(r *http.Request) bool {
 	return r.Context().Value(ctx.VersionDefault) != nil
 }
@@ -2529,9 +3114,16 @@ func ctxSetLoopLevel(r *http.Request, value int) {
 	setCtxValue(r, ctx.LoopLevel, value)
 }
 
-func ctxIncLoopLevel(r *http.Request, loopLimit int) {
-	ctxSetLoopLimit(r, loopLimit)
-	ctxSetLoopLevel(r, ctxLoopLevel(r)+1)
+func ctxLoopTrace(r *http.Request) []LoopHop {
+	if v := r.Context().Value(ctx.LoopTrace); v != nil {
+		return v.([]LoopHop)
+	}
+	return nil
+}
+
+func ctxAddLoopHop(r *http.Request, hop LoopHop) {
+	trace := ctxLoopTrace(r)
+	setCtxValue(r, ctx.LoopTrace, append(trace[:len(trace):len(trace)], hop))
 }
 
 func ctxLoopLevelLimit(r *http.Request) int {
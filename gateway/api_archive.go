@@ -0,0 +1,76 @@
+package gateway
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+const apiArchiveChecksums = "SHA256SUMS"
+
+// writeAPIArchive streams the definitions of the loaded APIs with the given
+// tag and category as a zip archive, with one file per API and a SHA256SUMS
+// file listing their checksums in the format of sha256sum.
+func writeAPIArchive(w http.ResponseWriter, format, tag, category string) {
+	if format != "zip" {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Unsupported archive format, only zip is supported"))
+		return
+	}
+
+	apisMu.RLock()
+	defs := make([]*apidef.APIDefinition, 0, len(apisByID))
+	for _, spec := range apisByID {
+		if specMatchesTags(spec, tag, category) {
+			defs = append(defs, spec.storedDefinition())
+		}
+	}
+	apisMu.RUnlock()
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].APIID < defs[j].APIID
+	})
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="apis.zip"`)
+	w.WriteHeader(http.StatusOK)
+
+	archive := zip.NewWriter(w)
+	var checksums []byte
+	for _, def := range defs {
+		data, err := json.MarshalIndent(def, "", "  ")
+		if err != nil {
+			log.WithError(err).WithField("api_id", def.APIID).Error("Couldn't marshal API definition for archive")
+			continue
+		}
+
+		name := "apis/" + url.PathEscape(def.APIID) + ".json"
+		file, err := archive.Create(name)
+		if err == nil {
+			_, err = file.Write(data)
+		}
+		if err != nil {
+			// The client went away, the archive can't be completed
+			log.WithError(err).Error("Couldn't write API archive")
+			return
+		}
+
+		sum := sha256.Sum256(data)
+		checksums = append(checksums, hex.EncodeToString(sum[:])+"  "+name+"\n"...)
+	}
+
+	file, err := archive.Create(apiArchiveChecksums)
+	if err == nil {
+		_, err = file.Write(checksums)
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		log.WithError(err).Error("Couldn't write API archive")
+	}
+}
@@ -0,0 +1,71 @@
+package gateway
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestAPIArchive(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "api-b"
+		spec.Proxy.ListenPath = "/b/"
+		spec.Tags = []string{"backup"}
+	}, func(spec *APISpec) {
+		spec.APIID = "api-a"
+		spec.Proxy.ListenPath = "/a/"
+		spec.Tags = []string{"backup"}
+	}, func(spec *APISpec) {
+		spec.APIID = "api-c"
+		spec.Proxy.ListenPath = "/c/"
+	})
+
+	resp, _ := ts.Run(t, test.TestCase{Path: "/tyk/apis?archive=zip&tag=backup", AdminAuth: true, Code: http.StatusOK,
+		HeadersMatch: map[string]string{"Content-Type": "application/zip"}})
+	body, _ := ioutil.ReadAll(resp.Body)
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{}
+	var names []string
+	for _, f := range archive.File {
+		r, _ := f.Open()
+		files[f.Name], _ = ioutil.ReadAll(r)
+		r.Close()
+		names = append(names, f.Name)
+	}
+	expectNames := "apis/api-a.json,apis/api-b.json,SHA256SUMS"
+	if got := strings.Join(names, ","); got != expectNames {
+		t.Fatalf("Expected files %s, got %s", expectNames, got)
+	}
+
+	var def apidef.APIDefinition
+	if err := json.Unmarshal(files["apis/api-a.json"], &def); err != nil || def.Proxy.ListenPath != "/a/" {
+		t.Errorf("Expected the definition of api-a, got %+v (%v)", def, err)
+	}
+
+	var expectSums string
+	for _, name := range []string{"apis/api-a.json", "apis/api-b.json"} {
+		sum := sha256.Sum256(files[name])
+		expectSums += hex.EncodeToString(sum[:]) + "  " + name + "\n"
+	}
+	if got := string(files["SHA256SUMS"]); got != expectSums {
+		t.Errorf("Expected checksums:\n%s\ngot:\n%s", expectSums, got)
+	}
+
+	_, _ = ts.Run(t, test.TestCase{Path: "/tyk/apis?archive=tar", AdminAuth: true, Code: http.StatusBadRequest})
+}
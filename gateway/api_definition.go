@@ -11,6 +11,8 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -25,10 +27,13 @@ import (
 	circuit "github.com/TykTechnologies/circuitbreaker"
 	"github.com/gorilla/mux"
 	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
+	cache "github.com/pmylund/go-cache"
+	"github.com/rs/cors"
 	"github.com/sirupsen/logrus"
 
 	"github.com/TykTechnologies/gojsonschema"
 	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/condition"
 	"github.com/TykTechnologies/tyk/config"
 	"github.com/TykTechnologies/tyk/headers"
 	"github.com/TykTechnologies/tyk/regexp"
@@ -80,6 +85,10 @@ const (
 	ValidateJSONRequest
 	Internal
 	GoPlugin
+	CORSEndpoint
+	Idempotent
+	FallbackResponse
+	StaticResponse
 )
 
 // RequestStatus is a custom type to avoid collisions
@@ -113,6 +122,10 @@ const (
 	StatusValidateJSON             RequestStatus = "Validate JSON"
 	StatusInternal                 RequestStatus = "Internal path"
 	StatusGoPlugin                 RequestStatus = "Go plugin"
+	StatusCORS                     RequestStatus = "CORS endpoint"
+	StatusIdempotent               RequestStatus = "Idempotent endpoint"
+	StatusFallbackResponse         RequestStatus = "Fallback response"
+	StatusStaticResponse           RequestStatus = "Static response"
 )
 
 // URLSpec represents a flattened specification for URLs, used to check if a proxy URL
@@ -132,7 +145,7 @@ type URLSpec struct {
 	HardTimeout               apidef.HardTimeoutMeta
 	CircuitBreaker            ExtendedCircuitBreakerMeta
 	URLRewrite                *apidef.URLRewriteMeta
-	VirtualPathSpec           apidef.VirtualMeta
+	VirtualPathSpec           EndpointVirtualSpec
 	RequestSize               apidef.RequestSizeMeta
 	MethodTransform           apidef.MethodTransformMeta
 	TrackEndpoint             apidef.TrackEndpointMeta
@@ -140,6 +153,13 @@ type URLSpec struct {
 	ValidatePathMeta          apidef.ValidatePathMeta
 	Internal                  apidef.InternalMeta
 	GoPluginMeta              GoPluginMiddleware
+	CORS                      *EndpointCORSSpec
+	Idempotency               apidef.IdempotencyMeta
+	Fallback                  apidef.FallbackMeta
+	StaticResponse            *StaticResponseSpec
+
+	// Condition decides whether the middleware entry runs for a request.
+	Condition *condition.Condition
 
 	IgnoreCase bool
 }
@@ -148,11 +168,35 @@ type EndPointCacheMeta struct {
 	Method                 string
 	CacheKeyRegex          string
 	CacheOnlyResponseCodes []int
+	CoalesceRequests       bool
+	CoalesceMaxWait        float64
 }
 
 type TransformSpec struct {
 	apidef.TemplateMeta
 	Template *template.Template
+	// Tiers are the transforms of the callers of each tier.
+	Tiers map[string]*TransformSpec
+}
+
+// EndpointVirtualSpec holds the state shared by the requests to a virtual
+// endpoint.
+type EndpointVirtualSpec struct {
+	apidef.VirtualMeta
+	cache *cache.Cache
+	slots chan struct{}
+}
+
+// EndpointCORSSpec holds the CORS handler of an endpoint
+type EndpointCORSSpec struct {
+	apidef.CORSMeta
+	Cors *cors.Cors
+}
+
+// StaticResponseSpec holds the parsed body template of a static response.
+type StaticResponseSpec struct {
+	apidef.StaticResponseMeta
+	Template *template.Template
 }
 
 type ExtendedCircuitBreakerMeta struct {
@@ -192,8 +236,36 @@ type APISpec struct {
 
 	middlewareChain *ChainObject
 
+	// routeIndexes index the URL specs of each version in RxPaths.
+	routeIndexes map[*URLSpec]*routeIndex
+	// loadWarnings are the entries of the definition that couldn't be loaded
+	// and were left out, reported in the load statuses.
+	loadWarnings []string
+	// headerPreserve maps the canonical names of the headers in
+	// header_casing.preserve to the casing they must have.
+	headerPreserve map[string]string
+
 	network NetworkStats
 
+	// definitionErr is why the definition couldn't be loaded as is.
+	definitionErr error
+
+	// tracing is set on the specs made to trace requests, whose traffic
+	// isn't counted in the stats of the API.
+	tracing bool
+
+	// muxListenPath is the listen path the API is routed with, its wildcards
+	// turned into parameters.
+	muxListenPath string
+
+	// trafficSplitTargets are the parsed targets of the traffic split rules,
+	// by rule index, nil for the rules left out as theirs is invalid.
+	trafficSplitTargets []*url.URL
+
+	// rawDefinition is the definition before its references were expanded,
+	// which is the one returned and persisted so as not to leak their values.
+	rawDefinition *apidef.APIDefinition
+
 	GraphQLExecutor struct {
 		Engine   *graphql.ExecutionEngine
 		EngineV2 *graphql.ExecutionEngineV2
@@ -223,9 +295,13 @@ func (s *APISpec) Release() {
 
 // Validate returns nil if s is a valid spec and an error stating why the spec is not valid.
 func (s *APISpec) Validate() error {
+	if s.definitionErr != nil {
+		return s.definitionErr
+	}
+
 	// For tcp services we need to make sure we can bind to the port.
 	switch s.Protocol {
-	case "tcp", "tls":
+	case "tcp", "tls", "udp":
 		return s.validateTCP()
 	default:
 		return s.validateHTTP()
@@ -246,20 +322,68 @@ func (s *APISpec) validateHTTP() error {
 
 // APIDefinitionLoader will load an Api definition from a storage
 // system.
-type APIDefinitionLoader struct{}
+type APIDefinitionLoader struct {
+	// warnings collects the entries of the definition MakeSpec is making a
+	// spec of which are left out as they couldn't be loaded.
+	warnings *[]string
+}
+
+// warn reports an entry of the definition left out of the spec.
+func (a APIDefinitionLoader) warn(format string, args ...interface{}) {
+	if a.warnings != nil {
+		*a.warnings = append(*a.warnings, fmt.Sprintf(format, args...))
+	}
+}
 
 // Nonce to use when interacting with the dashboard service
 var ServiceNonce string
 
+// storedDefinition returns a copy of the definition of the API as it was
+// loaded, with its references unexpanded. It is copied under the lock as its
+// GraphQL configuration may be updated at runtime.
+func (a *APISpec) storedDefinition() *apidef.APIDefinition {
+	a.RLock()
+	defer a.RUnlock()
+	def := *a.APIDefinition
+	if a.rawDefinition != nil {
+		def = *a.rawDefinition
+	}
+	return &def
+}
+
 // MakeSpec will generate a flattened URLSpec from and APIDefinitions' VersionInfo data. paths are
 // keyed to the Api version name, which is determined during routing to speed up lookups
 func (a APIDefinitionLoader) MakeSpec(def *apidef.APIDefinition, logger *logrus.Entry) *APISpec {
 	spec := &APISpec{}
+	a.warnings = &spec.loadWarnings
 
 	if logger == nil {
 		logger = logrus.NewEntry(log)
 	}
 
+	if config.Global().ExpandAPIDefinitions {
+		expanded, err := expandedAPIDefinition(def)
+		if err != nil {
+			logger.WithError(err).WithField("api_id", def.APIID).Error("Couldn't expand API definition")
+			spec.definitionErr = err
+		}
+		spec.rawDefinition = def
+		def = expanded
+	}
+
+	if err := validateFieldMasking(def.FieldMasking); err != nil && spec.definitionErr == nil {
+		logger.WithError(err).WithField("api_id", def.APIID).Error("Invalid field masking rules")
+		spec.definitionErr = err
+	}
+	if err := validateConditions(def); err != nil && spec.definitionErr == nil {
+		logger.WithError(err).WithField("api_id", def.APIID).Error("Invalid middleware condition")
+		spec.definitionErr = err
+	}
+	if err := validateUptimeTests(def); err != nil && spec.definitionErr == nil {
+		logger.WithError(err).WithField("api_id", def.APIID).Error("Invalid uptime test")
+		spec.definitionErr = err
+	}
+
 	// parse version expiration time stamps
 	for key, ver := range def.VersionData.Versions {
 		if ver.Expires == "" || ver.Expires == "-1" {
@@ -274,6 +398,18 @@ func (a APIDefinitionLoader) MakeSpec(def *apidef.APIDefinition, logger *logrus.
 		}
 	}
 
+	// parse the traffic split targets, the rules with an invalid one
+	// matching no requests
+	spec.trafficSplitTargets = make([]*url.URL, len(def.TrafficSplit))
+	for i, rule := range def.TrafficSplit {
+		target, err := parseTrafficSplitTarget(rule.Target)
+		if err != nil {
+			a.warn("traffic split variant %q left out: %v", rule.Variant, err)
+			continue
+		}
+		spec.trafficSplitTargets[i] = target
+	}
+
 	spec.APIDefinition = def
 
 	// We'll push the default HealthChecker:
@@ -345,6 +481,8 @@ func (a APIDefinitionLoader) MakeSpec(def *apidef.APIDefinition, logger *logrus.
 		spec.RxPaths[v.Name] = pathSpecs
 		spec.WhiteListEnabled[v.Name] = whiteListSpecs
 	}
+	spec.routeIndexes = newRouteIndexes(spec.RxPaths)
+	spec.headerPreserve = newHeaderPreserve(def.HeaderCasing.Preserve)
 
 	return spec
 }
@@ -464,7 +602,14 @@ func (a APIDefinitionLoader) FromRPC(orgId string) ([]*APISpec, error) {
 		}
 	}
 
-	return a.processRPCDefinitions(apiCollection)
+	specs, err := a.processRPCDefinitions(apiCollection)
+	if err != nil {
+		return nil, err
+	}
+
+	lastRPCAPISync.Touch()
+
+	return specs, nil
 }
 
 func (a APIDefinitionLoader) processRPCDefinitions(apiCollection string) ([]*APISpec, error) {
@@ -537,6 +682,9 @@ func (a APIDefinitionLoader) getPathSpecs(apiVersionDef apidef.VersionInfo) ([]U
 	return combinedPath, len(whiteListPaths) > 0
 }
 
+// matchNoPath stands for invalid paths.
+var matchNoPath = regexp.MustCompile(`[^\s\S]`)
+
 func (a APIDefinitionLoader) generateRegex(stringSpec string, newSpec *URLSpec, specType URLStatus) {
 	apiLangIDsRegex := regexp.MustCompile(`{([^}]*)}`)
 	asRegexStr := apiLangIDsRegex.ReplaceAllString(stringSpec, `([^/]*)`)
@@ -544,7 +692,12 @@ func (a APIDefinitionLoader) generateRegex(stringSpec string, newSpec *URLSpec,
 	if newSpec.IgnoreCase || config.Global().IgnoreEndpointCase {
 		asRegexStr = "(?i)" + asRegexStr
 	}
-	asRegex, _ := regexp.Compile(asRegexStr)
+	asRegex, err := regexp.Compile(asRegexStr)
+	if err != nil {
+		log.WithError(err).Error("Invalid path, it matches no requests: ", stringSpec)
+		a.warn("invalid path %q, it matches no requests: %v", stringSpec, err)
+		asRegex = matchNoPath
+	}
 	newSpec.Status = specType
 	newSpec.Spec = asRegex
 }
@@ -600,6 +753,8 @@ func (a APIDefinitionLoader) compileCachedPathSpec(oldpaths []string, newpaths [
 		newSpec.CacheConfig.Method = spec.Method
 		newSpec.CacheConfig.CacheKeyRegex = spec.CacheKeyRegex
 		newSpec.CacheConfig.CacheOnlyResponseCodes = spec.CacheOnlyResponseCodes
+		newSpec.CacheConfig.CoalesceRequests = spec.CoalesceRequests
+		newSpec.CacheConfig.CoalesceMaxWait = spec.CoalesceMaxWait
 		// Extend with method actions
 		urlSpec = append(urlSpec, newSpec)
 	}
@@ -646,17 +801,20 @@ func (a APIDefinitionLoader) compileTransformPathSpec(paths []apidef.TemplateMet
 
 		// Load the templates
 		var err error
-
-		switch stringSpec.TemplateData.Mode {
-		case apidef.UseFile:
-			log.Debug("-- Using File mode")
-			newTransformSpec.Template, err = a.loadFileTemplate(stringSpec.TemplateData.TemplateSource)
-		case apidef.UseBlob:
-			log.Debug("-- Blob mode")
-			newTransformSpec.Template, err = a.loadBlobTemplate(stringSpec.TemplateData.TemplateSource)
-		default:
-			log.Warning("[Transform Templates] No template mode defined! Found: ", stringSpec.TemplateData.Mode)
-			err = errors.New("No valid template mode defined, must be either 'file' or 'blob'")
+		newTransformSpec.Template, err = a.loadTemplate(stringSpec.TemplateData)
+		for tier, data := range stringSpec.TierTemplates {
+			if err != nil {
+				break
+			}
+			tierSpec := &TransformSpec{TemplateMeta: apidef.TemplateMeta{TemplateData: data}}
+			if tierSpec.Template, err = a.loadTemplate(data); err != nil {
+				err = fmt.Errorf("template of tier %q: %v", tier, err)
+				break
+			}
+			if newTransformSpec.Tiers == nil {
+				newTransformSpec.Tiers = make(map[string]*TransformSpec)
+			}
+			newTransformSpec.Tiers[tier] = tierSpec
 		}
 
 		if stat == Transformed {
@@ -665,11 +823,16 @@ func (a APIDefinitionLoader) compileTransformPathSpec(paths []apidef.TemplateMet
 			newSpec.TransformResponseAction = newTransformSpec
 		}
 
+		if err == nil {
+			newSpec.Condition, err = compileCondition(stringSpec.Condition)
+		}
+
 		if err == nil {
 			urlSpec = append(urlSpec, newSpec)
 			log.Debug("-- Loaded")
 		} else {
 			log.Error("Template load failure! Skipping transformation: ", err)
+			a.warn("transform of %s %s left out: %v", stringSpec.Method, stringSpec.Path, err)
 		}
 
 	}
@@ -677,6 +840,20 @@ func (a APIDefinitionLoader) compileTransformPathSpec(paths []apidef.TemplateMet
 	return urlSpec
 }
 
+func (a APIDefinitionLoader) loadTemplate(data apidef.TemplateData) (*template.Template, error) {
+	switch data.Mode {
+	case apidef.UseFile:
+		log.Debug("-- Using File mode")
+		return a.loadFileTemplate(data.TemplateSource)
+	case apidef.UseBlob:
+		log.Debug("-- Blob mode")
+		return a.loadBlobTemplate(data.TemplateSource)
+	default:
+		log.Warning("[Transform Templates] No template mode defined! Found: ", data.Mode)
+		return nil, errors.New("No valid template mode defined, must be either 'file' or 'blob'")
+	}
+}
+
 func (a APIDefinitionLoader) compileInjectedHeaderSpec(paths []apidef.HeaderInjectionMeta, stat URLStatus) []URLSpec {
 	// transform an extended configuration URL into an array of URLSpecs
 	// This way we can iterate the whole array once, on match we break with status
@@ -692,6 +869,13 @@ func (a APIDefinitionLoader) compileInjectedHeaderSpec(paths []apidef.HeaderInje
 			newSpec.InjectHeadersResponse = stringSpec
 		}
 
+		var err error
+		if newSpec.Condition, err = compileCondition(stringSpec.Condition); err != nil {
+			log.WithError(err).Error("Skipping header injection")
+			a.warn("header injection of %s %s left out: %v", stringSpec.Method, stringSpec.Path, err)
+			continue
+		}
+
 		urlSpec = append(urlSpec, newSpec)
 	}
 
@@ -748,6 +932,51 @@ func (a APIDefinitionLoader) compileRequestSizePathSpec(paths []apidef.RequestSi
 	return urlSpec
 }
 
+func (a APIDefinitionLoader) compileIdempotencyPathSpec(paths []apidef.IdempotencyMeta, stat URLStatus) []URLSpec {
+	urlSpec := []URLSpec{}
+
+	for _, stringSpec := range paths {
+		newSpec := URLSpec{}
+		a.generateRegex(stringSpec.Path, &newSpec, stat)
+		newSpec.Idempotency = stringSpec
+		urlSpec = append(urlSpec, newSpec)
+	}
+
+	return urlSpec
+}
+
+func (a APIDefinitionLoader) compileFallbackPathSpec(paths []apidef.FallbackMeta, stat URLStatus) []URLSpec {
+	urlSpec := []URLSpec{}
+
+	for _, stringSpec := range paths {
+		newSpec := URLSpec{}
+		a.generateRegex(stringSpec.Path, &newSpec, stat)
+		newSpec.Fallback = stringSpec
+		urlSpec = append(urlSpec, newSpec)
+	}
+
+	return urlSpec
+}
+
+func (a APIDefinitionLoader) compileStaticResponsePathSpec(paths []apidef.StaticResponseMeta, stat URLStatus) []URLSpec {
+	urlSpec := []URLSpec{}
+
+	for _, stringSpec := range paths {
+		tmpl, err := apidef.Template.New("").Funcs(a.filterSprigFuncs()).Parse(stringSpec.Body)
+		if err != nil {
+			log.WithError(err).Error("Template load failure! Skipping static response: ", stringSpec.Path)
+			a.warn("static response of %s %s left out: %v", stringSpec.Method, stringSpec.Path, err)
+			continue
+		}
+		newSpec := URLSpec{}
+		a.generateRegex(stringSpec.Path, &newSpec, stat)
+		newSpec.StaticResponse = &StaticResponseSpec{StaticResponseMeta: stringSpec, Template: tmpl}
+		urlSpec = append(urlSpec, newSpec)
+	}
+
+	return urlSpec
+}
+
 func (a APIDefinitionLoader) compileCircuitBreakerPathSpec(paths []apidef.CircuitBreakerMeta, stat URLStatus, apiSpec *APISpec) []URLSpec {
 	// transform an extended configuration URL into an array of URLSpecs
 	// This way we can iterate the whole array once, on match we break with status
@@ -852,9 +1081,16 @@ func (a APIDefinitionLoader) compileVirtualPathspathSpec(paths []apidef.VirtualM
 		newSpec := URLSpec{}
 		a.generateRegex(stringSpec.Path, &newSpec, stat)
 		// Extend with method actions
-		newSpec.VirtualPathSpec = stringSpec
+		newSpec.VirtualPathSpec = EndpointVirtualSpec{VirtualMeta: stringSpec}
+		if stringSpec.CacheTTL > 0 {
+			ttl := time.Duration(stringSpec.CacheTTL) * time.Second
+			newSpec.VirtualPathSpec.cache = cache.New(ttl, ttl)
+		}
+		if stringSpec.MaxConcurrency > 0 {
+			newSpec.VirtualPathSpec.slots = make(chan struct{}, stringSpec.MaxConcurrency)
+		}
 
-		preLoadVirtualMetaCode(&newSpec.VirtualPathSpec, &apiSpec.JSVM)
+		preLoadVirtualMetaCode(&newSpec.VirtualPathSpec.VirtualMeta, &apiSpec.JSVM)
 
 		urlSpec = append(urlSpec, newSpec)
 	}
@@ -907,16 +1143,23 @@ func (a APIDefinitionLoader) compileTrackedEndpointPathspathSpec(paths []apidef.
 }
 
 func (a APIDefinitionLoader) compileValidateJSONPathspathSpec(paths []apidef.ValidatePathMeta, stat URLStatus) []URLSpec {
-	urlSpec := make([]URLSpec, len(paths))
+	urlSpec := make([]URLSpec, 0, len(paths))
 
-	for i, stringSpec := range paths {
+	for _, stringSpec := range paths {
 		newSpec := URLSpec{}
 		a.generateRegex(stringSpec.Path, &newSpec, stat)
 		// Extend with method actions
 
 		stringSpec.SchemaCache = gojsonschema.NewGoLoader(stringSpec.Schema)
 		newSpec.ValidatePathMeta = stringSpec
-		urlSpec[i] = newSpec
+
+		var err error
+		if newSpec.Condition, err = compileCondition(stringSpec.Condition); err != nil {
+			log.WithError(err).Error("Skipping JSON validation")
+			a.warn("JSON validation of %s %s left out: %v", stringSpec.Method, stringSpec.Path, err)
+			continue
+		}
+		urlSpec = append(urlSpec, newSpec)
 	}
 
 	return urlSpec
@@ -950,6 +1193,55 @@ func (a APIDefinitionLoader) compileInternalPathspathSpec(paths []apidef.Interna
 	return urlSpec
 }
 
+func (a APIDefinitionLoader) compileCORSPathSpec(paths []apidef.CORSMeta, stat URLStatus, apiSpec *APISpec) []URLSpec {
+	if !apiSpec.CORS.Enable {
+		return nil
+	}
+
+	urlSpec := []URLSpec{}
+
+	for _, stringSpec := range paths {
+		newSpec := URLSpec{}
+		a.generateRegex(stringSpec.Path, &newSpec, stat)
+		newSpec.CORS = &EndpointCORSSpec{
+			CORSMeta: stringSpec,
+			Cors:     cors.New(corsOptions(apiSpec.CORS, stringSpec)),
+		}
+		urlSpec = append(urlSpec, newSpec)
+	}
+
+	return urlSpec
+}
+
+// deriveCORSMeta returns CORS overrides allowing, for each white listed or
+// ignored path, the methods defined for it.
+func deriveCORSMeta(extendedPaths apidef.ExtendedPathsSet) []apidef.CORSMeta {
+	var paths []string
+	methods := map[string][]string{}
+
+	endpoints := append([]apidef.EndPointMeta{}, extendedPaths.WhiteList...)
+	endpoints = append(endpoints, extendedPaths.Ignored...)
+	for _, endpoint := range endpoints {
+		if _, ok := methods[endpoint.Path]; !ok {
+			paths = append(paths, endpoint.Path)
+		}
+		for method := range endpoint.MethodActions {
+			methods[endpoint.Path] = append(methods[endpoint.Path], method)
+		}
+	}
+
+	metas := make([]apidef.CORSMeta, 0, len(paths))
+	for _, path := range paths {
+		if len(methods[path]) == 0 {
+			continue
+		}
+		sort.Strings(methods[path])
+		metas = append(metas, apidef.CORSMeta{Path: path, AllowedMethods: methods[path]})
+	}
+
+	return metas
+}
+
 func (a APIDefinitionLoader) getExtendedPathSpecs(apiVersionDef apidef.VersionInfo, apiSpec *APISpec) ([]URLSpec, bool) {
 	// TODO: New compiler here, needs to put data into a different structure
 
@@ -974,6 +1266,14 @@ func (a APIDefinitionLoader) getExtendedPathSpecs(apiVersionDef apidef.VersionIn
 	unTrackedPaths := a.compileUnTrackedEndpointPathspathSpec(apiVersionDef.ExtendedPaths.DoNotTrackEndpoints, RequestNotTracked)
 	validateJSON := a.compileValidateJSONPathspathSpec(apiVersionDef.ExtendedPaths.ValidateJSON, ValidateJSONRequest)
 	internalPaths := a.compileInternalPathspathSpec(apiVersionDef.ExtendedPaths.Internal, Internal)
+	corsMetas := apiVersionDef.ExtendedPaths.CORS
+	if apiSpec.CORS.DeriveAllowedMethods {
+		corsMetas = append(corsMetas[:len(corsMetas):len(corsMetas)], deriveCORSMeta(apiVersionDef.ExtendedPaths)...)
+	}
+	corsPaths := a.compileCORSPathSpec(corsMetas, CORSEndpoint, apiSpec)
+	idempotentPaths := a.compileIdempotencyPathSpec(apiVersionDef.ExtendedPaths.Idempotency, Idempotent)
+	fallbackPaths := a.compileFallbackPathSpec(apiVersionDef.ExtendedPaths.Fallback, FallbackResponse)
+	staticResponses := a.compileStaticResponsePathSpec(apiVersionDef.ExtendedPaths.StaticResponse, StaticResponse)
 
 	combinedPath := []URLSpec{}
 	combinedPath = append(combinedPath, ignoredPaths...)
@@ -997,6 +1297,10 @@ func (a APIDefinitionLoader) getExtendedPathSpecs(apiVersionDef apidef.VersionIn
 	combinedPath = append(combinedPath, unTrackedPaths...)
 	combinedPath = append(combinedPath, validateJSON...)
 	combinedPath = append(combinedPath, internalPaths...)
+	combinedPath = append(combinedPath, corsPaths...)
+	combinedPath = append(combinedPath, idempotentPaths...)
+	combinedPath = append(combinedPath, fallbackPaths...)
+	combinedPath = append(combinedPath, staticResponses...)
 
 	return combinedPath, len(whiteListPaths) > 0
 }
@@ -1055,6 +1359,14 @@ func (a *APISpec) getURLStatus(stat URLStatus) RequestStatus {
 		return StatusInternal
 	case GoPlugin:
 		return StatusGoPlugin
+	case CORSEndpoint:
+		return StatusCORS
+	case Idempotent:
+		return StatusIdempotent
+	case FallbackResponse:
+		return StatusFallbackResponse
+	case StaticResponse:
+		return StatusStaticResponse
 
 	default:
 		log.Error("URL Status was not one of Ignored, Blacklist or WhiteList! Blocking.")
@@ -1160,6 +1472,28 @@ func (a *APISpec) CheckSpecMatchesStatus(r *http.Request, rxPaths []URLSpec, mod
 		matchPath = "/" + matchPath
 	}
 
+	// Only run the regexes of the specs the path may match
+	if idx := a.routeIndex(rxPaths); idx != nil && isASCII(matchPath) {
+		routes := idx.byStatus[mode]
+		if routes == nil {
+			return false, nil
+		}
+		var buf [16]int32
+		for _, id := range routes.candidates(matchPath, buf[:]) {
+			route := routes.routes[id]
+			if !route.literal && !rxPaths[route.pos].Spec.MatchString(matchPath) {
+				continue
+			}
+			if !rxPaths[route.pos].conditionHolds(r, a) {
+				continue
+			}
+			if found, meta := a.urlSpecMeta(r, &rxPaths[route.pos], method); found {
+				return true, meta
+			}
+		}
+		return false, nil
+	}
+
 	// Check if ignored
 	for i := range rxPaths {
 		if mode != rxPaths[i].Status {
@@ -1168,82 +1502,114 @@ func (a *APISpec) CheckSpecMatchesStatus(r *http.Request, rxPaths []URLSpec, mod
 		if !rxPaths[i].Spec.MatchString(matchPath) {
 			continue
 		}
+		if !rxPaths[i].conditionHolds(r, a) {
+			continue
+		}
+		if found, meta := a.urlSpecMeta(r, &rxPaths[i], method); found {
+			return true, meta
+		}
+	}
+	return false, nil
+}
 
-		switch rxPaths[i].Status {
-		case Ignored, BlackList, WhiteList:
-			return true, nil
-		case Cached:
-			if method == rxPaths[i].CacheConfig.Method || (rxPaths[i].CacheConfig.Method == SAFE_METHODS && isSafeMethod(method)) {
-				return true, &rxPaths[i].CacheConfig
-			}
-		case Transformed:
-			if method == rxPaths[i].TransformAction.Method {
-				return true, &rxPaths[i].TransformAction
-			}
-		case TransformedJQ:
-			if method == rxPaths[i].TransformJQAction.Method {
-				return true, &rxPaths[i].TransformJQAction
-			}
-		case HeaderInjected:
-			if method == rxPaths[i].InjectHeaders.Method {
-				return true, &rxPaths[i].InjectHeaders
-			}
-		case HeaderInjectedResponse:
-			if method == rxPaths[i].InjectHeadersResponse.Method {
-				return true, &rxPaths[i].InjectHeadersResponse
-			}
-		case TransformedResponse:
-			if method == rxPaths[i].TransformResponseAction.Method {
-				return true, &rxPaths[i].TransformResponseAction
-			}
-		case TransformedJQResponse:
-			if method == rxPaths[i].TransformJQResponseAction.Method {
-				return true, &rxPaths[i].TransformJQResponseAction
-			}
-		case HardTimeout:
-			if r.Method == rxPaths[i].HardTimeout.Method {
-				return true, &rxPaths[i].HardTimeout.TimeOut
-			}
-		case CircuitBreaker:
-			if method == rxPaths[i].CircuitBreaker.Method {
-				return true, &rxPaths[i].CircuitBreaker
-			}
-		case URLRewrite:
-			if method == rxPaths[i].URLRewrite.Method {
-				return true, rxPaths[i].URLRewrite
-			}
-		case VirtualPath:
-			if method == rxPaths[i].VirtualPathSpec.Method {
-				return true, &rxPaths[i].VirtualPathSpec
-			}
-		case RequestSizeLimit:
-			if method == rxPaths[i].RequestSize.Method {
-				return true, &rxPaths[i].RequestSize
-			}
-		case MethodTransformed:
-			if method == rxPaths[i].MethodTransform.Method {
-				return true, &rxPaths[i].MethodTransform
-			}
-		case RequestTracked:
-			if method == rxPaths[i].TrackEndpoint.Method {
-				return true, &rxPaths[i].TrackEndpoint
-			}
-		case RequestNotTracked:
-			if method == rxPaths[i].DoNotTrackEndpoint.Method {
-				return true, &rxPaths[i].DoNotTrackEndpoint
-			}
-		case ValidateJSONRequest:
-			if method == rxPaths[i].ValidatePathMeta.Method {
-				return true, &rxPaths[i].ValidatePathMeta
-			}
-		case Internal:
-			if method == rxPaths[i].Internal.Method {
-				return true, &rxPaths[i].Internal
-			}
-		case GoPlugin:
-			if method == rxPaths[i].GoPluginMeta.Meta.Method {
-				return true, &rxPaths[i].GoPluginMeta
-			}
+// urlSpecMeta returns the middleware configuration of a URL spec matching the
+// path of r, if it applies to the method of r.
+func (a *APISpec) urlSpecMeta(r *http.Request, spec *URLSpec, method string) (bool, interface{}) {
+	switch spec.Status {
+	case Ignored, BlackList, WhiteList:
+		return true, nil
+	case Cached:
+		if method == spec.CacheConfig.Method || (spec.CacheConfig.Method == SAFE_METHODS && isSafeMethod(method)) {
+			return true, &spec.CacheConfig
+		}
+	case Transformed:
+		if method == spec.TransformAction.Method {
+			return true, &spec.TransformAction
+		}
+	case TransformedJQ:
+		if method == spec.TransformJQAction.Method {
+			return true, &spec.TransformJQAction
+		}
+	case HeaderInjected:
+		if method == spec.InjectHeaders.Method {
+			return true, &spec.InjectHeaders
+		}
+	case HeaderInjectedResponse:
+		if method == spec.InjectHeadersResponse.Method {
+			return true, &spec.InjectHeadersResponse
+		}
+	case TransformedResponse:
+		if method == spec.TransformResponseAction.Method {
+			return true, &spec.TransformResponseAction
+		}
+	case TransformedJQResponse:
+		if method == spec.TransformJQResponseAction.Method {
+			return true, &spec.TransformJQResponseAction
+		}
+	case HardTimeout:
+		if r.Method == spec.HardTimeout.Method {
+			return true, &spec.HardTimeout.TimeOut
+		}
+	case CircuitBreaker:
+		if method == spec.CircuitBreaker.Method {
+			return true, &spec.CircuitBreaker
+		}
+	case URLRewrite:
+		if method == spec.URLRewrite.Method {
+			return true, spec.URLRewrite
+		}
+	case VirtualPath:
+		if method == spec.VirtualPathSpec.Method {
+			return true, &spec.VirtualPathSpec
+		}
+	case RequestSizeLimit:
+		if method == spec.RequestSize.Method {
+			return true, &spec.RequestSize
+		}
+	case MethodTransformed:
+		if method == spec.MethodTransform.Method {
+			return true, &spec.MethodTransform
+		}
+	case RequestTracked:
+		if method == spec.TrackEndpoint.Method {
+			return true, &spec.TrackEndpoint
+		}
+	case RequestNotTracked:
+		if method == spec.DoNotTrackEndpoint.Method {
+			return true, &spec.DoNotTrackEndpoint
+		}
+	case ValidateJSONRequest:
+		if method == spec.ValidatePathMeta.Method {
+			return true, &spec.ValidatePathMeta
+		}
+	case Internal:
+		if method == spec.Internal.Method {
+			return true, &spec.Internal
+		}
+	case GoPlugin:
+		if method == spec.GoPluginMeta.Meta.Method {
+			return true, &spec.GoPluginMeta
+		}
+	case CORSEndpoint:
+		// preflight requests are matched against the method they announce
+		corsMethod := method
+		if reqMethod := r.Header.Get("Access-Control-Request-Method"); method == http.MethodOptions && reqMethod != "" {
+			corsMethod = reqMethod
+		}
+		if spec.CORS.Method == "" || spec.CORS.Method == corsMethod {
+			return true, spec.CORS
+		}
+	case Idempotent:
+		if method == spec.Idempotency.Method {
+			return true, &spec.Idempotency
+		}
+	case FallbackResponse:
+		if method == spec.Fallback.Method {
+			return true, &spec.Fallback
+		}
+	case StaticResponse:
+		if method == spec.StaticResponse.Method {
+			return true, spec.StaticResponse
 		}
 	}
 	return false, nil
@@ -1388,7 +1754,16 @@ func (a *APISpec) Version(r *http.Request) (*apidef.VersionInfo, []URLSpec, bool
 }
 
 func (a *APISpec) StripListenPath(r *http.Request, path string) string {
-	return stripListenPath(a.Proxy.ListenPath, path, mux.Vars(r))
+	return stripListenPath(a.routedListenPath(), path, mux.Vars(r))
+}
+
+// routedListenPath returns the listen path the API is routed with, which is
+// its listen path with its wildcards turned into parameters.
+func (a *APISpec) routedListenPath() string {
+	if a.muxListenPath != "" {
+		return a.muxListenPath
+	}
+	return a.Proxy.ListenPath
 }
 
 type RoundRobin struct {
@@ -1406,6 +1781,24 @@ func (r *RoundRobin) WithLen(len int) int {
 
 var listenPathVarsRE = regexp.MustCompile(`{[^:]+(:[^}]+)?}`)
 
+// wildcardListenPath turns the * segments of a listen path into parameters
+// named wildcard1, wildcard2 and so on, so that /tenants/*/api is matched as
+// /tenants/{wildcard1}/api.
+func wildcardListenPath(listenPath string) string {
+	if !strings.Contains(listenPath, "*") {
+		return listenPath
+	}
+	segments := strings.Split(listenPath, "/")
+	n := 0
+	for i, segment := range segments {
+		if segment == "*" {
+			n++
+			segments[i] = "{wildcard" + strconv.Itoa(n) + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
 func stripListenPath(listenPath, path string, muxVars map[string]string) string {
 	if !strings.Contains(listenPath, "{") {
 		return strings.TrimPrefix(path, listenPath)
@@ -0,0 +1,151 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+)
+
+// definitionVarEnvPrefix is the prefix of the environment variables API
+// definitions may refer to, so that they can't read the other secrets of the
+// gateway environment.
+const definitionVarEnvPrefix = "TYK_SECRET_"
+
+// definitionVarMatch matches the ${name} and ${name:-default} references of
+// API definitions, and the $${ escape.
+var definitionVarMatch = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_.]*)(:-([^}]*))?\}`)
+
+// lookupDefinitionVar returns the value of a reference of API definitions,
+// from the gateway config or else the environment variables with the
+// definitionVarEnvPrefix prefix.
+func lookupDefinitionVar(name string) (string, bool) {
+	if value, ok := config.Global().APIDefinitionVariables[name]; ok {
+		return value, true
+	}
+	if !strings.HasPrefix(name, definitionVarEnvPrefix) {
+		return "", false
+	}
+	return os.LookupEnv(name)
+}
+
+// expandDefinitionString expands the references of value, and returns the
+// names of those without a value or default.
+func expandDefinitionString(value string) (string, []string) {
+	if !strings.Contains(value, "${") {
+		return value, nil
+	}
+	var missing []string
+	expanded := definitionVarMatch.ReplaceAllStringFunc(value, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+		m := definitionVarMatch.FindStringSubmatch(ref)
+		if resolved, ok := lookupDefinitionVar(m[1]); ok {
+			return resolved
+		}
+		if m[2] != "" {
+			return m[3]
+		}
+		missing = append(missing, m[1])
+		return ref
+	})
+	return expanded, missing
+}
+
+// walkDefinitionStrings calls fn on the path and value of each exported
+// string of v, and sets them to the value it returns.
+func walkDefinitionStrings(v reflect.Value, path string, fn func(path, value string) string) {
+	join := func(name string) string {
+		if path == "" {
+			return name
+		}
+		return path + "." + name
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		if v.CanSet() {
+			if value := fn(path, v.String()); value != v.String() {
+				v.SetString(value)
+			}
+		}
+	case reflect.Ptr:
+		if !v.IsNil() {
+			walkDefinitionStrings(v.Elem(), path, fn)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			if field.Anonymous {
+				walkDefinitionStrings(v.Field(i), path, fn)
+				continue
+			}
+			walkDefinitionStrings(v.Field(i), join(name), fn)
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// raw JSON, such as GraphQL data source configs
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			walkDefinitionStrings(v.Index(i), join(fmt.Sprint(i)), fn)
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			// map values aren't addressable, so update a copy
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(v.MapIndex(key))
+			walkDefinitionStrings(value, join(fmt.Sprint(key.Interface())), fn)
+			v.SetMapIndex(key, value)
+		}
+	}
+}
+
+// expandedAPIDefinition returns a copy of def with its references expanded,
+// leaving def as is to be persisted.
+func expandedAPIDefinition(def *apidef.APIDefinition) (*apidef.APIDefinition, error) {
+	raw, err := json.Marshal(def)
+	if err != nil {
+		return def, err
+	}
+	expanded := &apidef.APIDefinition{}
+	if err := json.Unmarshal(raw, expanded); err != nil {
+		return def, err
+	}
+	return expanded, expandAPIDefinition(expanded)
+}
+
+// expandAPIDefinition expands the references in the string fields of an API
+// definition. It fails with the fields referring to variables without a
+// value.
+func expandAPIDefinition(def *apidef.APIDefinition) error {
+	var missing []string
+	walkDefinitionStrings(reflect.ValueOf(def), "", func(path, value string) string {
+		expanded, names := expandDefinitionString(value)
+		for _, name := range names {
+			missing = append(missing, fmt.Sprintf("%s: ${%s}", path, name))
+		}
+		return expanded
+	})
+	if len(missing) > 0 {
+		return fmt.Errorf("undefined variables in API definition: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
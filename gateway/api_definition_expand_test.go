@@ -0,0 +1,62 @@
+package gateway
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+)
+
+func TestExpandAPIDefinition(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.APIDefinitionVariables = map[string]string{"region": "eu-west-1"}
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	os.Setenv("TYK_SECRET_UPSTREAM_HOST", "upstream.internal")
+	defer os.Unsetenv("TYK_SECRET_UPSTREAM_HOST")
+
+	def := &apidef.APIDefinition{}
+	def.Proxy.ListenPath = "/${region}/orders/"
+	def.Proxy.TargetURL = "https://${TYK_SECRET_UPSTREAM_HOST}:${TYK_SECRET_UPSTREAM_PORT:-8443}"
+	def.VersionData.Versions = map[string]apidef.VersionInfo{
+		"v1": {GlobalHeaders: map[string]string{"X-Region": "${region}", "X-Literal": "$${region}"}},
+	}
+
+	if err := expandAPIDefinition(def); err != nil {
+		t.Fatal(err)
+	}
+	if def.Proxy.ListenPath != "/eu-west-1/orders/" {
+		t.Errorf("Unexpected listen path %q", def.Proxy.ListenPath)
+	}
+	if def.Proxy.TargetURL != "https://upstream.internal:8443" {
+		t.Errorf("Unexpected target URL %q", def.Proxy.TargetURL)
+	}
+	headers := def.VersionData.Versions["v1"].GlobalHeaders
+	if headers["X-Region"] != "eu-west-1" || headers["X-Literal"] != "${region}" {
+		t.Errorf("Unexpected headers %v", headers)
+	}
+
+	os.Setenv("TYK_TEST_NOT_SECRET", "leaked")
+	defer os.Unsetenv("TYK_TEST_NOT_SECRET")
+
+	def = &apidef.APIDefinition{}
+	def.Proxy.TargetURL = "http://${TYK_TEST_NOT_SECRET}"
+	def.Proxy.ListenPath = "/${region}/"
+	expanded, err := expandedAPIDefinition(def)
+	if err == nil || !strings.Contains(err.Error(), "proxy.target_url: ${TYK_TEST_NOT_SECRET}") {
+		t.Errorf("Expected variables without the prefix not to be read from the environment, got %v", err)
+	}
+	if expanded.Proxy.ListenPath != "/eu-west-1/" || def.Proxy.ListenPath != "/${region}/" {
+		t.Errorf("Expected a copy to be expanded, got %q and %q", expanded.Proxy.ListenPath, def.Proxy.ListenPath)
+	}
+
+	def = &apidef.APIDefinition{}
+	def.Proxy.TargetURL = "http://${TYK_TEST_MISSING}"
+	err = expandAPIDefinition(def)
+	if err == nil || !strings.Contains(err.Error(), "proxy.target_url: ${TYK_TEST_MISSING}") {
+		t.Errorf("Expected the missing variable to be reported, got %v", err)
+	}
+}
@@ -939,3 +939,16 @@ func TestAPIDefinitionLoader_Template(t *testing.T) {
 		executeAndAssert(t, temp)
 	})
 }
+
+func TestWildcardListenPath(t *testing.T) {
+	tests := map[string]string{
+		"/api/":                      "/api/",
+		"/tenants/*/api":             "/tenants/{wildcard1}/api",
+		"/*/orders/*/":               "/{wildcard1}/orders/{wildcard2}/",
+		"/ids/{id:[0-9]*}/":          "/ids/{id:[0-9]*}/",
+		"/tenants/{tenantID}/*/api/": "/tenants/{tenantID}/{wildcard1}/api/",
+	}
+	for listenPath, expected := range tests {
+		assert.Equal(t, expected, wildcardListenPath(listenPath))
+	}
+}
@@ -0,0 +1,120 @@
+package gateway
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// States of the APIs of the last load.
+const (
+	apiLoadStateLoaded  = "loaded"
+	apiLoadStateSkipped = "skipped"
+	apiLoadStateError   = "error"
+)
+
+// APILoadStatus is the outcome of loading an API on the last reload.
+// LastLoaded is when it was last loaded successfully, which may be before
+// the last reload if it failed. Warnings are the problems met while loading
+// it, such as entries of its definition left out as they were invalid.
+// swagger:model
+type APILoadStatus struct {
+	APIID      string     `json:"api_id"`
+	Name       string     `json:"name"`
+	State      string     `json:"state"`
+	Reason     string     `json:"reason,omitempty"`
+	Warnings   []string   `json:"warnings,omitempty"`
+	LastLoaded *time.Time `json:"last_loaded,omitempty"`
+}
+
+var (
+	apiLoadStatusesMu sync.RWMutex
+	apiLoadStatuses   = map[string]*APILoadStatus{}
+)
+
+func newAPILoadStatus(spec *APISpec) *APILoadStatus {
+	now := time.Now()
+	return &APILoadStatus{
+		APIID:      spec.APIID,
+		Name:       spec.Name,
+		State:      apiLoadStateLoaded,
+		Warnings:   append([]string(nil), spec.loadWarnings...),
+		LastLoaded: &now,
+	}
+}
+
+func (s *APILoadStatus) fail(reason string) {
+	s.State = apiLoadStateError
+	s.Reason = reason
+	s.LastLoaded = nil
+}
+
+// fromChain sets the status from the chain the API was loaded into. Skipped
+// chains without a handler failed to load, the others are internal APIs.
+func (s *APILoadStatus) fromChain(chain *ChainObject) {
+	s.Warnings = append(s.Warnings, chain.Warnings...)
+	if !chain.Skip {
+		return
+	}
+	if chain.ThisHandler == nil {
+		s.fail(chain.SkipReason)
+		return
+	}
+	s.State = apiLoadStateSkipped
+	s.Reason = chain.SkipReason
+}
+
+// swapAPILoadStatuses replaces the statuses of the previous load, keeping
+// when APIs that failed to load were last loaded.
+func swapAPILoadStatuses(statuses map[string]*APILoadStatus) {
+	apiLoadStatusesMu.Lock()
+	defer apiLoadStatusesMu.Unlock()
+	for id, status := range statuses {
+		if prev, ok := apiLoadStatuses[id]; ok && status.LastLoaded == nil {
+			status.LastLoaded = prev.LastLoaded
+		}
+	}
+	apiLoadStatuses = statuses
+}
+
+// getAPILoadStatuses returns the statuses of the last load by API ID, of
+// those in state if set.
+func getAPILoadStatuses(state string) []APILoadStatus {
+	apiLoadStatusesMu.RLock()
+	defer apiLoadStatusesMu.RUnlock()
+
+	list := make([]APILoadStatus, 0, len(apiLoadStatuses))
+	for _, status := range apiLoadStatuses {
+		if state == "" || status.State == state {
+			list = append(list, *status)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].APIID < list[j].APIID
+	})
+	return list
+}
+
+// Get the load status of APIs
+// Lists the APIs of the last reload with whether they were loaded, skipped
+// as internal APIs, or failed to load and why, so that partially applied
+// configurations can be detected. The state parameter filters them.
+//
+//---
+// parameters:
+// - name: state
+//   in: query
+//   required: false
+//   type: string
+//   enum: [loaded, skipped, error]
+// responses:
+//   200:
+//     description: Load status of APIs
+//     schema:
+//       type: array
+//       items:
+//         "$ref": "#/definitions/APILoadStatus"
+func apiLoadStatusHandler(w http.ResponseWriter, r *http.Request) {
+	doJSONWrite(w, http.StatusOK, getAPILoadStatuses(r.URL.Query().Get("state")))
+}
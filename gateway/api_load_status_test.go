@@ -0,0 +1,78 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestAPILoadStatus(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "broken"
+		spec.Proxy.ListenPath = ""
+	}, func(spec *APISpec) {
+		spec.APIID = "internal"
+		spec.Proxy.ListenPath = "/internal/"
+		spec.Internal = true
+	}, func(spec *APISpec) {
+		spec.APIID = "working"
+		spec.Proxy.ListenPath = "/working/"
+	})
+
+	resp, _ := ts.Run(t, test.TestCase{Path: "/tyk/apis/status", AdminAuth: true, Code: http.StatusOK})
+	var statuses []APILoadStatus
+	if err := json.NewDecoder(resp.Body).Decode(&statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 3 {
+		t.Fatalf("Expected the status of 3 APIs, got %+v", statuses)
+	}
+
+	broken, internal, working := statuses[0], statuses[1], statuses[2]
+	if broken.State != apiLoadStateError || broken.Reason != "Listen path is empty" || broken.LastLoaded != nil {
+		t.Errorf("Expected the broken API to fail to load, got %+v", broken)
+	}
+	if internal.State != apiLoadStateSkipped || internal.Reason == "" {
+		t.Errorf("Expected the internal API to be skipped, got %+v", internal)
+	}
+	if working.State != apiLoadStateLoaded || working.LastLoaded == nil {
+		t.Errorf("Expected the working API to be loaded, got %+v", working)
+	}
+
+	_, _ = ts.Run(t, test.TestCase{Path: "/tyk/apis/status?state=error", AdminAuth: true, Code: http.StatusOK,
+		BodyMatch: `"api_id":"broken"`, BodyNotMatch: `"api_id":"working"`})
+}
+
+func TestAPILoadStatusWarnings(t *testing.T) {
+	def := &apidef.APIDefinition{APIID: "warnings"}
+	def.VersionData.Versions = map[string]apidef.VersionInfo{"Default": {
+		Name:             "Default",
+		UseExtendedPaths: true,
+		ExtendedPaths: apidef.ExtendedPathsSet{
+			Ignored:        []apidef.EndPointMeta{{Path: "/valid"}, {Path: "/invalid("}},
+			StaticResponse: []apidef.StaticResponseMeta{{Path: "/static", Method: "GET", Body: "{{"}},
+		},
+	}}
+	spec := APIDefinitionLoader{}.MakeSpec(def, nil)
+	if found, _ := spec.CheckSpecMatchesStatus(httptest.NewRequest("GET", "/invalid(", nil), spec.RxPaths["Default"], Ignored); found {
+		t.Error("Expected an invalid path to match no requests")
+	}
+
+	status := newAPILoadStatus(spec)
+	status.fromChain(&ChainObject{Warnings: []string{"from chain"}})
+
+	if len(status.Warnings) != 3 || status.Warnings[2] != "from chain" {
+		t.Fatal("Expected the invalid path, the static response and the chain warning, got ", status.Warnings)
+	}
+	if !strings.Contains(status.Warnings[0], `"/invalid("`) || !strings.Contains(status.Warnings[1], "static response of GET /static") {
+		t.Error("Unexpected warnings: ", status.Warnings)
+	}
+}
@@ -2,6 +2,7 @@ package gateway
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -35,6 +36,10 @@ type ChainObject struct {
 	RateLimitChain http.Handler
 	Open           bool
 	Skip           bool
+	// SkipReason is why the API isn't served, Warnings the problems met
+	// while loading it.
+	SkipReason string
+	Warnings   []string
 }
 
 func prepareStorage() generalStores {
@@ -48,17 +53,16 @@ func prepareStorage() generalStores {
 	return gs
 }
 
-func skipSpecBecauseInvalid(spec *APISpec, logger *logrus.Entry) bool {
+// specLoadError returns why a spec can't be loaded, nil if it can.
+func specLoadError(spec *APISpec) error {
 
 	switch spec.Protocol {
 	case "", "http", "https":
 		if spec.Proxy.ListenPath == "" {
-			logger.Error("Listen path is empty")
-			return true
+			return errors.New("Listen path is empty")
 		}
 		if strings.Contains(spec.Proxy.ListenPath, " ") {
-			logger.Error("Listen path contains spaces, is invalid")
-			return true
+			return errors.New("Listen path contains spaces, is invalid")
 		}
 	}
 	if val, err := kvStore(spec.Proxy.TargetURL); err == nil {
@@ -67,11 +71,18 @@ func skipSpecBecauseInvalid(spec *APISpec, logger *logrus.Entry) bool {
 
 	_, err := url.Parse(spec.Proxy.TargetURL)
 	if err != nil {
-		logger.Error("couldn't parse target URL: ", err)
-		return true
+		return fmt.Errorf("couldn't parse target URL: %v", err)
 	}
 
-	return false
+	// data sources can't be reached without their upstream auth
+	if spec.GraphQL.Enabled && spec.GraphQL.ExecutionMode == apidef.GraphQLExecutionModeExecutionEngine &&
+		spec.GraphQL.Version == apidef.GraphQLConfigVersion2 {
+		if _, err := graphQLDataSourceClients(spec, spec.GraphQL.Engine.DataSources); err != nil {
+			return fmt.Errorf("couldn't set up upstream auth of GraphQL data sources: %v", err)
+		}
+	}
+
+	return nil
 }
 
 func generateDomainPath(hostname, listenPath string) string {
@@ -109,6 +120,7 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 
 	var chainDef ChainObject
 
+	handleSecurityHeaders(subrouter, spec)
 	handleCORS(subrouter, spec)
 
 	logger = logger.WithFields(logrus.Fields{
@@ -143,15 +155,18 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 		spec.TagHeaders = lowerCaseHeaders
 	}
 
-	if skipSpecBecauseInvalid(spec, logger) {
+	if err := specLoadError(spec); err != nil {
+		logger.Error(err)
 		logger.Warning("Spec not valid, skipped!")
 		chainDef.Skip = true
+		chainDef.SkipReason = err.Error()
 		return &chainDef
 	}
 
 	// Expose API only to looping
 	if spec.Internal {
 		chainDef.Skip = true
+		chainDef.SkipReason = "internal API, only reachable by looping"
 	}
 
 	pathModified := false
@@ -177,7 +192,9 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 		}
 	}
 	if pathModified {
+		spec.muxListenPath = wildcardListenPath(spec.Proxy.ListenPath)
 		logger.Error("Listen path collision, changed to ", spec.Proxy.ListenPath)
+		chainDef.Warnings = append(chainDef.Warnings, "listen path collision, changed to "+spec.Proxy.ListenPath)
 	}
 
 	// Set up LB targets:
@@ -225,6 +242,7 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 	if spec.CustomMiddlewareBundle != "" {
 		if err := loadBundle(spec); err != nil {
 			logger.WithError(err).Error("Couldn't load bundle")
+			chainDef.Warnings = append(chainDef.Warnings, "couldn't load bundle: "+err.Error())
 		}
 		prefix = getBundleDestPath(spec)
 	}
@@ -335,6 +353,8 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 	mwAppendEnabled(&chainArray, &CertificateCheckMW{BaseMiddleware: baseMid})
 	mwAppendEnabled(&chainArray, &OrganizationMonitor{BaseMiddleware: baseMid})
 	mwAppendEnabled(&chainArray, &RequestSizeLimitMiddleware{baseMid})
+	mwAppendEnabled(&chainArray, &JWEDecryptMiddleware{BaseMiddleware: baseMid})
+	mwAppendEnabled(&chainArray, &JWSValidationMiddleware{BaseMiddleware: baseMid})
 	mwAppendEnabled(&chainArray, &MiddlewareContextVars{BaseMiddleware: baseMid})
 	mwAppendEnabled(&chainArray, &TrackEndpointMiddleware{baseMid})
 
@@ -421,7 +441,14 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 		mwAppendEnabled(&chainArray, &KeyExpired{baseMid})
 		mwAppendEnabled(&chainArray, &AccessRightsCheck{baseMid})
 		mwAppendEnabled(&chainArray, &GranularAccessMiddleware{baseMid})
+		mwAppendEnabled(&chainArray, &ExternalAuthzMiddleware{BaseMiddleware: baseMid})
+		// shed requests don't count against the rate limits and quotas
+		mwAppendEnabled(&chainArray, &LoadSheddingMiddleware{BaseMiddleware: baseMid})
 		mwAppendEnabled(&chainArray, &RateLimitAndQuotaCheck{baseMid})
+	} else {
+		mwAppendEnabled(&chainArray, &ExternalAuthzMiddleware{BaseMiddleware: baseMid})
+		mwAppendEnabled(&chainArray, &LoadSheddingMiddleware{BaseMiddleware: baseMid})
+		mwAppendEnabled(&chainArray, &AnonymousRateLimit{BaseMiddleware: baseMid})
 	}
 
 	mwAppendEnabled(&chainArray, &RateLimitForAPI{BaseMiddleware: baseMid})
@@ -438,6 +465,7 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 	mwAppendEnabled(&chainArray, &URLRewriteMiddleware{BaseMiddleware: baseMid})
 	mwAppendEnabled(&chainArray, &TransformMethod{BaseMiddleware: baseMid})
 	mwAppendEnabled(&chainArray, &GoPluginMiddleware{BaseMiddleware: baseMid})
+	mwAppendEnabled(&chainArray, &StaticResponseMiddleware{BaseMiddleware: baseMid})
 	mwAppendEnabled(&chainArray, &VirtualEndpoint{BaseMiddleware: baseMid})
 	mwAppendEnabled(&chainArray, &RequestSigning{BaseMiddleware: baseMid})
 
@@ -459,11 +487,25 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 			chainArray = append(chainArray, createDynamicMiddleware(obj.Name, false, obj.RequireSession, baseMid))
 		}
 	}
+	mwAppendEnabled(&chainArray, &IdempotencyMiddleware{BaseMiddleware: baseMid})
+
 	//Do not add middlewares after cache middleware.
 	//It will not get executed
 	mwAppendEnabled(&chainArray, &RedisCacheMiddleware{BaseMiddleware: baseMid, CacheStore: &cacheStore})
 
 	chain = alice.New(chainArray...).Then(&DummyProxyHandler{SH: SuccessHandler{baseMid}})
+	if spec.SlowRequests.Enabled {
+		chain = slowRequestHandler(spec, chain)
+	}
+	if !spec.tracing {
+		chain = trafficStatsHandler(spec, chain)
+	}
+	if config.Global().LoadShedding.Enabled {
+		chain = loadHandler(chain)
+	}
+	if spec.AccessLog.Enabled {
+		chain = accessLogHandler(spec, chain)
+	}
 
 	if !spec.UseKeylessAccess {
 		var simpleArray []alice.Constructor
@@ -485,7 +527,7 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 	logger.Debug("Setting Listen Path: ", spec.Proxy.ListenPath)
 
 	if trace.IsEnabled() {
-		chainDef.ThisHandler = trace.Handle(spec.Name, chain)
+		chainDef.ThisHandler = trace.Handle(spec.Name, chain, tracePropagationFormats(spec.TracePropagation.Inbound)...)
 	} else {
 		chainDef.ThisHandler = chain
 	}
@@ -503,21 +545,65 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 // Check for recursion
 const defaultLoopLevelLimit = 5
 
-func isLoop(r *http.Request) (bool, error) {
-	if r.URL.Scheme != "tyk" {
-		return false, nil
+// loopError is returned when a request can't be looped to an internal API,
+// its message is returned to the client.
+type loopError struct {
+	msg string
+}
+
+func (e *loopError) Error() string {
+	return e.msg
+}
+
+func isLoop(r *http.Request) bool {
+	return r.URL.Scheme == "tyk"
+}
+
+// loopTarget returns the handler of the API a request is looped to from
+// another API, and records the hop. The limit of hops in a request is set by
+// the loop_limit query parameter or the API the first loop started from.
+func loopTarget(r *http.Request, from *APISpec, apiNameOrID string, loopLevelLimit int) (http.Handler, error) {
+	if loopLevelLimit == 0 {
+		loopLevelLimit = from.LoopLimit
 	}
+	ctxSetLoopLimit(r, loopLevelLimit)
 
 	limit := ctxLoopLevelLimit(r)
 	if limit == 0 {
 		limit = defaultLoopLevelLimit
 	}
 
-	if ctxLoopLevel(r) > limit {
-		return true, fmt.Errorf("Loop level too deep. Found more than %d loops in single request", limit)
+	trace := ctxLoopTrace(r)
+	if len(trace) > limit {
+		return nil, &loopError{fmt.Sprintf("Loop level too deep. Found more than %d loops in single request: %s",
+			limit, formatLoopTrace(trace))}
+	}
+
+	targetAPI := from
+	if apiNameOrID != "self" {
+		targetAPI = fuzzyFindAPI(apiNameOrID)
 	}
 
-	return true, nil
+	var handler interface{}
+	found := false
+	if targetAPI != nil {
+		handler, found = apisHandlesByID.Load(targetAPI.APIID)
+	}
+	if !found {
+		return nil, &loopError{"Loop target API not found: " + apiNameOrID}
+	}
+
+	ctxAddLoopHop(r, LoopHop{APIID: targetAPI.APIID, APIName: targetAPI.Name, Path: r.URL.Path})
+
+	return handler.(http.Handler), nil
+}
+
+func formatLoopTrace(trace []LoopHop) string {
+	hops := make([]string, len(trace))
+	for i, hop := range trace {
+		hops[i] = "tyk://" + hop.APIID + hop.Path
+	}
+	return strings.Join(hops, ", ")
 }
 
 type DummyProxyHandler struct {
@@ -533,39 +619,25 @@ func (d *DummyProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		r.Method = newMethod
 		ctxSetTransformRequestMethod(r, "")
 	}
-	if found, err := isLoop(r); found {
-		if err != nil {
-			handler := ErrorHandler{*d.SH.Base()}
-			handler.HandleError(w, r, err.Error(), http.StatusInternalServerError, true)
-			return
-		}
-
+	if isLoop(r) {
 		r.URL.Scheme = "http"
 		if methodOverride := r.URL.Query().Get("method"); methodOverride != "" {
 			r.Method = methodOverride
 		}
 
-		var handler http.Handler
-		if r.URL.Hostname() == "self" {
-			if h, found := apisHandlesByID.Load(d.SH.Spec.APIID); found {
-				handler = h.(http.Handler)
-			}
-		} else {
-			ctxSetVersionInfo(r, nil)
-
-			if targetAPI := fuzzyFindAPI(r.URL.Hostname()); targetAPI != nil {
-				if h, found := apisHandlesByID.Load(targetAPI.APIID); found {
-					handler = h.(http.Handler)
-				}
-			} else {
-				handler := ErrorHandler{*d.SH.Base()}
-				handler.HandleError(w, r, "Can't detect loop target", http.StatusInternalServerError, true)
-				return
-			}
-		}
-
 		// No need to handle errors, in all error cases limit will be set to 0
 		loopLevelLimit, _ := strconv.Atoi(r.URL.Query().Get("loop_limit"))
+		handler, err := loopTarget(r, d.SH.Spec, r.URL.Hostname(), loopLevelLimit)
+		if err != nil {
+			errorHandler := ErrorHandler{*d.SH.Base()}
+			errorHandler.HandleError(w, r, err.Error(), http.StatusInternalServerError, true)
+			return
+		}
+
+		if r.URL.Hostname() != "self" {
+			ctxSetVersionInfo(r, nil)
+		}
+		ctxSetLoopLevel(r, ctxLoopLevel(r)+1)
 		ctxSetCheckLoopLimits(r, r.URL.Query().Get("check_limits") == "true")
 
 		if origURL := ctxGetOrigRequestURL(r); origURL != nil {
@@ -574,20 +646,19 @@ func (d *DummyProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			ctxSetOrigRequestURL(r, nil)
 		}
 
-		ctxIncLoopLevel(r, loopLevelLimit)
 		handler.ServeHTTP(w, r)
 		return
 	}
 
 	if d.SH.Spec.target.Scheme == "tyk" {
-		handler, found := findInternalHttpHandlerByNameOrID(d.SH.Spec.target.Host)
-		if !found {
-			handler := ErrorHandler{*d.SH.Base()}
-			handler.HandleError(w, r, "Couldn't detect target", http.StatusInternalServerError, true)
+		sanitizeProxyPaths(d.SH.Spec, r)
+		handler, err := loopTarget(r, d.SH.Spec, d.SH.Spec.target.Host, 0)
+		if err != nil {
+			errorHandler := ErrorHandler{*d.SH.Base()}
+			errorHandler.HandleError(w, r, err.Error(), http.StatusInternalServerError, true)
 			return
 		}
 
-		sanitizeProxyPaths(d.SH.Spec, r)
 		handler.ServeHTTP(w, r)
 		return
 	}
@@ -595,20 +666,6 @@ func (d *DummyProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	d.SH.ServeHTTP(w, r)
 }
 
-func findInternalHttpHandlerByNameOrID(apiNameOrID string) (handler http.Handler, ok bool) {
-	targetAPI := fuzzyFindAPI(apiNameOrID)
-	if targetAPI == nil {
-		return nil, false
-	}
-
-	h, found := apisHandlesByID.Load(targetAPI.APIID)
-	if !found {
-		return nil, false
-	}
-
-	return h.(http.Handler), true
-}
-
 func sanitizeProxyPaths(apiSpec *APISpec, request *http.Request) {
 	if !apiSpec.Proxy.StripListenPath {
 		return
@@ -636,6 +693,19 @@ func trimCategories(name string) string {
 	return name
 }
 
+// apiCategories returns the categories of an API, which are the words of its
+// name starting with "#".
+func apiCategories(name string) []string {
+	var categories []string
+	for _, word := range strings.Fields(name) {
+		if len(word) > 1 && word[0] == '#' {
+			categories = append(categories, word[1:])
+		}
+	}
+
+	return categories
+}
+
 func fuzzyFindAPI(search string) *APISpec {
 	if search == "" {
 		return nil
@@ -655,7 +725,7 @@ func fuzzyFindAPI(search string) *APISpec {
 	return nil
 }
 
-func loadHTTPService(spec *APISpec, apisByListen map[string]int, gs *generalStores, muxer *proxyMux) http.Handler {
+func loadHTTPService(spec *APISpec, apisByListen map[string]int, gs *generalStores, muxer *proxyMux) *ChainObject {
 	port := config.Global().ListenPort
 	if spec.ListenPort != 0 {
 		port = spec.ListenPort
@@ -663,6 +733,7 @@ func loadHTTPService(spec *APISpec, apisByListen map[string]int, gs *generalStor
 	router := muxer.router(port, spec.Protocol)
 	if router == nil {
 		router = mux.NewRouter()
+		router.NotFoundHandler = http.HandlerFunc(muxer.handle404)
 		muxer.setRouter(port, spec.Protocol, router)
 	}
 
@@ -676,11 +747,11 @@ func loadHTTPService(spec *APISpec, apisByListen map[string]int, gs *generalStor
 		router = router.Host(hostname).Subrouter()
 	}
 
-	subrouter := router.PathPrefix(spec.Proxy.ListenPath).Subrouter()
+	subrouter := router.PathPrefix(spec.routedListenPath()).Subrouter()
 
-	chainObj := processSpec(spec, apisByListen, gs, subrouter, logrus.NewEntry(log))
+	chainObj := processSpec(spec, apisByListen, gs, subrouter, logrus.NewEntry(apiLogger(spec.APIID)))
 	if chainObj.Skip {
-		return chainObj.ThisHandler
+		return chainObj
 	}
 
 	if !chainObj.Open {
@@ -688,7 +759,7 @@ func loadHTTPService(spec *APISpec, apisByListen map[string]int, gs *generalStor
 	}
 
 	subrouter.NewRoute().Handler(chainObj.ThisHandler)
-	return chainObj.ThisHandler
+	return chainObj
 }
 
 func loadTCPService(spec *APISpec, gs *generalStores, muxer *proxyMux) {
@@ -718,7 +789,16 @@ func loadTCPService(spec *APISpec, gs *generalStores, muxer *proxyMux) {
 	// Health checkers are initialised per spec so that each API handler has it's own connection and redis storage pool
 	spec.Init(authStore, sessionStore, gs.healthStore, orgStore)
 
-	muxer.addTCPService(spec, nil)
+	// Set up LB targets:
+	if spec.Proxy.EnableLoadBalancing {
+		spec.Proxy.StructuredTargetList = apidef.NewHostListFromList(spec.Proxy.Targets)
+	}
+
+	if spec.Protocol == "udp" {
+		muxer.addUDPService(spec, tcpServiceModifier(spec))
+		return
+	}
+	muxer.addTCPService(spec, tcpServiceModifier(spec))
 }
 
 type generalStores struct {
@@ -784,7 +864,7 @@ func loadGraphQLPlayground(spec *APISpec, subrouter *mux.Router) {
 
 		err := playgroundTemplate.ExecuteTemplate(rw, playgroundHTMLTemplateName, struct {
 			Url, Schema, PathPrefix string
-		}{endpoint, strconv.Quote(spec.GraphQL.Schema), path.Join(endpoint, playgroundPath)})
+		}{endpoint, strconv.Quote(spec.graphQLPlaygroundSchema()), path.Join(endpoint, playgroundPath)})
 
 		if err != nil {
 			rw.WriteHeader(http.StatusInternalServerError)
@@ -818,21 +898,25 @@ func loadApps(specs []*APISpec) {
 	muxer := &proxyMux{}
 	router := mux.NewRouter()
 	router.NotFoundHandler = http.HandlerFunc(muxer.handle404)
-	loadControlAPIEndpoints(router)
+	loadNetworkControlAPIEndpoints(router)
 
 	muxer.setRouter(port, "", router)
 
 	gs := prepareStorage()
 	shouldTrace := trace.IsEnabled()
+	loadStatuses := make(map[string]*APILoadStatus, len(specs))
 	for _, spec := range specs {
 		func() {
 			if strings.Contains(spec.Proxy.TargetURL, "h2c://") {
 				spec.Protocol = "h2c"
 			}
+			status := newAPILoadStatus(spec)
+			loadStatuses[spec.APIID] = status
 			defer func() {
 				// recover from panic if one occured. Set err to nil otherwise.
 				if err := recover(); err != nil {
 					log.Errorf("Panic while loading an API: %v, panic: %v, stacktrace: %v", spec.APIDefinition, err, string(debug.Stack()))
+					status.fail(fmt.Sprint("panic while loading: ", err))
 				}
 			}()
 
@@ -843,6 +927,7 @@ func loadApps(specs []*APISpec) {
 			if converted, err := kvStore(spec.Proxy.ListenPath); err == nil {
 				spec.Proxy.ListenPath = converted
 			}
+			spec.muxListenPath = wildcardListenPath(spec.Proxy.ListenPath)
 
 			tmpSpecRegister[spec.APIID] = spec
 
@@ -857,8 +942,10 @@ func loadApps(specs []*APISpec) {
 						mainLog.Infof("Intialized tracer  api_name=%q", spec.Name)
 					}
 				}
-				tmpSpecHandles.Store(spec.APIID, loadHTTPService(spec, apisByListen, &gs, muxer))
-			case "tcp", "tls":
+				chainObj := loadHTTPService(spec, apisByListen, &gs, muxer)
+				tmpSpecHandles.Store(spec.APIID, chainObj.ThisHandler)
+				status.fromChain(chainObj)
+			case "tcp", "tls", "udp":
 				loadTCPService(spec, &gs, muxer)
 			}
 		}()
@@ -869,6 +956,12 @@ func loadApps(specs []*APISpec) {
 	// Swap in the new register
 	apisMu.Lock()
 
+	for _, spec := range invalidAPISpecs {
+		status := newAPILoadStatus(spec)
+		status.fail(spec.Validate().Error())
+		loadStatuses[spec.APIID] = status
+	}
+
 	// release current specs resources before overwriting map
 	for _, curSpec := range apisByID {
 		curSpec.Release()
@@ -879,6 +972,12 @@ func loadApps(specs []*APISpec) {
 
 	apisMu.Unlock()
 
+	swapAPILoadStatuses(loadStatuses)
+	pruneAPILoggers(tmpSpecRegister)
+	pruneAPIDNSCaches(tmpSpecRegister)
+
+	queueOASPublish(tmpSpecRegister)
+
 	mainLog.Debug("Checker host list")
 
 	// Kick off our host checkers
@@ -3,13 +3,16 @@ package gateway
 import (
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"path"
 	"sync/atomic"
 	"testing"
 
 	"github.com/TykTechnologies/tyk/user"
 
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
 
 	"github.com/stretchr/testify/assert"
 
@@ -264,6 +267,122 @@ func TestCORS(t *testing.T) {
 	})
 }
 
+func TestSecurityHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headers.XFrameOptions, "SAMEORIGIN")
+		w.Header().Set(headers.ReferrerPolicy, "unsafe-url")
+	}))
+	defer upstream.Close()
+
+	globalConf := config.Global()
+	globalConf.SecurityHeaders = apidef.SecurityHeadersConfig{
+		HSTS:         apidef.HSTSConfig{MaxAge: 63072000, IncludeSubdomains: true},
+		FrameOptions: "DENY",
+	}
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	g := StartTest()
+	defer g.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/default/"
+		spec.Proxy.TargetURL = upstream.URL
+	}, func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/secure/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.SecurityHeaders = apidef.SecurityHeadersConfig{
+			Enabled:               true,
+			ContentTypeOptions:    true,
+			ContentSecurityPolicy: "default-src 'self'",
+			ReferrerPolicy:        "no-referrer",
+		}
+	}, func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/keyless/"
+		spec.UseKeylessAccess = false
+		spec.SecurityHeaders.Enabled = true
+	})
+
+	secured := map[string]string{
+		headers.StrictTransportSecurity: "max-age=63072000; includeSubDomains",
+		headers.XContentTypeOptions:     "nosniff",
+		headers.ContentSecurityPolicy:   "default-src 'self'",
+		headers.XFrameOptions:           "DENY",
+		headers.ReferrerPolicy:          "no-referrer",
+	}
+
+	_, _ = g.Run(t, []test.TestCase{
+		// the gateway options only apply to APIs enabling security headers
+		{Path: "/default/", Code: http.StatusOK, HeadersMatch: map[string]string{headers.XFrameOptions: "SAMEORIGIN"}, HeadersNotMatch: map[string]string{headers.StrictTransportSecurity: "max-age=63072000; includeSubDomains"}},
+		// and the error responses of the gateway
+		{Path: "/keyless/", Code: http.StatusUnauthorized, HeadersMatch: map[string]string{headers.XFrameOptions: "DENY"}},
+	}...)
+
+	resp, _ := g.Run(t, test.TestCase{Path: "/secure/", Code: http.StatusOK, HeadersMatch: secured})
+	for name := range secured {
+		if values := resp.Header.Values(name); len(values) != 1 {
+			t.Errorf("Expected the upstream %s header to be replaced, got %v", name, values)
+		}
+	}
+}
+
+func TestCORSEndpointOverrides(t *testing.T) {
+	g := StartTest()
+	defer g.Close()
+
+	const (
+		apiOrigin = "http://api.example.com"
+		appOrigin = "http://app.example.com"
+	)
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/cors-api/"
+		spec.CORS.Enable = true
+		spec.CORS.AllowedOrigins = []string{apiOrigin}
+		spec.CORS.AllowedMethods = []string{http.MethodGet}
+		spec.CORS.DeriveAllowedMethods = true
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.UseExtendedPaths = true
+			v.ExtendedPaths.CORS = []apidef.CORSMeta{
+				{Path: "/public", AllowedOrigins: []string{"*"}},
+				{Path: "/write", Method: http.MethodPost, AllowedOrigins: []string{appOrigin}, AllowedMethods: []string{http.MethodPost}},
+			}
+			v.ExtendedPaths.WhiteList = []apidef.EndPointMeta{{
+				Path: "/items",
+				MethodActions: map[string]apidef.EndpointMethodMeta{
+					http.MethodGet: {Action: apidef.NoAction},
+					http.MethodPut: {Action: apidef.NoAction},
+				},
+			}}
+		})
+	})
+
+	preflight := func(origin, method string) map[string]string {
+		return map[string]string{"Origin": origin, "Access-Control-Request-Method": method}
+	}
+
+	_, _ = g.Run(t, []test.TestCase{
+		// API level options
+		{Path: "/cors-api/items", Headers: map[string]string{"Origin": apiOrigin},
+			HeadersMatch: map[string]string{"Access-Control-Allow-Origin": apiOrigin}, Code: http.StatusOK},
+		{Path: "/cors-api/items", Headers: map[string]string{"Origin": appOrigin},
+			HeadersNotMatch: map[string]string{"Access-Control-Allow-Origin": appOrigin}, Code: http.StatusOK},
+		// Endpoint overrides
+		{Method: http.MethodOptions, Path: "/cors-api/public", Headers: preflight(appOrigin, http.MethodGet),
+			HeadersMatch: map[string]string{"Access-Control-Allow-Origin": "*"}, Code: http.StatusOK},
+		{Method: http.MethodOptions, Path: "/cors-api/write", Headers: preflight(appOrigin, http.MethodPost),
+			HeadersMatch: map[string]string{"Access-Control-Allow-Origin": appOrigin, "Access-Control-Allow-Methods": http.MethodPost},
+			BodyNotMatch: "Method", Code: http.StatusOK},
+		{Method: http.MethodOptions, Path: "/cors-api/write", Headers: preflight(appOrigin, http.MethodGet),
+			HeadersNotMatch: map[string]string{"Access-Control-Allow-Origin": appOrigin}, Code: http.StatusOK},
+		// Methods derived from the white list
+		{Method: http.MethodOptions, Path: "/cors-api/items", Headers: preflight(apiOrigin, http.MethodPut),
+			HeadersMatch: map[string]string{"Access-Control-Allow-Methods": http.MethodPut}, BodyNotMatch: "Method", Code: http.StatusOK},
+		{Method: http.MethodOptions, Path: "/cors-api/items", Headers: preflight(apiOrigin, http.MethodDelete),
+			HeadersNotMatch: map[string]string{"Access-Control-Allow-Origin": apiOrigin}, Code: http.StatusOK},
+	}...)
+}
+
 func TestTykRateLimitsStatusOfAPI(t *testing.T) {
 	g := StartTest()
 	defer g.Close()
@@ -0,0 +1,205 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+// oauthExportKeyCheck is encrypted along with the client secrets, so that an
+// import can tell whether it was given the right key.
+const oauthExportKeyCheck = "tyk-oauth-client-export"
+
+// oauthClientExport holds the OAuth clients of an API, as exported from one
+// environment and imported into another. When Encrypted is set, the client
+// secrets are encrypted with the key passed in the X-Tyk-Export-Key header.
+//
+// swagger:model oauthClientExport
+type oauthClientExport struct {
+	APIID     string             `json:"api_id"`
+	Encrypted bool               `json:"encrypted"`
+	KeyCheck  string             `json:"key_check,omitempty"`
+	Clients   []NewClientRequest `json:"clients"`
+}
+
+// oauthClientImportResult lists the IDs of the imported clients, and of the
+// existing ones that were left untouched.
+//
+// swagger:model oauthClientImportResult
+type oauthClientImportResult struct {
+	Imported []string `json:"imported"`
+	Skipped  []string `json:"skipped"`
+}
+
+func oauthExportKey(r *http.Request) []byte {
+	key := r.Header.Get(headers.XTykExportKey)
+	if key == "" {
+		return nil
+	}
+	return []byte(rightPad2Len(key, "=", 32))
+}
+
+// Export OAuth clients
+// Exports all OAuth clients of an API, including their secrets. The secrets
+// are encrypted with the key passed in the `X-Tyk-Export-Key` header, if any.
+//
+//---
+// responses:
+//   200:
+//     description: OAuth clients of the API
+//     schema:
+//       "$ref": "#/definitions/oauthClientExport"
+//   404:
+//     description: API not found
+func exportOauthClientsHandler(w http.ResponseWriter, r *http.Request) {
+	apiID := mux.Vars(r)["apiID"]
+
+	clientData, status, code := getApiClients(apiID)
+	if code != http.StatusOK {
+		doJSONWrite(w, code, status)
+		return
+	}
+
+	key := oauthExportKey(r)
+	export := oauthClientExport{
+		APIID:     apiID,
+		Encrypted: key != nil,
+		Clients:   []NewClientRequest{},
+	}
+	if export.Encrypted {
+		export.KeyCheck = encrypt(key, oauthExportKeyCheck)
+	}
+
+	for _, client := range clientData {
+		secret := client.GetSecret()
+		if export.Encrypted {
+			secret = encrypt(key, secret)
+		}
+
+		export.Clients = append(export.Clients, NewClientRequest{
+			ClientID:          client.GetId(),
+			ClientSecret:      secret,
+			ClientRedirectURI: client.GetRedirectUri(),
+			PolicyID:          client.GetPolicyID(),
+			MetaData:          client.GetUserData(),
+			Description:       client.GetDescription(),
+		})
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix":    "api",
+		"apiID":     apiID,
+		"clients":   len(export.Clients),
+		"encrypted": export.Encrypted,
+		"status":    "ok",
+	}).Info("Exported OAuth clients")
+
+	doJSONWrite(w, http.StatusOK, export)
+}
+
+// Import OAuth clients
+// Imports OAuth clients, as exported from any API, into an API. Encrypted
+// secrets are decrypted with the key passed in the `X-Tyk-Export-Key` header.
+// Existing clients are skipped, unless `overwrite=true` is set.
+//
+//---
+// responses:
+//   200:
+//     description: Import result
+//     schema:
+//       "$ref": "#/definitions/oauthClientImportResult"
+//   400:
+//     description: Malformed export, API not OAuth2 or wrong key
+//   404:
+//     description: API not found
+func importOauthClientsHandler(w http.ResponseWriter, r *http.Request) {
+	apiID := mux.Vars(r)["apiID"]
+	overwrite := r.URL.Query().Get("overwrite") == "true"
+
+	var export oauthClientExport
+	if err := json.NewDecoder(r.Body).Decode(&export); err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+		return
+	}
+
+	apiSpec := getApiSpec(apiID)
+	if apiSpec == nil {
+		doJSONWrite(w, http.StatusNotFound, apiError("API doesn't exist"))
+		return
+	}
+	if !apiSpec.UseOauth2 || apiSpec.OAuthManager == nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError("API is not OAuth2"))
+		return
+	}
+
+	key := oauthExportKey(r)
+	if export.Encrypted {
+		if key == nil || decrypt(key, export.KeyCheck) != oauthExportKeyCheck {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Wrong or missing export key"))
+			return
+		}
+	}
+
+	for _, client := range export.Clients {
+		if client.ClientID == "" || client.ClientSecret == "" {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Clients must have an ID and a secret"))
+			return
+		}
+	}
+
+	storage := apiSpec.OAuthManager.OsinServer.Storage
+	result := oauthClientImportResult{
+		Imported: []string{},
+		Skipped:  []string{},
+	}
+	for _, client := range export.Clients {
+		storageID := oauthClientStorageID(client.ClientID)
+		if !overwrite {
+			if _, err := storage.GetExtendedClientNoPrefix(storageID); err == nil {
+				result.Skipped = append(result.Skipped, client.ClientID)
+				continue
+			}
+		}
+
+		secret := client.ClientSecret
+		if export.Encrypted {
+			secret = decrypt(key, secret)
+		}
+
+		newClient := OAuthClient{
+			ClientID:          client.ClientID,
+			ClientSecret:      secret,
+			ClientRedirectURI: client.ClientRedirectURI,
+			PolicyID:          client.PolicyID,
+			MetaData:          client.MetaData,
+			Description:       client.Description,
+		}
+		if err := storage.SetClient(storageID, apiSpec.OrgID, &newClient, true); err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix":   "api",
+				"apiID":    apiID,
+				"clientID": client.ClientID,
+				"status":   "fail",
+				"err":      err,
+			}).Error("Failed to import OAuth client")
+			doJSONWrite(w, http.StatusInternalServerError, apiError("Failure in storing client data."))
+			return
+		}
+		result.Imported = append(result.Imported, client.ClientID)
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix":   "api",
+		"apiID":    apiID,
+		"fromAPI":  export.APIID,
+		"imported": len(result.Imported),
+		"skipped":  len(result.Skipped),
+		"status":   "ok",
+	}).Info("Imported OAuth clients")
+
+	doJSONWrite(w, http.StatusOK, result)
+}
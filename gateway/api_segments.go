@@ -0,0 +1,72 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+// nodeSegments represents the segment tags of the node
+// swagger:model
+type nodeSegments struct {
+	NodeIsSegmented bool     `json:"node_is_segmented"`
+	Tags            []string `json:"tags"`
+}
+
+// nodeSegmentsMu serialises the updates of the segment tags, for none to
+// be lost to another one made from an older global config.
+var nodeSegmentsMu sync.Mutex
+
+// Manage node segment tags
+// Returns or updates the segment tags of the node. An update reloads the APIs
+// of the node, filtered by the new tags, and lasts until the gateway is
+// restarted. With `block=true` the request waits for the reload to finish.
+//
+//---
+// responses:
+//   200:
+//     description: Segment tags of the node
+//     schema:
+//       "$ref": "#/definitions/nodeSegments"
+//   400:
+//     description: Request malformed
+func nodeSegmentsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		var segments nodeSegments
+		if err := json.NewDecoder(r.Body).Decode(&segments); err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+			return
+		}
+
+		nodeSegmentsMu.Lock()
+		globalConf := config.Global()
+		globalConf.DBAppConfOptions.NodeIsSegmented = segments.NodeIsSegmented
+		globalConf.DBAppConfOptions.Tags = segments.Tags
+		config.SetGlobal(globalConf)
+		nodeSegmentsMu.Unlock()
+
+		log.WithFields(logrus.Fields{
+			"prefix": "api",
+			"tags":   segments.Tags,
+		}).Info("Node segment tags updated, reloading APIs.")
+
+		var wg sync.WaitGroup
+		if r.URL.Query().Get("block") == "true" {
+			wg.Add(1)
+			reloadURLStructure(wg.Done)
+		} else {
+			reloadURLStructure(nil)
+		}
+		wg.Wait()
+	}
+
+	dbAppConfOptions := config.Global().DBAppConfOptions
+	doJSONWrite(w, http.StatusOK, nodeSegments{
+		NodeIsSegmented: dbAppConfOptions.NodeIsSegmented,
+		Tags:            dbAppConfOptions.Tags,
+	})
+}
@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestNodeSegmentsHandler(t *testing.T) {
+	ReloadTestCase.Enable()
+	defer ReloadTestCase.Disable()
+
+	ReloadTestCase.StartTicker()
+	defer ReloadTestCase.StopTicker()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	dashboard := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/system/apis" {
+			w.Write([]byte(`{"Status": "OK", "Message": []}`))
+			return
+		}
+		w.Write([]byte(`{"Status": "OK", "Nonce": "1", "Message": [
+			{"api_definition": {"api_id": "a", "tags": ["a"], "proxy": {"listen_path": "/a/"}}},
+			{"api_definition": {"api_id": "b", "tags": ["b"], "proxy": {"listen_path": "/b/"}}}
+		]}`))
+	}))
+	defer dashboard.Close()
+
+	globalConf := config.Global()
+	globalConf.UseDBAppConfigs = true
+	globalConf.AllowInsecureConfigs = true
+	globalConf.DBAppConfOptions.ConnectionString = dashboard.URL
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/tyk/node/segments", AdminAuth: true, Code: http.StatusOK, BodyMatch: `"node_is_segmented":false`},
+		{Method: http.MethodPut, Path: "/tyk/node/segments", Data: "{", AdminAuth: true, Code: http.StatusBadRequest},
+		{
+			Method: http.MethodPut, Path: "/tyk/node/segments?block=true", AdminAuth: true, Code: http.StatusOK,
+			Data:      nodeSegments{NodeIsSegmented: true, Tags: []string{"b"}},
+			BodyMatch: `{"node_is_segmented":true,"tags":\["b"\]}`,
+		},
+	}...)
+
+	if getApiSpec("a") != nil || getApiSpec("b") == nil {
+		t.Error("Only APIs of the new segment should be loaded")
+	}
+
+	ts.Run(t, test.TestCase{
+		Method: http.MethodPut, Path: "/tyk/node/segments?block=true", AdminAuth: true, Code: http.StatusOK,
+		Data: nodeSegments{NodeIsSegmented: true, Tags: []string{"a", "b"}},
+	})
+
+	if getApiSpec("a") == nil || getApiSpec("b") == nil {
+		t.Error("APIs of both segments should be loaded")
+	}
+}
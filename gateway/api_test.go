@@ -2,15 +2,19 @@ package gateway
 
 import (
 	"bytes"
+	"crypto/sha1"
 	"crypto/x509"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strconv"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	uuid "github.com/satori/go.uuid"
@@ -22,6 +26,7 @@ import (
 
 	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
 	"github.com/TykTechnologies/tyk/storage"
 	"github.com/TykTechnologies/tyk/test"
 	"github.com/TykTechnologies/tyk/user"
@@ -62,6 +67,43 @@ func TestHealthCheckEndpoint(t *testing.T) {
 	}...)
 }
 
+func TestUptimeTestsHandler(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "uptime"
+		spec.UptimeTests.CheckList = []apidef.HostCheckObject{{CheckURL: "http://host1"}}
+	})
+	// the handler persists the definition, keep it from being loaded by other tests
+	defer os.Remove(filepath.Join(config.Global().AppPath, "uptime.json"))
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/tyk/apis/unknown/uptime_tests", AdminAuth: true, Code: http.StatusNotFound},
+		{Path: "/tyk/apis/uptime/uptime_tests", AdminAuth: true, Code: http.StatusOK, BodyMatch: `"url":"http://host1"`},
+		{Path: "/tyk/apis/uptime/uptime_tests/1", AdminAuth: true, Code: http.StatusNotFound},
+		{Method: http.MethodPost, Path: "/tyk/apis/uptime/uptime_tests", AdminAuth: true, Data: `{"method":"GET"}`,
+			Code: http.StatusBadRequest, BodyMatch: errUptimeTestURLMissing.Error()},
+		{Method: http.MethodPost, Path: "/tyk/apis/uptime/uptime_tests", AdminAuth: true,
+			Data: apidef.HostCheckObject{CheckURL: "http://host2", ExpectedStatusCodes: []int{204}}, Code: http.StatusOK},
+		{Path: "/tyk/apis/uptime/uptime_tests/1", AdminAuth: true, Code: http.StatusOK,
+			BodyMatch: `"url":"http://host2".*"expected_status_codes":\[204\]`},
+		{Method: http.MethodDelete, Path: "/tyk/apis/uptime/uptime_tests/0", AdminAuth: true, Code: http.StatusOK},
+	}...)
+
+	spec := getApiSpec("uptime")
+	if len(spec.UptimeTests.CheckList) != 1 || spec.UptimeTests.CheckList[0].CheckURL != "http://host2" {
+		t.Error("Expected uptime tests to be updated in place, got ", spec.UptimeTests.CheckList)
+	}
+
+	GlobalHostChecker.checkerMu.Lock()
+	_, tracked := GlobalHostChecker.currentHostList["http://host2"]
+	GlobalHostChecker.checkerMu.Unlock()
+	if !tracked {
+		t.Error("Expected updated uptime test to be tracked")
+	}
+}
+
 func TestApiHandlerPostDupPath(t *testing.T) {
 	type testCase struct {
 		APIID, ListenPath string
@@ -205,8 +247,32 @@ func TestKeyHandler(t *testing.T) {
 				Path:      "/tyk/keys/create",
 				Data:      string(withBadPolicyJSON),
 				AdminAuth: true,
+				Code:      400,
+				BodyMatch: `"reason":"policy_not_found","policy_ids":\["xyz_policy"\]`,
+			},
+			{
+				Method:    "POST",
+				Path:      "/tyk/keys/create?strict=false",
+				Data:      string(withBadPolicyJSON),
+				AdminAuth: true,
 				Code:      500,
 			},
+			{
+				Method:    "POST",
+				Path:      "/tyk/keys/bad_policy_key",
+				Data:      string(withBadPolicyJSON),
+				AdminAuth: true,
+				Code:      400,
+				BodyMatch: `"reason":"policy_not_found"`,
+			},
+			{
+				Method:    "POST",
+				Path:      "/tyk/keys/preview",
+				Data:      string(withBadPolicyJSON),
+				AdminAuth: true,
+				Code:      400,
+				BodyMatch: `"reason":"policy_not_found"`,
+			},
 			{
 				Method:    "POST",
 				Path:      "/tyk/keys/my_key_id",
@@ -585,6 +651,81 @@ func TestUpdateKeyWithCert(t *testing.T) {
 	})
 }
 
+func TestPreviewKeyHandler(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "versioned"
+		spec.Proxy.ListenPath = "/versioned/"
+		spec.VersionData.NotVersioned = false
+		spec.VersionData.Versions = map[string]apidef.VersionInfo{"v1": {Name: "v1"}}
+		spec.DisableQuota = true
+	})
+
+	policiesMu.Lock()
+	policiesByID["preview_policy"] = user.Policy{
+		ID:               "preview_policy",
+		Active:           true,
+		Rate:             100,
+		Per:              1,
+		QuotaMax:         50,
+		QuotaRenewalRate: 3600,
+		AccessRights: map[string]user.AccessDefinition{"versioned": {
+			APIID:       "versioned",
+			Versions:    []string{"v1", "v2"},
+			AllowedURLs: []user.AccessSpec{{URL: "/allowed", Methods: []string{"GET"}}},
+		}},
+	}
+	policiesMu.Unlock()
+	defer func() {
+		policiesMu.Lock()
+		delete(policiesByID, "preview_policy")
+		policiesMu.Unlock()
+	}()
+
+	session := CreateStandardSession()
+	session.ApplyPolicies = []string{"preview_policy"}
+
+	ts.Run(t, []test.TestCase{
+		{
+			Method: http.MethodPost, Path: "/tyk/keys/preview", Data: session, AdminAuth: true, Code: http.StatusOK,
+			BodyMatchFunc: func(body []byte) bool {
+				var preview struct {
+					ApplyPolicies   []string            `json:"apply_policies"`
+					EffectiveLimits []apiEffectiveLimit `json:"effective_limits"`
+					Warnings        []string            `json:"warnings"`
+				}
+				if err := json.Unmarshal(body, &preview); err != nil {
+					t.Error(err)
+					return false
+				}
+
+				assert.Equal(t, []string{"preview_policy"}, preview.ApplyPolicies)
+				assert.Equal(t, []apiEffectiveLimit{{
+					APIID:            "versioned",
+					Versions:         []string{"v1", "v2"},
+					Rate:             100,
+					Per:              1,
+					QuotaMax:         50,
+					QuotaRenewalRate: 3600,
+					AllowedURLs:      []user.AccessSpec{{URL: "/allowed", Methods: []string{"GET"}}},
+				}}, preview.EffectiveLimits)
+				assert.Equal(t, []string{
+					`version "v2" of API versioned does not exist`,
+					"quotas are disabled for API versioned",
+				}, preview.Warnings)
+				return true
+			},
+		},
+		{
+			Method: http.MethodPost, Path: "/tyk/keys/preview", AdminAuth: true, Code: http.StatusOK,
+			Data:      user.SessionState{AccessRights: map[string]user.AccessDefinition{"missing": {APIID: "missing"}}},
+			BodyMatch: `"warnings":\["API missing is not loaded"\]`,
+		},
+	}...)
+}
+
 func TestKeyHandler_CheckKeysNotDuplicateOnUpdate(t *testing.T) {
 	ts := StartTest()
 	defer ts.Close()
@@ -659,6 +800,8 @@ func TestHashKeyHandler(t *testing.T) {
 		{storage.HashMurmur64, 16, ""},
 		{storage.HashMurmur128, 32, ""},
 		{storage.HashSha256, 64, ""},
+		{storage.HashSha512_256, 64, ""},
+		{storage.HashBlake3, 64, ""},
 		{"wrong", 16, " Should fallback to murmur64 if wrong alg"},
 	}
 
@@ -675,6 +818,41 @@ func TestHashKeyHandler(t *testing.T) {
 	}
 }
 
+func TestHashKeyFunctionMigration(t *testing.T) {
+	storage.RegisterHashFunction("test-sha1", sha1.New)
+
+	globalConf := config.Global()
+	globalConf.HashKeys = true
+	globalConf.HashKeyFunction = "test-sha1"
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	session := testPrepareBasicAuth(false)
+	resp, _ := ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/tyk/keys/migrateduser", Data: session, AdminAuth: true, Code: http.StatusOK})
+	var created apiModifyKeySuccess
+	json.NewDecoder(resp.Body).Decode(&created)
+	if len(created.KeyHash) != 40 {
+		t.Fatal("Expected the key to be hashed with the registered function, got: ", created.KeyHash)
+	}
+
+	globalConf.HashKeyFunction = storage.HashBlake3
+	config.SetGlobal(globalConf)
+
+	userPath := "/tyk/keys/migrateduser?username=true&org_id=default"
+	_, _ = ts.Run(t, test.TestCase{Method: http.MethodGet, Path: userPath, AdminAuth: true, Code: http.StatusNotFound})
+
+	globalConf.HashKeyFunctionFallback = []string{"test-sha1"}
+	config.SetGlobal(globalConf)
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Method: http.MethodGet, Path: userPath, AdminAuth: true, Code: http.StatusOK},
+		{Method: http.MethodGet, Path: "/", Headers: map[string]string{"Authorization": genAuthHeader("migrateduser", "password")}, Code: http.StatusOK},
+	}...)
+}
+
 func TestHashKeyHandlerLegacyWithHashFunc(t *testing.T) {
 	globalConf := config.Global()
 
@@ -1004,6 +1182,79 @@ func TestHashKeyListingDisabled(t *testing.T) {
 	})
 }
 
+func TestExpiringKeysHandler(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.HashKeys = false
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	const orgID = "expiry-audit-org"
+	now := time.Now()
+
+	createKey := func(expires, lifetime int64) string {
+		key := generateToken(orgID, "")
+		session := CreateStandardSession()
+		session.OrgID = orgID
+		session.Expires = expires
+		session.AccessRights = map[string]user.AccessDefinition{"test": {APIID: "test"}}
+		GlobalSessionManager.UpdateSession(key, session, lifetime, false)
+		return key
+	}
+
+	soon := createKey(now.Add(time.Hour).Unix(), 0)
+	removedSoon := createKey(0, 3600)
+	later := createKey(now.Add(10*24*time.Hour).Unix(), 0)
+	expired := createKey(now.Add(-time.Hour).Unix(), 0)
+	never := createKey(0, 0)
+	defer func() {
+		for _, key := range []string{soon, removedSoon, later, expired, never} {
+			GlobalSessionManager.RemoveSession(orgID, key, false)
+		}
+	}()
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/tyk/keys/expiring?within=nope", AdminAuth: true, Code: http.StatusBadRequest},
+		{
+			Path: "/tyk/keys/expiring?within=72h&org_id=" + orgID, AdminAuth: true, Code: http.StatusOK,
+			BodyMatchFunc: func(body []byte) bool {
+				var report keyExpiryReport
+				if err := json.Unmarshal(body, &report); err != nil {
+					t.Error(err)
+					return false
+				}
+
+				var hashes []string
+				for _, key := range report.Keys {
+					hashes = append(hashes, key.KeyHash)
+				}
+				want := []string{storage.HashStr(removedSoon), storage.HashStr(soon)}
+				sort.Strings(want)
+				sort.Strings(hashes)
+
+				return report.Within == 72*3600 && report.Count == 2 &&
+					reflect.DeepEqual(hashes, want) &&
+					report.Orgs[orgID] == 2 && report.APIs["test"] == 2
+			},
+		},
+		{
+			Path: "/tyk/keys/expiring?within=720h&org_id=" + orgID, AdminAuth: true, Code: http.StatusOK,
+			BodyMatch: `"count":3`,
+		},
+	}...)
+
+	t.Run("Hashed key listing disabled", func(t *testing.T) {
+		globalConf := config.Global()
+		globalConf.HashKeys = true
+		globalConf.EnableHashedKeysListing = false
+		config.SetGlobal(globalConf)
+
+		ts.Run(t, test.TestCase{Path: "/tyk/keys/expiring", AdminAuth: true, Code: http.StatusNotFound})
+	})
+}
+
 func TestKeyHandler_HashingDisabled(t *testing.T) {
 	globalConf := config.Global()
 	// make it to NOT use hashes for Redis keys
@@ -1100,6 +1351,52 @@ func TestInvalidateCache(t *testing.T) {
 	}...)
 }
 
+func TestAPITagsAndCategories(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "catalog-api"
+		spec.Name = "Catalog #catalog #public"
+		spec.Tags = []string{"catalog"}
+		spec.Proxy.ListenPath = "/catalog"
+	}, func(spec *APISpec) {
+		spec.APIID = "orders-api"
+		spec.Name = "Orders #public"
+		spec.Tags = []string{"orders"}
+		spec.Proxy.ListenPath = "/orders"
+	})
+
+	ts.Run(t, []test.TestCase{
+		{
+			Path: "/tyk/apis?tag=catalog", AdminAuth: true, Code: http.StatusOK,
+			BodyMatch: `"api_id":"catalog-api"`, BodyNotMatch: `"api_id":"orders-api"`,
+		},
+		{
+			Path: "/tyk/apis?category=public", AdminAuth: true, Code: http.StatusOK,
+			BodyMatch: `"api_id":"orders-api"`,
+		},
+		{Path: "/tyk/apis?category=catalog&tag=orders", AdminAuth: true, Code: http.StatusOK, BodyMatch: `^\[\]`},
+		{
+			Path: "/tyk/apis/categories", AdminAuth: true, Code: http.StatusOK,
+			BodyMatch: `"categories":{"catalog":\["catalog-api"\],"public":\["catalog-api","orders-api"\]}`,
+		},
+		{
+			Path: "/tyk/apis/categories", AdminAuth: true, Code: http.StatusOK,
+			BodyMatch: `"tags":{"catalog":\["catalog-api"\],"orders":\["orders-api"\]}`,
+		},
+		{Method: http.MethodDelete, Path: "/tyk/cache", AdminAuth: true, Code: http.StatusBadRequest},
+		{
+			Method: http.MethodDelete, Path: "/tyk/cache?category=public", AdminAuth: true, Code: http.StatusOK,
+			BodyMatch: `cache invalidated for 2 APIs`,
+		},
+		{
+			Method: http.MethodDelete, Path: "/tyk/cache?tag=catalog", AdminAuth: true, Code: http.StatusOK,
+			BodyMatch: `cache invalidated for 1 APIs`,
+		},
+	}...)
+}
+
 func TestGetOAuthClients(t *testing.T) {
 	ts := StartTest()
 	defer ts.Close()
@@ -1124,6 +1421,54 @@ func TestGetOAuthClients(t *testing.T) {
 	}...)
 }
 
+func TestOAuthClientsExportImport(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "staging"
+		spec.Proxy.ListenPath = "/staging/"
+		spec.UseOauth2 = true
+	}, func(spec *APISpec) {
+		spec.APIID = "prod"
+		spec.Proxy.ListenPath = "/prod/"
+		spec.UseOauth2 = true
+	})
+
+	ts.Run(t, test.TestCase{
+		Method: http.MethodPost, Path: "/tyk/oauth/clients/create", AdminAuth: true, Code: http.StatusOK,
+		Data: NewClientRequest{ClientID: "client1", ClientSecret: "secret1", ClientRedirectURI: "http://localhost", APIID: "staging"},
+	})
+
+	exportKey := map[string]string{headers.XTykExportKey: "passphrase"}
+
+	var encrypted, plain oauthClientExport
+	ts.Run(t, []test.TestCase{
+		{Path: "/tyk/oauth/clients/unknown/export", AdminAuth: true, Code: http.StatusNotFound},
+		{Path: "/tyk/oauth/clients/staging/export", AdminAuth: true, Code: http.StatusOK, BodyMatchFunc: func(body []byte) bool {
+			return json.Unmarshal(body, &plain) == nil
+		}},
+		{Path: "/tyk/oauth/clients/staging/export", Headers: exportKey, AdminAuth: true, Code: http.StatusOK, BodyMatchFunc: func(body []byte) bool {
+			return json.Unmarshal(body, &encrypted) == nil
+		}},
+	}...)
+
+	assert.False(t, plain.Encrypted)
+	assert.Equal(t, "secret1", plain.Clients[0].ClientSecret)
+	assert.True(t, encrypted.Encrypted)
+	assert.Len(t, encrypted.Clients, 1)
+	assert.NotEqual(t, "secret1", encrypted.Clients[0].ClientSecret)
+
+	ts.Run(t, []test.TestCase{
+		{Method: http.MethodPost, Path: "/tyk/oauth/clients/prod/import", Data: encrypted, AdminAuth: true, Code: http.StatusBadRequest, BodyMatch: "Wrong or missing export key"},
+		{Method: http.MethodPost, Path: "/tyk/oauth/clients/prod/import", Data: encrypted, Headers: map[string]string{headers.XTykExportKey: "wrong"}, AdminAuth: true, Code: http.StatusBadRequest},
+		{Method: http.MethodPost, Path: "/tyk/oauth/clients/prod/import", Data: encrypted, Headers: exportKey, AdminAuth: true, Code: http.StatusOK, BodyMatch: `{"imported":\["client1"\],"skipped":\[\]}`},
+		{Path: "/tyk/oauth/clients/prod/client1", AdminAuth: true, Code: http.StatusOK, BodyMatch: `"secret":"secret1"`},
+		{Method: http.MethodPost, Path: "/tyk/oauth/clients/prod/import", Data: plain, AdminAuth: true, Code: http.StatusOK, BodyMatch: `{"imported":\[\],"skipped":\["client1"\]}`},
+		{Method: http.MethodPost, Path: "/tyk/oauth/clients/prod/import?overwrite=true", Data: plain, AdminAuth: true, Code: http.StatusOK, BodyMatch: `{"imported":\["client1"\]`},
+	}...)
+}
+
 func TestCreateOAuthClient(t *testing.T) {
 	ts := StartTest()
 	defer ts.Close()
@@ -0,0 +1,204 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/regexp"
+)
+
+var errUptimeTestURLMissing = errors.New("uptime test url is required")
+
+func validateUptimeTest(check apidef.HostCheckObject) error {
+	if check.CheckURL == "" {
+		return errUptimeTestURLMissing
+	}
+	if _, err := url.Parse(check.CheckURL); err != nil {
+		return err
+	}
+	if check.BodyMatch != "" {
+		if _, err := regexp.Compile(check.BodyMatch); err != nil {
+			return fmt.Errorf("invalid body_match: %v", err)
+		}
+	}
+	return nil
+}
+
+// validateUptimeTests checks the uptime tests of an API, which isn't loaded
+// if any is invalid rather than have its hosts reported down.
+func validateUptimeTests(def *apidef.APIDefinition) error {
+	for _, check := range def.UptimeTests.CheckList {
+		if err := validateUptimeTest(check); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uptimeTestsMu serialises the updates of uptime tests, for each to be
+// persisted and applied before the next one.
+var uptimeTestsMu sync.Mutex
+
+// Manage uptime tests of an API
+// Lists, adds, replaces or removes the uptime tests of a loaded API. Changes
+// are persisted to the API definition file and applied to the host checker
+// without reloading the gateway.
+//
+//---
+// responses:
+//   200:
+//     description: Uptime tests of the API
+//     schema:
+//       type: array
+//       items:
+//         "$ref": "#/definitions/HostCheckObject"
+//   400:
+//     description: Invalid uptime test, or API definitions managed by the Dashboard
+//   404:
+//     description: API or uptime test not found
+func uptimeTestsHandler(w http.ResponseWriter, r *http.Request) {
+	apiID := mux.Vars(r)["apiID"]
+	index, hasIndex := mux.Vars(r)["index"]
+
+	spec := getApiSpec(apiID)
+	if spec == nil {
+		doJSONWrite(w, http.StatusNotFound, apiError("API not found"))
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		if config.Global().UseDBAppConfigs {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Due to enabled use_db_app_configs, please use the Dashboard API"))
+			return
+		}
+		if config.Global().SlaveOptions.UseRPC {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Due to enabled slave_options.use_rpc, please use the Dashboard API"))
+			return
+		}
+		uptimeTestsMu.Lock()
+		defer uptimeTestsMu.Unlock()
+	}
+
+	// the change is applied to the definition as it was loaded, to be
+	// persisted with its references unexpanded
+	def := *spec.storedDefinition()
+	checkList := def.UptimeTests.CheckList
+
+	pos := -1
+	if hasIndex {
+		var err error
+		pos, err = strconv.Atoi(index)
+		if err != nil || pos < 0 || pos >= len(checkList) {
+			doJSONWrite(w, http.StatusNotFound, apiError("Uptime test not found"))
+			return
+		}
+	}
+
+	if r.Method == http.MethodGet {
+		if hasIndex {
+			doJSONWrite(w, http.StatusOK, checkList[pos])
+			return
+		}
+		doJSONWrite(w, http.StatusOK, checkList)
+		return
+	}
+
+	var newList []apidef.HostCheckObject
+	switch {
+	case r.Method == http.MethodDelete:
+		newList = append(newList, checkList[:pos]...)
+		newList = append(newList, checkList[pos+1:]...)
+	case r.Method == http.MethodPut && !hasIndex:
+		if err := json.NewDecoder(r.Body).Decode(&newList); err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+			return
+		}
+	default:
+		var check apidef.HostCheckObject
+		if err := json.NewDecoder(r.Body).Decode(&check); err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+			return
+		}
+
+		newList = append(newList, checkList...)
+		if hasIndex {
+			newList[pos] = check
+		} else {
+			newList = append(newList, check)
+		}
+	}
+	def.UptimeTests.CheckList = newList
+
+	liveList := newList
+	if config.Global().ExpandAPIDefinitions {
+		expanded, err := expandedAPIDefinition(&def)
+		if err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+			return
+		}
+		liveList = expanded.UptimeTests.CheckList
+	}
+
+	for _, check := range liveList {
+		if err := validateUptimeTest(check); err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+			return
+		}
+	}
+
+	logger := log.WithFields(logrus.Fields{"prefix": "api", "api_id": apiID})
+	persisted, err := persistAPIDefinition(&def)
+	if err != nil {
+		logger.WithError(err).Error("Couldn't persist the updated uptime tests")
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Failed to persist API definition"))
+		return
+	}
+	if !persisted {
+		logger.Warning("Uptime tests updated for this gateway only, the API wasn't loaded from a file of the app path")
+	}
+
+	spec.Lock()
+	spec.UptimeTests.CheckList = liveList
+	if spec.rawDefinition != nil {
+		spec.rawDefinition = &def
+	}
+	spec.Unlock()
+
+	updateUptimeTestsForSpec(spec)
+
+	doJSONWrite(w, http.StatusOK, newList)
+}
+
+// updateUptimeTestsForSpec replaces the hosts tracked by the host checker for
+// the given API.
+func updateUptimeTestsForSpec(spec *APISpec) {
+	spec.RLock()
+	useDiscovery := spec.UptimeTests.Config.ServiceDiscovery.UseDiscoveryService
+	checkList := spec.UptimeTests.CheckList
+	spec.RUnlock()
+
+	if useDiscovery {
+		return
+	}
+
+	hostList := []HostData{}
+	for _, check := range checkList {
+		hostData, err := GlobalHostChecker.PrepareTrackingHost(check, spec.APIID)
+		if err != nil {
+			continue
+		}
+		hostList = append(hostList, hostData)
+	}
+
+	GlobalHostChecker.UpdateTrackingListByAPIID(hostList, spec.APIID)
+}
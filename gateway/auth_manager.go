@@ -83,6 +83,7 @@ func (b *DefaultSessionManager) clearCacheForKey(keyName string, hashed bool) {
 
 	// Delete current gateway's cache immediately
 	SessionCache.Delete(cacheKey)
+	sessionFallback.delete(cacheKey)
 
 	// Notify gateways in cluster to flush cache
 	n := Notification{
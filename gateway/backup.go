@@ -0,0 +1,481 @@
+package gateway
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/certs"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const (
+	snapshotManifest     = "manifest.json"
+	snapshotCertificates = "certificates.json"
+	snapshotAPIsDir      = "apis/"
+	snapshotPoliciesDir  = "policies/"
+
+	// maxSnapshotSize limits the uncompressed size of restored snapshots.
+	maxSnapshotSize = 512 << 20
+)
+
+// snapshotInfo describes a snapshot, it is the manifest.json file of the
+// snapshot.
+// swagger:model
+type snapshotInfo struct {
+	CreatedAt    time.Time `json:"created_at"`
+	NodeID       string    `json:"node_id"`
+	Version      string    `json:"version"`
+	APIs         int       `json:"apis"`
+	Policies     int       `json:"policies"`
+	Certificates int       `json:"certificates"`
+}
+
+// snapshot is the state of the gateway saved by a backup. Certificates only
+// hold the metadata of the certificates, not their keys.
+type snapshot struct {
+	Info         snapshotInfo
+	APIs         []*apidef.APIDefinition
+	Policies     []user.Policy
+	Certificates []*certs.CertificateMeta
+}
+
+// apiBackupStored is the response to a backup written to the backup path.
+// swagger:model
+type apiBackupStored struct {
+	Status   string       `json:"status"`
+	File     string       `json:"file"`
+	Snapshot snapshotInfo `json:"snapshot"`
+}
+
+// apiRestoreResult is the response to a restored snapshot. MissingCertificates
+// lists the certificates of the snapshot that are not in the certificate
+// store, they must be added again for the APIs using them to work.
+// swagger:model
+type apiRestoreResult struct {
+	Status              string       `json:"status"`
+	Snapshot            snapshotInfo `json:"snapshot"`
+	PoliciesRestored    bool         `json:"policies_restored"`
+	MissingCertificates []string     `json:"missing_certificates"`
+}
+
+// takeSnapshot captures the loaded API definitions and policies, and the
+// metadata of the stored certificates.
+func takeSnapshot() snapshot {
+	snap := snapshot{
+		Info: snapshotInfo{
+			CreatedAt: time.Now().UTC(),
+			NodeID:    GetNodeID(),
+			Version:   VERSION,
+		},
+	}
+
+	apisMu.RLock()
+	for _, spec := range apisByID {
+		snap.APIs = append(snap.APIs, spec.storedDefinition())
+	}
+	apisMu.RUnlock()
+	sort.Slice(snap.APIs, func(i, j int) bool {
+		return snap.APIs[i].APIID < snap.APIs[j].APIID
+	})
+
+	policiesMu.RLock()
+	for _, policy := range policiesByID {
+		snap.Policies = append(snap.Policies, policy)
+	}
+	policiesMu.RUnlock()
+	sort.Slice(snap.Policies, func(i, j int) bool {
+		return snap.Policies[i].ID < snap.Policies[j].ID
+	})
+
+	certIDs := CertificateManager.ListAllIds("")
+	sort.Strings(certIDs)
+	for i, cert := range CertificateManager.List(certIDs, certs.CertificateAny) {
+		if cert == nil || cert.Leaf == nil {
+			continue
+		}
+		snap.Certificates = append(snap.Certificates, extractCertificateMeta(cert, certIDs[i]))
+	}
+
+	snap.Info.APIs = len(snap.APIs)
+	snap.Info.Policies = len(snap.Policies)
+	snap.Info.Certificates = len(snap.Certificates)
+	return snap
+}
+
+// writeSnapshot writes snap to w as a gzipped tarball.
+func writeSnapshot(w io.Writer, snap snapshot) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	add := func(name string, obj interface{}) error {
+		data, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			return err
+		}
+		header := &tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: snap.Info.CreatedAt,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	}
+
+	if err := add(snapshotManifest, snap.Info); err != nil {
+		return err
+	}
+	for _, def := range snap.APIs {
+		if err := add(snapshotAPIsDir+def.APIID+".json", def); err != nil {
+			return err
+		}
+	}
+	for _, policy := range snap.Policies {
+		if err := add(snapshotPoliciesDir+policy.ID+".json", policy); err != nil {
+			return err
+		}
+	}
+	if err := add(snapshotCertificates, snap.Certificates); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// readSnapshot reads a snapshot written by writeSnapshot. All the API
+// definitions must be valid.
+func readSnapshot(r io.Reader) (snapshot, error) {
+	var snap snapshot
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return snap, errors.New("snapshot is not a gzipped tarball")
+	}
+	tr := tar.NewReader(io.LimitReader(gz, maxSnapshotSize))
+
+	foundManifest := false
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return snap, fmt.Errorf("couldn't read snapshot: %v", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(header.Name)
+		var target interface{}
+		switch {
+		case name == snapshotManifest:
+			foundManifest = true
+			target = &snap.Info
+		case name == snapshotCertificates:
+			target = &snap.Certificates
+		case strings.HasPrefix(name, snapshotAPIsDir):
+			def := &apidef.APIDefinition{}
+			snap.APIs = append(snap.APIs, def)
+			target = def
+		case strings.HasPrefix(name, snapshotPoliciesDir):
+			snap.Policies = append(snap.Policies, user.Policy{})
+			target = &snap.Policies[len(snap.Policies)-1]
+		default:
+			continue
+		}
+		if err := json.NewDecoder(tr).Decode(target); err != nil {
+			return snap, fmt.Errorf("couldn't decode %s: %v", name, err)
+		}
+	}
+	if !foundManifest {
+		return snap, errors.New("snapshot has no manifest")
+	}
+
+	for _, def := range snap.APIs {
+		if def.APIID == "" || strings.ContainsAny(def.APIID, `/\`) {
+			return snap, fmt.Errorf("invalid API ID %q", def.APIID)
+		}
+		result := apidef.Validate(def, apidef.DefaultValidationRuleSet)
+		if !result.IsValid {
+			reason := "unknown"
+			if result.ErrorCount() > 0 {
+				reason = result.FirstError().Error()
+			}
+			return snap, fmt.Errorf("validation of API %s failed: %s", def.APIID, reason)
+		}
+	}
+	for _, policy := range snap.Policies {
+		if policy.ID == "" {
+			return snap, errors.New("policy without ID")
+		}
+	}
+
+	return snap, nil
+}
+
+// fileRestore writes files, keeping their previous content so that they can
+// be rolled back if one of the writes fails.
+type fileRestore struct {
+	previous map[string][]byte
+	written  []string
+}
+
+func (f *fileRestore) write(name string, data []byte) error {
+	if _, ok := f.previous[name]; !ok {
+		old, err := ioutil.ReadFile(name)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		f.previous[name] = old
+	}
+
+	if err := writeFileAtomic(name, data, 0644); err != nil {
+		return err
+	}
+	f.written = append(f.written, name)
+	return nil
+}
+
+// writeFileAtomic writes to a temporary file first, so that a failed write
+// leaves the file as it was.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, perm); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func (f *fileRestore) rollback() {
+	for _, name := range f.written {
+		old := f.previous[name]
+		var err error
+		if old == nil {
+			err = os.Remove(name)
+		} else {
+			err = ioutil.WriteFile(name, old, 0644)
+		}
+		if err != nil {
+			log.WithError(err).WithField("file", name).Error("Couldn't roll back restored file")
+		}
+	}
+}
+
+// policiesFromFile reports whether policies are loaded from the policy file,
+// and can thus be restored.
+func policiesFromFile() bool {
+	switch config.Global().Policies.PolicySource {
+	case "service", "rpc":
+		return false
+	}
+	return config.Global().Policies.PolicyRecordName != ""
+}
+
+// restoreSnapshot writes the API definitions and policies of snap to the app
+// path and the policy file, all or none of them. Files of APIs that are not in
+// the snapshot are kept. Policies are only restored if they are loaded from
+// the policy file, and replace its content.
+func restoreSnapshot(snap snapshot) (policiesRestored bool, err error) {
+	files := &fileRestore{previous: map[string][]byte{}}
+
+	for _, def := range snap.APIs {
+		data, err := json.MarshalIndent(def, "", "  ")
+		if err != nil {
+			files.rollback()
+			return false, err
+		}
+		if err := files.write(filepath.Join(config.Global().AppPath, def.APIID+".json"), data); err != nil {
+			files.rollback()
+			return false, err
+		}
+	}
+
+	if policiesFromFile() {
+		policies := make(map[string]user.Policy, len(snap.Policies))
+		for _, policy := range snap.Policies {
+			policies[policy.ID] = policy
+		}
+		data, err := json.MarshalIndent(policies, "", "  ")
+		if err == nil {
+			err = files.write(config.Global().Policies.PolicyRecordName, data)
+		}
+		if err != nil {
+			files.rollback()
+			return false, err
+		}
+		policiesRestored = true
+	}
+
+	return policiesRestored, nil
+}
+
+// restoreCertificateMetadata sets the metadata of the stored certificates of
+// the snapshot, and returns the IDs of the ones missing from the store.
+func restoreCertificateMetadata(snap snapshot) []string {
+	missing := []string{}
+	for _, meta := range snap.Certificates {
+		if meta == nil {
+			continue
+		}
+		if CertificateManager.List([]string{meta.ID}, certs.CertificateAny)[0] == nil {
+			missing = append(missing, meta.ID)
+			continue
+		}
+		if meta.Metadata != nil {
+			if err := CertificateManager.SetMetadata(meta.ID, *meta.Metadata); err != nil {
+				log.WithError(err).WithField("cert_id", meta.ID).Error("Couldn't restore certificate metadata")
+			}
+		}
+	}
+	return missing
+}
+
+// Back up the gateway
+// Takes a snapshot of the loaded API definitions and policies, and of the
+// metadata of the stored certificates, as a gzipped tarball. The snapshot is
+// downloaded, or written to the backup path of the gateway configuration if
+// store is true. Certificates themselves are not included.
+//
+//---
+// parameters:
+//   - name: store
+//     in: query
+//     required: false
+//     type: boolean
+// responses:
+//   200:
+//     description: Snapshot tarball, or where it was stored
+//     schema:
+//       "$ref": "#/definitions/apiBackupStored"
+//   400:
+//     description: No backup path configured
+//     schema:
+//       "$ref": "#/definitions/apiStatusMessage"
+//   500:
+//     description: Snapshot couldn't be stored
+//     schema:
+//       "$ref": "#/definitions/apiStatusMessage"
+func backupHandler(w http.ResponseWriter, r *http.Request) {
+	snap := takeSnapshot()
+	name := "tyk-backup-" + snap.Info.CreatedAt.Format("20060102T150405Z") + ".tar.gz"
+
+	if r.URL.Query().Get("store") != "true" {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+		w.WriteHeader(http.StatusOK)
+		if err := writeSnapshot(w, snap); err != nil {
+			log.WithError(err).Error("Couldn't write snapshot")
+		}
+		return
+	}
+
+	dir := config.Global().Backup.Path
+	if dir == "" {
+		doJSONWrite(w, http.StatusBadRequest, apiError("No backup path configured"))
+		return
+	}
+
+	var buf bytes.Buffer
+	file := filepath.Join(dir, name)
+	err := writeSnapshot(&buf, snap)
+	if err == nil {
+		err = ioutil.WriteFile(file, buf.Bytes(), 0600)
+	}
+	if err != nil {
+		log.WithError(err).Error("Couldn't store snapshot")
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Couldn't store snapshot"))
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix": "api",
+		"file":   file,
+	}).Info("Stored snapshot")
+	doJSONWrite(w, http.StatusOK, apiBackupStored{Status: "ok", File: file, Snapshot: snap.Info})
+}
+
+// Restore a backup
+// Restores a snapshot taken by the backup endpoint, sent as the request body:
+// the API definition files and, if policies are loaded from a file, the
+// policy file are written, then the gateway reloads. Nothing is written if
+// any part of the snapshot is invalid. The metadata of the certificates of the
+// snapshot is restored for the ones in the certificate store, the others are
+// reported as missing.
+//
+//---
+// responses:
+//   200:
+//     description: Snapshot restored
+//     schema:
+//       "$ref": "#/definitions/apiRestoreResult"
+//   400:
+//     description: Invalid snapshot
+//     schema:
+//       "$ref": "#/definitions/apiStatusMessage"
+//   500:
+//     description: Snapshot couldn't be written
+//     schema:
+//       "$ref": "#/definitions/apiStatusMessage"
+func restoreHandler(w http.ResponseWriter, r *http.Request) {
+	if config.Global().UseDBAppConfigs {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Due to enabled use_db_app_configs, please use the Dashboard API"))
+		return
+	}
+
+	snap, err := readSnapshot(r.Body)
+	if err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Invalid snapshot: "+err.Error()))
+		return
+	}
+
+	policiesRestored, err := restoreSnapshot(snap)
+	if err != nil {
+		log.WithError(err).Error("Couldn't restore snapshot")
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Couldn't restore snapshot, no changes were made"))
+		return
+	}
+	missing := restoreCertificateMetadata(snap)
+
+	log.WithFields(logrus.Fields{
+		"prefix":     "api",
+		"created_at": snap.Info.CreatedAt,
+		"apis":       len(snap.APIs),
+	}).Info("Restored snapshot, reloading")
+	reloadURLStructure(nil)
+
+	doJSONWrite(w, http.StatusOK, apiRestoreResult{
+		Status:              "ok",
+		Snapshot:            snap.Info,
+		PoliciesRestored:    policiesRestored,
+		MissingCertificates: missing,
+	})
+}
@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestBackupRestore(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+	defer ResetTestConfig()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "backup-b"
+		spec.Proxy.ListenPath = "/backup-b/"
+	}, func(spec *APISpec) {
+		spec.APIID = "backup-a"
+		spec.Proxy.ListenPath = "/backup-a/"
+	})
+	policyID := CreatePolicy()
+
+	resp, _ := ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/tyk/backup", AdminAuth: true, Code: http.StatusOK,
+		HeadersMatch: map[string]string{"Content-Type": "application/gzip"}})
+	backup, _ := ioutil.ReadAll(resp.Body)
+
+	snap, err := readSnapshot(bytes.NewReader(backup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.APIs) != 2 || snap.APIs[0].APIID != "backup-a" || snap.APIs[1].APIID != "backup-b" || snap.Info.APIs != 2 {
+		t.Fatalf("Expected the loaded APIs in the snapshot, got %+v", snap.APIs)
+	}
+	foundPolicy := false
+	for _, policy := range snap.Policies {
+		foundPolicy = foundPolicy || policy.ID == policyID
+	}
+	if !foundPolicy {
+		t.Error("Expected the policy in the snapshot")
+	}
+
+	dir, err := ioutil.TempDir("", "tyk-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("store", func(t *testing.T) {
+		_, _ = ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/tyk/backup?store=true", AdminAuth: true, Code: http.StatusBadRequest})
+
+		globalConf := config.Global()
+		globalConf.Backup.Path = dir
+		config.SetGlobal(globalConf)
+
+		_, _ = ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/tyk/backup?store=true", AdminAuth: true, Code: http.StatusOK,
+			BodyMatch: `"apis":2`})
+		if stored, _ := filepath.Glob(filepath.Join(dir, "tyk-backup-*.tar.gz")); len(stored) != 1 {
+			t.Errorf("Expected the snapshot to be stored, got %v", stored)
+		}
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		appPath := filepath.Join(dir, "apps")
+		os.Mkdir(appPath, 0755)
+		policyFile := filepath.Join(dir, "policies.json")
+
+		globalConf := config.Global()
+		globalConf.AppPath = appPath
+		globalConf.Policies.PolicySource = "file"
+		globalConf.Policies.PolicyRecordName = policyFile
+		config.SetGlobal(globalConf)
+
+		var invalid bytes.Buffer
+		snap.APIs = append(snap.APIs, &apidef.APIDefinition{APIID: `invalid\id`})
+		writeSnapshot(&invalid, snap)
+
+		_, _ = ts.Run(t, []test.TestCase{
+			{Method: http.MethodPost, Path: "/tyk/restore", Data: "not a snapshot", AdminAuth: true, Code: http.StatusBadRequest},
+			{Method: http.MethodPost, Path: "/tyk/restore", Data: invalid.Bytes(), AdminAuth: true, Code: http.StatusBadRequest},
+		}...)
+		if files, _ := ioutil.ReadDir(appPath); len(files) != 0 {
+			t.Fatalf("Expected an invalid snapshot to write nothing, got %d files", len(files))
+		}
+
+		_, _ = ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/tyk/restore", Data: backup, AdminAuth: true, Code: http.StatusOK,
+			BodyMatch: `"policies_restored":true`})
+
+		for _, name := range []string{"backup-a.json", "backup-b.json"} {
+			if _, err := os.Stat(filepath.Join(appPath, name)); err != nil {
+				t.Error("Expected the API definition to be restored:", err)
+			}
+		}
+		if policies := LoadPoliciesFromFile(policyFile); policies[policyID].ID != policyID {
+			t.Error("Expected the policy to be restored")
+		}
+	})
+}
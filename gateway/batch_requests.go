@@ -92,7 +92,7 @@ func (b *BatchRequestHandler) DecodeBatchRequest(r *http.Request) (BatchRequestS
 
 func (b *BatchRequestHandler) ConstructRequests(batchRequest BatchRequestStructure, unsafe bool) ([]*http.Request, error) {
 	requestSet := []*http.Request{}
-	ignoreCanonical := config.Global().IgnoreCanonicalMIMEHeaderKey
+	casing := b.API.headerCasing()
 	for i, requestDef := range batchRequest.Requests {
 		// We re-build the URL to ensure that the requested URL is actually for the API in question
 		// URLs need to be built absolute so they go through the rate limiting and request limiting machinery
@@ -112,7 +112,7 @@ func (b *BatchRequestHandler) ConstructRequests(batchRequest BatchRequestStructu
 
 		// Add headers
 		for k, v := range requestDef.Headers {
-			setCustomHeader(request.Header, k, v, ignoreCanonical)
+			setCustomHeader(request.Header, k, v, casing)
 		}
 		requestSet = append(requestSet, request)
 	}
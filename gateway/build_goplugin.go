@@ -0,0 +1,7 @@
+// +build goplugin
+
+package gateway
+
+func init() {
+	registerBuildTag("goplugin")
+}
@@ -0,0 +1,103 @@
+package gateway
+
+import (
+	"net/http"
+	"runtime"
+	"sort"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+// buildTags are the optional features the gateway was built with, registered
+// by the files behind their build tags.
+var buildTags []string
+
+func registerBuildTag(tag string) {
+	buildTags = append(buildTags, tag)
+}
+
+type buildInfo struct {
+	Version       string            `json:"version"`
+	Commit        string            `json:"commit"`
+	BuildDate     string            `json:"build_date"`
+	BuiltBy       string            `json:"built_by"`
+	GoVersion     string            `json:"go_version"`
+	OS            string            `json:"os"`
+	Arch          string            `json:"arch"`
+	NodeID        string            `json:"node_id"`
+	BuildTags     []string          `json:"build_tags"`
+	PluginDrivers pluginDriversInfo `json:"plugin_drivers"`
+	Storage       storageInfo       `json:"storage"`
+}
+
+type pluginDriversInfo struct {
+	// Supported are the drivers custom middleware can use on this node.
+	Supported []string `json:"supported"`
+	// Loaded are the coprocess drivers which are running.
+	Loaded []string `json:"loaded"`
+}
+
+type storageInfo struct {
+	Type      string `json:"type"`
+	Cluster   bool   `json:"cluster"`
+	Sentinel  bool   `json:"sentinel"`
+	TLS       bool   `json:"tls"`
+	Database  int    `json:"database"`
+	Connected bool   `json:"connected"`
+	RPC       bool   `json:"rpc"`
+}
+
+func getBuildInfo() buildInfo {
+	conf := config.Global()
+
+	tags := append([]string{}, buildTags...)
+	sort.Strings(tags)
+
+	drivers := pluginDriversInfo{Supported: []string{}, Loaded: []string{}}
+	if conf.EnableJSVM {
+		drivers.Supported = append(drivers.Supported, "otto")
+	}
+	if contains(buildTags, "goplugin") {
+		drivers.Supported = append(drivers.Supported, "goplugin")
+	}
+	if conf.CoProcessOptions.EnableCoProcess {
+		for _, driver := range supportedDrivers {
+			drivers.Supported = append(drivers.Supported, string(driver))
+		}
+	}
+	for driver, dispatcher := range loadedDrivers {
+		if dispatcher != nil {
+			drivers.Loaded = append(drivers.Loaded, string(driver))
+		}
+	}
+	sort.Strings(drivers.Loaded)
+
+	return buildInfo{
+		Version:       VERSION,
+		Commit:        Commit,
+		BuildDate:     buildDate,
+		BuiltBy:       builtBy,
+		GoVersion:     runtime.Version(),
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		NodeID:        GetNodeID(),
+		BuildTags:     tags,
+		PluginDrivers: drivers,
+		Storage: storageInfo{
+			Type:      conf.Storage.Type,
+			Cluster:   conf.Storage.EnableCluster,
+			Sentinel:  conf.Storage.MasterName != "",
+			TLS:       conf.Storage.UseSSL,
+			Database:  conf.Storage.Database,
+			Connected: storage.Connected(),
+			RPC:       isRPCMode(),
+		},
+	}
+}
+
+// buildInfoHandler reports what the node was built with and can run, so
+// that automation can check its capabilities before sending it APIs.
+func buildInfoHandler(w http.ResponseWriter, r *http.Request) {
+	doJSONWrite(w, http.StatusOK, getBuildInfo())
+}
@@ -0,0 +1,29 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestBuildInfo(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/tyk/info", Code: http.StatusForbidden},
+		{Path: "/tyk/info", AdminAuth: true, Code: http.StatusOK,
+			BodyMatchFunc: func(body []byte) bool {
+				var info buildInfo
+				if err := json.Unmarshal(body, &info); err != nil {
+					t.Error(err)
+					return false
+				}
+				return info.Version == VERSION && info.GoVersion == runtime.Version() &&
+					info.Storage.Type == "redis" && info.BuildTags != nil
+			}},
+	}...)
+}
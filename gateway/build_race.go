@@ -0,0 +1,7 @@
+// +build race
+
+package gateway
+
+func init() {
+	registerBuildTag("race")
+}
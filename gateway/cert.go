@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net"
@@ -273,31 +274,7 @@ var tlsConfigMu sync.Mutex
 
 func getTLSConfigForClient(baseConfig *tls.Config, listenPort int) func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
 	// Supporting legacy certificate configuration
-	serverCerts := []tls.Certificate{}
-	certNameMap := map[string]*tls.Certificate{}
-
-	for _, certData := range config.Global().HttpServerOptions.Certificates {
-		cert, err := tls.LoadX509KeyPair(certData.CertFile, certData.KeyFile)
-		if err != nil {
-			log.Errorf("Server error: loadkeys: %s", err)
-			continue
-		}
-		serverCerts = append(serverCerts, cert)
-		certNameMap[certData.Name] = &cert
-	}
-
-	for _, cert := range CertificateManager.List(config.Global().HttpServerOptions.SSLCertificates, certs.CertificatePrivate) {
-		if cert != nil {
-			serverCerts = append(serverCerts, *cert)
-		}
-	}
-
-	baseConfig.Certificates = serverCerts
-	baseConfig.BuildNameToCertificate()
-
-	for name, cert := range certNameMap {
-		baseConfig.NameToCertificate[name] = cert
-	}
+	initServerCertificates()
 
 	listenPortStr := strconv.Itoa(listenPort)
 
@@ -309,12 +286,13 @@ func getTLSConfigForClient(baseConfig *tls.Config, listenPort int) func(hello *t
 		newConfig := baseConfig.Clone()
 
 		// Avoiding Race
+		serverCerts := getServerCertificates()
 		newConfig.Certificates = []tls.Certificate{}
-		for _, cert := range baseConfig.Certificates {
+		for _, cert := range serverCerts.certs {
 			newConfig.Certificates = append(newConfig.Certificates, cert)
 		}
 		newConfig.BuildNameToCertificate()
-		for name, cert := range certNameMap {
+		for name, cert := range serverCerts.names {
 			newConfig.NameToCertificate[name] = cert
 		}
 
@@ -410,6 +388,54 @@ func getTLSConfigForClient(baseConfig *tls.Config, listenPort int) func(hello *t
 	}
 }
 
+// certMetadataFromQuery reads the metadata given along with added
+// certificates, and reports whether any was given.
+func certMetadataFromQuery(query url.Values) (certs.CertificateMetadata, bool) {
+	meta := certs.CertificateMetadata{
+		Name:  query.Get("name"),
+		Owner: query.Get("owner"),
+		Notes: query.Get("notes"),
+	}
+	if tags := query.Get("tags"); tags != "" {
+		meta.Tags = strings.Split(tags, ",")
+	}
+	return meta, meta.Name != "" || meta.Owner != "" || meta.Notes != "" || len(meta.Tags) > 0
+}
+
+// addCertificate adds a certificate along with its metadata, if any.
+func addCertificate(content []byte, orgID string, meta certs.CertificateMetadata, hasMeta bool) (string, error) {
+	certID, err := CertificateManager.Add(content, orgID)
+	if err != nil {
+		return "", err
+	}
+	if hasMeta {
+		if err := CertificateManager.SetMetadata(certID, meta); err != nil {
+			return certID, err
+		}
+	}
+	return certID, nil
+}
+
+// addCertificateBundle adds each certificate of a PEM bundle on its own, and
+// reports the outcome for each one.
+func addCertificateBundle(content []byte, orgID string, meta certs.CertificateMetadata, hasMeta bool) ([]APICertificateStatusMessage, error) {
+	bundle, err := certs.SplitPEMBundle(content)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]APICertificateStatusMessage, 0, len(bundle))
+	for _, certPEM := range bundle {
+		certID, err := addCertificate(certPEM, orgID, meta, hasMeta)
+		if err != nil {
+			statuses = append(statuses, APICertificateStatusMessage{certID, "error", err.Error()})
+			continue
+		}
+		statuses = append(statuses, APICertificateStatusMessage{certID, "ok", "Certificate added"})
+	}
+	return statuses, nil
+}
+
 func certHandler(w http.ResponseWriter, r *http.Request) {
 	certID := mux.Vars(r)["certID"]
 
@@ -422,18 +448,57 @@ func certHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		orgID := r.URL.Query().Get("org_id")
+		meta, hasMeta := certMetadataFromQuery(r.URL.Query())
+
+		// A bulk upload adds each certificate of the bundle on its own
+		// instead of as a chain.
+		if r.URL.Query().Get("bulk") == "true" {
+			statuses, err := addCertificateBundle(content, orgID, meta, hasMeta)
+			if err != nil {
+				doJSONWrite(w, http.StatusForbidden, apiError(err.Error()))
+				return
+			}
+			doJSONWrite(w, http.StatusOK, statuses)
+			return
+		}
+
 		var certID string
-		if certID, err = CertificateManager.Add(content, orgID); err != nil {
+		if certID, err = addCertificate(content, orgID, meta, hasMeta); err != nil {
 			doJSONWrite(w, http.StatusForbidden, apiError(err.Error()))
 			return
 		}
 
 		doJSONWrite(w, http.StatusOK, &APICertificateStatusMessage{certID, "ok", "Certificate added"})
+	case "PUT":
+		var meta certs.CertificateMetadata
+		if err := json.NewDecoder(r.Body).Decode(&meta); err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+			return
+		}
+		if err := CertificateManager.SetMetadata(certID, meta); err != nil {
+			doJSONWrite(w, http.StatusNotFound, apiError(err.Error()))
+			return
+		}
+		doJSONWrite(w, http.StatusOK, &APICertificateStatusMessage{certID, "ok", "Certificate metadata updated"})
 	case "GET":
 		if certID == "" {
-			orgID := r.URL.Query().Get("org_id")
+			query := r.URL.Query()
+			orgID := query.Get("org_id")
 
 			certIds := CertificateManager.ListAllIds(orgID)
+
+			// Filter by metadata
+			name, owner, tag := query.Get("name"), query.Get("owner"), query.Get("tag")
+			if name != "" || owner != "" || tag != "" {
+				var matching []string
+				for _, id := range certIds {
+					if meta, ok := CertificateManager.GetMetadata(id); ok && meta.Matches(name, owner, tag) {
+						matching = append(matching, id)
+					}
+				}
+				certIds = matching
+			}
+
 			doJSONWrite(w, http.StatusOK, &APIAllCertificates{certIds})
 			return
 		}
@@ -447,13 +512,13 @@ func certHandler(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			doJSONWrite(w, http.StatusOK, certs.ExtractCertificateMeta(certificates[0], certIDs[0]))
+			doJSONWrite(w, http.StatusOK, extractCertificateMeta(certificates[0], certIDs[0]))
 			return
 		} else {
 			var meta []*certs.CertificateMeta
 			for ci, cert := range certificates {
 				if cert != nil {
-					meta = append(meta, certs.ExtractCertificateMeta(cert, certIDs[ci]))
+					meta = append(meta, extractCertificateMeta(cert, certIDs[ci]))
 				} else {
 					meta = append(meta, nil)
 				}
@@ -472,6 +537,15 @@ func certHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// extractCertificateMeta describes a certificate along with its metadata.
+func extractCertificateMeta(cert *tls.Certificate, certID string) *certs.CertificateMeta {
+	meta := certs.ExtractCertificateMeta(cert, certID)
+	if metadata, ok := CertificateManager.GetMetadata(certID); ok {
+		meta.Metadata = &metadata
+	}
+	return meta
+}
+
 func getCipherAliases(ciphers []string) (cipherCodes []uint16) {
 	for k, v := range cipherSuites {
 		for _, str := range ciphers {
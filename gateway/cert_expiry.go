@@ -0,0 +1,263 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/certs"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+const (
+	certExpiryDefaultWindow        = 30
+	certExpiryDefaultCheckInterval = time.Hour
+
+	certUsageClient   = "client"
+	certUsageUpstream = "upstream"
+)
+
+var certExpiryDefaultWarningDays = []int{30, 7, 1}
+
+// expiringCertificate is a certificate used by APIs, either to verify client
+// certificates or to connect to upstreams. DaysToExpiry is negative once the
+// certificate has expired. APIIDs is empty for upstream certificates set in
+// the gateway configuration.
+// swagger:model
+type expiringCertificate struct {
+	ID           string    `json:"id"`
+	Subject      string    `json:"subject"`
+	NotAfter     time.Time `json:"not_after"`
+	DaysToExpiry int       `json:"days_to_expiry"`
+	Usages       []string  `json:"usages"`
+	APIIDs       []string  `json:"api_ids"`
+}
+
+// certExpiryReport lists the certificates expiring within a number of days,
+// the soonest first.
+// swagger:model
+type certExpiryReport struct {
+	Within       int                   `json:"within"`
+	Count        int                   `json:"count"`
+	Certificates []expiringCertificate `json:"certificates"`
+}
+
+func addCertUsage(used map[string]*expiringCertificate, certID, usage, apiID string) {
+	cert, ok := used[certID]
+	if !ok {
+		cert = &expiringCertificate{ID: certID, Usages: []string{}, APIIDs: []string{}}
+		used[certID] = cert
+	}
+
+	if !contains(cert.Usages, usage) {
+		cert.Usages = append(cert.Usages, usage)
+	}
+	if apiID != "" && !contains(cert.APIIDs, apiID) {
+		cert.APIIDs = append(cert.APIIDs, apiID)
+	}
+}
+
+// usedCertificates returns the client CA and upstream certificates used by
+// the loaded APIs and by the gateway configuration, by ID.
+func usedCertificates() map[string]*expiringCertificate {
+	used := map[string]*expiringCertificate{}
+
+	apisMu.RLock()
+	for _, spec := range apisByID {
+		for _, certID := range spec.ClientCertificates {
+			addCertUsage(used, certID, certUsageClient, spec.APIID)
+		}
+		for _, certID := range spec.UpstreamCertificates {
+			addCertUsage(used, certID, certUsageUpstream, spec.APIID)
+		}
+	}
+	apisMu.RUnlock()
+
+	for _, certID := range config.Global().Security.Certificates.Upstream {
+		addCertUsage(used, certID, certUsageUpstream, "")
+	}
+
+	return used
+}
+
+// buildCertExpiryReport reports the used certificates that expire within the
+// given number of days, including the ones that have already expired.
+// Certificates that cannot be loaded are left out.
+func buildCertExpiryReport(within int) certExpiryReport {
+	report := certExpiryReport{
+		Within:       within,
+		Certificates: []expiringCertificate{},
+	}
+
+	used := usedCertificates()
+	ids := make([]string, 0, len(used))
+	for id := range used {
+		ids = append(ids, id)
+	}
+
+	now := time.Now()
+	for i, tlsCert := range CertificateManager.List(ids, certs.CertificateAny) {
+		if tlsCert == nil || tlsCert.Leaf == nil || tlsCert.Leaf.NotAfter.IsZero() {
+			continue
+		}
+
+		cert := used[ids[i]]
+		cert.Subject = tlsCert.Leaf.Subject.CommonName
+		cert.NotAfter = tlsCert.Leaf.NotAfter
+		cert.DaysToExpiry = daysToExpiry(now, cert.NotAfter)
+		if cert.DaysToExpiry > within {
+			continue
+		}
+
+		sort.Strings(cert.Usages)
+		sort.Strings(cert.APIIDs)
+		report.Certificates = append(report.Certificates, *cert)
+	}
+
+	sort.Slice(report.Certificates, func(i, j int) bool {
+		if !report.Certificates[i].NotAfter.Equal(report.Certificates[j].NotAfter) {
+			return report.Certificates[i].NotAfter.Before(report.Certificates[j].NotAfter)
+		}
+		return report.Certificates[i].ID < report.Certificates[j].ID
+	})
+	report.Count = len(report.Certificates)
+
+	return report
+}
+
+// daysToExpiry counts the whole days left before notAfter, rounding down.
+func daysToExpiry(now, notAfter time.Time) int {
+	left := notAfter.Sub(now)
+	days := int(left / (24 * time.Hour))
+	if left < 0 && left%(24*time.Hour) != 0 {
+		days--
+	}
+	return days
+}
+
+// certExpiryWarningDay returns the shortest lead time that the certificate is
+// within, and false if it is within none.
+func certExpiryWarningDay(daysLeft int, warningDays []int) (int, bool) {
+	lead, found := 0, false
+	for _, days := range warningDays {
+		if daysLeft <= days && (!found || days < lead) {
+			lead, found = days, true
+		}
+	}
+	return lead, found
+}
+
+// checkCertificateExpiry fires a CertificateExpiring event for each used
+// certificate that enters one of the lead times, to the APIs using it and to
+// the gateway event handlers. Each lead time fires once per certificate
+// across the cluster.
+func checkCertificateExpiry(warningDays []int) {
+	longest := 0
+	for _, days := range warningDays {
+		if days > longest {
+			longest = days
+		}
+	}
+
+	lock := &storage.RedisCluster{}
+	for _, cert := range buildCertExpiryReport(longest).Certificates {
+		lead, ok := certExpiryWarningDay(cert.DaysToExpiry, warningDays)
+		if !ok {
+			continue
+		}
+
+		// The lock outlives the lead time, so that the event is not
+		// fired again for it.
+		lockKey := "cert-expiry-" + cert.ID + "-" + strconv.Itoa(lead)
+		if lock.IncrememntWithExpire(lockKey, int64(lead+1)*24*3600) != 1 {
+			continue
+		}
+
+		meta := EventCertificateExpiringMeta{
+			EventMetaDefault: EventMetaDefault{
+				Message: fmt.Sprintf("Certificate %s expires in %d days", cert.ID, cert.DaysToExpiry),
+			},
+			Certificate: cert,
+		}
+		if cert.DaysToExpiry < 0 {
+			meta.Message = fmt.Sprintf("Certificate %s has expired", cert.ID)
+		}
+
+		for _, apiID := range cert.APIIDs {
+			if spec := getApiSpec(apiID); spec != nil {
+				spec.FireEvent(EventCertificateExpiring, meta)
+			}
+		}
+		FireSystemEvent(EventCertificateExpiring, meta)
+
+		log.WithFields(logrus.Fields{
+			"prefix":  "cert_storage",
+			"cert_id": cert.ID,
+			"days":    cert.DaysToExpiry,
+		}).Warning("Certificate is about to expire")
+	}
+}
+
+// certExpiryLoop checks the used certificates every interval.
+func certExpiryLoop(ctx context.Context, conf config.CertificateExpiryConfig) {
+	warningDays := conf.WarningDays
+	if len(warningDays) == 0 {
+		warningDays = certExpiryDefaultWarningDays
+	}
+
+	interval := certExpiryDefaultCheckInterval
+	if conf.CheckInterval > 0 {
+		interval = time.Duration(conf.CheckInterval) * time.Second
+	}
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		checkCertificateExpiry(warningDays)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// List certificates about to expire
+// Lists the client CA and upstream certificates used by the loaded APIs, and
+// the upstream certificates of the gateway configuration, that expire within
+// a number of days, the soonest first. Expired certificates are included. The
+// number of days defaults to 30.
+//
+//---
+// parameters:
+// - name: within
+//   in: query
+//   type: integer
+// responses:
+//   200:
+//     description: Certificates expiring within the number of days
+//     schema:
+//       "$ref": "#/definitions/certExpiryReport"
+//   400:
+//     description: Invalid number of days
+func expiringCertsHandler(w http.ResponseWriter, r *http.Request) {
+	within := certExpiryDefaultWindow
+	if value := r.URL.Query().Get("within"); value != "" {
+		var err error
+		within, err = strconv.Atoi(value)
+		if err != nil || within < 0 {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Invalid within number of days"))
+			return
+		}
+	}
+
+	doJSONWrite(w, http.StatusOK, buildCertExpiryReport(within))
+}
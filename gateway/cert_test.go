@@ -7,6 +7,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
@@ -1128,6 +1129,28 @@ func TestCertificateHandlerTLS(t *testing.T) {
 			{Method: "GET", Path: "/tyk/certs?org_id=1", AdminAuth: true, Code: 200, BodyMatch: `{"certs":null}`},
 		}...)
 	})
+
+	t.Run("Bulk upload and metadata", func(t *testing.T) {
+		bundle := string(clientPEM) + "\n" + string(combinedServerPEM)
+		clientID, serverID := "2"+clientCertID, "2"+serverCertID
+		defer CertificateManager.Delete(clientID, "2")
+		defer CertificateManager.Delete(serverID, "2")
+
+		ts.Run(t, []test.TestCase{
+			{Method: "POST", Path: "/tyk/certs?org_id=2&bulk=true&name=partner&tags=mtls,prod&owner=ops", Data: bundle, AdminAuth: true, Code: 200,
+				BodyMatch: `\[{"id":"` + clientID + `","status":"ok","message":"Certificate added"},{"id":"` + serverID + `","status":"ok"`},
+			// Already added
+			{Method: "POST", Path: "/tyk/certs?org_id=2&bulk=true", Data: string(clientPEM), AdminAuth: true, Code: 200, BodyMatch: `"status":"error"`},
+			{Method: "POST", Path: "/tyk/certs?org_id=2&bulk=true", Data: "not a bundle", AdminAuth: true, Code: 403},
+			{Method: "GET", Path: "/tyk/certs/" + clientID, AdminAuth: true, Code: 200,
+				BodyMatch: `"metadata":{"name":"partner","tags":\["mtls","prod"\],"owner":"ops"}`},
+			{Method: "PUT", Path: "/tyk/certs/" + serverID, Data: `{"name":"server","tags":["staging"],"notes":"renew yearly"}`, AdminAuth: true, Code: 200},
+			{Method: "PUT", Path: "/tyk/certs/missing", Data: `{"name":"server"}`, AdminAuth: true, Code: 404},
+			{Method: "GET", Path: "/tyk/certs?org_id=2&tag=prod", AdminAuth: true, Code: 200, BodyMatch: `{"certs":\["` + clientID + `"\]}`},
+			{Method: "GET", Path: "/tyk/certs?org_id=2&name=server", AdminAuth: true, Code: 200, BodyMatch: `{"certs":\["` + serverID + `"\]}`},
+			{Method: "GET", Path: "/tyk/certs?org_id=2&owner=nobody", AdminAuth: true, Code: 200, BodyMatch: `{"certs":null}`},
+		}...)
+	})
 }
 
 func TestCipherSuites(t *testing.T) {
@@ -1174,3 +1197,83 @@ func TestCipherSuites(t *testing.T) {
 		ts.Run(t, test.TestCase{Client: client, Path: "/", ErrorMatch: "tls: handshake failure"})
 	})
 }
+
+func TestCertificateExpiry(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	clientPEM, _, _, _ := genCertificate(&x509.Certificate{Subject: pkix.Name{CommonName: "client-ca"}})
+	clientCertID, _ := CertificateManager.Add(clientPEM, "")
+	defer CertificateManager.Delete(clientCertID, "")
+
+	_, _, upstreamPEM, _ := genCertificate(&x509.Certificate{Subject: pkix.Name{CommonName: "upstream"}})
+	upstreamCertID, _ := CertificateManager.Add(upstreamPEM, "")
+	defer CertificateManager.Delete(upstreamCertID, "")
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.ClientCertificates = []string{clientCertID}
+		spec.UpstreamCertificates = map[string]string{"*": upstreamCertID}
+	})
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/tyk/certs/expiring", AdminAuth: true, Code: http.StatusOK, BodyMatchFunc: func(body []byte) bool {
+			var report certExpiryReport
+			if err := json.Unmarshal(body, &report); err != nil {
+				t.Error(err)
+				return false
+			}
+			if report.Within != certExpiryDefaultWindow || report.Count != 2 {
+				return false
+			}
+			for _, cert := range report.Certificates {
+				if cert.DaysToExpiry != 0 || len(cert.APIIDs) != 1 || cert.APIIDs[0] != "test" {
+					return false
+				}
+				switch cert.ID {
+				case clientCertID:
+					if cert.Subject != "client-ca" || cert.Usages[0] != certUsageClient {
+						return false
+					}
+				case upstreamCertID:
+					if cert.Subject != "upstream" || cert.Usages[0] != certUsageUpstream {
+						return false
+					}
+				default:
+					return false
+				}
+			}
+			return true
+		}},
+		{Path: "/tyk/certs/expiring?within=-1", AdminAuth: true, Code: http.StatusBadRequest},
+	}...)
+
+	events := make(chan EventCertificateExpiringMeta, 4)
+	spec := getApiSpec("test")
+	spec.EventPaths = map[apidef.TykEvent][]config.TykEventHandler{
+		EventCertificateExpiring: {&testEventHandler{func(em config.EventMessage) {
+			events <- em.Meta.(EventCertificateExpiringMeta)
+		}}},
+	}
+
+	// Each lead time fires once per certificate
+	checkCertificateExpiry([]int{30, 1})
+	checkCertificateExpiry([]int{30, 1})
+
+	fired := map[string]int{}
+	for i := 0; i < 2; i++ {
+		select {
+		case meta := <-events:
+			fired[meta.Certificate.ID]++
+		case <-time.After(time.Second):
+			t.Fatal("Expected a CertificateExpiring event for each certificate, got: ", fired)
+		}
+	}
+	select {
+	case meta := <-events:
+		t.Error("Expected no more events, got one for: ", meta.Certificate.ID)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if fired[clientCertID] != 1 || fired[upstreamCertID] != 1 {
+		t.Error("Expected one event per certificate, got: ", fired)
+	}
+}
@@ -0,0 +1,42 @@
+package gateway
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/request"
+)
+
+// ipNets is a list of networks, such as trusted proxies or allowed clients.
+type ipNets []*net.IPNet
+
+// parseIPNet parses a CIDR, or a single IP.
+func parseIPNet(s string) (*net.IPNet, error) {
+	return request.ParseIPNet(s)
+}
+
+func (n ipNets) contains(ip net.IP) bool {
+	for _, ipNet := range n {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedClientIP returns the IP of the client of a request. Requests from
+// trusted proxies are traced back through their forwarding header, from the
+// closest hop, to the first hop that isn't trusted. Without trusted proxies
+// of its own, the client_ip configuration applies.
+func forwardedClientIP(r *http.Request, trusted ipNets) net.IP {
+	resolver := request.ConfiguredClientIPResolver()
+	if len(trusted) > 0 || resolver == nil {
+		forwardingHeader := headers.XForwardFor
+		if resolver != nil {
+			forwardingHeader = resolver.Header
+		}
+		resolver = &request.ClientIPResolver{TrustedProxies: trusted, Header: forwardingHeader}
+	}
+	return resolver.ClientIP(r)
+}
@@ -0,0 +1,167 @@
+package gateway
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+var defaultCompressionAlgorithms = []string{"br", "gzip"}
+
+// bodyDecoder returns a reader decoding body according to the given content
+// encoding, or nil if the encoding isn't supported.
+func bodyDecoder(encoding string, body io.Reader) (io.Reader, error) {
+	switch strings.ToLower(encoding) {
+	case "gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		return flate.NewReader(body), nil
+	case "br":
+		return brotli.NewReader(body), nil
+	}
+	return nil, nil
+}
+
+type decodedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// decompressResponse replaces a compressed upstream response body with its
+// decoded content, so that response middleware sees the plain payload.
+func decompressResponse(res *http.Response) error {
+	if res.ContentLength == 0 || res.StatusCode == http.StatusNoContent || res.StatusCode == http.StatusNotModified {
+		return nil
+	}
+
+	reader, err := bodyDecoder(res.Header.Get(headers.ContentEncoding), res.Body)
+	if err != nil || reader == nil {
+		return err
+	}
+
+	res.Body = decodedBody{Reader: reader, Closer: res.Body}
+	res.Header.Del(headers.ContentEncoding)
+	res.Header.Del(headers.ContentLength)
+	res.ContentLength = -1
+	res.Uncompressed = true
+
+	return nil
+}
+
+// compressResponse compresses an identity encoded response body using the
+// preferred algorithm accepted by the client.
+func compressResponse(req *http.Request, res *http.Response, conf apidef.CompressionConfig) {
+	if enc := res.Header.Get(headers.ContentEncoding); enc != "" && enc != "identity" {
+		return
+	}
+	if req.Method == http.MethodHead || res.StatusCode == http.StatusNoContent || res.StatusCode == http.StatusNotModified {
+		return
+	}
+	if res.ContentLength == 0 || (res.ContentLength > 0 && res.ContentLength < conf.MinSize) {
+		return
+	}
+	if !compressibleContentType(res.Header.Get(headers.ContentType), conf.ContentTypes) {
+		return
+	}
+
+	algorithms := conf.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = defaultCompressionAlgorithms
+	}
+	encoding := negotiateEncoding(req.Header.Get(headers.AcceptEncoding), algorithms)
+	if encoding == "" {
+		return
+	}
+
+	body := res.Body
+	pr, pw := io.Pipe()
+	go func() {
+		var zw io.WriteCloser
+		if encoding == "br" {
+			zw = brotli.NewWriter(pw)
+		} else {
+			zw = gzip.NewWriter(pw)
+		}
+
+		_, err := io.Copy(zw, body)
+		if closeErr := zw.Close(); err == nil {
+			err = closeErr
+		}
+		body.Close()
+		pw.CloseWithError(err)
+	}()
+
+	// the header map may be shared with the cached copy of the response
+	res.Header = res.Header.Clone()
+	res.Header.Set(headers.ContentEncoding, encoding)
+	res.Header.Add(headers.Vary, headers.AcceptEncoding)
+	res.Header.Del(headers.ContentLength)
+	res.ContentLength = -1
+	res.Body = pr
+}
+
+// negotiateEncoding picks the first algorithm accepted by the client.
+func negotiateEncoding(acceptEncoding string, algorithms []string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		accepted[name] = q > 0
+	}
+
+	for _, algorithm := range algorithms {
+		algorithm = strings.ToLower(algorithm)
+		if algorithm != "br" && algorithm != "gzip" {
+			continue
+		}
+		if ok, found := accepted[algorithm]; ok || (!found && accepted["*"]) {
+			return algorithm
+		}
+	}
+
+	return ""
+}
+
+// compressibleContentType reports whether the media type matches one of the
+// configured types, which may use a "type/*" wildcard.
+func compressibleContentType(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, t := range allowed {
+		t = strings.ToLower(t)
+		if t == mediaType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1])) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,92 @@
+package gateway
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	for _, tc := range []struct {
+		accept     string
+		algorithms []string
+		want       string
+	}{
+		{"", defaultCompressionAlgorithms, ""},
+		{"gzip, deflate", defaultCompressionAlgorithms, "gzip"},
+		{"gzip, br", defaultCompressionAlgorithms, "br"},
+		{"gzip, br;q=0", defaultCompressionAlgorithms, "gzip"},
+		{"*", []string{"gzip"}, "gzip"},
+		{"*, gzip;q=0", []string{"gzip", "br"}, "br"},
+		{"deflate", defaultCompressionAlgorithms, ""},
+	} {
+		if got := negotiateEncoding(tc.accept, tc.algorithms); got != tc.want {
+			t.Errorf("negotiateEncoding(%q, %v) = %q, want %q", tc.accept, tc.algorithms, got, tc.want)
+		}
+	}
+}
+
+func TestCompressibleContentType(t *testing.T) {
+	allowed := []string{"application/json", "text/*"}
+
+	if !compressibleContentType("application/json; charset=utf-8", allowed) {
+		t.Error("Expected JSON to be compressible")
+	}
+	if !compressibleContentType("text/html", allowed) {
+		t.Error("Expected wildcard to match")
+	}
+	if compressibleContentType("image/png", allowed) {
+		t.Error("Image should not be compressible")
+	}
+	if !compressibleContentType("image/png", nil) {
+		t.Error("All types should be compressible without filter")
+	}
+}
+
+func TestResponseCompression(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	t.Run("Compress identity responses", func(t *testing.T) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/"
+			spec.Compression = apidef.CompressionConfig{Enabled: true, MinSize: 10}
+		})
+
+		ts.Run(t, []test.TestCase{
+			{Path: "/get", Headers: map[string]string{"Accept-Encoding": "br"}, Code: 200,
+				HeadersMatch: map[string]string{"Content-Encoding": "br", "Vary": "Accept-Encoding"},
+				BodyMatchFunc: func(body []byte) bool {
+					decoded, err := ioutil.ReadAll(brotli.NewReader(bytes.NewReader(body)))
+					return err == nil && bytes.Contains(decoded, []byte(`"Url":"/get"`))
+				}},
+			{Path: "/get", Headers: map[string]string{"Accept-Encoding": "deflate"}, Code: 200,
+				HeadersNotMatch: map[string]string{"Content-Encoding": "deflate"}, BodyMatch: `"Url":"/get"`},
+		}...)
+	})
+
+	t.Run("Content type filter", func(t *testing.T) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/"
+			spec.Compression = apidef.CompressionConfig{Enabled: true, ContentTypes: []string{"text/html"}}
+		})
+
+		ts.Run(t, test.TestCase{Path: "/get", Headers: map[string]string{"Accept-Encoding": "gzip"}, Code: 200,
+			HeadersNotMatch: map[string]string{"Content-Encoding": "gzip"}, BodyMatch: `"Url":"/get"`})
+	})
+
+	t.Run("Decompress upstream", func(t *testing.T) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/"
+			spec.Compression = apidef.CompressionConfig{DecompressUpstream: true}
+		})
+
+		ts.Run(t, test.TestCase{Path: "/compressed", Headers: map[string]string{"Accept-Encoding": "gzip"}, Code: 200,
+			HeadersNotMatch: map[string]string{"Content-Encoding": "gzip"}, BodyMatch: "This is a compressed response"})
+	})
+}
@@ -0,0 +1,464 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/TykTechnologies/gojsonschema"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/certs"
+	"github.com/TykTechnologies/tyk/cli/linter"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/regexp"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const (
+	configCheckSchema      = "schema"
+	configCheckUpstreamURL = "upstream_url"
+	configCheckListenPath  = "listen_path"
+	configCheckCertificate = "certificate"
+	configCheckSecret      = "secret"
+)
+
+// configSchemaPath is the JSON schema of the gateway configuration, as used
+// by the lint command.
+var configSchemaPath = "cli/linter/schema.json"
+
+// configIssue is a problem found in one of the configuration files. Source is
+// the file, Field the JSON path of the value in it, if any.
+// swagger:model
+type configIssue struct {
+	Source  string `json:"source"`
+	Field   string `json:"field,omitempty"`
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// configValidationReport is the result of the validation of the gateway
+// configuration, API definitions and policies. Valid is false if there are
+// errors, warnings are checks that couldn't be made or settings that are
+// likely mistakes.
+// swagger:model
+type configValidationReport struct {
+	Valid    bool          `json:"valid"`
+	Config   string        `json:"config"`
+	APIs     int           `json:"apis"`
+	Policies int           `json:"policies"`
+	Errors   []configIssue `json:"errors"`
+	Warnings []configIssue `json:"warnings"`
+}
+
+func (r *configValidationReport) errorf(source, field, check, format string, args ...interface{}) {
+	r.Errors = append(r.Errors, configIssue{Source: source, Field: field, Check: check, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *configValidationReport) warnf(source, field, check, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, configIssue{Source: source, Field: field, Check: check, Message: fmt.Sprintf(format, args...)})
+}
+
+// validateConfig checks the configuration file of conf, the API definitions
+// of its app path and its policy file. Secret placeholders are resolved with
+// the global configuration.
+func validateConfig(conf config.Config) configValidationReport {
+	report := configValidationReport{
+		Config:   conf.OriginalPath,
+		Errors:   []configIssue{},
+		Warnings: []configIssue{},
+	}
+
+	validateConfigFile(&report, conf)
+
+	apiIDs := map[string]bool{}
+	if conf.UseDBAppConfigs {
+		report.warnf(conf.OriginalPath, "use_db_app_configs", configCheckSchema, "API definitions are loaded from the Dashboard, app_path was not checked")
+	} else {
+		for _, def := range validateAPIDefinitionFiles(&report, conf.AppPath) {
+			apiIDs[def.APIID] = true
+		}
+	}
+
+	switch {
+	case conf.Policies.PolicySource == "service", conf.Policies.PolicySource == "rpc":
+		report.warnf(conf.OriginalPath, "policies.policy_source", configCheckSchema, "Policies are loaded from %s, they were not checked", conf.Policies.PolicySource)
+	case conf.Policies.PolicyRecordName != "":
+		validatePolicyFile(&report, conf.Policies.PolicyRecordName, apiIDs, conf.UseDBAppConfigs)
+	}
+
+	report.Valid = len(report.Errors) == 0
+	return report
+}
+
+func validateConfigFile(report *configValidationReport, conf config.Config) {
+	source := conf.OriginalPath
+	if source == "" {
+		report.warnf("", "", configCheckSchema, "No configuration file was loaded")
+	} else if schm, err := ioutil.ReadFile(configSchemaPath); err != nil {
+		report.warnf(source, "", configCheckSchema, "Configuration schema not found at %s, the configuration was not checked against it", configSchemaPath)
+	} else {
+		warns, err := linter.Check(string(schm), source)
+		if err != nil {
+			report.errorf(source, "", configCheckSchema, "%v", err)
+		}
+		for _, warn := range warns {
+			report.errorf(source, "", configCheckSchema, "%s", warn)
+		}
+	}
+
+	if source != "" {
+		if raw, err := readJSONFile(source); err == nil {
+			checkSecretPlaceholders(report, source, raw)
+		}
+	}
+
+	checkCertificates(report, source, "http_server_options.ssl_certificates", conf.HttpServerOptions.SSLCertificates)
+	checkCertificates(report, source, "security.certificates.apis", conf.Security.Certificates.API)
+	checkCertificates(report, source, "security.certificates.control_api", conf.Security.Certificates.ControlAPI)
+	checkCertificates(report, source, "security.certificates.upstream", mapValues(conf.Security.Certificates.Upstream))
+}
+
+// validateAPIDefinitionFiles checks the API definitions of the app path, and
+// returns the ones that could be read.
+func validateAPIDefinitionFiles(report *configValidationReport, appPath string) []*apidef.APIDefinition {
+	paths, err := filepath.Glob(filepath.Join(appPath, "*.json"))
+	if err != nil || len(paths) == 0 {
+		report.warnf(appPath, "", configCheckSchema, "No API definitions found")
+		return nil
+	}
+	sort.Strings(paths)
+
+	schemaLoader := gojsonschema.NewStringLoader(apidef.Schema)
+	var defs []*apidef.APIDefinition
+	listenPaths := map[string]string{}
+	for _, path := range paths {
+		raw, err := readJSONFile(path)
+		if err != nil {
+			report.errorf(path, "", configCheckSchema, "Couldn't read API definition: %v", err)
+			continue
+		}
+		result, err := gojsonschema.Validate(schemaLoader, gojsonschema.NewGoLoader(raw))
+		if err != nil {
+			report.errorf(path, "", configCheckSchema, "%v", err)
+			continue
+		}
+		for _, desc := range result.Errors() {
+			report.errorf(path, desc.Field(), configCheckSchema, "%s", desc.Description())
+		}
+
+		data, _ := json.Marshal(raw)
+		def := &apidef.APIDefinition{}
+		if err := json.Unmarshal(data, def); err != nil {
+			report.errorf(path, "", configCheckSchema, "Couldn't decode API definition: %v", err)
+			continue
+		}
+		defs = append(defs, def)
+		report.APIs++
+
+		if def.APIID == "" {
+			report.errorf(path, "api_id", configCheckSchema, "API ID is empty")
+		}
+		if result := apidef.Validate(def, apidef.DefaultValidationRuleSet); !result.IsValid {
+			for _, err := range result.Errors {
+				report.errorf(path, "", configCheckSchema, "%v", err)
+			}
+		}
+
+		checkSecretPlaceholders(report, path, raw)
+		checkUpstreamURLs(report, path, def)
+		checkListenPath(report, path, def, listenPaths)
+		checkCertificates(report, path, "certificates", def.Certificates)
+		checkCertificates(report, path, "client_certificates", def.ClientCertificates)
+		checkCertificates(report, path, "upstream_certificates", mapValues(def.UpstreamCertificates))
+	}
+	return defs
+}
+
+func validatePolicyFile(report *configValidationReport, path string, apiIDs map[string]bool, remoteAPIs bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		report.errorf(path, "", configCheckSchema, "Couldn't open policy file: %v", err)
+		return
+	}
+	defer f.Close()
+
+	var policies map[string]user.Policy
+	if err := json.NewDecoder(f).Decode(&policies); err != nil {
+		report.errorf(path, "", configCheckSchema, "Couldn't decode policies: %v", err)
+		return
+	}
+	report.Policies = len(policies)
+
+	ids := make([]string, 0, len(policies))
+	for id := range policies {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		policy := policies[id]
+		throttle := checkPolicyThrottle(policy)
+		for _, msg := range throttle.Policy.Errors {
+			report.errorf(path, id, configCheckSchema, "%s", msg)
+		}
+		for apiID, check := range throttle.APIs {
+			for _, msg := range check.Errors {
+				report.errorf(path, id+".access_rights."+apiID, configCheckSchema, "%s", msg)
+			}
+		}
+		if remoteAPIs {
+			continue
+		}
+		for apiID := range policy.AccessRights {
+			if !apiIDs[apiID] {
+				report.warnf(path, id+".access_rights."+apiID, configCheckSchema, "API %s is not defined in the app path", apiID)
+			}
+		}
+	}
+}
+
+func readJSONFile(path string) (interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw interface{}
+	err = json.Unmarshal(data, &raw)
+	return raw, err
+}
+
+func mapValues(m map[string]string) []string {
+	values := make([]string, 0, len(m))
+	for _, v := range m {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// checkSecretPlaceholders resolves the secret placeholders found in the string
+// values of raw, either whole values such as "env://name" or references
+// such as "$secret_env.name".
+func checkSecretPlaceholders(report *configValidationReport, source string, raw interface{}) {
+	walkJSONStrings(raw, "", func(field, value string) {
+		for _, placeholder := range secretPlaceholders(value) {
+			resolved, err := kvStore(placeholder)
+			switch {
+			case err != nil:
+				report.errorf(source, field, configCheckSecret, "Couldn't resolve %s: %v", placeholder, err)
+			case resolved == "":
+				report.errorf(source, field, configCheckSecret, "%s resolves to an empty value", placeholder)
+			case resolved == placeholder:
+				report.errorf(source, field, configCheckSecret, "Couldn't resolve %s, its store is not available", placeholder)
+			}
+		}
+	})
+}
+
+// secretPlaceholders returns the secrets referenced by value, as accepted by
+// kvStore.
+func secretPlaceholders(value string) []string {
+	for _, prefix := range []string{"secrets://", "env://", "consul://", "vault://"} {
+		if strings.HasPrefix(value, prefix) {
+			return []string{value}
+		}
+	}
+
+	var placeholders []string
+	for _, ref := range []struct {
+		match  *regexp.Regexp
+		prefix string
+	}{
+		{secretsConfMatch, "secrets://"},
+		{envValueMatch, "env://"},
+		{consulMatch, "consul://"},
+		{vaultMatch, "vault://"},
+	} {
+		for _, m := range ref.match.FindAllStringSubmatch(value, -1) {
+			placeholders = append(placeholders, ref.prefix+m[1])
+		}
+	}
+	return placeholders
+}
+
+// walkJSONStrings calls fn with the path and value of each string in raw.
+func walkJSONStrings(raw interface{}, field string, fn func(field, value string)) {
+	join := func(key string) string {
+		if field == "" {
+			return key
+		}
+		return field + "." + key
+	}
+	switch v := raw.(type) {
+	case string:
+		fn(field, v)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			walkJSONStrings(v[key], join(key), fn)
+		}
+	case []interface{}:
+		for i, item := range v {
+			walkJSONStrings(item, join(strconv.Itoa(i)), fn)
+		}
+	}
+}
+
+// checkUpstreamURLs checks the syntax of the target URL of an API, or of its
+// load balancing targets.
+func checkUpstreamURLs(report *configValidationReport, source string, def *apidef.APIDefinition) {
+	check := func(field, target string) {
+		if len(secretPlaceholders(target)) > 0 {
+			if resolved, err := kvStore(target); err == nil && resolved != "" {
+				target = resolved
+			}
+		}
+		if err := checkUpstreamURL(def.Protocol, target); err != nil {
+			report.errorf(source, field, configCheckUpstreamURL, "%v", err)
+		}
+	}
+
+	if def.Proxy.EnableLoadBalancing {
+		if len(def.Proxy.Targets) == 0 {
+			report.errorf(source, "proxy.target_list", configCheckUpstreamURL, "Load balancing is enabled without targets")
+		}
+		for i, target := range def.Proxy.Targets {
+			check("proxy.target_list."+strconv.Itoa(i), target)
+		}
+		return
+	}
+	check("proxy.target_url", def.Proxy.TargetURL)
+}
+
+func checkUpstreamURL(protocol, target string) error {
+	if target == "" {
+		return fmt.Errorf("Target URL is empty")
+	}
+	switch protocol {
+	case "tcp", "tls", "udp":
+		// Services accept host:port targets with an optional scheme
+		if i := strings.Index(target, "://"); i >= 0 {
+			target = target[i+3:]
+		}
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			return fmt.Errorf("Target %q is not a host:port address: %v", target, err)
+		}
+		return nil
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("Couldn't parse target URL: %v", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("Target URL %q has no scheme or host", target)
+	}
+	return nil
+}
+
+// checkListenPath checks that an HTTP API has a valid listen path, not used by
+// another API on the same port and domain. listenPaths records the files of
+// the listen paths seen so far.
+func checkListenPath(report *configValidationReport, source string, def *apidef.APIDefinition, listenPaths map[string]string) {
+	switch def.Protocol {
+	case "", "http", "https", "h2c":
+	default:
+		return
+	}
+
+	listenPath := def.Proxy.ListenPath
+	if resolved, err := kvStore(listenPath); err == nil {
+		listenPath = resolved
+	}
+	if listenPath == "" {
+		report.errorf(source, "proxy.listen_path", configCheckListenPath, "Listen path is empty")
+		return
+	}
+	if strings.Contains(listenPath, " ") {
+		report.errorf(source, "proxy.listen_path", configCheckListenPath, "Listen path contains spaces")
+		return
+	}
+
+	key := strconv.Itoa(def.ListenPort) + " " + generateDomainPath(def.Domain, listenPath)
+	if other, ok := listenPaths[key]; ok {
+		report.errorf(source, "proxy.listen_path", configCheckListenPath, "Listen path %s is also used by %s", generateDomainPath(def.Domain, listenPath), other)
+		return
+	}
+	listenPaths[key] = source
+}
+
+// checkCertificates checks that the certificates exist, as files or in the
+// certificate store. Certificates of the store are only checked when it is
+// available.
+func checkCertificates(report *configValidationReport, source, field string, ids []string) {
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		if _, err := os.Stat(id); err == nil {
+			continue
+		}
+		if CertificateManager == nil || !storage.Connected() {
+			report.warnf(source, field, configCheckCertificate, "Certificate %s is not a file, and the certificate store is not available to check it", id)
+			continue
+		}
+		if CertificateManager.List([]string{id}, certs.CertificateAny)[0] == nil {
+			report.errorf(source, field, configCheckCertificate, "Certificate %s not found", id)
+		}
+	}
+}
+
+// Validate the configuration
+// Checks the configuration file of the gateway, the API definitions of its
+// app path and its policy file for schema errors, invalid upstream URLs,
+// duplicate listen paths, missing certificates and secrets that can't be
+// resolved. Files are read again, so changes not loaded yet are checked.
+//
+//---
+// responses:
+//   200:
+//     description: Validation report
+//     schema:
+//       "$ref": "#/definitions/configValidationReport"
+func validateConfigHandler(w http.ResponseWriter, r *http.Request) {
+	doJSONWrite(w, http.StatusOK, validateConfig(config.Global()))
+}
+
+// runConfigValidation validates the configuration files of the paths, prints
+// the report as JSON and returns whether they are valid. It is the
+// --validate-config mode.
+func runConfigValidation(paths []string) bool {
+	var conf config.Config
+	if err := config.Load(paths, &conf); err != nil {
+		report := configValidationReport{Errors: []configIssue{{
+			Source:  strings.Join(paths, ", "),
+			Check:   configCheckSchema,
+			Message: err.Error(),
+		}}, Warnings: []configIssue{}}
+		printConfigReport(report)
+		return false
+	}
+	config.SetGlobal(conf)
+
+	report := validateConfig(conf)
+	printConfigReport(report)
+	return report.Valid
+}
+
+func printConfigReport(report configValidationReport) {
+	data, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(data))
+}
@@ -0,0 +1,166 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestSecretPlaceholders(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"http://upstream", nil},
+		{"env://upstream", []string{"env://upstream"}},
+		{"vault://path/to/key", []string{"vault://path/to/key"}},
+		{"Bearer $secret_conf.token", []string{"secrets://token"}},
+		{"$secret_env.user:$secret_consul.pass", []string{"env://user", "consul://pass"}},
+	}
+	for _, tc := range tests {
+		if got := secretPlaceholders(tc.value); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("secretPlaceholders(%q) = %v, want %v", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestCheckUpstreamURL(t *testing.T) {
+	tests := []struct {
+		protocol, target string
+		valid            bool
+	}{
+		{"", "http://upstream:8080/path", true},
+		{"https", "tyk://other-api", true},
+		{"", "upstream:8080", false},
+		{"", "/path", false},
+		{"", "http://[::1", false},
+		{"", "", false},
+		{"tcp", "upstream:8080", true},
+		{"tls", "tcp://upstream:8080", true},
+		{"udp", "upstream", false},
+	}
+	for _, tc := range tests {
+		if err := checkUpstreamURL(tc.protocol, tc.target); (err == nil) != tc.valid {
+			t.Errorf("checkUpstreamURL(%q, %q) returned %v, want valid %v", tc.protocol, tc.target, err, tc.valid)
+		}
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+	defer ResetTestConfig()
+
+	dir, err := ioutil.TempDir("", "tyk-validate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	appPath := filepath.Join(dir, "apps")
+	if err := os.Mkdir(appPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name string, obj interface{}) string {
+		data, _ := json.Marshal(obj)
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	api := func(id, listenPath, target string) map[string]interface{} {
+		return map[string]interface{}{
+			"api_id":       id,
+			"name":         id,
+			"version_data": map[string]interface{}{"not_versioned": true, "versions": map[string]interface{}{}},
+			"proxy": map[string]interface{}{
+				"listen_path": listenPath,
+				"target_url":  target,
+			},
+		}
+	}
+
+	confPath := write("tyk.conf", map[string]interface{}{
+		"secret":  "secrets://gateway",
+		"secrets": map[string]string{"gateway": "352d20ee67be67f6340b4c0605b044b7", "upstream": "http://upstream"},
+	})
+	apiGood := write("apps/a-good.json", api("good", "/good/", "secrets://upstream"))
+	apiDuplicate := write("apps/b-duplicate.json", api("duplicate", "/good/", "http://upstream"))
+	badAPI := api("bad", "/bad/", "upstream:8080")
+	badAPI["client_certificates"] = []string{"missing-certificate"}
+	badAPI["enable_jsvmm"] = true
+	badAPI["custom_middleware"] = map[string]interface{}{
+		"pre": []map[string]string{{"name": "env://TYK_VALIDATE_MISSING"}},
+	}
+	apiBad := write("apps/c-bad.json", badAPI)
+	policyPath := write("policies.json", map[string]interface{}{
+		"throttled": map[string]interface{}{
+			"id":                   "throttled",
+			"throttle_retry_limit": 5,
+			"access_rights":        map[string]interface{}{"good": map[string]interface{}{"api_id": "good"}, "unknown": map[string]interface{}{"api_id": "unknown"}},
+		},
+	})
+
+	configSchemaPath = "../cli/linter/schema.json"
+	defer func() { configSchemaPath = "cli/linter/schema.json" }()
+
+	globalConf := config.Global()
+	globalConf.OriginalPath = confPath
+	globalConf.AppPath = appPath
+	globalConf.Policies.PolicySource = "file"
+	globalConf.Policies.PolicyRecordName = policyPath
+	globalConf.Secrets = map[string]string{"gateway": "352d20ee67be67f6340b4c0605b044b7", "upstream": "http://upstream"}
+	config.SetGlobal(globalConf)
+
+	var report configValidationReport
+	_, _ = ts.Run(t, test.TestCase{Path: "/tyk/config/validate", AdminAuth: true, Code: http.StatusOK,
+		BodyMatchFunc: func(body []byte) bool {
+			return json.Unmarshal(body, &report) == nil
+		}})
+
+	if report.Valid || report.Config != confPath || report.APIs != 3 || report.Policies != 1 {
+		t.Fatalf("Expected an invalid report of 3 APIs and 1 policy, got %+v", report)
+	}
+
+	type issue struct{ source, field, check string }
+	found := map[issue]bool{}
+	for _, i := range report.Errors {
+		found[issue{i.Source, i.Field, i.Check}] = true
+	}
+	for _, want := range []issue{
+		{apiBad, "proxy.target_url", configCheckUpstreamURL},
+		{apiBad, "enable_jsvmm", configCheckSchema},
+		{apiBad, "custom_middleware.pre.0.name", configCheckSecret},
+		{apiBad, "client_certificates", configCheckCertificate},
+		{apiDuplicate, "proxy.listen_path", configCheckListenPath},
+		{policyPath, "throttled", configCheckSchema},
+	} {
+		if !found[want] {
+			t.Errorf("Expected error %+v, got %+v", want, report.Errors)
+		}
+	}
+	for i := range found {
+		if i.source == apiGood || i.source == confPath {
+			t.Errorf("Expected no errors in %s, got %+v", i.source, i)
+		}
+	}
+	if len(report.Errors) != 6 {
+		t.Errorf("Expected 6 errors, got %+v", report.Errors)
+	}
+
+	foundUnknownAPI := false
+	for _, i := range report.Warnings {
+		foundUnknownAPI = foundUnknownAPI || (i.Source == policyPath && i.Field == "throttled.access_rights.unknown")
+	}
+	if !foundUnknownAPI {
+		t.Errorf("Expected a warning for the unknown API of the policy, got %+v", report.Warnings)
+	}
+}
@@ -0,0 +1,95 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+// connRequestsKey stores the number of requests served on a client
+// connection in its context.
+type connRequestsKey struct{}
+
+// connectionLimits returns the client connection limits of a listen port.
+func connectionLimits(port int) config.ConnectionLimitsConfig {
+	opts := config.Global().HttpServerOptions
+	if limits, ok := opts.PortConnectionLimits[strconv.Itoa(port)]; ok {
+		return limits
+	}
+	return opts.ConnectionLimits
+}
+
+// limitListener caps the number of connections accepted concurrently by l.
+func limitListener(l net.Listener, maxConns int) net.Listener {
+	if maxConns <= 0 {
+		return l
+	}
+	return &limitedListener{Listener: l, sem: make(chan struct{}, maxConns), done: make(chan struct{})}
+}
+
+// limitedListener holds a slot of sem for each connection it accepted, until
+// it is closed.
+type limitedListener struct {
+	net.Listener
+	sem       chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *limitedListener) Accept() (net.Conn, error) {
+	select {
+	case l.sem <- struct{}{}:
+	case <-l.done:
+		return nil, errors.New("listener closed")
+	}
+	c, err := l.Listener.Accept()
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+	return &limitedConn{Conn: c, release: func() { <-l.sem }}, nil
+}
+
+func (l *limitedListener) Close() error {
+	err := l.Listener.Close()
+	l.closeOnce.Do(func() { close(l.done) })
+	return err
+}
+
+// limitedConn releases its slot when closed.
+type limitedConn struct {
+	net.Conn
+	releaseOnce sync.Once
+	release     func()
+}
+
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.releaseOnce.Do(c.release)
+	return err
+}
+
+// countConnRequests attaches a request counter to a new client connection.
+func countConnRequests(ctx context.Context, _ net.Conn) context.Context {
+	return context.WithValue(ctx, connRequestsKey{}, new(int64))
+}
+
+// lastConnRequest counts r on its connection and reports whether it is the
+// last one allowed. Only HTTP/1 connections are limited, as HTTP/2 ones
+// can't be closed from a handler.
+func lastConnRequest(r *http.Request, maxRequests int) bool {
+	if maxRequests <= 0 || r.ProtoMajor != 1 {
+		return false
+	}
+	count, ok := r.Context().Value(connRequestsKey{}).(*int64)
+	if !ok {
+		return false
+	}
+	return atomic.AddInt64(count, 1) >= int64(maxRequests)
+}
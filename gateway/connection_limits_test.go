@@ -0,0 +1,46 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+func TestConnectionLimits(t *testing.T) {
+	defer ResetTestConfig()
+
+	globalConf := config.Global()
+	globalConf.HttpServerOptions.ConnectionLimits = config.ConnectionLimitsConfig{MaxConnections: 100}
+	globalConf.HttpServerOptions.PortConnectionLimits = map[string]config.ConnectionLimitsConfig{
+		"8443": {MaxConnections: 10, IdleTimeout: 5},
+	}
+	config.SetGlobal(globalConf)
+
+	assert.Equal(t, config.ConnectionLimitsConfig{MaxConnections: 100}, connectionLimits(8080))
+	assert.Equal(t, config.ConnectionLimitsConfig{MaxConnections: 10, IdleTimeout: 5}, connectionLimits(8443))
+}
+
+func TestMaxRequestsPerConnection(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	upstream := httptest.NewUnstartedServer(&handleWrapper{router: router, maxConnRequests: 2})
+	upstream.Config.ConnContext = countConnRequests
+	upstream.Start()
+	defer upstream.Close()
+
+	client := upstream.Client()
+	for i, expectClose := range []bool{false, true, false} {
+		resp, err := client.Get(upstream.URL)
+		if !assert.NoError(t, err) {
+			return
+		}
+		resp.Body.Close()
+		assert.Equal(t, expectClose, resp.Close, "request %d", i)
+	}
+}
@@ -0,0 +1,88 @@
+package gateway
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+// controlAPIAllowList restricts the control API to the clients of allowed
+// networks.
+type controlAPIAllowList struct {
+	// enabled is set when networks are configured, even if none of them
+	// is valid, so that a mistyped allow list doesn't allow everyone.
+	enabled        bool
+	allowed        ipNets
+	trustedProxies ipNets
+}
+
+func newControlAPIAllowList(conf config.ControlAPIAllowListConfig) *controlAPIAllowList {
+	allowList := &controlAPIAllowList{
+		enabled:        len(conf.CIDRs) > 0,
+		allowed:        parseControlAPINets(conf.CIDRs, "allowed network"),
+		trustedProxies: parseControlAPINets(conf.TrustedProxies, "trusted proxy"),
+	}
+	if allowList.enabled && len(allowList.allowed) == 0 {
+		mainLog.Error("None of the networks of the control API allow list is valid, the control API is only available on its socket")
+	}
+	return allowList
+}
+
+// parseControlAPINets parses the networks of the control API allow list,
+// skipping invalid ones.
+func parseControlAPINets(list []string, kind string) ipNets {
+	var nets ipNets
+	for _, s := range list {
+		ipNet, err := parseIPNet(s)
+		if err != nil {
+			mainLog.WithError(err).Errorf("Invalid %s of the control API allow list: %s", kind, s)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+// clientIP returns the IP of the client of a control API request, as
+// forwarded by the trusted proxies. It is nil for requests that didn't come
+// over IP, such as those on the control API socket.
+func (a *controlAPIAllowList) clientIP(r *http.Request) net.IP {
+	return forwardedClientIP(r, a.trustedProxies)
+}
+
+// allows reports whether the client of r may use the control API. Requests
+// on the control API socket are always allowed, as its file permissions
+// restrict access to it.
+func (a *controlAPIAllowList) allows(r *http.Request) bool {
+	if !a.enabled {
+		return true
+	}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && addr.Network() == "unix" {
+		return true
+	}
+	ip := a.clientIP(r)
+	return ip != nil && a.allowed.contains(ip)
+}
+
+// checkControlAPIAllowList rejects control API requests from clients outside
+// of the allowed networks, before their key is checked.
+func checkControlAPIAllowList(next http.Handler) http.Handler {
+	allowList := newControlAPIAllowList(config.Global().Security.ControlAPIAllowList)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowList.allows(r) {
+			mainLog.WithFields(logrus.Fields{
+				"prefix": "control-api",
+				"origin": r.RemoteAddr,
+				"client": allowList.clientIP(r),
+				"path":   r.URL.Path,
+			}).Warning("Attempted administrative access from a disallowed IP")
+
+			doJSONWrite(w, http.StatusForbidden, apiError("access from this IP has been disallowed"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,67 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestControlAPIAllowList(t *testing.T) {
+	allowList := newControlAPIAllowList(config.ControlAPIAllowListConfig{
+		CIDRs:          []string{"10.0.0.0/8", "192.168.1.1", "invalid"},
+		TrustedProxies: []string{"172.16.0.0/12"},
+	})
+
+	tests := []struct {
+		remoteAddr string
+		forwarded  string
+		allowed    bool
+	}{
+		{"10.1.1.1:1234", "", true},
+		{"192.168.1.1:1234", "", true},
+		{"192.168.1.2:1234", "", false},
+		// forwarded for by a trusted proxy
+		{"172.16.0.1:1234", "10.1.1.1", true},
+		{"172.16.0.1:1234", "203.0.113.1", false},
+		{"172.16.0.1:1234", "", false},
+		// spoofed by an untrusted client
+		{"203.0.113.1:1234", "10.1.1.1", false},
+	}
+	for _, tc := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/tyk/apis", nil)
+		r.RemoteAddr = tc.remoteAddr
+		if tc.forwarded != "" {
+			r.Header.Set(headers.XForwardFor, tc.forwarded)
+		}
+		assert.Equal(t, tc.allowed, allowList.allows(r), "%s forwarded for %q", tc.remoteAddr, tc.forwarded)
+	}
+
+	assert.True(t, newControlAPIAllowList(config.ControlAPIAllowListConfig{}).allows(httptest.NewRequest(http.MethodGet, "/", nil)))
+	// a list without any valid network allows no one
+	invalid := newControlAPIAllowList(config.ControlAPIAllowListConfig{CIDRs: []string{"10.0.0.0/33", "localhost"}})
+	assert.False(t, invalid.allows(httptest.NewRequest(http.MethodGet, "/", nil)))
+}
+
+func TestControlAPIAllowListEndpoints(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.Security.ControlAPIAllowList = config.ControlAPIAllowListConfig{
+		CIDRs:          []string{"10.0.0.0/8"},
+		TrustedProxies: []string{"127.0.0.1"},
+	}
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/tyk/apis", AdminAuth: true, Code: http.StatusForbidden, BodyMatch: "disallowed"},
+		{Path: "/tyk/apis", AdminAuth: true, Headers: map[string]string{headers.XForwardFor: "10.1.1.1"}, Code: http.StatusOK},
+	}...)
+}
@@ -0,0 +1,165 @@
+package gateway
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+)
+
+// controlAPIPruneInterval is how often the state of clients that are neither
+// limited nor locked out anymore is dropped.
+const controlAPIPruneInterval = time.Minute
+
+// controlAPIClient is the state of a control API client IP.
+type controlAPIClient struct {
+	requests      int
+	requestsStart time.Time
+	failures      int
+	failuresStart time.Time
+	lockedUntil   time.Time
+}
+
+// controlAPIGuard rate limits the control API requests of client IPs and
+// locks out those that fail to authorize too often. The state is local to
+// the node, as is the secret.
+type controlAPIGuard struct {
+	conf config.ControlAPIProtectionConfig
+
+	mu        sync.Mutex
+	clients   map[string]*controlAPIClient
+	lastPrune time.Time
+}
+
+// controlAPIProtection guards all the control API endpoints, including the
+// ones of OAuth APIs, for clients to share their limits between them.
+var controlAPIProtection = newControlAPIGuard(config.ControlAPIProtectionConfig{})
+
+func newControlAPIGuard(conf config.ControlAPIProtectionConfig) *controlAPIGuard {
+	return &controlAPIGuard{
+		conf:      conf,
+		clients:   make(map[string]*controlAPIClient),
+		lastPrune: time.Now(),
+	}
+}
+
+// configure sets the limits of the guard. The state of clients is kept
+// unless the limits change.
+func (g *controlAPIGuard) configure(conf config.ControlAPIProtectionConfig) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if conf == g.conf {
+		return
+	}
+	g.conf = conf
+	g.clients = make(map[string]*controlAPIClient)
+}
+
+func (g *controlAPIGuard) enabled() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.conf.RateLimit > 0 || g.conf.MaxFailedAttempts > 0
+}
+
+// client returns the state of ip, creating it if needed. g.mu must be held.
+func (g *controlAPIGuard) client(ip string, now time.Time) *controlAPIClient {
+	if now.Sub(g.lastPrune) > controlAPIPruneInterval {
+		g.prune(now)
+	}
+	c := g.clients[ip]
+	if c == nil {
+		c = &controlAPIClient{}
+		g.clients[ip] = c
+	}
+	return c
+}
+
+func (g *controlAPIGuard) prune(now time.Time) {
+	per := time.Duration(g.conf.RateLimitPer) * time.Second
+	window := time.Duration(g.conf.FailureWindow) * time.Second
+	for ip, c := range g.clients {
+		if now.Before(c.lockedUntil) || now.Sub(c.requestsStart) < per || now.Sub(c.failuresStart) < window {
+			continue
+		}
+		delete(g.clients, ip)
+	}
+	g.lastPrune = now
+}
+
+// allow counts a request of ip and returns the status code to reject it
+// with, or 0 if it is allowed.
+func (g *controlAPIGuard) allow(ip string) int {
+	now := time.Now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c := g.client(ip, now)
+	if now.Before(c.lockedUntil) {
+		return http.StatusForbidden
+	}
+	if g.conf.RateLimit <= 0 {
+		return 0
+	}
+	if now.Sub(c.requestsStart) >= time.Duration(g.conf.RateLimitPer)*time.Second {
+		c.requests = 0
+		c.requestsStart = now
+	}
+	c.requests++
+	if c.requests > g.conf.RateLimit {
+		return http.StatusTooManyRequests
+	}
+	return 0
+}
+
+// fail counts a failed authorization of ip. It returns the number of
+// failures in the current window and whether ip got locked out.
+func (g *controlAPIGuard) fail(ip string) (int, bool) {
+	now := time.Now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c := g.client(ip, now)
+	if now.Sub(c.failuresStart) >= time.Duration(g.conf.FailureWindow)*time.Second {
+		c.failures = 0
+		c.failuresStart = now
+	}
+	c.failures++
+	if g.conf.MaxFailedAttempts <= 0 || c.failures < g.conf.MaxFailedAttempts {
+		return c.failures, false
+	}
+	c.lockedUntil = now.Add(time.Duration(g.conf.LockoutDuration) * time.Second)
+	return c.failures, true
+}
+
+// controlAPIClientIP returns the IP of the client of r. Forwarding headers
+// are only honored from the trusted proxies of the control API allow list,
+// or of client_ip without any, as they would otherwise let a client pick its
+// own IP.
+func controlAPIClientIP(r *http.Request, allowList *controlAPIAllowList) string {
+	if ip := allowList.clientIP(r); ip != nil {
+		return ip.String()
+	}
+	return r.RemoteAddr
+}
+
+// reportControlAPIAccess logs and fires an audit event for a rejected or
+// failed control API request.
+func reportControlAPIAccess(event apidef.TykEvent, message string, r *http.Request, ip string, failures int) {
+	mainLog.WithFields(logrus.Fields{
+		"prefix":   "control-api",
+		"origin":   ip,
+		"path":     r.URL.Path,
+		"failures": failures,
+	}).Warning(message)
+
+	FireSystemEvent(event, EventControlAPIAccessMeta{
+		EventMetaDefault: EventMetaDefault{Message: message},
+		Path:             r.URL.Path,
+		Origin:           ip,
+		Failures:         failures,
+	})
+}
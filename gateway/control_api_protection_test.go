@@ -0,0 +1,66 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestControlAPIGuard(t *testing.T) {
+	guard := newControlAPIGuard(config.ControlAPIProtectionConfig{
+		RateLimit:         2,
+		RateLimitPer:      60,
+		MaxFailedAttempts: 2,
+		FailureWindow:     60,
+		LockoutDuration:   60,
+	})
+	assert.True(t, guard.enabled())
+
+	assert.Equal(t, 0, guard.allow("10.0.0.1"))
+	assert.Equal(t, 0, guard.allow("10.0.0.1"))
+	assert.Equal(t, http.StatusTooManyRequests, guard.allow("10.0.0.1"))
+	assert.Equal(t, 0, guard.allow("10.0.0.2"))
+
+	failures, lockedOut := guard.fail("10.0.0.3")
+	assert.Equal(t, 1, failures)
+	assert.False(t, lockedOut)
+	failures, lockedOut = guard.fail("10.0.0.3")
+	assert.Equal(t, 2, failures)
+	assert.True(t, lockedOut)
+	assert.Equal(t, http.StatusForbidden, guard.allow("10.0.0.3"))
+
+	assert.False(t, newControlAPIGuard(config.ControlAPIProtectionConfig{}).enabled())
+
+	// clients keep their state unless the limits change
+	guard.configure(guard.conf)
+	assert.Equal(t, http.StatusForbidden, guard.allow("10.0.0.3"))
+	guard.configure(config.ControlAPIProtectionConfig{})
+	assert.Equal(t, 0, guard.allow("10.0.0.3"))
+}
+
+func TestControlAPILockout(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.Security.ControlAPIProtection = config.ControlAPIProtectionConfig{
+		MaxFailedAttempts: 2,
+		FailureWindow:     60,
+		LockoutDuration:   60,
+	}
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	wrongKey := map[string]string{headers.XTykAuthorization: "wrong"}
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/tyk/apis", Headers: wrongKey, Code: http.StatusForbidden, BodyMatch: "invalid or missing key"},
+		{Path: "/tyk/apis", Headers: wrongKey, Code: http.StatusForbidden, BodyMatch: "invalid or missing key"},
+		// the right secret is rejected too while locked out
+		{Path: "/tyk/apis", AdminAuth: true, Code: http.StatusForbidden, BodyMatch: "Too many failed attempts"},
+	}...)
+}
@@ -0,0 +1,86 @@
+package gateway
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+// controlSocketMode restricts the control API socket to the user and group
+// of the gateway.
+const controlSocketMode = 0660
+
+// controlSocketServer serves the control API on the Unix socket set in
+// control_api_socket, if any.
+var controlSocketServer *http.Server
+
+// loadNetworkControlAPIEndpoints loads the control API on a TCP router. If it
+// is only served on the Unix socket, only the health check is loaded.
+func loadNetworkControlAPIEndpoints(router *mux.Router) {
+	if config.Global().ControlAPISocket != "" && config.Global().ControlAPISocketOnly {
+		router.HandleFunc("/"+config.Global().HealthCheckEndpointName, liveCheckHandler)
+		return
+	}
+	loadControlAPIEndpoints(router)
+}
+
+// listenControlSocket listens on the Unix socket at path, replacing the
+// socket file a previous process may have left behind.
+func listenControlSocket(path string) (net.Listener, error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// a process forked on restart has already replaced the socket file, so
+	// closing ours must not remove it
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(path, controlSocketMode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// startControlSocket serves the control API on the configured Unix socket,
+// so that colocated tools can manage the gateway without it being exposed on
+// the network.
+func startControlSocket() {
+	path := config.Global().ControlAPISocket
+	if path == "" || controlSocketServer != nil {
+		return
+	}
+	listener, err := listenControlSocket(path)
+	if err != nil {
+		mainLog.WithError(err).Error("Can't start control API socket")
+		return
+	}
+
+	router := mux.NewRouter()
+	loadControlAPIEndpoints(router)
+	controlSocketServer = &http.Server{Handler: router}
+
+	mainLog.Info("Control API listening on socket: ", path)
+	go controlSocketServer.Serve(listener)
+}
+
+// stopControlSocket stops serving the control API on the Unix socket.
+func stopControlSocket() {
+	if controlSocketServer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := controlSocketServer.Shutdown(ctx); err != nil {
+		mainLog.WithError(err).Error("Closing control API socket")
+	}
+	controlSocketServer = nil
+}
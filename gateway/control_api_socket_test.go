@@ -0,0 +1,80 @@
+package gateway
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+func TestControlSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tyk-control-socket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "control.sock")
+
+	globalConf := config.Global()
+	globalConf.ControlAPISocket = path
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	startControlSocket()
+	defer stopControlSocket()
+
+	info, err := os.Stat(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, os.FileMode(controlSocketMode), info.Mode().Perm())
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	do := func(secret string) int {
+		req, _ := http.NewRequest(http.MethodGet, "http://unix/tyk/apis", nil)
+		req.Header.Set(headers.XTykAuthorization, secret)
+		resp, err := client.Do(req)
+		if !assert.NoError(t, err) {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusOK, do(config.Global().Secret))
+	assert.Equal(t, http.StatusForbidden, do("wrong"))
+}
+
+func TestControlSocketOnly(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.ControlAPISocket = "/tmp/tyk-control.sock"
+	globalConf.ControlAPISocketOnly = true
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	router := mux.NewRouter()
+	loadNetworkControlAPIEndpoints(router)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/"+globalConf.HealthCheckEndpointName, nil))
+	assert.NotEqual(t, http.StatusNotFound, rec.Code, "The health check should still be served")
+
+	req := httptest.NewRequest(http.MethodGet, "/tyk/apis", nil)
+	req.Header.Set(headers.XTykAuthorization, globalConf.Secret)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
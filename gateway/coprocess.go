@@ -183,9 +183,9 @@ func (c *CoProcessor) ObjectPostProcess(object *coprocess.Object, r *http.Reques
 	for _, dh := range object.Request.DeleteHeaders {
 		r.Header.Del(dh)
 	}
-	ignoreCanonical := config.Global().IgnoreCanonicalMIMEHeaderKey
+	casing := c.Middleware.Spec.headerCasing()
 	for h, v := range object.Request.SetHeaders {
-		setCustomHeader(r.Header, h, v, ignoreCanonical)
+		setCustomHeader(r.Header, h, v, casing)
 	}
 
 	updatedValues := r.URL.Query()
@@ -546,9 +546,9 @@ func (h *CustomMiddlewareResponseHook) HandleResponse(rw http.ResponseWriter, re
 	}
 
 	// Set headers:
-	ignoreCanonical := config.Global().IgnoreCanonicalMIMEHeaderKey
+	casing := h.mw.Spec.headerCasing()
 	for k, v := range retObject.Response.Headers {
-		setCustomHeader(res.Header, k, v, ignoreCanonical)
+		setCustomHeader(res.Header, k, v, casing)
 	}
 
 	// Set response body:
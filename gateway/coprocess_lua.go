@@ -86,6 +86,8 @@ const (
 )
 
 func init() {
+	registerBuildTag("lua")
+
 	var err error
 	loadedDrivers[apidef.LuaDriver], err = NewLuaDispatcher()
 	if err == nil {
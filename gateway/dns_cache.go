@@ -0,0 +1,108 @@
+package gateway
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/TykTechnologies/tyk/dnscache"
+)
+
+// apiDNSCaches holds the DNS caches of the APIs with their own DNS options,
+// by API ID. They are replaced whenever the transport of an API is, and
+// dropped with the API or its DNS options, their janitors stopping once the
+// storage isn't referenced.
+var apiDNSCaches sync.Map
+
+// pruneAPIDNSCaches drops the DNS caches of the APIs that are no longer
+// loaded, or no longer have DNS options of their own.
+func pruneAPIDNSCaches(specs map[string]*APISpec) {
+	apiDNSCaches.Range(func(k, _ interface{}) bool {
+		if spec, ok := specs[k.(string)]; !ok || !spec.Proxy.DNS.Enabled() {
+			apiDNSCaches.Delete(k)
+		}
+		return true
+	})
+}
+
+// DNSCacheStatus lists the entries of the global DNS cache, and of the DNS
+// caches of APIs with their own DNS options by API ID.
+// swagger:model
+type DNSCacheStatus struct {
+	Global []dnscache.DnsCacheEntry            `json:"global"`
+	APIs   map[string][]dnscache.DnsCacheEntry `json:"apis"`
+}
+
+// dnsCaches calls fn with the DNS caches of APIs, or of a single one if
+// apiID is set, and the global cache as "" if it isn't.
+func dnsCaches(apiID string, fn func(apiID string, storage *dnscache.DnsCacheStorage)) {
+	if apiID == "" {
+		if storage, ok := dnsCacheManager.CacheStorage().(*dnscache.DnsCacheStorage); ok {
+			fn("", storage)
+		}
+	}
+	apiDNSCaches.Range(func(k, v interface{}) bool {
+		id := k.(string)
+		if (apiID == "" || id == apiID) && getApiSpec(id) != nil {
+			fn(id, v.(*dnscache.DnsCacheStorage))
+		}
+		return true
+	})
+}
+
+// Get or flush the DNS cache
+// Lists the hosts in the DNS caches of the node, or removes them so that
+// they're resolved again, e.g. when upstream IPs move. The api_id parameter
+// restricts it to the cache of an API, host to a single host.
+//
+//---
+// parameters:
+// - name: api_id
+//   in: query
+//   required: false
+//   type: string
+// - name: host
+//   in: query
+//   required: false
+//   type: string
+// responses:
+//   200:
+//     description: DNS cache entries, or flush confirmation
+//     schema:
+//       "$ref": "#/definitions/DNSCacheStatus"
+func dnsCacheHandler(w http.ResponseWriter, r *http.Request) {
+	apiID := r.URL.Query().Get("api_id")
+	host := r.URL.Query().Get("host")
+
+	if r.Method == http.MethodDelete {
+		dnsCaches(apiID, func(_ string, storage *dnscache.DnsCacheStorage) {
+			if host != "" {
+				storage.Delete(host)
+				return
+			}
+			storage.Clear()
+		})
+		log.WithField("api_id", apiID).WithField("host", host).Info("Flushed the DNS cache")
+		doJSONWrite(w, http.StatusOK, apiOk("DNS cache flushed"))
+		return
+	}
+
+	status := DNSCacheStatus{Global: []dnscache.DnsCacheEntry{}, APIs: map[string][]dnscache.DnsCacheEntry{}}
+	dnsCaches(apiID, func(id string, storage *dnscache.DnsCacheStorage) {
+		entries := storage.Entries()
+		if host != "" {
+			matching := entries[:0]
+			for _, entry := range entries {
+				if entry.Host == host {
+					matching = append(matching, entry)
+				}
+			}
+			entries = matching
+		}
+		if id == "" {
+			status.Global = entries
+			return
+		}
+		status.APIs[id] = entries
+	})
+	doJSONWrite(w, http.StatusOK, status)
+}
@@ -0,0 +1,183 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/certs"
+)
+
+// proxyFromAPI returns the proxy requests to the upstreams of an API go
+// through: the proxy of the API unless the upstream is in its bypass list,
+// or else the proxy of the environment.
+func proxyFromAPI(api *APISpec) func(*http.Request) (*url.URL, error) {
+	if api == nil || api.Proxy.Transport.ProxyURL == "" {
+		return http.ProxyFromEnvironment
+	}
+	transport := api.Proxy.Transport
+
+	proxyURL, err := url.Parse(transport.ProxyURL)
+	if err != nil {
+		return func(*http.Request) (*url.URL, error) {
+			return nil, err
+		}
+	}
+	if transport.ProxyUsername != "" {
+		password, err := kvStore(transport.ProxyPassword)
+		if err != nil {
+			log.WithError(err).WithField("api_id", api.APIID).Error("Couldn't resolve the password of the upstream proxy")
+		}
+		proxyURL.User = url.UserPassword(transport.ProxyUsername, password)
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		if noProxyMatch(req.URL, transport.NoProxy) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}
+}
+
+// noProxyMatch reports whether a URL is in a NO_PROXY style bypass list.
+func noProxyMatch(u *url.URL, noProxy []string) bool {
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" || u.Scheme == "wss" {
+			port = "443"
+		}
+	}
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+
+	for _, entry := range noProxy {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+			continue
+		case entry == "*":
+			return true
+		}
+
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		entryHost, entryPort := entry, ""
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			entryHost, entryPort = h, p
+		}
+		if entryPort != "" && entryPort != port {
+			continue
+		}
+
+		if entryIP := net.ParseIP(entryHost); entryIP != nil {
+			if ip != nil && entryIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+
+		entryHost = strings.TrimPrefix(strings.TrimPrefix(entryHost, "*"), ".")
+		if host == entryHost || strings.HasSuffix(host, "."+entryHost) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyCertificate returns the client certificate of an API for its
+// upstream proxy.
+func proxyCertificate(spec *APISpec) *tls.Certificate {
+	certID := spec.Proxy.Transport.ProxyCertificateID
+	if certID == "" {
+		return nil
+	}
+	certList := CertificateManager.List([]string{certID}, certs.CertificatePrivate)
+	if len(certList) == 0 || certList[0] == nil {
+		log.WithField("api_id", spec.APIID).Error("Certificate of the upstream proxy not found")
+		return nil
+	}
+	return certList[0]
+}
+
+// proxyDialTLS returns the TLS dialer of the transport of an API presenting
+// the client certificate of its HTTPS proxy, with a TLS config of its own
+// for the certificate not to be presented to the upstreams. The other TLS
+// connections are dialed by dialTLS, if any.
+func proxyDialTLS(spec *APISpec, tc *tls.Config, dial func(ctx context.Context, network, addr string) (net.Conn, error),
+	dialTLS func(network, addr string) (net.Conn, error)) func(network, addr string) (net.Conn, error) {
+	transport := spec.Proxy.Transport
+	if transport.ProxyCertificateID == "" {
+		return dialTLS
+	}
+	proxyURL, err := url.Parse(transport.ProxyURL)
+	if err != nil || proxyURL.Scheme != "https" {
+		return dialTLS
+	}
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "443")
+	}
+
+	return func(network, addr string) (net.Conn, error) {
+		if addr != proxyAddr && dialTLS != nil {
+			return dialTLS(network, addr)
+		}
+
+		clone := tc.Clone()
+		if addr == proxyAddr {
+			clone.ServerName = proxyURL.Hostname()
+			clone.Certificates = nil
+			if cert := proxyCertificate(spec); cert != nil {
+				clone.Certificates = []tls.Certificate{*cert}
+			}
+		} else if clone.ServerName == "" {
+			clone.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+
+		conn, err := dial(context.Background(), network, addr)
+		if err != nil {
+			return nil, err
+		}
+		tlsConn := tls.Client(conn, clone)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+}
+
+// upstreamProxyError returns why a request failed because of the upstream
+// proxy rather than the upstream, if it went through one.
+func upstreamProxyError(spec *APISpec, req *http.Request, err error) (string, bool) {
+	if spec.Proxy.Transport.ProxyURL == "" {
+		return "", false
+	}
+	if proxyURL, _ := proxyFromAPI(spec)(req); proxyURL == nil {
+		return "", false
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "proxyconnect" {
+		return "Upstream proxy connection failed", true
+	}
+	// the proxy rejected the CONNECT request, the error is its status text
+	switch err.Error() {
+	case http.StatusText(http.StatusProxyAuthRequired):
+		return "Upstream proxy authentication failed", true
+	case http.StatusText(http.StatusForbidden), http.StatusText(http.StatusBadGateway),
+		http.StatusText(http.StatusServiceUnavailable), http.StatusText(http.StatusGatewayTimeout):
+		return "Upstream proxy rejected the connection", true
+	}
+	return "", false
+}
@@ -0,0 +1,149 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestNoProxyMatch(t *testing.T) {
+	noProxy := []string{"internal.example.com", ".corp", "10.0.0.0/8", "192.168.1.5", "api.partner.com:8443"}
+
+	tests := []struct {
+		url      string
+		expected bool
+	}{
+		{"http://internal.example.com/", true},
+		{"http://svc.internal.example.com/", true},
+		{"http://example.com/", false},
+		{"https://billing.corp/", true},
+		{"http://10.1.2.3:8080/", true},
+		{"http://11.1.2.3/", false},
+		{"http://192.168.1.5/", true},
+		{"https://api.partner.com:8443/", true},
+		{"https://api.partner.com/", false},
+	}
+	for _, tc := range tests {
+		u, _ := url.Parse(tc.url)
+		if got := noProxyMatch(u, noProxy); got != tc.expected {
+			t.Errorf("%s: expected %v, got %v", tc.url, tc.expected, got)
+		}
+	}
+
+	u, _ := url.Parse("http://anything/")
+	if !noProxyMatch(u, []string{"*"}) {
+		t.Error("Expected * to bypass the proxy for every upstream")
+	}
+}
+
+func TestEgressProxy(t *testing.T) {
+	var proxied int
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := parseProxyAuthorization(r); !ok || user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		proxied++
+		w.Write([]byte("proxied"))
+	}))
+	defer proxy.Close()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "proxied"
+		spec.Proxy.ListenPath = "/proxied/"
+		spec.Proxy.TargetURL = "http://upstream.example.com"
+		spec.Proxy.Transport.ProxyURL = proxy.URL
+		spec.Proxy.Transport.ProxyUsername = "user"
+		spec.Proxy.Transport.ProxyPassword = "pass"
+	}, func(spec *APISpec) {
+		spec.APIID = "bypassed"
+		spec.Proxy.ListenPath = "/bypassed/"
+		spec.Proxy.Transport.ProxyURL = proxy.URL
+		spec.Proxy.Transport.NoProxy = []string{"127.0.0.1", "localhost"}
+	}, func(spec *APISpec) {
+		spec.APIID = "unreachable"
+		spec.Proxy.ListenPath = "/unreachable/"
+		spec.Proxy.Transport.ProxyURL = "http://127.0.0.1:1"
+	})
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/proxied/", Code: http.StatusOK, BodyMatch: "proxied"},
+		{Path: "/bypassed/", Code: http.StatusOK, BodyMatch: `"Url":"/"`},
+		{Path: "/unreachable/", Code: http.StatusBadGateway, BodyMatch: "Upstream proxy connection failed"},
+	}...)
+
+	if proxied != 1 {
+		t.Errorf("Expected one request through the proxy, got %d", proxied)
+	}
+}
+
+func TestProxyDialTLS(t *testing.T) {
+	_, _, combinedClientPEM, _ := genCertificate(&x509.Certificate{})
+	certID, _ := CertificateManager.Add(combinedClientPEM, "")
+	defer CertificateManager.Delete(certID, "")
+
+	_, _, _, serverCert := genServerCertificate()
+	// listen accepts a TLS connection and sends whether the client presented
+	// a certificate
+	listen := func() (net.Listener, chan bool) {
+		ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientAuth:   tls.RequestClientCert,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		presented := make(chan bool, 1)
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			tlsConn := conn.(*tls.Conn)
+			tlsConn.Handshake()
+			presented <- len(tlsConn.ConnectionState().PeerCertificates) > 0
+		}()
+		return ln, presented
+	}
+
+	proxy, proxyPresented := listen()
+	defer proxy.Close()
+	upstream, upstreamPresented := listen()
+	defer upstream.Close()
+
+	spec := &APISpec{APIDefinition: &apidef.APIDefinition{}}
+	spec.Proxy.Transport.ProxyURL = "https://" + proxy.Addr().String()
+	spec.Proxy.Transport.ProxyCertificateID = certID
+
+	dialTLS := proxyDialTLS(spec, &tls.Config{InsecureSkipVerify: true}, (&net.Dialer{}).DialContext, nil)
+	for _, addr := range []string{proxy.Addr().String(), upstream.Addr().String()} {
+		conn, err := dialTLS("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+	}
+
+	if !<-proxyPresented {
+		t.Error("Expected the client certificate to be presented to the proxy")
+	}
+	if <-upstreamPresented {
+		t.Error("Expected the client certificate not to be presented to the upstream")
+	}
+}
+
+func parseProxyAuthorization(r *http.Request) (string, string, bool) {
+	req := &http.Request{Header: http.Header{"Authorization": r.Header["Proxy-Authorization"]}}
+	return req.BasicAuth()
+}
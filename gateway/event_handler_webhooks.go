@@ -191,9 +191,9 @@ func (w *WebHookHandler) BuildRequest(reqBody string) (*http.Request, error) {
 
 	req.Header.Set(headers.UserAgent, headers.TykHookshot)
 
-	ignoreCanonical := config.Global().IgnoreCanonicalMIMEHeaderKey
+	casing := globalHeaderCasing()
 	for key, val := range w.conf.HeaderList {
-		setCustomHeader(req.Header, key, val, ignoreCanonical)
+		setCustomHeader(req.Header, key, val, casing)
 	}
 
 	if req.Header.Get(headers.ContentType) == "" {
@@ -34,6 +34,20 @@ const (
 	EventTokenCreated         apidef.TykEvent = "TokenCreated"
 	EventTokenUpdated         apidef.TykEvent = "TokenUpdated"
 	EventTokenDeleted         apidef.TykEvent = "TokenDeleted"
+	EventKeyExpiryReport      apidef.TykEvent = "KeyExpiryReport"
+	EventCertificateExpiring  apidef.TykEvent = "CertificateExpiring"
+	EventRequestReplayed      apidef.TykEvent = "RequestReplayed"
+	EventKeyIPViolation       apidef.TykEvent = "KeyIPViolation"
+	EventResponseSizeExceeded apidef.TykEvent = "ResponseSizeExceeded"
+	EventSlowRequest          apidef.TykEvent = "SlowRequest"
+	EventSLABreach            apidef.TykEvent = "SLABreach"
+	EventStaleResponseServed  apidef.TykEvent = "StaleResponseServed"
+	EventSelfProtection       apidef.TykEvent = "SelfProtection"
+	EventSessionFallback      apidef.TykEvent = "SessionFallback"
+
+	EventControlAPIRateLimitExceeded apidef.TykEvent = "ControlAPIRateLimitExceeded"
+	EventControlAPIAuthFailure       apidef.TykEvent = "ControlAPIAuthFailure"
+	EventControlAPILockout           apidef.TykEvent = "ControlAPILockout"
 )
 
 // EventMetaDefault is a standard embedded struct to be used with custom event metadata types, gives an interface for
@@ -88,6 +102,90 @@ type EventTokenMeta struct {
 	Key string
 }
 
+// EventKeyExpiryReportMeta is the metadata structure for the daily report of
+// keys that are about to expire.
+type EventKeyExpiryReportMeta struct {
+	EventMetaDefault
+	Report keyExpiryReport
+}
+
+// EventCertificateExpiringMeta is the metadata structure for a certificate
+// used by APIs that is about to expire.
+type EventCertificateExpiringMeta struct {
+	EventMetaDefault
+	Certificate expiringCertificate
+}
+
+// EventResponseSizeExceededMeta is the metadata structure for an upstream
+// response larger than the maximum size of its API.
+type EventResponseSizeExceededMeta struct {
+	EventMetaDefault
+	Path   string
+	Origin string
+	APIID  string
+	Limit  int64
+}
+
+// EventSlowRequestMeta is the metadata structure for a request slower than
+// the thresholds of its API. Times are in milliseconds, Gateway is the time
+// spent in the gateway rather than waiting on the upstream.
+type EventSlowRequestMeta struct {
+	EventMetaDefault
+	Path     string
+	Method   string
+	Origin   string
+	APIID    string
+	Total    int64
+	Upstream int64
+	Gateway  int64
+}
+
+// EventSLABreachMeta is the metadata structure for an API that stopped
+// meeting one of its service level objectives.
+type EventSLABreachMeta struct {
+	EventMetaDefault
+	APIID     string
+	Objective SLOCompliance
+}
+
+// EventStaleResponseMeta is the metadata structure for an expired cached
+// response served because the upstream failed.
+type EventStaleResponseMeta struct {
+	EventMetaDefault
+	Path   string
+	Origin string
+	APIID  string
+	Reason string
+}
+
+// EventSelfProtectionMeta is the metadata structure for the node entering or
+// leaving self-protection mode.
+type EventSelfProtectionMeta struct {
+	EventMetaDefault
+	Engaged    bool
+	HeapBytes  uint64
+	Goroutines int
+}
+
+// EventSessionFallbackMeta is the metadata structure for the session
+// fallback engaging or disengaging as Redis becomes unavailable or recovers.
+// Sessions is how many sessions the fallback holds.
+type EventSessionFallbackMeta struct {
+	EventMetaDefault
+	Engaged  bool
+	Sessions int
+}
+
+// EventControlAPIAccessMeta is the metadata structure for rejected and
+// failed control API requests. The originating request is left out not to
+// leak the attempted secret.
+type EventControlAPIAccessMeta struct {
+	EventMetaDefault
+	Path     string
+	Origin   string
+	Failures int
+}
+
 // EncodeRequestToEvent will write the request out in wire protocol and
 // encode it to base64 and store it in an Event object
 func EncodeRequestToEvent(r *http.Request) string {
@@ -0,0 +1,290 @@
+package gateway
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/ctx"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const (
+	fallbackCached   = "cached"
+	fallbackRedirect = "redirect"
+
+	// fallbackResponseTag tags the analytics of requests answered with a
+	// fallback response.
+	fallbackResponseTag = "fallback-response"
+
+	defaultFallbackMaxAge = time.Hour
+	// maxFallbackResponseSize is the size of the largest response kept
+	// for cached fallbacks.
+	maxFallbackResponseSize = 1 << 20
+	// maxFallbackResponses and maxFallbackResponsesSize bound the number
+	// and total body size of the responses kept for cached fallbacks, the
+	// least recently used being dropped first.
+	maxFallbackResponses     = 10000
+	maxFallbackResponsesSize = 64 << 20
+)
+
+// lastGoodResponses holds the last successful responses of endpoints with a
+// cached fallback, by lastGoodResponseKey.
+var lastGoodResponses = newLastGoodResponseCache(maxFallbackResponses, maxFallbackResponsesSize)
+
+type lastGoodResponse struct {
+	key     string
+	code    int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// lastGoodResponseCache is an LRU of the responses kept for cached
+// fallbacks, bounded by their number and the total size of their bodies.
+type lastGoodResponseCache struct {
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List
+	size     int
+	maxCount int
+	maxSize  int
+}
+
+func newLastGoodResponseCache(maxCount, maxSize int) *lastGoodResponseCache {
+	return &lastGoodResponseCache{
+		entries:  map[string]*list.Element{},
+		lru:      list.New(),
+		maxCount: maxCount,
+		maxSize:  maxSize,
+	}
+}
+
+func (c *lastGoodResponseCache) set(res *lastGoodResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[res.key]; ok {
+		c.remove(elem)
+	}
+	c.entries[res.key] = c.lru.PushFront(res)
+	c.size += len(res.body)
+	for c.lru.Len() > c.maxCount || c.size > c.maxSize {
+		c.remove(c.lru.Back())
+	}
+}
+
+// get returns the response kept for key, unless it expired.
+func (c *lastGoodResponseCache) get(key string) (*lastGoodResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	res := elem.Value.(*lastGoodResponse)
+	if time.Now().After(res.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return res, true
+}
+
+// remove must be called with c.mu held.
+func (c *lastGoodResponseCache) remove(elem *list.Element) {
+	res := c.lru.Remove(elem).(*lastGoodResponse)
+	delete(c.entries, res.key)
+	c.size -= len(res.body)
+}
+
+// flush drops all the responses kept.
+func (c *lastGoodResponseCache) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[string]*list.Element{}
+	c.lru.Init()
+	c.size = 0
+}
+
+func (c *lastGoodResponseCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// lastGoodResponseKey identifies the responses that can be served to a
+// request: those to the same method and URI, with the same key, so that the
+// response to one client is never served to another.
+func lastGoodResponseKey(spec *APISpec, r *http.Request) string {
+	return storage.HashStr(strings.Join([]string{spec.APIID, r.Method, r.URL.RequestURI(), ctxGetAuthToken(r)}, "|"), storage.HashSha256)
+}
+
+// fallbackFor returns the fallback of the endpoint of a request, if any.
+func (p *ReverseProxy) fallbackFor(r *http.Request) *apidef.FallbackMeta {
+	_, versionPaths, _, _ := p.TykAPISpec.Version(r)
+	found, meta := p.TykAPISpec.CheckSpecMatchesStatus(r, versionPaths, FallbackResponse)
+	if !found {
+		return nil
+	}
+	return meta.(*apidef.FallbackMeta)
+}
+
+// fallbackOnStatus reports whether an upstream status code is replaced by
+// the fallback.
+func fallbackOnStatus(meta *apidef.FallbackMeta, code int) bool {
+	for _, c := range meta.StatusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// keepLastGoodResponse keeps a successful response for the cached fallback
+// of its endpoint, unless it is too large. Its body is read, and replaced so
+// that it can still be sent to the client. It is kept as the upstream sent
+// it, the response chain running again when it is served.
+func (p *ReverseProxy) keepLastGoodResponse(r *http.Request, res *http.Response, meta *apidef.FallbackMeta) {
+	if res.StatusCode/100 != 2 || res.StatusCode == http.StatusPartialContent {
+		return
+	}
+
+	var buf bytes.Buffer
+	_, err := io.CopyN(&buf, res.Body, maxFallbackResponseSize+1)
+	if err != nil && err != io.EOF {
+		res.Body = readCloser{io.MultiReader(&buf, res.Body), res.Body}
+		return
+	}
+	if buf.Len() > maxFallbackResponseSize {
+		res.Body = readCloser{io.MultiReader(&buf, res.Body), res.Body}
+		return
+	}
+	res.Body.Close()
+	body := buf.Bytes()
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	header := res.Header.Clone()
+	for _, h := range hopHeaders {
+		header.Del(h)
+	}
+
+	maxAge := defaultFallbackMaxAge
+	if meta.MaxAge > 0 {
+		maxAge = time.Duration(meta.MaxAge) * time.Second
+	}
+	lastGoodResponses.set(&lastGoodResponse{
+		key:     lastGoodResponseKey(p.TykAPISpec, r),
+		code:    res.StatusCode,
+		header:  header,
+		body:    body,
+		expires: time.Now().Add(maxAge),
+	})
+}
+
+// servedFallback reports whether a request was answered with a fallback
+// response, which must not be cached as a response of the upstream.
+func servedFallback(r *http.Request) bool {
+	for _, tag := range ctx.GetAnalyticsTags(r) {
+		if tag == fallbackResponseTag {
+			return true
+		}
+	}
+	return false
+}
+
+// readCloser reads from a reader and closes a closer, such as a partly read
+// body.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// serveFallback writes the fallback response of an endpoint. It returns false
+// when it has none to write, for cached fallbacks without a response kept.
+func (p *ReverseProxy) serveFallback(rw http.ResponseWriter, r *http.Request, meta *apidef.FallbackMeta, upstreamLatency time.Duration) (ProxyResponse, bool) {
+	res := &http.Response{Header: http.Header{}}
+	var body []byte
+
+	switch meta.Type {
+	case fallbackCached:
+		kept, ok := lastGoodResponses.get(lastGoodResponseKey(p.TykAPISpec, r))
+		if !ok {
+			return ProxyResponse{}, false
+		}
+		res.StatusCode = kept.code
+		res.Header = kept.header.Clone()
+		body = kept.body
+	case fallbackRedirect:
+		res.StatusCode = http.StatusFound
+		res.Header.Set("Location", meta.RedirectURL)
+	default: // static
+		res.StatusCode = http.StatusOK
+		body = []byte(meta.Body)
+	}
+	if meta.Type != fallbackCached {
+		if meta.Code != 0 {
+			res.StatusCode = meta.Code
+		}
+		for name, value := range meta.Headers {
+			res.Header.Set(name, value)
+		}
+	}
+	res.ContentLength = int64(len(body))
+	res.Header.Set(headers.ContentLength, strconv.FormatInt(res.ContentLength, 10))
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	p.logger.WithField("type", meta.Type).Debug("Serving the fallback response")
+	ctx.AddAnalyticsTags(r, fallbackResponseTag)
+
+	// fallbacks are transformed, masked or encrypted as upstream responses
+	session := ctxGetSession(r)
+	if session == nil {
+		session = user.NewSessionState()
+	}
+	abortRequest, err := handleResponseChain(p.TykAPISpec.ResponseChain, rw, res, r, session)
+	if abortRequest {
+		return ProxyResponse{UpstreamLatency: upstreamLatency}, true
+	}
+	if err != nil {
+		p.logger.Error("Response chain failed! ", err)
+	}
+	body, err = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		p.logger.WithError(err).Error("Couldn't read the fallback response")
+	}
+	res.ContentLength = int64(len(body))
+	res.Header.Set(headers.ContentLength, strconv.FormatInt(res.ContentLength, 10))
+
+	copyHeader(rw.Header(), res.Header, p.TykAPISpec.headerCasing())
+	rw.WriteHeader(res.StatusCode)
+	rw.Write(body)
+
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return ProxyResponse{UpstreamLatency: upstreamLatency, Response: res}, true
+}
+
+// serveInsteadOfUpstream serves the fallback response of the endpoint of a
+// request, if any, or else its stale cached response if allowed, when its
+// upstream failed for reason. It returns false when it has neither.
+func (p *ReverseProxy) serveInsteadOfUpstream(rw http.ResponseWriter, r *http.Request, fallback *apidef.FallbackMeta, allowStale bool, upstreamLatency time.Duration, reason string) (ProxyResponse, bool) {
+	if fallback != nil {
+		if resp, ok := p.serveFallback(rw, r, fallback, upstreamLatency); ok {
+			return resp, true
+		}
+	}
+	if serveStale := ctxGetStaleResponse(r); allowStale && serveStale != nil {
+		serveStale(rw, reason)
+		return ProxyResponse{UpstreamLatency: upstreamLatency}, true
+	}
+	return ProxyResponse{}, false
+}
@@ -0,0 +1,142 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestFallbackResponses(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	var down int32
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, "%s hit %d", r.URL.Path, atomic.AddInt32(&hits, 1))
+	}))
+	defer upstream.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream.URL
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.UseExtendedPaths = true
+			v.ExtendedPaths.Fallback = []apidef.FallbackMeta{
+				{
+					Path: "/static", Method: http.MethodGet, StatusCodes: []int{http.StatusServiceUnavailable},
+					Type: "static", Code: http.StatusOK, Body: "static fallback",
+					Headers: map[string]string{"X-Fallback": "static"},
+				},
+				{Path: "/cached", Method: http.MethodGet, StatusCodes: []int{http.StatusServiceUnavailable}, Type: "cached"},
+				{
+					Path: "/redirect", Method: http.MethodGet, StatusCodes: []int{http.StatusServiceUnavailable},
+					Type: "redirect", RedirectURL: "https://status.example.com",
+				},
+				{Path: "/other-codes", Method: http.MethodGet, StatusCodes: []int{http.StatusBadGateway}, Body: "not served"},
+			}
+		})
+	})
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/static", Code: http.StatusOK, BodyMatch: "/static hit"},
+		{Path: "/cached", Code: http.StatusOK, BodyMatch: "/cached hit 2"},
+		{Path: "/cached?page=2", Code: http.StatusOK, BodyMatch: "/cached hit 3"},
+	}...)
+
+	atomic.StoreInt32(&down, 1)
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/static", Code: http.StatusOK, BodyMatch: "^static fallback$", HeadersMatch: map[string]string{"X-Fallback": "static"}},
+		{Path: "/cached", Code: http.StatusOK, BodyMatch: "^/cached hit 2$"},
+		{Path: "/cached?page=2", Code: http.StatusOK, BodyMatch: "^/cached hit 3$"},
+		// nothing kept for this request
+		{Path: "/cached?page=3", Code: http.StatusServiceUnavailable},
+		{Path: "/redirect", Code: http.StatusFound, HeadersMatch: map[string]string{"Location": "https://status.example.com"}},
+		{Path: "/other-codes", Code: http.StatusServiceUnavailable},
+	}...)
+}
+
+func TestFallbackResponseCircuitBreaker(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = "http://127.0.0.1:1"
+		spec.CircuitBreakerEnabled = true
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.UseExtendedPaths = true
+			v.ExtendedPaths.CircuitBreaker = []apidef.CircuitBreakerMeta{
+				{Path: "/", Method: http.MethodGet, ThresholdPercent: 0.5, Samples: 2, ReturnToServiceAfter: 60},
+			}
+			v.ExtendedPaths.Fallback = []apidef.FallbackMeta{
+				{Path: "/", Method: http.MethodGet, Type: "static", Code: http.StatusServiceUnavailable, Body: "down for maintenance"},
+			}
+		})
+	})
+
+	// served when the upstream can't be reached, then when the breaker is
+	// open
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/", Code: http.StatusServiceUnavailable, BodyMatch: "down for maintenance"},
+		{Path: "/", Code: http.StatusServiceUnavailable, BodyMatch: "down for maintenance"},
+		{Path: "/", Code: http.StatusServiceUnavailable, BodyMatch: "down for maintenance"},
+	}...)
+}
+
+func TestLastGoodResponseCache(t *testing.T) {
+	kept := func(key string, size int) *lastGoodResponse {
+		return &lastGoodResponse{key: key, body: make([]byte, size), expires: time.Now().Add(time.Minute)}
+	}
+
+	t.Run("bounded by count", func(t *testing.T) {
+		c := newLastGoodResponseCache(2, 100)
+		c.set(kept("a", 1))
+		c.set(kept("b", 1))
+		// keeps a from being the least recently used
+		c.get("a")
+		c.set(kept("c", 1))
+
+		assert.Equal(t, 2, c.len())
+		_, found := c.get("b")
+		assert.False(t, found)
+		_, found = c.get("a")
+		assert.True(t, found)
+	})
+
+	t.Run("bounded by size", func(t *testing.T) {
+		c := newLastGoodResponseCache(10, 100)
+		c.set(kept("a", 60))
+		c.set(kept("b", 30))
+		c.set(kept("b", 50))
+
+		assert.Equal(t, 1, c.len())
+		assert.Equal(t, 50, c.size)
+		_, found := c.get("a")
+		assert.False(t, found)
+	})
+
+	t.Run("expires", func(t *testing.T) {
+		c := newLastGoodResponseCache(10, 100)
+		expired := kept("a", 1)
+		expired.expires = time.Now().Add(-time.Second)
+		c.set(expired)
+
+		_, found := c.get("a")
+		assert.False(t, found)
+		assert.Equal(t, 0, c.size)
+	})
+}
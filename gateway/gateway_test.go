@@ -1979,6 +1979,59 @@ func TestTracing(t *testing.T) {
 	})
 }
 
+func TestAPITracing(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "trace"
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = "http://upstream.invalid"
+	})
+
+	keyID := CreateSession()
+	limitedKeyID := CreateSession(func(s *user.SessionState) {
+		s.QuotaMax = 1
+		s.QuotaRemaining = 1
+		s.QuotaRenewalRate = 3600
+	})
+	limitedTrace := apiTraceRequest{traceHttpRequest: traceHttpRequest{Method: "GET", Path: "/get"}, Key: limitedKeyID}
+
+	ts.Run(t, []test.TestCase{
+		{Method: "POST", Path: "/tyk/debug/unknown", Data: `{}`, AdminAuth: true, Code: 404},
+		{Method: "POST", Path: "/tyk/debug/trace", AdminAuth: true, Code: 400, BodyMatch: "Request malformed"},
+		{Method: "POST", Path: "/tyk/debug/trace", Data: apiTraceRequest{traceHttpRequest: traceHttpRequest{Method: "GET", Path: "/"}},
+			AdminAuth: true, Code: 200, BodyMatch: `"middleware":"AuthKey","code":401`},
+		{Method: "POST", Path: "/tyk/debug/trace", Data: apiTraceRequest{traceHttpRequest: traceHttpRequest{Method: "GET", Path: "/get"}, Key: keyID},
+			AdminAuth: true, Code: 200, BodyMatch: `200 OK.*\\"path\\":\\"/get\\"`},
+		// tracing doesn't use up the quota of the key
+		{Method: "POST", Path: "/tyk/debug/trace", Data: limitedTrace, AdminAuth: true, Code: 200, BodyMatch: `200 OK`},
+		{Method: "POST", Path: "/tyk/debug/trace", Data: limitedTrace, AdminAuth: true, Code: 200, BodyMatch: `200 OK`},
+	}...)
+
+	if spec := getApiSpec("trace"); spec.Proxy.TargetURL != "http://upstream.invalid" {
+		t.Error("Tracing should not modify loaded API, got target ", spec.Proxy.TargetURL)
+	}
+
+	t.Run("Cached API", func(t *testing.T) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.APIID = "trace"
+			spec.Proxy.ListenPath = "/"
+			spec.Proxy.TargetURL = "http://upstream.invalid"
+			spec.CacheOptions.EnableCache = true
+			spec.CacheOptions.CacheAllSafeRequests = true
+		})
+
+		// the response of the traced request isn't cached for the API
+		ts.Run(t, []test.TestCase{
+			{Method: "POST", Path: "/tyk/debug/trace", Data: apiTraceRequest{traceHttpRequest: traceHttpRequest{Method: "GET", Path: "/cached"}},
+				AdminAuth: true, Code: 200, BodyMatch: `200 OK`},
+			{Path: "/cached", BodyNotMatch: `"path":"/cached"`},
+		}...)
+	})
+}
+
 func TestBrokenClients(t *testing.T) {
 	ts := StartTest()
 	defer ts.Close()
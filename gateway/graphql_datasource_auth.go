@@ -0,0 +1,169 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/certs"
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+// clientCredentialsExpiryDelta is how long before they expire access tokens
+// are renewed, so that they don't expire on the way to the upstream.
+const clientCredentialsExpiryDelta = 10 * time.Second
+
+// clientCredentialsTokenSource fetches access tokens with the OAuth2 client
+// credentials grant, and caches them until they expire.
+type clientCredentialsTokenSource struct {
+	conf   apidef.ClientCredentialsConfig
+	client *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func (s *clientCredentialsTokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && (s.expiry.IsZero() || time.Now().Before(s.expiry)) {
+		return s.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(s.conf.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.conf.Scopes, " "))
+	}
+	req, err := http.NewRequest(http.MethodPost, s.conf.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(headers.ContentType, "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(s.conf.ClientID), url.QueryEscape(s.conf.ClientSecret))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint responded with status %d", resp.StatusCode)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("token endpoint responded without an access token")
+	}
+
+	s.token = token.AccessToken
+	s.expiry = time.Time{}
+	if token.ExpiresIn > 0 {
+		s.expiry = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - clientCredentialsExpiryDelta)
+	}
+	return s.token, nil
+}
+
+// Reset drops the cached token, such as when the upstream rejects it.
+func (s *clientCredentialsTokenSource) Reset() {
+	s.mu.Lock()
+	s.token = ""
+	s.mu.Unlock()
+}
+
+// dataSourceAuthTransport authenticates the requests of the execution engine
+// to the upstream of a data source.
+type dataSourceAuthTransport struct {
+	spec *APISpec
+	auth apidef.GraphQLEngineDataSourceAuth
+	// transport presents the client certificate of the data source, or is
+	// nil to go through the transport of the API.
+	transport http.RoundTripper
+	tokens    *clientCredentialsTokenSource
+}
+
+func (t *dataSourceAuthTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+
+	if t.tokens != nil {
+		token, err := t.tokens.Token()
+		if err != nil {
+			return nil, fmt.Errorf("couldn't fetch an access token for the data source: %v", err)
+		}
+		if t.auth.OAuth2.Header != "" {
+			r.Header.Set(t.auth.OAuth2.Header, token)
+		} else {
+			r.Header.Set(headers.Authorization, "Bearer "+token)
+		}
+	}
+
+	if t.auth.RequestSigning.IsEnabled {
+		if err := signRequest(r, t.auth.RequestSigning, supportedAlgorithms, r.URL.RequestURI()); err != nil {
+			return nil, err
+		}
+	}
+
+	transport := t.transport
+	if transport == nil {
+		transport = t.spec.GraphQLExecutor.Client.Transport
+	}
+	resp, err := transport.RoundTrip(r)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && t.tokens != nil {
+		t.tokens.Reset()
+	}
+	return resp, err
+}
+
+// graphQLDataSourceClients creates the HTTP clients of the data sources
+// authenticating to their upstream, by data source name. The others use the
+// client of the API.
+func graphQLDataSourceClients(spec *APISpec, dataSources []apidef.GraphQLEngineDataSource) (map[string]*http.Client, error) {
+	clients := map[string]*http.Client{}
+	for _, ds := range dataSources {
+		auth := ds.UpstreamAuth
+		if !auth.OAuth2.Enabled && !auth.RequestSigning.IsEnabled && auth.CertificateID == "" {
+			continue
+		}
+
+		transport := &dataSourceAuthTransport{spec: spec, auth: auth}
+		tlsConfig := tlsClientConfig(spec)
+
+		if auth.CertificateID != "" {
+			certList := CertificateManager.List([]string{auth.CertificateID}, certs.CertificatePrivate)
+			if len(certList) == 0 || certList[0] == nil {
+				return nil, fmt.Errorf("data source %q: certificate %q not found", ds.Name, auth.CertificateID)
+			}
+			tlsConfig.Certificates = []tls.Certificate{*certList[0]}
+			transport.transport = &http.Transport{TLSClientConfig: tlsConfig, Proxy: proxyFromAPI(spec)}
+		}
+
+		if auth.OAuth2.Enabled {
+			if auth.OAuth2.TokenURL == "" || auth.OAuth2.ClientID == "" {
+				return nil, fmt.Errorf("data source %q: token URL and client ID are required for OAuth2", ds.Name)
+			}
+			transport.tokens = &clientCredentialsTokenSource{
+				conf: auth.OAuth2,
+				client: &http.Client{
+					Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: proxyFromAPI(spec)},
+					Timeout:   30 * time.Second,
+				},
+			}
+		}
+
+		clients[ds.Name] = &http.Client{Transport: transport}
+	}
+	return clients, nil
+}
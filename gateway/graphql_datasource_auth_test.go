@@ -0,0 +1,143 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func testTokenServer(t *testing.T, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		id, secret, _ := r.BasicAuth()
+		r.ParseForm()
+		if id != "client" || secret != "secret" || r.Form.Get("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"token-` + r.Form.Get("scope") + `","token_type":"bearer","expires_in":3600}`))
+	}))
+}
+
+func TestClientCredentialsTokenSource(t *testing.T) {
+	var calls int32
+	tokenServer := testTokenServer(t, &calls)
+	defer tokenServer.Close()
+
+	source := &clientCredentialsTokenSource{
+		conf: apidef.ClientCredentialsConfig{
+			ClientID: "client", ClientSecret: "secret", TokenURL: tokenServer.URL, Scopes: []string{"read"},
+		},
+		client: http.DefaultClient,
+	}
+
+	for i := 0; i < 2; i++ {
+		token, err := source.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "token-read" {
+			t.Errorf("Expected token-read, got %q", token)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected the token to be cached, token endpoint called %d times", calls)
+	}
+
+	source.Reset()
+	source.Token()
+	if calls != 2 {
+		t.Errorf("Expected a new token after a reset, token endpoint called %d times", calls)
+	}
+
+	source = &clientCredentialsTokenSource{
+		conf:   apidef.ClientCredentialsConfig{ClientID: "client", ClientSecret: "wrong", TokenURL: tokenServer.URL},
+		client: http.DefaultClient,
+	}
+	if _, err := source.Token(); err == nil {
+		t.Error("Expected the rejected credentials to fail")
+	}
+}
+
+func TestGraphQL_DataSourceUpstreamAuth(t *testing.T) {
+	var calls int32
+	tokenServer := testTokenServer(t, &calls)
+	defer tokenServer.Close()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"authorization": r.Header.Get("Authorization"),
+			"signed":        strings.HasPrefix(r.Header.Get("Signature"), `Signature keyId="upstream"`),
+		})
+	}))
+	defer upstream.Close()
+
+	g := StartTest()
+	defer g.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = true
+		spec.Proxy.ListenPath = "/"
+		spec.GraphQL.Enabled = true
+		spec.GraphQL.ExecutionMode = apidef.GraphQLExecutionModeExecutionEngine
+		spec.GraphQL.Version = apidef.GraphQLConfigVersion2
+		spec.GraphQL.Schema = "type Query {secret: Secret} type Secret {authorization: String signed: Boolean}"
+		spec.GraphQL.Engine.FieldConfigs = []apidef.GraphQLFieldConfig{
+			{TypeName: "Query", FieldName: "secret", DisableDefaultMapping: true, Path: []string{""}},
+		}
+		spec.GraphQL.Engine.DataSources = []apidef.GraphQLEngineDataSource{{
+			Kind:       apidef.GraphQLEngineDataSourceKindREST,
+			Name:       "secret",
+			RootFields: []apidef.GraphQLTypeFields{{Type: "Query", Fields: []string{"secret"}}},
+			Config:     json.RawMessage(`{"url":"` + upstream.URL + `","method":"GET"}`),
+			UpstreamAuth: apidef.GraphQLEngineDataSourceAuth{
+				OAuth2: apidef.ClientCredentialsConfig{
+					Enabled: true, ClientID: "client", ClientSecret: "secret", TokenURL: tokenServer.URL,
+				},
+				RequestSigning: apidef.RequestSigningMeta{
+					IsEnabled: true, KeyId: "upstream", Secret: "signing-secret", Algorithm: "hmac-sha256",
+					SignatureHeader: "Signature",
+				},
+			},
+		}}
+	})
+
+	query := graphql.Request{Query: "query Query { secret { authorization signed } }"}
+	_, _ = g.Run(t, []test.TestCase{
+		{Data: query, Code: http.StatusOK, BodyMatch: `"authorization":"Bearer token-","signed":true`},
+		{Data: query, Code: http.StatusOK, BodyMatch: `"authorization":"Bearer token-","signed":true`},
+	}...)
+
+	if calls != 1 {
+		t.Errorf("Expected the token to be cached, token endpoint called %d times", calls)
+	}
+}
+
+func TestGraphQL_DataSourceUpstreamAuthInvalid(t *testing.T) {
+	spec := BuildAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.GraphQL.Enabled = true
+		spec.GraphQL.ExecutionMode = apidef.GraphQLExecutionModeExecutionEngine
+		spec.GraphQL.Version = apidef.GraphQLConfigVersion2
+		spec.GraphQL.Engine.DataSources = []apidef.GraphQLEngineDataSource{{
+			Name: "secret",
+			UpstreamAuth: apidef.GraphQLEngineDataSourceAuth{
+				OAuth2: apidef.ClientCredentialsConfig{Enabled: true, ClientID: "client"},
+			},
+		}}
+	})[0]
+
+	err := specLoadError(spec)
+	if err == nil || !strings.Contains(err.Error(), "token URL and client ID are required") {
+		t.Errorf("Expected the API not to load, got %v", err)
+	}
+}
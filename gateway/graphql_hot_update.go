@@ -0,0 +1,256 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jensneuse/abstractlogger"
+	"github.com/jensneuse/graphql-go-tools/pkg/astparser"
+	gql "github.com/jensneuse/graphql-go-tools/pkg/graphql"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/apidef/adapter"
+	"github.com/TykTechnologies/tyk/config"
+)
+
+// graphQLUpdate is a new schema of a GraphQL API, and the data sources
+// (subgraphs) its fields are resolved from by the execution engine.
+type graphQLUpdate struct {
+	Schema       string                           `json:"schema"`
+	DataSources  []apidef.GraphQLEngineDataSource `json:"data_sources"`
+	FieldConfigs []apidef.GraphQLFieldConfig      `json:"field_configs"`
+}
+
+// graphQLUpdateResult is the outcome of a GraphQL update, which isn't
+// persisted for APIs not loaded from a file of the app path.
+type graphQLUpdateResult struct {
+	apiModifyKeySuccess
+	Persisted bool `json:"persisted"`
+}
+
+// graphQLUpdateMu serialises the GraphQL updates, for each to be persisted
+// and applied before the next one.
+var graphQLUpdateMu sync.Mutex
+
+// validateGraphQLComposition checks that a schema is valid, and that the
+// root fields of each data source exist in it.
+func validateGraphQLComposition(conf apidef.GraphQLConfig) error {
+	result, err := gql.ValidateSchemaString(conf.Schema)
+	if err != nil {
+		return err
+	}
+	if !result.Valid {
+		if result.Errors != nil && result.Errors.Count() > 0 {
+			return fmt.Errorf("invalid schema: %v", result.Errors.ErrorByIndex(0))
+		}
+		return fmt.Errorf("invalid schema")
+	}
+
+	doc, report := astparser.ParseGraphqlDocumentString(conf.Schema)
+	if report.HasErrors() {
+		return fmt.Errorf("invalid schema: %s", report.Error())
+	}
+	for _, ds := range conf.Engine.DataSources {
+		for _, root := range ds.RootFields {
+			node, ok := doc.Index.FirstNodeByNameStr(root.Type)
+			if !ok {
+				return fmt.Errorf("data source %q: type %q is not in the schema", ds.Name, root.Type)
+			}
+			for _, field := range root.Fields {
+				if _, ok := doc.NodeFieldDefinitionByName(node, []byte(field)); !ok {
+					return fmt.Errorf("data source %q: field %s.%s is not in the schema", ds.Name, root.Type, field)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// buildGraphQLEngine creates the schema and the execution engine of a
+// GraphQL configuration, without touching the running ones.
+func buildGraphQLEngine(spec *APISpec, conf apidef.GraphQLConfig) (*gql.Schema, *gql.ExecutionEngineV2, error) {
+	schema, err := gql.NewSchemaFromString(conf.Schema)
+	if err != nil {
+		return nil, nil, err
+	}
+	if conf.ExecutionMode != apidef.GraphQLExecutionModeExecutionEngine {
+		return schema, nil, nil
+	}
+
+	configAdapter := adapter.NewGraphQLConfigAdapter(conf)
+	configAdapter.SetHttpClient(spec.GraphQLExecutor.Client)
+	dataSourceClients, err := graphQLDataSourceClients(spec, conf.Engine.DataSources)
+	if err != nil {
+		return nil, nil, err
+	}
+	configAdapter.SetDataSourceHttpClients(dataSourceClients)
+	engineConfig, err := configAdapter.EngineConfigV2()
+	if err != nil {
+		return nil, nil, err
+	}
+	absLogger := abstractlogger.NewLogrusLogger(log, absLoggerLevel(log.Level))
+	engine, err := gql.NewExecutionEngineV2(absLogger, *engineConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	return schema, engine, nil
+}
+
+// persistAPIDefinition writes the definition of an API loaded from the app
+// path back to its file, so that updates made at runtime survive reloads.
+// It reports whether there was such a file, which is never left half
+// written.
+func persistAPIDefinition(def *apidef.APIDefinition) (bool, error) {
+	defFilePath := filepath.Join(config.Global().AppPath, def.APIID+".json")
+	info, err := os.Stat(defFilePath)
+	if err != nil {
+		return false, nil
+	}
+	asByte, err := json.MarshalIndent(def, "", "  ")
+	if err != nil {
+		return false, err
+	}
+
+	if err := writeFileAtomic(defFilePath, asByte, info.Mode().Perm()); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// graphQLUpdateHandler swaps the schema and data sources of a GraphQL API
+// once they are validated and persisted, without reloading the gateway. The
+// definitions of the APIs loaded from the Dashboard or MDCB aren't theirs to
+// update, and would be reverted on reload.
+func graphQLUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	if config.Global().UseDBAppConfigs {
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Due to enabled use_db_app_configs, please use the Dashboard API"))
+		return
+	}
+	if config.Global().SlaveOptions.UseRPC {
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Due to enabled slave_options.use_rpc, please use the Dashboard API"))
+		return
+	}
+
+	apiID := mux.Vars(r)["apiID"]
+	spec := getApiSpec(apiID)
+	if spec == nil {
+		doJSONWrite(w, http.StatusNotFound, apiError("API not found"))
+		return
+	}
+	if !spec.GraphQL.Enabled {
+		doJSONWrite(w, http.StatusBadRequest, apiError("API is not a GraphQL API"))
+		return
+	}
+
+	var update graphQLUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+		return
+	}
+
+	graphQLUpdateMu.Lock()
+	defer graphQLUpdateMu.Unlock()
+
+	// the update is applied to the definition as it was loaded, to be
+	// persisted with its references unexpanded, and expanded the way it is
+	// at load for the running engine
+	def := *spec.storedDefinition()
+	def.GraphQL.Schema = update.Schema
+	if update.DataSources != nil {
+		def.GraphQL.Engine.DataSources = update.DataSources
+	}
+	if update.FieldConfigs != nil {
+		def.GraphQL.Engine.FieldConfigs = update.FieldConfigs
+	}
+	now := time.Now()
+	def.GraphQL.LastSchemaUpdate = &now
+
+	conf := def.GraphQL
+	if config.Global().ExpandAPIDefinitions {
+		expanded, err := expandedAPIDefinition(&def)
+		if err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+			return
+		}
+		conf = expanded.GraphQL
+	}
+
+	if conf.ExecutionMode == apidef.GraphQLExecutionModeExecutionEngine && conf.Version != apidef.GraphQLConfigVersion2 {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Only engine v2 configurations can be updated at runtime"))
+		return
+	}
+
+	if err := validateGraphQLComposition(conf); err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+		return
+	}
+	schema, engine, err := buildGraphQLEngine(spec, conf)
+	if err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Couldn't build the execution engine: "+err.Error()))
+		return
+	}
+
+	logger := log.WithFields(logrus.Fields{"prefix": "api", "api_id": apiID})
+	persisted, err := persistAPIDefinition(&def)
+	if err != nil {
+		logger.WithError(err).Error("Couldn't persist the updated GraphQL configuration")
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Couldn't persist the GraphQL configuration"))
+		return
+	}
+	if !persisted {
+		logger.Warning("GraphQL configuration updated for this gateway only, the API wasn't loaded from a file of the app path")
+	}
+
+	// only the updated fields are written, the others being read by
+	// requests without the lock
+	spec.Lock()
+	spec.GraphQL.Schema = conf.Schema
+	spec.GraphQL.Engine.DataSources = conf.Engine.DataSources
+	spec.GraphQL.Engine.FieldConfigs = conf.Engine.FieldConfigs
+	spec.GraphQL.LastSchemaUpdate = conf.LastSchemaUpdate
+	spec.GraphQLExecutor.Schema = schema
+	if engine != nil {
+		spec.GraphQLExecutor.EngineV2 = engine
+	}
+	if spec.rawDefinition != nil {
+		spec.rawDefinition = &def
+	}
+	spec.Unlock()
+	logger.Info("Updated GraphQL schema and data sources")
+
+	doJSONWrite(w, http.StatusOK, graphQLUpdateResult{
+		apiModifyKeySuccess: apiModifyKeySuccess{Key: apiID, Status: "ok", Action: "modified"},
+		Persisted:           persisted,
+	})
+}
+
+// graphQLPlaygroundSchema returns the current schema of a GraphQL API, for
+// its playground.
+func (a *APISpec) graphQLPlaygroundSchema() string {
+	a.RLock()
+	defer a.RUnlock()
+	return a.GraphQL.Schema
+}
+
+// graphQLSchema returns the current schema of a GraphQL API, which may be
+// swapped at runtime.
+func (a *APISpec) graphQLSchema() *gql.Schema {
+	a.RLock()
+	defer a.RUnlock()
+	return a.GraphQLExecutor.Schema
+}
+
+// graphQLEngineV2 returns the current execution engine of a GraphQL API,
+// which may be swapped at runtime.
+func (a *APISpec) graphQLEngineV2() *gql.ExecutionEngineV2 {
+	a.RLock()
+	defer a.RUnlock()
+	return a.GraphQLExecutor.EngineV2
+}
@@ -0,0 +1,187 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestValidateGraphQLComposition(t *testing.T) {
+	var ds apidef.GraphQLEngineDataSource
+	if err := json.Unmarshal([]byte(testRESTDataSourceConfigurationV2), &ds); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := apidef.GraphQLConfig{Schema: testComposedSchema}
+	conf.Engine.DataSources = []apidef.GraphQLEngineDataSource{ds}
+	if err := validateGraphQLComposition(conf); err != nil {
+		t.Error(err)
+	}
+
+	conf.Schema = "type Query {countries: [Country]} type Country {code: String}"
+	if err := validateGraphQLComposition(conf); err == nil {
+		t.Error("Expected a data source field missing from the schema to be rejected")
+	}
+
+	conf.Schema = "type Query {"
+	if err := validateGraphQLComposition(conf); err == nil {
+		t.Error("Expected an invalid schema to be rejected")
+	}
+}
+
+func TestGraphQLUpdate(t *testing.T) {
+	g := StartTest()
+	defer g.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "gql"
+		spec.Proxy.ListenPath = "/"
+		spec.GraphQL.Enabled = true
+		spec.GraphQL.ExecutionMode = apidef.GraphQLExecutionModeExecutionEngine
+		spec.GraphQL.Version = apidef.GraphQLConfigVersion2
+	})
+
+	var ds apidef.GraphQLEngineDataSource
+	if err := json.Unmarshal([]byte(testRESTHeadersDataSourceConfigurationV2), &ds); err != nil {
+		t.Fatal(err)
+	}
+	update := graphQLUpdate{
+		Schema:      "type Query {headers: [Header]} type Header {name: String value: String}",
+		DataSources: []apidef.GraphQLEngineDataSource{ds},
+		FieldConfigs: []apidef.GraphQLFieldConfig{
+			{TypeName: "Query", FieldName: "headers", DisableDefaultMapping: true, Path: []string{""}},
+		},
+	}
+	invalid := graphQLUpdate{Schema: "type Query {people: [String]}", DataSources: update.DataSources}
+
+	people := graphql.Request{Query: "query Query { people { name } }"}
+	headers := graphql.Request{Query: "query Query { headers { name } }"}
+
+	_, _ = g.Run(t, []test.TestCase{
+		{Method: http.MethodPut, Path: "/tyk/apis/unknown/graphql", AdminAuth: true, Data: update, Code: http.StatusNotFound},
+		{Method: http.MethodPut, Path: "/tyk/apis/gql/graphql", AdminAuth: true, Data: invalid, Code: http.StatusBadRequest,
+			BodyMatch: `field Query.headers is not in the schema`},
+		{Data: people, Code: http.StatusOK},
+		{Method: http.MethodPut, Path: "/tyk/apis/gql/graphql", AdminAuth: true, Data: update, Code: http.StatusOK,
+			BodyMatch: `"persisted":false`},
+		{Data: people, Code: http.StatusBadRequest},
+		{Data: headers, Code: http.StatusOK, BodyMatch: `"headers":`},
+	}...)
+}
+
+func TestGraphQLUpdate_ExpandedReferences(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.ExpandAPIDefinitions = true
+	globalConf.APIDefinitionVariables = map[string]string{"FIELD": "headers"}
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	g := StartTest()
+	defer g.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "gql"
+		spec.Proxy.ListenPath = "/"
+		spec.GraphQL.Enabled = true
+		spec.GraphQL.ExecutionMode = apidef.GraphQLExecutionModeExecutionEngine
+		spec.GraphQL.Version = apidef.GraphQLConfigVersion2
+	})
+
+	var ds apidef.GraphQLEngineDataSource
+	if err := json.Unmarshal([]byte(testRESTHeadersDataSourceConfigurationV2), &ds); err != nil {
+		t.Fatal(err)
+	}
+	ds.RootFields = []apidef.GraphQLTypeFields{{Type: "Query", Fields: []string{"${FIELD}"}}}
+	update := graphQLUpdate{
+		Schema:      "type Query {headers: [Header]} type Header {name: String value: String}",
+		DataSources: []apidef.GraphQLEngineDataSource{ds},
+		FieldConfigs: []apidef.GraphQLFieldConfig{
+			{TypeName: "Query", FieldName: "${FIELD}", DisableDefaultMapping: true, Path: []string{""}},
+		},
+	}
+
+	_, _ = g.Run(t, []test.TestCase{
+		{Method: http.MethodPut, Path: "/tyk/apis/gql/graphql", AdminAuth: true, Data: update, Code: http.StatusOK},
+		{Data: graphql.Request{Query: "query Query { headers { name } }"}, Code: http.StatusOK, BodyMatch: `"headers":`},
+	}...)
+
+	spec := getApiSpec("gql")
+	stored := spec.storedDefinition().GraphQL.Engine
+	if got := stored.FieldConfigs[0].FieldName; got != "${FIELD}" {
+		t.Errorf("Expected the stored field config to keep its reference, got %q", got)
+	}
+	if got := stored.DataSources[0].RootFields[0].Fields[0]; got != "${FIELD}" {
+		t.Errorf("Expected the stored data source to keep its reference, got %q", got)
+	}
+	spec.RLock()
+	live := spec.GraphQL.Engine.FieldConfigs[0].FieldName
+	spec.RUnlock()
+	if live != "headers" {
+		t.Errorf("Expected the running field config to be expanded, got %q", live)
+	}
+}
+
+func TestGraphQLUpdate_DBAppConfigs(t *testing.T) {
+	g := StartTest()
+	defer g.Close()
+
+	globalConf := config.Global()
+	globalConf.UseDBAppConfigs = true
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	_, _ = g.Run(t, test.TestCase{Method: http.MethodPut, Path: "/tyk/apis/gql/graphql", AdminAuth: true,
+		Data: graphQLUpdate{}, Code: http.StatusInternalServerError, BodyMatch: "please use the Dashboard API"})
+}
+
+func TestPersistAPIDefinition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	globalConf := config.Global()
+	defer config.SetGlobal(globalConf)
+	conf := config.Global()
+	conf.AppPath = dir
+	config.SetGlobal(conf)
+
+	def := &apidef.APIDefinition{APIID: "gql"}
+	if persisted, err := persistAPIDefinition(def); err != nil || persisted {
+		t.Fatalf("Expected an API without file not to be persisted, got %v, %v", persisted, err)
+	}
+
+	defFilePath := filepath.Join(dir, "gql.json")
+	if err := ioutil.WriteFile(defFilePath, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	def.GraphQL.Schema = "type Query {a: String}"
+	if persisted, err := persistAPIDefinition(def); err != nil || !persisted {
+		t.Fatalf("Expected the API to be persisted, got %v, %v", persisted, err)
+	}
+
+	var persistedDef apidef.APIDefinition
+	data, _ := ioutil.ReadFile(defFilePath)
+	if err := json.Unmarshal(data, &persistedDef); err != nil {
+		t.Fatal(err)
+	}
+	if persistedDef.GraphQL.Schema != def.GraphQL.Schema {
+		t.Errorf("Expected the schema to be persisted, got %q", persistedDef.GraphQL.Schema)
+	}
+	if info, _ := os.Stat(defFilePath); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the file mode to be kept, got %v", info.Mode().Perm())
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Expected no temporary file to be left, got %d files", len(files))
+	}
+}
@@ -0,0 +1,278 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/jensneuse/abstractlogger"
+	gql "github.com/jensneuse/graphql-go-tools/pkg/graphql"
+	"github.com/jensneuse/graphql-go-tools/pkg/subscription"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+const graphQLSSEContentType = "text/event-stream"
+
+// graphQLSSEOperationID is the ID of the single operation of a graphql-sse
+// connection in distinct connections mode.
+const graphQLSSEOperationID = "1"
+
+// isGraphQLSSERequest reports whether the client asks for the results of an
+// operation as a stream of server-sent events, following the graphql-sse
+// protocol.
+func isGraphQLSSERequest(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get(headers.Accept), ",") {
+		mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(accept))
+		if mediaType == graphQLSSEContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// graphQLRequestFromQuery reads an operation sent as the query parameters of
+// a GET request.
+func graphQLRequestFromQuery(query url.Values) (gqlRequest gql.Request, err error) {
+	gqlRequest.Query = query.Get("query")
+	gqlRequest.OperationName = query.Get("operationName")
+	if variables := query.Get("variables"); variables != "" {
+		if !json.Valid([]byte(variables)) {
+			return gqlRequest, errors.New("variables are not valid JSON")
+		}
+		gqlRequest.Variables = json.RawMessage(variables)
+	}
+	if gqlRequest.Query == "" {
+		return gqlRequest, gql.ErrEmptyRequest
+	}
+	return gqlRequest, nil
+}
+
+// graphQLSSEClient is a subscription client writing the results of a single
+// operation as server-sent events. Each event is checked before being sent,
+// so a subscription stops as soon as the caller is no longer allowed to
+// receive it.
+type graphQLSSEClient struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	ctx     context.Context
+	check   func() error
+
+	mu        sync.Mutex
+	pending   []*subscription.Message
+	connected bool
+	done      chan struct{}
+}
+
+func newGraphQLSSEClient(ctx context.Context, w http.ResponseWriter, payload []byte, check func() error) (*graphQLSSEClient, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming is not supported by the response writer")
+	}
+	return &graphQLSSEClient{
+		w:       w,
+		flusher: flusher,
+		ctx:     ctx,
+		check:   check,
+		pending: []*subscription.Message{
+			{Type: subscription.MessageTypeConnectionInit},
+			{Id: graphQLSSEOperationID, Type: subscription.MessageTypeStart, Payload: payload},
+		},
+		connected: true,
+		done:      make(chan struct{}),
+	}, nil
+}
+
+func (c *graphQLSSEClient) ReadFromClient() (*subscription.Message, error) {
+	c.mu.Lock()
+	if len(c.pending) > 0 {
+		message := c.pending[0]
+		c.pending = c.pending[1:]
+		c.mu.Unlock()
+		return message, nil
+	}
+	c.mu.Unlock()
+
+	// the client can't send anything else, wait for the stream to end
+	select {
+	case <-c.ctx.Done():
+	case <-c.done:
+	}
+	return &subscription.Message{Type: subscription.MessageTypeConnectionTerminate}, nil
+}
+
+func (c *graphQLSSEClient) WriteToClient(message subscription.Message) error {
+	switch message.Type {
+	case subscription.MessageTypeConnectionAck:
+		return nil
+	case subscription.MessageTypeConnectionKeepAlive:
+		return c.write(":\n\n")
+	case subscription.MessageTypeData:
+		if err := c.check(); err != nil {
+			c.write(graphQLSSEEvent("next", graphQLSSEErrors(err.Error())))
+			return c.complete()
+		}
+		return c.write(graphQLSSEEvent("next", message.Payload))
+	case subscription.MessageTypeError, subscription.MessageTypeConnectionError:
+		c.write(graphQLSSEEvent("next", graphQLSSEErrorPayload(message.Payload)))
+		return c.complete()
+	case subscription.MessageTypeComplete:
+		return c.complete()
+	}
+	return nil
+}
+
+func (c *graphQLSSEClient) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected && c.ctx.Err() == nil
+}
+
+func (c *graphQLSSEClient) Disconnect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.connected {
+		c.connected = false
+		close(c.done)
+	}
+	return nil
+}
+
+// complete ends the stream, as a connection carries a single operation.
+func (c *graphQLSSEClient) complete() error {
+	err := c.write(graphQLSSEEvent("complete", nil))
+	c.Disconnect()
+	return err
+}
+
+func (c *graphQLSSEClient) write(event string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected {
+		return nil
+	}
+	if _, err := c.w.Write([]byte(event)); err != nil {
+		return err
+	}
+	c.flusher.Flush()
+	return nil
+}
+
+func graphQLSSEEvent(event string, data []byte) string {
+	return fmt.Sprintf("event: %s\ndata: %s\n\n", event, data)
+}
+
+func graphQLSSEErrors(message string) []byte {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"errors": []map[string]string{{"message": message}},
+	})
+	return payload
+}
+
+// graphQLSSEErrorPayload turns the payload of an error message, either a
+// message or a list of GraphQL errors, into an execution result.
+func graphQLSSEErrorPayload(payload json.RawMessage) []byte {
+	var message string
+	if err := json.Unmarshal(payload, &message); err == nil {
+		return graphQLSSEErrors(message)
+	}
+	result, _ := json.Marshal(map[string]json.RawMessage{"errors": payload})
+	return result
+}
+
+// graphQLSubscriptionEventCheck returns the checks applied to each event of
+// a subscription: the key must still be valid, within its rate limit and
+// quota, and allowed to run the operation.
+func (p *ReverseProxy) graphQLSubscriptionEventCheck(r *http.Request, gqlRequest *gql.Request) func() error {
+	spec := p.TykAPISpec
+	token := ctxGetAuthToken(r)
+	return func() error {
+		if ctxGetSession(r) == nil {
+			return nil
+		}
+
+		base := BaseMiddleware{Spec: spec, logger: p.logger}
+		session, found := base.CheckSessionAndIdentityForValidKey(&token, r)
+		if !found {
+			return errors.New("Key not authorised")
+		}
+		if session.IsInactive {
+			return errors.New("Key is inactive, please renew")
+		}
+		if spec.AuthManager.KeyExpired(&session) {
+			return errors.New("Key has expired, please renew")
+		}
+
+		switch sessionLimiter.ForwardMessage(r, &session, token, GlobalSessionManager.Store(),
+			!spec.DisableRateLimit, !spec.DisableQuota, &spec.GlobalConfig, spec, false) {
+		case sessionFailNone:
+		case sessionFailRateLimit:
+			return errors.New("Rate limit exceeded")
+		case sessionFailQuota:
+			return errors.New("Quota exceeded")
+		default:
+			return errors.New("There was a problem proxying the request")
+		}
+
+		accessDef, _, err := GetAccessDefinitionByAPIIDOrSession(&session, spec)
+		if err != nil {
+			return errors.New("There was a problem proxying the request")
+		}
+		complexity := GraphQLComplexityMiddleware{}
+		if complexity.DepthLimitEnabled(accessDef) && complexity.DepthLimitExceeded(gqlRequest, accessDef, spec.graphQLSchema()) != ComplexityFailReasonNone {
+			return errors.New("depth limit exceeded")
+		}
+		return nil
+	}
+}
+
+// handleGraphQLEngineSSE streams the results of an operation, typically a
+// subscription, as server-sent events.
+func (p *ReverseProxy) handleGraphQLEngineSSE(roundTripper *TykRoundTripper, r *http.Request, w http.ResponseWriter) (res *http.Response, hijacked bool, err error) {
+	gqlRequest := ctxGetGraphQLRequest(r)
+	if gqlRequest == nil {
+		return nil, false, errors.New("graphql request is nil")
+	}
+	if p.TykAPISpec.GraphQL.Version != apidef.GraphQLConfigVersion2 {
+		return nil, false, errors.New("server-sent events require a v2 execution engine")
+	}
+	engine := p.TykAPISpec.graphQLEngineV2()
+	if engine == nil {
+		return nil, false, errors.New("execution engine is nil")
+	}
+	payload, err := json.Marshal(gqlRequest)
+	if err != nil {
+		return nil, false, err
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	client, err := newGraphQLSSEClient(ctx, w, payload, p.graphQLSubscriptionEventCheck(r, gqlRequest))
+	if err != nil {
+		return nil, false, err
+	}
+
+	p.TykAPISpec.GraphQLExecutor.Client.Transport = roundTripper
+	absLogger := abstractlogger.NewLogrusLogger(log, absLoggerLevel(log.Level))
+	handler, err := subscription.NewHandler(absLogger, client, subscription.NewExecutorV2Pool(engine))
+	if err != nil {
+		return nil, false, err
+	}
+
+	w.Header().Set(headers.ContentType, graphQLSSEContentType)
+	w.Header().Set(headers.CacheControl, "no-cache")
+	w.Header().Set(headers.Connection, "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	client.flusher.Flush()
+
+	handler.Handle(ctx)
+	return nil, true, nil
+}
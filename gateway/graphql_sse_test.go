@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/jensneuse/graphql-go-tools/pkg/subscription"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestGraphQLRequestFromQuery(t *testing.T) {
+	query := url.Values{"query": {"subscription { price }"}, "variables": {`{"id":1}`}}
+	gqlRequest, err := graphQLRequestFromQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gqlRequest.Query != "subscription { price }" || string(gqlRequest.Variables) != `{"id":1}` {
+		t.Errorf("Unexpected request: %+v", gqlRequest)
+	}
+
+	query.Set("variables", "{")
+	if _, err := graphQLRequestFromQuery(query); err == nil {
+		t.Error("Expected invalid variables to be rejected")
+	}
+	if _, err := graphQLRequestFromQuery(url.Values{}); err == nil {
+		t.Error("Expected an empty query to be rejected")
+	}
+}
+
+func TestGraphQLSSEClient(t *testing.T) {
+	allowed := true
+	check := func() error {
+		if !allowed {
+			return errors.New("Rate limit exceeded")
+		}
+		return nil
+	}
+
+	rec := httptest.NewRecorder()
+	client, err := newGraphQLSSEClient(context.Background(), rec, []byte(`{"query":"subscription { price }"}`), check)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{subscription.MessageTypeConnectionInit, subscription.MessageTypeStart} {
+		message, _ := client.ReadFromClient()
+		if message.Type != expected {
+			t.Fatalf("Expected %q message, got %q", expected, message.Type)
+		}
+	}
+
+	client.WriteToClient(subscription.Message{Type: subscription.MessageTypeConnectionAck})
+	client.WriteToClient(subscription.Message{Type: subscription.MessageTypeData, Payload: []byte(`{"data":{"price":1}}`)})
+	allowed = false
+	client.WriteToClient(subscription.Message{Type: subscription.MessageTypeData, Payload: []byte(`{"data":{"price":2}}`)})
+	client.WriteToClient(subscription.Message{Type: subscription.MessageTypeData, Payload: []byte(`{"data":{"price":3}}`)})
+
+	expected := "event: next\ndata: {\"data\":{\"price\":1}}\n\n" +
+		"event: next\ndata: {\"errors\":[{\"message\":\"Rate limit exceeded\"}]}\n\n" +
+		"event: complete\ndata: \n\n"
+	if rec.Body.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, rec.Body.String())
+	}
+	if client.IsConnected() {
+		t.Error("Expected the client to be disconnected")
+	}
+	if message, _ := client.ReadFromClient(); message.Type != subscription.MessageTypeConnectionTerminate {
+		t.Errorf("Expected the stream to terminate, got %q", message.Type)
+	}
+}
+
+func TestGraphQL_SSE(t *testing.T) {
+	g := StartTest()
+	defer g.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = true
+		spec.Proxy.ListenPath = "/"
+		spec.GraphQL.Enabled = true
+		spec.GraphQL.ExecutionMode = apidef.GraphQLExecutionModeExecutionEngine
+		spec.GraphQL.Version = apidef.GraphQLConfigVersion2
+	})
+
+	sse := map[string]string{headers.Accept: graphQLSSEContentType}
+	_, _ = g.Run(t, []test.TestCase{
+		{Method: http.MethodPost, Data: `{"query":"query Query { people { name } }"}`, Headers: sse, Code: http.StatusOK,
+			HeadersMatch: map[string]string{headers.ContentType: graphQLSSEContentType},
+			BodyMatchFunc: func(body []byte) bool {
+				return strings.HasPrefix(string(body), "event: next\ndata: {\"data\":{\"people\":") &&
+					strings.HasSuffix(string(body), "event: complete\ndata: \n\n")
+			}},
+		{Method: http.MethodGet, Path: "/?query=" + url.QueryEscape("query Query { people { name } }"), Headers: sse, Code: http.StatusOK,
+			BodyMatch: `"people":`},
+		{Method: http.MethodGet, Path: "/?query=" + url.QueryEscape("query Query { unknown }"), Headers: sse, Code: http.StatusBadRequest},
+	}...)
+}
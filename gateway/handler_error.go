@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/ctx"
 
 	"github.com/TykTechnologies/tyk/headers"
 	"github.com/TykTechnologies/tyk/request"
@@ -120,6 +121,9 @@ type TemplateExecutor interface {
 // HandleError is the actual error handler and will store the error details in analytics if analytics processing is enabled.
 func (e *ErrorHandler) HandleError(w http.ResponseWriter, r *http.Request, errMsg string, errCode int, writeResponse bool) {
 	defer e.Base().UpdateRequestSession(r)
+	if timing := ctxGetRequestTiming(r); timing != nil {
+		timing.Status = errCode
+	}
 	response := &http.Response{}
 
 	if writeResponse {
@@ -246,6 +250,17 @@ func (e *ErrorHandler) HandleError(w http.ResponseWriter, r *http.Request, errMs
 			tags = tagHeaders(r, e.Spec.TagHeaders, tags)
 		}
 
+		if len(e.Spec.TagListenPathParams) > 0 {
+			tags = tagListenPathParams(r, e.Spec.TagListenPathParams, tags)
+		}
+
+		if len(e.Spec.TagRules) > 0 {
+			tags = tagRules(r, e.Spec, tags)
+		}
+
+		// Added by plugins
+		tags = append(tags, ctx.GetAnalyticsTags(r)...)
+
 		rawRequest := ""
 		rawResponse := ""
 		if recordDetail(r, e.Spec) {
@@ -274,7 +289,8 @@ func (e *ErrorHandler) HandleError(w http.ResponseWriter, r *http.Request, errMs
 			host = e.Spec.target.Host
 		}
 
-		record := AnalyticsRecord{
+		record := newAnalyticsRecord()
+		*record = AnalyticsRecord{
 			r.Method,
 			host,
 			trackedPath,
@@ -303,6 +319,8 @@ func (e *ErrorHandler) HandleError(w http.ResponseWriter, r *http.Request, errMs
 			tags,
 			alias,
 			trackEP,
+			ctxLoopTrace(r),
+			ctxThrottleLevel(r),
 			t,
 		}
 
@@ -324,7 +342,7 @@ func (e *ErrorHandler) HandleError(w http.ResponseWriter, r *http.Request, errMs
 		if e.Spec.GlobalConfig.AnalyticsConfig.NormaliseUrls.Enabled {
 			record.NormalisePath(&e.Spec.GlobalConfig)
 		}
-		analytics.RecordHit(&record)
+		analytics.RecordHit(record)
 	}
 	// Report in health check
 	reportHealthValue(e.Spec, BlockedRequestLog, "-1")
@@ -11,12 +11,14 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gorilla/mux"
 	cache "github.com/pmylund/go-cache"
 
 	"github.com/TykTechnologies/tyk/config"
 	"github.com/TykTechnologies/tyk/ctx"
 	"github.com/TykTechnologies/tyk/headers"
 	"github.com/TykTechnologies/tyk/request"
+	"github.com/TykTechnologies/tyk/storage"
 	"github.com/TykTechnologies/tyk/user"
 )
 
@@ -41,6 +43,9 @@ type ProxyResponse struct {
 	// UpstreamLatency the time it takes to do roundtrip to upstream. Total time
 	// taken for the gateway to receive response from upstream host.
 	UpstreamLatency time.Duration
+	// Aborted is set when the response was cut short once started, for the
+	// handler to abort it after recording it.
+	Aborted bool
 }
 
 type ReturningHttpHandler interface {
@@ -76,6 +81,42 @@ func tagHeaders(r *http.Request, th []string, tags []string) []string {
 	return tags
 }
 
+// tagListenPathParams tags a request with the values of the parameters of
+// the listen path it was matched with.
+func tagListenPathParams(r *http.Request, params []string, tags []string) []string {
+	vars := mux.Vars(r)
+	for _, name := range params {
+		if val, ok := vars[name]; ok {
+			tags = append(tags, name+"-"+val)
+		}
+	}
+	return tags
+}
+
+// tagRules tags a request with the attributes read by the tag rules of its
+// API.
+func tagRules(r *http.Request, spec *APISpec, tags []string) []string {
+	for _, rule := range spec.TagRules {
+		value := requestAttribute(r, spec, rule.Source, rule.Name, rule.Index)
+		if value == "" {
+			continue
+		}
+		if rule.Hash {
+			value = storage.HashStr(value, storage.HashSha256)
+		}
+
+		tag := rule.Tag
+		if tag == "" {
+			tag = strings.ToLower(rule.Name)
+			if rule.Source == attributePathSegment {
+				tag = "segment-" + strconv.Itoa(rule.Index)
+			}
+		}
+		tags = append(tags, tag+"-"+value)
+	}
+	return tags
+}
+
 func addVersionHeader(w http.ResponseWriter, r *http.Request, globalConf config.Config) {
 	if ctxGetDefaultVersion(r) {
 		if vinfo := ctxGetVersionInfo(r); vinfo != nil {
@@ -105,6 +146,8 @@ func estimateTagsCapacity(session *user.SessionState, apiSpec *APISpec) int {
 	}
 
 	size += len(apiSpec.TagHeaders)
+	size += len(apiSpec.TagListenPathParams)
+	size += len(apiSpec.TagRules)
 
 	return size
 }
@@ -163,6 +206,17 @@ func (s *SuccessHandler) RecordHit(r *http.Request, timing Latency, code int, re
 			tags = tagHeaders(r, s.Spec.TagHeaders, tags)
 		}
 
+		if len(s.Spec.TagListenPathParams) > 0 {
+			tags = tagListenPathParams(r, s.Spec.TagListenPathParams, tags)
+		}
+
+		if len(s.Spec.TagRules) > 0 {
+			tags = tagRules(r, s.Spec, tags)
+		}
+
+		// Added by plugins
+		tags = append(tags, ctx.GetAnalyticsTags(r)...)
+
 		rawRequest := ""
 		rawResponse := ""
 
@@ -206,7 +260,8 @@ func (s *SuccessHandler) RecordHit(r *http.Request, timing Latency, code int, re
 			host = s.Spec.target.Host
 		}
 
-		record := AnalyticsRecord{
+		record := newAnalyticsRecord()
+		*record = AnalyticsRecord{
 			r.Method,
 			host,
 			trackedPath,
@@ -235,6 +290,8 @@ func (s *SuccessHandler) RecordHit(r *http.Request, timing Latency, code int, re
 			tags,
 			alias,
 			trackEP,
+			ctxLoopTrace(r),
+			ctxThrottleLevel(r),
 			t,
 		}
 
@@ -257,7 +314,7 @@ func (s *SuccessHandler) RecordHit(r *http.Request, timing Latency, code int, re
 			record.NormalisePath(&s.Spec.GlobalConfig)
 		}
 
-		analytics.RecordHit(&record)
+		analytics.RecordHit(record)
 	}
 
 	// Report in health check
@@ -326,6 +383,12 @@ func (s *SuccessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) *http
 
 	t1 := time.Now()
 	resp := s.Proxy.ServeHTTP(w, r)
+	if timing := ctxGetRequestTiming(r); timing != nil {
+		timing.Upstream = resp.UpstreamLatency
+		if resp.Response != nil {
+			timing.Status = resp.Response.StatusCode
+		}
+	}
 
 	millisec := DurationToMillisecond(time.Since(t1))
 	log.Debug("Upstream request took (ms): ", millisec)
@@ -337,6 +400,10 @@ func (s *SuccessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) *http
 		}
 		s.RecordHit(r, latency, resp.Response.StatusCode, resp.Response)
 	}
+	if resp.Aborted {
+		// the client must not take the response for a complete one
+		panic(http.ErrAbortHandler)
+	}
 	log.Debug("Done proxy")
 	return nil
 }
@@ -364,6 +431,12 @@ func (s *SuccessHandler) ServeHTTPWithCache(w http.ResponseWriter, r *http.Reque
 
 	t1 := time.Now()
 	inRes := s.Proxy.ServeHTTPForCache(w, r)
+	if timing := ctxGetRequestTiming(r); timing != nil {
+		timing.Upstream = inRes.UpstreamLatency
+		if inRes.Response != nil {
+			timing.Status = inRes.Response.StatusCode
+		}
+	}
 	millisec := DurationToMillisecond(time.Since(t1))
 
 	addVersionHeader(w, r, s.Spec.GlobalConfig)
@@ -377,6 +450,10 @@ func (s *SuccessHandler) ServeHTTPWithCache(w http.ResponseWriter, r *http.Reque
 		}
 		s.RecordHit(r, latency, inRes.Response.StatusCode, inRes.Response)
 	}
+	if inRes.Aborted {
+		// the client must not take the response for a complete one
+		panic(http.ErrAbortHandler)
+	}
 
 	return inRes
 }
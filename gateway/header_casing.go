@@ -0,0 +1,79 @@
+package gateway
+
+import (
+	"net/http"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+// headerCasing decides which header names are written as given rather than
+// canonicalized, from the gateway configuration and the header_casing of an
+// API.
+type headerCasing struct {
+	// all keeps the case of every header name set by middleware.
+	all bool
+	// preserve maps canonical header names to the casing they must have.
+	preserve map[string]string
+}
+
+func globalHeaderCasing() headerCasing {
+	return headerCasing{all: config.Global().IgnoreCanonicalMIMEHeaderKey}
+}
+
+// newHeaderPreserve maps the canonical names of the headers to preserve to
+// their casing, once when the API is loaded.
+func newHeaderPreserve(names []string) map[string]string {
+	if len(names) == 0 {
+		return nil
+	}
+	preserve := make(map[string]string, len(names))
+	for _, name := range names {
+		preserve[http.CanonicalHeaderKey(name)] = name
+	}
+	return preserve
+}
+
+// headerCasing returns the header casing of the API, that of the gateway if
+// there is no API.
+func (s *APISpec) headerCasing() headerCasing {
+	casing := globalHeaderCasing()
+	if s == nil || s.APIDefinition == nil {
+		return casing
+	}
+
+	casing.all = casing.all || s.HeaderCasing.IgnoreCanonical
+	casing.preserve = s.headerPreserve
+	return casing
+}
+
+// key returns the name to write a header under, and whether it is to be
+// written as is.
+func (c headerCasing) key(name string) (string, bool) {
+	if exact, ok := c.preserve[http.CanonicalHeaderKey(name)]; ok {
+		return exact, true
+	}
+	return name, c.all
+}
+
+// del removes a header whatever the case of its name.
+func (c headerCasing) del(h http.Header, name string) {
+	h.Del(name)
+	if exact, keep := c.key(name); keep {
+		delete(h, name)
+		delete(h, exact)
+	}
+}
+
+// rename moves the values of the preserved headers of h, such as those
+// received from clients with canonical names, to the casing they must have.
+func (c headerCasing) rename(h http.Header) {
+	for canonical, exact := range c.preserve {
+		if canonical == exact {
+			continue
+		}
+		if values, ok := h[canonical]; ok {
+			delete(h, canonical)
+			h[exact] = append(h[exact], values...)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+func TestHeaderCasing(t *testing.T) {
+	def := &apidef.APIDefinition{
+		HeaderCasing: apidef.HeaderCasingConfig{Preserve: []string{"SOAPAction", "x-api-key"}},
+	}
+	spec := APIDefinitionLoader{}.MakeSpec(def, nil)
+	casing := spec.headerCasing()
+
+	t.Run("set", func(t *testing.T) {
+		h := http.Header{}
+		setCustomHeader(h, "soapaction", "first", casing)
+		setCustomHeader(h, "SoapAction", "second", casing)
+		setCustomHeader(h, "x-custom", "value", casing)
+
+		expected := http.Header{"SOAPAction": {"second"}, "X-Custom": {"value"}}
+		if !reflect.DeepEqual(h, expected) {
+			t.Errorf("Expected %v, got %v", expected, h)
+		}
+	})
+
+	t.Run("copy", func(t *testing.T) {
+		src := http.Header{}
+		src.Set("X-Api-Key", "key")
+		src.Set("Content-Type", "text/plain")
+		dst := http.Header{}
+		copyHeader(dst, src, casing)
+
+		expected := http.Header{"x-api-key": {"key"}, "Content-Type": {"text/plain"}}
+		if !reflect.DeepEqual(dst, expected) {
+			t.Errorf("Expected %v, got %v", expected, dst)
+		}
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		h := http.Header{}
+		h.Set("Soapaction", "action")
+		h.Set("Accept", "*/*")
+		casing.rename(h)
+
+		expected := http.Header{"SOAPAction": {"action"}, "Accept": {"*/*"}}
+		if !reflect.DeepEqual(h, expected) {
+			t.Errorf("Expected %v, got %v", expected, h)
+		}
+	})
+
+	t.Run("ignore canonical", func(t *testing.T) {
+		spec.HeaderCasing.IgnoreCanonical = true
+		h := http.Header{}
+		setCustomHeader(h, "x-custom", "value", spec.headerCasing())
+		if _, ok := h["x-custom"]; !ok {
+			t.Errorf("Expected the header to keep its case, got %v", h)
+		}
+	})
+}
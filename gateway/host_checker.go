@@ -3,6 +3,7 @@ package gateway
 import (
 	"context"
 	"crypto/tls"
+	"io/ioutil"
 	"math/rand"
 	"net"
 	"net/http"
@@ -18,6 +19,7 @@ import (
 
 	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/regexp"
 )
 
 const (
@@ -42,6 +44,9 @@ type HostData struct {
 	Method              string
 	Headers             map[string]string
 	Body                string
+	Interval            time.Duration
+	ExpectedStatusCodes []int
+	BodyMatch           *regexp.Regexp
 	MetaData            map[string]string
 }
 
@@ -70,6 +75,9 @@ type HostUptimeChecker struct {
 	resetListMu sync.Mutex
 	doResetList bool
 	newList     map[string]HostData
+
+	// lastChecked holds the time of the last check of hosts with an interval
+	lastChecked map[string]time.Time
 }
 
 func (h *HostUptimeChecker) getStopLoop() bool {
@@ -131,10 +139,17 @@ func (h *HostUptimeChecker) execCheck() {
 		h.HostList = h.newList
 		h.newList = nil
 		h.doResetList = false
+		h.pruneLastChecked()
 		log.Debug("[HOST CHECKER] Host list reset")
 	}
 	h.resetListMu.Unlock()
 	for _, host := range h.HostList {
+		if host.Interval > 0 {
+			if last, ok := h.lastChecked[host.CheckURL]; ok && time.Since(last) < host.Interval {
+				continue
+			}
+			h.lastChecked[host.CheckURL] = time.Now()
+		}
 		_, err := h.pool.SendWork(host)
 		if err != nil && err != tunny.ErrPoolNotRunning {
 			log.Warnf("[HOST CHECKER] could not send work, error: %v", err)
@@ -142,6 +157,20 @@ func (h *HostUptimeChecker) execCheck() {
 	}
 }
 
+// pruneLastChecked forgets the last check of the hosts no longer in the host
+// list.
+func (h *HostUptimeChecker) pruneLastChecked() {
+	current := make(map[string]bool, len(h.HostList))
+	for _, host := range h.HostList {
+		current[host.CheckURL] = true
+	}
+	for checkURL := range h.lastChecked {
+		if !current[checkURL] {
+			delete(h.lastChecked, checkURL)
+		}
+	}
+}
+
 func (h *HostUptimeChecker) HostReporter(ctx context.Context) {
 	for {
 		select {
@@ -208,6 +237,7 @@ func (h *HostUptimeChecker) CheckHost(toCheck HostData) {
 	report := HostHealthReport{
 		HostData: toCheck,
 	}
+	unhealthy := false
 	switch toCheck.Protocol {
 	case "tcp", "tls":
 		host := toCheck.CheckURL
@@ -276,9 +306,9 @@ func (h *HostUptimeChecker) CheckHost(toCheck HostData) {
 			log.Error("Could not create request: ", err)
 			return
 		}
-		ignoreCanonical := config.Global().IgnoreCanonicalMIMEHeaderKey
+		casing := globalHeaderCasing()
 		for headerName, headerValue := range toCheck.Headers {
-			setCustomHeader(req.Header, headerName, headerValue, ignoreCanonical)
+			setCustomHeader(req.Header, headerName, headerValue, casing)
 		}
 		req.Header.Set("Connection", "close")
 		HostCheckerClient.Transport = &http.Transport{
@@ -295,8 +325,13 @@ func (h *HostUptimeChecker) CheckHost(toCheck HostData) {
 			report.IsTCPError = true
 			break
 		}
+		var body []byte
+		if toCheck.BodyMatch != nil {
+			body, _ = ioutil.ReadAll(response.Body)
+		}
 		response.Body.Close()
 		report.ResponseCode = response.StatusCode
+		unhealthy = !toCheck.expectsStatusCode(response.StatusCode) || !toCheck.matchesBody(body)
 	}
 
 	millisec := DurationToMillisecond(time.Since(t1))
@@ -306,7 +341,7 @@ func (h *HostUptimeChecker) CheckHost(toCheck HostData) {
 		return
 	}
 
-	if report.ResponseCode != http.StatusOK {
+	if unhealthy {
 		h.errorChan <- report
 		return
 	}
@@ -315,6 +350,25 @@ func (h *HostUptimeChecker) CheckHost(toCheck HostData) {
 	h.okChan <- report
 }
 
+func (h HostData) expectsStatusCode(code int) bool {
+	if len(h.ExpectedStatusCodes) == 0 {
+		return code == http.StatusOK
+	}
+	for _, expected := range h.ExpectedStatusCodes {
+		if code == expected {
+			return true
+		}
+	}
+	return false
+}
+
+func (h HostData) matchesBody(body []byte) bool {
+	if h.BodyMatch == nil {
+		return true
+	}
+	return h.BodyMatch.Match(body)
+}
+
 // HostCheckCallBacks defines call backs which will be invoked on different
 // states of the health check
 type HostCheckCallBacks struct {
@@ -335,6 +389,7 @@ func (h *HostUptimeChecker) Init(workers, triggerLimit, timeout int, hostList ma
 	h.okChan = make(chan HostHealthReport)
 	h.HostList = hostList
 	h.unHealthyList = make(map[string]bool)
+	h.lastChecked = make(map[string]time.Time)
 	h.cb = cb
 
 	h.workerPoolSize = workers
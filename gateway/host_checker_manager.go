@@ -16,6 +16,7 @@ import (
 
 	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/regexp"
 	"github.com/TykTechnologies/tyk/storage"
 )
 
@@ -344,6 +345,16 @@ func (hc *HostCheckerManager) PrepareTrackingHost(checkObject apidef.HostCheckOb
 		bodyData = string(bodyByteArr)
 	}
 
+	var bodyMatch *regexp.Regexp
+	if checkObject.BodyMatch != "" {
+		if bodyMatch, err = regexp.Compile(checkObject.BodyMatch); err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix": "host-check-mgr",
+			}).Error("Invalid body match pattern: ", err)
+			return hostData, err
+		}
+	}
+
 	hostData = HostData{
 		CheckURL: checkObject.CheckURL,
 		MetaData: map[string]string{
@@ -358,6 +369,9 @@ func (hc *HostCheckerManager) PrepareTrackingHost(checkObject apidef.HostCheckOb
 		Commands:            checkObject.Commands,
 		Headers:             checkObject.Headers,
 		Body:                bodyData,
+		Interval:            time.Duration(checkObject.Interval) * time.Second,
+		ExpectedStatusCodes: checkObject.ExpectedStatusCodes,
+		BodyMatch:           bodyMatch,
 	}
 
 	return hostData, nil
@@ -18,6 +18,7 @@ import (
 
 	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/regexp"
 	"github.com/TykTechnologies/tyk/storage"
 )
 
@@ -537,3 +538,45 @@ func TestChecker_triggerSampleLimit(t *testing.T) {
 	assert.Equal(t, limit, ping.Load().(int), "ping count is wrong")
 	assert.Equal(t, 1, failed.Load().(int), "expected host down to be fired once")
 }
+
+func TestHostDataExpectations(t *testing.T) {
+	data := HostData{}
+	assert.True(t, data.expectsStatusCode(http.StatusOK))
+	assert.False(t, data.expectsStatusCode(http.StatusNoContent))
+	assert.True(t, data.matchesBody(nil))
+
+	data = HostData{
+		ExpectedStatusCodes: []int{http.StatusNoContent, http.StatusAccepted},
+		BodyMatch:           regexp.MustCompile(`"status":\s*"pass"`),
+	}
+	assert.False(t, data.expectsStatusCode(http.StatusOK))
+	assert.True(t, data.expectsStatusCode(http.StatusAccepted))
+	assert.True(t, data.matchesBody([]byte(`{"status": "pass"}`)))
+	assert.False(t, data.matchesBody([]byte(`{"status": "fail"}`)))
+}
+
+func TestValidateUptimeTests(t *testing.T) {
+	def := &apidef.APIDefinition{}
+	def.UptimeTests.CheckList = []apidef.HostCheckObject{{CheckURL: "http://host", BodyMatch: `"status":\s*"pass"`}}
+	assert.NoError(t, validateUptimeTests(def))
+
+	def.UptimeTests.CheckList = append(def.UptimeTests.CheckList, apidef.HostCheckObject{CheckURL: "http://host", BodyMatch: "("})
+	assert.Error(t, validateUptimeTests(def))
+
+	hostData, err := GlobalHostChecker.PrepareTrackingHost(def.UptimeTests.CheckList[0], "test")
+	assert.NoError(t, err)
+	assert.True(t, hostData.matchesBody([]byte(`{"status": "pass"}`)))
+}
+
+func TestHostCheckerPruneLastChecked(t *testing.T) {
+	h := &HostUptimeChecker{
+		HostList: map[string]HostData{"kept": {CheckURL: "http://kept"}},
+		lastChecked: map[string]time.Time{
+			"http://kept":    time.Now(),
+			"http://removed": time.Now(),
+		},
+	}
+	h.pruneLastChecked()
+	assert.Len(t, h.lastChecked, 1)
+	assert.Contains(t, h.lastChecked, "http://kept")
+}
@@ -0,0 +1,82 @@
+package gateway
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+// defaultAltSvcMaxAge is the number of seconds clients may remember that
+// HTTP/3 is available, used when http3_alt_svc_max_age is not set.
+const defaultAltSvcMaxAge = 86400
+
+// altSvcWrapper advertises the HTTP/3 listener of a proxy to clients
+// connecting over HTTP/1.1 or HTTP/2.
+type altSvcWrapper struct {
+	*h2cWrapper
+	altSvc string
+}
+
+func (h *altSvcWrapper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if http3EnabledForHost(r.Host) {
+		w.Header().Set("Alt-Svc", h.altSvc)
+	}
+	h.h2cWrapper.ServeHTTP(w, r)
+}
+
+// startHTTP3 starts an HTTP/3 server on the UDP port matching the TLS
+// listener of the proxy, and returns the handler the TLS listener should use.
+// When HTTP/3 can't be started the proxy keeps serving HTTP/1.1 and HTTP/2
+// without advertising HTTP/3.
+func (p *proxy) startHTTP3(addr string, h *h2cWrapper) http.Handler {
+	srv, err := serveHTTP3(addr, listenerTLSConfig(p.port), h.w)
+	if err != nil {
+		mainLog.WithError(err).Warning("Can't start HTTP/3 server, falling back to HTTP/1.1 and HTTP/2")
+		return h
+	}
+
+	mainLog.Warning("Starting HTTP/3 server on:", addr)
+	p.http3Server = srv
+
+	return &altSvcWrapper{h2cWrapper: h, altSvc: altSvcValue(p.port)}
+}
+
+func altSvcValue(port int) string {
+	maxAge := config.Global().HttpServerOptions.Http3AltSvcMaxAge
+	if maxAge <= 0 {
+		maxAge = defaultAltSvcMaxAge
+	}
+	// the QUIC implementation supporting Go 1.15 speaks draft 29 of HTTP/3
+	return fmt.Sprintf(`h3-29=":%d"; ma=%d`, port, maxAge)
+}
+
+// http3EnabledForHost reports whether HTTP/3 should be advertised for the
+// requested host. All hosts are enabled when http3_domains is empty, entries
+// starting with "*." match any subdomain.
+func http3EnabledForHost(host string) bool {
+	domains := config.Global().HttpServerOptions.Http3Domains
+	if len(domains) == 0 {
+		return true
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	for _, domain := range domains {
+		if strings.EqualFold(domain, host) {
+			return true
+		}
+		if strings.HasPrefix(domain, "*.") {
+			suffix := domain[1:]
+			if len(host) > len(suffix) && strings.EqualFold(host[len(host)-len(suffix):], suffix) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,33 @@
+// +build http3
+
+// HTTP/3 support is built on github.com/lucas-clemente/quic-go, whose TLS
+// stack is tied to the Go release it was built for. Building with the http3
+// tag pulls it in.
+package gateway
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/lucas-clemente/quic-go/http3"
+)
+
+func init() {
+	registerBuildTag("http3")
+}
+
+func serveHTTP3(addr string, tlsConfig *tls.Config, handler http.Handler) (io.Closer, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	srv := &http3.Server{
+		Server: &http.Server{Handler: handler, TLSConfig: tlsConfig},
+	}
+	go srv.Serve(conn)
+
+	return srv, nil
+}
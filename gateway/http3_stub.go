@@ -0,0 +1,16 @@
+// +build !http3
+
+package gateway
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+)
+
+var errHTTP3NotSupported = errors.New("HTTP/3 not supported, gateway built without the http3 tag")
+
+func serveHTTP3(addr string, tlsConfig *tls.Config, handler http.Handler) (io.Closer, error) {
+	return nil, errHTTP3NotSupported
+}
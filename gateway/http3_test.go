@@ -0,0 +1,65 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+func TestHTTP3EnabledForHost(t *testing.T) {
+	defer ResetTestConfig()
+
+	if !http3EnabledForHost("example.com") {
+		t.Error("All hosts should be enabled when no domains are configured")
+	}
+
+	globalConf := config.Global()
+	globalConf.HttpServerOptions.Http3Domains = []string{"api.example.com", "*.tyk.io"}
+	config.SetGlobal(globalConf)
+
+	for host, want := range map[string]bool{
+		"api.example.com":      true,
+		"API.example.com:8443": true,
+		"example.com":          false,
+		"gw.tyk.io":            true,
+		"tyk.io":               false,
+	} {
+		if got := http3EnabledForHost(host); got != want {
+			t.Errorf("http3EnabledForHost(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestAltSvcWrapper(t *testing.T) {
+	defer ResetTestConfig()
+
+	globalConf := config.Global()
+	globalConf.HttpServerOptions.Http3Domains = []string{"api.example.com"}
+	globalConf.HttpServerOptions.Http3AltSvcMaxAge = 60
+	config.SetGlobal(globalConf)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+	h := &altSvcWrapper{
+		h2cWrapper: &h2cWrapper{w: &handleWrapper{router: router}, h: &handleWrapper{router: router}},
+		altSvc:     altSvcValue(8443),
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "https://api.example.com/", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Alt-Svc"); got != `h3-29=":8443"; ma=60` {
+		t.Errorf("Unexpected Alt-Svc header: %q", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "https://other.example.com/", nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Alt-Svc"); got != "" {
+		t.Errorf("Alt-Svc should not be advertised for disabled domains, got %q", got)
+	}
+}
@@ -12,6 +12,10 @@ import (
 	"reflect"
 )
 
+func init() {
+	registerBuildTag("jq")
+}
+
 // JQ type stores a JQ vm
 // Must be protected with mutex in threaded environment
 type JQ struct {
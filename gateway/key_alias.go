@@ -0,0 +1,209 @@
+package gateway
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// keyAliasClaimTTL is how long, in seconds, an alias is reserved for a key
+// being stored before it is indexed.
+const keyAliasClaimTTL = 30
+
+// keyAliasStore maps the aliases of each org to the key they belong to, as
+// the key is stored: hashed if hash_keys is enabled. The entries of aliases
+// reserved for keys not stored yet expire, the others don't.
+func keyAliasStore() *storage.RedisCluster {
+	return &storage.RedisCluster{KeyPrefix: "key-alias."}
+}
+
+func keyAliasIndexName(orgID, alias string) string {
+	return orgID + "." + alias
+}
+
+// storedKeyName returns the name the session of keyName is stored under.
+func storedKeyName(keyName string, isHashed bool) string {
+	if isHashed {
+		return keyName
+	}
+	return storage.HashKey(keyName)
+}
+
+// keyAliasPending reports whether the entry of an alias is reserved for a key
+// not stored yet.
+func keyAliasPending(store *storage.RedisCluster, name string) bool {
+	ttl, err := store.GetExp(name)
+	return err == nil && ttl != -1
+}
+
+// keyByAlias returns the stored name of the key an alias belongs to. Entries
+// of keys that no longer exist are removed.
+func keyByAlias(orgID, alias string) (string, bool) {
+	store := keyAliasStore()
+	name := keyAliasIndexName(orgID, alias)
+
+	keyName, err := store.GetKey(name)
+	if err != nil {
+		return "", false
+	}
+	if _, found := GlobalSessionManager.SessionDetail(orgID, keyName, config.Global().HashKeys); !found {
+		if !keyAliasPending(store, name) {
+			store.DeleteKeyIfEqual(name, keyName)
+		}
+		return "", false
+	}
+	return keyName, true
+}
+
+// claimKeyAlias reserves the alias of session for the key stored as keyName,
+// and reports whether it could, that is whether the alias isn't used by
+// another key of the org. The alias is set only if absent, for keys stored
+// concurrently not to get the same one. indexKeyAlias confirms the claim once
+// the key is stored, releaseKeyAlias drops it otherwise.
+func claimKeyAlias(keyName string, session *user.SessionState) bool {
+	if !config.Global().UniqueKeyAliases || session.Alias == "" {
+		return true
+	}
+
+	store := keyAliasStore()
+	name := keyAliasIndexName(session.OrgID, session.Alias)
+	// the entry of a key that no longer exists is removed, then claimed again
+	for i := 0; i < 2; i++ {
+		claimed, err := store.SetKeyIfAbsent(name, keyName, keyAliasClaimTTL)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix": "api",
+				"key":    obfuscateKey(keyName),
+				"alias":  session.Alias,
+			}).WithError(err).Error("Couldn't claim key alias")
+			return false
+		}
+		if claimed {
+			return true
+		}
+
+		owner, err := store.GetKey(name)
+		if err != nil {
+			// removed meanwhile
+			continue
+		}
+		if owner == keyName {
+			return true
+		}
+		if keyAliasPending(store, name) {
+			return false
+		}
+		if _, found := GlobalSessionManager.SessionDetail(session.OrgID, owner, config.Global().HashKeys); found {
+			return false
+		}
+		store.DeleteKeyIfEqual(name, owner)
+	}
+	return false
+}
+
+// releaseKeyAlias drops the claim of the alias of session for the key stored
+// as keyName, when the key couldn't be stored.
+func releaseKeyAlias(keyName string, session *user.SessionState) {
+	if !config.Global().UniqueKeyAliases || session.Alias == "" {
+		return
+	}
+	store := keyAliasStore()
+	name := keyAliasIndexName(session.OrgID, session.Alias)
+	if keyAliasPending(store, name) {
+		store.DeleteKeyIfEqual(name, keyName)
+	}
+}
+
+// indexKeyAlias points the alias of session, claimed by claimKeyAlias, to the
+// key stored as keyName for good, and removes the previous alias of the key if
+// it changed.
+func indexKeyAlias(keyName string, session *user.SessionState, previousAlias string) {
+	if !config.Global().UniqueKeyAliases {
+		return
+	}
+
+	store := keyAliasStore()
+	if previousAlias != "" && previousAlias != session.Alias {
+		store.DeleteKeyIfEqual(keyAliasIndexName(session.OrgID, previousAlias), keyName)
+	}
+	if session.Alias == "" {
+		return
+	}
+	if err := store.SetKey(keyAliasIndexName(session.OrgID, session.Alias), keyName, 0); err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "api",
+			"key":    obfuscateKey(keyName),
+			"alias":  session.Alias,
+		}).WithError(err).Error("Couldn't index key alias")
+	}
+}
+
+// unindexKeyAlias removes the alias of a deleted key from the index. The
+// entry is only removed if the key it points to is gone.
+func unindexKeyAlias(session *user.SessionState) {
+	if !config.Global().UniqueKeyAliases || session.Alias == "" {
+		return
+	}
+	keyByAlias(session.OrgID, session.Alias)
+}
+
+// apiKeyByAlias is the key an alias belongs to
+// swagger:model
+type apiKeyByAlias struct {
+	// KeyID is the key hash if hash_keys is enabled, the key otherwise.
+	KeyID   string      `json:"key_id"`
+	Session interface{} `json:"session"`
+}
+
+// Get a key by alias
+// Looks up, within the org given by the org_id parameter, the key with the
+// given alias. Requires unique_key_aliases, which indexes the aliases of keys
+// as they are created or updated.
+//
+//---
+// parameters:
+//   - name: alias
+//     in: path
+//     required: true
+//     type: string
+//   - name: org_id
+//     in: query
+//     required: false
+//     type: string
+// responses:
+//   200:
+//     description: Key ID and object
+//     schema:
+//       "$ref": "#/definitions/apiKeyByAlias"
+//   400:
+//     description: Key aliases are not indexed
+//     schema:
+//       "$ref": "#/definitions/apiStatusMessage"
+//   404:
+//     description: Key not found
+//     schema:
+//       "$ref": "#/definitions/apiStatusMessage"
+func keyByAliasHandler(w http.ResponseWriter, r *http.Request) {
+	if !config.Global().UniqueKeyAliases {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Key aliases are not indexed, enable unique_key_aliases"))
+		return
+	}
+
+	keyName, found := keyByAlias(r.URL.Query().Get("org_id"), mux.Vars(r)["alias"])
+	if !found {
+		doJSONWrite(w, http.StatusNotFound, apiError("Key not found"))
+		return
+	}
+
+	obj, code := handleGetDetail(keyName, "", config.Global().HashKeys)
+	if code != http.StatusOK {
+		doJSONWrite(w, code, obj)
+		return
+	}
+	doJSONWrite(w, code, apiKeyByAlias{KeyID: keyName, Session: obj})
+}
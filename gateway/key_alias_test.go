@@ -0,0 +1,102 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestKeyAliases(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.UniqueKeyAliases = true
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI()
+
+	alias := "support-" + randStringBytes(8) + "@example.com"
+	newAlias := "renamed-" + alias
+	session := CreateStandardSession()
+	session.Alias = alias
+	session.AccessRights = map[string]user.AccessDefinition{"test": {
+		APIID: "test", Versions: []string{"v1"},
+	}}
+
+	byAlias := func(alias string) string {
+		return "/tyk/keys/by-alias/" + alias + "?org_id=default"
+	}
+	matchKey := func(key string) func([]byte) bool {
+		return func(body []byte) bool {
+			var resp apiKeyByAlias
+			if err := json.Unmarshal(body, &resp); err != nil {
+				t.Error(err)
+				return false
+			}
+			return resp.KeyID == key
+		}
+	}
+
+	var created apiModifyKeySuccess
+	resp, _ := ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/tyk/keys/create", Data: session, AdminAuth: true, Code: http.StatusOK})
+	json.NewDecoder(resp.Body).Decode(&created)
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: byAlias(alias), AdminAuth: true, Code: http.StatusOK, BodyMatchFunc: matchKey(created.Key)},
+		{Path: byAlias(alias) + "-other", AdminAuth: true, Code: http.StatusNotFound},
+		{Method: http.MethodPost, Path: "/tyk/keys/create", Data: session, AdminAuth: true, Code: http.StatusConflict},
+		{Method: http.MethodPost, Path: "/tyk/keys/" + alias, Data: session, AdminAuth: true, Code: http.StatusConflict},
+		// Updating a key keeps its own alias
+		{Method: http.MethodPut, Path: "/tyk/keys/" + created.Key, Data: session, AdminAuth: true, Code: http.StatusOK},
+	}...)
+
+	session.Alias = newAlias
+	_, _ = ts.Run(t, []test.TestCase{
+		{Method: http.MethodPut, Path: "/tyk/keys/" + created.Key, Data: session, AdminAuth: true, Code: http.StatusOK},
+		{Path: byAlias(alias), AdminAuth: true, Code: http.StatusNotFound},
+		{Path: byAlias(newAlias), AdminAuth: true, Code: http.StatusOK, BodyMatchFunc: matchKey(created.Key)},
+		{Method: http.MethodDelete, Path: "/tyk/keys/" + created.Key, AdminAuth: true, Code: http.StatusOK},
+		{Path: byAlias(newAlias), AdminAuth: true, Code: http.StatusNotFound},
+		{Method: http.MethodPost, Path: "/tyk/keys/create", Data: session, AdminAuth: true, Code: http.StatusOK},
+	}...)
+
+	t.Run("concurrent creations", func(t *testing.T) {
+		session.Alias = "concurrent-" + alias
+
+		var created int32
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, _ := ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/tyk/keys/create", Data: session, AdminAuth: true})
+				if resp != nil && resp.StatusCode == http.StatusOK {
+					atomic.AddInt32(&created, 1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if created != 1 {
+			t.Errorf("Expected the alias to be given to one key, got %d", created)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		globalConf.UniqueKeyAliases = false
+		config.SetGlobal(globalConf)
+
+		_, _ = ts.Run(t, []test.TestCase{
+			{Path: byAlias(newAlias), AdminAuth: true, Code: http.StatusBadRequest},
+			{Method: http.MethodPost, Path: "/tyk/keys/create", Data: session, AdminAuth: true, Code: http.StatusOK},
+		}...)
+	})
+}
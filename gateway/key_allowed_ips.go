@@ -0,0 +1,148 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/request"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+var errKeyIPNotAllowed = errors.New("access from this IP has been disallowed for this key")
+
+// keyAllowedIPsUpdate changes the IPs a key is bound to. AllowedIPs replaces
+// the list when set, then Add and Remove are applied to it.
+type keyAllowedIPsUpdate struct {
+	AllowedIPs *[]string `json:"allowed_ips"`
+	Add        []string  `json:"add"`
+	Remove     []string  `json:"remove"`
+}
+
+type apiKeyAllowedIPs struct {
+	Key        string   `json:"key"`
+	AllowedIPs []string `json:"allowed_ips"`
+}
+
+// validateAllowedIPs checks that the entries of a list of allowed IPs are
+// IPv4 or IPv6 addresses or CIDR ranges.
+func validateAllowedIPs(ips []string) error {
+	for _, entry := range ips {
+		if _, _, err := net.ParseCIDR(entry); err == nil {
+			continue
+		}
+		if net.ParseIP(entry) == nil {
+			return fmt.Errorf("%q is neither an IP address nor a CIDR range", entry)
+		}
+	}
+	return nil
+}
+
+// checkSessionIP rejects requests from IPs the key of the session isn't
+// bound to. Keys without allowed IPs can be used from anywhere.
+func checkSessionIP(m TykMiddleware, r *http.Request, session *user.SessionState, token string) error {
+	if len(session.AllowedIPs) == 0 {
+		return nil
+	}
+	ip := request.RealIP(r)
+	if ipListContains(session.AllowedIPs, net.ParseIP(ip)) {
+		return nil
+	}
+
+	m.Logger().WithField("origin", ip).Info("Attempted access from an IP the key isn't bound to.")
+	m.Base().FireEvent(EventKeyIPViolation, EventKeyFailureMeta{
+		EventMetaDefault: EventMetaDefault{Message: "Attempted access from an IP the key isn't bound to.", OriginatingRequest: EncodeRequestToEvent(r)},
+		Path:             r.URL.Path,
+		Origin:           ip,
+		Key:              token,
+	})
+	reportHealthValue(m.Base().Spec, KeyFailure, "-1")
+	return errKeyIPNotAllowed
+}
+
+// keyLifetime returns the lifetime of a key that has access to the given
+// APIs.
+func keyLifetime(session *user.SessionState) int64 {
+	var lifetime int64
+	for apiID := range session.GetAccessRights() {
+		if spec := getApiSpec(apiID); spec != nil && spec.SessionLifetime > lifetime {
+			lifetime = spec.SessionLifetime
+		}
+	}
+	return session.Lifetime(lifetime)
+}
+
+// keyAllowedIPsHandler updates the IPs a key is bound to, without the rest
+// of its session.
+func keyAllowedIPsHandler(w http.ResponseWriter, r *http.Request) {
+	keyName := mux.Vars(r)["keyName"]
+	orgID := r.URL.Query().Get("org_id")
+	isHashed := keyIdentifierHashed(r, keyName, orgID)
+
+	var update keyAllowedIPsUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Couldn't decode instruction"))
+		return
+	}
+	for _, ips := range [][]string{update.Add, update.Remove} {
+		if err := validateAllowedIPs(ips); err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+			return
+		}
+	}
+	if update.AllowedIPs != nil {
+		if err := validateAllowedIPs(*update.AllowedIPs); err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+			return
+		}
+	}
+
+	session, found := GlobalSessionManager.SessionDetail(orgID, keyName, isHashed)
+	if !found {
+		doJSONWrite(w, http.StatusNotFound, apiError("Key not found"))
+		return
+	}
+
+	allowedIPs := session.AllowedIPs
+	if update.AllowedIPs != nil {
+		allowedIPs = *update.AllowedIPs
+	}
+	for _, ip := range update.Add {
+		if !contains(allowedIPs, ip) {
+			allowedIPs = append(allowedIPs, ip)
+		}
+	}
+	var kept []string
+	for _, ip := range allowedIPs {
+		if !contains(update.Remove, ip) {
+			kept = append(kept, ip)
+		}
+	}
+	session.AllowedIPs = kept
+	session.LastUpdated = strconv.Itoa(int(time.Now().Unix()))
+
+	if err := GlobalSessionManager.UpdateSession(keyName, &session, keyLifetime(&session), isHashed); err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "api",
+			"key":    obfuscateKey(keyName),
+		}).WithError(err).Error("Failed to update the allowed IPs of the key")
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Could not write key data"))
+		return
+	}
+	emitKeyspaceEvent(KeyspaceEventUpdated, session.OrgID, keyName, isHashed)
+
+	log.WithFields(logrus.Fields{
+		"prefix": "api",
+		"key":    obfuscateKey(keyName),
+		"status": "ok",
+	}).Info("Updated the allowed IPs of the key.")
+
+	doJSONWrite(w, http.StatusOK, apiKeyAllowedIPs{Key: keyName, AllowedIPs: session.AllowedIPs})
+}
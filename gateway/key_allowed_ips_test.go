@@ -0,0 +1,51 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestKeyAllowedIPs(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/"
+	})
+
+	key := CreateSession(func(s *user.SessionState) {
+		s.AccessRights = map[string]user.AccessDefinition{"test": {APIID: "test", Versions: []string{"v1"}}}
+		s.AllowedIPs = []string{"10.0.0.0/8", "2001:db8::/32"}
+	})
+	authHeaders := map[string]string{"Authorization": key}
+	allowedIPs := "/tyk/keys/" + key + "/allowed-ips"
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/", Headers: authHeaders, Code: http.StatusForbidden, BodyMatch: "disallowed for this key"},
+		{Path: "/", Headers: map[string]string{"Authorization": key, "X-Real-IP": "10.1.2.3"}, Code: http.StatusOK},
+		{Path: "/", Headers: map[string]string{"Authorization": key, "X-Real-IP": "2001:db8::1"}, Code: http.StatusOK},
+		{Method: http.MethodPatch, Path: allowedIPs, Data: `{"add": ["not-an-ip"]}`, AdminAuth: true,
+			Code: http.StatusBadRequest},
+		{Method: http.MethodPatch, Path: "/tyk/keys/unknown/allowed-ips", Data: `{"add": ["127.0.0.1"]}`, AdminAuth: true,
+			Code: http.StatusNotFound},
+		{Method: http.MethodPatch, Path: allowedIPs, Data: `{"add": ["127.0.0.1"], "remove": ["10.0.0.0/8"]}`, AdminAuth: true,
+			Code: http.StatusOK, BodyMatch: `"allowed_ips":\["2001:db8::/32","127.0.0.1"\]`},
+		{Path: "/", Headers: authHeaders, Code: http.StatusOK},
+		{Path: "/", Headers: map[string]string{"Authorization": key, "X-Real-IP": "10.1.2.3"}, Code: http.StatusForbidden},
+		{Method: http.MethodPatch, Path: allowedIPs, Data: `{"allowed_ips": []}`, AdminAuth: true, Code: http.StatusOK},
+		{Path: "/", Headers: map[string]string{"Authorization": key, "X-Real-IP": "10.1.2.3"}, Code: http.StatusOK},
+	}...)
+}
+
+func TestValidateAllowedIPs(t *testing.T) {
+	if err := validateAllowedIPs([]string{"192.168.0.1", "10.0.0.0/8", "::1", "fd00::/8"}); err != nil {
+		t.Error(err)
+	}
+	if err := validateAllowedIPs([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("Expected invalid CIDR ranges to be rejected")
+	}
+}
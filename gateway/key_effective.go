@@ -0,0 +1,208 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// limitOverrideContributor stands for the active limit override of a key in
+// policy traces, where it is applied after the policies.
+const limitOverrideContributor = "limit_override"
+
+// policyTraceIgnored are the session fields left out of policy traces, as
+// they change without affecting what the key can do.
+var policyTraceIgnored = map[string]bool{
+	"last_updated": true,
+}
+
+// policyTraceEntry is a change made to a field of a session by a policy, or
+// by the active limit override of the key, whose PolicyID is
+// "limit_override".
+//
+// swagger:model policyTraceEntry
+type policyTraceEntry struct {
+	PolicyID string      `json:"policy_id"`
+	Field    string      `json:"field"`
+	From     interface{} `json:"from"`
+	To       interface{} `json:"to"`
+	// Overrides is the policy that set the previous value, empty if it came
+	// from the key itself.
+	Overrides string `json:"overrides,omitempty"`
+}
+
+// apiKeyEffective is a key with its policies applied, along with the fields
+// each policy set.
+//
+// swagger:model apiKeyEffective
+type apiKeyEffective struct {
+	Session *user.SessionState `json:"session"`
+	// Fields maps the fields changed by policies, such as
+	// access_rights.{api_id}.limit.rate, to the policy that changed them
+	// last, or to "limit_override" for the limits changed by the active
+	// limit override. Fields set to the value the key already has are not
+	// listed.
+	Fields map[string]string  `json:"fields"`
+	Trace  []policyTraceEntry `json:"trace"`
+}
+
+// flattenSession returns the fields of the JSON encoding of a session by
+// path, with objects flattened and arrays kept whole.
+func flattenSession(session *user.SessionState) map[string]interface{} {
+	fields := map[string]interface{}{}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fields
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fields
+	}
+
+	var walk func(prefix string, obj map[string]interface{})
+	walk = func(prefix string, obj map[string]interface{}) {
+		for k, v := range obj {
+			path := prefix + k
+			if child, ok := v.(map[string]interface{}); ok && len(child) > 0 {
+				walk(path+".", child)
+				continue
+			}
+			fields[path] = v
+		}
+	}
+	walk("", doc)
+	return fields
+}
+
+// traceKeyPolicies applies the policies of session one by one to copies of
+// it, then its active limit override, recording the fields each of them
+// changed. The effective session is the one requests are limited by.
+func traceKeyPolicies(session *user.SessionState) (apiKeyEffective, error) {
+	effective := apiKeyEffective{Session: session, Fields: map[string]string{}, Trace: []policyTraceEntry{}}
+	policies := session.GetPolicyIDs()
+	mw := BaseMiddleware{}
+
+	prev := flattenSession(session)
+	for i, polID := range policies {
+		step := session.Clone()
+		step.SetPolicies(policies[:i+1]...)
+		if err := mw.ApplyPolicies(&step); err != nil {
+			return effective, err
+		}
+		step.ApplyPolicies = session.ApplyPolicies
+		step.ApplyPolicyID = session.ApplyPolicyID
+
+		prev = effective.record(polID, prev, flattenSession(&step))
+		effective.Session = &step
+	}
+
+	if session.LimitOverride.Active(time.Now().Unix()) {
+		step := effective.Session.Clone()
+		applyLimitOverride(&step)
+		effective.record(limitOverrideContributor, prev, flattenSession(&step))
+		effective.Session = &step
+	}
+
+	return effective, nil
+}
+
+// record adds the fields contributor changed from prev to cur to the trace,
+// and returns cur.
+func (e *apiKeyEffective) record(contributor string, prev, cur map[string]interface{}) map[string]interface{} {
+	paths := make([]string, 0, len(cur)+len(prev))
+	for path := range cur {
+		paths = append(paths, path)
+	}
+	for path := range prev {
+		if _, ok := cur[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if policyTraceIgnored[path] || reflect.DeepEqual(prev[path], cur[path]) {
+			continue
+		}
+		e.Trace = append(e.Trace, policyTraceEntry{
+			PolicyID:  contributor,
+			Field:     path,
+			From:      prev[path],
+			To:        cur[path],
+			Overrides: e.Fields[path],
+		})
+		e.Fields[path] = contributor
+	}
+	return cur
+}
+
+// applyLimitOverride applies the limit override of session to the limits
+// requests use, as GetAccessDefinitionByAPIIDOrSession does: those of the
+// access rights that have some, those of the session for the others.
+func applyLimitOverride(session *user.SessionState) {
+	override := session.LimitOverride
+	sessionLimits := len(session.AccessRights) == 0
+	for apiID, rights := range session.AccessRights {
+		if rights.Limit == nil {
+			sessionLimits = true
+			continue
+		}
+		rights.Limit = override.Apply(rights.Limit)
+		session.AccessRights[apiID] = rights
+	}
+	if !sessionLimits {
+		return
+	}
+
+	limit := override.Apply(&user.APILimit{Rate: session.Rate, Per: session.Per, QuotaMax: session.QuotaMax})
+	session.Rate, session.Per, session.QuotaMax = limit.Rate, limit.Per, limit.QuotaMax
+}
+
+// Get the effective key
+// Returns the key with its policies and its active limit override applied,
+// as requests see it, along with the fields each of them set and the values
+// they replaced, in the order they are applied.
+//
+//---
+// responses:
+//   200:
+//     description: Key with its policies applied
+//     schema:
+//       "$ref": "#/definitions/apiKeyEffective"
+//   400:
+//     description: Policies cannot be applied
+//     schema:
+//       "$ref": "#/definitions/apiPolicyError"
+//   404:
+//     description: Key not found
+//     schema:
+//       "$ref": "#/definitions/apiStatusMessage"
+func keyEffectiveHandler(w http.ResponseWriter, r *http.Request) {
+	keyName := mux.Vars(r)["keyName"]
+	orgID := r.URL.Query().Get("org_id")
+	isHashed := keyIdentifierHashed(r, keyName, orgID)
+
+	session, found := GlobalSessionManager.SessionDetail(orgID, keyName, isHashed)
+	if !found {
+		doJSONWrite(w, http.StatusNotFound, apiError("Key not found"))
+		return
+	}
+
+	effective, err := traceKeyPolicies(&session)
+	if err != nil {
+		resp := apiPolicyError{Status: "error", Message: err.Error()}
+		if policyErr, ok := err.(*policyApplyError); ok {
+			resp.Reason = policyErr.Reason
+			resp.PolicyIDs = policyErr.PolicyIDs
+		}
+		doJSONWrite(w, http.StatusBadRequest, resp)
+		return
+	}
+	doJSONWrite(w, http.StatusOK, effective)
+}
@@ -0,0 +1,91 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestKeyEffective(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI()
+
+	withRate := func(rate float64) func(p *user.Policy) {
+		return func(p *user.Policy) {
+			p.Rate = rate
+			p.Per = 60
+			p.Tags = []string{"from-policy"}
+			p.AccessRights = map[string]user.AccessDefinition{"test": {APIID: "test", Versions: []string{"v1"}}}
+		}
+	}
+	slow := CreatePolicy(withRate(10))
+	fast := CreatePolicy(withRate(20))
+
+	key := CreateSession(func(s *user.SessionState) {
+		s.Rate = 0
+		s.Per = 0
+		s.SetPolicies(slow, fast)
+	})
+
+	resp, _ := ts.Run(t, test.TestCase{Path: "/tyk/keys/" + key + "/effective", AdminAuth: true, Code: http.StatusOK})
+	var effective apiKeyEffective
+	if err := json.NewDecoder(resp.Body).Decode(&effective); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := effective.Session.AccessRights["test"].Limit.Rate; got != 20 {
+		t.Errorf("Expected the merged rate to be 20, got %v", got)
+	}
+	if got := effective.Fields["access_rights.test.limit.rate"]; got != fast {
+		t.Errorf("Expected the rate to be set by %s, got %q", fast, got)
+	}
+
+	var overridden bool
+	for _, entry := range effective.Trace {
+		if entry.Field == "access_rights.test.limit.rate" && entry.PolicyID == fast {
+			overridden = entry.Overrides == slow && entry.From == float64(10) && entry.To == float64(20)
+		}
+	}
+	if !overridden {
+		t.Errorf("Expected the trace to show %s overriding the rate of %s, got %+v", fast, slow, effective.Trace)
+	}
+
+	_, _ = ts.Run(t, test.TestCase{Path: "/tyk/keys/unknown/effective", AdminAuth: true, Code: http.StatusNotFound})
+}
+
+func TestTraceKeyLimitOverride(t *testing.T) {
+	session := user.NewSessionState()
+	session.AccessRights = map[string]user.AccessDefinition{"test": {
+		APIID: "test", Limit: &user.APILimit{Rate: 10, Per: 60},
+	}}
+	session.LimitOverride = &user.LimitOverride{RateMultiplier: 2, Expires: time.Now().Unix() + 60}
+
+	effective, err := traceKeyPolicies(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := effective.Session.AccessRights["test"].Limit.Rate; got != 20 {
+		t.Errorf("Expected the overridden rate to be 20, got %v", got)
+	}
+	if session.AccessRights["test"].Limit.Rate != 10 {
+		t.Error("Expected the key to be left unchanged")
+	}
+	expected := []policyTraceEntry{{
+		PolicyID: limitOverrideContributor, Field: "access_rights.test.limit.rate", From: float64(10), To: float64(20),
+	}}
+	if !reflect.DeepEqual(effective.Trace, expected) {
+		t.Errorf("Expected the override in the trace, got %+v", effective.Trace)
+	}
+
+	session.LimitOverride.Expires = time.Now().Unix() - 1
+	if effective, _ = traceKeyPolicies(session); len(effective.Trace) != 0 {
+		t.Errorf("Expected an expired override not to apply, got %+v", effective.Trace)
+	}
+}
@@ -0,0 +1,240 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const (
+	keyExpiryAuditDefaultWindow = 72 * time.Hour
+	keyExpiryAuditInterval      = 24 * time.Hour
+)
+
+// expiringKey is a key that expires within the requested window. Expires
+// is the session expiry and TTL the seconds left before the key is removed
+// from the store, ExpiresAt is the earliest of both.
+// swagger:model
+type expiringKey struct {
+	KeyHash   string   `json:"key_hash"`
+	OrgID     string   `json:"org_id"`
+	APIIDs    []string `json:"api_ids"`
+	Expires   int64    `json:"expires"`
+	TTL       int64    `json:"ttl"`
+	ExpiresAt int64    `json:"expires_at"`
+}
+
+// keyExpiryReport lists the keys expiring within a window, in seconds, along
+// with the number of expiring keys per organisation and per API.
+// swagger:model
+type keyExpiryReport struct {
+	Within int64          `json:"within"`
+	Count  int            `json:"count"`
+	Keys   []expiringKey  `json:"keys"`
+	Orgs   map[string]int `json:"orgs"`
+	APIs   map[string]int `json:"apis"`
+}
+
+// keyExpiryAuditStore is the store of the sessions read by the key expiry
+// audit.
+type keyExpiryAuditStore interface {
+	ScanKeysValuesAndTTLs(keep func(key string) bool, fn func(key string, value storage.KeyValueTTL) error) error
+}
+
+// buildKeyExpiryReport goes through all sessions in the store and reports
+// the ones that expire, or are removed from the store, within the window.
+// Keys that have already expired are left out.
+func buildKeyExpiryReport(store keyExpiryAuditStore, within time.Duration, orgID string) (keyExpiryReport, error) {
+	report := keyExpiryReport{
+		Within: int64(within.Seconds()),
+		Keys:   []expiringKey{},
+		Orgs:   map[string]int{},
+		APIs:   map[string]int{},
+	}
+
+	now := time.Now().Unix()
+	deadline := time.Now().Add(within).Unix()
+
+	keep := func(key string) bool {
+		return !strings.HasPrefix(key, QuotaKeyPrefix) && !strings.HasPrefix(key, RateLimitKeyPrefix)
+	}
+	err := store.ScanKeysValuesAndTTLs(keep, func(key string, value storage.KeyValueTTL) error {
+		session := &user.SessionState{}
+		if err := json.Unmarshal([]byte(value.Value), session); err != nil {
+			return nil
+		}
+		if orgID != "" && session.OrgID != orgID {
+			return nil
+		}
+
+		expiresAt := session.Expires
+		ttl := value.TTL
+		if ttl > 0 && (expiresAt <= 0 || now+ttl < expiresAt) {
+			expiresAt = now + ttl
+		}
+		if expiresAt <= 0 || expiresAt < now || expiresAt > deadline {
+			return nil
+		}
+
+		keyHash := key
+		if !config.Global().HashKeys {
+			keyHash = storage.HashStr(key)
+		}
+
+		apiIDs := make([]string, 0, len(session.AccessRights))
+		for apiID := range session.AccessRights {
+			apiIDs = append(apiIDs, apiID)
+			report.APIs[apiID]++
+		}
+		sort.Strings(apiIDs)
+		report.Orgs[session.OrgID]++
+
+		report.Keys = append(report.Keys, expiringKey{
+			KeyHash:   keyHash,
+			OrgID:     session.OrgID,
+			APIIDs:    apiIDs,
+			Expires:   session.Expires,
+			TTL:       ttl,
+			ExpiresAt: expiresAt,
+		})
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	sort.Slice(report.Keys, func(i, j int) bool {
+		if report.Keys[i].ExpiresAt != report.Keys[j].ExpiresAt {
+			return report.Keys[i].ExpiresAt < report.Keys[j].ExpiresAt
+		}
+		return report.Keys[i].KeyHash < report.Keys[j].KeyHash
+	})
+	report.Count = len(report.Keys)
+
+	return report, nil
+}
+
+// sessionStoreForAudit reads the session store without hashing key names, as
+// the listed names are already in their stored form.
+func sessionStoreForAudit() keyExpiryAuditStore {
+	return &storage.RedisCluster{KeyPrefix: GlobalSessionManager.Store().GetKeyPrefix()}
+}
+
+// List keys about to expire
+// Lists the hashes of keys that expire within a window, such as `72h`, with a
+// breakdown per organisation and per API. The window defaults to 72 hours.
+//
+//---
+// parameters:
+// - name: within
+//   in: query
+//   type: string
+// - name: org_id
+//   in: query
+//   type: string
+// responses:
+//   200:
+//     description: Keys expiring within the window
+//     schema:
+//       "$ref": "#/definitions/keyExpiryReport"
+//   400:
+//     description: Invalid window
+//   404:
+//     description: Hashed key listing is disabled
+func expiringKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if config.Global().HashKeys && !config.Global().EnableHashedKeysListing {
+		doJSONWrite(w, http.StatusNotFound, apiError("Hashed key listing is disabled in config (enable_hashed_keys_listing)"))
+		return
+	}
+
+	within := keyExpiryAuditDefaultWindow
+	if value := r.URL.Query().Get("within"); value != "" {
+		var err error
+		within, err = time.ParseDuration(value)
+		if err != nil || within <= 0 {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Invalid within duration"))
+			return
+		}
+	}
+
+	report, err := buildKeyExpiryReport(sessionStoreForAudit(), within, r.URL.Query().Get("org_id"))
+	if err != nil {
+		log.WithError(err).Error("Failed to list expiring keys")
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Failed to list expiring keys"))
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix": "api",
+		"status": "ok",
+	}).Info("Retrieved expiring key list.")
+
+	doJSONWrite(w, http.StatusOK, report)
+}
+
+// keyExpiryAuditLoop sends the key expiry report to the configured webhook
+// once a day. Only one gateway of the cluster sends it each day.
+func keyExpiryAuditLoop(ctx context.Context, conf config.KeyExpiryAuditConfig) {
+	h := &WebHookHandler{}
+	if err := h.Init(conf.Webhook); err != nil {
+		mainLog.Error("Failed to initialise key expiry audit webhook: ", err)
+		return
+	}
+
+	within := keyExpiryAuditDefaultWindow
+	if conf.Window > 0 {
+		within = time.Duration(conf.Window) * time.Second
+	}
+
+	lock := &storage.RedisCluster{}
+	tick := time.NewTicker(keyExpiryAuditInterval)
+	defer tick.Stop()
+
+	for {
+		// The lock expires slightly before the next run, so that the
+		// gateway holding it does not skip a day.
+		taken, err := incrementRawKey(lock, "key-expiry-audit-lock", int64((keyExpiryAuditInterval-time.Minute).Seconds()))
+		switch {
+		case err != nil:
+			log.WithError(err).Error("Couldn't take the key expiry audit lock")
+		case taken == 1:
+			sendKeyExpiryReport(h, within)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// sendKeyExpiryReport sends the report of the keys expiring within the
+// window to the webhook.
+func sendKeyExpiryReport(h *WebHookHandler, within time.Duration) {
+	report, err := buildKeyExpiryReport(sessionStoreForAudit(), within, "")
+	if err != nil {
+		mainLog.WithError(err).Error("Failed to build the key expiry report")
+		return
+	}
+	h.HandleEvent(config.EventMessage{
+		Type: EventKeyExpiryReport,
+		Meta: EventKeyExpiryReportMeta{
+			EventMetaDefault: EventMetaDefault{
+				Message: fmt.Sprintf("%d keys expire within %s", report.Count, within),
+			},
+			Report: report,
+		},
+		TimeStamp: time.Now().Local().String(),
+	})
+}
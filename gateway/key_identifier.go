@@ -0,0 +1,76 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+// keyHashLengths returns the lengths of the hashes keys may be stored under:
+// those of the hash functions in use, and of murmur32 for legacy keys.
+func keyHashLengths(conf config.Config) map[int]bool {
+	lengths := map[int]bool{}
+	algos := append([]string{storage.HashMurmur32, storage.HashMurmur64, conf.HashKeyFunction}, conf.HashKeyFunctionFallback...)
+	for _, algo := range algos {
+		lengths[len(storage.HashStr("", algo))] = true
+	}
+	return lengths
+}
+
+// looksLikeKeyHash reports whether keyName has the format of a key hash:
+// lower case hex of the length of a hash in use. Keys in the JSON format
+// never do.
+func looksLikeKeyHash(conf config.Config, keyName string) bool {
+	if !conf.HashKeys || storage.TokenHashAlgo(keyName) != "" {
+		return false
+	}
+	if !keyHashLengths(conf)[len(keyName)] {
+		return false
+	}
+	for _, c := range keyName {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// keyIdentifierHashed reports whether the key identifier of a keys endpoint
+// request is a key hash. The hashed query parameter decides when set, and
+// is the only way to tell unless detect_key_hashes is enabled. Identifiers
+// that look like a hash, but belong to a raw key with no session under them
+// as a hash, are raw keys.
+func keyIdentifierHashed(r *http.Request, keyName, orgID string) bool {
+	hashed := r.URL.Query().Get("hashed")
+	conf := config.Global()
+	if !conf.DetectKeyHashes {
+		return hashed != ""
+	}
+	if hashed != "" {
+		if explicit, err := strconv.ParseBool(hashed); err == nil {
+			return explicit
+		}
+		return true
+	}
+	if keyName == "" || !looksLikeKeyHash(conf, keyName) {
+		return false
+	}
+
+	isHashed := true
+	store := GlobalSessionManager.Store()
+	if _, err := store.GetRawKey(store.GetKeyPrefix() + keyName); err != nil {
+		if _, found := GlobalSessionManager.SessionDetail(orgID, keyName, false); found {
+			isHashed = false
+		}
+	}
+	log.WithFields(logrus.Fields{
+		"prefix": "api",
+		"key":    obfuscateKey(keyName),
+		"hashed": isHashed,
+	}).Debug("Detected the format of a key identifier")
+	return isHashed
+}
@@ -0,0 +1,67 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestLooksLikeKeyHash(t *testing.T) {
+	conf := config.Config{HashKeys: true, HashKeyFunction: storage.HashSha256}
+	token, _ := storage.GenerateToken("default", "", storage.HashSha256)
+
+	tests := []struct {
+		keyName string
+		want    bool
+	}{
+		{storage.HashStr(token), true},
+		{storage.HashStr("legacy"), true},
+		{storage.HashStr("legacy", storage.HashMurmur64), true},
+		{token, false},
+		{"default" + "0123456789abcdef0123456789abcdef", false},
+		{"DEADBEEF", false},
+		{"not-a-hash", false},
+	}
+	for _, tc := range tests {
+		if got := looksLikeKeyHash(conf, tc.keyName); got != tc.want {
+			t.Errorf("looksLikeKeyHash(%q) = %v, want %v", tc.keyName, got, tc.want)
+		}
+	}
+
+	conf.HashKeys = false
+	if looksLikeKeyHash(conf, storage.HashStr("legacy")) {
+		t.Error("Keys are never hashes when hash_keys is disabled")
+	}
+}
+
+func TestKeyIdentifierDetection(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.HashKeys = true
+	globalConf.DetectKeyHashes = true
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI()
+
+	key := CreateSession(func(s *user.SessionState) {
+		s.AccessRights = map[string]user.AccessDefinition{"test": {APIID: "test", Versions: []string{"v1"}}}
+	})
+	keyHash := storage.HashKey(key)
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/tyk/keys/" + key, AdminAuth: true, Code: http.StatusOK},
+		{Path: "/tyk/keys/" + keyHash, AdminAuth: true, Code: http.StatusOK},
+		{Path: "/tyk/keys/" + keyHash + "?hashed=true", AdminAuth: true, Code: http.StatusOK},
+		// the hashed parameter overrides the detection
+		{Path: "/tyk/keys/" + keyHash + "?hashed=false", AdminAuth: true, Code: http.StatusNotFound},
+		{Method: http.MethodDelete, Path: "/tyk/keys/" + keyHash, AdminAuth: true, Code: http.StatusOK},
+		{Path: "/tyk/keys/" + key, AdminAuth: true, Code: http.StatusNotFound},
+	}...)
+}
@@ -0,0 +1,98 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// keyLimitOverrideUpdate attaches a limit override to a key for TTL seconds.
+type keyLimitOverrideUpdate struct {
+	user.LimitOverride
+	TTL int64 `json:"ttl"`
+}
+
+type apiKeyLimitOverride struct {
+	Key           string              `json:"key"`
+	LimitOverride *user.LimitOverride `json:"limit_override"`
+}
+
+func (u *keyLimitOverrideUpdate) validate() error {
+	if u.TTL <= 0 {
+		return errors.New("ttl must be a positive number of seconds")
+	}
+	if u.RateMultiplier < 0 || u.QuotaMultiplier < 0 || u.Rate < 0 || u.Per < 0 {
+		return errors.New("rates, periods and multipliers can't be negative")
+	}
+	if u.RateMultiplier == 0 && u.QuotaMultiplier == 0 && u.Rate == 0 && u.QuotaMax == 0 {
+		return errors.New("the override changes no limit")
+	}
+	return nil
+}
+
+// keyLimitOverrideHandler attaches a temporary limit override to a key, or
+// removes it, without changing the rest of its session. Overrides stop
+// applying once they expire.
+func keyLimitOverrideHandler(w http.ResponseWriter, r *http.Request) {
+	keyName := mux.Vars(r)["keyName"]
+	orgID := r.URL.Query().Get("org_id")
+	isHashed := keyIdentifierHashed(r, keyName, orgID)
+
+	var update keyLimitOverrideUpdate
+	if r.Method == http.MethodPatch {
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Couldn't decode instruction"))
+			return
+		}
+		if err := update.validate(); err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+			return
+		}
+	}
+
+	session, found := GlobalSessionManager.SessionDetail(orgID, keyName, isHashed)
+	if !found {
+		doJSONWrite(w, http.StatusNotFound, apiError("Key not found"))
+		return
+	}
+
+	session.LimitOverride = nil
+	if r.Method == http.MethodPatch {
+		override := update.LimitOverride
+		override.Expires = time.Now().Unix() + update.TTL
+		session.LimitOverride = &override
+	}
+	session.LastUpdated = strconv.Itoa(int(time.Now().Unix()))
+
+	if err := GlobalSessionManager.UpdateSession(keyName, &session, keyLifetime(&session), isHashed); err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "api",
+			"key":    obfuscateKey(keyName),
+		}).WithError(err).Error("Failed to update the limit override of the key")
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Could not write key data"))
+		return
+	}
+	emitKeyspaceEvent(KeyspaceEventUpdated, session.OrgID, keyName, isHashed)
+
+	fields := logrus.Fields{
+		"prefix": "api",
+		"key":    obfuscateKey(keyName),
+		"status": "ok",
+	}
+	if session.LimitOverride != nil {
+		fields["expires"] = session.LimitOverride.Expires
+		fields["reason"] = session.LimitOverride.Reason
+		log.WithFields(fields).Info("Attached a limit override to the key.")
+	} else {
+		log.WithFields(fields).Info("Removed the limit override of the key.")
+	}
+
+	doJSONWrite(w, http.StatusOK, apiKeyLimitOverride{Key: keyName, LimitOverride: session.LimitOverride})
+}
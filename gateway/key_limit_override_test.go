@@ -0,0 +1,72 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestLimitOverrideApply(t *testing.T) {
+	limit := &user.APILimit{Rate: 10, Per: 60, QuotaMax: 100}
+
+	boosted := (&user.LimitOverride{RateMultiplier: 2, QuotaMultiplier: 1.5}).Apply(limit)
+	if boosted.Rate != 20 || boosted.Per != 60 || boosted.QuotaMax != 150 {
+		t.Errorf("Expected multiplied limits, got %+v", boosted)
+	}
+	if limit.Rate != 10 || limit.QuotaMax != 100 {
+		t.Error("Expected the original limit to be left alone")
+	}
+
+	replaced := (&user.LimitOverride{Rate: 5, Per: 1, QuotaMax: -1}).Apply(limit)
+	if replaced.Rate != 5 || replaced.Per != 1 || replaced.QuotaMax != -1 {
+		t.Errorf("Expected replaced limits, got %+v", replaced)
+	}
+
+	unlimited := (&user.LimitOverride{RateMultiplier: 2, QuotaMultiplier: 2}).Apply(&user.APILimit{Rate: -1, QuotaMax: -1})
+	if unlimited.Rate != -1 || unlimited.QuotaMax != -1 {
+		t.Errorf("Expected unlimited limits to stay unlimited, got %+v", unlimited)
+	}
+
+	var none *user.LimitOverride
+	now := time.Now().Unix()
+	if none.Active(now) || (&user.LimitOverride{Expires: now - 1}).Active(now) {
+		t.Error("Expected missing and expired overrides to be inactive")
+	}
+}
+
+func TestKeyLimitOverride(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/"
+	})
+
+	key := CreateSession(func(s *user.SessionState) {
+		s.AccessRights = map[string]user.AccessDefinition{"test": {APIID: "test", Versions: []string{"v1"}}}
+		s.QuotaMax = 1
+		s.QuotaRemaining = 1
+		s.QuotaRenewalRate = 3600
+	})
+	authHeaders := map[string]string{"Authorization": key}
+	override := "/tyk/keys/" + key + "/override"
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/", Headers: authHeaders, Code: http.StatusOK},
+		{Path: "/", Headers: authHeaders, Code: http.StatusForbidden},
+		{Method: http.MethodPatch, Path: override, Data: `{"quota_max": 3}`, AdminAuth: true, Code: http.StatusBadRequest,
+			BodyMatch: "ttl"},
+		{Method: http.MethodPatch, Path: "/tyk/keys/unknown/override", Data: `{"quota_max": 3, "ttl": 60}`, AdminAuth: true,
+			Code: http.StatusNotFound},
+		{Method: http.MethodPatch, Path: override, Data: `{"quota_max": 3, "ttl": 60, "reason": "launch"}`, AdminAuth: true,
+			Code: http.StatusOK, BodyMatch: `"reason":"launch"`},
+		{Path: "/", Headers: authHeaders, Code: http.StatusOK},
+		{Path: "/", Headers: authHeaders, Code: http.StatusForbidden},
+		{Method: http.MethodDelete, Path: override, AdminAuth: true, Code: http.StatusOK, BodyMatch: `"limit_override":null`},
+		{Path: "/", Headers: authHeaders, Code: http.StatusForbidden},
+	}...)
+}
@@ -0,0 +1,297 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+const (
+	keysRehashBatchSize = 100
+	keysRehashLockTTL   = int64(time.Hour / time.Second)
+
+	keysRehashLockKey   = "keys-rehash-lock"
+	keysRehashStatusKey = "keys-rehash-status"
+
+	keysRehashRunning  = "running"
+	keysRehashFinished = "finished"
+)
+
+// keysRehashRequest starts the migration of keys to the current
+// hash_key_function.
+//
+// swagger:model keysRehashRequest
+type keysRehashRequest struct {
+	// GracePeriod is how long, in seconds, keys stay reachable under their
+	// previous name. With 0, the previous names are removed straight away.
+	GracePeriod int64 `json:"grace_period"`
+	// Keys are the keys to rehash, by their name as listed by /tyk/keys.
+	// Without them, every custom key is rehashed.
+	Keys []string `json:"keys"`
+}
+
+// keysRehashStatus reports the progress of the last migration of keys to the
+// current hash_key_function, made by any gateway of the cluster.
+//
+// swagger:model keysRehashStatus
+type keysRehashStatus struct {
+	Status          string    `json:"status"`
+	HashKeyFunction string    `json:"hash_key_function"`
+	GracePeriod     int64     `json:"grace_period"`
+	Keys            []string  `json:"keys,omitempty"`
+	StartedAt       time.Time `json:"started_at"`
+	FinishedAt      time.Time `json:"finished_at"`
+
+	Scanned  int `json:"scanned"`
+	Rehashed int `json:"rehashed"`
+	Skipped  int `json:"skipped"`
+	Failed   int `json:"failed"`
+}
+
+func loadKeysRehashStatus() (status keysRehashStatus, found bool) {
+	data, err := (&storage.RedisCluster{}).GetRawKey(keysRehashStatusKey)
+	if err != nil {
+		return status, false
+	}
+	if err := json.Unmarshal([]byte(data), &status); err != nil {
+		log.WithError(err).Error("Couldn't unmarshal keys rehash status")
+		return status, false
+	}
+	return status, true
+}
+
+func storeKeysRehashStatus(status keysRehashStatus) {
+	data, err := json.Marshal(status)
+	if err != nil {
+		log.WithError(err).Error("Couldn't marshal keys rehash status")
+		return
+	}
+	if err := (&storage.RedisCluster{}).SetRawKey(keysRehashStatusKey, string(data), 0); err != nil {
+		log.WithError(err).Error("Couldn't store keys rehash status")
+	}
+}
+
+// rehashKey copies the session stored under key to the name the key has under
+// hashAlgorithm. The previous name expires after gracePeriod seconds, unless
+// it expires earlier, or is removed if gracePeriod is 0. It reports whether
+// the key was rehashed; a nil error with false means the key was skipped.
+func rehashKey(store storage.Handler, key, hashAlgorithm string, gracePeriod int64) (bool, error) {
+	// Only keys in the JSON format carry the org and ID needed to name
+	// them again; legacy keys are the concatenation of both.
+	currentAlgorithm := storage.TokenHashAlgo(key)
+	if currentAlgorithm == "" || currentAlgorithm == hashAlgorithm {
+		return false, nil
+	}
+
+	keyID, err := storage.TokenID(key)
+	if err != nil {
+		return false, nil
+	}
+	newKey, err := storage.GenerateToken(storage.TokenOrg(key), keyID, hashAlgorithm)
+	if err != nil {
+		return false, err
+	}
+	if exists, err := store.Exists(newKey); err != nil || exists {
+		return false, err
+	}
+
+	session, err := store.GetKey(key)
+	if err != nil {
+		return false, err
+	}
+	ttl, err := store.GetExp(key)
+	if err != nil {
+		return false, err
+	}
+	if ttl < 0 {
+		ttl = 0
+	}
+	if err := store.SetKey(newKey, session, ttl); err != nil {
+		return false, err
+	}
+
+	switch {
+	case gracePeriod == 0:
+		GlobalSessionManager.RemoveSession(storage.TokenOrg(key), key, false)
+	case ttl == 0 || gracePeriod < ttl:
+		if err := store.SetExp(key, gracePeriod); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// isGeneratedKeyID reports whether a key ID is one generated by the gateway,
+// rather than a custom key name. Clients hold generated keys as they were
+// issued, so those mustn't be renamed.
+func isGeneratedKeyID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	for _, c := range id {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// runKeysRehash rehashes the keys listed in status, or every custom key
+// scanned from the store if there are none, storing its progress every batch
+// of keys.
+func runKeysRehash(status keysRehashStatus) keysRehashStatus {
+	store := GlobalSessionManager.Store()
+
+	rehash := func(key string) error {
+		if status.Scanned > 0 && status.Scanned%keysRehashBatchSize == 0 {
+			storeKeysRehashStatus(status)
+		}
+		status.Scanned++
+
+		rehashed, err := rehashKey(store, key, status.HashKeyFunction, status.GracePeriod)
+		switch {
+		case err != nil:
+			status.Failed++
+			log.WithError(err).WithField("key", obfuscateKey(key)).Error("Couldn't rehash key")
+		case rehashed:
+			status.Rehashed++
+		default:
+			status.Skipped++
+		}
+		return nil
+	}
+
+	if len(status.Keys) > 0 {
+		for _, key := range status.Keys {
+			rehash(key)
+		}
+	} else {
+		err := scanKeys(store, "", func(key string) error {
+			if keyID, err := storage.TokenID(key); err == nil && isGeneratedKeyID(keyID) {
+				status.Scanned++
+				status.Skipped++
+				return nil
+			}
+			return rehash(key)
+		})
+		if err != nil {
+			log.WithError(err).Error("Couldn't scan the keys to rehash")
+		}
+	}
+
+	status.Status = keysRehashFinished
+	status.FinishedAt = time.Now()
+	storeKeysRehashStatus(status)
+
+	log.WithFields(logrus.Fields{
+		"prefix":   "api",
+		"scanned":  status.Scanned,
+		"rehashed": status.Rehashed,
+		"skipped":  status.Skipped,
+		"failed":   status.Failed,
+	}).Info("Rehashed keys")
+
+	return status
+}
+
+// Rehash keys
+// Starts copying custom keys to the name they have under the current
+// hash_key_function, so that keys created under a previous one can still be
+// looked up by their custom name. Either the keys listed are copied, or every
+// custom key, keys generated by the gateway being left as they were issued.
+// Keys already stored under their new name are skipped. The previous names
+// are kept for the grace period. Keys can only be renamed when hash_keys is
+// disabled, as a hashed key cannot be hashed again without its raw value.
+// Only one migration runs at a time across the cluster, and its progress is
+// reported by GET.
+//
+//---
+// responses:
+//   202:
+//     description: Migration started
+//     schema:
+//       "$ref": "#/definitions/keysRehashStatus"
+//   400:
+//     description: Keys are hashed or the request is malformed
+//     schema:
+//       "$ref": "#/definitions/apiStatusMessage"
+//   409:
+//     description: A migration is already running
+//     schema:
+//       "$ref": "#/definitions/apiStatusMessage"
+//   503:
+//     description: The migration lock can't be taken
+//     schema:
+//       "$ref": "#/definitions/apiStatusMessage"
+func keysRehashHandler(w http.ResponseWriter, r *http.Request) {
+	conf := config.Global()
+	if conf.HashKeys {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Hashed keys cannot be rehashed without their raw value"))
+		return
+	}
+
+	var req keysRehashRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.GracePeriod < 0 {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+			return
+		}
+	}
+
+	lock := &storage.RedisCluster{}
+	taken, err := incrementRawKey(lock, keysRehashLockKey, keysRehashLockTTL)
+	if err != nil {
+		log.WithError(err).Error("Couldn't take the keys rehash lock")
+		doJSONWrite(w, http.StatusServiceUnavailable, apiError("Keys rehash can't be started at the moment"))
+		return
+	}
+	if taken != 1 {
+		doJSONWrite(w, http.StatusConflict, apiError("Keys rehash is already running"))
+		return
+	}
+
+	status := keysRehashStatus{
+		Status:          keysRehashRunning,
+		HashKeyFunction: conf.HashKeyFunction,
+		GracePeriod:     req.GracePeriod,
+		Keys:            req.Keys,
+		StartedAt:       time.Now(),
+	}
+	storeKeysRehashStatus(status)
+
+	go func() {
+		defer lock.DeleteRawKey(keysRehashLockKey)
+		runKeysRehash(status)
+	}()
+
+	doJSONWrite(w, http.StatusAccepted, status)
+}
+
+// Get keys rehash status
+// Reports the progress of the last migration of keys to the current
+// hash_key_function.
+//
+//---
+// responses:
+//   200:
+//     description: Keys rehash status
+//     schema:
+//       "$ref": "#/definitions/keysRehashStatus"
+//   404:
+//     description: No migration was started
+//     schema:
+//       "$ref": "#/definitions/apiStatusMessage"
+func keysRehashStatusHandler(w http.ResponseWriter, r *http.Request) {
+	status, found := loadKeysRehashStatus()
+	if !found {
+		doJSONWrite(w, http.StatusNotFound, apiError("Keys rehash not started"))
+		return
+	}
+	doJSONWrite(w, http.StatusOK, status)
+}
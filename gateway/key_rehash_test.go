@@ -0,0 +1,111 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestKeysRehash(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.HashKeys = false
+	globalConf.HashKeyFunction = storage.HashMurmur32
+	globalConf.LocalSessionCache.DisableCacheSessionState = true
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	raw := &storage.RedisCluster{}
+	raw.DeleteRawKey(keysRehashStatusKey)
+	defer raw.DeleteRawKey(keysRehashStatusKey)
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.UseKeylessAccess = false
+		spec.AuthConfigs = map[string]apidef.AuthConfig{
+			authTokenType: {},
+		}
+	})
+
+	const customKey = "rehash-custom-key"
+	session := CreateStandardSession()
+	session.AccessRights = map[string]user.AccessDefinition{"test": {
+		APIID: "test", Versions: []string{"v1"},
+	}}
+	authHeader := map[string]string{"Authorization": customKey}
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/tyk/keys/rehash", AdminAuth: true, Code: http.StatusNotFound},
+		{Method: http.MethodPost, Path: "/tyk/keys/" + customKey, Data: session, AdminAuth: true, Code: http.StatusOK},
+		{Headers: authHeader, Code: http.StatusOK},
+	}...)
+
+	oldKey, _ := storage.GenerateToken("default", customKey, storage.HashMurmur32)
+	newKey, _ := storage.GenerateToken("default", customKey, storage.HashMurmur64)
+	store := GlobalSessionManager.Store()
+	defer store.DeleteKey(oldKey)
+	defer store.DeleteKey(newKey)
+
+	// keys generated by the gateway are held by clients as issued
+	generatedKey := CreateSession()
+	generatedID, _ := storage.TokenID(generatedKey)
+	generatedNewKey, _ := storage.GenerateToken("default", generatedID, storage.HashMurmur64)
+	defer store.DeleteKey(generatedKey)
+
+	globalConf.HashKeyFunction = storage.HashMurmur64
+	config.SetGlobal(globalConf)
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Headers: authHeader, Code: http.StatusForbidden},
+		{Method: http.MethodPost, Path: "/tyk/keys/rehash", Data: `{"grace_period": -1}`, AdminAuth: true, Code: http.StatusBadRequest},
+		{Method: http.MethodPost, Path: "/tyk/keys/rehash", Data: `{"grace_period": 60}`, AdminAuth: true, Code: http.StatusAccepted},
+	}...)
+
+	var status keysRehashStatus
+	for i := 0; i < 50; i++ {
+		status, _ = loadKeysRehashStatus()
+		if status.Status == keysRehashFinished {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/tyk/keys/rehash", AdminAuth: true, Code: http.StatusOK, BodyMatchFunc: func(body []byte) bool {
+			var status keysRehashStatus
+			if err := json.Unmarshal(body, &status); err != nil {
+				t.Error(err)
+				return false
+			}
+			return status.Status == keysRehashFinished && status.HashKeyFunction == storage.HashMurmur64 &&
+				status.Rehashed >= 1 && status.Scanned == status.Rehashed+status.Skipped+status.Failed
+		}},
+		{Headers: authHeader, Code: http.StatusOK},
+	}...)
+
+	if ttl, _ := store.GetExp(oldKey); ttl <= 0 || ttl > 60 {
+		t.Error("Expected the previous key name to expire after the grace period, got TTL: ", ttl)
+	}
+	if exists, _ := store.Exists(generatedNewKey); exists {
+		t.Error("Expected generated keys not to be rehashed")
+	}
+	if ttl, _ := store.GetExp(generatedKey); ttl > 0 {
+		t.Error("Expected generated keys to keep their name, got TTL: ", ttl)
+	}
+
+	t.Run("hashed keys", func(t *testing.T) {
+		globalConf.HashKeys = true
+		config.SetGlobal(globalConf)
+
+		_, _ = ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/tyk/keys/rehash", AdminAuth: true, Code: http.StatusBadRequest})
+	})
+}
@@ -0,0 +1,142 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+var (
+	keyTemplatesMu   sync.RWMutex
+	keyTemplatesByID = map[string]user.KeyTemplate{}
+)
+
+// LoadKeyTemplatesFromFile reads key templates by ID from a JSON file, in
+// the same format as policy files.
+func LoadKeyTemplatesFromFile(filePath string) (map[string]user.KeyTemplate, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var templates map[string]user.KeyTemplate
+	if err := json.NewDecoder(f).Decode(&templates); err != nil {
+		return nil, err
+	}
+	for id, tpl := range templates {
+		if tpl.ID == "" {
+			tpl.ID = id
+			templates[id] = tpl
+		}
+	}
+	return templates, nil
+}
+
+// syncKeyTemplates reloads the key templates from policies.key_template_record_name.
+func syncKeyTemplates() {
+	path := config.Global().Policies.KeyTemplateRecordName
+	if path == "" {
+		return
+	}
+	templates, err := LoadKeyTemplatesFromFile(path)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "policy",
+		}).Error("Couldn't load key templates: ", err)
+		return
+	}
+	mainLog.Infof("Key templates found (%d total)", len(templates))
+
+	keyTemplatesMu.Lock()
+	keyTemplatesByID = templates
+	keyTemplatesMu.Unlock()
+}
+
+func getKeyTemplate(id string) (user.KeyTemplate, bool) {
+	keyTemplatesMu.RLock()
+	defer keyTemplatesMu.RUnlock()
+	tpl, ok := keyTemplatesByID[id]
+	return tpl, ok
+}
+
+// metaFieldType returns the type of a metadata value decoded from JSON, as
+// named in key template schemas.
+func metaFieldType(val interface{}) string {
+	switch val.(type) {
+	case string:
+		return "string"
+	case float64, int, int64:
+		return "number"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return ""
+}
+
+// applyKeyTemplate fills in the fields of a key being created that it
+// doesn't set from a template, and checks its metadata against the schema
+// of the template.
+func applyKeyTemplate(session *user.SessionState, tpl user.KeyTemplate) error {
+	if session.OrgID == "" {
+		session.OrgID = tpl.OrgID
+	}
+	if tpl.OrgID != "" && session.OrgID != tpl.OrgID {
+		return fmt.Errorf("key template %s belongs to another org", tpl.ID)
+	}
+	if len(session.GetPolicyIDs()) == 0 && len(tpl.ApplyPolicies) > 0 {
+		session.SetPolicies(tpl.ApplyPolicies...)
+	}
+	tags := make(map[string]bool, len(session.Tags))
+	for _, tag := range session.Tags {
+		tags[tag] = true
+	}
+	for _, tag := range tpl.Tags {
+		if !tags[tag] {
+			session.Tags = append(session.Tags, tag)
+		}
+	}
+	if len(tpl.MetaData) > 0 && session.MetaData == nil {
+		session.MetaData = make(map[string]interface{}, len(tpl.MetaData))
+	}
+	for k, v := range tpl.MetaData {
+		if _, ok := session.MetaData[k]; !ok {
+			session.MetaData[k] = v
+		}
+	}
+	if session.Expires == 0 && tpl.KeyExpiresIn > 0 {
+		session.Expires = time.Now().Unix() + tpl.KeyExpiresIn
+	}
+
+	names := make([]string, 0, len(tpl.MetaDataSchema))
+	for name := range tpl.MetaDataSchema {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		field := tpl.MetaDataSchema[name]
+		val, ok := session.MetaData[name]
+		if !ok {
+			if field.Required {
+				return fmt.Errorf("meta_data.%s is required by key template %s", name, tpl.ID)
+			}
+			continue
+		}
+		if field.Type != "" && metaFieldType(val) != field.Type {
+			return fmt.Errorf("meta_data.%s must be of type %s", name, field.Type)
+		}
+	}
+	return nil
+}
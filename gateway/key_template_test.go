@@ -0,0 +1,107 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestApplyKeyTemplate(t *testing.T) {
+	tpl := user.KeyTemplate{
+		ID:            "gold",
+		OrgID:         "default",
+		ApplyPolicies: []string{"gold-policy"},
+		Tags:          []string{"gold", "provisioned"},
+		MetaData:      map[string]interface{}{"tier": "gold", "region": "eu"},
+		MetaDataSchema: map[string]user.KeyTemplateMetaField{
+			"customer_id": {Type: "string", Required: true},
+			"seats":       {Type: "number"},
+		},
+		KeyExpiresIn: 3600,
+	}
+
+	session := &user.SessionState{
+		Tags:     []string{"provisioned"},
+		MetaData: map[string]interface{}{"region": "us", "customer_id": "c1"},
+	}
+	if err := applyKeyTemplate(session, tpl); err != nil {
+		t.Fatal(err)
+	}
+	if session.OrgID != "default" {
+		t.Errorf("Expected the org of the template, got %q", session.OrgID)
+	}
+	if !reflect.DeepEqual(session.ApplyPolicies, []string{"gold-policy"}) {
+		t.Errorf("Expected the policies of the template, got %v", session.ApplyPolicies)
+	}
+	if !reflect.DeepEqual(session.Tags, []string{"provisioned", "gold"}) {
+		t.Errorf("Expected merged tags, got %v", session.Tags)
+	}
+	if session.MetaData["tier"] != "gold" || session.MetaData["region"] != "us" {
+		t.Errorf("Expected merged metadata, got %v", session.MetaData)
+	}
+	if session.Expires == 0 {
+		t.Error("Expected the key to expire")
+	}
+
+	for name, session := range map[string]*user.SessionState{
+		"missing field": {},
+		"wrong type":    {MetaData: map[string]interface{}{"customer_id": "c1", "seats": "ten"}},
+		"other org":     {OrgID: "other", MetaData: map[string]interface{}{"customer_id": "c1"}},
+	} {
+		if err := applyKeyTemplate(session, tpl); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestKeyTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "key-templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pID := CreatePolicy(func(p *user.Policy) {
+		p.AccessRights = map[string]user.AccessDefinition{"test": {APIID: "test", Versions: []string{"v1"}}}
+	})
+	templates, _ := json.Marshal(map[string]user.KeyTemplate{
+		"gold": {
+			OrgID:          "default",
+			ApplyPolicies:  []string{pID},
+			Tags:           []string{"gold"},
+			MetaDataSchema: map[string]user.KeyTemplateMetaField{"customer_id": {Type: "string", Required: true}},
+		},
+	})
+	path := filepath.Join(dir, "key_templates.json")
+	if err := ioutil.WriteFile(path, templates, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	globalConf := config.Global()
+	globalConf.Policies.KeyTemplateRecordName = path
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI()
+	syncKeyTemplates()
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Method: http.MethodPost, Path: "/tyk/keys/create?template=gold", Data: `{"meta_data": {"customer_id": "c1"}}`,
+			AdminAuth: true, Code: http.StatusOK},
+		{Method: http.MethodPost, Path: "/tyk/keys/create?template=gold", Data: `{}`,
+			AdminAuth: true, Code: http.StatusBadRequest, BodyMatch: "meta_data.customer_id is required"},
+		{Method: http.MethodPost, Path: "/tyk/keys/create?template=silver", Data: `{}`,
+			AdminAuth: true, Code: http.StatusBadRequest, BodyMatch: "Key template not found"},
+	}...)
+}
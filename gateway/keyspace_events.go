@@ -0,0 +1,188 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+const (
+	KeyspaceEventCreated = "created"
+	KeyspaceEventUpdated = "updated"
+	KeyspaceEventDeleted = "deleted"
+	KeyspaceEventRevoked = "revoked"
+
+	keyspaceEventsDefaultBatchSize     = 100
+	keyspaceEventsDefaultFlushInterval = 5 * time.Second
+)
+
+// keyspaceEvent is a change to the keyspace as sent to external systems. Keys
+// are only ever sent hashed.
+type keyspaceEvent struct {
+	Action    string    `json:"action"`
+	OrgID     string    `json:"org_id"`
+	KeyHash   string    `json:"key_hash"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// keyspaceEventStream batches keyspace changes and posts them to the target
+// URL as a JSON array.
+type keyspaceEventStream struct {
+	conf   config.KeyspaceEventsConfig
+	orgs   map[string]bool
+	events chan keyspaceEvent
+	client *http.Client
+}
+
+// keyspaceEvents is nil unless the keyspace event stream is enabled.
+var keyspaceEvents *keyspaceEventStream
+
+func newKeyspaceEventStream(conf config.KeyspaceEventsConfig) *keyspaceEventStream {
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = keyspaceEventsDefaultBatchSize
+	}
+
+	s := &keyspaceEventStream{
+		conf:   conf,
+		events: make(chan keyspaceEvent, conf.BatchSize*10),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	if len(conf.OrgIDs) > 0 {
+		s.orgs = make(map[string]bool, len(conf.OrgIDs))
+		for _, orgID := range conf.OrgIDs {
+			s.orgs[orgID] = true
+		}
+	}
+	return s
+}
+
+// emitKeyspaceEvent queues a keyspace change for the external systems. The
+// change is dropped if the queue is full, so that admin calls never block on
+// the target.
+func emitKeyspaceEvent(action, orgID, key string, hashed bool) {
+	s := keyspaceEvents
+	if s == nil {
+		return
+	}
+
+	if orgID == "" && !hashed {
+		orgID = storage.TokenOrg(key)
+	}
+	if s.orgs != nil && !s.orgs[orgID] {
+		return
+	}
+
+	keyHash := key
+	if !hashed {
+		keyHash = storage.HashStr(key)
+	}
+
+	select {
+	case s.events <- keyspaceEvent{
+		Action:    action,
+		OrgID:     orgID,
+		KeyHash:   keyHash,
+		Timestamp: time.Now(),
+	}:
+	default:
+		log.WithField("prefix", "keyspace-events").Warning("Event queue is full, dropping keyspace event.")
+	}
+}
+
+// keyspaceEventKey returns the name a custom key is stored under, so that
+// its deletion reports the same hash as its creation.
+func keyspaceEventKey(orgID, keyName string) string {
+	if orgID != "" && storage.TokenOrg(keyName) != orgID {
+		return generateToken(orgID, keyName)
+	}
+	return keyName
+}
+
+// Run sends the queued events once a batch is full or the flush interval has
+// passed, until the context is done.
+func (s *keyspaceEventStream) Run(ctx context.Context) {
+	interval := keyspaceEventsDefaultFlushInterval
+	if s.conf.FlushInterval > 0 {
+		interval = time.Duration(s.conf.FlushInterval) * time.Second
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	batch := make([]keyspaceEvent, 0, s.conf.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		s.send(batch)
+		batch = make([]keyspaceEvent, 0, s.conf.BatchSize)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-s.events:
+					batch = append(batch, e)
+					if len(batch) >= s.conf.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		case e := <-s.events:
+			batch = append(batch, e)
+			if len(batch) >= s.conf.BatchSize {
+				flush()
+			}
+		case <-tick.C:
+			flush()
+		}
+	}
+}
+
+func (s *keyspaceEventStream) send(batch []keyspaceEvent) {
+	logger := log.WithFields(logrus.Fields{
+		"prefix": "keyspace-events",
+		"count":  len(batch),
+	})
+
+	body, err := json.Marshal(batch)
+	if err != nil {
+		logger.WithError(err).Error("Failed to encode keyspace events.")
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.conf.TargetURL, bytes.NewReader(body))
+	if err != nil {
+		logger.WithError(err).Error("Failed to create keyspace events request.")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.conf.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		logger.WithError(err).Error("Failed to send keyspace events.")
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		logger.WithError(fmt.Errorf("unexpected status %d", resp.StatusCode)).Error("Failed to send keyspace events.")
+		return
+	}
+	logger.Debug("Keyspace events sent.")
+}
@@ -0,0 +1,90 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestKeyspaceEvents(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "test"
+		spec.OrgID = "default"
+		spec.UseKeylessAccess = false
+	})
+
+	var received []keyspaceEvent
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Test") != "keyspace" {
+			t.Error("Configured header not sent")
+		}
+		var batch []keyspaceEvent
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Error(err)
+		}
+		received = append(received, batch...)
+	}))
+	defer target.Close()
+
+	keyspaceEvents = newKeyspaceEventStream(config.KeyspaceEventsConfig{
+		Enabled:       true,
+		TargetURL:     target.URL,
+		Headers:       map[string]string{"X-Test": "keyspace"},
+		OrgIDs:        []string{"default"},
+		FlushInterval: 60,
+	})
+	defer func() { keyspaceEvents = nil }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		keyspaceEvents.Run(ctx)
+		close(done)
+	}()
+
+	session := CreateStandardSession()
+	session.AccessRights = map[string]user.AccessDefinition{"test": {
+		APIID: "test", Versions: []string{"v1"},
+	}}
+	otherOrg := CreateStandardSession()
+	otherOrg.OrgID = "other"
+	otherOrg.AccessRights = session.AccessRights
+
+	ts.Run(t, []test.TestCase{
+		{Method: http.MethodPost, Path: "/tyk/keys/keyspace-key", Data: session, AdminAuth: true, Code: http.StatusOK},
+		{Method: http.MethodPut, Path: "/tyk/keys/keyspace-key", Data: session, AdminAuth: true, Code: http.StatusOK},
+		{Method: http.MethodPatch, Path: "/tyk/keys/" + generateToken("default", "keyspace-key") + "/allowed-ips", Data: `{"add": ["127.0.0.1"]}`, AdminAuth: true,
+			Code: http.StatusOK},
+		{Method: http.MethodPost, Path: "/tyk/keys/other-key", Data: otherOrg, AdminAuth: true, Code: http.StatusOK},
+		{Method: http.MethodDelete, Path: "/tyk/keys/keyspace-key?api_id=test", AdminAuth: true, Code: http.StatusOK},
+	}...)
+
+	cancel()
+	<-done
+
+	expected := []string{KeyspaceEventCreated, KeyspaceEventUpdated, KeyspaceEventUpdated, KeyspaceEventDeleted}
+	if len(received) != len(expected) {
+		t.Fatalf("Expected %d events, got %d: %+v", len(expected), len(received), received)
+	}
+	for i, e := range received {
+		if e.Action != expected[i] {
+			t.Errorf("Expected event %d to be %q, got %q", i, expected[i], e.Action)
+		}
+		if e.OrgID != "default" {
+			t.Errorf("Expected org default, got %q", e.OrgID)
+		}
+		if e.KeyHash != storage.HashStr(generateToken("default", "keyspace-key")) {
+			t.Errorf("Expected key to be sent hashed, got %q", e.KeyHash)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mavricknz/ldap"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+const (
+	ldapTLSStartTLS = "starttls"
+	ldapTLSLDAPS    = "ldaps"
+
+	ldapUsernamePlaceholder = "{username}"
+	ldapDefaultGroupAttr    = "memberOf"
+	ldapDefaultMaxConns     = 5
+	ldapDefaultTimeout      = 5 * time.Second
+)
+
+var (
+	errLDAPInvalidCredentials = errors.New("invalid credentials")
+	errLDAPNoPolicy           = errors.New("no policy is mapped to the groups of the user")
+)
+
+// ldapPools are shared by the APIs using the same server, as binding as a
+// user doesn't tie a connection to an API.
+var (
+	ldapPoolsMu sync.Mutex
+	ldapPools   = map[string]*ldapPool{}
+)
+
+// ldapPool keeps idle connections to an LDAP server.
+type ldapPool struct {
+	conf apidef.BasicAuthLDAPMeta
+	idle chan *ldap.LDAPConnection
+}
+
+func getLDAPPool(conf apidef.BasicAuthLDAPMeta) *ldapPool {
+	key := fmt.Sprintf("%s:%d/%s/%v", conf.Server, conf.Port, conf.TLS, conf.InsecureSkipVerify)
+
+	ldapPoolsMu.Lock()
+	defer ldapPoolsMu.Unlock()
+	if pool, ok := ldapPools[key]; ok {
+		return pool
+	}
+
+	maxConns := conf.MaxConnections
+	if maxConns <= 0 {
+		maxConns = ldapDefaultMaxConns
+	}
+	pool := &ldapPool{conf: conf, idle: make(chan *ldap.LDAPConnection, maxConns)}
+	ldapPools[key] = pool
+	return pool
+}
+
+func (p *ldapPool) get() (*ldap.LDAPConnection, error) {
+	select {
+	case conn := <-p.idle:
+		return conn, nil
+	default:
+	}
+
+	port := p.conf.Port
+	if port == 0 {
+		port = 389
+		if p.conf.TLS == ldapTLSLDAPS {
+			port = 636
+		}
+	}
+	tlsConfig := &tls.Config{ServerName: p.conf.Server, InsecureSkipVerify: p.conf.InsecureSkipVerify}
+
+	var conn *ldap.LDAPConnection
+	switch p.conf.TLS {
+	case ldapTLSStartTLS:
+		conn = ldap.NewLDAPTLSConnection(p.conf.Server, port, tlsConfig)
+	case ldapTLSLDAPS:
+		conn = ldap.NewLDAPSSLConnection(p.conf.Server, port, tlsConfig)
+	default:
+		conn = ldap.NewLDAPConnection(p.conf.Server, port)
+	}
+
+	timeout := ldapDefaultTimeout
+	if p.conf.Timeout > 0 {
+		timeout = time.Duration(p.conf.Timeout * float64(time.Second))
+	}
+	conn.NetworkConnectTimeout = timeout
+	conn.ReadTimeout = timeout
+
+	if err := conn.Connect(); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// put returns a connection to the pool, or closes it when the pool is full
+// or the connection is broken.
+func (p *ldapPool) put(conn *ldap.LDAPConnection, broken bool) {
+	if !broken {
+		select {
+		case p.idle <- conn:
+			return
+		default:
+		}
+	}
+	conn.Close()
+}
+
+// ldapEscapeDN escapes the special characters of a DN attribute value.
+func ldapEscapeDN(value string) string {
+	var b strings.Builder
+	for i, c := range value {
+		switch {
+		case strings.ContainsRune(`,\#+<>;"=`, c),
+			c == ' ' && (i == 0 || i == len(value)-1):
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// ldapUser is a user authenticated by the directory.
+type ldapUser struct {
+	// dn is the DN of the user entry, as the directory spells it whatever
+	// the case of the username.
+	dn       string
+	policies []string
+}
+
+// ldapAuthenticate binds to the directory as the user and returns its entry,
+// with the policies mapped to its groups.
+func ldapAuthenticate(conf apidef.BasicAuthLDAPMeta, username, password string) (*ldapUser, error) {
+	// an empty password would be an unauthenticated bind, which succeeds
+	if username == "" || password == "" {
+		return nil, errLDAPInvalidCredentials
+	}
+
+	pool := getLDAPPool(conf)
+	conn, err := pool.get()
+	if err != nil {
+		return nil, err
+	}
+
+	dn, groups, err := ldapUserGroups(conn, conf, username, password)
+	// connections may be broken after other errors
+	pool.put(conn, err != nil && err != errLDAPInvalidCredentials)
+	if err != nil {
+		return nil, err
+	}
+
+	var policies []string
+	for _, group := range groups {
+		for dn, policyID := range conf.GroupPolicies {
+			if strings.EqualFold(dn, group) && !contains(policies, policyID) {
+				policies = append(policies, policyID)
+			}
+		}
+	}
+	if len(policies) == 0 {
+		if conf.DefaultPolicy == "" {
+			return nil, errLDAPNoPolicy
+		}
+		policies = []string{conf.DefaultPolicy}
+	}
+
+	return &ldapUser{dn: dn, policies: policies}, nil
+}
+
+// ldapUserGroups binds as the user and returns the DN and the groups of its
+// entry.
+func ldapUserGroups(conn *ldap.LDAPConnection, conf apidef.BasicAuthLDAPMeta, username, password string) (string, []string, error) {
+	bindDN := strings.Replace(conf.BindDN, ldapUsernamePlaceholder, ldapEscapeDN(username), -1)
+	if err := conn.Bind(bindDN, password); err != nil {
+		if ldapErr, ok := err.(*ldap.LDAPError); ok && ldapErr.ResultCode == ldap.LDAPResultInvalidCredentials {
+			return "", nil, errLDAPInvalidCredentials
+		}
+		return "", nil, err
+	}
+
+	groupAttr := conf.GroupAttribute
+	if groupAttr == "" {
+		groupAttr = ldapDefaultGroupAttr
+	}
+
+	baseDN, scope, filter := bindDN, ldap.ScopeBaseObject, "(objectClass=*)"
+	if conf.UserFilter != "" {
+		baseDN, scope = conf.BaseDN, ldap.ScopeWholeSubtree
+		filter = strings.Replace(conf.UserFilter, ldapUsernamePlaceholder, ldap.EscapeFilterValue(username), -1)
+	}
+	search := ldap.NewSearchRequest(baseDN, scope, ldap.NeverDerefAliases, 1, 0, false,
+		filter, []string{groupAttr}, nil)
+
+	sr, err := conn.Search(search)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(sr.Entries) == 0 {
+		return "", nil, errors.New("user entry not found")
+	}
+	entry := sr.Entries[0]
+	return entry.DN, entry.GetAttributeValues(groupAttr), nil
+}
+
+// ldapBindCacheKey identifies successful binds of an API in the basic auth
+// cache, without keeping the password.
+func ldapBindCacheKey(apiID, username, password string) string {
+	sum := sha256.Sum256([]byte(apiID + "\x00" + username + "\x00" + password))
+	return "ldap-" + hex.EncodeToString(sum[:])
+}
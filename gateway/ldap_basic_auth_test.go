@@ -0,0 +1,32 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+func TestLDAPEscapeDN(t *testing.T) {
+	tests := map[string]string{
+		"alice":          "alice",
+		"doe, john":      `doe\, john`,
+		"a=b+c":          `a\=b\+c`,
+		" padded ":       `\ padded\ `,
+		`quote"back\`:    `quote\"back\\`,
+		"<admin>;#group": `\<admin\>\;\#group`,
+	}
+	for in, want := range tests {
+		if got := ldapEscapeDN(in); got != want {
+			t.Errorf("ldapEscapeDN(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestLDAPAuthenticateEmptyPassword(t *testing.T) {
+	// an unauthenticated bind must never be attempted, so no server is
+	// needed
+	conf := apidef.BasicAuthLDAPMeta{Enabled: true, Server: "127.0.0.1", Port: 1, BindDN: "uid={username},dc=example"}
+	if _, err := ldapAuthenticate(conf, "alice", ""); err != errLDAPInvalidCredentials {
+		t.Errorf("Expected invalid credentials, got %v", err)
+	}
+}
@@ -0,0 +1,312 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+// priorityClass is the priority class of a request when the gateway sheds
+// load. Higher classes are shed later.
+type priorityClass int
+
+const (
+	priorityLow priorityClass = iota
+	priorityNormal
+	priorityHigh
+)
+
+var priorityClassNames = [...]string{"low", "normal", "high"}
+
+func (c priorityClass) String() string {
+	return priorityClassNames[c]
+}
+
+// parsePriorityClass returns the priority class of a name, false if it names
+// none.
+func parsePriorityClass(name string) (priorityClass, bool) {
+	for i, n := range priorityClassNames {
+		if n == name {
+			return priorityClass(i), true
+		}
+	}
+	return priorityNormal, false
+}
+
+// loadState is the load of the node, as told by its load_shedding
+// thresholds.
+type loadState int
+
+const (
+	loadNormal loadState = iota
+	loadElevated
+	loadOverloaded
+)
+
+var loadStateNames = [...]string{"normal", "elevated", "overloaded"}
+
+func (s loadState) String() string {
+	return loadStateNames[s]
+}
+
+// loadLatencyDecay is the time constant of the moving average of request
+// latencies. The average also decays while no request completes, so that
+// the node doesn't stay overloaded once it sheds all its traffic.
+const loadLatencyDecay = 10 * time.Second
+
+// loadSheddingRetryAfter is the Retry-After, in seconds, of shed requests.
+const loadSheddingRetryAfter = "1"
+
+var errLoadShed = errors.New("The gateway is overloaded, please try again later")
+
+// gatewayLoad tracks the load of the node and the requests shed because of
+// it.
+type gatewayLoad struct {
+	// inFlight counts the requests being served, waiting those delayed
+	// until the load drops. Waiting requests don't add to the load.
+	inFlight int64
+	waiting  int64
+
+	mu          sync.Mutex
+	latency     float64
+	lastLatency time.Time
+	shed        [len(priorityClassNames)]uint64
+	delayed     [len(priorityClassNames)]uint64
+}
+
+var currentLoad = &gatewayLoad{}
+
+// observe adds the latency of a completed request to the moving average.
+func (l *gatewayLoad) observe(latency time.Duration, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	alpha := 1.0
+	if !l.lastLatency.IsZero() {
+		alpha = 1 - math.Exp(-float64(now.Sub(l.lastLatency))/float64(loadLatencyDecay))
+	}
+	l.latency += alpha * (DurationToMillisecond(latency) - l.latency)
+	l.lastLatency = now
+}
+
+// averageLatency returns the moving average of request latencies, in
+// milliseconds, decayed since the last request completed.
+func (l *gatewayLoad) averageLatency(now time.Time) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.lastLatency.IsZero() {
+		return 0
+	}
+	return l.latency * math.Exp(-float64(now.Sub(l.lastLatency))/float64(loadLatencyDecay))
+}
+
+// load returns the requests in flight, less the waiting ones, and the
+// average latency.
+func (l *gatewayLoad) load(now time.Time) (int64, float64) {
+	return atomic.LoadInt64(&l.inFlight) - atomic.LoadInt64(&l.waiting), l.averageLatency(now)
+}
+
+// state returns the load state of the node under conf.
+func (l *gatewayLoad) state(conf config.LoadSheddingConfig, now time.Time) loadState {
+	inFlight, latency := l.load(now)
+	exceeds := func(t config.LoadThresholds) bool {
+		return (t.InFlight > 0 && inFlight >= t.InFlight) || (t.Latency > 0 && latency >= t.Latency)
+	}
+	switch {
+	case exceeds(conf.Overloaded):
+		return loadOverloaded
+	case exceeds(conf.Elevated):
+		return loadElevated
+	}
+	return loadNormal
+}
+
+// shedUnder reports whether requests of a priority class are shed in a load
+// state: low ones from elevated, normal ones from overloaded, high ones
+// never.
+func shedUnder(class priorityClass, state loadState) bool {
+	switch state {
+	case loadElevated:
+		return class == priorityLow
+	case loadOverloaded:
+		return class <= priorityNormal
+	}
+	return false
+}
+
+// waitForLoad waits up to delay for the load to drop enough for a request
+// of a priority class not to be shed. It returns false if it didn't.
+func (l *gatewayLoad) waitForLoad(ctx context.Context, conf config.LoadSheddingConfig, class priorityClass, delay time.Duration) bool {
+	atomic.AddInt64(&l.waiting, 1)
+	defer atomic.AddInt64(&l.waiting, -1)
+
+	deadline := time.NewTimer(delay)
+	defer deadline.Stop()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-deadline.C:
+			return false
+		case now := <-ticker.C:
+			if !shedUnder(class, l.state(conf, now)) {
+				return true
+			}
+		}
+	}
+}
+
+// loadHandler counts the requests of an API in the load of the node.
+func loadHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timing := withRequestTiming(r)
+
+		atomic.AddInt64(&currentLoad.inFlight, 1)
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		atomic.AddInt64(&currentLoad.inFlight, -1)
+
+		// shed requests would lower the latency the node sheds on
+		if !timing.Shed {
+			currentLoad.observe(time.Since(start), time.Now())
+		}
+	})
+}
+
+// requestPriority returns the priority class of a request: the highest set
+// by the policies of its key, else the one of its API. The priority header,
+// set by clients, may only lower it.
+func requestPriority(spec *APISpec, r *http.Request) priorityClass {
+	class, _ := parsePriorityClass(spec.Priority)
+	if session := ctxGetSession(r); session != nil {
+		found := false
+		highest := priorityLow
+		policiesMu.RLock()
+		for _, polID := range session.GetPolicyIDs() {
+			if polClass, ok := parsePriorityClass(policiesByID[polID].Priority); ok {
+				found = true
+				if polClass > highest {
+					highest = polClass
+				}
+			}
+		}
+		policiesMu.RUnlock()
+		if found {
+			class = highest
+		}
+	}
+
+	conf := config.Global().LoadShedding
+	if conf.PriorityHeader != "" {
+		if value := r.Header.Get(conf.PriorityHeader); value != "" {
+			if len(conf.PriorityHeaderValues) > 0 {
+				value = conf.PriorityHeaderValues[value]
+			}
+			if headerClass, ok := parsePriorityClass(value); ok && headerClass < class {
+				class = headerClass
+			}
+		}
+	}
+	return class
+}
+
+// LoadSheddingMiddleware sheds the requests of low priority classes while
+// the node is under load.
+type LoadSheddingMiddleware struct {
+	BaseMiddleware
+}
+
+func (m *LoadSheddingMiddleware) Name() string {
+	return "LoadSheddingMiddleware"
+}
+
+func (m *LoadSheddingMiddleware) EnabledForSpec() bool {
+	return config.Global().LoadShedding.Enabled
+}
+
+func (m *LoadSheddingMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	// requests looping back were admitted already
+	if ctxLoopingEnabled(r) {
+		return nil, http.StatusOK
+	}
+
+	conf := config.Global().LoadShedding
+	class := requestPriority(m.Spec, r)
+	state := currentLoad.state(conf, time.Now())
+	if !shedUnder(class, state) {
+		return nil, http.StatusOK
+	}
+
+	if class == priorityLow && state == loadElevated && conf.LowPriorityDelay > 0 {
+		currentLoad.mu.Lock()
+		currentLoad.delayed[class]++
+		currentLoad.mu.Unlock()
+		if currentLoad.waitForLoad(r.Context(), conf, class, time.Duration(conf.LowPriorityDelay)*time.Millisecond) {
+			return nil, http.StatusOK
+		}
+	}
+
+	currentLoad.mu.Lock()
+	currentLoad.shed[class]++
+	currentLoad.mu.Unlock()
+	withRequestTiming(r).Shed = true
+
+	m.Logger().WithField("priority", class.String()).WithField("load", state.String()).Debug("Shedding the request")
+	w.Header().Set(headers.RetryAfter, loadSheddingRetryAfter)
+	return errLoadShed, http.StatusServiceUnavailable
+}
+
+// LoadStatus is the load of the node, and the requests it shed and delayed
+// by priority class since it started. Latency is the moving average of
+// request latencies, in milliseconds.
+// swagger:model
+type LoadStatus struct {
+	Enabled  bool              `json:"enabled"`
+	State    string            `json:"state"`
+	InFlight int64             `json:"in_flight"`
+	Latency  float64           `json:"latency"`
+	Shed     map[string]uint64 `json:"shed"`
+	Delayed  map[string]uint64 `json:"delayed"`
+}
+
+// status reports the load of the node under conf.
+func (l *gatewayLoad) status(conf config.LoadSheddingConfig, now time.Time) LoadStatus {
+	inFlight, latency := l.load(now)
+	status := LoadStatus{
+		Enabled:  conf.Enabled,
+		State:    l.state(conf, now).String(),
+		InFlight: inFlight,
+		Latency:  latency,
+		Shed:     map[string]uint64{},
+		Delayed:  map[string]uint64{},
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, name := range priorityClassNames {
+		status.Shed[name] = l.shed[i]
+		status.Delayed[name] = l.delayed[i]
+	}
+	return status
+}
+
+// Get the load of the node
+// Returns the load state of the node, as told by its load shedding
+// thresholds, and the requests it shed and delayed by priority class.
+//
+//---
+// responses:
+//   200:
+//     description: Load of the node
+//     schema:
+//       "$ref": "#/definitions/LoadStatus"
+func loadStatusHandler(w http.ResponseWriter, r *http.Request) {
+	doJSONWrite(w, http.StatusOK, currentLoad.status(config.Global().LoadShedding, time.Now()))
+}
@@ -0,0 +1,87 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestShedUnder(t *testing.T) {
+	assert.False(t, shedUnder(priorityLow, loadNormal))
+	assert.True(t, shedUnder(priorityLow, loadElevated))
+	assert.False(t, shedUnder(priorityNormal, loadElevated))
+	assert.True(t, shedUnder(priorityNormal, loadOverloaded))
+	assert.False(t, shedUnder(priorityHigh, loadOverloaded))
+}
+
+func TestGatewayLoadState(t *testing.T) {
+	conf := config.LoadSheddingConfig{
+		Elevated:   config.LoadThresholds{InFlight: 10, Latency: 500},
+		Overloaded: config.LoadThresholds{InFlight: 20},
+	}
+	now := time.Now()
+
+	l := &gatewayLoad{}
+	assert.Equal(t, loadNormal, l.state(conf, now))
+
+	l.inFlight = 10
+	assert.Equal(t, loadElevated, l.state(conf, now))
+	l.inFlight = 25
+	assert.Equal(t, loadOverloaded, l.state(conf, now))
+	// waiting requests don't add to the load
+	l.waiting = 20
+	assert.Equal(t, loadNormal, l.state(conf, now))
+
+	l = &gatewayLoad{}
+	l.observe(time.Second, now)
+	assert.InDelta(t, 1000, l.averageLatency(now), 0.001)
+	assert.Equal(t, loadElevated, l.state(conf, now))
+	// the average decays while no request completes
+	assert.Equal(t, loadNormal, l.state(conf, now.Add(10*loadLatencyDecay)))
+}
+
+func TestLoadShedding(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.LoadShedding = config.LoadSheddingConfig{
+		Enabled: true,
+		// the request itself puts the node under elevated load
+		Elevated:             config.LoadThresholds{InFlight: 1},
+		PriorityHeader:       "X-Priority",
+		PriorityHeaderValues: map[string]string{"batch": "low", "gold": "high"},
+	}
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	before := currentLoad.status(globalConf.LoadShedding, time.Now())
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/normal/"
+	}, func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/low/"
+		spec.Priority = "low"
+	})
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/normal/", Code: http.StatusOK},
+		{Path: "/normal/", Headers: map[string]string{"X-Priority": "batch"}, Code: http.StatusServiceUnavailable, HeadersMatch: map[string]string{headers.RetryAfter: "1"}},
+		{Path: "/normal/", Headers: map[string]string{"X-Priority": "unknown"}, Code: http.StatusOK},
+		{Path: "/low/", Code: http.StatusServiceUnavailable},
+		// the header may only lower the priority
+		{Path: "/low/", Headers: map[string]string{"X-Priority": "gold"}, Code: http.StatusServiceUnavailable},
+	}...)
+
+	after := currentLoad.status(globalConf.LoadShedding, time.Now())
+	assert.Equal(t, before.Shed["low"]+3, after.Shed["low"])
+	assert.Equal(t, before.Shed["normal"], after.Shed["normal"])
+
+	_, _ = ts.Run(t, test.TestCase{Path: "/tyk/load", AdminAuth: true, Code: http.StatusOK, BodyMatch: `"enabled":true`})
+}
@@ -41,6 +41,14 @@ func getLogEntryForRequest(logger *logrus.Entry, r *http.Request, key string, da
 			fields["key"] = obfuscateKey(key)
 		}
 	}
+	// add key hash so entries can be correlated without exposing the key
+	if session := ctxGetSession(r); session != nil && !session.KeyHashEmpty() {
+		fields["key_hash"] = session.GetKeyHash()
+	}
+	// add correlation ID when context variables are enabled
+	if id, ok := ctxGetData(r)["request_id"]; ok {
+		fields["request_id"] = id
+	}
 	// add to log additional fields if any passed
 	for key, val := range data {
 		fields[key] = val
@@ -0,0 +1,103 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	apiLoggersMu sync.Mutex
+	apiLoggers   = map[string]*logrus.Logger{}
+)
+
+// apiLogLevel represents the log level currently used by an API
+//
+// swagger:model apiLogLevel
+type apiLogLevel struct {
+	APIID string `json:"api_id"`
+	Level string `json:"level"`
+	// Override is true when the level differs from the global log level
+	Override bool `json:"override"`
+}
+
+// apiLogger returns the logger used by all log sites of an API. It shares the
+// output, formatter and hooks of the global logger, but its level can be
+// changed at runtime without affecting other APIs.
+func apiLogger(apiID string) *logrus.Logger {
+	apiLoggersMu.Lock()
+	defer apiLoggersMu.Unlock()
+
+	if l, ok := apiLoggers[apiID]; ok {
+		return l
+	}
+
+	l := &logrus.Logger{
+		Out:          log.Out,
+		Formatter:    log.Formatter,
+		Hooks:        log.Hooks,
+		Level:        log.GetLevel(),
+		ExitFunc:     log.ExitFunc,
+		ReportCaller: log.ReportCaller,
+	}
+	apiLoggers[apiID] = l
+
+	return l
+}
+
+// pruneAPILoggers drops the loggers of the APIs that are no longer loaded,
+// the loggers of the others keeping their level across reloads.
+func pruneAPILoggers(specs map[string]*APISpec) {
+	apiLoggersMu.Lock()
+	defer apiLoggersMu.Unlock()
+
+	for apiID := range apiLoggers {
+		if _, ok := specs[apiID]; !ok {
+			delete(apiLoggers, apiID)
+		}
+	}
+}
+
+func getAPILogLevel(apiID string) apiLogLevel {
+	level := apiLogger(apiID).GetLevel()
+	return apiLogLevel{
+		APIID:    apiID,
+		Level:    level.String(),
+		Override: level != log.GetLevel(),
+	}
+}
+
+func apiLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	apiID := mux.Vars(r)["apiID"]
+
+	if getApiSpec(apiID) == nil {
+		doJSONWrite(w, http.StatusNotFound, apiError("API not found"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var req apiLogLevel
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+			return
+		}
+
+		level, err := logrus.ParseLevel(req.Level)
+		if err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+			return
+		}
+
+		apiLogger(apiID).SetLevel(level)
+		log.WithField("api_id", apiID).Info("API log level changed to ", level)
+	case http.MethodDelete:
+		apiLogger(apiID).SetLevel(log.GetLevel())
+		log.WithField("api_id", apiID).Info("API log level reset")
+	}
+
+	doJSONWrite(w, http.StatusOK, getAPILogLevel(apiID))
+}
@@ -0,0 +1,57 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestAPILogLevel(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "log-level"
+		spec.Proxy.ListenPath = "/"
+	})
+
+	defer apiLogger("log-level").SetLevel(log.GetLevel())
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/tyk/apis/unknown/log_level", AdminAuth: true, Code: 404},
+		{Method: "PUT", Path: "/tyk/apis/log-level/log_level", AdminAuth: true, Data: `{"level":"verbose"}`, Code: 400},
+		{Method: "PUT", Path: "/tyk/apis/log-level/log_level", AdminAuth: true, Data: `{"level":"trace"}`, Code: 200,
+			BodyMatch: `"level":"trace","override":true`},
+		{Path: "/tyk/apis/log-level/log_level", AdminAuth: true, Code: 200, BodyMatch: `"level":"trace"`},
+	}...)
+
+	if apiLogger("log-level").GetLevel() != logrus.TraceLevel {
+		t.Error("Expected API logger to use overridden level")
+	}
+	if log.GetLevel() == logrus.TraceLevel {
+		t.Error("Global log level should not change")
+	}
+
+	ts.Run(t, test.TestCase{Method: "DELETE", Path: "/tyk/apis/log-level/log_level", AdminAuth: true, Code: 200,
+		BodyMatch: `"override":false`})
+}
+
+func TestPruneAPILoggers(t *testing.T) {
+	apiLogger("prune-kept").SetLevel(logrus.TraceLevel)
+	apiLogger("prune-removed")
+	defer pruneAPILoggers(map[string]*APISpec{})
+
+	pruneAPILoggers(map[string]*APISpec{"prune-kept": {}})
+
+	apiLoggersMu.Lock()
+	_, removed := apiLoggers["prune-removed"]
+	apiLoggersMu.Unlock()
+	if removed {
+		t.Error("Expected the logger of the unloaded API to be dropped")
+	}
+	if apiLogger("prune-kept").GetLevel() != logrus.TraceLevel {
+		t.Error("Expected the logger of a loaded API to keep its level")
+	}
+}
@@ -5,9 +5,14 @@ package gateway
 
 import (
 	"encoding/json"
+	"net/http"
 	"sync"
 	"testing"
+	"time"
 
+	msgpack "gopkg.in/vmihailenco/msgpack.v2"
+
+	"github.com/TykTechnologies/tyk/config"
 	"github.com/TykTechnologies/tyk/test"
 	"github.com/TykTechnologies/tyk/user"
 )
@@ -175,7 +180,7 @@ func TestLooping(t *testing.T) {
 			{Path: "/somesecret", Code: 404},
 			{Path: "/test/by_name", Code: 200, BodyMatch: `"X-Name":"internal"`},
 			{Path: "/test/by_id", Code: 200, BodyMatch: `"X-Name":"internal"`},
-			{Path: "/test/wrong", Code: 500},
+			{Path: "/test/wrong", Code: 500, BodyMatch: "Loop target API not found: wrong"},
 		}...)
 	})
 
@@ -267,6 +272,48 @@ func TestLooping(t *testing.T) {
 	})
 }
 
+func TestLoopTrace(t *testing.T) {
+	ts := StartTest(TestConfig{
+		Delay: 20 * time.Millisecond,
+	})
+	defer ts.Close()
+
+	globalConf := config.Global()
+	globalConf.EnableAnalytics = true
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	// the APIs target each other
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "api-a"
+		spec.Proxy.ListenPath = "/a/"
+		spec.Proxy.TargetURL = "tyk://api-b"
+		spec.LoopLimit = 3
+	}, func(spec *APISpec) {
+		spec.APIID = "api-b"
+		spec.Proxy.ListenPath = "/b/"
+		spec.Proxy.TargetURL = "tyk://api-a"
+	})
+
+	time.Sleep(recordsBufferFlushInterval + 50)
+	analytics.Store.GetAndDeleteSet(analyticsKeyName)
+
+	ts.Run(t, test.TestCase{Path: "/a/", Code: http.StatusInternalServerError,
+		BodyMatch: "Found more than 3 loops in single request: tyk://api-b/a/, tyk://api-a/a/, tyk://api-b/a/"})
+
+	time.Sleep(recordsBufferFlushInterval + 50)
+	results := analytics.Store.GetAndDeleteSet(analyticsKeyName)
+	if len(results) != 1 {
+		t.Fatal("Should return 1 record: ", len(results))
+	}
+
+	var record AnalyticsRecord
+	msgpack.Unmarshal([]byte(results[0].(string)), &record)
+	if len(record.LoopTrace) != 4 || record.LoopTrace[0].APIID != "api-b" || record.LoopTrace[1].APIID != "api-a" {
+		t.Error("Expected the loops to be recorded, got: ", record.LoopTrace)
+	}
+}
+
 func TestConcurrencyReloads(t *testing.T) {
 	var wg sync.WaitGroup
 
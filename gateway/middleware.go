@@ -304,6 +304,25 @@ func (t BaseMiddleware) UpdateRequestSession(r *http.Request) bool {
 	return true
 }
 
+// Reasons for which policies cannot be applied to a session
+const (
+	PolicyErrorNotFound               = "policy_not_found"
+	PolicyErrorOrgMismatch            = "org_mismatch"
+	PolicyErrorIncompatiblePartitions = "incompatible_partitions"
+)
+
+// policyApplyError is returned by ApplyPolicies with the policies that could
+// not be applied and the reason why.
+type policyApplyError struct {
+	PolicyIDs []string
+	Reason    string
+	Message   string
+}
+
+func (e *policyApplyError) Error() string {
+	return e.Message
+}
+
 // ApplyPolicies will check if any policies are loaded. If any are, it
 // will overwrite the session state to use the policy values.
 func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
@@ -314,6 +333,9 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 	}
 
 	didQuota, didRateLimit, didACL, didComplexity := make(map[string]bool), make(map[string]bool), make(map[string]bool), make(map[string]bool)
+	// limitedBy is the first policy setting any of the partitions of an API,
+	// to report which policy a per_api one conflicts with
+	limitedBy := make(map[string]string)
 	policies := session.GetPolicyIDs()
 
 	for _, polID := range policies {
@@ -321,21 +343,33 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 		policy, ok := policiesByID[polID]
 		policiesMu.RUnlock()
 		if !ok {
-			err := fmt.Errorf("policy not found: %q", polID)
+			err := &policyApplyError{
+				PolicyIDs: []string{polID},
+				Reason:    PolicyErrorNotFound,
+				Message:   fmt.Sprintf("policy not found: %q", polID),
+			}
 			t.Logger().Error(err)
 			return err
 		}
 		// Check ownership, policy org owner must be the same as API,
 		// otherwise youcould overwrite a session key with a policy from a different org!
 		if t.Spec != nil && policy.OrgID != t.Spec.OrgID {
-			err := fmt.Errorf("attempting to apply policy from different organisation to key, skipping")
+			err := &policyApplyError{
+				PolicyIDs: []string{polID},
+				Reason:    PolicyErrorOrgMismatch,
+				Message:   "attempting to apply policy from different organisation to key, skipping",
+			}
 			t.Logger().Error(err)
 			return err
 		}
 
 		if policy.Partitions.PerAPI &&
 			(policy.Partitions.Quota || policy.Partitions.RateLimit || policy.Partitions.Acl || policy.Partitions.Complexity) {
-			err := fmt.Errorf("cannot apply policy %s which has per_api and any of partitions set", policy.ID)
+			err := &policyApplyError{
+				PolicyIDs: []string{polID},
+				Reason:    PolicyErrorIncompatiblePartitions,
+				Message:   fmt.Sprintf("cannot apply policy %s which has per_api and any of partitions set", policy.ID),
+			}
 			log.Error(err)
 			return err
 		}
@@ -344,7 +378,11 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 			for apiID, accessRights := range policy.AccessRights {
 				// new logic when you can specify quota or rate in more than one policy but for different APIs
 				if didQuota[apiID] || didRateLimit[apiID] || didACL[apiID] || didComplexity[apiID] { // no other partitions allowed
-					err := fmt.Errorf("cannot apply multiple policies when some have per_api set and some are partitioned")
+					err := &policyApplyError{
+						PolicyIDs: []string{limitedBy[apiID], polID},
+						Reason:    PolicyErrorIncompatiblePartitions,
+						Message:   "cannot apply multiple policies when some have per_api set and some are partitioned",
+					}
 					log.Error(err)
 					return err
 				}
@@ -357,6 +395,9 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 					accessRights.Limit = &user.APILimit{
 						QuotaMax:           policy.QuotaMax,
 						QuotaRenewalRate:   policy.QuotaRenewalRate,
+						QuotaRenewalPeriod: policy.QuotaRenewalPeriod,
+						QuotaTimezone:      policy.QuotaTimezone,
+						QuotaCarryOver:     policy.QuotaCarryOver,
 						Rate:               policy.Rate,
 						Per:                policy.Per,
 						ThrottleInterval:   policy.ThrottleInterval,
@@ -376,6 +417,7 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 				rights[apiID] = accessRights
 
 				// identify that limit for that API is set (to allow set it only once)
+				limitedBy[apiID] = polID
 				didACL[apiID] = true
 				didQuota[apiID] = true
 				didRateLimit[apiID] = true
@@ -391,6 +433,10 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 					v.Limit = &user.APILimit{}
 				}
 
+				if _, ok := limitedBy[k]; !ok {
+					limitedBy[k] = polID
+				}
+
 				if !usePartitions || policy.Partitions.Acl {
 					didACL[k] = true
 
@@ -463,6 +509,15 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 							session.QuotaRenewalRate = policy.QuotaRenewalRate
 						}
 					}
+
+					if policy.QuotaRenewalPeriod != "" {
+						ar.Limit.QuotaRenewalPeriod = policy.QuotaRenewalPeriod
+						ar.Limit.QuotaTimezone = policy.QuotaTimezone
+						ar.Limit.QuotaCarryOver = policy.QuotaCarryOver
+						session.QuotaRenewalPeriod = policy.QuotaRenewalPeriod
+						session.QuotaTimezone = policy.QuotaTimezone
+						session.QuotaCarryOver = policy.QuotaCarryOver
+					}
 				}
 
 				if !usePartitions || policy.Partitions.RateLimit {
@@ -535,6 +590,9 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 				if !usePartitions || policy.Partitions.Quota {
 					session.QuotaMax = policy.QuotaMax
 					session.QuotaRenewalRate = policy.QuotaRenewalRate
+					session.QuotaRenewalPeriod = policy.QuotaRenewalPeriod
+					session.QuotaTimezone = policy.QuotaTimezone
+					session.QuotaCarryOver = policy.QuotaCarryOver
 				}
 			}
 
@@ -595,6 +653,9 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 		if !didQuota[k] {
 			v.Limit.QuotaMax = session.QuotaMax
 			v.Limit.QuotaRenewalRate = session.QuotaRenewalRate
+			v.Limit.QuotaRenewalPeriod = session.QuotaRenewalPeriod
+			v.Limit.QuotaTimezone = session.QuotaTimezone
+			v.Limit.QuotaCarryOver = session.QuotaCarryOver
 			v.Limit.QuotaRenews = session.QuotaRenews
 		}
 
@@ -622,6 +683,9 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 				session.QuotaMax = v.Limit.QuotaMax
 				session.QuotaRenews = v.Limit.QuotaRenews
 				session.QuotaRenewalRate = v.Limit.QuotaRenewalRate
+				session.QuotaRenewalPeriod = v.Limit.QuotaRenewalPeriod
+				session.QuotaTimezone = v.Limit.QuotaTimezone
+				session.QuotaCarryOver = v.Limit.QuotaCarryOver
 			}
 
 			if len(didComplexity) == 1 {
@@ -686,6 +750,9 @@ func (t BaseMiddleware) CheckSessionAndIdentityForValidKey(originalKey *string,
 		if !t.Spec.GlobalConfig.LocalSessionCache.DisableCacheSessionState {
 			go SessionCache.Set(cacheKey, &clone, cache.DefaultExpiration)
 		}
+		if conf := t.Spec.GlobalConfig.SessionFallback; conf.Enabled {
+			sessionFallback.set(cacheKey, &clone, conf)
+		}
 
 		// Check for a policy, if there is a policy, pull it and overwrite the session values
 		if err := t.ApplyPolicies(&session); err != nil {
@@ -696,6 +763,18 @@ func (t BaseMiddleware) CheckSessionAndIdentityForValidKey(originalKey *string,
 		return session.Clone(), true
 	}
 
+	// Redis is unavailable, authorize the keys validated recently
+	if t.Spec.GlobalConfig.SessionFallback.Enabled && sessionFallbackActive() {
+		if session, found := sessionFallback.get(cacheKey); found {
+			t.Logger().Debug("--> Key found in session fallback")
+			if err := t.ApplyPolicies(&session); err != nil {
+				t.Logger().Error(err)
+				return session.Clone(), false
+			}
+			return session.Clone(), true
+		}
+	}
+
 	if _, ok := t.Spec.AuthManager.Store().(*RPCStorageHandler); ok && rpc.IsEmergencyMode() {
 		return session.Clone(), false
 	}
@@ -717,6 +796,9 @@ func (t BaseMiddleware) CheckSessionAndIdentityForValidKey(originalKey *string,
 		if !t.Spec.GlobalConfig.LocalSessionCache.DisableCacheSessionState {
 			go SessionCache.Set(cacheKey, &clone, cache.DefaultExpiration)
 		}
+		if conf := t.Spec.GlobalConfig.SessionFallback; conf.Enabled {
+			sessionFallback.set(cacheKey, &clone, conf)
+		}
 
 		// Check for a policy, if there is a policy, pull it and overwrite the session values
 		if err := t.ApplyPolicies(&session); err != nil {
@@ -821,19 +903,36 @@ func responseProcessorByName(name string) TykResponseHandler {
 
 func handleResponseChain(chain []TykResponseHandler, rw http.ResponseWriter, res *http.Response, req *http.Request, ses *user.SessionState) (abortRequest bool, err error) {
 	traceIsEnabled := trace.IsEnabled()
-	for _, rh := range chain {
+	for i, rh := range chain {
 		if err := handleResponse(rh, rw, res, req, ses, traceIsEnabled); err != nil {
 			// Abort the request if this handler is a response middleware hook:
 			if rh.Name() == "CustomMiddlewareResponseHook" {
 				rh.HandleError(rw, req)
 				return true, err
 			}
+			// the response is still written, so the mandatory handlers
+			// after the failed one must run
+			for _, next := range chain[i+1:] {
+				if _, ok := next.(mandatoryResponseHandler); ok {
+					if err := handleResponse(next, rw, res, req, ses, traceIsEnabled); err != nil {
+						log.WithError(err).Error(next.Name() + " failed")
+					}
+				}
+			}
 			return false, err
 		}
 	}
 	return false, nil
 }
 
+// mandatoryResponseHandler is a response handler that runs even when a
+// handler before it fails, such as the encryption of responses which must
+// not reach consumers in plaintext.
+type mandatoryResponseHandler interface {
+	TykResponseHandler
+	mandatory()
+}
+
 func handleResponse(rh TykResponseHandler, rw http.ResponseWriter, res *http.Response, req *http.Request, ses *user.SessionState, shouldTrace bool) error {
 	if shouldTrace {
 		span, ctx := trace.Span(req.Context(), rh.Name())
@@ -0,0 +1,126 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/condition"
+)
+
+// Attributes of the conditions of middleware entries. Those with a key, such
+// as header.X-Beta, read the key of their source.
+const (
+	conditionMethod = "method"
+	conditionPath   = "path"
+	conditionHost   = "host"
+	conditionHeader = "header"
+	conditionQuery  = "query"
+	conditionParam  = "param"
+	conditionClaim  = "claim"
+	conditionMeta   = "meta"
+	conditionCtx    = "ctx"
+)
+
+// conditionSource splits an attribute of a condition into its source and
+// key.
+func conditionSource(name string) (string, string) {
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return name, ""
+}
+
+// compileCondition parses the condition of a middleware entry, nil if it has
+// none.
+func compileCondition(expr string) (*condition.Condition, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	c, err := condition.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range c.References() {
+		source, key := conditionSource(name)
+		switch source {
+		case conditionMethod, conditionPath, conditionHost:
+			if key == "" {
+				continue
+			}
+		case conditionHeader, conditionQuery, conditionParam, conditionClaim, conditionMeta, conditionCtx:
+			if key != "" {
+				continue
+			}
+		}
+		return nil, fmt.Errorf("condition %q: unknown attribute %q", expr, name)
+	}
+	return c, nil
+}
+
+// validateConditions checks the conditions of the middleware entries of an
+// API, which isn't loaded if any is invalid rather than run its entries
+// unconditionally or not at all.
+func validateConditions(def *apidef.APIDefinition) error {
+	for name, version := range def.VersionData.Versions {
+		paths := version.ExtendedPaths
+		var conditions []string
+		for _, meta := range append(paths.Transform, paths.TransformResponse...) {
+			conditions = append(conditions, meta.Condition)
+		}
+		for _, meta := range append(paths.TransformHeader, paths.TransformResponseHeader...) {
+			conditions = append(conditions, meta.Condition)
+		}
+		for _, meta := range paths.ValidateJSON {
+			conditions = append(conditions, meta.Condition)
+		}
+		for _, expr := range conditions {
+			if _, err := compileCondition(expr); err != nil {
+				return fmt.Errorf("version %q: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// conditionAttributes resolves the attributes of the conditions of
+// middleware entries for a request.
+func conditionAttributes(r *http.Request, spec *APISpec) condition.Attributes {
+	return func(name string) string {
+		source, key := conditionSource(name)
+		switch source {
+		case conditionMethod:
+			return r.Method
+		case conditionPath:
+			return spec.StripListenPath(r, r.URL.Path)
+		case conditionHost:
+			return r.Host
+		case conditionHeader:
+			return requestAttribute(r, spec, attributeHeader, key, 0)
+		case conditionQuery:
+			return requestAttribute(r, spec, attributeQueryParam, key, 0)
+		case conditionParam:
+			return requestAttribute(r, spec, attributePathParam, key, 0)
+		case conditionClaim:
+			return requestAttribute(r, spec, attributeJWTClaim, key, 0)
+		case conditionMeta:
+			if session := ctxGetSession(r); session != nil {
+				if val, ok := session.MetaData[key]; ok {
+					return valToStr(val)
+				}
+			}
+		case conditionCtx:
+			if val, ok := ctxGetData(r)[key]; ok {
+				return valToStr(val)
+			}
+		}
+		return ""
+	}
+}
+
+// conditionHolds reports whether the middleware entry of u runs for a
+// request, always if it has no condition.
+func (u *URLSpec) conditionHolds(r *http.Request, spec *APISpec) bool {
+	return u.Condition == nil || u.Condition.Eval(conditionAttributes(r, spec))
+}
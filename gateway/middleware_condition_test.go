@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestCompileCondition(t *testing.T) {
+	c, err := compileCondition("  ")
+	assert.NoError(t, err)
+	assert.Nil(t, c)
+
+	for _, expr := range []string{
+		`method == "GET" && path =~ "^/users" && host`,
+		`header.X-Beta && query.debug && param.id && claim.sub && meta.tier && ctx.tenant`,
+	} {
+		_, err := compileCondition(expr)
+		assert.NoError(t, err, expr)
+	}
+
+	for _, expr := range []string{
+		`header == "x"`,
+		`method.name == "GET"`,
+		`cookie.session`,
+		`header.X-Beta ==`,
+	} {
+		_, err := compileCondition(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestValidateConditions(t *testing.T) {
+	def := &apidef.APIDefinition{}
+	def.VersionData.Versions = map[string]apidef.VersionInfo{
+		"v1": {ExtendedPaths: apidef.ExtendedPathsSet{
+			TransformHeader: []apidef.HeaderInjectionMeta{{Path: "/a", Condition: `header.X-Beta`}},
+		}},
+	}
+	assert.NoError(t, validateConditions(def))
+
+	v1 := def.VersionData.Versions["v1"]
+	v1.ExtendedPaths.ValidateJSON = []apidef.ValidatePathMeta{{Path: "/b", Condition: `cookie.session`}}
+	def.VersionData.Versions["v1"] = v1
+	assert.Error(t, validateConditions(def))
+}
+
+func TestConditionalMiddleware(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.UseExtendedPaths = true
+			v.ExtendedPaths.TransformHeader = []apidef.HeaderInjectionMeta{
+				{
+					Path:       "/beta",
+					Method:     http.MethodGet,
+					AddHeaders: map[string]string{"X-Variant": "beta"},
+					Condition:  `header.X-Beta == "true"`,
+				},
+				{
+					Path:       "/beta",
+					Method:     http.MethodGet,
+					AddHeaders: map[string]string{"X-Variant": "stable"},
+				},
+			}
+			v.ExtendedPaths.ValidateJSON = []apidef.ValidatePathMeta{
+				{
+					Path:   "/strict",
+					Method: http.MethodPost,
+					Schema: map[string]interface{}{
+						"type":     "object",
+						"required": []interface{}{"name"},
+					},
+					Condition: `query.strict == "1"`,
+				},
+			}
+		})
+	})
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/beta", Headers: map[string]string{"X-Beta": "true"}, Code: http.StatusOK, BodyMatch: `"X-Variant":"beta"`},
+		{Path: "/beta", Code: http.StatusOK, BodyMatch: `"X-Variant":"stable"`},
+		{Method: http.MethodPost, Path: "/strict?strict=1", Data: `{}`, Code: http.StatusUnprocessableEntity},
+		{Method: http.MethodPost, Path: "/strict", Data: `{}`, Code: http.StatusOK},
+	}...)
+}
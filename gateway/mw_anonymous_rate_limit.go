@@ -0,0 +1,124 @@
+package gateway
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// AnonymousRateLimit rate limits the clients of keyless APIs by IP, as they
+// have no key to count requests with.
+type AnonymousRateLimit struct {
+	BaseMiddleware
+	trustedProxies ipNets
+	lastUpdated    string
+}
+
+func (k *AnonymousRateLimit) Name() string {
+	return "AnonymousRateLimit"
+}
+
+func (k *AnonymousRateLimit) EnabledForSpec() bool {
+	conf := k.Spec.AnonymousRateLimit
+	if !k.Spec.UseKeylessAccess || k.Spec.DisableRateLimit || !conf.Enabled || conf.Rate <= 0 || conf.Per <= 0 {
+		return false
+	}
+
+	k.trustedProxies = nil
+	for _, proxy := range conf.TrustedProxies {
+		ipNet, err := parseIPNet(proxy)
+		if err != nil {
+			k.Logger().WithError(err).Error("Invalid trusted proxy of the anonymous rate limit")
+			continue
+		}
+		k.trustedProxies = append(k.trustedProxies, ipNet)
+	}
+
+	// Set last updated on each load to ensure we always use a new rate limit bucket
+	k.lastUpdated = strconv.Itoa(int(time.Now().UnixNano()))
+
+	return true
+}
+
+// clientIP returns the IP of the client of a request, as forwarded by the
+// trusted proxies.
+func (k *AnonymousRateLimit) clientIP(r *http.Request) net.IP {
+	return forwardedClientIP(r, k.trustedProxies)
+}
+
+// clientNetwork returns the network of a client IP its requests are counted
+// with.
+func clientNetwork(ip net.IP, ipv4PrefixLength, ipv6PrefixLength int) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		if ipv4PrefixLength <= 0 || ipv4PrefixLength > 32 {
+			ipv4PrefixLength = 32
+		}
+		mask := net.CIDRMask(ipv4PrefixLength, 32)
+		return (&net.IPNet{IP: ip4.Mask(mask), Mask: mask}).String()
+	}
+	if ipv6PrefixLength <= 0 || ipv6PrefixLength > 128 {
+		ipv6PrefixLength = 64
+	}
+	mask := net.CIDRMask(ipv6PrefixLength, 128)
+	return (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String()
+}
+
+func (k *AnonymousRateLimit) handleRateLimitFailure(r *http.Request, client string) (error, int) {
+	k.Logger().WithField("client", client).Info("Anonymous rate limit exceeded.")
+
+	// Fire a rate limit exceeded event
+	k.FireEvent(EventRateLimitExceeded, EventKeyFailureMeta{
+		EventMetaDefault: EventMetaDefault{Message: "Anonymous Rate Limit Exceeded", OriginatingRequest: EncodeRequestToEvent(r)},
+		Path:             r.URL.Path,
+		Origin:           client,
+	})
+
+	// Report in health check
+	reportHealthValue(k.Spec, Throttle, "-1")
+
+	return errors.New("Rate limit exceeded"), http.StatusTooManyRequests
+}
+
+// ProcessRequest will run any checks on the request on the way through the system, return an error to have the chain fail
+func (k *AnonymousRateLimit) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	// Skip rate limiting and quotas for looping
+	if !ctxCheckLimits(r) {
+		return nil, http.StatusOK
+	}
+
+	ip := k.clientIP(r)
+	if ip == nil {
+		return nil, http.StatusOK
+	}
+	conf := k.Spec.AnonymousRateLimit
+	client := clientNetwork(ip, conf.IPv4PrefixLength, conf.IPv6PrefixLength)
+
+	keyName := "anonlimiter-" + k.Spec.OrgID + k.Spec.APIID + "-" + client
+	session := &user.SessionState{
+		Rate:        conf.Rate,
+		Per:         conf.Per,
+		LastUpdated: k.lastUpdated,
+	}
+	session.SetKeyHash(storage.HashKey(keyName))
+
+	reason := sessionLimiter.ForwardMessage(r, session,
+		keyName,
+		GlobalSessionManager.Store(),
+		true,
+		false,
+		&k.Spec.GlobalConfig,
+		k.Spec,
+		false,
+	)
+
+	if reason == sessionFailRateLimit {
+		return k.handleRateLimitFailure(r, client)
+	}
+
+	return nil, http.StatusOK
+}
@@ -0,0 +1,92 @@
+package gateway
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestAnonymousRateLimit(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	DRLManager.SetCurrentTokenValue(1)
+	DRLManager.RequestTokenValue = 1
+	defer func() {
+		DRLManager.SetCurrentTokenValue(0)
+		DRLManager.RequestTokenValue = 0
+	}()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.UseKeylessAccess = true
+		spec.AnonymousRateLimit = apidef.AnonymousRateLimitMeta{
+			Enabled:          true,
+			Rate:             1,
+			Per:              60,
+			TrustedProxies:   []string{"127.0.0.1"},
+			IPv4PrefixLength: 24,
+		}
+	})
+
+	from := func(ip string) map[string]string {
+		return map[string]string{headers.XForwardFor: ip}
+	}
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Headers: from("203.0.113.1"), Code: http.StatusOK},
+		{Headers: from("203.0.113.1"), Code: http.StatusTooManyRequests},
+		// same /24
+		{Headers: from("203.0.113.2"), Code: http.StatusTooManyRequests},
+		{Headers: from("198.51.100.1"), Code: http.StatusOK},
+		// spoofed hops before the client are ignored
+		{Headers: from("192.0.2.1, 198.51.100.1"), Code: http.StatusTooManyRequests},
+	}...)
+}
+
+func TestAnonymousRateLimitClientIP(t *testing.T) {
+	k := &AnonymousRateLimit{BaseMiddleware: BaseMiddleware{Spec: &APISpec{APIDefinition: &apidef.APIDefinition{
+		UseKeylessAccess: true,
+		AnonymousRateLimit: apidef.AnonymousRateLimitMeta{
+			Enabled:        true,
+			Rate:           1,
+			Per:            1,
+			TrustedProxies: []string{"10.0.0.0/8", "192.168.1.1"},
+		},
+	}}}}
+	assert.True(t, k.EnabledForSpec())
+
+	tests := []struct {
+		remoteAddr string
+		forwarded  string
+		expected   string
+	}{
+		{"203.0.113.1:1234", "198.51.100.1", "203.0.113.1"},
+		{"10.1.1.1:1234", "198.51.100.1", "198.51.100.1"},
+		{"10.1.1.1:1234", "198.51.100.1, 192.168.1.1, 10.2.2.2", "198.51.100.1"},
+		{"10.1.1.1:1234", "", "10.1.1.1"},
+		{"10.1.1.1:1234", "garbage, 198.51.100.1", "198.51.100.1"},
+	}
+	for _, tc := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tc.remoteAddr
+		if tc.forwarded != "" {
+			r.Header.Set(headers.XForwardFor, tc.forwarded)
+		}
+		assert.Equal(t, tc.expected, k.clientIP(r).String(), tc.forwarded)
+	}
+}
+
+func TestClientNetwork(t *testing.T) {
+	assert.Equal(t, "203.0.113.7/32", clientNetwork(net.ParseIP("203.0.113.7"), 0, 0))
+	assert.Equal(t, "203.0.113.0/24", clientNetwork(net.ParseIP("203.0.113.7"), 24, 0))
+	assert.Equal(t, "2001:db8:1:2::/64", clientNetwork(net.ParseIP("2001:db8:1:2:3:4:5:6"), 0, 0))
+	assert.Equal(t, "2001:db8::/32", clientNetwork(net.ParseIP("2001:db8:1:2:3:4:5:6"), 0, 32))
+}
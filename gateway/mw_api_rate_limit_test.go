@@ -11,6 +11,7 @@ import (
 	uuid "github.com/satori/go.uuid"
 
 	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
 	"github.com/TykTechnologies/tyk/test"
 	"github.com/TykTechnologies/tyk/user"
 )
@@ -184,10 +185,13 @@ func requestThrottlingTest(limiter string, testLevel string) func(t *testing.T)
 				}
 
 				if requestThrottlingEnabled && throttleInterval > 0 {
-					ts.Run(t, []test.TestCase{
+					resp, _ := ts.Run(t, []test.TestCase{
 						{Path: "/", Headers: authHeaders, Code: 200, Delay: 100 * time.Millisecond},
 						{Path: "/", Headers: authHeaders, Code: 200},
 					}...)
+					if resp != nil && resp.Header.Get(headers.XThrottledRetries) == "" {
+						t.Error("Expected the throttled request to report its retries")
+					}
 				} else {
 					ts.Run(t, []test.TestCase{
 						{Path: "/", Headers: authHeaders, Code: 200, Delay: 100 * time.Millisecond},
@@ -2,8 +2,10 @@ package gateway
 
 import (
 	"bytes"
+	"crypto/md5"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -177,6 +179,10 @@ func (k *BasicAuthKeyIsValid) ProcessRequest(w http.ResponseWriter, r *http.Requ
 		}
 	}
 
+	if k.Spec.BasicAuth.LDAP.Enabled {
+		return k.processLDAP(w, r, username, password, token)
+	}
+
 	// Check if API key valid
 	keyName := username
 	logger := k.Logger().WithField("key", obfuscateKey(keyName))
@@ -219,6 +225,75 @@ func (k *BasicAuthKeyIsValid) ProcessRequest(w http.ResponseWriter, r *http.Requ
 	return nil, http.StatusOK
 }
 
+// processLDAP authenticates the user against the directory of the API. Its
+// session is virtual, like the sessions of centralised JWTs, and follows the
+// groups of the user.
+func (k *BasicAuthKeyIsValid) processLDAP(w http.ResponseWriter, r *http.Request, username, password, token string) (error, int) {
+	logger := k.Logger().WithField("user", username)
+
+	var entry *ldapUser
+	cacheKey := ldapBindCacheKey(k.Spec.APIID, username, password)
+	if cached, found := basicAuthCache.Get(cacheKey); found && !k.Spec.BasicAuth.DisableCaching {
+		entry = cached.(*ldapUser)
+	} else {
+		var err error
+		entry, err = ldapAuthenticate(k.Spec.BasicAuth.LDAP, username, password)
+		switch err {
+		case nil:
+		case errLDAPInvalidCredentials:
+			logger.Warn("Attempted access with invalid directory credentials.")
+			return k.handleAuthFail(w, r, token)
+		case errLDAPNoPolicy:
+			logger.Warn("Attempted access by a user in no mapped group.")
+			AuthFailed(k, r, token)
+			return errors.New("Access to this API has been disallowed"), http.StatusForbidden
+		default:
+			logger.WithError(err).Error("Couldn't authenticate user against the directory")
+			return errors.New("There was a problem proxying the request"), http.StatusServiceUnavailable
+		}
+
+		if !k.Spec.BasicAuth.DisableCaching {
+			cacheTTL := defaultBasicAuthTTL
+			if k.Spec.BasicAuth.CacheTTL > 0 {
+				cacheTTL = time.Duration(k.Spec.BasicAuth.CacheTTL) * time.Second
+			}
+			basicAuthCache.Set(cacheKey, entry, cacheTTL)
+		}
+	}
+	policies := entry.policies
+
+	// directory logins aren't case sensitive, the key of a user is derived
+	// from its entry
+	keyName := generateToken(k.Spec.OrgID, fmt.Sprintf("%x", md5.Sum([]byte("ldap:"+strings.ToLower(entry.dn)))))
+	session, exists := k.CheckSessionAndIdentityForValidKey(&keyName, r)
+	updateSession := false
+	if !exists {
+		var err error
+		session, err = generateSessionFromPolicy(policies[0], k.Spec.OrgID, true)
+		if err != nil {
+			logger.WithError(err).Error("Could not find a valid policy to apply to this user")
+			return errors.New("Key not authorized: no matching policy"), http.StatusForbidden
+		}
+		session.Alias = username
+		updateSession = true
+	}
+	if !exists || !session.PoliciesEqualTo(policies) {
+		session.SetPolicies(policies...)
+		if err := k.ApplyPolicies(&session); err != nil {
+			logger.WithError(err).Error("Could not apply the policies of the user groups")
+			return errors.New("Key not authorized: could not apply policies"), http.StatusForbidden
+		}
+		updateSession = true
+	}
+
+	switch k.Spec.BaseIdentityProvidedBy {
+	case apidef.BasicAuthUser, apidef.UnsetAuth:
+		ctxSetSession(r, &session, keyName, updateSession)
+	}
+
+	return nil, http.StatusOK
+}
+
 func (k *BasicAuthKeyIsValid) handleAuthFail(w http.ResponseWriter, r *http.Request, token string) (error, int) {
 
 	// Fire Authfailed Event
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/gorilla/mux"
 	uuid "github.com/satori/go.uuid"
 
 	"github.com/TykTechnologies/tyk/request"
@@ -41,6 +42,14 @@ func (m *MiddlewareContextVars) ProcessRequest(w http.ResponseWriter, r *http.Re
 		contextDataObject[n] = vals[0]
 	}
 
+	// parameters of the listen path, such as tenantID in /tenants/{tenantID}/api
+	if pathParams := mux.Vars(r); len(pathParams) > 0 {
+		contextDataObject["path_params"] = pathParams
+		for name, val := range pathParams {
+			contextDataObject["path_params_"+name] = val
+		}
+	}
+
 	for _, c := range r.Cookies() {
 		name := "cookies_" + strings.Replace(c.Name, "-", "_", -1)
 		contextDataObject[name] = c.Value
@@ -240,3 +240,34 @@ func BenchmarkContextVarsMiddlewareProcessRequest(b *testing.B) {
 		})
 	}
 }
+
+func TestContextVarsListenPathParams(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	spec := BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/tenants/{tenantID}/api/*/"
+		spec.Proxy.StripListenPath = true
+		spec.EnableContextVars = true
+		spec.VersionData.Versions = map[string]apidef.VersionInfo{
+			"v1": {
+				UseExtendedPaths: true,
+				GlobalHeaders: map[string]string{
+					"X-Tenant":   "$tyk_context.path_params_tenantID",
+					"X-Wildcard": "$tyk_context.path_params_wildcard1",
+				},
+			},
+		}
+	})[0]
+
+	// the definition keeps the listen path as written
+	if got := spec.storedDefinition().Proxy.ListenPath; got != "/tenants/{tenantID}/api/*/" {
+		t.Errorf("Expected the listen path of the definition to be left as is, got %q", got)
+	}
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/tenants/acme/api/v2/orders", Code: 200, BodyMatch: `"X-Tenant":"acme"`},
+		{Path: "/tenants/acme/api/v2/orders", Code: 200, BodyMatch: `"X-Wildcard":"v2"`},
+		{Path: "/tenants/acme/api/v2/orders", Code: 200, BodyMatch: `"Url":"/orders"`},
+	}...)
+}
@@ -0,0 +1,330 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	cache "github.com/pmylund/go-cache"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/TykTechnologies/tyk/certs"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/request"
+)
+
+const (
+	extAuthzProtocolGRPC      = "grpc"
+	extAuthzDefaultGRPCMethod = "/tyk.ExternalAuthz/Check"
+	extAuthzDefaultTimeout    = 2 * time.Second
+)
+
+var (
+	errExtAuthzDenied      = errors.New("Access to this resource has been disallowed")
+	errExtAuthzUnavailable = errors.New("Authorization service unavailable")
+)
+
+// extAuthzConns are shared by the APIs using the same gRPC service and
+// transport security, so that reloads don't open new connections.
+var (
+	extAuthzConnsMu sync.Mutex
+	extAuthzConns   = map[string]*grpc.ClientConn{}
+)
+
+// extAuthzCheck is the metadata of a request sent to the authorization
+// service.
+type extAuthzCheck struct {
+	APIID      string                 `json:"api_id"`
+	OrgID      string                 `json:"org_id"`
+	Method     string                 `json:"method"`
+	Host       string                 `json:"host"`
+	Path       string                 `json:"path"`
+	Query      string                 `json:"query,omitempty"`
+	Headers    map[string]string      `json:"headers"`
+	RemoteAddr string                 `json:"remote_addr"`
+	KeyAlias   string                 `json:"key_alias,omitempty"`
+	Policies   []string               `json:"policies,omitempty"`
+	MetaData   map[string]interface{} `json:"meta_data,omitempty"`
+	Body       string                 `json:"body,omitempty"`
+}
+
+// extAuthzDecision is the decision of the authorization service.
+type extAuthzDecision struct {
+	Allowed    bool              `json:"allowed"`
+	StatusCode int               `json:"status_code"`
+	Message    string            `json:"message"`
+	Headers    map[string]string `json:"headers"`
+}
+
+// ExternalAuthzMiddleware lets an external authorization service allow or
+// deny requests. Decisions may be cached, and requests are allowed or denied
+// as configured when the service fails.
+type ExternalAuthzMiddleware struct {
+	BaseMiddleware
+	client    *http.Client
+	conn      *grpc.ClientConn
+	decisions *cache.Cache
+}
+
+func (m *ExternalAuthzMiddleware) Name() string {
+	return "ExternalAuthzMiddleware"
+}
+
+func (m *ExternalAuthzMiddleware) EnabledForSpec() bool {
+	return m.Spec.ExternalAuthz.Enabled
+}
+
+func (m *ExternalAuthzMiddleware) Init() {
+	conf := m.Spec.ExternalAuthz
+	if conf.CacheTTL > 0 {
+		m.decisions = cache.New(time.Duration(conf.CacheTTL)*time.Second, time.Minute)
+	}
+
+	tlsConfig := &tls.Config{}
+	if conf.Certificate != "" {
+		cert := CertificateManager.List([]string{conf.Certificate}, certs.CertificatePrivate)[0]
+		if cert == nil {
+			m.Logger().Error("Client certificate of the authorization service not found: ", conf.Certificate)
+		} else {
+			tlsConfig.Certificates = []tls.Certificate{*cert}
+		}
+	}
+
+	if conf.Protocol != extAuthzProtocolGRPC {
+		m.client = &http.Client{
+			Timeout:   m.timeout(),
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+		}
+		return
+	}
+
+	transport := grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))
+	connKey := conf.URL + "|tls|" + conf.Certificate
+	if conf.GRPCInsecure {
+		transport = grpc.WithInsecure()
+		connKey = conf.URL + "|insecure"
+	}
+
+	extAuthzConnsMu.Lock()
+	defer extAuthzConnsMu.Unlock()
+	if conn, ok := extAuthzConns[connKey]; ok {
+		m.conn = conn
+		return
+	}
+	conn, err := grpc.Dial(conf.URL, transport)
+	if err != nil {
+		m.Logger().WithError(err).Error("Couldn't connect to the authorization service")
+		return
+	}
+	extAuthzConns[connKey] = conn
+	m.conn = conn
+}
+
+func (m *ExternalAuthzMiddleware) timeout() time.Duration {
+	if timeout := m.Spec.ExternalAuthz.Timeout; timeout > 0 {
+		return time.Duration(timeout * float64(time.Second))
+	}
+	return extAuthzDefaultTimeout
+}
+
+func (m *ExternalAuthzMiddleware) checkRequest(r *http.Request) (*extAuthzCheck, error) {
+	check := &extAuthzCheck{
+		APIID:      m.Spec.APIID,
+		OrgID:      m.Spec.OrgID,
+		Method:     r.Method,
+		Host:       r.Host,
+		Path:       r.URL.Path,
+		Query:      r.URL.RawQuery,
+		Headers:    make(map[string]string, len(r.Header)),
+		RemoteAddr: request.RealIP(r),
+	}
+	for name, values := range r.Header {
+		check.Headers[name] = strings.Join(values, ",")
+	}
+	if session := ctxGetSession(r); session != nil {
+		check.KeyAlias = session.Alias
+		check.Policies = session.GetPolicyIDs()
+		check.MetaData = session.GetMetaData()
+	}
+	if m.Spec.ExternalAuthz.IncludeBody {
+		body, err := readBody(r)
+		if err != nil {
+			return nil, err
+		}
+		check.Body = string(body)
+	}
+	return check, nil
+}
+
+func (m *ExternalAuthzMiddleware) checkHTTP(ctx context.Context, payload []byte) (*extAuthzDecision, error) {
+	req, err := http.NewRequest(http.MethodPost, m.Spec.ExternalAuthz.URL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range m.Spec.ExternalAuthz.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set(headers.ContentType, headers.ApplicationJSON)
+
+	resp, err := m.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	decision := &extAuthzDecision{}
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		decision.Allowed = true
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		decision.StatusCode = resp.StatusCode
+	default:
+		return nil, fmt.Errorf("authorization service returned %d", resp.StatusCode)
+	}
+
+	var body extAuthzDecision
+	if err := json.NewDecoder(resp.Body).Decode(&body); err == nil {
+		decision.Message = body.Message
+		decision.Headers = body.Headers
+	}
+	return decision, nil
+}
+
+func (m *ExternalAuthzMiddleware) checkGRPC(ctx context.Context, payload []byte) (*extAuthzDecision, error) {
+	if m.conn == nil {
+		return nil, errors.New("no connection to the authorization service")
+	}
+
+	in := &structpb.Struct{}
+	if err := jsonpb.Unmarshal(bytes.NewReader(payload), in); err != nil {
+		return nil, err
+	}
+	method := m.Spec.ExternalAuthz.GRPCMethod
+	if method == "" {
+		method = extAuthzDefaultGRPCMethod
+	}
+	for name, value := range m.Spec.ExternalAuthz.Headers {
+		ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(name), value)
+	}
+	out := &structpb.Struct{}
+	if err := m.conn.Invoke(ctx, method, in, out); err != nil {
+		return nil, err
+	}
+
+	outJSON, err := (&jsonpb.Marshaler{}).MarshalToString(out)
+	if err != nil {
+		return nil, err
+	}
+	decision := &extAuthzDecision{}
+	if err := json.Unmarshal([]byte(outJSON), decision); err != nil {
+		return nil, err
+	}
+	return decision, nil
+}
+
+// cacheKey returns the key of the decision for a request in the cache,
+// which only depends on the configured headers when there are some.
+func (m *ExternalAuthzMiddleware) cacheKey(check *extAuthzCheck) (string, error) {
+	cacheHeaders := m.Spec.ExternalAuthz.CacheHeaders
+	if len(cacheHeaders) > 0 {
+		keyed := *check
+		keyed.Headers = make(map[string]string, len(cacheHeaders))
+		for _, name := range cacheHeaders {
+			name = http.CanonicalHeaderKey(name)
+			if value, ok := check.Headers[name]; ok {
+				keyed.Headers[name] = value
+			}
+		}
+		check = &keyed
+	}
+
+	raw, err := json.Marshal(check)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (m *ExternalAuthzMiddleware) decide(r *http.Request) (*extAuthzDecision, error) {
+	check, err := m.checkRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(check)
+	if err != nil {
+		return nil, err
+	}
+
+	var cacheKey string
+	if m.decisions != nil {
+		cacheKey, err = m.cacheKey(check)
+		if err != nil {
+			return nil, err
+		}
+		if cached, found := m.decisions.Get(cacheKey); found {
+			return cached.(*extAuthzDecision), nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), m.timeout())
+	defer cancel()
+
+	var decision *extAuthzDecision
+	if m.Spec.ExternalAuthz.Protocol == extAuthzProtocolGRPC {
+		decision, err = m.checkGRPC(ctx, payload)
+	} else {
+		decision, err = m.checkHTTP(ctx, payload)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if m.decisions != nil {
+		m.decisions.Set(cacheKey, decision, cache.DefaultExpiration)
+	}
+	return decision, nil
+}
+
+func (m *ExternalAuthzMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	decision, err := m.decide(r)
+	if err != nil {
+		logger := m.Logger().WithError(err)
+		if m.Spec.ExternalAuthz.FailOpen {
+			logger.Warning("Authorization service failed, allowing request")
+			return nil, http.StatusOK
+		}
+		logger.Error("Authorization service failed, denying request")
+		return errExtAuthzUnavailable, http.StatusForbidden
+	}
+
+	if !decision.Allowed {
+		// the service may only deny requests with a client error
+		code := decision.StatusCode
+		if code < 400 || code > 499 {
+			code = http.StatusForbidden
+		}
+		if decision.Message != "" {
+			return errors.New(decision.Message), code
+		}
+		return errExtAuthzDenied, code
+	}
+
+	for name, value := range decision.Headers {
+		r.Header.Set(name, value)
+	}
+	return nil, http.StatusOK
+}
@@ -0,0 +1,69 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestExternalAuthz(t *testing.T) {
+	var calls int32
+	authz := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		var check extAuthzCheck
+		if err := json.NewDecoder(r.Body).Decode(&check); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if check.Headers["X-User"] != "alice" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(extAuthzDecision{Message: "Only alice may pass"})
+			return
+		}
+		json.NewEncoder(w).Encode(extAuthzDecision{Headers: map[string]string{"X-Authz-Role": "admin"}})
+	}))
+	defer authz.Close()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "authz"
+		spec.Proxy.ListenPath = "/authz/"
+		spec.ExternalAuthz.Enabled = true
+		spec.ExternalAuthz.URL = authz.URL
+		spec.ExternalAuthz.CacheTTL = 60
+		spec.ExternalAuthz.CacheHeaders = []string{"x-user"}
+	}, func(spec *APISpec) {
+		spec.APIID = "authz-closed"
+		spec.Proxy.ListenPath = "/closed/"
+		spec.ExternalAuthz.Enabled = true
+		spec.ExternalAuthz.URL = "http://127.0.0.1:1"
+	}, func(spec *APISpec) {
+		spec.APIID = "authz-open"
+		spec.Proxy.ListenPath = "/open/"
+		spec.ExternalAuthz.Enabled = true
+		spec.ExternalAuthz.URL = "http://127.0.0.1:1"
+		spec.ExternalAuthz.FailOpen = true
+	})
+
+	alice := map[string]string{"X-User": "alice"}
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/authz/", Headers: alice, Code: http.StatusOK, BodyMatch: `"X-Authz-Role":"admin"`},
+		// headers the decisions don't depend on don't miss the cache
+		{Path: "/authz/", Headers: map[string]string{"X-User": "alice", "X-Request-Id": "2"}, Code: http.StatusOK,
+			BodyMatch: `"X-Authz-Role":"admin"`},
+		{Path: "/authz/", Headers: map[string]string{"X-User": "bob"}, Code: http.StatusForbidden,
+			BodyMatch: "Only alice may pass"},
+		{Path: "/closed/", Code: http.StatusForbidden, BodyMatch: "Authorization service unavailable"},
+		{Path: "/open/", Code: http.StatusOK},
+	}...)
+
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("Expected the decision for alice to be cached, the service was called %d times", n)
+	}
+}
@@ -143,6 +143,13 @@ func (m *GraphQLMiddleware) initGraphQLEngineV2(logger *abstractlogger.LogrusLog
 	configAdapter := adapter.NewGraphQLConfigAdapter(m.Spec.GraphQL)
 	configAdapter.SetHttpClient(m.Spec.GraphQLExecutor.Client)
 
+	dataSourceClients, err := graphQLDataSourceClients(m.Spec, m.Spec.GraphQL.Engine.DataSources)
+	if err != nil {
+		m.Logger().WithError(err).Error("could not set up upstream auth of data sources")
+		return
+	}
+	configAdapter.SetDataSourceHttpClients(dataSourceClients)
+
 	engineConfig, err := configAdapter.EngineConfigV2()
 	if err != nil {
 		m.Logger().WithError(err).Error("could not create engine v2 config")
@@ -160,7 +167,8 @@ func (m *GraphQLMiddleware) initGraphQLEngineV2(logger *abstractlogger.LogrusLog
 
 func (m *GraphQLMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
 
-	if m.Spec.GraphQLExecutor.Schema == nil {
+	schema := m.Spec.graphQLSchema()
+	if schema == nil {
 		m.Logger().Error("Schema is not created")
 		return errors.New("there was a problem proxying the request"), http.StatusInternalServerError
 	}
@@ -179,15 +187,24 @@ func (m *GraphQLMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Reques
 	}
 
 	var gqlRequest gql.Request
-	err := gql.UnmarshalRequest(r.Body, &gqlRequest)
+	var err error
+	isSSE := m.Spec.GraphQL.ExecutionMode == apidef.GraphQLExecutionModeExecutionEngine && isGraphQLSSERequest(r)
+	if isSSE && r.Method == http.MethodGet {
+		gqlRequest, err = graphQLRequestFromQuery(r.URL.Query())
+	} else {
+		err = gql.UnmarshalRequest(r.Body, &gqlRequest)
+	}
 	if err != nil {
 		m.Logger().Debugf("Error while unmarshalling GraphQL request: '%s'", err)
 		return err, http.StatusBadRequest
 	}
 
 	defer ctxSetGraphQLRequest(r, &gqlRequest)
+	if isSSE {
+		ctxSetGraphQLIsSSE(r, true)
+	}
 
-	normalizationResult, err := gqlRequest.Normalize(m.Spec.GraphQLExecutor.Schema)
+	normalizationResult, err := gqlRequest.Normalize(schema)
 	if err != nil {
 		m.Logger().Errorf("Error while normalizing GraphQL request: '%s'", err)
 		return errors.New("there was a problem proxying the request"), http.StatusInternalServerError
@@ -197,7 +214,7 @@ func (m *GraphQLMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Reques
 		return m.writeGraphQLError(w, normalizationResult.Errors)
 	}
 
-	validationResult, err := gqlRequest.ValidateForSchema(m.Spec.GraphQLExecutor.Schema)
+	validationResult, err := gqlRequest.ValidateForSchema(schema)
 	if err != nil {
 		m.Logger().Errorf("Error while validating GraphQL request: '%s'", err)
 		return errors.New("there was a problem proxying the request"), http.StatusInternalServerError
@@ -41,7 +41,7 @@ func (m *GraphQLComplexityMiddleware) ProcessRequest(w http.ResponseWriter, r *h
 
 	// If MaxQueryDepth is -1 or 0, it means unlimited and no need for depth limiting.
 	if m.DepthLimitEnabled(accessDef) {
-		if failReason := m.DepthLimitExceeded(gqlRequest, accessDef, m.Spec.GraphQLExecutor.Schema); failReason != ComplexityFailReasonNone {
+		if failReason := m.DepthLimitExceeded(gqlRequest, accessDef, m.Spec.graphQLSchema()); failReason != ComplexityFailReasonNone {
 			return m.handleComplexityFailReason(failReason)
 		}
 	}
@@ -45,7 +45,7 @@ func (m *GraphQLGranularAccessMiddleware) ProcessRequest(w http.ResponseWriter,
 		Types: sessionVersionData.RestrictedTypes,
 	}
 
-	result, err := gqlRequest.ValidateFieldRestrictions(m.Spec.GraphQLExecutor.Schema, restrictedFieldsList, graphql.DefaultFieldsValidator{})
+	result, err := gqlRequest.ValidateFieldRestrictions(m.Spec.graphQLSchema(), restrictedFieldsList, graphql.DefaultFieldsValidator{})
 	if err != nil {
 		m.Logger().Errorf("Error during GraphQL request restricted fields validation: '%s'", err)
 		return errors.New("there was a problem proxying the request"), http.StatusInternalServerError
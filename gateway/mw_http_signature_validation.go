@@ -192,12 +192,31 @@ func (hm *HTTPSignatureValidationMiddleware) ProcessRequest(w http.ResponseWrite
 	}
 
 	// Check clock skew
-	_, dateVal := getDateHeader(r)
+	dateHeader, dateVal := getDateHeader(r)
 	if !hm.checkClockSkew(dateVal) {
 		logger.Error("Clock skew outside of acceptable bounds")
 		return hm.authorizationError(r)
 	}
 
+	if hm.Spec.ReplayProtection.Enabled {
+		// the window is checked against the date, which mustn't be
+		// replaced in a replay
+		if !hmacHeaderSigned(fieldValues, dateHeader) {
+			return errReplayDateUnsigned, http.StatusBadRequest
+		}
+		nonce, ok := hmacReplayNonce(r, hm.Spec.ReplayProtection.NonceHeader, fieldValues)
+		if !ok {
+			return errReplayNonceMissing, http.StatusBadRequest
+		}
+		signedAt, err := parseSignatureDate(dateVal)
+		if err != nil {
+			return errReplayStale, http.StatusBadRequest
+		}
+		if err, code := checkReplay(hm, r, fieldValues.KeyID, nonce, signedAt); err != nil {
+			return err, code
+		}
+	}
+
 	// Set session state on context, we will need it later
 	switch hm.Spec.BaseIdentityProvidedBy {
 	case apidef.HMACKey, apidef.UnsetAuth:
@@ -250,7 +269,8 @@ func (hm *HTTPSignatureValidationMiddleware) authorizationError(r *http.Request)
 	return errors.New("Authorization field missing, malformed or invalid"), http.StatusBadRequest
 }
 
-func (hm HTTPSignatureValidationMiddleware) checkClockSkew(dateHeaderValue string) bool {
+// parseSignatureDate parses the date header of a signed request.
+func parseSignatureDate(dateHeaderValue string) (time.Time, error) {
 	// Reference layout for parsing time: "Mon Jan 2 15:04:05 MST 2006"
 	refDate := "Mon, 02 Jan 2006 15:04:05 MST"
 	// Fall back to a numeric timezone, since some environments don't provide a timezone name code
@@ -260,7 +280,11 @@ func (hm HTTPSignatureValidationMiddleware) checkClockSkew(dateHeaderValue strin
 	if err != nil {
 		tim, err = time.Parse(refDateNumeric, dateHeaderValue)
 	}
+	return tim, err
+}
 
+func (hm HTTPSignatureValidationMiddleware) checkClockSkew(dateHeaderValue string) bool {
+	tim, err := parseSignatureDate(dateHeaderValue)
 	if err != nil {
 		hm.Logger().WithError(err).WithField("date_string", tim).Error("Date parsing failed")
 		return false
@@ -0,0 +1,191 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/request"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+const (
+	idempotencyDefaultTTL = 24 * 60 * 60
+	// idempotencyLockTTL bounds how long a request keeps retries of its
+	// idempotency key waiting, should the gateway die while proxying it.
+	idempotencyLockTTL = 60
+)
+
+var errIdempotencyInFlight = errors.New("A request with the same idempotency key is being processed")
+
+// rawIncrementStore reports the increments failing as the store is
+// unavailable.
+type rawIncrementStore interface {
+	IncrementRawKey(keyName string, expire int64) (int64, error)
+}
+
+// incrementRawKey increments a raw key, failing when the store is
+// unavailable rather than returning 0, which locks and nonces would take
+// for a key already taken.
+func incrementRawKey(store storage.Handler, keyName string, expire int64) (int64, error) {
+	if incrStore, ok := store.(rawIncrementStore); ok {
+		return incrStore.IncrementRawKey(keyName, expire)
+	}
+	val := store.IncrememntWithExpire(keyName, expire)
+	if val == 0 {
+		return 0, storage.ErrRedisIsDown
+	}
+	return val, nil
+}
+
+// IdempotencyMiddleware replays the first response of an endpoint to requests
+// retried with the same Idempotency-Key header and body, so that upstreams
+// process them only once. As it proxies the request itself, it must be the
+// last middleware before the cache.
+type IdempotencyMiddleware struct {
+	BaseMiddleware
+	store storage.Handler
+	sh    SuccessHandler
+}
+
+func (m *IdempotencyMiddleware) Name() string {
+	return "IdempotencyMiddleware"
+}
+
+func (m *IdempotencyMiddleware) Init() {
+	m.store = &storage.RedisCluster{KeyPrefix: "idempotency-"}
+	m.sh = SuccessHandler{m.BaseMiddleware}
+}
+
+func (m *IdempotencyMiddleware) EnabledForSpec() bool {
+	for _, version := range m.Spec.VersionData.Versions {
+		if len(version.ExtendedPaths.Idempotency) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// requestKey identifies a request by its idempotency key, endpoint, body and
+// the client that made it.
+func (m *IdempotencyMiddleware) requestKey(r *http.Request, idempotencyKey string) (string, error) {
+	body, err := readBody(r)
+	if err != nil {
+		return "", err
+	}
+	bodyHash := sha256.Sum256(body)
+
+	client := ctxGetAuthToken(r)
+	if client == "" {
+		client = request.RealIP(r)
+	}
+
+	h := sha256.New()
+	for _, part := range []string{m.Spec.APIID, client, r.Method, r.URL.Path, idempotencyKey} {
+		io.WriteString(h, part)
+		h.Write([]byte{0})
+	}
+	h.Write(bodyHash[:])
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (m *IdempotencyMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	idempotencyKey := r.Header.Get(headers.IdempotencyKey)
+	if idempotencyKey == "" {
+		return nil, http.StatusOK
+	}
+
+	_, versionPaths, _, _ := m.Spec.Version(r)
+	found, meta := m.Spec.CheckSpecMatchesStatus(r, versionPaths, Idempotent)
+	if !found {
+		return nil, http.StatusOK
+	}
+	idempotencyMeta := meta.(*apidef.IdempotencyMeta)
+
+	key, err := m.requestKey(r, idempotencyKey)
+	if err != nil {
+		m.Logger().WithError(err).Error("Couldn't read the request body, idempotency key ignored")
+		return nil, http.StatusOK
+	}
+
+	if stored, err := m.store.GetKey(key); err == nil {
+		return m.replay(w, r, stored)
+	}
+
+	lockKey := m.store.GetKeyPrefix() + key + "-lock"
+	locked, err := incrementRawKey(m.store, lockKey, idempotencyLockTTL)
+	if err != nil {
+		m.Logger().WithError(err).Error("Couldn't lock the idempotency key")
+		return errors.New("Idempotency keys are unavailable"), http.StatusServiceUnavailable
+	}
+	if locked != 1 {
+		status := idempotencyMeta.InFlightStatusCode
+		if status != http.StatusTooEarly {
+			status = http.StatusConflict
+		}
+		return errIdempotencyInFlight, status
+	}
+	defer m.store.DeleteRawKey(lockKey)
+
+	// the first request may have completed in the meantime
+	if stored, err := m.store.GetKey(key); err == nil {
+		return m.replay(w, r, stored)
+	}
+
+	applyDeferredRequestChanges(r)
+	res := m.sh.ServeHTTPWithCache(w, r).Response
+	if res == nil {
+		m.Logger().Warning("Upstream request must have failed, response is empty")
+		return nil, mwStatusRespond
+	}
+
+	// failures are not replayed, so that they can be retried
+	if res.StatusCode < http.StatusInternalServerError {
+		ttl := idempotencyMeta.TTL
+		if ttl <= 0 {
+			ttl = idempotencyDefaultTTL
+		}
+
+		var wireFormatRes bytes.Buffer
+		res.Write(&wireFormatRes)
+		if err := m.store.SetKey(key, wireFormatRes.String(), ttl); err != nil {
+			m.Logger().WithError(err).Error("Couldn't store the response of an idempotent request")
+		}
+	}
+
+	return nil, mwStatusRespond
+}
+
+// replay writes the stored response of an idempotent request.
+func (m *IdempotencyMiddleware) replay(w http.ResponseWriter, r *http.Request, stored string) (error, int) {
+	res, err := http.ReadResponse(bufio.NewReader(strings.NewReader(stored)), r)
+	if err != nil {
+		m.Logger().WithError(err).Error("Couldn't read the stored response of an idempotent request")
+		return errors.New("There was a problem proxying the request"), http.StatusInternalServerError
+	}
+	nopCloseResponseBody(res)
+	defer res.Body.Close()
+
+	for _, h := range hopHeaders {
+		res.Header.Del(h)
+	}
+	copyHeader(w.Header(), res.Header, m.Spec.headerCasing())
+	w.Header().Set(headers.IdempotentReplayed, "true")
+
+	w.WriteHeader(res.StatusCode)
+	m.Proxy.CopyResponse(w, res.Body)
+
+	if !m.Spec.DoNotTrack {
+		m.sh.RecordHit(r, Latency{}, res.StatusCode, res)
+	}
+
+	return nil, mwStatusRespond
+}
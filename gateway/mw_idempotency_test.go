@@ -0,0 +1,114 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestIdempotency(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	var hits int32
+	slowStarted := make(chan struct{})
+	slowRelease := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(slowStarted)
+			<-slowRelease
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "hit %d", atomic.AddInt32(&hits, 1))
+	}))
+	defer upstream.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream.URL
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.UseExtendedPaths = true
+			v.ExtendedPaths.Idempotency = []apidef.IdempotencyMeta{
+				{Path: "/pay", Method: http.MethodPost, TTL: 60},
+				{Path: "/slow", Method: http.MethodPost, InFlightStatusCode: http.StatusTooEarly},
+			}
+		})
+	})
+
+	// stored responses outlive the test
+	run := uuid.NewV4().String()
+	withKey := func(key string) map[string]string {
+		return map[string]string{headers.IdempotencyKey: run + key}
+	}
+	replayed := map[string]string{headers.IdempotentReplayed: "true"}
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Method: http.MethodPost, Path: "/pay", Data: "a", Headers: withKey("k1"), Code: http.StatusCreated, BodyMatch: "hit 1", HeadersNotMatch: replayed},
+		{Method: http.MethodPost, Path: "/pay", Data: "a", Headers: withKey("k1"), Code: http.StatusCreated, BodyMatch: "hit 1", HeadersMatch: replayed},
+		// a different body or key is a different request
+		{Method: http.MethodPost, Path: "/pay", Data: "b", Headers: withKey("k1"), Code: http.StatusCreated, BodyMatch: "hit 2"},
+		{Method: http.MethodPost, Path: "/pay", Data: "a", Headers: withKey("k2"), Code: http.StatusCreated, BodyMatch: "hit 3"},
+		// requests without a key, or to other endpoints, are not replayed
+		{Method: http.MethodPost, Path: "/pay", Data: "a", Code: http.StatusCreated, BodyMatch: "hit 4"},
+		{Method: http.MethodPost, Path: "/other", Data: "a", Headers: withKey("k1"), Code: http.StatusCreated, BodyMatch: "hit 5"},
+		{Method: http.MethodPost, Path: "/other", Data: "a", Headers: withKey("k1"), Code: http.StatusCreated, BodyMatch: "hit 6"},
+	}...)
+
+	t.Run("In flight", func(t *testing.T) {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _ = ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/slow", Headers: withKey("k3"), Code: http.StatusCreated, BodyMatch: "hit 7"})
+		}()
+
+		<-slowStarted
+		_, _ = ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/slow", Headers: withKey("k3"), Code: http.StatusTooEarly})
+		close(slowRelease)
+		<-done
+
+		_, _ = ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/slow", Headers: withKey("k3"), Code: http.StatusCreated, BodyMatch: "hit 7", HeadersMatch: replayed})
+	})
+}
+
+// unavailableStore is a store that lost its connection to Redis.
+type unavailableStore struct {
+	storage.Handler
+}
+
+func (unavailableStore) GetKey(string) (string, error) {
+	return "", storage.ErrRedisIsDown
+}
+
+func (unavailableStore) IncrementRawKey(string, int64) (int64, error) {
+	return 0, storage.ErrRedisIsDown
+}
+
+func TestIdempotency_StoreUnavailable(t *testing.T) {
+	spec := createSpecTestFrom(t, BuildAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.UseExtendedPaths = true
+			v.ExtendedPaths.Idempotency = []apidef.IdempotencyMeta{{Path: "/pay", Method: http.MethodPost}}
+		})
+	})[0].APIDefinition)
+
+	m := &IdempotencyMiddleware{BaseMiddleware: BaseMiddleware{Spec: spec}}
+	m.Init()
+	m.store = unavailableStore{m.store}
+
+	r := httptest.NewRequest(http.MethodPost, "/pay", strings.NewReader("a"))
+	r.Header.Set(headers.IdempotencyKey, "k1")
+	if err, code := m.ProcessRequest(httptest.NewRecorder(), r, nil); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the request to be rejected as unavailable, got %d: %v", code, err)
+	}
+}
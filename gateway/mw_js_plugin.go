@@ -236,17 +236,14 @@ func (d *DynamicMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Reques
 		return nil, http.StatusOK
 	}
 
-	ignoreCanonical := config.Global().IgnoreCanonicalMIMEHeaderKey
+	casing := d.Spec.headerCasing()
 	// Delete and set headers
 	for _, dh := range newRequestData.Request.DeleteHeaders {
-		r.Header.Del(dh)
-		if ignoreCanonical {
-			// Make sure we delete the header in case the header key was not canonical.
-			delete(r.Header, dh)
-		}
+		// Make sure we delete the header in case the header key was not canonical.
+		casing.del(r.Header, dh)
 	}
 	for h, v := range newRequestData.Request.SetHeaders {
-		setCustomHeader(r.Header, h, v, ignoreCanonical)
+		setCustomHeader(r.Header, h, v, casing)
 	}
 
 	// Delete and set request parameters
@@ -475,7 +472,7 @@ func (j *JSVM) LoadTykJSApi() {
 		}
 		return returnVal
 	})
-	ignoreCanonical := config.Global().IgnoreCanonicalMIMEHeaderKey
+	casing := j.Spec.headerCasing()
 	// Enable the creation of HTTP Requsts
 	j.VM.Set("TykMakeHttpRequest", func(call otto.FunctionCall) otto.Value {
 		jsonHRO := call.Argument(0).String()
@@ -513,7 +510,7 @@ func (j *JSVM) LoadTykJSApi() {
 		}
 
 		for k, v := range hro.Headers {
-			setCustomHeader(r.Header, k, v, ignoreCanonical)
+			setCustomHeader(r.Header, k, v, casing)
 		}
 		r.Close = true
 
@@ -600,7 +597,13 @@ func (j *JSVM) LoadTykJSApi() {
 			return otto.Value{}
 		}
 
-		doAddOrUpdate(apiKey, newSession, suppressReset == "1", false)
+		action := KeyspaceEventCreated
+		if _, found := GlobalSessionManager.SessionDetail(newSession.OrgID, apiKey, false); found {
+			action = KeyspaceEventUpdated
+		}
+		if err := doAddOrUpdate(apiKey, newSession, suppressReset == "1", false); err == nil {
+			emitKeyspaceEvent(action, newSession.OrgID, apiKey, false)
+		}
 
 		return otto.Value{}
 	})
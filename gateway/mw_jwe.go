@@ -0,0 +1,233 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	jose "github.com/square/go-jose"
+
+	"github.com/TykTechnologies/tyk/certs"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const (
+	jweContentType        = "application/jose"
+	jweJSONContentType    = "application/jose+json"
+	jweDefaultPlaintextCT = "application/json"
+	jweDefaultEncryption  = jose.A256GCM
+)
+
+var (
+	errJWERequired   = errors.New("Request body must be encrypted")
+	errJWEMalformed  = errors.New("Encrypted request body is malformed")
+	errJWEDecrypt    = errors.New("Request body couldn't be decrypted")
+	errJWECompressed = errors.New("Compressed encrypted request bodies are not supported")
+)
+
+// JWEDecryptMiddleware decrypts JWE encrypted request bodies with the keys
+// of the gateway, before they are proxied.
+type JWEDecryptMiddleware struct {
+	BaseMiddleware
+}
+
+func (m *JWEDecryptMiddleware) Name() string {
+	return "JWEDecryptMiddleware"
+}
+
+func (m *JWEDecryptMiddleware) EnabledForSpec() bool {
+	return m.Spec.JWE.Enabled && len(m.Spec.JWE.DecryptionKeys) > 0
+}
+
+// isJWEContentType reports whether a content type is the one of a JWE.
+func isJWEContentType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == jweContentType || mediaType == jweJSONContentType
+}
+
+func (m *JWEDecryptMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	body, err := readBody(r)
+	if err != nil {
+		return err, http.StatusBadRequest
+	}
+	if len(body) == 0 {
+		return nil, http.StatusOK
+	}
+	if !isJWEContentType(r.Header.Get(headers.ContentType)) {
+		if m.Spec.JWE.RequireEncryption {
+			return errJWERequired, http.StatusBadRequest
+		}
+		return nil, http.StatusOK
+	}
+
+	jwe, err := jose.ParseEncrypted(strings.TrimSpace(string(body)))
+	if err != nil {
+		m.Logger().WithError(err).Debug("Couldn't parse encrypted request body")
+		return errJWEMalformed, http.StatusBadRequest
+	}
+	// the plaintext would be inflated before its size is known
+	if _, ok := jwe.Header.ExtraHeaders["zip"]; ok {
+		return errJWECompressed, http.StatusBadRequest
+	}
+
+	var plaintext []byte
+	for _, cert := range CertificateManager.List(m.Spec.JWE.DecryptionKeys, certs.CertificatePrivate) {
+		if cert == nil {
+			continue
+		}
+		if plaintext, err = jwe.Decrypt(cert.PrivateKey); err == nil {
+			break
+		}
+	}
+	if plaintext == nil {
+		m.Logger().WithError(err).Info("Couldn't decrypt request body")
+		return errJWEDecrypt, http.StatusBadRequest
+	}
+
+	contentType, _ := jwe.Header.ExtraHeaders[jose.HeaderContentType].(string)
+	if contentType == "" {
+		contentType = jweDefaultPlaintextCT
+	}
+	r.Header.Set(headers.ContentType, contentType)
+	r.Body = ioutil.NopCloser(bytes.NewReader(plaintext))
+	r.ContentLength = int64(len(plaintext))
+	r.Header.Set(headers.ContentLength, strconv.Itoa(len(plaintext)))
+
+	// the size limits were checked against the encrypted body
+	sizeLimit := &RequestSizeLimitMiddleware{m.BaseMiddleware}
+	return sizeLimit.ProcessRequest(w, r, nil)
+}
+
+// ResponseJWEEncryptMiddleware encrypts the responses of the consumers whose
+// session metadata holds a public key.
+type ResponseJWEEncryptMiddleware struct {
+	Spec *APISpec
+}
+
+func (ResponseJWEEncryptMiddleware) Name() string {
+	return "ResponseJWEEncryptMiddleware"
+}
+
+func (h *ResponseJWEEncryptMiddleware) Init(c interface{}, spec *APISpec) error {
+	h.Spec = spec
+	return nil
+}
+
+func (h *ResponseJWEEncryptMiddleware) HandleError(rw http.ResponseWriter, req *http.Request) {
+}
+
+// mandatory makes the encryption run even when a response handler before it
+// fails, as a response that isn't encrypted is replaced by a 500.
+func (h *ResponseJWEEncryptMiddleware) mandatory() {}
+
+// jweRecipientKey parses the public key of a consumer, given as PEM or as
+// the ID of a public key of the certificate store.
+func jweRecipientKey(value string) (interface{}, error) {
+	if !strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN") {
+		if key := CertificateManager.ListRawPublicKey(value); key != nil {
+			return key, nil
+		}
+		return nil, errors.New("public key not found")
+	}
+
+	block, _ := pem.Decode([]byte(value))
+	if block == nil {
+		return nil, errors.New("couldn't decode public key")
+	}
+	if block.Type == "CERTIFICATE" {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+func (h *ResponseJWEEncryptMiddleware) keyAlgorithm(key interface{}) jose.KeyAlgorithm {
+	if alg := h.Spec.JWE.KeyAlgorithm; alg != "" {
+		return jose.KeyAlgorithm(alg)
+	}
+	if _, ok := key.(*ecdsa.PublicKey); ok {
+		return jose.ECDH_ES_A256KW
+	}
+	return jose.RSA_OAEP_256
+}
+
+func (h *ResponseJWEEncryptMiddleware) HandleResponse(rw http.ResponseWriter, res *http.Response, req *http.Request, ses *user.SessionState) error {
+	if ses == nil || !h.Spec.JWE.Enabled || h.Spec.JWE.ResponseKeyMetadata == "" {
+		return nil
+	}
+	value, _ := ses.GetMetaDataByKey(h.Spec.JWE.ResponseKeyMetadata)
+	keyValue, _ := value.(string)
+	if keyValue == "" {
+		return nil
+	}
+
+	err := h.encrypt(res, keyValue)
+	if err != nil {
+		// the plaintext must not reach the consumer
+		res.StatusCode = http.StatusInternalServerError
+		res.Body = ioutil.NopCloser(bytes.NewReader(nil))
+		res.ContentLength = 0
+		res.Header.Del(headers.ContentType)
+		res.Header.Set(headers.ContentLength, "0")
+	}
+	return err
+}
+
+func (h *ResponseJWEEncryptMiddleware) encrypt(res *http.Response, keyValue string) error {
+	key, err := jweRecipientKey(keyValue)
+	if err != nil {
+		return err
+	}
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return errors.New("unsupported response encryption key type")
+	}
+
+	enc := jweDefaultEncryption
+	if h.Spec.JWE.ContentEncryption != "" {
+		enc = jose.ContentEncryption(h.Spec.JWE.ContentEncryption)
+	}
+	opts := &jose.EncrypterOptions{}
+	if contentType := res.Header.Get(headers.ContentType); contentType != "" {
+		opts.WithContentType(jose.ContentType(contentType))
+	}
+	encrypter, err := jose.NewEncrypter(enc, jose.Recipient{Algorithm: h.keyAlgorithm(key), Key: key}, opts)
+	if err != nil {
+		return err
+	}
+
+	body := respBodyReader(nil, res)
+	plaintext, err := ioutil.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return err
+	}
+	obj, err := encrypter.Encrypt(plaintext)
+	if err != nil {
+		return err
+	}
+	ciphertext, err := obj.CompactSerialize()
+	if err != nil {
+		return err
+	}
+
+	res.Header.Del(headers.ContentEncoding)
+	res.Header.Set(headers.ContentType, jweContentType)
+	res.Header.Set(headers.ContentLength, strconv.Itoa(len(ciphertext)))
+	res.ContentLength = int64(len(ciphertext))
+	res.Body = ioutil.NopCloser(strings.NewReader(ciphertext))
+	return nil
+}
@@ -0,0 +1,146 @@
+package gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jose "github.com/square/go-jose"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestJWEDecrypt(t *testing.T) {
+	certPem, _, combinedPEM, _ := genServerCertificate()
+	certID, err := CertificateManager.Add(combinedPEM, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CertificateManager.Delete(certID, "")
+
+	block, _ := pem.Decode(certPem)
+	cert, _ := x509.ParseCertificate(block.Bytes)
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/jwe/"
+		spec.JWE.Enabled = true
+		spec.JWE.DecryptionKeys = []string{certID}
+		spec.JWE.RequireEncryption = true
+	})
+
+	encrypter, _ := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: cert.PublicKey},
+		(&jose.EncrypterOptions{}).WithContentType("application/json"))
+	obj, _ := encrypter.Encrypt([]byte(`{"card":"4111"}`))
+	encrypted, _ := obj.CompactSerialize()
+
+	zipEncrypter, _ := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: cert.PublicKey},
+		&jose.EncrypterOptions{Compression: jose.DEFLATE})
+	obj, _ = zipEncrypter.Encrypt([]byte(`{"card":"4111"}`))
+	compressed, _ := obj.CompactSerialize()
+
+	jwe := map[string]string{"Content-Type": jweContentType}
+	_, _ = ts.Run(t, []test.TestCase{
+		{Method: http.MethodPost, Path: "/jwe/", Data: encrypted, Headers: jwe, Code: http.StatusOK,
+			BodyMatch: `card\\":\\"4111`},
+		{Method: http.MethodPost, Path: "/jwe/", Data: `{"card":"4111"}`, Code: http.StatusBadRequest,
+			BodyMatch: "must be encrypted"},
+		{Method: http.MethodPost, Path: "/jwe/", Data: "not.a.jwe", Headers: jwe, Code: http.StatusBadRequest,
+			BodyMatch: "malformed"},
+		{Method: http.MethodPost, Path: "/jwe/", Data: compressed, Headers: jwe, Code: http.StatusBadRequest,
+			BodyMatch: "Compressed"},
+	}...)
+}
+
+func TestJWEEncryptResponse(t *testing.T) {
+	consumerKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(consumerKey.Public())
+	publicPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/"
+		spec.JWE.Enabled = true
+		spec.JWE.ResponseKeyMetadata = "jwe_key"
+	})
+
+	encryptedKey := CreateSession(func(s *user.SessionState) {
+		s.AccessRights = map[string]user.AccessDefinition{"test": {APIID: "test", Versions: []string{"v1"}}}
+		s.MetaData = map[string]interface{}{"jwe_key": publicPEM}
+	})
+	plainKey := CreateSession(func(s *user.SessionState) {
+		s.AccessRights = map[string]user.AccessDefinition{"test": {APIID: "test", Versions: []string{"v1"}}}
+	})
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/get", Headers: map[string]string{"Authorization": plainKey}, Code: http.StatusOK, BodyMatch: `"Url":"/get"`},
+		{Path: "/get", Headers: map[string]string{"Authorization": encryptedKey}, Code: http.StatusOK,
+			HeadersMatch: map[string]string{"Content-Type": jweContentType},
+			BodyMatchFunc: func(body []byte) bool {
+				obj, err := jose.ParseEncrypted(string(body))
+				if err != nil {
+					t.Error(err)
+					return false
+				}
+				plaintext, err := obj.Decrypt(consumerKey)
+				if err != nil {
+					t.Error(err)
+					return false
+				}
+				return strings.Contains(string(plaintext), `"Url":"/get"`)
+			}},
+	}...)
+}
+
+type failingResponseHandler struct{}
+
+func (failingResponseHandler) Init(interface{}, *APISpec) error { return nil }
+func (failingResponseHandler) Name() string                     { return "failingResponseHandler" }
+func (failingResponseHandler) HandleError(http.ResponseWriter, *http.Request) {
+}
+func (failingResponseHandler) HandleResponse(http.ResponseWriter, *http.Response, *http.Request, *user.SessionState) error {
+	return errors.New("failed")
+}
+
+func TestJWEEncryptAfterFailedHandler(t *testing.T) {
+	consumerKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(consumerKey.Public())
+	publicPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	spec := &APISpec{APIDefinition: &apidef.APIDefinition{}}
+	spec.JWE.Enabled = true
+	spec.JWE.ResponseKeyMetadata = "jwe_key"
+	encrypt := &ResponseJWEEncryptMiddleware{}
+	encrypt.Init(nil, spec)
+
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(`{"secret":true}`)),
+	}
+	session := &user.SessionState{MetaData: map[string]interface{}{"jwe_key": publicPEM}}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	_, err := handleResponseChain([]TykResponseHandler{failingResponseHandler{}, encrypt}, httptest.NewRecorder(), res, req, session)
+	if err == nil {
+		t.Fatal("Expected the error of the failed handler")
+	}
+	if ct := res.Header.Get("Content-Type"); ct != jweContentType {
+		t.Errorf("Expected the response to be encrypted, got %s", ct)
+	}
+}
@@ -0,0 +1,127 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	jose "github.com/square/go-jose"
+)
+
+const jwsDefaultHeader = "x-jws-signature"
+
+var jwsDefaultAlgorithms = []string{"PS256", "RS256", "ES256"}
+
+var (
+	errJWSMissing   = errors.New("Request signature is missing")
+	errJWSMalformed = errors.New("Request signature is malformed")
+	errJWSAlgorithm = errors.New("Request signature algorithm is not allowed")
+	errJWSInvalid   = errors.New("Request signature is invalid")
+)
+
+// JWSValidationMiddleware rejects requests whose body doesn't match the
+// detached JWS signature of its header. Requests without a body aren't
+// checked.
+type JWSValidationMiddleware struct {
+	BaseMiddleware
+}
+
+func (m *JWSValidationMiddleware) Name() string {
+	return "JWSValidationMiddleware"
+}
+
+func (m *JWSValidationMiddleware) EnabledForSpec() bool {
+	return m.Spec.JWSValidation.IsEnabled
+}
+
+func (m *JWSValidationMiddleware) header() string {
+	if header := m.Spec.JWSValidation.Header; header != "" {
+		return header
+	}
+	return jwsDefaultHeader
+}
+
+func (m *JWSValidationMiddleware) algorithmAllowed(alg string) bool {
+	allowed := m.Spec.JWSValidation.AllowedAlgorithms
+	if len(allowed) == 0 {
+		allowed = jwsDefaultAlgorithms
+	}
+	for _, a := range allowed {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// verificationKeys returns the keys the signature may be verified with: the
+// keys of the JWKS matching its key ID, then the pinned keys.
+func (m *JWSValidationMiddleware) verificationKeys(kid string) []interface{} {
+	var keys []interface{}
+	if m.Spec.JWSValidation.JWKSURL != "" {
+		jwkSet, err := fetchJWKS("jws-"+m.Spec.APIID, m.Spec.JWSValidation.JWKSURL)
+		if err != nil {
+			m.Logger().WithError(err).Error("Couldn't fetch the JWKS to validate request signatures")
+		} else {
+			matching := jwkSet.Keys
+			if kid != "" {
+				matching = jwkSet.Key(kid)
+			}
+			for _, key := range matching {
+				keys = append(keys, key.Key)
+			}
+		}
+	}
+	for _, id := range m.Spec.JWSValidation.PinnedKeys {
+		if key := CertificateManager.ListRawPublicKey(id); key != nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (m *JWSValidationMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	body, err := readBody(r)
+	if err != nil {
+		return err, http.StatusBadRequest
+	}
+	if len(body) == 0 {
+		return nil, http.StatusOK
+	}
+
+	signature := strings.TrimSpace(r.Header.Get(m.header()))
+	if signature == "" {
+		return errJWSMissing, http.StatusBadRequest
+	}
+	jws, err := jose.ParseDetached(signature, body)
+	if err != nil || len(jws.Signatures) != 1 {
+		m.Logger().WithError(err).Debug("Couldn't parse request signature")
+		return errJWSMalformed, http.StatusBadRequest
+	}
+	protected := jws.Signatures[0].Protected
+	if !m.algorithmAllowed(protected.Algorithm) {
+		return errJWSAlgorithm, http.StatusBadRequest
+	}
+
+	for _, key := range m.verificationKeys(protected.KeyID) {
+		if err := jws.DetachedVerify(body, key); err == nil {
+			return m.checkReplay(r, jws)
+		}
+	}
+
+	m.Logger().WithField("kid", protected.KeyID).Info("Request signature doesn't match its body")
+	return errJWSInvalid, http.StatusUnauthorized
+}
+
+// checkReplay rejects replays of verified signatures, when the API is
+// protected against them.
+func (m *JWSValidationMiddleware) checkReplay(r *http.Request, jws *jose.JSONWebSignature) (error, int) {
+	if !m.Spec.ReplayProtection.Enabled {
+		return nil, http.StatusOK
+	}
+	nonce, signedAt, ok := jwsReplayNonce(jws)
+	if !ok {
+		return errReplayStale, http.StatusBadRequest
+	}
+	return checkReplay(m, r, jws.Signatures[0].Protected.KeyID, nonce, signedAt)
+}
@@ -0,0 +1,113 @@
+package gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	jose "github.com/square/go-jose"
+
+	"github.com/TykTechnologies/tyk/test"
+)
+
+// signDetached returns the detached compact JWS of payload.
+func signDetached(t *testing.T, alg jose.SignatureAlgorithm, key interface{}, kid string, payload []byte, b64 bool) string {
+	opts := &jose.SignerOptions{}
+	if kid != "" {
+		opts.WithHeader("kid", kid)
+	}
+	if !b64 {
+		opts.WithBase64(false).WithCritical("b64")
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: key}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err := signer.Sign(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := obj.DetachedCompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+func TestJWSValidation(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	otherRSAKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwks := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: otherRSAKey.Public(), KeyID: "other", Algorithm: "PS256", Use: "sig"},
+		{Key: rsaKey.Public(), KeyID: "ob-key", Algorithm: "PS256", Use: "sig"},
+	}}
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	defer jwksServer.Close()
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(ecKey.Public())
+	pinnedKeyID, err := CertificateManager.Add(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CertificateManager.Delete(pinnedKeyID, "")
+	otherECKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "jws-jwks"
+		spec.Proxy.ListenPath = "/jwks/"
+		spec.JWSValidation.IsEnabled = true
+		spec.JWSValidation.JWKSURL = jwksServer.URL
+	}, func(spec *APISpec) {
+		spec.APIID = "jws-pinned"
+		spec.Proxy.ListenPath = "/pinned/"
+		spec.JWSValidation.IsEnabled = true
+		spec.JWSValidation.Header = "X-Signature"
+		spec.JWSValidation.AllowedAlgorithms = []string{"ES256"}
+		spec.JWSValidation.PinnedKeys = []string{pinnedKeyID}
+	})
+
+	body := []byte(`{"Data":{"Initiation":{"InstructedAmount":{"Amount":"10.00"}}}}`)
+	tampered := []byte(`{"Data":{"Initiation":{"InstructedAmount":{"Amount":"99.00"}}}}`)
+	signed := signDetached(t, jose.PS256, rsaKey, "ob-key", body, true)
+	unencoded := signDetached(t, jose.PS256, rsaKey, "ob-key", body, false)
+	hmac := signDetached(t, jose.HS256, []byte("secret"), "", body, true)
+	wrongKey := signDetached(t, jose.PS256, otherRSAKey, "ob-key", body, true)
+	pinned := signDetached(t, jose.ES256, ecKey, "", body, true)
+	otherPinned := signDetached(t, jose.ES256, otherECKey, "", body, true)
+
+	sig := func(header, value string) map[string]string {
+		return map[string]string{header: value}
+	}
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Method: http.MethodPost, Path: "/jwks/", Data: body, Headers: sig("X-JWS-Signature", signed), Code: http.StatusOK,
+			BodyMatch: `10.00`},
+		{Method: http.MethodPost, Path: "/jwks/", Data: body, Headers: sig("X-JWS-Signature", unencoded), Code: http.StatusOK},
+		{Method: http.MethodPost, Path: "/jwks/", Data: tampered, Headers: sig("X-JWS-Signature", signed), Code: http.StatusUnauthorized},
+		{Method: http.MethodPost, Path: "/jwks/", Data: body, Headers: sig("X-JWS-Signature", wrongKey), Code: http.StatusUnauthorized},
+		{Method: http.MethodPost, Path: "/jwks/", Data: body, Headers: sig("X-JWS-Signature", hmac), Code: http.StatusBadRequest,
+			BodyMatch: "algorithm is not allowed"},
+		{Method: http.MethodPost, Path: "/jwks/", Data: body, Headers: sig("X-JWS-Signature", "not.a-jws"), Code: http.StatusBadRequest,
+			BodyMatch: "malformed"},
+		{Method: http.MethodPost, Path: "/jwks/", Data: body, Code: http.StatusBadRequest, BodyMatch: "missing"},
+		{Method: http.MethodGet, Path: "/jwks/", Code: http.StatusOK},
+
+		{Method: http.MethodPost, Path: "/pinned/", Data: body, Headers: sig("X-Signature", pinned), Code: http.StatusOK},
+		{Method: http.MethodPost, Path: "/pinned/", Data: tampered, Headers: sig("X-Signature", pinned), Code: http.StatusUnauthorized},
+		{Method: http.MethodPost, Path: "/pinned/", Data: body, Headers: sig("X-Signature", otherPinned), Code: http.StatusUnauthorized},
+		{Method: http.MethodPost, Path: "/pinned/", Data: body, Headers: sig("X-Signature", signed), Code: http.StatusBadRequest},
+	}...)
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
 	"github.com/TykTechnologies/tyk/storage"
 	"github.com/TykTechnologies/tyk/user"
 )
@@ -81,6 +82,38 @@ func parseJWK(buf []byte) (*jose.JSONWebKeySet, error) {
 	return &j, nil
 }
 
+// fetchJWKS returns the JWKS at url, cached under cacheKey.
+func fetchJWKS(cacheKey, url string) (*jose.JSONWebKeySet, error) {
+	if JWKCache == nil {
+		JWKCache = cache.New(240*time.Second, 30*time.Second)
+	}
+	if cached, found := JWKCache.Get(cacheKey); found {
+		return cached.(*jose.JSONWebKeySet), nil
+	}
+
+	client := http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: config.Global().JWTSSLInsecureSkipVerify},
+		},
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	jwkSet, err := parseJWK(buf)
+	if err != nil {
+		return nil, err
+	}
+	JWKCache.Set(cacheKey, jwkSet, cache.DefaultExpiration)
+	return jwkSet, nil
+}
+
 func (k *JWTMiddleware) legacyGetSecretFromURL(url, kid, keyType string) (interface{}, error) {
 	// Implement a cache
 	if JWKCache == nil {
@@ -583,7 +616,8 @@ func (k *JWTMiddleware) processCentralisedJWT(r *http.Request, token *jwt.Token)
 						storageManager,
 						GlobalSessionManager,
 						&storage.RedisCluster{KeyPrefix: prefix, HashKeys: false},
-						k.Spec.OrgID}),
+						k.Spec.OrgID,
+						k.Spec}),
 			}
 		}
 
@@ -678,6 +712,10 @@ func (k *JWTMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _
 
 	// enable bearer token format
 	rawJWT = stripBearer(rawJWT)
+	var dpopScheme bool
+	if k.Spec.JWTDPoP.Enabled {
+		rawJWT, dpopScheme = stripDPoP(rawJWT)
+	}
 
 	// Use own validation logic, see below
 	parser := &jwt.Parser{SkipClaimsValidation: true}
@@ -736,6 +774,19 @@ func (k *JWTMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _
 			return errors.New("Key not authorized: " + jwtErr.Error()), http.StatusUnauthorized
 		}
 
+		if k.Spec.JWTDPoP.Enabled {
+			err := k.validateDPoP(r, rawJWT, dpopScheme, token.Claims.(jwt.MapClaims))
+			if err == errDPoPUnavailable {
+				return err, http.StatusServiceUnavailable
+			}
+			if err != nil {
+				logger.WithError(err).Info("Attempted JWT access with an invalid DPoP proof.")
+				k.reportLoginFailure(tykId, r)
+				w.Header().Set(headers.WWWAuthenticate, `DPoP error="invalid_dpop_proof"`)
+				return errors.New("Key not authorized: " + err.Error()), http.StatusUnauthorized
+			}
+		}
+
 		// Token is valid - let's move on
 
 		// Are we mapping to a central JWT Secret?
@@ -859,6 +910,9 @@ func generateSessionFromPolicy(policyID, orgID string, enforceOrg bool) (user.Se
 	session.MaxQueryDepth = policy.MaxQueryDepth
 	session.QuotaMax = policy.QuotaMax
 	session.QuotaRenewalRate = policy.QuotaRenewalRate
+	session.QuotaRenewalPeriod = policy.QuotaRenewalPeriod
+	session.QuotaTimezone = policy.QuotaTimezone
+	session.QuotaCarryOver = policy.QuotaCarryOver
 	session.AccessRights = make(map[string]user.AccessDefinition)
 	for apiID, access := range policy.AccessRights {
 		session.AccessRights[apiID] = access
@@ -0,0 +1,190 @@
+package gateway
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	jose "github.com/square/go-jose"
+
+	"github.com/TykTechnologies/tyk/request"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+const (
+	dpopHeader        = "DPoP"
+	dpopProofType     = "dpop+jwt"
+	dpopDefaultMaxAge = 300
+)
+
+var dpopDefaultAlgorithms = []string{"RS256", "PS256", "ES256"}
+
+var (
+	errDPoPRequired  = errors.New("a DPoP proof is required")
+	errDPoPMissing   = errors.New("DPoP proof is missing")
+	errDPoPMalformed = errors.New("DPoP proof is malformed")
+	errDPoPAlgorithm = errors.New("DPoP proof algorithm is not allowed")
+	errDPoPInvalid   = errors.New("DPoP proof is invalid")
+	errDPoPExpired   = errors.New("DPoP proof is too old or issued in the future")
+	errDPoPReplayed  = errors.New("DPoP proof has already been used")
+	errDPoPUnbound   = errors.New("token is not bound to the DPoP proof key")
+	// errDPoPUnavailable is returned when the proof can't be checked for
+	// replays, rather than accepting it.
+	errDPoPUnavailable = errors.New("DPoP proofs can't be checked at the moment")
+)
+
+// dpopReplayStore remembers the jti of the proofs seen within their max age.
+var dpopReplayStore storage.Handler = &storage.RedisCluster{KeyPrefix: "dpop-jti-"}
+
+// dpopClaims are the claims of a DPoP proof.
+type dpopClaims struct {
+	JTI string `json:"jti"`
+	HTM string `json:"htm"`
+	HTU string `json:"htu"`
+	IAT int64  `json:"iat"`
+	ATH string `json:"ath"`
+}
+
+// stripDPoP strips the DPoP authorization scheme from a token, and reports
+// whether it was there.
+func stripDPoP(token string) (string, bool) {
+	if len(token) > 5 && strings.EqualFold(token[:5], dpopHeader+" ") {
+		return token[5:], true
+	}
+	return token, false
+}
+
+// dpopBoundKey returns the thumbprint of the key a token is bound to, from
+// its "cnf" claim.
+func dpopBoundKey(claims jwt.MapClaims) string {
+	cnf, _ := claims["cnf"].(map[string]interface{})
+	jkt, _ := cnf["jkt"].(string)
+	return jkt
+}
+
+func (k *JWTMiddleware) dpopAlgorithmAllowed(alg string) bool {
+	allowed := k.Spec.JWTDPoP.AllowedAlgorithms
+	if len(allowed) == 0 {
+		allowed = dpopDefaultAlgorithms
+	}
+	for _, a := range allowed {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// dpopRequestURL returns the URL of the request the proof must be for,
+// without its query. The scheme clients used is only taken from the
+// forwarding headers of the trusted proxies of the client_ip configuration.
+func dpopRequestURL(r *http.Request) *url.URL {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if resolver := request.ConfiguredClientIPResolver(); resolver != nil {
+		scheme = resolver.Scheme(r)
+	}
+	return &url.URL{Scheme: scheme, Host: r.Host, Path: r.URL.Path}
+}
+
+// validateDPoP checks the DPoP proof of a request authenticated with
+// rawJWT, following RFC 9449. dpopScheme is whether the token was sent with
+// the DPoP authorization scheme.
+func (k *JWTMiddleware) validateDPoP(r *http.Request, rawJWT string, dpopScheme bool, claims jwt.MapClaims) error {
+	conf := k.Spec.JWTDPoP
+	jkt := dpopBoundKey(claims)
+
+	proofs := r.Header[http.CanonicalHeaderKey(dpopHeader)]
+	if !dpopScheme && jkt == "" && len(proofs) == 0 {
+		if conf.Required {
+			return errDPoPRequired
+		}
+		// a bearer token
+		return nil
+	}
+	if len(proofs) == 0 {
+		return errDPoPMissing
+	}
+	if len(proofs) > 1 {
+		return errDPoPMalformed
+	}
+	if jkt == "" {
+		return errDPoPUnbound
+	}
+
+	jws, err := jose.ParseSigned(proofs[0])
+	if err != nil || len(jws.Signatures) != 1 {
+		return errDPoPMalformed
+	}
+	header := jws.Signatures[0].Header
+	if typ, _ := header.ExtraHeaders[jose.HeaderType].(string); typ != dpopProofType {
+		return errDPoPMalformed
+	}
+	if !k.dpopAlgorithmAllowed(header.Algorithm) {
+		return errDPoPAlgorithm
+	}
+	if header.JSONWebKey == nil || !header.JSONWebKey.IsPublic() {
+		return errDPoPMalformed
+	}
+
+	payload, err := jws.Verify(header.JSONWebKey)
+	if err != nil {
+		return errDPoPInvalid
+	}
+	var proof dpopClaims
+	if err := json.Unmarshal(payload, &proof); err != nil || proof.JTI == "" {
+		return errDPoPMalformed
+	}
+
+	if proof.HTM != r.Method {
+		return errDPoPInvalid
+	}
+	htu, err := url.Parse(proof.HTU)
+	reqURL := dpopRequestURL(r)
+	if err != nil || !strings.EqualFold(htu.Scheme, reqURL.Scheme) ||
+		!strings.EqualFold(htu.Host, reqURL.Host) || htu.Path != reqURL.Path {
+		return errDPoPInvalid
+	}
+
+	ath := sha256.Sum256([]byte(rawJWT))
+	if proof.ATH != base64.RawURLEncoding.EncodeToString(ath[:]) {
+		return errDPoPInvalid
+	}
+
+	thumbprint, err := header.JSONWebKey.Thumbprint(crypto.SHA256)
+	if err != nil || base64.RawURLEncoding.EncodeToString(thumbprint) != jkt {
+		return errDPoPUnbound
+	}
+
+	maxAge := conf.MaxAge
+	if maxAge <= 0 {
+		maxAge = dpopDefaultMaxAge
+	}
+	if age := time.Now().Unix() - proof.IAT; age > maxAge || age < -maxAge {
+		return errDPoPExpired
+	}
+
+	// proofs are valid for twice their max age, as they may be issued
+	// that much in the future
+	jtiHash := sha256.Sum256([]byte(proof.JTI))
+	replayKey := dpopReplayStore.GetKeyPrefix() + k.Spec.APIID + "-" + base64.RawURLEncoding.EncodeToString(jtiHash[:])
+	seen, err := incrementRawKey(dpopReplayStore, replayKey, 2*maxAge)
+	if err != nil {
+		log.WithError(err).Error("Couldn't record the DPoP proof")
+		return errDPoPUnavailable
+	}
+	if seen > 1 {
+		return errDPoPReplayed
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package gateway
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	uuid "github.com/satori/go.uuid"
+	jose "github.com/square/go-jose"
+
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// createDPoPProof returns a DPoP proof of key for a request to htu.
+func createDPoPProof(t *testing.T, key *ecdsa.PrivateKey, htm, htu, accessToken string, iat time.Time) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key},
+		(&jose.SignerOptions{EmbedJWK: true}).WithType(dpopProofType))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ath := sha256.Sum256([]byte(accessToken))
+	payload, _ := json.Marshal(dpopClaims{
+		JTI: uuid.NewV4().String(),
+		HTM: htm,
+		HTU: htu,
+		IAT: iat.Unix(),
+		ATH: base64.RawURLEncoding.EncodeToString(ath[:]),
+	})
+	obj, err := signer.Sign(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := obj.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
+
+func TestJWTDPoP(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	spec := BuildAndLoadAPI(func(spec *APISpec) {
+		spec.OrgID = "default"
+		spec.UseKeylessAccess = false
+		spec.EnableJWT = true
+		spec.JWTSigningMethod = HMACSign
+		spec.JWTSource = base64.StdEncoding.EncodeToString([]byte("secret"))
+		spec.JWTPolicyFieldName = "pol"
+		spec.JWTDPoP.Enabled = true
+		spec.Proxy.ListenPath = "/dpop/"
+	})[0]
+	policyID := CreatePolicy(func(p *user.Policy) {
+		p.AccessRights = map[string]user.AccessDefinition{
+			spec.APIID: {APIID: spec.APIID, Versions: []string{"default"}},
+		}
+	})
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	thumbprint, _ := (&jose.JSONWebKey{Key: key.Public()}).Thumbprint(crypto.SHA256)
+
+	accessToken := func(bound bool) string {
+		claims := jwt.MapClaims{
+			"sub": "user",
+			"pol": policyID,
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		if bound {
+			claims["cnf"] = map[string]string{"jkt": base64.RawURLEncoding.EncodeToString(thumbprint)}
+		}
+		signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		return signed
+	}
+
+	bound, unbound := accessToken(true), accessToken(false)
+	htu := ts.URL + "/dpop/get"
+	proof := createDPoPProof(t, key, http.MethodGet, htu, bound, time.Now())
+
+	dpop := func(token, proof string) map[string]string {
+		return map[string]string{"Authorization": "DPoP " + token, "DPoP": proof}
+	}
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/dpop/get", Headers: dpop(bound, proof), Code: http.StatusOK},
+		{Path: "/dpop/get", Headers: dpop(bound, proof), Code: http.StatusUnauthorized, BodyMatch: "already been used"},
+		{Path: "/dpop/get", Headers: map[string]string{"Authorization": "Bearer " + bound}, Code: http.StatusUnauthorized,
+			BodyMatch: "proof is missing"},
+		{Path: "/dpop/get", Headers: map[string]string{"Authorization": "Bearer " + unbound}, Code: http.StatusOK},
+		{Path: "/dpop/get", Headers: dpop(bound, createDPoPProof(t, otherKey, http.MethodGet, htu, bound, time.Now())),
+			Code: http.StatusUnauthorized, BodyMatch: "not bound"},
+		{Path: "/dpop/get", Headers: dpop(bound, createDPoPProof(t, key, http.MethodPost, htu, bound, time.Now())),
+			Code: http.StatusUnauthorized, BodyMatch: "proof is invalid"},
+		{Path: "/dpop/get", Headers: dpop(bound, createDPoPProof(t, key, http.MethodGet, ts.URL+"/other", bound, time.Now())),
+			Code: http.StatusUnauthorized, BodyMatch: "proof is invalid"},
+		{Path: "/dpop/get", Headers: dpop(bound, createDPoPProof(t, key, http.MethodGet, htu, unbound, time.Now())),
+			Code: http.StatusUnauthorized, BodyMatch: "proof is invalid"},
+		{Path: "/dpop/get", Headers: dpop(bound, createDPoPProof(t, key, http.MethodGet, htu, bound, time.Now().Add(-time.Hour))),
+			Code: http.StatusUnauthorized, BodyMatch: "too old"},
+	}...)
+
+	t.Run("Replay store unavailable", func(t *testing.T) {
+		store := dpopReplayStore
+		dpopReplayStore = unavailableStore{store}
+		defer func() { dpopReplayStore = store }()
+
+		_, _ = ts.Run(t, test.TestCase{Path: "/dpop/get", Headers: dpop(bound, createDPoPProof(t, key, http.MethodGet, htu, bound, time.Now())),
+			Code: http.StatusServiceUnavailable})
+	})
+
+	t.Run("Required", func(t *testing.T) {
+		spec.JWTDPoP.Required = true
+		LoadAPI(spec)
+
+		_, _ = ts.Run(t, test.TestCase{Path: "/dpop/get", Headers: map[string]string{"Authorization": "Bearer " + unbound},
+			Code: http.StatusUnauthorized, BodyMatch: "proof is required"})
+	})
+}
@@ -45,6 +45,10 @@ func (k *KeyExpired) ProcessRequest(w http.ResponseWriter, r *http.Request, _ in
 		return errors.New("Key is inactive, please renew"), http.StatusForbidden
 	}
 
+	if err := checkSessionIP(k, r, session, token); err != nil {
+		return err, http.StatusForbidden
+	}
+
 	if !k.Spec.AuthManager.KeyExpired(session) {
 		return nil, http.StatusOK
 	}
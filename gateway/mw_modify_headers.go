@@ -4,7 +4,6 @@ import (
 	"net/http"
 
 	"github.com/TykTechnologies/tyk/apidef"
-	"github.com/TykTechnologies/tyk/config"
 )
 
 // TransformMiddleware is a middleware that will apply a template to a request body to transform it's contents ready for an upstream API
@@ -38,10 +37,10 @@ func (t *TransformHeaders) ProcessRequest(w http.ResponseWriter, r *http.Request
 	}
 
 	// Add
-	ignoreCanonical := config.Global().IgnoreCanonicalMIMEHeaderKey
+	casing := t.Spec.headerCasing()
 	for nKey, nVal := range vInfo.GlobalHeaders {
 		t.Logger().Debug("Adding: ", nKey)
-		setCustomHeader(r.Header, nKey, replaceTykVariables(r, nVal, false), ignoreCanonical)
+		setCustomHeader(r.Header, nKey, replaceTykVariables(r, nVal, false), casing)
 	}
 
 	found, meta := t.Spec.CheckSpecMatchesStatus(r, versionPaths, HeaderInjected)
@@ -51,7 +50,7 @@ func (t *TransformHeaders) ProcessRequest(w http.ResponseWriter, r *http.Request
 			r.Header.Del(dKey)
 		}
 		for nKey, nVal := range hmeta.AddHeaders {
-			setCustomHeader(r.Header, nKey, replaceTykVariables(r, nVal, false), ignoreCanonical)
+			setCustomHeader(r.Header, nKey, replaceTykVariables(r, nVal, false), casing)
 		}
 	}
 
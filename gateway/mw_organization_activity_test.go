@@ -89,6 +89,48 @@ func TestProcessRequestLiveQuotaLimit(t *testing.T) {
 	})
 }
 
+func TestOrgUsageAndResetQuota(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.EnforceOrgQuotas = true
+	globalConf.ExperimentalProcessOrgOffThread = false
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	data := map[string]interface{}{
+		"quota_max":          3,
+		"quota_remaining":    3,
+		"quota_renewal_rate": 3600,
+	}
+	testPrepareProcessRequestQuotaLimit(t, ts, data)
+	orgID := data["org_id"].(string)
+
+	ts.Run(t, []test.TestCase{
+		{Code: http.StatusOK},
+		{Code: http.StatusOK},
+		{Code: http.StatusOK},
+		{Code: http.StatusForbidden},
+		{
+			Path: "/tyk/org/keys/" + orgID + "/usage", AdminAuth: true, Code: http.StatusOK,
+			BodyMatch: `"quota_max":3,"quota_used":4,"quota_remaining":0`,
+		},
+		{Path: "/tyk/org/keys/unknown-org/usage", AdminAuth: true, Code: http.StatusNotFound},
+		{
+			Method: http.MethodPost, Path: "/tyk/org/keys/" + orgID + "/reset_quota", AdminAuth: true, Code: http.StatusOK,
+			BodyMatch: `"action":"quota reset"`,
+		},
+		{
+			Path: "/tyk/org/keys/" + orgID + "/usage", AdminAuth: true, Code: http.StatusOK,
+			BodyMatch: `"quota_max":3,"quota_used":0,"quota_remaining":3`,
+		},
+		{Code: http.StatusOK},
+		// the org session is left untouched
+		{Path: "/tyk/org/keys/" + orgID, AdminAuth: true, Code: http.StatusOK, BodyMatch: `"quota_max":3`},
+	}...)
+}
+
 func BenchmarkProcessRequestLiveQuotaLimit(b *testing.B) {
 	b.ReportAllocs()
 
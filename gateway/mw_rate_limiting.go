@@ -3,11 +3,15 @@ package gateway
 import (
 	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/TykTechnologies/tyk/headers"
 	"github.com/TykTechnologies/tyk/request"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
 )
 
 var sessionLimiter = SessionLimiter{}
@@ -61,6 +65,23 @@ func (k *RateLimitAndQuotaCheck) handleQuotaFailure(r *http.Request, token strin
 	return errors.New("Quota exceeded"), http.StatusForbidden
 }
 
+// setRateLimitHeaders tells the client the state of its rate limit, so that
+// it can slow down before being rejected.
+func (k *RateLimitAndQuotaCheck) setRateLimitHeaders(w http.ResponseWriter, r *http.Request, session *user.SessionState, token string, store storage.Handler, limited bool) {
+	status, ok := sessionLimiter.RateLimitStatus(r, session, token, store, &k.Spec.GlobalConfig, k.Spec)
+	if !ok {
+		return
+	}
+	if limited {
+		status.Remaining = 0
+		w.Header().Set(headers.RetryAfter, strconv.FormatInt(status.Reset, 10))
+	}
+
+	w.Header().Set(headers.RateLimitLimit, strconv.FormatInt(status.Limit, 10))
+	w.Header().Set(headers.RateLimitRemaining, strconv.FormatInt(status.Remaining, 10))
+	w.Header().Set(headers.RateLimitReset, strconv.FormatInt(status.Reset, 10))
+}
+
 // ProcessRequest will run any checks on the request on the way through the system, return an error to have the chain fail
 func (k *RateLimitAndQuotaCheck) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
 	if ctxGetRequestStatus(r) == StatusOkAndIgnore {
@@ -75,6 +96,12 @@ func (k *RateLimitAndQuotaCheck) ProcessRequest(w http.ResponseWriter, r *http.R
 	session := ctxGetSession(r)
 	token := ctxGetAuthToken(r)
 
+	if !k.Spec.DisableRateLimit {
+		if _, ok := rateLimitKeyScope(r, k.Spec); !ok {
+			return errors.New("Rate limit key missing"), http.StatusBadRequest
+		}
+	}
+
 	storeRef := GlobalSessionManager.Store()
 	reason := sessionLimiter.ForwardMessage(
 		r,
@@ -100,6 +127,10 @@ func (k *RateLimitAndQuotaCheck) ProcessRequest(w http.ResponseWriter, r *http.R
 		}
 	}
 
+	if k.Spec.EnableRateLimitHeaders && !k.Spec.DisableRateLimit {
+		k.setRateLimitHeaders(w, r, session, token, storeRef, reason == sessionFailRateLimit)
+	}
+
 	switch reason {
 	case sessionFailNone:
 	case sessionFailRateLimit:
@@ -131,9 +162,11 @@ func (k *RateLimitAndQuotaCheck) ProcessRequest(w http.ResponseWriter, r *http.R
 				}
 
 				if reason == sessionFailNone {
+					w.Header().Set(headers.XThrottledRetries, strconv.Itoa(ctxThrottleLevel(r)))
 					return k.ProcessRequest(w, r, nil)
 				}
 			}
+			w.Header().Set(headers.XThrottledRetries, strconv.Itoa(ctxThrottleLevel(r)))
 		}
 		return err, errCode
 
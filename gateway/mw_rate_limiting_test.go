@@ -2,11 +2,16 @@ package gateway
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/gorilla/mux"
 	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
 	"github.com/TykTechnologies/tyk/headers"
 	"github.com/TykTechnologies/tyk/test"
 	"github.com/TykTechnologies/tyk/user"
@@ -106,6 +111,188 @@ func TestNeverRenewQuota(t *testing.T) {
 
 }
 
+func TestRateLimitHeaders(t *testing.T) {
+	g := StartTest()
+	defer g.Close()
+
+	DRLManager.SetCurrentTokenValue(1)
+	DRLManager.RequestTokenValue = 1
+	defer func() {
+		DRLManager.SetCurrentTokenValue(0)
+		DRLManager.RequestTokenValue = 0
+	}()
+
+	api := BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.UseKeylessAccess = false
+		spec.EnableRateLimitHeaders = true
+	})[0]
+
+	createKey := func() map[string]string {
+		_, key := g.CreateSession(func(s *user.SessionState) {
+			s.AccessRights = map[string]user.AccessDefinition{
+				api.APIID: {
+					APIName: api.Name,
+					APIID:   api.APIID,
+				},
+			}
+			s.Rate = 2
+			s.Per = 60
+		})
+		return map[string]string{headers.Authorization: key}
+	}
+
+	t.Run("DRL", func(t *testing.T) {
+		authHeader := createKey()
+
+		_, _ = g.Run(t, []test.TestCase{
+			{Headers: authHeader, Code: http.StatusOK, HeadersMatch: map[string]string{
+				headers.RateLimitLimit:     "2",
+				headers.RateLimitRemaining: "1",
+			}, HeadersNotMatch: map[string]string{headers.RateLimitReset: ""}},
+			{Headers: authHeader, Code: http.StatusOK, HeadersMatch: map[string]string{
+				headers.RateLimitRemaining: "0",
+			}},
+			{Headers: authHeader, Code: http.StatusTooManyRequests, HeadersMatch: map[string]string{
+				headers.RateLimitRemaining: "0",
+			}, HeadersNotMatch: map[string]string{headers.RetryAfter: ""}},
+		}...)
+	})
+
+	t.Run("Redis rolling window", func(t *testing.T) {
+		globalConf := config.Global()
+		globalConf.EnableRedisRollingLimiter = true
+		config.SetGlobal(globalConf)
+		defer func() {
+			globalConf.EnableRedisRollingLimiter = false
+			config.SetGlobal(globalConf)
+		}()
+
+		authHeader := createKey()
+
+		_, _ = g.Run(t, []test.TestCase{
+			{Headers: authHeader, Code: http.StatusOK, HeadersMatch: map[string]string{
+				headers.RateLimitLimit:     "2",
+				headers.RateLimitRemaining: "1",
+				headers.RateLimitReset:     "60",
+			}},
+			{Headers: authHeader, Code: http.StatusOK, HeadersMatch: map[string]string{
+				headers.RateLimitRemaining: "0",
+			}},
+			{Headers: authHeader, Code: http.StatusTooManyRequests, HeadersMatch: map[string]string{
+				headers.RateLimitRemaining: "0",
+				headers.RetryAfter:         "60",
+			}},
+		}...)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		api = BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/"
+			spec.UseKeylessAccess = false
+		})[0]
+
+		_, _ = g.Run(t, test.TestCase{Headers: createKey(), Code: http.StatusOK, HeadersMatch: map[string]string{
+			headers.RateLimitLimit: "",
+		}})
+	})
+}
+
+func TestRateLimitKey(t *testing.T) {
+	g := StartTest()
+	defer g.Close()
+
+	DRLManager.SetCurrentTokenValue(1)
+	DRLManager.RequestTokenValue = 1
+	defer func() {
+		DRLManager.SetCurrentTokenValue(0)
+		DRLManager.RequestTokenValue = 0
+	}()
+
+	api := BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.UseKeylessAccess = false
+		spec.RateLimitKey = apidef.RateLimitKeyMeta{
+			Enabled: true,
+			Source:  attributeHeader,
+			Name:    "X-Tenant",
+			Rate:    1,
+			Per:     60,
+		}
+	})[0]
+
+	_, key := g.CreateSession(func(s *user.SessionState) {
+		s.AccessRights = map[string]user.AccessDefinition{
+			api.APIID: {
+				APIName: api.Name,
+				APIID:   api.APIID,
+			},
+		}
+		s.Rate = 3
+		s.Per = 60
+	})
+
+	tenant := func(name string) map[string]string {
+		return map[string]string{headers.Authorization: key, "X-Tenant": name}
+	}
+
+	_, _ = g.Run(t, []test.TestCase{
+		{Headers: tenant("acme"), Code: http.StatusOK},
+		{Headers: tenant("acme"), Code: http.StatusTooManyRequests},
+		{Headers: tenant("globex"), Code: http.StatusOK},
+		{Headers: tenant("globex"), Code: http.StatusTooManyRequests},
+		// without a valid tenant, the key is counted on its own
+		{Headers: tenant("not a tenant"), Code: http.StatusOK},
+		// the limit of the key applies to all tenants together
+		{Headers: tenant("initech"), Code: http.StatusTooManyRequests},
+		{Headers: map[string]string{headers.Authorization: key}, Code: http.StatusTooManyRequests},
+	}...)
+
+	t.Run("reject requests without a tenant", func(t *testing.T) {
+		api.RateLimitKey.Fallback = rateLimitKeyFallbackReject
+		LoadAPI(api)
+
+		_, _ = g.Run(t, test.TestCase{
+			Headers: map[string]string{headers.Authorization: key}, Code: http.StatusBadRequest,
+			BodyMatch: "Rate limit key missing",
+		})
+	})
+}
+
+func TestRateLimitKeyValue(t *testing.T) {
+	spec := &APISpec{APIDefinition: &apidef.APIDefinition{}}
+	spec.Proxy.ListenPath = "/api/"
+
+	r := httptest.NewRequest(http.MethodGet, "/api/tenants/acme/orders", nil)
+	r.Header.Set("X-Tenant", "globex")
+	r = mux.SetURLVars(r, map[string]string{"tenantID": "initech"})
+	ctxSetData(r, map[string]interface{}{"jwt_claims_tenant": "umbrella"})
+
+	tests := []struct {
+		conf     apidef.RateLimitKeyMeta
+		expected string
+	}{
+		{apidef.RateLimitKeyMeta{Source: attributeHeader, Name: "X-Tenant"}, "globex"},
+		{apidef.RateLimitKeyMeta{Source: attributePathSegment, Index: 1}, "acme"},
+		{apidef.RateLimitKeyMeta{Source: attributePathSegment, Index: 5}, ""},
+		{apidef.RateLimitKeyMeta{Source: attributePathParam, Name: "tenantID"}, "initech"},
+		{apidef.RateLimitKeyMeta{Source: attributeJWTClaim, Name: "tenant"}, "umbrella"},
+		{apidef.RateLimitKeyMeta{Source: attributeHeader, Name: "X-Missing"}, ""},
+	}
+	for _, tc := range tests {
+		spec.RateLimitKey = tc.conf
+		assert.Equal(t, tc.expected, rateLimitKeyValue(r, spec), tc.conf.Source)
+	}
+}
+
+func TestValidRateLimitKeyValue(t *testing.T) {
+	assert.True(t, validRateLimitKeyValue("acme-eu_1.prod"))
+	assert.False(t, validRateLimitKeyValue(""))
+	assert.False(t, validRateLimitKeyValue("acme corp"))
+	assert.False(t, validRateLimitKeyValue("acme:*"))
+	assert.False(t, validRateLimitKeyValue(strings.Repeat("a", maxRateLimitKeyValueLen+1)))
+}
+
 func TestMwRateLimiting_DepthLimit(t *testing.T) {
 	g := StartTest()
 	defer g.Close()
@@ -13,12 +13,14 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/singleflight"
 
 	"github.com/TykTechnologies/murmur3"
-	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/ctx"
 	"github.com/TykTechnologies/tyk/headers"
 	"github.com/TykTechnologies/tyk/regexp"
 	"github.com/TykTechnologies/tyk/request"
@@ -28,14 +30,30 @@ import (
 const (
 	upstreamCacheHeader    = "x-tyk-cache-action-set"
 	upstreamCacheTTLHeader = "x-tyk-cache-action-set-ttl"
+
+	defaultStaleGracePeriod = 3600
 )
 
+// staleResponse serves the expired cached response of a request, when the
+// upstream failed to give a fresh one for reason.
+type staleResponse func(w http.ResponseWriter, reason string)
+
 // RedisCacheMiddleware is a caching middleware that will pull data from Redis instead of the upstream proxy
 type RedisCacheMiddleware struct {
 	BaseMiddleware
 	CacheStore   storage.Handler
 	sh           SuccessHandler
 	singleFlight singleflight.Group
+
+	coalesceMu sync.Mutex
+	coalescing map[string]*coalescedResponse
+}
+
+// coalescedResponse is the response of a request that identical requests
+// made while it is in flight wait for.
+type coalescedResponse struct {
+	done     chan struct{}
+	response string
 }
 
 func (m *RedisCacheMiddleware) Name() string {
@@ -44,6 +62,7 @@ func (m *RedisCacheMiddleware) Name() string {
 
 func (m *RedisCacheMiddleware) Init() {
 	m.sh = SuccessHandler{m.BaseMiddleware}
+	m.coalescing = make(map[string]*coalescedResponse)
 }
 
 func (m *RedisCacheMiddleware) EnabledForSpec() bool {
@@ -196,6 +215,12 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 	if stat != StatusCached {
 		return nil, http.StatusOK
 	}
+
+	isRangeRequest := r.Method == http.MethodGet && r.Header.Get("Range") != ""
+	if isRangeRequest && m.Spec.CacheOptions.BypassRangeRequests {
+		return nil, http.StatusOK
+	}
+
 	token := ctxGetAuthToken(r)
 
 	// No authentication data? use the IP.
@@ -221,108 +246,265 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 		if !errCreatingChecksum {
 			log.Debug("Cache enabled, but record not found")
 		}
-		// Pass through to proxy AND CACHE RESULT
-
-		var resVal *http.Response
-		if isVirtual {
-			log.Debug("This is a virtual function")
-			vp := VirtualEndpoint{BaseMiddleware: m.BaseMiddleware}
-			vp.Init()
-			resVal = vp.ServeHTTPForCache(w, r, nil)
-		} else {
-			// This passes through and will write the value to the writer, but spit out a copy for the cache
-			log.Debug("Not virtual, passing")
-			if newURL := ctxGetURLRewriteTarget(r); newURL != nil {
-				r.URL = newURL
-				ctxSetURLRewriteTarget(r, nil)
-			}
-			if newMethod := ctxGetTransformRequestMethod(r); newMethod != "" {
-				r.Method = newMethod
-				ctxSetTransformRequestMethod(r, "")
+
+		if key != "" && cacheMeta != nil && cacheMeta.CoalesceRequests && isSafeMethod(r.Method) && !isRangeRequest {
+			// identical requests of different clients wait for the same
+			// response, which is only shared when it is public
+			coalesceKey, err := m.CreateCheckSum(r, "", cacheKeyRegex, m.getCacheKeyFromHeaders(r))
+			if err == nil {
+				return m.coalesce(w, r, key, coalesceKey, cacheMeta, isVirtual)
 			}
-			sr := m.sh.ServeHTTPWithCache(w, r)
-			resVal = sr.Response
 		}
 
-		cacheThisRequest := true
-		cacheTTL := m.Spec.CacheOptions.CacheTimeout
+		m.fetchAndCache(w, r, key, cacheMeta, isVirtual, false)
+		return nil, mwStatusRespond
+	}
 
-		if resVal == nil {
-			log.Warning("Upstream request must have failed, response is empty")
+	cachedData, timestamp, err := m.decodePayload(retBlob)
+	if err != nil {
+		// Tere was an issue with this cache entry - lets remove it:
+		m.CacheStore.DeleteKey(key)
+		return nil, http.StatusOK
+	}
+
+	if m.isTimeStampExpired(timestamp) || len(cachedData) == 0 {
+		if m.Spec.CacheOptions.ServeStaleOnError && cachedStatusOK(cachedData) {
+			// keep the expired response until it is replaced, to serve
+			// it if the upstream fails
+			ctxSetStaleResponse(r, m.staleResponse(r, cachedData, isRangeRequest))
+			m.fetchAndCache(w, r, key, cacheMeta, isVirtual, false)
 			return nil, mwStatusRespond
 		}
+		m.CacheStore.DeleteKey(key)
+		return nil, http.StatusOK
+	}
+
+	log.Debug("Cache got: ", cachedData)
+	return m.serveStoredResponse(w, r, cachedData, isRangeRequest)
+}
 
-		cacheOnlyResponseCodes := m.Spec.CacheOptions.CacheOnlyResponseCodes
-		// override api main CacheOnlyResponseCodes by endpoint specific if provided
-		if cacheMeta != nil && len(cacheMeta.CacheOnlyResponseCodes) > 0 {
-			cacheOnlyResponseCodes = cacheMeta.CacheOnlyResponseCodes
+// coalesce makes identical requests made while a first one is in flight wait
+// for its response, up to the max wait of the endpoint, instead of all calling
+// the upstream. Requests are told apart by coalesceKey, which doesn't depend
+// on their client, and responses are cached under the key of their own.
+func (m *RedisCacheMiddleware) coalesce(w http.ResponseWriter, r *http.Request, key, coalesceKey string, cacheMeta *EndPointCacheMeta, isVirtual bool) (error, int) {
+	m.coalesceMu.Lock()
+	inFlight, found := m.coalescing[coalesceKey]
+	if !found {
+		inFlight = &coalescedResponse{done: make(chan struct{})}
+		m.coalescing[coalesceKey] = inFlight
+	}
+	m.coalesceMu.Unlock()
+
+	if !found {
+		// the waiting requests are released even if the request panics
+		defer func() {
+			m.coalesceMu.Lock()
+			delete(m.coalescing, coalesceKey)
+			m.coalesceMu.Unlock()
+			close(inFlight.done)
+		}()
+		inFlight.response = m.fetchAndCache(w, r, key, cacheMeta, isVirtual, true)
+		return nil, mwStatusRespond
+	}
+
+	var timeout <-chan time.Time
+	if cacheMeta.CoalesceMaxWait > 0 {
+		timer := time.NewTimer(time.Duration(cacheMeta.CoalesceMaxWait * float64(time.Second)))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-inFlight.done:
+		if inFlight.response != "" {
+			log.Debug("Serving coalesced response")
+			return m.serveStoredResponse(w, r, inFlight.response, false)
 		}
+	case <-timeout:
+		log.Debug("Coalesced request waited too long, passing")
+	}
 
-		// make sure the status codes match if specified
-		if len(cacheOnlyResponseCodes) > 0 {
-			foundCode := false
-			for _, code := range cacheOnlyResponseCodes {
-				if code == resVal.StatusCode {
-					foundCode = true
-					break
-				}
+	m.fetchAndCache(w, r, key, cacheMeta, isVirtual, false)
+	return nil, mwStatusRespond
+}
+
+// fetchAndCache passes the request through to the upstream, and caches the
+// response if it should be. It returns the response in wire format if it was
+// cached and, for a coalesced request, can be shared with the requests
+// waiting for it, an empty string otherwise.
+func (m *RedisCacheMiddleware) fetchAndCache(w http.ResponseWriter, r *http.Request, key string, cacheMeta *EndPointCacheMeta, isVirtual, coalesced bool) string {
+	// Pass through to proxy AND CACHE RESULT
+
+	var resVal *http.Response
+	if isVirtual {
+		log.Debug("This is a virtual function")
+		vp := VirtualEndpoint{BaseMiddleware: m.BaseMiddleware}
+		vp.Init()
+		resVal = vp.ServeHTTPForCache(w, r, nil)
+	} else {
+		// This passes through and will write the value to the writer, but spit out a copy for the cache
+		log.Debug("Not virtual, passing")
+		applyDeferredRequestChanges(r)
+		sr := m.sh.ServeHTTPWithCache(w, r)
+		resVal = sr.Response
+	}
+
+	cacheThisRequest := true
+	cacheTTL := m.Spec.CacheOptions.CacheTimeout
+
+	if resVal == nil {
+		log.Warning("Upstream request must have failed, response is empty")
+		return ""
+	}
+	if servedFallback(r) {
+		return ""
+	}
+
+	cacheOnlyResponseCodes := m.Spec.CacheOptions.CacheOnlyResponseCodes
+	// override api main CacheOnlyResponseCodes by endpoint specific if provided
+	if cacheMeta != nil && len(cacheMeta.CacheOnlyResponseCodes) > 0 {
+		cacheOnlyResponseCodes = cacheMeta.CacheOnlyResponseCodes
+	}
+
+	// make sure the status codes match if specified
+	if len(cacheOnlyResponseCodes) > 0 {
+		foundCode := false
+		for _, code := range cacheOnlyResponseCodes {
+			if code == resVal.StatusCode {
+				foundCode = true
+				break
 			}
-			cacheThisRequest = foundCode
 		}
+		cacheThisRequest = foundCode
+	}
 
-		// Are we using upstream cache control?
-		if m.Spec.CacheOptions.EnableUpstreamCacheControl {
-			log.Debug("Upstream control enabled")
-			// Do we cache?
-			if resVal.Header.Get(upstreamCacheHeader) == "" {
-				log.Warning("Upstream cache action not found, not caching")
-				cacheThisRequest = false
-			}
+	// Are we using upstream cache control?
+	if m.Spec.CacheOptions.EnableUpstreamCacheControl {
+		log.Debug("Upstream control enabled")
+		// Do we cache?
+		if resVal.Header.Get(upstreamCacheHeader) == "" {
+			log.Warning("Upstream cache action not found, not caching")
+			cacheThisRequest = false
+		}
 
-			cacheTTLHeader := upstreamCacheTTLHeader
-			if m.Spec.CacheOptions.CacheControlTTLHeader != "" {
-				cacheTTLHeader = m.Spec.CacheOptions.CacheControlTTLHeader
-			}
+		cacheTTLHeader := upstreamCacheTTLHeader
+		if m.Spec.CacheOptions.CacheControlTTLHeader != "" {
+			cacheTTLHeader = m.Spec.CacheOptions.CacheControlTTLHeader
+		}
 
-			ttl := resVal.Header.Get(cacheTTLHeader)
-			if ttl != "" {
-				log.Debug("TTL Set upstream")
-				cacheAsInt, err := strconv.Atoi(ttl)
-				if err != nil {
-					log.Error("Failed to decode TTL cache value: ", err)
-					cacheTTL = m.Spec.CacheOptions.CacheTimeout
-				} else {
-					cacheTTL = int64(cacheAsInt)
-				}
+		ttl := resVal.Header.Get(cacheTTLHeader)
+		if ttl != "" {
+			log.Debug("TTL Set upstream")
+			cacheAsInt, err := strconv.Atoi(ttl)
+			if err != nil {
+				log.Error("Failed to decode TTL cache value: ", err)
+				cacheTTL = m.Spec.CacheOptions.CacheTimeout
+			} else {
+				cacheTTL = int64(cacheAsInt)
 			}
 		}
+	}
+
+	// Only full objects are cached, ranges are served from them
+	if resVal.StatusCode == http.StatusPartialContent {
+		cacheThisRequest = false
+	}
+
+	cacheThisRequest = cacheThisRequest && key != ""
+	if !cacheThisRequest {
+		return ""
+	}
+
+	var wireFormatReq bytes.Buffer
+	resVal.Write(&wireFormatReq)
+
+	log.Debug("Caching request to redis")
+	log.Debug("Cache TTL is:", cacheTTL)
+	ts := m.getTimeTTL(cacheTTL)
+	toStore := m.encodePayload(wireFormatReq.String(), ts)
+	go m.CacheStore.SetKey(key, toStore, cacheTTL+m.staleGracePeriod())
+
+	if coalesced && !coalescable(resVal, ctxGetAuthToken(r) != "") {
+		return ""
+	}
+	return wireFormatReq.String()
+}
 
-		if cacheThisRequest && !errCreatingChecksum {
-			log.Debug("Caching request to redis")
-			var wireFormatReq bytes.Buffer
-			resVal.Write(&wireFormatReq)
-			log.Debug("Cache TTL is:", cacheTTL)
-			ts := m.getTimeTTL(cacheTTL)
-			toStore := m.encodePayload(wireFormatReq.String(), ts)
-			go m.CacheStore.SetKey(key, toStore, cacheTTL)
+// coalescable reports whether a response can be served to the requests that
+// waited for it, whatever their client: successful responses that aren't
+// specific to their client. The responses to authenticated requests must be
+// explicitly public, as in shared caches.
+func coalescable(res *http.Response, authenticated bool) bool {
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return false
+	}
+	if res.Header.Get(headers.SetCookie) != "" {
+		return false
+	}
+	public := false
+	for _, directive := range strings.Split(strings.ToLower(res.Header.Get(headers.CacheControl)), ",") {
+		directive = strings.TrimSpace(directive)
+		switch {
+		case directive == "private", directive == "no-store", directive == "no-cache":
+			return false
+		case directive == "public", strings.HasPrefix(directive, "s-maxage"):
+			public = true
 		}
+	}
+	return public || !authenticated
+}
 
-		return nil, mwStatusRespond
+// staleGracePeriod is how long, in seconds, responses are kept after they
+// expire, to be served if the upstream fails.
+func (m *RedisCacheMiddleware) staleGracePeriod() int64 {
+	if !m.Spec.CacheOptions.ServeStaleOnError {
+		return 0
+	}
+	if m.Spec.CacheOptions.StaleGracePeriod > 0 {
+		return m.Spec.CacheOptions.StaleGracePeriod
 	}
+	return defaultStaleGracePeriod
+}
 
-	cachedData, timestamp, err := m.decodePayload(retBlob)
-	if err != nil {
-		// Tere was an issue with this cache entry - lets remove it:
-		m.CacheStore.DeleteKey(key)
-		return nil, http.StatusOK
+// cachedStatusOK reports whether a response stored in wire format is a 200.
+func cachedStatusOK(cachedData string) bool {
+	statusLine := cachedData
+	if i := strings.IndexByte(statusLine, '\n'); i >= 0 {
+		statusLine = statusLine[:i]
 	}
+	fields := strings.Fields(statusLine)
+	return len(fields) > 1 && fields[1] == "200"
+}
 
-	if m.isTimeStampExpired(timestamp) || len(cachedData) == 0 {
-		m.CacheStore.DeleteKey(key)
-		return nil, http.StatusOK
+// staleResponse returns the function serving an expired cached response, with
+// a Warning header, when the upstream fails.
+func (m *RedisCacheMiddleware) staleResponse(r *http.Request, cachedData string, isRangeRequest bool) staleResponse {
+	return func(w http.ResponseWriter, reason string) {
+		log.WithFields(logrus.Fields{
+			"prefix": "cache",
+			"api_id": m.Spec.APIID,
+			"path":   r.URL.Path,
+			"reason": reason,
+		}).Warning("Serving a stale cached response")
+
+		ctx.AddAnalyticsTags(r, "stale-response")
+		m.FireEvent(EventStaleResponseServed, EventStaleResponseMeta{
+			EventMetaDefault: EventMetaDefault{Message: "Served a stale cached response", OriginatingRequest: EncodeRequestToEvent(r)},
+			Path:             r.URL.Path,
+			Origin:           request.RealIP(r),
+			APIID:            m.Spec.APIID,
+			Reason:           reason,
+		})
+
+		w.Header().Set(headers.Warning, `110 - "Response is Stale"`)
+		m.serveStoredResponse(w, r, cachedData, isRangeRequest)
 	}
+}
 
-	log.Debug("Cache got: ", cachedData)
+// serveStoredResponse writes a response that was stored in wire format,
+// instead of calling the upstream.
+func (m *RedisCacheMiddleware) serveStoredResponse(w http.ResponseWriter, r *http.Request, cachedData string, isRangeRequest bool) (error, int) {
 	bufData := bufio.NewReader(strings.NewReader(cachedData))
 	newRes, err := http.ReadResponse(bufData, r)
 	if err != nil {
@@ -335,7 +517,7 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 		newRes.Header.Del(h)
 	}
 
-	copyHeader(w.Header(), newRes.Header, config.Global().IgnoreCanonicalMIMEHeaderKey)
+	copyHeader(w.Header(), newRes.Header, m.Spec.headerCasing())
 	session := ctxGetSession(r)
 
 	// Only add ratelimit data to keyed sessions
@@ -347,17 +529,21 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 	}
 	w.Header().Set("x-tyk-cached-response", "1")
 
-	if reqEtag := r.Header.Get("If-None-Match"); reqEtag != "" {
-		if respEtag := newRes.Header.Get("Etag"); respEtag != "" {
-			if strings.Contains(reqEtag, respEtag) {
-				newRes.StatusCode = http.StatusNotModified
+	if isRangeRequest && newRes.StatusCode == http.StatusOK {
+		newRes.StatusCode = serveCachedRange(w, r, newRes)
+	} else {
+		if reqEtag := r.Header.Get("If-None-Match"); reqEtag != "" {
+			if respEtag := newRes.Header.Get("Etag"); respEtag != "" {
+				if strings.Contains(reqEtag, respEtag) {
+					newRes.StatusCode = http.StatusNotModified
+				}
 			}
 		}
-	}
 
-	w.WriteHeader(newRes.StatusCode)
-	if newRes.StatusCode != http.StatusNotModified {
-		m.Proxy.CopyResponse(w, newRes.Body)
+		w.WriteHeader(newRes.StatusCode)
+		if newRes.StatusCode != http.StatusNotModified {
+			m.Proxy.CopyResponse(w, newRes.Body)
+		}
 	}
 
 	// Record analytics
@@ -369,6 +555,40 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 	return nil, mwStatusRespond
 }
 
+// serveCachedRange serves the ranges requested by r from a cached full
+// response, and returns the status code sent.
+func serveCachedRange(w http.ResponseWriter, r *http.Request, res *http.Response) int {
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		log.Error("Could not read cached response body: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return http.StatusInternalServerError
+	}
+
+	modTime, _ := http.ParseTime(res.Header.Get("Last-Modified"))
+
+	// Content-Length of the full object, ServeContent sets the range length
+	w.Header().Del(headers.ContentLength)
+
+	cw := &customResponseWriter{ResponseWriter: w}
+	http.ServeContent(cw, r, "", modTime, bytes.NewReader(body))
+
+	return cw.statusCodeSent
+}
+
+// applyDeferredRequestChanges applies the URL rewrite and method transform
+// left for the proxy, for middlewares that proxy the request themselves.
+func applyDeferredRequestChanges(r *http.Request) {
+	if newURL := ctxGetURLRewriteTarget(r); newURL != nil {
+		r.URL = newURL
+		ctxSetURLRewriteTarget(r, nil)
+	}
+	if newMethod := ctxGetTransformRequestMethod(r); newMethod != "" {
+		r.Method = newMethod
+		ctxSetTransformRequestMethod(r, "")
+	}
+}
+
 func isSafeMethod(method string) bool {
 	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
 }
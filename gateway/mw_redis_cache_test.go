@@ -3,13 +3,21 @@ package gateway
 import (
 	"crypto/md5"
 	"encoding/hex"
+	"fmt"
 	"hash"
 	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 
 	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
 	"github.com/TykTechnologies/tyk/storage"
 	"github.com/TykTechnologies/tyk/test"
 )
@@ -68,6 +76,211 @@ func TestRedisCacheMiddleware_WithCompressedResponse(t *testing.T) {
 	})
 }
 
+func TestRedisCacheMiddleware_RangeRequests(t *testing.T) {
+	const content = "abcdefghijklmnopqrstuvwxyz"
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Etag", `"alphabet"`)
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer upstream.Close()
+
+	ts := StartTest()
+	defer ts.Close()
+	cache := storage.RedisCluster{KeyPrefix: "cache-"}
+	defer cache.DeleteScanMatch("*")
+
+	createAPI := func(withCache, bypassRange bool) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/"
+			spec.Proxy.TargetURL = upstream.URL
+			spec.CacheOptions = apidef.CacheOptions{
+				CacheTimeout:         60,
+				EnableCache:          withCache,
+				CacheAllSafeRequests: true,
+				BypassRangeRequests:  bypassRange,
+			}
+		})
+		cache.DeleteScanMatch("*")
+	}
+
+	headerCache := map[string]string{"x-tyk-cached-response": "1"}
+	rangeHeader := map[string]string{"Range": "bytes=0-4"}
+
+	t.Run("without cache", func(t *testing.T) {
+		createAPI(false, false)
+
+		ts.Run(t, test.TestCase{Path: "/", Headers: rangeHeader, Code: http.StatusPartialContent,
+			HeadersMatch: map[string]string{"Content-Range": "bytes 0-4/26"}, BodyMatch: "^abcde$"})
+	})
+
+	t.Run("partial responses are not cached", func(t *testing.T) {
+		createAPI(true, false)
+
+		ts.Run(t, []test.TestCase{
+			{Path: "/", Headers: rangeHeader, Code: http.StatusPartialContent, HeadersNotMatch: headerCache,
+				BodyMatch: "^abcde$", Delay: 10 * time.Millisecond},
+			{Path: "/", Code: http.StatusOK, HeadersNotMatch: headerCache, BodyMatch: "^" + content + "$"},
+		}...)
+	})
+
+	t.Run("ranges served from cache", func(t *testing.T) {
+		createAPI(true, false)
+
+		ts.Run(t, []test.TestCase{
+			{Path: "/", Code: http.StatusOK, HeadersNotMatch: headerCache, Delay: 10 * time.Millisecond},
+			{Path: "/", Code: http.StatusOK, HeadersMatch: headerCache, BodyMatch: "^" + content + "$"},
+			{Path: "/", Headers: map[string]string{"Range": "bytes=5-9"}, Code: http.StatusPartialContent,
+				HeadersMatch: map[string]string{"x-tyk-cached-response": "1", "Content-Range": "bytes 5-9/26", "Content-Length": "5"},
+				BodyMatch:    "^fghij$"},
+			{Path: "/", Headers: map[string]string{"Range": "bytes=-3"}, Code: http.StatusPartialContent,
+				HeadersMatch: map[string]string{"Content-Range": "bytes 23-25/26"}, BodyMatch: "^xyz$"},
+			{Path: "/", Headers: map[string]string{"Range": "bytes=0-4", "If-Range": `"other"`}, Code: http.StatusOK,
+				HeadersMatch: headerCache, BodyMatch: "^" + content + "$"},
+			{Path: "/", Headers: map[string]string{"Range": "bytes=100-"}, Code: http.StatusRequestedRangeNotSatisfiable,
+				HeadersMatch: map[string]string{"Content-Range": "bytes */26"}},
+		}...)
+	})
+
+	t.Run("bypass cache for ranges", func(t *testing.T) {
+		createAPI(true, true)
+
+		ts.Run(t, []test.TestCase{
+			{Path: "/", Code: http.StatusOK, HeadersNotMatch: headerCache, Delay: 10 * time.Millisecond},
+			{Path: "/", Code: http.StatusOK, HeadersMatch: headerCache},
+			{Path: "/", Headers: rangeHeader, Code: http.StatusPartialContent, HeadersNotMatch: headerCache,
+				HeadersMatch: map[string]string{"Content-Range": "bytes 0-4/26"}, BodyMatch: "^abcde$"},
+		}...)
+	})
+}
+
+func TestRedisCacheMiddleware_Coalescing(t *testing.T) {
+	var hits int32
+	arrived := make(chan struct{}, 10)
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit := atomic.AddInt32(&hits, 1)
+		arrived <- struct{}{}
+		<-release
+		fmt.Fprintf(w, "hit %d", hit)
+	}))
+	defer upstream.Close()
+
+	ts := StartTest()
+	defer ts.Close()
+	cache := storage.RedisCluster{KeyPrefix: "cache-"}
+	defer cache.DeleteScanMatch("*")
+
+	createAPI := func(maxWait float64) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/"
+			spec.Proxy.TargetURL = upstream.URL
+			spec.CacheOptions = apidef.CacheOptions{
+				CacheTimeout: 60,
+				EnableCache:  true,
+			}
+			UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+				v.UseExtendedPaths = true
+				v.ExtendedPaths.AdvanceCacheConfig = []apidef.CacheMeta{{
+					Method:           http.MethodGet,
+					Path:             "/",
+					CoalesceRequests: true,
+					CoalesceMaxWait:  maxWait,
+				}}
+			})
+		})
+		cache.DeleteScanMatch("*")
+		atomic.StoreInt32(&hits, 0)
+		release = make(chan struct{})
+	}
+
+	// run sends a first request and, once it reached the upstream, identical
+	// ones that wait for it
+	run := func(t *testing.T, followers int, followerCase test.TestCase) {
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ts.Run(t, test.TestCase{Path: "/", Code: http.StatusOK, BodyMatch: "^hit 1$"})
+		}()
+		<-arrived
+
+		for i := 0; i < followers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ts.Run(t, followerCase)
+			}()
+		}
+
+		// followers wait for the first request, or reached the upstream
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+		wg.Wait()
+	}
+
+	t.Run("coalesced", func(t *testing.T) {
+		createAPI(0)
+
+		run(t, 4, test.TestCase{Path: "/", Code: http.StatusOK, BodyMatch: "^hit 1$",
+			HeadersMatch: map[string]string{"x-tyk-cached-response": "1"}})
+		if hits := atomic.LoadInt32(&hits); hits != 1 {
+			t.Errorf("Expected one upstream call, got %d", hits)
+		}
+	})
+
+	t.Run("different clients", func(t *testing.T) {
+		createAPI(0)
+
+		run(t, 2, test.TestCase{Path: "/", Headers: map[string]string{"X-Real-IP": "10.0.0.2"}, Code: http.StatusOK,
+			BodyMatch: "^hit 1$", HeadersMatch: map[string]string{"x-tyk-cached-response": "1"}})
+		if hits := atomic.LoadInt32(&hits); hits != 1 {
+			t.Errorf("Expected the requests of other clients to be coalesced, got %d upstream calls", hits)
+		}
+	})
+
+	t.Run("max wait", func(t *testing.T) {
+		createAPI(0.01)
+
+		run(t, 2, test.TestCase{Path: "/", Code: http.StatusOK, BodyMatch: "^hit [23]$"})
+		for i := 0; i < 2; i++ {
+			<-arrived
+		}
+		if hits := atomic.LoadInt32(&hits); hits != 3 {
+			t.Errorf("Expected waiting requests to call the upstream, got %d calls", hits)
+		}
+	})
+}
+
+func Test_coalescable(t *testing.T) {
+	tests := []struct {
+		name          string
+		code          int
+		header        http.Header
+		authenticated bool
+		expected      bool
+	}{
+		{"OK", http.StatusOK, http.Header{}, false, true},
+		{"public", http.StatusOK, http.Header{"Cache-Control": {"public, max-age=60"}}, false, true},
+		{"error", http.StatusInternalServerError, http.Header{}, false, false},
+		{"not found", http.StatusNotFound, http.Header{}, false, false},
+		{"private", http.StatusOK, http.Header{"Cache-Control": {"max-age=60, Private"}}, false, false},
+		{"no-store", http.StatusOK, http.Header{"Cache-Control": {"no-store"}}, false, false},
+		{"cookie", http.StatusOK, http.Header{"Set-Cookie": {"session=1"}}, false, false},
+		{"authenticated", http.StatusOK, http.Header{}, true, false},
+		{"authenticated public", http.StatusOK, http.Header{"Cache-Control": {"public, max-age=60"}}, true, true},
+		{"authenticated s-maxage", http.StatusOK, http.Header{"Cache-Control": {"s-maxage=60"}}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &http.Response{StatusCode: tt.code, Header: tt.header}
+			if got := coalescable(res, tt.authenticated); got != tt.expected {
+				t.Errorf("coalescable() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
 func Test_isSafeMethod(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -151,3 +364,57 @@ func Test_addBodyHash(t *testing.T) {
 		})
 	}
 }
+
+func TestRedisCacheMiddleware_ServeStaleOnError(t *testing.T) {
+	var down int32
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprintf(w, "hit %d", atomic.AddInt32(&hits, 1))
+	}))
+	defer upstream.Close()
+
+	ts := StartTest()
+	defer ts.Close()
+	cache := storage.RedisCluster{KeyPrefix: "cache-"}
+	defer cache.DeleteScanMatch("*")
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.CacheOptions = apidef.CacheOptions{
+			CacheTimeout:         1,
+			EnableCache:          true,
+			CacheAllSafeRequests: true,
+			ServeStaleOnError:    true,
+			StaleGracePeriod:     60,
+		}
+	})
+	cache.DeleteScanMatch("*")
+
+	headerCache := map[string]string{"x-tyk-cached-response": "1"}
+	headerStale := map[string]string{headers.Warning: `110 - "Response is Stale"`}
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/", Code: http.StatusOK, BodyMatch: "^hit 1$", Delay: 10 * time.Millisecond},
+		{Path: "/", Code: http.StatusOK, BodyMatch: "^hit 1$", HeadersMatch: headerCache, HeadersNotMatch: headerStale, Delay: 2 * time.Second},
+		// expired responses are replaced while the upstream is healthy
+		{Path: "/", Code: http.StatusOK, BodyMatch: "^hit 2$", HeadersNotMatch: headerCache, Delay: 2 * time.Second},
+	}...)
+
+	atomic.StoreInt32(&down, 1)
+	ts.Run(t, []test.TestCase{
+		{Path: "/", Code: http.StatusOK, BodyMatch: "^hit 2$", HeadersMatch: headerStale},
+		// nothing cached for this one
+		{Path: "/other", Code: http.StatusBadGateway},
+	}...)
+}
+
+func TestCachedStatusOK(t *testing.T) {
+	assert.True(t, cachedStatusOK("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"))
+	assert.False(t, cachedStatusOK("HTTP/1.1 404 Not Found\r\n\r\n"))
+	assert.False(t, cachedStatusOK(""))
+}
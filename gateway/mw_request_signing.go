@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/certs"
 )
 
@@ -93,11 +94,6 @@ func (s *RequestSigning) getRequestPath(r *http.Request) string {
 }
 
 func (s *RequestSigning) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
-	if (s.Spec.RequestSigning.Secret == "" && s.Spec.RequestSigning.CertificateId == "") || s.Spec.RequestSigning.KeyId == "" || s.Spec.RequestSigning.Algorithm == "" {
-		log.Error("Fields required for signing the request are missing")
-		return errors.New("Fields required for signing the request are missing"), http.StatusInternalServerError
-	}
-
 	var algoList []string
 	if len(s.Spec.HmacAllowedAlgorithms) > 0 {
 		algoList = s.Spec.HmacAllowedAlgorithms
@@ -105,81 +101,94 @@ func (s *RequestSigning) ProcessRequest(w http.ResponseWriter, r *http.Request,
 		algoList = supportedAlgorithms
 	}
 
+	if err := signRequest(r, s.Spec.RequestSigning, algoList, s.getRequestPath(r)); err != nil {
+		return err, http.StatusInternalServerError
+	}
+
+	return nil, http.StatusOK
+}
+
+// signRequest sets the signature of a request, following the Signing HTTP
+// Messages draft, in its Authorization header or the configured one.
+func signRequest(r *http.Request, signing apidef.RequestSigningMeta, algoList []string, path string) error {
+	if (signing.Secret == "" && signing.CertificateId == "") || signing.KeyId == "" || signing.Algorithm == "" {
+		log.Error("Fields required for signing the request are missing")
+		return errors.New("Fields required for signing the request are missing")
+	}
+
 	algorithmAllowed := false
 	for _, alg := range algoList {
-		if alg == s.Spec.RequestSigning.Algorithm {
+		if alg == signing.Algorithm {
 			algorithmAllowed = true
 			break
 		}
 	}
 	if !algorithmAllowed {
-		log.WithField("algorithm", s.Spec.RequestSigning.Algorithm).Error("Algorithm not supported")
-		return errors.New("Request signing algorithm is not supported"), http.StatusInternalServerError
+		log.WithField("algorithm", signing.Algorithm).Error("Algorithm not supported")
+		return errors.New("Request signing algorithm is not supported")
 	}
 
-	headers := generateHeaderList(r, s.Spec.RequestSigning.HeaderList)
-
-	path := s.getRequestPath(r)
+	headers := generateHeaderList(r, signing.HeaderList)
 
 	signatureString, err := generateHMACSignatureStringFromRequest(r, headers, path)
 	if err != nil {
 		log.Error(err)
-		return err, http.StatusInternalServerError
+		return err
 	}
 	strHeaders := strings.Join(headers, " ")
 
 	var encodedSignature string
 
-	if strings.HasPrefix(s.Spec.RequestSigning.Algorithm, "rsa") {
-		if s.Spec.RequestSigning.CertificateId == "" {
+	if strings.HasPrefix(signing.Algorithm, "rsa") {
+		if signing.CertificateId == "" {
 			log.Error("CertificateID is empty")
-			return errors.New("CertificateID is empty"), http.StatusInternalServerError
+			return errors.New("CertificateID is empty")
 		}
 
-		certList := CertificateManager.List([]string{s.Spec.RequestSigning.CertificateId}, certs.CertificatePrivate)
+		certList := CertificateManager.List([]string{signing.CertificateId}, certs.CertificatePrivate)
 		if len(certList) == 0 || certList[0] == nil {
 			log.Error("Certificate not found")
-			return errors.New("Certificate not found"), http.StatusInternalServerError
+			return errors.New("Certificate not found")
 		}
 		cert := certList[0]
 		rsaKey, ok := cert.PrivateKey.(*rsa.PrivateKey)
 		if !ok {
 			log.Error("Certificate does not contain RSA private key")
-			return errors.New("Certificate does not contain RSA private key"), http.StatusInternalServerError
+			return errors.New("Certificate does not contain RSA private key")
 		}
-		encodedSignature, err = generateRSAEncodedSignature(signatureString, rsaKey, s.Spec.RequestSigning.Algorithm)
+		encodedSignature, err = generateRSAEncodedSignature(signatureString, rsaKey, signing.Algorithm)
 		if err != nil {
 			log.Error("Error while generating signature:", err)
-			return err, http.StatusInternalServerError
+			return err
 		}
 	} else {
 		var err error
-		encodedSignature, err = generateHMACEncodedSignature(signatureString, s.Spec.RequestSigning.Secret, s.Spec.RequestSigning.Algorithm)
+		encodedSignature, err = generateHMACEncodedSignature(signatureString, signing.Secret, signing.Algorithm)
 		if err != nil {
-			return err, http.StatusInternalServerError
+			return err
 		}
 	}
 
 	//Generate Authorization header
 	authHeader := "Signature "
 	//Append keyId
-	authHeader += "keyId=\"" + s.Spec.RequestSigning.KeyId + "\","
+	authHeader += "keyId=\"" + signing.KeyId + "\","
 	//Append algorithm
-	authHeader += "algorithm=\"" + s.Spec.RequestSigning.Algorithm + "\","
+	authHeader += "algorithm=\"" + signing.Algorithm + "\","
 	//Append Headers
 	authHeader += "headers=\"" + strHeaders + "\","
 	//Append signature
 	authHeader += "signature=\"" + encodedSignature + "\""
 
-	if s.Spec.RequestSigning.SignatureHeader != "" {
-		r.Header.Set(s.Spec.RequestSigning.SignatureHeader, authHeader)
-		log.Debugf("Setting %s headers as =%s", s.Spec.RequestSigning.SignatureHeader, authHeader)
+	if signing.SignatureHeader != "" {
+		r.Header.Set(signing.SignatureHeader, authHeader)
+		log.Debugf("Setting %s headers as =%s", signing.SignatureHeader, authHeader)
 	} else {
 		r.Header.Set("Authorization", authHeader)
 		log.Debug("Setting Authorization headers as =", authHeader)
 	}
 
-	return nil, http.StatusOK
+	return nil
 }
 
 func generateRSAEncodedSignature(signatureString string, privateKey *rsa.PrivateKey, algorithm string) (string, error) {
@@ -0,0 +1,91 @@
+package gateway
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/TykTechnologies/tyk/request"
+)
+
+var errStaticResponse = errors.New("Failed to render the static response. Contact Administrator for more details.")
+
+// StaticResponseMiddleware answers requests to endpoints with a static
+// response itself, without proxying them.
+type StaticResponseMiddleware struct {
+	BaseMiddleware
+	sh SuccessHandler
+}
+
+func (m *StaticResponseMiddleware) Name() string {
+	return "StaticResponseMiddleware"
+}
+
+func (m *StaticResponseMiddleware) Init() {
+	m.sh = SuccessHandler{m.BaseMiddleware}
+}
+
+func (m *StaticResponseMiddleware) EnabledForSpec() bool {
+	for _, version := range m.Spec.VersionData.Versions {
+		if len(version.ExtendedPaths.StaticResponse) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// staticResponseData is what the body template of a static response is
+// rendered with.
+func staticResponseData(r *http.Request, spec *APISpec) map[string]interface{} {
+	data := map[string]interface{}{
+		"method":       r.Method,
+		"path":         spec.StripListenPath(r, r.URL.Path),
+		"host":         r.Host,
+		"query":        r.URL.Query(),
+		"headers":      map[string][]string(r.Header),
+		"remote_addr":  request.RealIP(r),
+		"_tyk_context": ctxGetData(r),
+	}
+	if session := ctxGetSession(r); session != nil {
+		data["_tyk_meta"] = session.GetMetaData()
+	}
+	return data
+}
+
+// ProcessRequest will run any checks on the request on the way through the system, return an error to have the chain fail
+func (m *StaticResponseMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	_, versionPaths, _, _ := m.Spec.Version(r)
+	found, meta := m.Spec.CheckSpecMatchesStatus(r, versionPaths, StaticResponse)
+	if !found {
+		return nil, http.StatusOK
+	}
+	spec := meta.(*StaticResponseSpec)
+
+	t1 := time.Now()
+	var body bytes.Buffer
+	if err := spec.Template.Execute(&body, staticResponseData(r, m.Spec)); err != nil {
+		m.Logger().WithError(err).Error("Failed to render static response")
+		return errStaticResponse, http.StatusInternalServerError
+	}
+
+	code := spec.Code
+	if code == 0 {
+		code = http.StatusOK
+	}
+	responseHeaders := make(map[string]string, len(spec.Headers))
+	for name, value := range spec.Headers {
+		responseHeaders[name] = replaceTykVariables(r, value, false)
+	}
+
+	session := ctxGetSession(r)
+	res := forceResponse(w, r, &VMResponseObject{
+		Response: ResponseObject{Body: body.String(), Headers: responseHeaders, Code: code},
+	}, m.Spec, session, false, m.Logger())
+	if res != nil {
+		ms := DurationToMillisecond(time.Since(t1))
+		m.sh.RecordHit(r, Latency{Total: int64(ms)}, res.StatusCode, res)
+	}
+
+	return nil, mwStatusRespond
+}
@@ -0,0 +1,58 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestStaticResponse(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte("upstream"))
+	}))
+	defer upstream.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/static/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.EnableContextVars = true
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.UseExtendedPaths = true
+			v.ExtendedPaths.StaticResponse = []apidef.StaticResponseMeta{
+				{Path: "/robots.txt", Method: http.MethodGet, Body: "User-agent: *\nDisallow: /\n"},
+				{
+					Path:    "/health",
+					Method:  http.MethodGet,
+					Code:    http.StatusAccepted,
+					Headers: map[string]string{"Content-Type": "application/json", "X-Path": "$tyk_context.path"},
+					Body:    `{"method":"{{.method}}","path":"{{.path}}","q":"{{index .query "q" 0}}"}`,
+				},
+				{Path: "/broken", Method: http.MethodGet, Body: `{{index .query "q" 0}}`},
+			}
+		})
+	})
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/static/robots.txt", Code: http.StatusOK, BodyMatch: "Disallow: /"},
+		{Path: "/static/health?q=up", Code: http.StatusAccepted,
+			BodyMatch:    `{"method":"GET","path":"/health","q":"up"}`,
+			HeadersMatch: map[string]string{"Content-Type": "application/json", "X-Path": "/static/health"}},
+		// other methods and endpoints are proxied
+		{Method: http.MethodPost, Path: "/static/health", Code: http.StatusOK, BodyMatch: "upstream"},
+		{Path: "/static/other", Code: http.StatusOK, BodyMatch: "upstream"},
+		{Path: "/static/broken", Code: http.StatusInternalServerError},
+	}...)
+
+	if got := atomic.LoadInt32(&hits); got != 2 {
+		t.Errorf("upstream hit %d times, want 2", got)
+	}
+}
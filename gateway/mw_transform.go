@@ -51,6 +51,8 @@ func (t *TransformMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Requ
 }
 
 func transformBody(r *http.Request, tmeta *TransformSpec, contextVars bool) error {
+	tmeta = tmeta.forSession(ctxGetSession(r))
+
 	body, _ := ioutil.ReadAll(r.Body)
 	defer r.Body.Close()
 
@@ -88,12 +90,8 @@ func transformBody(r *http.Request, tmeta *TransformSpec, contextVars bool) erro
 		return fmt.Errorf("unsupported request input type: %v", tmeta.TemplateData.Input)
 	}
 
-	if tmeta.TemplateData.EnableSession {
-		if session := ctxGetSession(r); session != nil {
-			bodyData["_tyk_meta"] = session.GetMetaData()
-		} else {
-			log.Error("Session context was enabled but not found.")
-		}
+	if tmeta.TemplateData.EnableSession && !addSessionTemplateData(r, bodyData) {
+		log.Error("Session context was enabled but not found.")
 	}
 
 	if contextVars {
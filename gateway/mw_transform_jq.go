@@ -90,9 +90,9 @@ func (t *TransformJQMiddleware) transformJQBody(r *http.Request, ts *TransformJQ
 	r.ContentLength = int64(bodyBuffer.Len())
 
 	// Replace header in the request
-	ignoreCanonical := config.Global().IgnoreCanonicalMIMEHeaderKey
+	casing := t.Spec.headerCasing()
 	for hName, hValue := range jqResult.RewriteHeaders {
-		setCustomHeader(r.Header, hName, hValue, ignoreCanonical)
+		setCustomHeader(r.Header, hName, hValue, casing)
 	}
 
 	if t.Spec.EnableContextVars {
@@ -176,6 +176,7 @@ func (a *APIDefinitionLoader) compileTransformJQPathSpec(paths []apidef.Transfor
 			urlSpec = append(urlSpec, newSpec)
 		} else {
 			log.Error("JQ Filter load failure! Skipping transformation: ", err)
+			a.warn("jq transform of %s %s left out: %v", stringSpec.Method, stringSpec.Path, err)
 		}
 	}
 
@@ -23,6 +23,7 @@ import (
 const (
 	metaLabel        = "$tyk_meta."
 	contextLabel     = "$tyk_context."
+	sessionLabel     = "$tyk_session."
 	consulLabel      = "$secret_consul."
 	vaultLabel       = "$secret_vault."
 	envLabel         = "$secret_env."
@@ -37,9 +38,17 @@ var consulMatch = regexp.MustCompile(`\$secret_consul.([A-Za-z0-9\/\-\.]+)`)
 var vaultMatch = regexp.MustCompile(`\$secret_vault.([A-Za-z0-9\/\-\.]+)`)
 var envValueMatch = regexp.MustCompile(`\$secret_env.([A-Za-z0-9_\-\.]+)`)
 var metaMatch = regexp.MustCompile(`\$tyk_meta.([A-Za-z0-9_\-\.]+)`)
+var sessionMatch = regexp.MustCompile(`\$tyk_session.([A-Za-z0-9_]+)`)
 var secretsConfMatch = regexp.MustCompile(`\$secret_conf.([A-Za-z0-9[.\-\_]+)`)
 
 func urlRewrite(meta *apidef.URLRewriteMeta, r *http.Request) (string, error) {
+	newpath, _, err := urlRewriteWithTrigger(meta, r)
+	return newpath, err
+}
+
+// urlRewriteWithTrigger rewrites the request URL and also returns the index
+// of the trigger which selected the rewrite target, or -1 if none did.
+func urlRewriteWithTrigger(meta *apidef.URLRewriteMeta, r *http.Request) (string, int, error) {
 	path := r.URL.String()
 	log.Debug("Inbound path: ", path)
 	newpath := path
@@ -48,12 +57,13 @@ func urlRewrite(meta *apidef.URLRewriteMeta, r *http.Request) (string, error) {
 		var err error
 		meta.MatchRegexp, err = regexp.Compile(meta.MatchPattern)
 		if err != nil {
-			return path, fmt.Errorf("URLRewrite regexp error %s", meta.MatchPattern)
+			return path, -1, fmt.Errorf("URLRewrite regexp error %s", meta.MatchPattern)
 		}
 	}
 
 	// Check triggers
 	rewriteToPath := meta.RewriteTo
+	triggered := -1
 	if len(meta.Triggers) > 0 {
 
 		// This feature uses context, we must force it if it doesn't exist
@@ -76,6 +86,7 @@ func urlRewrite(meta *apidef.URLRewriteMeta, r *http.Request) (string, error) {
 					setCount += 1
 					if checkAny {
 						rewriteToPath = triggerOpts.RewriteTo
+						triggered = tn
 						break
 					}
 				}
@@ -87,6 +98,7 @@ func urlRewrite(meta *apidef.URLRewriteMeta, r *http.Request) (string, error) {
 					setCount += 1
 					if checkAny {
 						rewriteToPath = triggerOpts.RewriteTo
+						triggered = tn
 						break
 					}
 				}
@@ -98,6 +110,7 @@ func urlRewrite(meta *apidef.URLRewriteMeta, r *http.Request) (string, error) {
 					setCount += 1
 					if checkAny {
 						rewriteToPath = triggerOpts.RewriteTo
+						triggered = tn
 						break
 					}
 				}
@@ -110,6 +123,7 @@ func urlRewrite(meta *apidef.URLRewriteMeta, r *http.Request) (string, error) {
 						setCount += 1
 						if checkAny {
 							rewriteToPath = triggerOpts.RewriteTo
+							triggered = tn
 							break
 						}
 					}
@@ -122,6 +136,7 @@ func urlRewrite(meta *apidef.URLRewriteMeta, r *http.Request) (string, error) {
 					setCount += 1
 					if checkAny {
 						rewriteToPath = triggerOpts.RewriteTo
+						triggered = tn
 						break
 					}
 				}
@@ -133,6 +148,7 @@ func urlRewrite(meta *apidef.URLRewriteMeta, r *http.Request) (string, error) {
 					setCount += 1
 					if checkAny {
 						rewriteToPath = triggerOpts.RewriteTo
+						triggered = tn
 						break
 					}
 				}
@@ -161,6 +177,7 @@ func urlRewrite(meta *apidef.URLRewriteMeta, r *http.Request) (string, error) {
 				}
 				if total == setCount {
 					rewriteToPath = triggerOpts.RewriteTo
+					triggered = tn
 				}
 			}
 		}
@@ -197,7 +214,7 @@ func urlRewrite(meta *apidef.URLRewriteMeta, r *http.Request) (string, error) {
 
 	newpath = replaceTykVariables(r, newpath, true)
 
-	return newpath, nil
+	return newpath, triggered, nil
 }
 
 func replaceTykVariables(r *http.Request, in string, escape bool) string {
@@ -241,6 +258,11 @@ func replaceTykVariables(r *http.Request, in string, escape bool) string {
 			in = replaceVariables(in, vars, session.GetMetaData(), metaLabel, escape)
 		}
 	}
+
+	if strings.Contains(in, sessionLabel) {
+		vars := sessionMatch.FindAllString(in, -1)
+		in = replaceVariables(in, vars, sessionVars(ctxGetSession(r)), sessionLabel, escape)
+	}
 	//todo add config_data
 	return in
 }
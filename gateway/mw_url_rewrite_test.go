@@ -1220,6 +1220,43 @@ func TestURLRewriteCaseSensitivity(t *testing.T) {
 	})
 }
 
+func TestRewriteTestHandler(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "rewrite"
+		spec.Proxy.ListenPath = "/rewrite/"
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.ExtendedPaths.URLRewrite = []apidef.URLRewriteMeta{{
+				Path:         "/get/{id}",
+				Method:       "GET",
+				MatchPattern: "/get/(\\w+)",
+				RewriteTo:    "/default/$1",
+				Triggers: []apidef.RoutingTrigger{{
+					On: apidef.Any,
+					Options: apidef.RoutingTriggerOptions{
+						HeaderMatches: map[string]apidef.StringRegexMap{
+							"X-Beta": {MatchPattern: "yes"},
+						},
+					},
+					RewriteTo: "/beta/$1",
+				}},
+			}}
+		})
+	})
+
+	ts.Run(t, []test.TestCase{
+		{Method: "POST", Path: "/tyk/apis/unknown/rewrite-test", Data: `{}`, AdminAuth: true, Code: 404},
+		{Method: "POST", Path: "/tyk/apis/rewrite/rewrite-test", Data: `{"path":"/rewrite/other"}`, AdminAuth: true, Code: 200,
+			BodyMatch: `"matched":false,"target":"/rewrite/other"`},
+		{Method: "POST", Path: "/tyk/apis/rewrite/rewrite-test", Data: `{"path":"/rewrite/get/1"}`, AdminAuth: true, Code: 200,
+			BodyMatch: `"matched":true,"target":"/default/1"`},
+		{Method: "POST", Path: "/tyk/apis/rewrite/rewrite-test", Data: `{"path":"/rewrite/get/1","headers":{"X-Beta":["yes"]}}`, AdminAuth: true, Code: 200,
+			BodyMatch: `"matched":true,"trigger":0,"target":"/beta/1"`},
+	}...)
+}
+
 func TestValToStr(t *testing.T) {
 
 	example := []interface{}{
@@ -1236,3 +1273,16 @@ func TestValToStr(t *testing.T) {
 		t.Errorf("expected (%s) got (%s)", expected, str)
 	}
 }
+
+func TestReplaceSessionVariables(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	session := user.NewSessionState()
+	session.Tags = []string{"gold", "eu"}
+	session.Alias = "acme"
+	ctxSetSession(r, session, "", false)
+
+	got := replaceTykVariables(r, "/$tyk_session.alias/$tyk_session.tags/$tyk_session.unknown", false)
+	if expected := "/acme/gold,eu/"; got != expected {
+		t.Errorf("expected (%s) got (%s)", expected, got)
+	}
+}
@@ -2,7 +2,9 @@ package gateway
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"io"
@@ -15,6 +17,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gocraft/health"
+	cache "github.com/pmylund/go-cache"
 	"github.com/robertkrimen/otto"
 	_ "github.com/robertkrimen/otto/underscore"
 
@@ -46,6 +50,8 @@ type VMResponseObject struct {
 	SessionMeta map[string]interface{}
 }
 
+var errVirtualEndpointBusy = errors.New("Too many concurrent requests to the virtual endpoint")
+
 // DynamicMiddleware is a generic middleware that will execute JS code before continuing
 type VirtualEndpoint struct {
 	BaseMiddleware
@@ -106,14 +112,14 @@ func (d *VirtualEndpoint) EnabledForSpec() bool {
 	return false
 }
 
-func (d *VirtualEndpoint) getMetaFromRequest(r *http.Request) *apidef.VirtualMeta {
+func (d *VirtualEndpoint) getMetaFromRequest(r *http.Request) *EndpointVirtualSpec {
 	_, versionPaths, _, _ := d.Spec.Version(r)
 	found, meta := d.Spec.CheckSpecMatchesStatus(r, versionPaths, VirtualPath)
 	if !found {
 		return nil
 	}
 
-	vmeta, ok := meta.(*apidef.VirtualMeta)
+	vmeta, ok := meta.(*EndpointVirtualSpec)
 	if !ok {
 		return nil
 	}
@@ -121,11 +127,56 @@ func (d *VirtualEndpoint) getMetaFromRequest(r *http.Request) *apidef.VirtualMet
 	return vmeta
 }
 
-func (d *VirtualEndpoint) ServeHTTPForCache(w http.ResponseWriter, r *http.Request, vmeta *apidef.VirtualMeta) *http.Response {
+// instrument records an event of a virtual endpoint, with its execution time
+// when not zero.
+func (d *VirtualEndpoint) instrument(vmeta *EndpointVirtualSpec, event string, execTime time.Duration) {
+	if !instrumentationEnabled {
+		return
+	}
+
+	job := instrument.NewJob("VirtualEndpointCall")
+	meta := health.Kvs{
+		"api_id":   d.Spec.APIID,
+		"method":   vmeta.Method,
+		"endpoint": vmeta.Path,
+		"function": vmeta.ResponseFunctionName,
+	}
+	job.EventKv(event, meta)
+	if execTime > 0 {
+		job.TimingKv(event+".exec_time", execTime.Nanoseconds(), meta)
+	}
+}
+
+// virtualCacheKey identifies the requests a cached response of a virtual
+// endpoint is served to. The function may read the key and the headers of
+// the request, so responses are cached per key and per value of the cache
+// by headers of the API.
+func virtualCacheKey(r *http.Request, cacheByHeaders []string, body []byte) string {
+	h := sha256.New()
+	parts := []string{r.Method, r.URL.String(), ctxGetAuthToken(r)}
+	for _, header := range cacheByHeaders {
+		parts = append(parts, header, r.Header.Get(header))
+	}
+	for _, part := range parts {
+		io.WriteString(h, part)
+		h.Write([]byte{0})
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (d *VirtualEndpoint) ServeHTTPForCache(w http.ResponseWriter, r *http.Request, vmeta *EndpointVirtualSpec) *http.Response {
+	res, _ := d.serveVirtual(w, r, vmeta)
+	return res
+}
+
+// serveVirtual runs the function of a virtual endpoint and writes its
+// response. A nil response means that the function failed.
+func (d *VirtualEndpoint) serveVirtual(w http.ResponseWriter, r *http.Request, vmeta *EndpointVirtualSpec) (*http.Response, error) {
 	t1 := time.Now()
 	if vmeta == nil {
 		if vmeta = d.getMetaFromRequest(r); vmeta == nil {
-			return nil
+			return nil, nil
 		}
 	}
 
@@ -133,10 +184,38 @@ func (d *VirtualEndpoint) ServeHTTPForCache(w http.ResponseWriter, r *http.Reque
 	originalBody, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		d.Logger().WithError(err).Error("Failed to read request body!")
-		return nil
+		return nil, nil
 	}
 	defer r.Body.Close()
 
+	session := user.NewSessionState()
+
+	// Encode the session object (if not a pre-process)
+	if vmeta.UseSession {
+		session = ctxGetSession(r)
+	}
+
+	var cacheKey string
+	if vmeta.cache != nil {
+		cacheKey = virtualCacheKey(r, d.Spec.CacheOptions.CacheByHeaders, originalBody)
+		if cached, found := vmeta.cache.Get(cacheKey); found {
+			d.instrument(vmeta, "cache_hit", 0)
+			newResponseData := *cached.(*VMResponseObject)
+			r.Body = ioutil.NopCloser(bytes.NewReader(originalBody))
+			return d.writeVirtualResponse(w, r, vmeta, &newResponseData, session, t1), nil
+		}
+	}
+
+	if vmeta.slots != nil {
+		select {
+		case vmeta.slots <- struct{}{}:
+			defer func() { <-vmeta.slots }()
+		default:
+			d.instrument(vmeta, "rejected", 0)
+			return nil, errVirtualEndpointBusy
+		}
+	}
+
 	scheme := "http"
 	if r.TLS != nil {
 		scheme = "https"
@@ -156,23 +235,21 @@ func (d *VirtualEndpoint) ServeHTTPForCache(w http.ResponseWriter, r *http.Reque
 	requestAsJson, err := json.Marshal(requestData)
 	if err != nil {
 		d.Logger().WithError(err).Error("Failed to encode request object for virtual endpoint")
-		return nil
+		return nil, nil
 	}
 
 	// Encode the configuration data too
 	specAsJson := specToJson(d.Spec)
 
-	session := user.NewSessionState()
-
-	// Encode the session object (if not a pre-process)
-	if vmeta.UseSession {
-		session = ctxGetSession(r)
-	}
-
 	sessionAsJson, err := json.Marshal(session)
 	if err != nil {
 		d.Logger().WithError(err).Error("Failed to encode session for VM")
-		return nil
+		return nil, nil
+	}
+
+	timeout := d.Spec.JSVM.Timeout
+	if vmeta.Timeout > 0 {
+		timeout = time.Duration(vmeta.Timeout * float64(time.Second))
 	}
 
 	// Run the middleware
@@ -195,23 +272,25 @@ func (d *VirtualEndpoint) ServeHTTPForCache(w http.ResponseWriter, r *http.Reque
 		errRet <- err
 	}()
 	var returnRaw otto.Value
-	t := time.NewTimer(d.Spec.JSVM.Timeout)
+	t := time.NewTimer(timeout)
 	select {
 	case returnRaw = <-ret:
 		if err := <-errRet; err != nil {
 			d.Logger().WithError(err).Error("Failed to run JS middleware")
-			return nil
+			d.instrument(vmeta, "error", time.Since(t1))
+			return nil, nil
 		}
 		t.Stop()
 	case <-t.C:
 		t.Stop()
-		d.Logger().Error("JS middleware timed out after ", d.Spec.JSVM.Timeout)
+		d.Logger().Error("JS middleware timed out after ", timeout)
+		d.instrument(vmeta, "timeout", time.Since(t1))
 		vm.Interrupt <- func() {
 			// only way to stop the VM is to send it a func
 			// that panics.
 			panic("stop")
 		}
-		return nil
+		return nil, nil
 	}
 	returnDataStr, _ := returnRaw.ToString()
 
@@ -220,8 +299,10 @@ func (d *VirtualEndpoint) ServeHTTPForCache(w http.ResponseWriter, r *http.Reque
 	if err := json.Unmarshal([]byte(returnDataStr), &newResponseData); err != nil {
 		d.Logger().WithError(err).Error("Failed to decode virtual endpoint response data on return from VM: ",
 			"; Returned: ", returnDataStr)
-		return nil
+		d.instrument(vmeta, "error", time.Since(t1))
+		return nil, nil
 	}
+	d.instrument(vmeta, "executed", time.Since(t1))
 
 	// Save the sesison data (if modified)
 	if vmeta.UseSession {
@@ -232,7 +313,17 @@ func (d *VirtualEndpoint) ServeHTTPForCache(w http.ResponseWriter, r *http.Reque
 		}
 	}
 
-	copiedResponse := forceResponse(w, r, &newResponseData, d.Spec, session, false, d.Logger())
+	if vmeta.cache != nil {
+		cached := newResponseData
+		vmeta.cache.Set(cacheKey, &cached, cache.DefaultExpiration)
+	}
+
+	return d.writeVirtualResponse(w, r, vmeta, &newResponseData, session, t1), nil
+}
+
+func (d *VirtualEndpoint) writeVirtualResponse(w http.ResponseWriter, r *http.Request, vmeta *EndpointVirtualSpec,
+	newResponseData *VMResponseObject, session *user.SessionState, t1 time.Time) *http.Response {
+	copiedResponse := forceResponse(w, r, newResponseData, d.Spec, session, false, d.Logger())
 	ms := DurationToMillisecond(time.Since(t1))
 	d.Logger().Debug("JSVM Virtual Endpoint execution took: (ms) ", ms)
 
@@ -255,9 +346,9 @@ func forceResponse(w http.ResponseWriter,
 	newResponse.Header = make(map[string][]string)
 
 	requestTime := time.Now().UTC().Format(http.TimeFormat)
-	ignoreCanonical := config.Global().IgnoreCanonicalMIMEHeaderKey
+	casing := spec.headerCasing()
 	for header, value := range newResponseData.Response.Headers {
-		setCustomHeader(newResponse.Header, header, value, ignoreCanonical)
+		setCustomHeader(newResponse.Header, header, value, casing)
 	}
 
 	newResponse.ContentLength = int64(len(responseMessage))
@@ -306,12 +397,14 @@ func (d *VirtualEndpoint) ProcessRequest(w http.ResponseWriter, r *http.Request,
 		return nil, http.StatusOK
 	}
 
-	if res := d.ServeHTTPForCache(w, r, vmeta); res == nil {
+	if res, err := d.serveVirtual(w, r, vmeta); res == nil {
 		if vmeta.ProxyOnError {
 			return nil, http.StatusOK
-		} else {
-			return errors.New("Error during virtual endpoint execution. Contact Administrator for more details."), http.StatusInternalServerError
 		}
+		if err != nil {
+			return err, http.StatusServiceUnavailable
+		}
+		return errors.New("Error during virtual endpoint execution. Contact Administrator for more details."), http.StatusInternalServerError
 	}
 
 	return nil, mwStatusRespond
@@ -339,7 +432,7 @@ func handleForcedResponse(rw http.ResponseWriter, res *http.Response, ses *user.
 		res.Header.Set(headers.XRateLimitReset, strconv.Itoa(int(quotaRenews)))
 	}
 
-	copyHeader(rw.Header(), res.Header, config.Global().IgnoreCanonicalMIMEHeaderKey)
+	copyHeader(rw.Header(), res.Header, spec.headerCasing())
 
 	rw.WriteHeader(res.StatusCode)
 	io.Copy(rw, res.Body)
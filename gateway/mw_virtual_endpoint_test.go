@@ -2,8 +2,12 @@ package gateway
 
 import (
 	"encoding/base64"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/TykTechnologies/tyk/user"
 
@@ -117,6 +121,96 @@ func TestVirtualEndpointSessionMetadata(t *testing.T) {
 	})
 }
 
+func TestVirtualEndpointLimits(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	// functions share the VM of the API
+	virtualMeta := func(path, js string) apidef.VirtualMeta {
+		name := "testVirtData" + strings.Trim(path, "/")
+		return apidef.VirtualMeta{
+			ResponseFunctionName: name,
+			FunctionSourceType:   "blob",
+			FunctionSourceURI: base64.StdEncoding.EncodeToString([]byte(`
+function ` + name + `(request, session, config) {
+	` + js + `
+	return TykJsResponse({Body: Math.random().toString(), Code: 200}, session.meta_data)
+}`)),
+			Path:   path,
+			Method: http.MethodGet,
+		}
+	}
+
+	cached := virtualMeta("/cached", "")
+	cached.CacheTTL = 60
+	timeout := virtualMeta("/timeout", "while (true) {}")
+	timeout.Timeout = 0.1
+	busy := virtualMeta("/busy", "var end = Date.now() + 300; while (Date.now() < end) {}")
+	busy.MaxConcurrency = 1
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.CacheOptions.CacheByHeaders = []string{"X-Tenant"}
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.UseExtendedPaths = true
+			v.ExtendedPaths.Virtual = []apidef.VirtualMeta{cached, timeout, busy}
+		})
+	})
+
+	t.Run("cache", func(t *testing.T) {
+		resp, _ := ts.Run(t, test.TestCase{Path: "/cached", Code: http.StatusOK})
+		body, _ := ioutil.ReadAll(resp.Body)
+		_, _ = ts.Run(t, []test.TestCase{
+			{Path: "/cached", Code: http.StatusOK, BodyMatch: "^" + string(body) + "$"},
+			{Path: "/cached?other", Code: http.StatusOK, BodyNotMatch: "^" + string(body) + "$"},
+			{Path: "/cached", Headers: map[string]string{"X-Tenant": "other"}, Code: http.StatusOK,
+				BodyNotMatch: "^" + string(body) + "$"},
+		}...)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		start := time.Now()
+		_, _ = ts.Run(t, test.TestCase{Path: "/timeout", Code: http.StatusInternalServerError})
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Error("Expected the endpoint timeout to apply, took ", elapsed)
+		}
+	})
+
+	t.Run("concurrency", func(t *testing.T) {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _ = ts.Run(t, test.TestCase{Path: "/busy", Code: http.StatusOK})
+		}()
+
+		time.Sleep(100 * time.Millisecond)
+		_, _ = ts.Run(t, test.TestCase{Path: "/busy", Code: http.StatusServiceUnavailable})
+		<-done
+		_, _ = ts.Run(t, test.TestCase{Path: "/busy", Code: http.StatusOK})
+	})
+}
+
+func TestVirtualCacheKey(t *testing.T) {
+	keyed := func(token, tenant string) string {
+		r := httptest.NewRequest(http.MethodGet, "/cached", nil)
+		r.Header.Set("X-Tenant", tenant)
+		if token != "" {
+			ctxSetSession(r, &user.SessionState{}, token, false)
+		}
+		return virtualCacheKey(r, []string{"X-Tenant"}, nil)
+	}
+
+	if keyed("a", "1") == keyed("b", "1") {
+		t.Error("Expected the responses to be cached per key")
+	}
+	if keyed("a", "1") == keyed("a", "2") {
+		t.Error("Expected the responses to be cached per value of the cache by headers")
+	}
+	if keyed("a", "1") != keyed("a", "1") {
+		t.Error("Expected identical requests to share their cached response")
+	}
+}
+
 func BenchmarkVirtualEndpoint(b *testing.B) {
 	b.ReportAllocs()
 
@@ -0,0 +1,150 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+const (
+	ndjsonFormat      = "ndjson"
+	ndjsonContentType = "application/x-ndjson"
+
+	// ndjsonFlushEvery is how many records are buffered before flushing
+	// them to the client.
+	ndjsonFlushEvery = 100
+)
+
+// wantsNDJSON reports whether a listing was requested as newline delimited
+// JSON with ?format=ndjson.
+func wantsNDJSON(r *http.Request) bool {
+	return r.URL.Query().Get("format") == ndjsonFormat
+}
+
+// ndjsonWriter streams records to a client as newline delimited JSON. Writes
+// block while the client isn't reading, so whatever produces the records is
+// slowed down to the pace of the client rather than buffered in memory.
+type ndjsonWriter struct {
+	ctx     context.Context
+	enc     *json.Encoder
+	flusher http.Flusher
+	pending int
+}
+
+func newNDJSONWriter(w http.ResponseWriter, r *http.Request) *ndjsonWriter {
+	w.Header().Set(headers.ContentType, ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	return &ndjsonWriter{
+		ctx:     r.Context(),
+		enc:     json.NewEncoder(w),
+		flusher: flusher,
+	}
+}
+
+// Write sends a record, failing once the client has gone away.
+func (n *ndjsonWriter) Write(record interface{}) error {
+	if err := n.ctx.Err(); err != nil {
+		return err
+	}
+	if err := n.enc.Encode(record); err != nil {
+		return err
+	}
+	n.pending++
+	if n.pending >= ndjsonFlushEvery {
+		n.Flush()
+	}
+	return nil
+}
+
+func (n *ndjsonWriter) Flush() {
+	n.pending = 0
+	if n.flusher != nil {
+		n.flusher.Flush()
+	}
+}
+
+// Close ends the stream, with a last error record if it was cut short, so
+// that clients can tell a partial listing from a complete one.
+func (n *ndjsonWriter) Close(err error) {
+	if err != nil && n.ctx.Err() == nil {
+		n.enc.Encode(apiError(err.Error()))
+	}
+	n.Flush()
+}
+
+// keyScanner is implemented by stores able to list keys as they scan them.
+type keyScanner interface {
+	ScanKeys(filter string, fn func(key string) error) error
+}
+
+// scanKeys calls fn with the keys of store matching filter, as they are
+// scanned if the store supports it.
+func scanKeys(store storage.Handler, filter string, fn func(key string) error) error {
+	if scanner, ok := store.(keyScanner); ok {
+		return scanner.ScanKeys(filter, fn)
+	}
+	for _, key := range store.GetKeys(filter) {
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apiKeyListEntry is a key in a streamed key listing.
+type apiKeyListEntry struct {
+	Key string `json:"key"`
+}
+
+// streamAllKeys is handleGetAllKeys writing each key as it is scanned.
+func streamAllKeys(w http.ResponseWriter, r *http.Request, filter string) {
+	filters := []string{filter}
+	if filter != "" {
+		filters = append(filters, orgIDFilterB64(filter))
+	}
+
+	stream := newNDJSONWriter(w, r)
+	write := func(key string) error {
+		if strings.HasPrefix(key, QuotaKeyPrefix) || strings.HasPrefix(key, RateLimitKeyPrefix) {
+			return nil
+		}
+		return stream.Write(apiKeyListEntry{Key: key})
+	}
+
+	var err error
+	for _, f := range filters {
+		if err = scanKeys(GlobalSessionManager.Store(), f, write); err != nil {
+			break
+		}
+	}
+	stream.Close(err)
+
+	fields := logrus.Fields{"prefix": "api"}
+	if err != nil {
+		log.WithFields(fields).WithError(err).Warning("Key list stream ended early.")
+		return
+	}
+	fields["status"] = "ok"
+	log.WithFields(fields).Info("Streamed key list.")
+}
+
+// streamAPIList is handleGetAPIList writing each API definition in turn.
+// The APIs are collected first so that a slow client can't hold up reloads.
+func streamAPIList(w http.ResponseWriter, r *http.Request, tag, category string) {
+	stream := newNDJSONWriter(w, r)
+	var err error
+	for _, spec := range specsByTags(tag, category) {
+		if err = stream.Write(spec.storedDefinition()); err != nil {
+			break
+		}
+	}
+	stream.Close(err)
+}
@@ -0,0 +1,70 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestNDJSONListings(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "first"
+		spec.Proxy.ListenPath = "/first/"
+	}, func(spec *APISpec) {
+		spec.APIID = "second"
+		spec.Proxy.ListenPath = "/second/"
+	})
+
+	_, key := ts.CreateSession(func(s *user.SessionState) {
+		s.AccessRights = map[string]user.AccessDefinition{"first": {APIID: "first", Versions: []string{"v1"}}}
+	})
+
+	// readLines decodes each line of a streamed listing into a map.
+	readLines := func(resp *http.Response) []map[string]interface{} {
+		if got := resp.Header.Get("Content-Type"); got != ndjsonContentType {
+			t.Errorf("Expected content type %s, got %s", ndjsonContentType, got)
+		}
+		var lines []map[string]interface{}
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			var line map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				t.Fatalf("Line %q isn't JSON: %v", scanner.Text(), err)
+			}
+			lines = append(lines, line)
+		}
+		return lines
+	}
+
+	t.Run("APIs", func(t *testing.T) {
+		resp, _ := ts.Run(t, test.TestCase{Path: "/tyk/apis?format=ndjson", AdminAuth: true, Code: http.StatusOK})
+		ids := map[interface{}]bool{}
+		for _, line := range readLines(resp) {
+			ids[line["api_id"]] = true
+		}
+		if len(ids) != 2 || !ids["first"] || !ids["second"] {
+			t.Errorf("Expected one line per API, got %v", ids)
+		}
+	})
+
+	t.Run("keys", func(t *testing.T) {
+		resp, _ := ts.Run(t, test.TestCase{Path: "/tyk/keys?format=ndjson", AdminAuth: true, Code: http.StatusOK})
+		var found bool
+		for _, line := range readLines(resp) {
+			if line["status"] == "error" {
+				t.Errorf("Expected the listing to be complete, got %v", line)
+			}
+			found = found || line["key"] == key
+		}
+		if !found {
+			t.Errorf("Expected key %s to be listed", key)
+		}
+	})
+}
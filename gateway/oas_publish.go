@@ -0,0 +1,221 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+)
+
+// oasDocument is the subset of an OpenAPI 3 document that can be told from
+// an API definition.
+type oasDocument struct {
+	OpenAPI string                             `json:"openapi"`
+	Info    oasInfo                            `json:"info"`
+	Servers []oasServer                        `json:"servers,omitempty"`
+	Paths   map[string]map[string]oasOperation `json:"paths"`
+}
+
+type oasInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type oasServer struct {
+	URL string `json:"url"`
+}
+
+type oasOperation struct {
+	Responses map[string]oasResponse `json:"responses"`
+}
+
+type oasResponse struct {
+	Description string `json:"description"`
+}
+
+var (
+	// publishedOASMu guards publishedOAS, the documents last published by
+	// API ID, so that only the documents of changed APIs are written.
+	publishedOASMu sync.Mutex
+	publishedOAS   = map[string][]byte{}
+)
+
+// oasPublisher publishes the documents of the APIs in the background, so
+// that reloads don't wait on the disk. Only the APIs of the last reload
+// are pending, those of earlier ones being outdated.
+var oasPublisher struct {
+	sync.Mutex
+	pending map[string]*APISpec
+	running bool
+}
+
+// queueOASPublish publishes the documents of the loaded APIs, once those of
+// the previous reload are.
+func queueOASPublish(specs map[string]*APISpec) {
+	if config.Global().OASPublish.Path == "" {
+		return
+	}
+
+	oasPublisher.Lock()
+	defer oasPublisher.Unlock()
+	oasPublisher.pending = specs
+	if oasPublisher.running {
+		return
+	}
+	oasPublisher.running = true
+
+	go func() {
+		for {
+			oasPublisher.Lock()
+			specs := oasPublisher.pending
+			oasPublisher.pending = nil
+			if specs == nil {
+				oasPublisher.running = false
+				oasPublisher.Unlock()
+				return
+			}
+			oasPublisher.Unlock()
+
+			publishOAS(specs)
+		}
+	}()
+}
+
+// publicOASVersion returns the version of an API its public document
+// describes: the default version, or the first one by name.
+func publicOASVersion(spec *APISpec) (string, apidef.VersionInfo) {
+	versions := spec.VersionData.Versions
+	if version, ok := versions[spec.VersionData.DefaultVersion]; ok {
+		return spec.VersionData.DefaultVersion, version
+	}
+	names := make([]string, 0, len(versions))
+	for name := range versions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return "", apidef.VersionInfo{}
+	}
+	return names[0], versions[names[0]]
+}
+
+// publicOAS renders the public OpenAPI document of an API, with the
+// endpoints listed in its whitelist and ignored paths, less the internal and
+// blacklisted ones.
+func publicOAS(spec *APISpec) ([]byte, error) {
+	name, version := publicOASVersion(spec)
+	if name == "" {
+		name = "1.0.0"
+	}
+
+	doc := oasDocument{
+		OpenAPI: "3.0.3",
+		Info:    oasInfo{Title: spec.Name, Version: name},
+		Paths:   map[string]map[string]oasOperation{},
+	}
+	if spec.Proxy.ListenPath != "" {
+		doc.Servers = []oasServer{{URL: strings.TrimSuffix(spec.Proxy.ListenPath, "/")}}
+	}
+
+	paths := version.ExtendedPaths
+	hidden := func(path, method string) bool {
+		for _, internal := range paths.Internal {
+			if internal.Path == path && strings.EqualFold(internal.Method, method) {
+				return true
+			}
+		}
+		for _, blacklisted := range paths.BlackList {
+			if _, ok := blacklisted.MethodActions[method]; ok && blacklisted.Path == path {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, list := range [][]apidef.EndPointMeta{paths.WhiteList, paths.Ignored} {
+		for _, endpoint := range list {
+			for method := range endpoint.MethodActions {
+				if hidden(endpoint.Path, method) {
+					continue
+				}
+				path := endpoint.Path
+				if !strings.HasPrefix(path, "/") {
+					path = "/" + path
+				}
+				if doc.Paths[path] == nil {
+					doc.Paths[path] = map[string]oasOperation{}
+				}
+				doc.Paths[path][strings.ToLower(method)] = oasOperation{
+					Responses: map[string]oasResponse{"default": {Description: "Response of the API"}},
+				}
+			}
+		}
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// publishOAS writes the public documents of the APIs that publish one, when
+// they changed since they were last published, and removes those of APIs
+// that no longer do.
+func publishOAS(specs map[string]*APISpec) {
+	dir := config.Global().OASPublish.Path
+	if dir == "" {
+		return
+	}
+
+	publishedOASMu.Lock()
+	defer publishedOASMu.Unlock()
+
+	published := map[string][]byte{}
+	for apiID, spec := range specs {
+		if !spec.PublishOAS {
+			continue
+		}
+		logger := log.WithFields(logrus.Fields{"prefix": "oas-publish", "api_id": apiID})
+		if filepath.Base(apiID) != apiID {
+			logger.Error("Couldn't publish the OpenAPI document, the API ID isn't a valid file name")
+			continue
+		}
+
+		doc, err := publicOAS(spec)
+		if err != nil {
+			logger.WithError(err).Error("Couldn't render the OpenAPI document")
+			continue
+		}
+		if bytes.Equal(doc, publishedOAS[apiID]) {
+			published[apiID] = doc
+			continue
+		}
+		if err := writeFileAtomic(filepath.Join(dir, apiID+".json"), doc, 0644); err != nil {
+			logger.WithError(err).Error("Couldn't publish the OpenAPI document")
+			// keep the previous document, to try again on the next reload
+			if previous, ok := publishedOAS[apiID]; ok {
+				published[apiID] = previous
+			}
+			continue
+		}
+		published[apiID] = doc
+		logger.Info("Published the OpenAPI document")
+	}
+
+	for apiID := range publishedOAS {
+		if _, ok := published[apiID]; ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, apiID+".json")); err != nil && !os.IsNotExist(err) {
+			log.WithError(err).WithField("api_id", apiID).Error("Couldn't remove the published OpenAPI document")
+			published[apiID] = publishedOAS[apiID]
+		}
+	}
+
+	publishedOAS = published
+}
@@ -0,0 +1,139 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+)
+
+func testOASSpec(apiID string) *APISpec {
+	spec := &APISpec{APIDefinition: &apidef.APIDefinition{}}
+	spec.APIID = apiID
+	spec.Name = "Pets"
+	spec.PublishOAS = true
+	spec.Proxy.ListenPath = "/pets/"
+	spec.VersionData.DefaultVersion = "v1"
+	spec.VersionData.Versions = map[string]apidef.VersionInfo{
+		"v1": {
+			Name:             "v1",
+			UseExtendedPaths: true,
+			ExtendedPaths: apidef.ExtendedPathsSet{
+				WhiteList: []apidef.EndPointMeta{
+					{Path: "/{id}", MethodActions: map[string]apidef.EndpointMethodMeta{"GET": {}, "DELETE": {}}},
+					{Path: "admin", MethodActions: map[string]apidef.EndpointMethodMeta{"POST": {}}},
+				},
+				Ignored: []apidef.EndPointMeta{
+					{Path: "/health", MethodActions: map[string]apidef.EndpointMethodMeta{"GET": {}}},
+				},
+				BlackList: []apidef.EndPointMeta{
+					{Path: "/{id}", MethodActions: map[string]apidef.EndpointMethodMeta{"DELETE": {}}},
+				},
+				Internal: []apidef.InternalMeta{{Path: "admin", Method: "POST"}},
+			},
+		},
+		"v2": {Name: "v2"},
+	}
+	return spec
+}
+
+func TestPublicOAS(t *testing.T) {
+	data, err := publicOAS(testOASSpec("pets"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc oasDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+	assert.Equal(t, oasInfo{Title: "Pets", Version: "v1"}, doc.Info)
+	assert.Equal(t, []oasServer{{URL: "/pets"}}, doc.Servers)
+	assert.Len(t, doc.Paths, 2)
+	assert.Contains(t, doc.Paths["/{id}"], "get")
+	assert.NotContains(t, doc.Paths["/{id}"], "delete")
+	assert.Contains(t, doc.Paths["/health"], "get")
+	assert.NotContains(t, doc.Paths, "/admin")
+}
+
+func TestPublishOAS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	globalConf := config.Global()
+	globalConf.OASPublish.Path = dir
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+	defer func() { publishedOAS = map[string][]byte{} }()
+
+	hidden := testOASSpec("hidden")
+	hidden.PublishOAS = false
+	publishOAS(map[string]*APISpec{"pets": testOASSpec("pets"), "hidden": hidden})
+
+	file := filepath.Join(dir, "pets.json")
+	published, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := publicOAS(testOASSpec("pets"))
+	assert.Equal(t, expected, published)
+	_, err = os.Stat(filepath.Join(dir, "hidden.json"))
+	assert.True(t, os.IsNotExist(err))
+
+	// only changed documents are written again
+	assert.NoError(t, ioutil.WriteFile(file, []byte("edited"), 0644))
+	publishOAS(map[string]*APISpec{"pets": testOASSpec("pets")})
+	published, _ = ioutil.ReadFile(file)
+	assert.Equal(t, "edited", string(published))
+
+	renamed := testOASSpec("pets")
+	renamed.Name = "Cats"
+	publishOAS(map[string]*APISpec{"pets": renamed})
+	published, _ = ioutil.ReadFile(file)
+	assert.Contains(t, string(published), "Cats")
+
+	// unpublished
+	publishOAS(map[string]*APISpec{})
+	_, err = os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestQueueOASPublish(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	globalConf := config.Global()
+	globalConf.OASPublish.Path = dir
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+	defer func() { publishedOAS = map[string][]byte{} }()
+
+	queueOASPublish(map[string]*APISpec{"pets": testOASSpec("pets")})
+	renamed := testOASSpec("pets")
+	renamed.Name = "Cats"
+	queueOASPublish(map[string]*APISpec{"pets": renamed})
+
+	// the document of the last reload is published last
+	file := filepath.Join(dir, "pets.json")
+	assert.Eventually(t, func() bool {
+		oasPublisher.Lock()
+		defer oasPublisher.Unlock()
+		published, _ := ioutil.ReadFile(file)
+		return !oasPublisher.running && strings.Contains(string(published), "Cats")
+	}, 5*time.Second, 10*time.Millisecond)
+}
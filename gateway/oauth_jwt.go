@@ -0,0 +1,296 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/lonelycode/osin"
+	jose "github.com/square/go-jose"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const (
+	OAuthTokenFormatJWT = "jwt"
+
+	// oauthSigningKeyName stores the RSA key the gateway generated to sign
+	// the access tokens of an API, encrypted with the node secret.
+	oauthSigningKeyName = "jwt-signing-key"
+	// oauthSigningKeyTTL is how long, in seconds, the generated key is kept
+	// after the API was last loaded, so that the keys of removed APIs don't
+	// linger.
+	oauthSigningKeyTTL = 90 * 24 * 60 * 60
+)
+
+var errOAuthSigningKeyPending = errors.New("the signing key isn't loaded yet")
+
+// oauthJWTClaimsData is what the templates of the custom claims are executed
+// against.
+type oauthJWTClaimsData struct {
+	ClientID       string
+	ClientMetaData interface{}
+	PolicyID       string
+	Policy         user.Policy
+	Scope          string
+	Session        *user.SessionState
+}
+
+// jwtAccessTokenGen issues signed JWT access tokens, so that resource servers
+// can validate them without calling the gateway. The token is still stored
+// like an opaque one, so that it can be revoked.
+type jwtAccessTokenGen struct {
+	spec   *APISpec
+	method jwt.SigningMethod
+	claims map[string]*template.Template
+
+	// key and jwk are set in the background when the gateways manage the
+	// key, for the API not to wait for it to be loaded.
+	keyMu sync.RWMutex
+	key   interface{}
+	jwk   *jose.JSONWebKey
+	// ready is closed once the key is set.
+	ready chan struct{}
+}
+
+func newJWTAccessTokenGen(spec *APISpec, store storage.Handler) (*jwtAccessTokenGen, error) {
+	meta := spec.Oauth2Meta
+	g := &jwtAccessTokenGen{
+		spec:   spec,
+		claims: make(map[string]*template.Template, len(meta.JWTClaims)),
+		ready:  make(chan struct{}),
+	}
+
+	switch meta.JWTSigningMethod {
+	case HMACSign:
+		if meta.JWTSigningKey == "" {
+			return nil, errors.New("an HMAC secret is required")
+		}
+		g.method = jwt.SigningMethodHS256
+		g.setKey([]byte(meta.JWTSigningKey), nil)
+	case RSASign:
+		g.method = jwt.SigningMethodRS256
+		if meta.JWTSigningKey == "" {
+			go g.loadManagedKey(store)
+			break
+		}
+
+		key, err := parseOAuthSigningKey(meta.JWTSigningKey)
+		if err != nil {
+			return nil, err
+		}
+		if err := g.setRSAKey(key); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported signing method %q", meta.JWTSigningMethod)
+	}
+
+	for name, text := range meta.JWTClaims {
+		tmpl, err := template.New(name).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("claim %q: %v", name, err)
+		}
+		g.claims[name] = tmpl
+	}
+
+	return g, nil
+}
+
+// publishesKey reports whether the tokens are signed with a public key, which
+// is published at the JWKS endpoint.
+func (g *jwtAccessTokenGen) publishesKey() bool {
+	return g.method == jwt.SigningMethodRS256
+}
+
+func (g *jwtAccessTokenGen) setKey(key interface{}, jwk *jose.JSONWebKey) {
+	g.keyMu.Lock()
+	g.key, g.jwk = key, jwk
+	g.keyMu.Unlock()
+	close(g.ready)
+}
+
+func (g *jwtAccessTokenGen) setRSAKey(key *rsa.PrivateKey) error {
+	jwk := &jose.JSONWebKey{Key: &key.PublicKey, Algorithm: g.method.Alg(), Use: "sig"}
+	thumbprint, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return err
+	}
+	jwk.KeyID = hex.EncodeToString(thumbprint)
+	g.setKey(key, jwk)
+	return nil
+}
+
+// signingKey returns the key tokens are signed with, and the key published
+// for RSA keys.
+func (g *jwtAccessTokenGen) signingKey() (interface{}, *jose.JSONWebKey, error) {
+	g.keyMu.RLock()
+	defer g.keyMu.RUnlock()
+	if g.key == nil {
+		return nil, nil, errOAuthSigningKeyPending
+	}
+	return g.key, g.jwk, nil
+}
+
+// loadManagedKey sets the RSA key the gateways manage for the API. Tokens
+// can't be issued until it is set.
+func (g *jwtAccessTokenGen) loadManagedKey(store storage.Handler) {
+	key, err := managedOAuthSigningKey(store)
+	if err == nil {
+		err = g.setRSAKey(key)
+	}
+	if err != nil {
+		log.WithError(err).WithField("api_id", g.spec.APIID).Error("[OAuth] Couldn't load the JWT signing key")
+	}
+}
+
+// parseOAuthSigningKey parses a PEM encoded RSA private key, which may also be
+// base64 encoded.
+func parseOAuthSigningKey(value string) (*rsa.PrivateKey, error) {
+	keyPEM := []byte(value)
+	if decoded, err := base64.StdEncoding.DecodeString(value); err == nil {
+		keyPEM = decoded
+	}
+	return jwt.ParseRSAPrivateKeyFromPEM(keyPEM)
+}
+
+// managedOAuthSigningKey returns the RSA key the gateways generated for an
+// API, generating it if there is none yet. Only one gateway generates it, the
+// others wait for it to be stored. The key is stored encrypted with the node
+// secret, which all the gateways of the cluster share.
+func managedOAuthSigningKey(store storage.Handler) (*rsa.PrivateKey, error) {
+	secret := []byte(rightPad2Len(config.Global().Secret, "=", 32))
+	for i := 0; i < 50; i++ {
+		if cryptoText, err := store.GetKey(oauthSigningKeyName); err == nil {
+			key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(decrypt(secret, cryptoText)))
+			if err != nil {
+				return nil, fmt.Errorf("couldn't decrypt the stored key, is the node secret the same on all gateways? %v", err)
+			}
+			if err := store.SetExp(oauthSigningKeyName, oauthSigningKeyTTL); err != nil {
+				log.WithError(err).Warning("[OAuth] Couldn't extend the expiry of the JWT signing key")
+			}
+			return key, nil
+		}
+
+		taken, err := incrementRawKey(store, oauthSigningKeyName+"-lock", 10)
+		if err != nil {
+			return nil, err
+		}
+		if taken == 1 {
+			key, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				return nil, err
+			}
+
+			keyPEM := pem.EncodeToMemory(&pem.Block{
+				Type:  "RSA PRIVATE KEY",
+				Bytes: x509.MarshalPKCS1PrivateKey(key),
+			})
+			if err := store.SetKey(oauthSigningKeyName, encrypt(secret, string(keyPEM)), oauthSigningKeyTTL); err != nil {
+				return nil, err
+			}
+			return key, nil
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return nil, errors.New("timed out waiting for the signing key to be generated")
+}
+
+// GenerateAccessToken generates a signed JWT access token and a base64-encoded
+// UUID refresh token
+func (g *jwtAccessTokenGen) GenerateAccessToken(data *osin.AccessData, generaterefresh bool) (accesstoken, refreshtoken string, err error) {
+	log.Info("[OAuth] Generating new JWT token")
+
+	session, err := oauthTokenSession(data)
+	if err != nil {
+		return "", "", err
+	}
+
+	// the token is signed with its final expiry
+	oauthAccessExpiry(g.spec, data)
+
+	claims := jwt.MapClaims{
+		"jti":       keyGen.GenerateAuthKey(session.OrgID),
+		"sub":       data.Client.GetId(),
+		"client_id": data.Client.GetId(),
+		"iat":       data.CreatedAt.Unix(),
+		"exp":       data.CreatedAt.Unix() + int64(data.ExpiresIn),
+	}
+	if g.spec.Oauth2Meta.JWTIssuer != "" {
+		claims["iss"] = g.spec.Oauth2Meta.JWTIssuer
+	}
+	if data.Scope != "" {
+		claims["scope"] = data.Scope
+	}
+	if policyID := data.Client.GetPolicyID(); policyID != "" {
+		claims["pol"] = policyID
+	}
+
+	if len(g.claims) > 0 {
+		claimsData := oauthJWTClaimsData{
+			ClientID:       data.Client.GetId(),
+			ClientMetaData: data.Client.GetUserData(),
+			PolicyID:       data.Client.GetPolicyID(),
+			Scope:          data.Scope,
+			Session:        session,
+		}
+		if claimsData.PolicyID != "" {
+			policiesMu.RLock()
+			claimsData.Policy = policiesByID[claimsData.PolicyID]
+			policiesMu.RUnlock()
+		}
+
+		for name, tmpl := range g.claims {
+			var value bytes.Buffer
+			if err := tmpl.Execute(&value, claimsData); err != nil {
+				log.WithError(err).Warning("[OAuth] Couldn't template JWT claim: ", name)
+				continue
+			}
+			claims[name] = value.String()
+		}
+	}
+
+	key, jwk, err := g.signingKey()
+	if err != nil {
+		return "", "", err
+	}
+	token := jwt.NewWithClaims(g.method, claims)
+	if jwk != nil {
+		token.Header["kid"] = jwk.KeyID
+	}
+	if accesstoken, err = token.SignedString(key); err != nil {
+		return "", "", err
+	}
+
+	if generaterefresh {
+		refreshtoken = generateRefreshToken()
+	}
+	return
+}
+
+// ServeHTTP publishes the public key tokens are signed with as a JSON Web Key
+// Set.
+func (g *jwtAccessTokenGen) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, jwk, err := g.signingKey()
+	if err != nil {
+		doJSONWrite(w, http.StatusServiceUnavailable, apiError(err.Error()))
+		return
+	}
+	doJSONWrite(w, http.StatusOK, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{*jwk}})
+}
@@ -0,0 +1,116 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	jose "github.com/square/go-jose"
+
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestOAuthJWTAccessTokens(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	store := getGlobalStorageHandler(generateOAuthPrefix("999999"), false)
+	store.DeleteKey(oauthSigningKeyName)
+	defer store.DeleteKey(oauthSigningKeyName)
+
+	checkToken := func(t *testing.T, token string, key interface{}) {
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+			return key, nil
+		})
+		if err != nil {
+			t.Fatal("Couldn't validate the token: ", err)
+		}
+
+		if claims["iss"] != "tyk" || claims["client_id"] != authClientID {
+			t.Errorf("Unexpected standard claims: %v", claims)
+		}
+		if claims["org"] != "53ac07777cbb8c2d53000002" || claims["client"] != authClientID {
+			t.Errorf("Unexpected templated claims: %v", claims)
+		}
+
+		// the token is also a regular OAuth token
+		_, _ = ts.Run(t, test.TestCase{
+			Path:    "/APIID/get",
+			Headers: map[string]string{"Authorization": "Bearer " + token},
+			Code:    http.StatusOK,
+		})
+	}
+
+	t.Run("Gateway managed RSA key", func(t *testing.T) {
+		spec := LoadAPI(buildTestOAuthSpec(func(spec *APISpec) {
+			spec.Oauth2Meta.AccessTokenFormat = OAuthTokenFormatJWT
+			spec.Oauth2Meta.JWTSigningMethod = RSASign
+			spec.Oauth2Meta.JWTIssuer = "tyk"
+			spec.Oauth2Meta.JWTClaims = map[string]string{
+				"org":    "{{.Session.OrgID}}",
+				"client": "{{.ClientID}}",
+			}
+		}))[0]
+		createTestOAuthClient(spec, authClientID)
+
+		tokenGen := spec.OAuthManager.OsinServer.AccessTokenGen.(*jwtAccessTokenGen)
+		select {
+		case <-tokenGen.ready:
+		case <-time.After(10 * time.Second):
+			t.Fatal("Timed out waiting for the signing key")
+		}
+
+		cryptoText, err := store.GetKey(oauthSigningKeyName)
+		if err != nil || strings.Contains(cryptoText, "PRIVATE KEY") {
+			t.Error("Expected the signing key to be stored encrypted: ", err)
+		}
+		if ttl, _ := store.GetExp(oauthSigningKeyName); ttl <= 0 {
+			t.Error("Expected the signing key to expire")
+		}
+
+		resp, _ := ts.Run(t, test.TestCase{Path: "/APIID/oauth/jwks", Code: http.StatusOK})
+		var keys jose.JSONWebKeySet
+		if err := json.NewDecoder(resp.Body).Decode(&keys); err != nil || len(keys.Keys) != 1 {
+			t.Fatal("Expected one published key: ", err)
+		}
+
+		checkToken(t, getToken(t, ts).AccessToken, keys.Keys[0].Key)
+	})
+
+	t.Run("HMAC secret", func(t *testing.T) {
+		spec := LoadAPI(buildTestOAuthSpec(func(spec *APISpec) {
+			spec.Oauth2Meta.AccessTokenFormat = OAuthTokenFormatJWT
+			spec.Oauth2Meta.JWTSigningMethod = HMACSign
+			spec.Oauth2Meta.JWTSigningKey = "secret"
+			spec.Oauth2Meta.JWTIssuer = "tyk"
+			spec.Oauth2Meta.JWTClaims = map[string]string{
+				"org":    "{{.Session.OrgID}}",
+				"client": "{{.ClientID}}",
+			}
+		}))[0]
+		createTestOAuthClient(spec, authClientID)
+
+		// no key is published for HMAC secrets
+		_, _ = ts.Run(t, test.TestCase{Path: "/APIID/oauth/jwks", BodyNotMatch: `"keys"`})
+
+		checkToken(t, getToken(t, ts).AccessToken, []byte("secret"))
+	})
+}
+
+func TestJWTAccessTokenGenPendingKey(t *testing.T) {
+	g := &jwtAccessTokenGen{method: jwt.SigningMethodRS256, ready: make(chan struct{})}
+
+	rec := httptest.NewRecorder()
+	g.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/oauth/jwks", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d until the key is loaded, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if _, _, err := g.signingKey(); err != errOAuthSigningKeyPending {
+		t.Error("Expected the key to be pending, got ", err)
+	}
+}
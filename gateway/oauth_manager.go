@@ -290,7 +290,6 @@ func (o *OAuthHandlers) HandleRevokeAllTokens(w http.ResponseWriter, r *http.Req
 		doJSONWrite(w, status, apiError(err.Error()))
 		return
 	}
-
 	n := Notification{
 		Command: KeySpaceUpdateNotification,
 		Payload: strings.Join(tokens, ","),
@@ -391,6 +390,12 @@ func (o *OAuthManager) HandleAccess(r *http.Request) *osin.Response {
 	if err := JSONToFormValues(r); err != nil {
 		log.Errorf("trying to set url values decoded from json body :%v", err)
 	}
+	if o.tokenExchangeEnabled(r) {
+		resp = o.HandleTokenExchange(r)
+		o.logAccessError(r, resp)
+		return resp
+	}
+
 	var username string
 
 	if ar := o.OsinServer.HandleAccessRequest(resp, r); ar != nil {
@@ -448,7 +453,9 @@ func (o *OAuthManager) HandleAccess(r *http.Request) *osin.Response {
 			oldToken, foundKey := session.OauthKeys[ar.Client.GetId()]
 			if foundKey {
 				log.Info("Found old token, revoking: ", oldToken)
-				GlobalSessionManager.RemoveSession(o.API.OrgID, oldToken, false)
+				if GlobalSessionManager.RemoveSession(o.API.OrgID, oldToken, false) {
+					emitKeyspaceEvent(KeyspaceEventRevoked, o.API.OrgID, oldToken, false)
+				}
 			}
 		}
 
@@ -490,6 +497,12 @@ func (o *OAuthManager) HandleAccess(r *http.Request) *osin.Response {
 			}
 		}
 	}
+	o.logAccessError(r, resp)
+
+	return resp
+}
+
+func (o *OAuthManager) logAccessError(r *http.Request, resp *osin.Response) {
 	if resp.IsError {
 		clientId := r.Form.Get("client_id")
 		log.WithFields(logrus.Fields{
@@ -500,8 +513,6 @@ func (o *OAuthManager) HandleAccess(r *http.Request) *osin.Response {
 			"RemoteAddr":     request.RealIP(r), //r.RemoteAddr,
 		}).Error("[OAuth] OAuth response marked as error")
 	}
-
-	return resp
 }
 
 // These enums fix the prefix to use when storing various OAuth keys and data, since we
@@ -589,6 +600,7 @@ type RedisOsinStorageInterface struct {
 	sessionManager SessionHandler
 	redisStore     storage.Handler
 	orgID          string
+	spec           *APISpec
 }
 
 func (r *RedisOsinStorageInterface) Clone() osin.Storage {
@@ -926,6 +938,9 @@ func (r *RedisOsinStorageInterface) RemoveAuthorize(code string) error {
 
 // SaveAccess will save a token and it's access data to redis
 func (r *RedisOsinStorageInterface) SaveAccess(accessData *osin.AccessData) error {
+	meta := r.spec.Oauth2Meta
+	sessionRemaining := oauthAccessExpiry(r.spec, accessData)
+
 	authDataJSON, err := json.Marshal(accessData)
 	if err != nil {
 		return err
@@ -933,11 +948,6 @@ func (r *RedisOsinStorageInterface) SaveAccess(accessData *osin.AccessData) erro
 	key := prefixAccess + storage.HashKey(accessData.AccessToken)
 	log.Debug("Saving ACCESS key: ", key)
 
-	// Overide default ExpiresIn:
-	if oauthTokenExpire := config.Global().OauthTokenExpire; oauthTokenExpire != 0 {
-		accessData.ExpiresIn = oauthTokenExpire
-	}
-
 	r.store.SetKey(key, string(authDataJSON), int64(accessData.ExpiresIn))
 
 	// add code to list of tokens for this client
@@ -996,7 +1006,9 @@ func (r *RedisOsinStorageInterface) SaveAccess(accessData *osin.AccessData) erro
 	}
 
 	// Use the default session expiry here as this is OAuth
-	r.sessionManager.UpdateSession(accessData.AccessToken, newSession, int64(accessData.ExpiresIn), false)
+	if err := r.sessionManager.UpdateSession(accessData.AccessToken, newSession, int64(accessData.ExpiresIn), false); err == nil {
+		emitKeyspaceEvent(KeyspaceEventCreated, newSession.OrgID, accessData.AccessToken, false)
+	}
 
 	// Store the refresh token too
 	if accessData.RefreshToken != "" {
@@ -1009,6 +1021,15 @@ func (r *RedisOsinStorageInterface) SaveAccess(accessData *osin.AccessData) erro
 		if oauthRefreshExpire := config.Global().OauthRefreshExpire; oauthRefreshExpire != 0 {
 			refreshExpire = oauthRefreshExpire
 		}
+		if meta.RefreshTokenExpire > 0 {
+			refreshExpire = meta.RefreshTokenExpire
+		}
+		if idleExpire := int64(accessData.ExpiresIn) + meta.IdleTimeout; meta.IdleTimeout > 0 && idleExpire < refreshExpire {
+			refreshExpire = idleExpire
+		}
+		if meta.SessionLifetime > 0 && sessionRemaining < refreshExpire {
+			refreshExpire = sessionRemaining
+		}
 		r.store.SetKey(key, string(accessDataJSON), refreshExpire)
 		log.Debug("STORING ACCESS DATA: ", string(accessDataJSON))
 		return nil
@@ -1017,6 +1038,40 @@ func (r *RedisOsinStorageInterface) SaveAccess(accessData *osin.AccessData) erro
 	return nil
 }
 
+// oauthAccessExpiry applies the gateway and API limits to the expiry of an
+// access token. It returns the seconds left in the session of the token when
+// the API limits the session lifetime.
+func oauthAccessExpiry(spec *APISpec, accessData *osin.AccessData) (sessionRemaining int64) {
+	// Overide default ExpiresIn:
+	if oauthTokenExpire := config.Global().OauthTokenExpire; oauthTokenExpire != 0 {
+		accessData.ExpiresIn = oauthTokenExpire
+	}
+
+	// Tokens never outlive the session, tokens issued before the session
+	// lifetime was set keep their own expiry.
+	if lifetime := spec.Oauth2Meta.SessionLifetime; lifetime > 0 {
+		sessionEnd := oauthSessionStart(accessData).Add(time.Duration(lifetime) * time.Second)
+		sessionRemaining = int64(time.Until(sessionEnd).Seconds())
+		if sessionRemaining < 1 {
+			sessionRemaining = 1
+		}
+		if int64(accessData.ExpiresIn) > sessionRemaining {
+			accessData.ExpiresIn = int32(sessionRemaining)
+		}
+	}
+
+	return sessionRemaining
+}
+
+// oauthSessionStart returns when the first token of a session was issued,
+// following the tokens it was refreshed from.
+func oauthSessionStart(accessData *osin.AccessData) time.Time {
+	for accessData.AccessData != nil {
+		accessData = accessData.AccessData
+	}
+	return accessData.CreatedAt
+}
+
 // LoadAccess will load access data from redis
 func (r *RedisOsinStorageInterface) LoadAccess(token string) (*osin.AccessData, error) {
 	key := prefixAccess + storage.HashKey(token)
@@ -1060,7 +1115,9 @@ func (r *RedisOsinStorageInterface) RemoveAccess(token string) error {
 	key := prefixAccess + storage.HashKey(token)
 	r.store.DeleteKey(key)
 	// remove the access token from central storage too
-	r.sessionManager.RemoveSession(r.orgID, token, false)
+	if r.sessionManager.RemoveSession(r.orgID, token, false) {
+		emitKeyspaceEvent(KeyspaceEventRevoked, r.orgID, token, false)
+	}
 	return nil
 }
 
@@ -1101,11 +1158,26 @@ type accessTokenGen struct{}
 func (accessTokenGen) GenerateAccessToken(data *osin.AccessData, generaterefresh bool) (accesstoken, refreshtoken string, err error) {
 	log.Info("[OAuth] Generating new token")
 
-	var newSession user.SessionState
+	newSession, err := oauthTokenSession(data)
+	if err != nil {
+		return "", "", err
+	}
+
+	accesstoken = keyGen.GenerateAuthKey(newSession.OrgID)
+	if generaterefresh {
+		refreshtoken = generateRefreshToken()
+	}
+	return
+}
+
+// oauthTokenSession returns the session a token is issued for, from the key
+// rules of the request or else from the policy of the client.
+func oauthTokenSession(data *osin.AccessData) (*user.SessionState, error) {
+	newSession := &user.SessionState{}
 	checkPolicy := true
 	if data.UserData != nil {
 		checkPolicy = false
-		err := json.Unmarshal([]byte(data.UserData.(string)), &newSession)
+		err := json.Unmarshal([]byte(data.UserData.(string)), newSession)
 		if err != nil {
 			log.Info("[GenerateAccessToken] Couldn't decode user.SessionState from UserData, checking policy: ", err)
 			checkPolicy = true
@@ -1116,18 +1188,18 @@ func (accessTokenGen) GenerateAccessToken(data *osin.AccessData, generaterefresh
 		// defined in JWT middleware
 		sessionFromPolicy, err := generateSessionFromPolicy(data.Client.GetPolicyID(), "", false)
 		if err != nil {
-			return "", "", errors.New("Couldn't use policy or key rules to create token, failing")
+			return nil, errors.New("Couldn't use policy or key rules to create token, failing")
 		}
 
-		newSession = sessionFromPolicy.Clone()
+		newSession = &sessionFromPolicy
 	}
 
-	accesstoken = keyGen.GenerateAuthKey(newSession.OrgID)
-	if generaterefresh {
-		u6 := uuid.NewV4()
-		refreshtoken = base64.StdEncoding.EncodeToString([]byte(u6.String()))
-	}
-	return
+	return newSession, nil
+}
+
+func generateRefreshToken() string {
+	u6 := uuid.NewV4()
+	return base64.StdEncoding.EncodeToString([]byte(u6.String()))
 }
 
 // LoadRefresh will load access data from Redis
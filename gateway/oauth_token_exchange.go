@@ -0,0 +1,256 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/lonelycode/osin"
+
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// Token exchange (RFC 8693) identifiers.
+const (
+	oauthGrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	oauthTokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+	oauthTokenTypeIDToken     = "urn:ietf:params:oauth:token-type:id_token"
+	oauthTokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// tokenExchangeEnabled reports whether r is a token exchange request the API
+// accepts.
+func (o *OAuthManager) tokenExchangeEnabled(r *http.Request) bool {
+	return o.API.Oauth2Meta.TokenExchange.Enabled && r.Form.Get("grant_type") == oauthGrantTypeTokenExchange
+}
+
+// HandleTokenExchange exchanges the JWT of an external identity provider for
+// an access token of the API. The policies of the token are mapped from the
+// claims of the subject token, or else are the policy of the client.
+func (o *OAuthManager) HandleTokenExchange(r *http.Request) *osin.Response {
+	resp := o.OsinServer.NewResponse()
+
+	client := o.tokenExchangeClient(resp, r)
+	if client == nil {
+		return resp
+	}
+
+	switch r.Form.Get("subject_token_type") {
+	case oauthTokenTypeJWT, oauthTokenTypeIDToken, oauthTokenTypeAccessToken:
+	default:
+		resp.SetError(osin.E_INVALID_REQUEST, "unsupported subject_token_type")
+		return resp
+	}
+
+	claims, err := o.validateSubjectToken(r.Form.Get("subject_token"))
+	if err != nil {
+		resp.SetError(osin.E_INVALID_GRANT, "invalid subject_token")
+		resp.InternalError = err
+		return resp
+	}
+
+	session, err := o.tokenExchangeSession(claims)
+	if err != nil {
+		resp.SetError(osin.E_INVALID_GRANT, err.Error())
+		resp.InternalError = err
+		return resp
+	}
+
+	ar := &osin.AccessRequest{
+		Type:        oauthGrantTypeTokenExchange,
+		Client:      client,
+		Scope:       r.Form.Get("scope"),
+		Authorized:  true,
+		Expiration:  o.OsinServer.Config.AccessExpiration,
+		HttpRequest: r,
+	}
+	if session != nil {
+		asString, _ := json.Marshal(session)
+		ar.UserData = string(asString)
+	}
+
+	o.OsinServer.FinishAccessRequest(resp, r, ar)
+	if !resp.IsError {
+		resp.Output["issued_token_type"] = oauthTokenTypeAccessToken
+	}
+
+	return resp
+}
+
+// tokenExchangeClient authenticates the client of a token exchange request,
+// with basic auth or, when the API allows it, the client_secret parameter.
+func (o *OAuthManager) tokenExchangeClient(resp *osin.Response, r *http.Request) osin.Client {
+	auth, err := osin.CheckBasicAuth(r)
+	if err != nil {
+		resp.SetError(osin.E_INVALID_REQUEST, "")
+		resp.InternalError = err
+		return nil
+	}
+	if auth == nil && o.OsinServer.Config.AllowClientSecretInParams && r.Form.Get("client_id") != "" {
+		auth = &osin.BasicAuth{Username: r.Form.Get("client_id"), Password: r.Form.Get("client_secret")}
+	}
+	if auth == nil {
+		resp.SetError(osin.E_INVALID_REQUEST, "")
+		resp.InternalError = errors.New("Client authentication not sent")
+		return nil
+	}
+
+	client, err := o.OsinServer.Storage.GetClient(auth.Username)
+	if err != nil || client == nil || client.GetSecret() != auth.Password {
+		resp.SetError(osin.E_UNAUTHORIZED_CLIENT, "")
+		resp.InternalError = err
+		return nil
+	}
+
+	return client
+}
+
+// validateSubjectToken verifies the signature, lifetime, issuer and audience
+// of a subject token and returns its claims.
+func (o *OAuthManager) validateSubjectToken(rawJWT string) (jwt.MapClaims, error) {
+	if rawJWT == "" {
+		return nil, errors.New("subject_token is missing")
+	}
+
+	conf := o.API.Oauth2Meta.TokenExchange
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	claims := jwt.MapClaims{}
+	token, err := parser.ParseWithClaims(rawJWT, claims, func(token *jwt.Token) (interface{}, error) {
+		return o.subjectTokenKey(token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("subject_token is invalid")
+	}
+
+	now := time.Now().Unix()
+	// subject tokens without an expiry would be exchangeable forever
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("subject_token has no expiry")
+	}
+	if !claims.VerifyExpiresAt(now, true) {
+		return nil, errors.New("subject_token has expired")
+	}
+	if !claims.VerifyNotBefore(now, false) {
+		return nil, errors.New("subject_token is not valid yet")
+	}
+	if conf.Issuer != "" && !claims.VerifyIssuer(conf.Issuer, true) {
+		return nil, errors.New("subject_token has an unexpected issuer")
+	}
+	if conf.Audience != "" && !claimContains(claims["aud"], conf.Audience) {
+		return nil, errors.New("subject_token has an unexpected audience")
+	}
+
+	return claims, nil
+}
+
+// subjectTokenKey returns the key the signature of a subject token is verified
+// with, from the JWKS at the configured source or the source itself.
+func (o *OAuthManager) subjectTokenKey(token *jwt.Token) (interface{}, error) {
+	conf := o.API.Oauth2Meta.TokenExchange
+
+	switch conf.SigningMethod {
+	case RSASign:
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("Unexpected signing method: %v and not RSA signature", token.Header["alg"])
+		}
+	case ECDSASign:
+		if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
+			return nil, fmt.Errorf("Unexpected signing method: %v and not ECDSA signature", token.Header["alg"])
+		}
+	default:
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("Unexpected signing method: %v and not HMAC signature", token.Header["alg"])
+		}
+	}
+
+	if httpScheme.MatchString(conf.Source) {
+		jwkSet, err := fetchJWKS("token-exchange-"+o.API.APIID, conf.Source)
+		if err != nil {
+			return nil, err
+		}
+		kid, _ := token.Header[KID].(string)
+		if keys := jwkSet.Key(kid); len(keys) > 0 {
+			return keys[0].Key, nil
+		}
+		return nil, errors.New("No matching KID could be found")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(conf.Source)
+	if err != nil {
+		return nil, err
+	}
+	if conf.SigningMethod == RSASign || conf.SigningMethod == ECDSASign {
+		return ParseRSAPublicKey(decoded)
+	}
+	return decoded, nil
+}
+
+// tokenExchangeSession returns the session of the issued token, with the
+// policies mapped from the claims of the subject token. It returns nil when
+// no policy is mapped, so that the policy of the client applies.
+func (o *OAuthManager) tokenExchangeSession(claims jwt.MapClaims) (*user.SessionState, error) {
+	conf := o.API.Oauth2Meta.TokenExchange
+
+	identityClaim := conf.IdentityClaim
+	if identityClaim == "" {
+		identityClaim = SUB
+	}
+	identity, _ := claims[identityClaim].(string)
+	if identity == "" {
+		return nil, fmt.Errorf("subject_token has no %s claim", identityClaim)
+	}
+
+	policyClaim := conf.PolicyClaim
+	if policyClaim == "" {
+		policyClaim = "scope"
+	}
+	var values []string
+	switch v := claims[policyClaim].(type) {
+	case []interface{}:
+		for _, value := range v {
+			if s, ok := value.(string); ok {
+				values = append(values, s)
+			}
+		}
+	case string:
+		values = getScopeFromClaim(claims, policyClaim)
+	}
+
+	policyIDs := mapScopeToPolicies(conf.PolicyMapping, values)
+	if len(policyIDs) == 0 {
+		return nil, nil
+	}
+
+	session, err := generateSessionFromPolicy(policyIDs[0], o.API.OrgID, true)
+	if err != nil {
+		return nil, err
+	}
+	session.SetPolicies(policyIDs...)
+	session.Alias = identity
+
+	return &session, nil
+}
+
+// claimContains reports whether a claim, a string or a list of strings,
+// contains value.
+func claimContains(claim interface{}, value string) bool {
+	switch v := claim.(type) {
+	case string:
+		return v == value
+	case []interface{}:
+		for _, item := range v {
+			if item == value {
+				return true
+			}
+		}
+	}
+	return false
+}
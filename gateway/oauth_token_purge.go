@@ -0,0 +1,193 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+const (
+	oauthTokenPurgeDefaultInterval  = time.Hour
+	oauthTokenPurgeDefaultBatchSize = 100
+	oauthTokenPurgeBatchPause       = 100 * time.Millisecond
+
+	oauthTokenPurgeLockKey   = "oauth-token-purge-lock"
+	oauthTokenPurgeStatusKey = "oauth-token-purge-status"
+)
+
+// oauthTokenPurgeStatus reports the last purge of lapsed OAuth tokens, made by
+// any gateway of the cluster.
+//
+// swagger:model oauthTokenPurgeStatus
+type oauthTokenPurgeStatus struct {
+	Enabled   bool  `json:"enabled"`
+	Interval  int64 `json:"interval"`
+	BatchSize int   `json:"batch_size"`
+
+	Runs              int64     `json:"runs"`
+	LastRun           time.Time `json:"last_run"`
+	LastRunDuration   int64     `json:"last_run_duration_ms"`
+	ListsScanned      int       `json:"lists_scanned"`
+	TokensPurged      int       `json:"tokens_purged"`
+	TotalTokensPurged int64     `json:"total_tokens_purged"`
+}
+
+// oauthTokenPurgeStore reads the OAuth data of all APIs, without hashing key
+// names.
+func oauthTokenPurgeStore() storage.Handler {
+	return &storage.RedisCluster{KeyPrefix: "oauth-data."}
+}
+
+func loadOauthTokenPurgeStatus() oauthTokenPurgeStatus {
+	var status oauthTokenPurgeStatus
+	if data, err := (&storage.RedisCluster{}).GetRawKey(oauthTokenPurgeStatusKey); err == nil {
+		if err := json.Unmarshal([]byte(data), &status); err != nil {
+			log.WithError(err).Error("Couldn't unmarshal OAuth token purge status")
+		}
+	}
+
+	conf := config.Global().OauthTokenPurge
+	status.Enabled = conf.Enabled
+	status.Interval = int64(oauthTokenPurgeInterval(conf).Seconds())
+	status.BatchSize = oauthTokenPurgeBatchSize(conf)
+	return status
+}
+
+func oauthTokenPurgeInterval(conf config.OauthTokenPurgeConfig) time.Duration {
+	if conf.Interval > 0 {
+		return time.Duration(conf.Interval) * time.Second
+	}
+	return oauthTokenPurgeDefaultInterval
+}
+
+func oauthTokenPurgeBatchSize(conf config.OauthTokenPurgeConfig) int {
+	if conf.BatchSize > 0 {
+		return conf.BatchSize
+	}
+	return oauthTokenPurgeDefaultBatchSize
+}
+
+// purgeLapsedOAuthTokens removes, from the token lists of all OAuth clients,
+// the tokens that expired more than oauth_token_expired_retain_period seconds
+// ago. The lists are purged in batches as they are scanned, and it stops
+// early if the context is done.
+func purgeLapsedOAuthTokens(ctx context.Context, store storage.Handler, batchSize int) (lists, purged int) {
+	cutoff := strconv.FormatInt(time.Now().Unix()-int64(config.Global().OauthTokenExpiredRetainPeriod), 10)
+
+	batch := make([]string, 0, batchSize)
+	purgeBatch := func() {
+		for _, key := range batch {
+			lists++
+			lapsed, _, err := store.GetSortedSetRange(key, "-inf", cutoff)
+			if err != nil || len(lapsed) == 0 {
+				continue
+			}
+			if err := store.RemoveSortedSetRange(key, "-inf", cutoff); err != nil {
+				continue
+			}
+			purged += len(lapsed)
+		}
+		batch = batch[:0]
+	}
+
+	err := scanKeys(store, "*"+prefixClientTokens, func(key string) error {
+		batch = append(batch, key)
+		if len(batch) < batchSize {
+			return nil
+		}
+		purgeBatch()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(oauthTokenPurgeBatchPause):
+		}
+		return nil
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			log.WithError(err).Error("Couldn't scan the OAuth client token lists")
+		}
+		return lists, purged
+	}
+	purgeBatch()
+
+	return lists, purged
+}
+
+// oauthTokenPurgeLoop purges lapsed OAuth tokens every interval. Only one
+// gateway of the cluster purges them each interval.
+func oauthTokenPurgeLoop(ctx context.Context, conf config.OauthTokenPurgeConfig) {
+	interval := oauthTokenPurgeInterval(conf)
+	batchSize := oauthTokenPurgeBatchSize(conf)
+
+	lock := &storage.RedisCluster{}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		// The lock expires slightly before the next run, so that the
+		// gateway holding it does not skip one.
+		taken, err := incrementRawKey(lock, oauthTokenPurgeLockKey, int64((interval-interval/10).Seconds()))
+		switch {
+		case err != nil:
+			log.WithError(err).Error("Couldn't take the OAuth token purge lock")
+		case taken == 1:
+			runOauthTokenPurge(ctx, batchSize)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+func runOauthTokenPurge(ctx context.Context, batchSize int) {
+	start := time.Now()
+	lists, purged := purgeLapsedOAuthTokens(ctx, oauthTokenPurgeStore(), batchSize)
+
+	status := loadOauthTokenPurgeStatus()
+	status.Runs++
+	status.LastRun = start
+	status.LastRunDuration = int64(time.Since(start) / time.Millisecond)
+	status.ListsScanned = lists
+	status.TokensPurged = purged
+	status.TotalTokensPurged += int64(purged)
+
+	log.WithFields(logrus.Fields{
+		"prefix": "oauth",
+		"lists":  lists,
+		"purged": purged,
+	}).Info("Purged lapsed OAuth tokens")
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		log.WithError(err).Error("Couldn't marshal OAuth token purge status")
+		return
+	}
+	if err := (&storage.RedisCluster{}).SetRawKey(oauthTokenPurgeStatusKey, string(data), 0); err != nil {
+		log.WithError(err).Error("Couldn't store OAuth token purge status")
+	}
+}
+
+// Get OAuth token purge status
+// Reports the last background purge of lapsed tokens from the OAuth client
+// token lists, and the totals since the status was first stored.
+//
+//---
+// responses:
+//   200:
+//     description: OAuth token purge status
+//     schema:
+//       "$ref": "#/definitions/oauthTokenPurgeStatus"
+func oauthTokenPurgeStatusHandler(w http.ResponseWriter, r *http.Request) {
+	doJSONWrite(w, http.StatusOK, loadOauthTokenPurgeStatus())
+}
@@ -0,0 +1,61 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestOauthTokenPurge(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	raw := &storage.RedisCluster{}
+	raw.DeleteRawKey(oauthTokenPurgeStatusKey)
+	defer raw.DeleteRawKey(oauthTokenPurgeStatusKey)
+
+	store := oauthTokenPurgeStore()
+	now := time.Now().Unix()
+	lists := []string{
+		"purge-api." + prefixClientTokens + "client-1",
+		"purge-api." + prefixClientTokens + "client-2",
+	}
+	for _, key := range lists {
+		store.DeleteKey(key)
+		defer store.DeleteKey(key)
+
+		store.AddToSortedSet(key, "lapsed", float64(now-3600))
+		store.AddToSortedSet(key, "valid", float64(now+3600))
+	}
+
+	runOauthTokenPurge(context.Background(), 1)
+
+	for _, key := range lists {
+		tokens, _, err := store.GetSortedSetRange(key, "-inf", "+inf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tokens) != 1 || tokens[0] != "valid" {
+			t.Errorf("Expected only the valid token to be left in %s, got %v", key, tokens)
+		}
+	}
+
+	_, _ = ts.Run(t, test.TestCase{
+		Path: "/tyk/oauth/tokens/purge", AdminAuth: true, Code: http.StatusOK,
+		BodyMatchFunc: func(body []byte) bool {
+			var status oauthTokenPurgeStatus
+			if err := json.Unmarshal(body, &status); err != nil {
+				t.Error(err)
+				return false
+			}
+			return status.Runs == 1 && status.ListsScanned >= 2 &&
+				status.TokensPurged >= 2 && status.TotalTokensPurged == int64(status.TokensPurged) &&
+				status.Interval == int64(oauthTokenPurgeDefaultInterval.Seconds())
+		},
+	})
+}
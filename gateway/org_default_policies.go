@@ -0,0 +1,68 @@
+package gateway
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// orgDefaultPoliciesMeta is the org session metadata listing the default
+// policies of the org, as an array or a comma separated string.
+const orgDefaultPoliciesMeta = "default_policies"
+
+func policyIDsFromMeta(val interface{}) []string {
+	var ids []string
+	switch x := val.(type) {
+	case string:
+		for _, id := range strings.Split(x, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	case []string:
+		ids = x
+	case []interface{}:
+		for _, id := range x {
+			if s, ok := id.(string); ok && s != "" {
+				ids = append(ids, s)
+			}
+		}
+	}
+	return ids
+}
+
+// orgDefaultPolicies returns the policies applied to the keys of an org
+// created without any: those of the org session if it lists some, or else
+// those of the org in policies.default_policies.
+func orgDefaultPolicies(orgID string) []string {
+	if spec := getSpecForOrg(orgID); spec != nil {
+		if org, found := spec.OrgSessionManager.SessionDetail(orgID, orgID, false); found {
+			if ids := policyIDsFromMeta(org.MetaData[orgDefaultPoliciesMeta]); len(ids) > 0 {
+				return ids
+			}
+		}
+	}
+	return config.Global().Policies.DefaultPolicies[orgID]
+}
+
+// applyOrgDefaultPolicies gives a key being created the default policies of
+// its org, unless it has policies or access rights of its own, which the
+// policies would override.
+func applyOrgDefaultPolicies(session *user.SessionState) {
+	if len(session.GetPolicyIDs()) > 0 || len(session.AccessRights) > 0 {
+		return
+	}
+	ids := orgDefaultPolicies(session.OrgID)
+	if len(ids) == 0 {
+		return
+	}
+	session.SetPolicies(ids...)
+	log.WithFields(logrus.Fields{
+		"prefix":   "api",
+		"org_id":   session.OrgID,
+		"policies": ids,
+	}).Debug("Applied the default policies of the org to a new key")
+}
@@ -0,0 +1,83 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestPolicyIDsFromMeta(t *testing.T) {
+	tests := []struct {
+		val  interface{}
+		want []string
+	}{
+		{"a, b,,c", []string{"a", "b", "c"}},
+		{[]interface{}{"a", 1, "", "b"}, []string{"a", "b"}},
+		{[]string{"a"}, []string{"a"}},
+		{nil, nil},
+	}
+	for _, tc := range tests {
+		if got := policyIDsFromMeta(tc.val); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("policyIDsFromMeta(%v) = %v, want %v", tc.val, got, tc.want)
+		}
+	}
+}
+
+func TestOrgDefaultPolicies(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI()
+
+	defaultPolicy := CreatePolicy(func(p *user.Policy) {
+		p.AccessRights = map[string]user.AccessDefinition{"test": {APIID: "test", Versions: []string{"v1"}}}
+	})
+	otherPolicy := CreatePolicy(func(p *user.Policy) {
+		p.AccessRights = map[string]user.AccessDefinition{"test": {APIID: "test", Versions: []string{"v1"}}}
+	})
+
+	globalConf := config.Global()
+	globalConf.Policies.DefaultPolicies = map[string][]string{"default": {defaultPolicy}}
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	createKey := func(t *testing.T, accessRights map[string]user.AccessDefinition, policies ...string) []string {
+		session := CreateStandardSession()
+		session.AccessRights = accessRights
+		session.ApplyPolicies = policies
+		data, _ := json.Marshal(session)
+		resp, _ := ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/tyk/keys/create", Data: data, AdminAuth: true, Code: http.StatusOK})
+
+		var created apiModifyKeySuccess
+		_ = json.NewDecoder(resp.Body).Decode(&created)
+		resp, _ = ts.Run(t, test.TestCase{Path: "/tyk/keys/" + created.Key, AdminAuth: true, Code: http.StatusOK})
+
+		var got user.SessionState
+		_ = json.NewDecoder(resp.Body).Decode(&got)
+		return got.ApplyPolicies
+	}
+
+	t.Run("Without policies", func(t *testing.T) {
+		if got := createKey(t, nil); !reflect.DeepEqual(got, []string{defaultPolicy}) {
+			t.Errorf("Expected the default policies of the org, got %v", got)
+		}
+	})
+
+	t.Run("With policies", func(t *testing.T) {
+		if got := createKey(t, nil, otherPolicy); !reflect.DeepEqual(got, []string{otherPolicy}) {
+			t.Errorf("Expected the policies of the key, got %v", got)
+		}
+	})
+
+	t.Run("With access rights", func(t *testing.T) {
+		accessRights := map[string]user.AccessDefinition{"test": {APIID: "test", Versions: []string{"v1"}}}
+		if got := createKey(t, accessRights); len(got) != 0 {
+			t.Errorf("Expected no policies, got %v", got)
+		}
+	})
+}
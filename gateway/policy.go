@@ -184,6 +184,8 @@ func LoadPoliciesFromRPC(orgId string) (map[string]user.Policy, error) {
 		return nil, err
 	}
 
+	lastRPCPolicySync.Touch()
+
 	if err := saveRPCPoliciesBackup(rpcPolicies); err != nil {
 		log.Error(err)
 	}
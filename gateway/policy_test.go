@@ -774,6 +774,19 @@ func TestApplyPolicies(t *testing.T) {
 	}
 }
 
+func TestApplyPoliciesConflictingPolicyIDs(t *testing.T) {
+	bmid, _ := testPrepareApplyPolicies()
+
+	sess := user.NewSessionState()
+	sess.SetPolicies("nonpart2", "per_api_and_no_other_partitions", "per_api_with_the_same_api")
+	err, ok := bmid.ApplyPolicies(sess).(*policyApplyError)
+	if !ok {
+		t.Fatalf("Expected a policy apply error, got %v", err)
+	}
+	assert.Equal(t, PolicyErrorIncompatiblePartitions, err.Reason)
+	assert.Equal(t, []string{"per_api_and_no_other_partitions", "per_api_with_the_same_api"}, err.PolicyIDs)
+}
+
 func BenchmarkApplyPolicies(b *testing.B) {
 	b.ReportAllocs()
 
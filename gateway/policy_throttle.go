@@ -0,0 +1,173 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// throttleCheck is the throttle configuration of a policy, or of the limits
+// of one of its APIs when it is partitioned per API. Throttling retries a
+// rate limited request up to ThrottleRetryLimit times, ThrottleInterval
+// seconds apart, so it can hold a request for up to MaxDelay seconds.
+// swagger:model
+type throttleCheck struct {
+	ThrottleInterval   float64  `json:"throttle_interval"`
+	ThrottleRetryLimit int      `json:"throttle_retry_limit"`
+	Enabled            bool     `json:"enabled"`
+	MaxDelay           float64  `json:"max_delay"`
+	Errors             []string `json:"errors"`
+	Warnings           []string `json:"warnings"`
+}
+
+// policyThrottleReport is the validation of the throttle configuration of a
+// policy. Valid is false if the policy or one of its APIs has errors.
+// swagger:model
+type policyThrottleReport struct {
+	PolicyID string                   `json:"policy_id"`
+	Valid    bool                     `json:"valid"`
+	Policy   throttleCheck            `json:"policy"`
+	APIs     map[string]throttleCheck `json:"apis"`
+}
+
+func serverWriteTimeout() time.Duration {
+	if timeout := config.Global().HttpServerOptions.WriteTimeout; timeout > 0 {
+		return time.Duration(timeout) * time.Second
+	}
+	return defWriteTimeout
+}
+
+// checkThrottle validates the throttle settings of a rate limit. Negative
+// values disable throttling.
+func checkThrottle(interval float64, retryLimit int, rate, per float64) throttleCheck {
+	check := throttleCheck{
+		ThrottleInterval:   interval,
+		ThrottleRetryLimit: retryLimit,
+		Errors:             []string{},
+		Warnings:           []string{},
+	}
+
+	if retryLimit <= 0 {
+		if interval > 0 {
+			check.Warnings = append(check.Warnings, "throttle_interval has no effect without throttle_retry_limit")
+		}
+		return check
+	}
+
+	check.Enabled = true
+	if interval <= 0 {
+		check.Errors = append(check.Errors, "throttle_interval must be positive when throttle_retry_limit is set")
+		return check
+	}
+
+	check.MaxDelay = interval * float64(retryLimit)
+	if rate <= 0 || per <= 0 {
+		check.Warnings = append(check.Warnings, "throttling only applies to rate limited requests, but no rate limit is set")
+	} else if interval < per/rate {
+		check.Warnings = append(check.Warnings, fmt.Sprintf("throttle_interval is shorter than the time between two allowed requests (%gs), retries may be wasted", per/rate))
+	}
+	if timeout := serverWriteTimeout(); time.Duration(check.MaxDelay*float64(time.Second)) >= timeout {
+		check.Warnings = append(check.Warnings, fmt.Sprintf("throttled requests may be held for %gs, longer than the write timeout of the gateway (%s)", check.MaxDelay, timeout))
+	}
+
+	return check
+}
+
+// checkPolicyThrottle validates the throttle settings of a policy, and of the
+// per API limits of its access rights.
+func checkPolicyThrottle(policy user.Policy) policyThrottleReport {
+	report := policyThrottleReport{
+		PolicyID: policy.ID,
+		Policy:   checkThrottle(policy.ThrottleInterval, policy.ThrottleRetryLimit, policy.Rate, policy.Per),
+		APIs:     map[string]throttleCheck{},
+	}
+	report.Valid = len(report.Policy.Errors) == 0
+
+	apiIDs := make([]string, 0, len(policy.AccessRights))
+	for apiID := range policy.AccessRights {
+		apiIDs = append(apiIDs, apiID)
+	}
+	sort.Strings(apiIDs)
+
+	for _, apiID := range apiIDs {
+		limit := policy.AccessRights[apiID].Limit
+		if limit == nil {
+			continue
+		}
+		check := checkThrottle(limit.ThrottleInterval, limit.ThrottleRetryLimit, limit.Rate, limit.Per)
+		report.APIs[apiID] = check
+		if len(check.Errors) > 0 {
+			report.Valid = false
+		}
+	}
+
+	return report
+}
+
+// Validate the throttle configuration of a policy
+// Checks the throttle_interval and throttle_retry_limit of the policy in the
+// request body, and of the per API limits of its access rights, without
+// loading the policy.
+//
+//---
+// requestBody:
+//   content:
+//     application/json:
+//       schema:
+//         "$ref": "#/definitions/Policy"
+// responses:
+//   200:
+//     description: Throttle configuration report
+//     schema:
+//       "$ref": "#/definitions/policyThrottleReport"
+//   400:
+//     description: Malformed policy
+//     schema:
+//       "$ref": "#/definitions/apiStatusMessage"
+func validatePolicyThrottleHandler(w http.ResponseWriter, r *http.Request) {
+	var policy user.Policy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+		return
+	}
+
+	doJSONWrite(w, http.StatusOK, checkPolicyThrottle(policy))
+}
+
+// Get the throttle configuration of a policy
+// Checks the throttle_interval and throttle_retry_limit of a loaded policy,
+// and of the per API limits of its access rights.
+//
+//---
+// parameters:
+//   - name: polID
+//     in: path
+//     required: true
+//     type: string
+// responses:
+//   200:
+//     description: Throttle configuration report
+//     schema:
+//       "$ref": "#/definitions/policyThrottleReport"
+//   404:
+//     description: Policy not found
+//     schema:
+//       "$ref": "#/definitions/apiStatusMessage"
+func policyThrottleHandler(w http.ResponseWriter, r *http.Request) {
+	policiesMu.RLock()
+	policy, ok := policiesByID[mux.Vars(r)["polID"]]
+	policiesMu.RUnlock()
+	if !ok {
+		doJSONWrite(w, http.StatusNotFound, apiError("Policy not found"))
+		return
+	}
+
+	doJSONWrite(w, http.StatusOK, checkPolicyThrottle(policy))
+}
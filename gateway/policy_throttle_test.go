@@ -0,0 +1,73 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestCheckThrottle(t *testing.T) {
+	tests := []struct {
+		name       string
+		interval   float64
+		retryLimit int
+		rate, per  float64
+		enabled    bool
+		errors     int
+		warnings   int
+	}{
+		{name: "disabled", interval: -1, retryLimit: -1, rate: 10, per: 1},
+		{name: "interval without retries", interval: 1, retryLimit: 0, rate: 10, per: 1, warnings: 1},
+		{name: "retries without interval", interval: 0, retryLimit: 3, rate: 10, per: 1, enabled: true, errors: 1},
+		{name: "valid", interval: 1, retryLimit: 3, rate: 1, per: 1, enabled: true},
+		{name: "no rate limit", interval: 1, retryLimit: 3, enabled: true, warnings: 1},
+		{name: "interval shorter than rate", interval: 0.1, retryLimit: 3, rate: 1, per: 1, enabled: true, warnings: 1},
+		{name: "longer than write timeout", interval: 60, retryLimit: 3, rate: 1, per: 60, enabled: true, warnings: 1},
+	}
+
+	for _, tc := range tests {
+		check := checkThrottle(tc.interval, tc.retryLimit, tc.rate, tc.per)
+		if check.Enabled != tc.enabled || len(check.Errors) != tc.errors || len(check.Warnings) != tc.warnings {
+			t.Errorf("%s: unexpected check %+v", tc.name, check)
+		}
+	}
+}
+
+func TestPolicyThrottleAPI(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	policyID := CreatePolicy(func(p *user.Policy) {
+		p.Rate, p.Per = 1, 1
+		p.ThrottleInterval, p.ThrottleRetryLimit = 1, 3
+		p.AccessRights = map[string]user.AccessDefinition{"test": {
+			APIID: "test",
+			Limit: &user.APILimit{Rate: 1, Per: 1, ThrottleRetryLimit: 3},
+		}}
+	})
+
+	matchReport := func(valid bool, apiErrors []string) func([]byte) bool {
+		return func(body []byte) bool {
+			var report policyThrottleReport
+			if err := json.Unmarshal(body, &report); err != nil {
+				t.Error(err)
+				return false
+			}
+			return report.Valid == valid && report.Policy.MaxDelay == 3 &&
+				reflect.DeepEqual(report.APIs["test"].Errors, apiErrors)
+		}
+	}
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/tyk/policies/" + policyID + "/throttle", AdminAuth: true, Code: http.StatusOK,
+			BodyMatchFunc: matchReport(false, []string{"throttle_interval must be positive when throttle_retry_limit is set"})},
+		{Path: "/tyk/policies/unknown/throttle", AdminAuth: true, Code: http.StatusNotFound},
+		{Method: http.MethodPost, Path: "/tyk/policies/throttle/validate", AdminAuth: true, Code: http.StatusOK,
+			Data: user.Policy{Rate: 1, Per: 1, ThrottleInterval: 1, ThrottleRetryLimit: 3}, BodyMatchFunc: matchReport(true, nil)},
+		{Method: http.MethodPost, Path: "/tyk/policies/throttle/validate", AdminAuth: true, Code: http.StatusBadRequest, Data: "{"},
+	}...)
+}
@@ -0,0 +1,207 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const (
+	policyConflictFail      = "fail"
+	policyConflictSkip      = "skip"
+	policyConflictOverwrite = "overwrite"
+)
+
+// policyImportResult lists the imported policies by what happened to them.
+// Nothing is written on a dry run.
+// swagger:model
+type policyImportResult struct {
+	DryRun  bool     `json:"dry_run"`
+	Created []string `json:"created"`
+	Updated []string `json:"updated"`
+	Skipped []string `json:"skipped"`
+}
+
+// validateImportedPolicies checks that all policies can be imported: they
+// have a unique ID and a valid throttle configuration.
+func validateImportedPolicies(policies []user.Policy) error {
+	seen := map[string]bool{}
+	for _, policy := range policies {
+		if policy.ID == "" {
+			return fmt.Errorf("policy %q has no ID", policy.Name)
+		}
+		if seen[policy.ID] {
+			return fmt.Errorf("policy %s is listed more than once", policy.ID)
+		}
+		seen[policy.ID] = true
+
+		report := checkPolicyThrottle(policy)
+		if report.Valid {
+			continue
+		}
+		errs := report.Policy.Errors
+		for _, check := range report.APIs {
+			errs = append(errs, check.Errors...)
+		}
+		return fmt.Errorf("policy %s: %s", policy.ID, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// Export policies
+// Lists the loaded policies, optionally of one organisation, in the format
+// accepted by the policy import.
+//
+//---
+// parameters:
+//   - name: org_id
+//     in: query
+//     required: false
+//     type: string
+// responses:
+//   200:
+//     description: List of policies
+//     schema:
+//       type: array
+//       items:
+//         "$ref": "#/definitions/Policy"
+func exportPoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := r.URL.Query().Get("org_id")
+
+	policiesMu.RLock()
+	policies := make([]user.Policy, 0, len(policiesByID))
+	for _, policy := range policiesByID {
+		if orgID == "" || policy.OrgID == orgID {
+			policies = append(policies, policy)
+		}
+	}
+	policiesMu.RUnlock()
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].ID < policies[j].ID
+	})
+
+	doJSONWrite(w, http.StatusOK, policies)
+}
+
+// Import policies
+// Imports a list of policies, as exported from any gateway, into the policy
+// file. All policies are validated before any is written. Policies that
+// already exist fail the import, unless `conflict` is `skip` or `overwrite`.
+// With `dry_run=true`, the result is reported without writing anything.
+//
+//---
+// parameters:
+//   - name: conflict
+//     in: query
+//     required: false
+//     type: string
+//     enum: [fail, skip, overwrite]
+//   - name: dry_run
+//     in: query
+//     required: false
+//     type: boolean
+// responses:
+//   200:
+//     description: Import result
+//     schema:
+//       "$ref": "#/definitions/policyImportResult"
+//   400:
+//     description: Malformed or invalid policies, or policies not loaded from a file
+//     schema:
+//       "$ref": "#/definitions/apiStatusMessage"
+//   409:
+//     description: Policies already exist
+//     schema:
+//       "$ref": "#/definitions/apiStatusMessage"
+func importPoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	conflict := r.URL.Query().Get("conflict")
+	switch conflict {
+	case "":
+		conflict = policyConflictFail
+	case policyConflictFail, policyConflictSkip, policyConflictOverwrite:
+	default:
+		doJSONWrite(w, http.StatusBadRequest, apiError("conflict must be one of fail, skip or overwrite"))
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	if !dryRun && !policiesFromFile() {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Policies are not loaded from a policy file, import them where they are managed"))
+		return
+	}
+
+	var policies []user.Policy
+	if err := json.NewDecoder(r.Body).Decode(&policies); err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+		return
+	}
+	if err := validateImportedPolicies(policies); err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Invalid policies: "+err.Error()))
+		return
+	}
+
+	policiesMu.Lock()
+	defer policiesMu.Unlock()
+
+	result := policyImportResult{
+		DryRun:  dryRun,
+		Created: []string{},
+		Updated: []string{},
+		Skipped: []string{},
+	}
+	var conflicts []string
+	updated := make(map[string]user.Policy, len(policiesByID)+len(policies))
+	for id, policy := range policiesByID {
+		updated[id] = policy
+	}
+	for _, policy := range policies {
+		if _, exists := policiesByID[policy.ID]; exists {
+			switch conflict {
+			case policyConflictFail:
+				conflicts = append(conflicts, policy.ID)
+				continue
+			case policyConflictSkip:
+				result.Skipped = append(result.Skipped, policy.ID)
+				continue
+			}
+			result.Updated = append(result.Updated, policy.ID)
+		} else {
+			result.Created = append(result.Created, policy.ID)
+		}
+		updated[policy.ID] = policy
+	}
+	if len(conflicts) > 0 {
+		doJSONWrite(w, http.StatusConflict, apiError("Policies already exist: "+strings.Join(conflicts, ", ")))
+		return
+	}
+
+	if !dryRun && len(result.Created)+len(result.Updated) > 0 {
+		data, err := json.MarshalIndent(updated, "", "  ")
+		if err == nil {
+			err = writeFileAtomic(config.Global().Policies.PolicyRecordName, data, 0644)
+		}
+		if err != nil {
+			log.WithError(err).Error("Couldn't write policy file")
+			doJSONWrite(w, http.StatusInternalServerError, apiError("Couldn't write policy file, no policies were imported"))
+			return
+		}
+		policiesByID = updated
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix":  "api",
+		"created": len(result.Created),
+		"updated": len(result.Updated),
+		"skipped": len(result.Skipped),
+		"dry_run": dryRun,
+	}).Info("Imported policies")
+
+	doJSONWrite(w, http.StatusOK, result)
+}
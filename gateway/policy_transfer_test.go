@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestPolicyExportImport(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+	defer ResetTestConfig()
+
+	existingID := CreatePolicy(func(p *user.Policy) {
+		p.OrgID = "export-org"
+		p.Name = "existing"
+	})
+
+	var exported []user.Policy
+	resp, _ := ts.Run(t, test.TestCase{Path: "/tyk/policies/export?org_id=export-org", AdminAuth: true, Code: http.StatusOK})
+	json.NewDecoder(resp.Body).Decode(&exported)
+	if len(exported) != 1 || exported[0].ID != existingID {
+		t.Fatalf("Expected the policy of the org to be exported, got %+v", exported)
+	}
+
+	dir, err := ioutil.TempDir("", "tyk-policies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	policyFile := filepath.Join(dir, "policies.json")
+
+	updatedPolicy := exported[0]
+	updatedPolicy.Name = "updated"
+	newPolicy := user.Policy{ID: "imported-" + existingID, OrgID: "export-org", Name: "new"}
+	policies := []user.Policy{updatedPolicy, newPolicy}
+
+	matchResult := func(expect policyImportResult) func([]byte) bool {
+		return func(body []byte) bool {
+			var result policyImportResult
+			json.Unmarshal(body, &result)
+			return reflect.DeepEqual(result, expect)
+		}
+	}
+	importPath := "/tyk/policies/import"
+
+	_, _ = ts.Run(t, []test.TestCase{
+		// Policies are not loaded from a file
+		{Method: http.MethodPost, Path: importPath, Data: policies, AdminAuth: true, Code: http.StatusBadRequest},
+		{Method: http.MethodPost, Path: importPath + "?dry_run=true&conflict=skip", Data: policies, AdminAuth: true, Code: http.StatusOK,
+			BodyMatchFunc: matchResult(policyImportResult{DryRun: true, Created: []string{newPolicy.ID}, Updated: []string{}, Skipped: []string{existingID}})},
+	}...)
+
+	globalConf := config.Global()
+	globalConf.Policies.PolicySource = "file"
+	globalConf.Policies.PolicyRecordName = policyFile
+	config.SetGlobal(globalConf)
+
+	invalid := newPolicy
+	invalid.ThrottleRetryLimit = 3
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Method: http.MethodPost, Path: importPath, Data: policies, AdminAuth: true, Code: http.StatusConflict},
+		{Method: http.MethodPost, Path: importPath + "?conflict=other", Data: policies, AdminAuth: true, Code: http.StatusBadRequest},
+		{Method: http.MethodPost, Path: importPath, Data: []user.Policy{invalid}, AdminAuth: true, Code: http.StatusBadRequest},
+		{Method: http.MethodPost, Path: importPath, Data: []user.Policy{newPolicy, newPolicy}, AdminAuth: true, Code: http.StatusBadRequest},
+	}...)
+	if _, err := os.Stat(policyFile); !os.IsNotExist(err) {
+		t.Fatal("Expected failed imports not to write the policy file")
+	}
+
+	_, _ = ts.Run(t, test.TestCase{Method: http.MethodPost, Path: importPath + "?conflict=overwrite", Data: policies, AdminAuth: true, Code: http.StatusOK,
+		BodyMatchFunc: matchResult(policyImportResult{Created: []string{newPolicy.ID}, Updated: []string{existingID}, Skipped: []string{}})})
+
+	stored := LoadPoliciesFromFile(policyFile)
+	if stored[existingID].Name != "updated" || stored[newPolicy.ID].Name != "new" {
+		t.Errorf("Expected the policies to be written, got %+v", stored)
+	}
+	policiesMu.RLock()
+	policy, ok := policiesByID[newPolicy.ID]
+	policiesMu.RUnlock()
+	if !ok || policy.Name != "new" {
+		t.Error("Expected the imported policy to be loaded")
+	}
+}
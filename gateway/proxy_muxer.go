@@ -4,9 +4,9 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
-	"net/url"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -16,9 +16,11 @@ import (
 
 	"github.com/TykTechnologies/again"
 	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/request"
 	"github.com/TykTechnologies/tyk/tcp"
+	"github.com/gocraft/health"
 	proxyproto "github.com/pires/go-proxyproto"
-	cache "github.com/pmylund/go-cache"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
@@ -28,21 +30,43 @@ import (
 // handleWrapper's only purpose is to allow router to be dynamically replaced
 type handleWrapper struct {
 	router *mux.Router
+	// maxConnRequests closes HTTP/1 connections after this many requests.
+	maxConnRequests int
+	hardening       config.RequestHardeningConfig
 }
 
 // h2cWrapper tracks handleWrapper for swapping w.router on reloads.
 type h2cWrapper struct {
 	w *handleWrapper
 	h http.Handler
+	// h2s serves the HTTP/2 connections of inspected TLS listeners, with
+	// the timeouts of srv.
+	h2s *http2.Server
+	srv *http.Server
 }
 
 func (h *h2cWrapper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if serveInspectedHTTP2(w, r, h.w, h.h2s, h.srv) {
+		return
+	}
 	h.h.ServeHTTP(w, r)
 }
 
 func (h *handleWrapper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	restoreInspectedTLS(r)
+	if rejectInSelfProtection(w, r) {
+		return
+	}
 	// make request body to be nopCloser and re-readable before serve it through chain of middlewares
 	nopCloseRequestBody(r)
+	if rejectUnsafeRequest(w, r, h.hardening) {
+		return
+	}
+	w, finish := closeOnRefusedUpgrade(w, r)
+	defer finish()
+	if lastConnRequest(r, h.maxConnRequests) {
+		w.Header().Set(headers.Connection, "close")
+	}
 	if NewRelicApplication != nil {
 		txn := NewRelicApplication.StartTransaction(r.URL.Path, w, r)
 		defer txn.End()
@@ -59,7 +83,10 @@ type proxy struct {
 	useProxyProtocol bool
 	router           *mux.Router
 	httpServer       *http.Server
+	http3Server      io.Closer
 	tcpProxy         *tcp.Proxy
+	packetConn       net.PacketConn
+	udpProxy         *tcp.UDPProxy
 	started          bool
 }
 
@@ -67,15 +94,23 @@ func (p proxy) String() string {
 	ls := ""
 	if p.listener != nil {
 		ls = p.listener.Addr().String()
+	} else if p.packetConn != nil {
+		ls = p.packetConn.LocalAddr().String()
 	}
 	return fmt.Sprintf("[proxy] :%d %s", p.port, ls)
 }
 
 // getListener returns a net.Listener for this proxy. If useProxyProtocol is
-// true it wraps the underlying listener to support proxyprotocol.
+// true it wraps the underlying listener to support proxyprotocol. As the
+// PROXY header comes before the TLS handshake, TLS is then handled on top of
+// it rather than by the underlying listener.
 func (p proxy) getListener() net.Listener {
 	if p.useProxyProtocol {
-		return &proxyproto.Listener{Listener: p.listener}
+		l := net.Listener(&proxyproto.Listener{Listener: p.listener})
+		if p.protocol == "tls" {
+			l = tls.NewListener(l, listenerTLSConfig(p.port))
+		}
+		return l
 	}
 	return p.listener
 }
@@ -163,12 +198,24 @@ func (m *proxyMux) setRouter(port int, protocol string, router *mux.Router) {
 func (m *proxyMux) handle404(w http.ResponseWriter, r *http.Request) {
 	if config.Global().Track404Logs {
 		requestMeta := fmt.Sprintf("%s %s %s", r.Method, r.URL.Path, r.Proto)
-		log.WithField("request", requestMeta).WithField("origin", r.RemoteAddr).
+		log.WithField("request", requestMeta).WithField("origin", request.RealIP(r)).
 			Error(http.StatusText(http.StatusNotFound))
 	}
 
-	w.WriteHeader(http.StatusNotFound)
-	_, _ = fmt.Fprint(w, http.StatusText(http.StatusNotFound))
+	action, domain := handleUnmatchedRequest(w, r)
+	if action == "" {
+		action = unmatchedNotFound
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprint(w, http.StatusText(http.StatusNotFound))
+	}
+
+	job := instrument.NewJob("UnmatchedRequest")
+	job.EventKv(action, health.Kvs{
+		"domain": domain,
+		"host":   r.Host,
+		"method": r.Method,
+		"path":   r.URL.Path,
+	})
 }
 
 func (m *proxyMux) addTCPService(spec *APISpec, modifier *tcp.Modifier) {
@@ -180,6 +227,10 @@ func (m *proxyMux) addTCPService(spec *APISpec, modifier *tcp.Modifier) {
 	}
 
 	if p := m.getProxy(spec.ListenPort); p != nil {
+		if p.tcpProxy == nil {
+			mainLog.WithField("port", spec.ListenPort).Error("Can't run a TCP service on a port used by another protocol")
+			return
+		}
 		p.tcpProxy.AddDomainHandler(hostname, spec.Proxy.TargetURL, modifier)
 	} else {
 		tlsConfig := tlsClientConfig(spec)
@@ -189,8 +240,8 @@ func (m *proxyMux) addTCPService(spec *APISpec, modifier *tcp.Modifier) {
 			protocol:         spec.Protocol,
 			useProxyProtocol: spec.EnableProxyProtocol,
 			tcpProxy: &tcp.Proxy{
-				DialTLS:         dialWithServiceDiscovery(spec, customDialTLSCheck(spec, tlsConfig)),
-				Dial:            dialWithServiceDiscovery(spec, net.Dial),
+				DialTLS:         customDialTLSCheck(spec, tlsConfig),
+				Dial:            net.Dial,
 				TLSConfigTarget: tlsConfig,
 				// SyncStats:       recordTCPHit(spec.APIID, spec.DoNotTrack),
 			},
@@ -200,6 +251,28 @@ func (m *proxyMux) addTCPService(spec *APISpec, modifier *tcp.Modifier) {
 	}
 }
 
+// addUDPService adds an experimental UDP service. Datagrams carry no domain,
+// so a port serves a single UDP service.
+func (m *proxyMux) addUDPService(spec *APISpec, modifier *tcp.Modifier) {
+	if p := m.getProxy(spec.ListenPort); p != nil {
+		if p.udpProxy == nil {
+			mainLog.WithField("port", spec.ListenPort).Error("Can't run a UDP service on a port used by another protocol")
+			return
+		}
+		mainLog.WithField("port", spec.ListenPort).Warning("Multiple UDP services on the same port, using the last one")
+		p.udpProxy.SetTarget(spec.Proxy.TargetURL, modifier)
+		return
+	}
+
+	p := &proxy{
+		port:     spec.ListenPort,
+		protocol: spec.Protocol,
+		udpProxy: &tcp.UDPProxy{},
+	}
+	p.udpProxy.SetTarget(spec.Proxy.TargetURL, modifier)
+	m.proxies = append(m.proxies, p)
+}
+
 func flushNetworkAnalytics(ctx context.Context) {
 	mainLog.Debug("Starting routine for flushing network analytics")
 	tick := time.NewTicker(time.Second)
@@ -221,7 +294,8 @@ func flushNetworkAnalytics(ctx context.Context) {
 				if spec.DoNotTrack {
 					continue
 				}
-				record := AnalyticsRecord{
+				record := newAnalyticsRecord()
+				*record = AnalyticsRecord{
 					Network:      spec.network.Flush(),
 					Day:          t.Day(),
 					Month:        t.Month(),
@@ -234,7 +308,7 @@ func flushNetworkAnalytics(ctx context.Context) {
 					OrgID:        spec.OrgID,
 				}
 				record.SetExpiry(spec.ExpireAnalyticsAfter)
-				analytics.RecordHit(&record)
+				analytics.RecordHit(record)
 			}
 			apisMu.RUnlock()
 		}
@@ -263,59 +337,6 @@ func recordTCPHit(specID string, doNotTrack bool) func(tcp.Stat) {
 	}
 }
 
-type dialFn func(network string, address string) (net.Conn, error)
-
-func dialWithServiceDiscovery(spec *APISpec, dial dialFn) dialFn {
-	if dial == nil {
-		return nil
-	}
-	if spec.Proxy.ServiceDiscovery.UseDiscoveryService {
-		log.Debug("[PROXY] Service discovery enabled")
-		if ServiceCache == nil {
-			log.Debug("[PROXY] Service cache initialising")
-			expiry := 120
-			if spec.Proxy.ServiceDiscovery.CacheTimeout > 0 {
-				expiry = int(spec.Proxy.ServiceDiscovery.CacheTimeout)
-			} else if spec.GlobalConfig.ServiceDiscovery.DefaultCacheTimeout > 0 {
-				expiry = spec.GlobalConfig.ServiceDiscovery.DefaultCacheTimeout
-			}
-			ServiceCache = cache.New(time.Duration(expiry)*time.Second, 15*time.Second)
-		}
-	}
-	return func(network, address string) (net.Conn, error) {
-		hostList := spec.Proxy.StructuredTargetList
-		target := address
-		switch {
-		case spec.Proxy.ServiceDiscovery.UseDiscoveryService:
-			var err error
-			hostList, err = urlFromService(spec)
-			if err != nil {
-				log.Error("[PROXY] [SERVICE DISCOVERY] Failed target lookup: ", err)
-				break
-			}
-			log.Debug("[PROXY] [SERVICE DISCOVERY] received host list ", hostList.All())
-			fallthrough // implies load balancing, with replaced host list
-		case spec.Proxy.EnableLoadBalancing:
-			host, err := nextTarget(hostList, spec)
-			if err != nil {
-				log.Error("[PROXY] [LOAD BALANCING] ", err)
-				host = allHostsDownURL
-			}
-			lbRemote, err := url.Parse(host)
-			if err != nil {
-				log.Error("[PROXY] [LOAD BALANCING] Couldn't parse target URL:", err)
-			} else {
-				if lbRemote.Scheme == network {
-					target = lbRemote.Host
-				} else {
-					log.Errorf("[PROXY] [LOAD BALANCING] mis match scheme want:%s got: %s", network, lbRemote.Scheme)
-				}
-			}
-		}
-		return dial(network, target)
-	}
-}
-
 func (m *proxyMux) swap(new *proxyMux) {
 	m.Lock()
 	defer m.Unlock()
@@ -328,12 +349,17 @@ func (m *proxyMux) swap(new *proxyMux) {
 		if match == nil || match.protocol != curP.protocol {
 			mainLog.Infof("Found unused listener at port %d, shutting down", curP.port)
 
+			if curP.http3Server != nil {
+				curP.http3Server.Close()
+			}
 			if curP.httpServer != nil {
 				ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 				curP.httpServer.Shutdown(ctx)
 				cancel()
 			} else if curP.listener != nil {
 				curP.listener.Close()
+			} else if curP.packetConn != nil {
+				curP.packetConn.Close()
 			}
 			m.again.Delete(target(listenAddress, curP.port))
 		} else {
@@ -352,6 +378,9 @@ func (m *proxyMux) swap(new *proxyMux) {
 			if match.tcpProxy != nil {
 				match.tcpProxy.Swap(newP.tcpProxy)
 			}
+			if match.udpProxy != nil {
+				match.udpProxy.Swap(newP.udpProxy)
+			}
 			match.router = newP.router
 			if match.httpServer != nil {
 				switch e := match.httpServer.Handler.(type) {
@@ -359,6 +388,8 @@ func (m *proxyMux) swap(new *proxyMux) {
 					e.router = newP.router
 				case *h2cWrapper:
 					e.w.router = newP.router
+				case *altSvcWrapper:
+					e.w.router = newP.router
 				}
 			}
 		}
@@ -369,8 +400,12 @@ func (m *proxyMux) swap(new *proxyMux) {
 
 func (m *proxyMux) serve() {
 	for _, p := range m.proxies {
+		if p.protocol == "udp" {
+			m.serveUDP(p)
+			continue
+		}
 		if p.listener == nil {
-			listener, err := m.generateListener(p.port, p.protocol)
+			listener, err := m.generateListener(p.port, p.protocol, p.useProxyProtocol)
 			if err != nil {
 				mainLog.WithError(err).Error("Can't start listener")
 				continue
@@ -400,31 +435,66 @@ func (m *proxyMux) serve() {
 			if config.Global().HttpServerOptions.WriteTimeout > 0 {
 				writeTimeout = time.Duration(config.Global().HttpServerOptions.WriteTimeout) * time.Second
 			}
+			limits := connectionLimits(p.port)
+			hardening := config.Global().HttpServerOptions.RequestHardening
 			var h http.Handler
-			h = &handleWrapper{p.router}
+			h = &handleWrapper{router: p.router, maxConnRequests: limits.MaxRequestsPerConnection, hardening: hardening}
 			// by default enabling h2c by wrapping handler in h2c. This ensures all features including tracing work
 			// in h2c services.
-			h2s := &http2.Server{}
-			h = &h2cWrapper{
-				w: h.(*handleWrapper),
-				h: h2c.NewHandler(h, h2s),
+			h2s := &http2.Server{IdleTimeout: time.Duration(limits.IdleTimeout) * time.Second}
+			wrapper := &h2cWrapper{
+				w:   h.(*handleWrapper),
+				h:   h2c.NewHandler(h, h2s),
+				h2s: h2s,
 			}
+			h = wrapper
 			addr := config.Global().ListenAddress + ":" + strconv.Itoa(p.port)
+			if p.protocol == "https" && config.Global().HttpServerOptions.EnableHttp3 {
+				h = p.startHTTP3(addr, wrapper)
+			}
 			p.httpServer = &http.Server{
 				Addr:         addr,
 				ReadTimeout:  readTimeout,
 				WriteTimeout: writeTimeout,
+				IdleTimeout:  time.Duration(limits.IdleTimeout) * time.Second,
 				Handler:      h,
 			}
+			// HTTP/2 connections get the timeouts of the server
+			if err := http2.ConfigureServer(p.httpServer, h2s); err != nil {
+				mainLog.WithError(err).Error("Can't configure HTTP/2")
+			}
+			wrapper.srv = p.httpServer
+			p.httpServer.ConnContext = connContext
 			if config.Global().CloseConnections {
 				p.httpServer.SetKeepAlivesEnabled(false)
 			}
-			go p.httpServer.Serve(p.listener)
+			go p.httpServer.Serve(inspectListener(limitListener(p.listener, limits.MaxConnections), hardening))
 		}
 		p.started = true
 	}
 }
 
+func (m *proxyMux) serveUDP(p *proxy) {
+	if p.packetConn == nil {
+		packetConn, err := m.generatePacketListener(p.port)
+		if err != nil {
+			mainLog.WithError(err).Error("Can't start listener")
+			return
+		}
+
+		_, portS, _ := net.SplitHostPort(packetConn.LocalAddr().String())
+		port, _ := strconv.Atoi(portS)
+		p.port = port
+		p.packetConn = packetConn
+	}
+	if p.started {
+		return
+	}
+	mainLog.Warning("Starting UDP server on:", p.packetConn.LocalAddr().String())
+	go p.udpProxy.Serve(p.packetConn)
+	p.started = true
+}
+
 func target(listenAddress string, listenPort int) string {
 	return fmt.Sprintf("%s:%d", listenAddress, listenPort)
 }
@@ -440,7 +510,7 @@ func CheckPortWhiteList(w map[string]config.PortWhiteList, listenPort int, proto
 	return fmt.Errorf("%s:%d trying to open disabled port", protocol, listenPort)
 }
 
-func (m *proxyMux) generateListener(listenPort int, protocol string) (l net.Listener, err error) {
+func (m *proxyMux) generateListener(listenPort int, protocol string, useProxyProtocol bool) (l net.Listener, err error) {
 	listenAddress := config.Global().ListenAddress
 	if !config.Global().DisablePortWhiteList {
 		if err := CheckPortWhiteList(config.Global().PortWhiteList, listenPort, protocol); err != nil {
@@ -452,27 +522,17 @@ func (m *proxyMux) generateListener(listenPort int, protocol string) (l net.List
 	if ls := m.again.GetListener(targetPort); ls != nil {
 		return ls, nil
 	}
-	switch protocol {
-	case "https", "tls":
+	switch {
+	case protocol == "tls" && useProxyProtocol:
+		mainLog.Infof("--> Using TLS after PROXY protocol (%s)", protocol)
+		l, err = net.Listen("tcp", targetPort)
+	case protocol == "https", protocol == "tls":
 		mainLog.Infof("--> Using TLS (%s)", protocol)
-		httpServerOptions := config.Global().HttpServerOptions
-
-		tlsConfig := tls.Config{
-			GetCertificate:     dummyGetCertificate,
-			ServerName:         httpServerOptions.ServerName,
-			MinVersion:         httpServerOptions.MinVersion,
-			MaxVersion:         httpServerOptions.MaxVersion,
-			ClientAuth:         tls.NoClientCert,
-			InsecureSkipVerify: httpServerOptions.SSLInsecureSkipVerify,
-			CipherSuites:       getCipherAliases(httpServerOptions.Ciphers),
-		}
-
-		if httpServerOptions.EnableHttp2 {
+		tlsConfig := listenerTLSConfig(listenPort)
+		if config.Global().HttpServerOptions.EnableHttp2 {
 			tlsConfig.NextProtos = append(tlsConfig.NextProtos, http2.NextProtoTLS)
 		}
-
-		tlsConfig.GetConfigForClient = getTLSConfigForClient(&tlsConfig, listenPort)
-		l, err = tls.Listen("tcp", targetPort, &tlsConfig)
+		l, err = tls.Listen("tcp", targetPort, tlsConfig)
 	default:
 		mainLog.WithField("port", targetPort).Infof("--> Standard listener (%s)", protocol)
 		l, err = net.Listen("tcp", targetPort)
@@ -485,3 +545,36 @@ func (m *proxyMux) generateListener(listenPort int, protocol string) (l net.List
 	}
 	return l, nil
 }
+
+// generatePacketListener listens for UDP services. Unlike stream listeners,
+// packet listeners are not handed over on hot restarts.
+func (m *proxyMux) generatePacketListener(listenPort int) (net.PacketConn, error) {
+	if !config.Global().DisablePortWhiteList {
+		if err := CheckPortWhiteList(config.Global().PortWhiteList, listenPort, "udp"); err != nil {
+			return nil, err
+		}
+	}
+
+	targetPort := config.Global().ListenAddress + ":" + strconv.Itoa(listenPort)
+	mainLog.WithField("port", targetPort).Info("--> Packet listener (udp)")
+	return net.ListenPacket("udp", targetPort)
+}
+
+// listenerTLSConfig returns the TLS configuration used by client-facing
+// listeners on the given port.
+func listenerTLSConfig(listenPort int) *tls.Config {
+	httpServerOptions := config.Global().HttpServerOptions
+
+	tlsConfig := &tls.Config{
+		GetCertificate:     dummyGetCertificate,
+		ServerName:         httpServerOptions.ServerName,
+		MinVersion:         httpServerOptions.MinVersion,
+		MaxVersion:         httpServerOptions.MaxVersion,
+		ClientAuth:         tls.NoClientCert,
+		InsecureSkipVerify: httpServerOptions.SSLInsecureSkipVerify,
+		CipherSuites:       getCipherAliases(httpServerOptions.Ciphers),
+	}
+	tlsConfig.GetConfigForClient = getTLSConfigForClient(tlsConfig, listenPort)
+
+	return tlsConfig
+}
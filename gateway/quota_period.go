@@ -0,0 +1,151 @@
+package gateway
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// Calendar aligned quota renewal periods
+const (
+	QuotaPeriodDay   = "day"
+	QuotaPeriodWeek  = "week"
+	QuotaPeriodMonth = "month"
+
+	// quotaPeriodKeySuffix is appended to the quota key to store the end of
+	// the period the quota counter belongs to.
+	quotaPeriodKeySuffix = "-period"
+)
+
+// periodCounterStore renews counters atomically at the start of periods.
+type periodCounterStore interface {
+	IncrementPeriodCounter(counterKey, periodKey string, periodEnd, expire int64,
+		renew func(lastPeriodEnd, last int64) int64) (int64, bool, error)
+}
+
+// quotaPeriodKey returns the key storing the end of the period of a quota
+// counter, tagged to be in the hash slot of the counter in a Redis cluster.
+func quotaPeriodKey(rawKey string) string {
+	return "{" + rawKey + "}" + quotaPeriodKeySuffix
+}
+
+var quotaLocations sync.Map
+
+// quotaLocation returns the time zone of a calendar aligned quota, UTC if it
+// is not set or unknown.
+func quotaLocation(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	if loc, ok := quotaLocations.Load(name); ok {
+		return loc.(*time.Location)
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.WithError(err).Warning("Unknown quota time zone, using UTC: ", name)
+		loc = time.UTC
+	}
+	quotaLocations.Store(name, loc)
+	return loc
+}
+
+// quotaPeriod returns the bounds of the calendar aligned quota period of the
+// limit containing t. It returns false when the quota renews every
+// QuotaRenewalRate seconds instead.
+func quotaPeriod(limit *user.APILimit, t time.Time) (start, end time.Time, ok bool) {
+	t = t.In(quotaLocation(limit.QuotaTimezone))
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+
+	switch limit.QuotaRenewalPeriod {
+	case QuotaPeriodDay:
+		return day, day.AddDate(0, 0, 1), true
+	case QuotaPeriodWeek:
+		// weeks start on Monday
+		start = day.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+		return start, start.AddDate(0, 0, 7), true
+	case QuotaPeriodMonth:
+		start = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+		return start, start.AddDate(0, 1, 0), true
+	}
+
+	return time.Time{}, time.Time{}, false
+}
+
+// quotaCarryOver returns the part of the quota left unused in the previous
+// period that is added to the period starting at start. lastEnd is the end of
+// the last period with requests, as stored next to the quota counter, 0 if
+// there is none, and lastUsed its counter.
+func quotaCarryOver(limit *user.APILimit, lastEnd, lastUsed int64, start time.Time) int64 {
+	if limit.QuotaCarryOver <= 0 || lastEnd == 0 || lastEnd > start.Unix() {
+		return 0
+	}
+
+	unused := limit.QuotaMax
+	if lastEnd == start.Unix() {
+		// the previous period had requests
+		unused -= lastUsed
+	}
+
+	// unused quota includes what was carried into the previous period, only
+	// up to one period of quota is carried over
+	if unused > limit.QuotaMax {
+		unused = limit.QuotaMax
+	}
+	if unused < 0 {
+		unused = 0
+	}
+
+	return unused * limit.QuotaCarryOver / 100
+}
+
+// incrementCalendarQuota counts a request against a calendar aligned quota
+// and returns the requests used in the period, which is negative while the
+// quota carried over has not been used. The first request of a period resets
+// the counter, atomically for the requests of the period not to be lost. The
+// request is let through when the quota can't be counted.
+func incrementCalendarQuota(store storage.Handler, rawKey string, limit *user.APILimit, start, end time.Time) (used int64, renewed bool) {
+	counterStore, ok := store.(periodCounterStore)
+	if !ok {
+		log.Error("Calendar aligned quotas aren't supported by the quota store")
+		return 0, false
+	}
+
+	// the counter is kept for an extra period, so that its unused part can
+	// be carried over
+	_, nextEnd, _ := quotaPeriod(limit, end)
+	ttl := int64(time.Until(nextEnd).Seconds())
+
+	used, renewed, err := counterStore.IncrementPeriodCounter(rawKey, quotaPeriodKey(rawKey), end.Unix(), ttl,
+		func(lastEnd, lastUsed int64) int64 {
+			return 1 - quotaCarryOver(limit, lastEnd, lastUsed, start)
+		})
+	if err != nil {
+		log.WithError(err).Error("Couldn't count the request against the quota")
+		return 0, false
+	}
+	return used, renewed
+}
+
+// calendarQuotaRemaining returns, without counting a request, the quota left
+// in the current period of a calendar aligned quota.
+func calendarQuotaRemaining(store storage.Handler, rawKey string, limit *user.APILimit, start, end time.Time) int64 {
+	lastEndValue, _ := store.GetRawKey(quotaPeriodKey(rawKey))
+	lastEnd, _ := strconv.ParseInt(lastEndValue, 10, 64)
+	used, _ := store.GetRawKey(rawKey)
+	usedInt, _ := strconv.ParseInt(used, 10, 64)
+
+	if lastEnd < end.Unix() {
+		// no request yet in this period
+		return limit.QuotaMax + quotaCarryOver(limit, lastEnd, usedInt, start)
+	}
+
+	remaining := limit.QuotaMax - usedInt
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining
+}
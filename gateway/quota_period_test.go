@@ -0,0 +1,146 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestQuotaPeriod(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a Wednesday
+	now := time.Date(2026, 10, 14, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		period, timezone string
+		start, end       time.Time
+	}{
+		{QuotaPeriodDay, "", time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)},
+		{QuotaPeriodWeek, "", time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+		{QuotaPeriodMonth, "", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{QuotaPeriodMonth, "America/New_York", time.Date(2026, 10, 1, 0, 0, 0, 0, newYork), time.Date(2026, 11, 1, 0, 0, 0, 0, newYork)},
+		{QuotaPeriodDay, "Unknown/Zone", time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.period+" "+tc.timezone, func(t *testing.T) {
+			start, end, ok := quotaPeriod(&user.APILimit{QuotaRenewalPeriod: tc.period, QuotaTimezone: tc.timezone}, now)
+			assert.True(t, ok)
+			assert.True(t, tc.start.Equal(start), "start: %v", start)
+			assert.True(t, tc.end.Equal(end), "end: %v", end)
+		})
+	}
+
+	_, _, ok := quotaPeriod(&user.APILimit{QuotaRenewalRate: 3600}, now)
+	assert.False(t, ok, "quota renewing by rate should not be calendar aligned")
+}
+
+func TestCalendarQuota(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	api := BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.UseKeylessAccess = false
+	})[0]
+
+	session, key := ts.CreateSession(func(s *user.SessionState) {
+		s.AccessRights = map[string]user.AccessDefinition{
+			api.APIID: {
+				APIName: api.Name,
+				APIID:   api.APIID,
+			},
+		}
+		s.QuotaMax = 4
+		s.QuotaRenewalRate = 0
+		s.QuotaRenewalPeriod = QuotaPeriodMonth
+		s.QuotaCarryOver = 50
+	})
+
+	start, end, _ := quotaPeriod(&user.APILimit{QuotaRenewalPeriod: session.QuotaRenewalPeriod}, time.Now())
+	authHeader := map[string]string{headers.Authorization: key}
+	detail := func(remaining int) test.TestCase {
+		return test.TestCase{
+			Path: "/tyk/keys/" + key, AdminAuth: true, Code: http.StatusOK,
+			BodyMatch: fmt.Sprintf(`"quota_renews":%d,"quota_remaining":%d`, end.Unix(), remaining),
+		}
+	}
+
+	_, _ = ts.Run(t, []test.TestCase{
+		detail(4),
+		{Headers: authHeader, Code: http.StatusOK},
+		{Headers: authHeader, Code: http.StatusOK},
+		{Headers: authHeader, Code: http.StatusOK},
+		{Headers: authHeader, Code: http.StatusOK},
+		{Headers: authHeader, Code: http.StatusForbidden},
+		detail(0),
+	}...)
+
+	// previous period ended at the start of this one with 2 requests unused
+	quotaKey := QuotaKeyPrefix + storage.HashKey(key)
+	store := GlobalSessionManager.Store()
+	store.SetRawKey(quotaKey, "2", 60)
+	store.SetRawKey(quotaPeriodKey(quotaKey), strconv.FormatInt(start.Unix(), 10), 60)
+
+	_, _ = ts.Run(t, []test.TestCase{
+		detail(5),
+		{Headers: authHeader, Code: http.StatusOK},
+		{Headers: authHeader, Code: http.StatusOK},
+		{Headers: authHeader, Code: http.StatusOK},
+		{Headers: authHeader, Code: http.StatusOK},
+		{Headers: authHeader, Code: http.StatusOK},
+		{Headers: authHeader, Code: http.StatusForbidden},
+	}...)
+}
+
+func TestIncrementCalendarQuota_Concurrent(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	store := &storage.RedisCluster{}
+	rawKey := QuotaKeyPrefix + "calendar-concurrent"
+	defer store.DeleteRawKey(rawKey)
+	defer store.DeleteRawKey(quotaPeriodKey(rawKey))
+
+	limit := &user.APILimit{QuotaMax: 100, QuotaRenewalPeriod: QuotaPeriodDay}
+	start, end, _ := quotaPeriod(limit, time.Now())
+
+	// none of the requests is lost to a concurrent renewal of the period
+	const requests = 20
+	var mu sync.Mutex
+	var renewals int
+	used := map[int64]bool{}
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, renewed := incrementCalendarQuota(store, rawKey, limit, start, end)
+			mu.Lock()
+			defer mu.Unlock()
+			used[n] = true
+			if renewed {
+				renewals++
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, renewals)
+	assert.Len(t, used, requests)
+	assert.True(t, used[requests])
+}
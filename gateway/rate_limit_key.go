@@ -0,0 +1,64 @@
+package gateway
+
+import (
+	"net/http"
+
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const rateLimitKeyFallbackReject = "reject"
+
+// maxRateLimitKeyValueLen is the longest value a rate limit is counted per.
+const maxRateLimitKeyValueLen = 64
+
+// rateLimitKeyValue reads the value the rate limit of the key of a request is
+// counted per, such as the tenant it is sent for.
+func rateLimitKeyValue(r *http.Request, spec *APISpec) string {
+	conf := spec.RateLimitKey
+	return requestAttribute(r, spec, conf.Source, conf.Name, conf.Index)
+}
+
+// rateLimitKeyScope returns the scope of the rate limit counter of the key of
+// a request. It returns false if the request has no valid value and must be
+// rejected.
+func rateLimitKeyScope(r *http.Request, spec *APISpec) (string, bool) {
+	if !spec.RateLimitKey.Enabled {
+		return "", true
+	}
+	value := rateLimitKeyValue(r, spec)
+	if !validRateLimitKeyValue(value) {
+		return "", spec.RateLimitKey.Fallback != rateLimitKeyFallbackReject
+	}
+	return "tenant-" + value + "-", true
+}
+
+// validRateLimitKeyValue reports whether a value read from a request can
+// scope a rate limit counter. Values are short identifiers, others are
+// handled as missing for clients not to create arbitrary counters.
+func validRateLimitKeyValue(value string) bool {
+	if value == "" || len(value) > maxRateLimitKeyValueLen {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// rateLimitKeyLimit returns the rate limit of each scope of a key, which
+// defaults to the limit of the key.
+func rateLimitKeyLimit(spec *APISpec, limit *user.APILimit) *user.APILimit {
+	conf := spec.RateLimitKey
+	if conf.Rate <= 0 || conf.Per <= 0 {
+		return limit
+	}
+	scoped := *limit
+	scoped.Rate, scoped.Per = conf.Rate, conf.Per
+	return &scoped
+}
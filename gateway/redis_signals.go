@@ -136,6 +136,7 @@ func handleKeySpaceEventCacheFlush(payload string) {
 
 		RPCGlobalCache.Delete("apikey-" + key)
 		SessionCache.Delete(key)
+		sessionFallback.delete(key)
 	}
 }
 
@@ -0,0 +1,32 @@
+package gateway
+
+import (
+	"net/http"
+
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+// RedisStats are the Redis commands run by the node and their errors, and
+// the counter updates buffered while Redis was unavailable.
+type RedisStats struct {
+	Ops           []storage.RedisOpStats     `json:"ops"`
+	CounterBuffer storage.CounterBufferStats `json:"counter_buffer"`
+}
+
+// Get the Redis stats
+// Returns the calls and errors of each Redis command by connection pool since
+// the node started, and the rate limit and quota counter updates buffered
+// while Redis was unavailable.
+//
+//---
+// responses:
+//   200:
+//     description: Redis stats
+//     schema:
+//       "$ref": "#/definitions/RedisStats"
+func redisStatsHandler(w http.ResponseWriter, r *http.Request) {
+	doJSONWrite(w, http.StatusOK, RedisStats{
+		Ops:           storage.RedisStats(),
+		CounterBuffer: storage.CounterBuffer(),
+	})
+}
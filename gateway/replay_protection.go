@@ -0,0 +1,116 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	jose "github.com/square/go-jose"
+
+	"github.com/TykTechnologies/tyk/request"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+const replayDefaultWindow = 300
+
+// jwsTimestampHeaders are the protected headers JWS signatures may be dated
+// with, the Open Banking one first.
+var jwsTimestampHeaders = []jose.HeaderKey{"http://openbanking.org.uk/iat", "iat"}
+
+var (
+	errReplayNonceMissing = errors.New("Request nonce is missing or not signed")
+	errReplayDateUnsigned = errors.New("Request date is not signed")
+	errReplayStale        = errors.New("Request signature is too old or dated in the future")
+	errReplayed           = errors.New("Request has already been processed")
+	errReplayUnavailable  = errors.New("Request nonces can't be checked at the moment")
+)
+
+// replayNonceStore remembers the nonces of the signed requests seen within
+// their window.
+var replayNonceStore storage.Handler = &storage.RedisCluster{KeyPrefix: "replay-nonce-"}
+
+// checkReplay rejects requests signed outside of the replay protection
+// window of the API, or whose nonce has already been seen for the key they
+// were signed with.
+func checkReplay(m TykMiddleware, r *http.Request, key, nonce string, signedAt time.Time) (error, int) {
+	spec := m.Base().Spec
+	window := spec.ReplayProtection.Window
+	if window <= 0 {
+		window = replayDefaultWindow
+	}
+
+	if age := time.Since(signedAt); age > time.Duration(window)*time.Second || age < -time.Duration(window)*time.Second {
+		m.Logger().WithField("signed_at", signedAt).Info("Request signature is outside of the replay window")
+		return errReplayStale, http.StatusBadRequest
+	}
+
+	// a signature dated at the end of the window is valid for twice as long
+	sum := sha256.Sum256([]byte(key + "\x00" + nonce))
+	nonceKey := replayNonceStore.GetKeyPrefix() + spec.APIID + "-" + base64.RawURLEncoding.EncodeToString(sum[:])
+	seen, err := incrementRawKey(replayNonceStore, nonceKey, 2*window)
+	if err != nil {
+		// the request can't be told apart from a replay
+		m.Logger().WithError(err).Error("Couldn't record the request nonce")
+		return errReplayUnavailable, http.StatusServiceUnavailable
+	}
+	if seen > 1 {
+		m.Logger().WithField("key", obfuscateKey(key)).Warning("Replayed request rejected")
+		m.Base().FireEvent(EventRequestReplayed, EventKeyFailureMeta{
+			EventMetaDefault: EventMetaDefault{Message: "Replayed request rejected", OriginatingRequest: EncodeRequestToEvent(r)},
+			Path:             r.URL.Path,
+			Origin:           request.RealIP(r),
+			Key:              key,
+		})
+		return errReplayed, http.StatusConflict
+	}
+
+	return nil, http.StatusOK
+}
+
+// hmacHeaderSigned reports whether a header is covered by the signature of
+// an HMAC signed request.
+func hmacHeaderSigned(fieldValues *HMACFieldValues, header string) bool {
+	for _, signed := range fieldValues.Headers {
+		if strings.EqualFold(signed, header) {
+			return true
+		}
+	}
+	return false
+}
+
+// hmacReplayNonce returns the nonce of an HMAC signed request, and whether
+// it is covered by its signature. Signatures are unescaped, for the lower
+// case escapes accepted by the validation not to make them new nonces.
+func hmacReplayNonce(r *http.Request, header string, fieldValues *HMACFieldValues) (string, bool) {
+	if header == "" {
+		signature, err := url.PathUnescape(fieldValues.Signature)
+		if err != nil {
+			return "", false
+		}
+		return signature, true
+	}
+	if !hmacHeaderSigned(fieldValues, header) {
+		return "", false
+	}
+	nonce := r.Header.Get(header)
+	return nonce, nonce != ""
+}
+
+// jwsReplayNonce returns the nonce and the date of a JWS signature.
+func jwsReplayNonce(jws *jose.JSONWebSignature) (string, time.Time, bool) {
+	sig := jws.Signatures[0]
+	nonce, _ := sig.Protected.ExtraHeaders["jti"].(string)
+	if nonce == "" {
+		nonce = base64.RawURLEncoding.EncodeToString(sig.Signature)
+	}
+	for _, header := range jwsTimestampHeaders {
+		if iat, ok := sig.Protected.ExtraHeaders[header].(float64); ok {
+			return nonce, time.Unix(int64(iat), 0), true
+		}
+	}
+	return nonce, time.Time{}, false
+}
@@ -0,0 +1,122 @@
+package gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	jose "github.com/square/go-jose"
+
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestHMACReplayProtection(t *testing.T) {
+	var eventWG sync.WaitGroup
+	eventWG.Add(1)
+	encodedString, spec, req, sessionKey := testPrepareHMACAuthSessionPass(t, sha1.New, &eventWG, false, false)
+	spec.ReplayProtection.Enabled = true
+	req.Header.Set("Authorization", fmt.Sprintf("Signature keyId=\"%s\",algorithm=\"hmac-sha1\",signature=\"%s\"", sessionKey, encodedString))
+
+	chain := getHMACAuthChain(spec)
+	for _, code := range []int{http.StatusOK, http.StatusConflict} {
+		recorder := httptest.NewRecorder()
+		chain.ServeHTTP(recorder, req)
+		if recorder.Code != code {
+			t.Errorf("Expected %d, got %d", code, recorder.Code)
+		}
+	}
+
+	t.Run("Nonce store unavailable", func(t *testing.T) {
+		store := replayNonceStore
+		replayNonceStore = unavailableStore{store}
+		defer func() { replayNonceStore = store }()
+
+		recorder := httptest.NewRecorder()
+		getHMACAuthChain(spec).ServeHTTP(recorder, req)
+		if recorder.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected requests to be rejected while their nonce can't be recorded, got %d", recorder.Code)
+		}
+	})
+
+	t.Run("Unsigned date", func(t *testing.T) {
+		req.Header.Set("X-Aux-Date", req.Header.Get("Date"))
+		defer req.Header.Del("X-Aux-Date")
+
+		recorder := httptest.NewRecorder()
+		getHMACAuthChain(spec).ServeHTTP(recorder, req)
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("Expected requests dated with an unsigned header to be rejected, got %d", recorder.Code)
+		}
+	})
+
+	t.Run("Nonce header", func(t *testing.T) {
+		spec.ReplayProtection.NonceHeader = "X-Request-Nonce"
+		req.Header.Set("X-Request-Nonce", "unsigned")
+
+		recorder := httptest.NewRecorder()
+		getHMACAuthChain(spec).ServeHTTP(recorder, req)
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("Expected requests with unsigned nonces to be rejected, got %d", recorder.Code)
+		}
+	})
+}
+
+func TestHMACReplayNonceEscapes(t *testing.T) {
+	lower, _ := hmacReplayNonce(nil, "", &HMACFieldValues{Signature: "a%2bb%3d"})
+	upper, _ := hmacReplayNonce(nil, "", &HMACFieldValues{Signature: "a%2Bb%3D"})
+	if lower != upper {
+		t.Errorf("Expected escapes of either case to give the same nonce, got %q and %q", lower, upper)
+	}
+}
+
+func TestJWSReplayProtection(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(key.Public())
+	keyID, err := CertificateManager.Add(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CertificateManager.Delete(keyID, "")
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/jws/"
+		spec.JWSValidation.IsEnabled = true
+		spec.JWSValidation.PinnedKeys = []string{keyID}
+		spec.ReplayProtection.Enabled = true
+	})
+
+	sign := func(iat time.Time) string {
+		opts := &jose.SignerOptions{}
+		if !iat.IsZero() {
+			opts.WithHeader("iat", iat.Unix())
+		}
+		signer, _ := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, opts)
+		obj, _ := signer.Sign([]byte(`{"amount":10}`))
+		sig, _ := obj.DetachedCompactSerialize()
+		return sig
+	}
+
+	signed := map[string]string{jwsDefaultHeader: sign(time.Now())}
+	_, _ = ts.Run(t, []test.TestCase{
+		{Method: http.MethodPost, Path: "/jws/", Data: `{"amount":10}`, Headers: signed, Code: http.StatusOK},
+		{Method: http.MethodPost, Path: "/jws/", Data: `{"amount":10}`, Headers: signed, Code: http.StatusConflict,
+			BodyMatch: "already been processed"},
+		{Method: http.MethodPost, Path: "/jws/", Data: `{"amount":10}`,
+			Headers: map[string]string{jwsDefaultHeader: sign(time.Time{})}, Code: http.StatusBadRequest},
+		{Method: http.MethodPost, Path: "/jws/", Data: `{"amount":10}`,
+			Headers: map[string]string{jwsDefaultHeader: sign(time.Now().Add(-time.Hour))}, Code: http.StatusBadRequest,
+			BodyMatch: "too old"},
+	}...)
+}
@@ -0,0 +1,43 @@
+package gateway
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Sources of request attributes, such as the value the rate limit of a key is
+// counted per, or analytics tags.
+const (
+	attributeHeader      = "header"
+	attributePathSegment = "path_segment"
+	attributePathParam   = "path_param"
+	attributeQueryParam  = "query_param"
+	attributeJWTClaim    = "jwt_claim"
+)
+
+// requestAttribute reads an attribute of a request. Name is the name of the
+// header, listen path or query parameter, or JWT claim, and index the
+// position of the path segment after the listen path.
+func requestAttribute(r *http.Request, spec *APISpec, source, name string, index int) string {
+	switch source {
+	case attributeHeader:
+		return r.Header.Get(name)
+	case attributePathSegment:
+		path := strings.TrimPrefix(spec.StripListenPath(r, r.URL.Path), "/")
+		segments := strings.Split(path, "/")
+		if index >= 0 && index < len(segments) {
+			return segments[index]
+		}
+	case attributePathParam:
+		return mux.Vars(r)[name]
+	case attributeQueryParam:
+		return r.URL.Query().Get(name)
+	case attributeJWTClaim:
+		if val, ok := ctxGetData(r)["jwt_claims_"+name]; ok {
+			return valToStr(val)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,490 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/request"
+)
+
+// Violations of the request hardening options, as reported in the
+// instrumentation.
+const (
+	violationConflictingFraming = "conflicting_framing"
+	violationObsFold            = "obs_fold"
+	violationDisallowedMethod   = "disallowed_method"
+	// violationUninspected is reported for requests read after the
+	// inspection of their connection stopped, such as after a request
+	// asking for a protocol upgrade the upstream refused.
+	violationUninspected = "uninspected"
+)
+
+type inspectState int
+
+const (
+	inspectHead inspectState = iota
+	inspectBody
+	inspectChunkSize
+	inspectChunkData
+	inspectTrailer
+	// inspectStopped is set once the connection can't be followed anymore.
+	inspectStopped
+)
+
+// requestInspectorKey stores the requestInspector of a connection in its
+// context.
+type requestInspectorKey struct{}
+
+// requestInspector follows the HTTP/1 requests read from a client
+// connection, and records the framing and header violations of each one,
+// before the HTTP server normalizes them away. It follows the request bodies
+// the way the server does, to find where the next request starts.
+type requestInspector struct {
+	conf config.RequestHardeningConfig
+
+	state     inspectState
+	line      []byte
+	remaining int64
+
+	// the request head being read
+	requestLine   bool
+	http10        bool
+	connect       bool
+	upgrade       bool
+	obsFold       bool
+	hasTE         bool
+	chunked       bool
+	hasCL         bool
+	contentLength int64
+
+	mu       sync.Mutex
+	verdicts [][]string
+}
+
+// inspect follows the bytes read from the connection.
+func (i *requestInspector) inspect(p []byte) {
+	for len(p) > 0 {
+		switch i.state {
+		case inspectStopped:
+			return
+		case inspectBody, inspectChunkData:
+			n := int64(len(p))
+			if n > i.remaining {
+				n = i.remaining
+			}
+			i.remaining -= n
+			p = p[n:]
+			if i.remaining > 0 {
+				continue
+			}
+			if i.state == inspectBody {
+				i.state = inspectHead
+			} else {
+				i.state = inspectChunkSize
+			}
+		default:
+			end := bytes.IndexByte(p, '\n')
+			if end < 0 {
+				i.line = append(i.line, p...)
+				p = nil
+			} else {
+				i.line = append(i.line, p[:end]...)
+				p = p[end+1:]
+			}
+			if len(i.line) > http.DefaultMaxHeaderBytes {
+				// the server rejects it
+				i.state = inspectStopped
+				return
+			}
+			if end < 0 {
+				return
+			}
+			i.readLine(bytes.TrimSuffix(i.line, []byte("\r")))
+			i.line = i.line[:0]
+		}
+	}
+}
+
+func (i *requestInspector) readLine(line []byte) {
+	switch i.state {
+	case inspectHead:
+		i.readHeadLine(line)
+	case inspectChunkSize:
+		if ext := bytes.IndexByte(line, ';'); ext >= 0 {
+			line = line[:ext]
+		}
+		size, err := strconv.ParseInt(string(bytes.TrimSpace(line)), 16, 64)
+		switch {
+		case err != nil || size < 0:
+			i.state = inspectStopped
+		case size == 0:
+			i.state = inspectTrailer
+		default:
+			// the chunk data is followed by a CRLF
+			i.remaining = size + 2
+			i.state = inspectChunkData
+		}
+	case inspectTrailer:
+		if len(line) == 0 {
+			i.state = inspectHead
+		}
+	}
+}
+
+func (i *requestInspector) readHeadLine(line []byte) {
+	if !i.requestLine {
+		// empty lines before a request are tolerated
+		if len(line) == 0 {
+			return
+		}
+		parts := strings.Fields(string(line))
+		if len(parts) != 3 || !strings.HasPrefix(parts[2], "HTTP/1.") {
+			// not HTTP/1, such as the preface of HTTP/2 with prior
+			// knowledge, or malformed, which the server rejects
+			i.state = inspectStopped
+			return
+		}
+		i.requestLine = true
+		i.http10 = parts[2] == "HTTP/1.0"
+		i.connect = parts[0] == http.MethodConnect
+		return
+	}
+
+	if len(line) == 0 {
+		i.endHead()
+		return
+	}
+	if line[0] == ' ' || line[0] == '\t' {
+		i.obsFold = true
+		return
+	}
+	colon := bytes.IndexByte(line, ':')
+	if colon < 0 {
+		return
+	}
+	name := string(line[:colon])
+	value := string(bytes.TrimSpace(line[colon+1:]))
+	switch {
+	case strings.EqualFold(name, headers.TransferEncoding):
+		i.hasTE = true
+		i.chunked = strings.EqualFold(value, "chunked")
+	case strings.EqualFold(name, headers.ContentLength):
+		i.hasCL = true
+		i.contentLength, _ = strconv.ParseInt(value, 10, 64)
+	case strings.EqualFold(name, headers.Upgrade):
+		i.upgrade = true
+	}
+}
+
+// endHead records the violations of the request head read, and follows its
+// body the way the server reads it.
+func (i *requestInspector) endHead() {
+	var violations []string
+	if i.conf.RejectConflictingFraming && i.hasTE && (i.hasCL || i.http10) {
+		violations = append(violations, violationConflictingFraming)
+	}
+	if i.conf.RejectObsFold && i.obsFold {
+		violations = append(violations, violationObsFold)
+	}
+
+	i.mu.Lock()
+	i.verdicts = append(i.verdicts, violations)
+	i.mu.Unlock()
+
+	switch {
+	case len(violations) > 0, i.upgrade, i.connect:
+		// the connection is closed after a rejected request, and may
+		// not be HTTP/1 anymore after the others
+		i.state = inspectStopped
+	case i.hasTE && !i.http10:
+		if !i.chunked {
+			// the server rejects other transfer encodings
+			i.state = inspectStopped
+		} else {
+			i.state = inspectChunkSize
+		}
+	case i.contentLength > 0:
+		i.remaining = i.contentLength
+		i.state = inspectBody
+	}
+
+	i.requestLine, i.http10, i.connect, i.upgrade, i.obsFold = false, false, false, false, false
+	i.hasTE, i.chunked, i.hasCL, i.contentLength = false, false, false, 0
+}
+
+// next returns the violations of the next request served on the
+// connection. It returns false if the request wasn't inspected.
+func (i *requestInspector) next() ([]string, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if len(i.verdicts) == 0 {
+		return nil, false
+	}
+	violations := i.verdicts[0]
+	i.verdicts = i.verdicts[1:]
+	return violations, true
+}
+
+// inspectedConn feeds the bytes read from a client connection to its
+// requestInspector. TLS connections are inspected once decrypted, the HTTP
+// server then serving them as plain ones, so the TLS state of their requests
+// is restored from tlsConn.
+type inspectedConn struct {
+	net.Conn
+	inspector *requestInspector
+	tlsConn   *tls.Conn
+}
+
+func (c *inspectedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.inspector.inspect(p[:n])
+	return n, err
+}
+
+// inspectedListener inspects the requests read from the connections it
+// accepts.
+type inspectedListener struct {
+	net.Listener
+	conf config.RequestHardeningConfig
+}
+
+func (l *inspectedListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &inspectedConn{Conn: c, inspector: &requestInspector{conf: l.conf}, tlsConn: tlsConnOf(c)}, nil
+}
+
+// tlsConnOf returns the TLS connection of c, nil if it isn't one.
+func tlsConnOf(c net.Conn) *tls.Conn {
+	if lc, ok := c.(*limitedConn); ok {
+		c = lc.Conn
+	}
+	tlsConn, _ := c.(*tls.Conn)
+	return tlsConn
+}
+
+// inspectListener inspects the requests read from the HTTP connections of l,
+// if a framing or header check is enabled.
+func inspectListener(l net.Listener, conf config.RequestHardeningConfig) net.Listener {
+	if !conf.RejectConflictingFraming && !conf.RejectObsFold {
+		return l
+	}
+	return &inspectedListener{Listener: l, conf: conf}
+}
+
+// connContext attaches the state of a new client connection to its context.
+func connContext(ctx context.Context, c net.Conn) context.Context {
+	ctx = countConnRequests(ctx, c)
+	if ic, ok := c.(*inspectedConn); ok {
+		ctx = context.WithValue(ctx, requestInspectorKey{}, ic.inspector)
+		if ic.tlsConn != nil {
+			ctx = context.WithValue(ctx, inspectedTLSConnKey{}, ic.tlsConn)
+		}
+	}
+	return ctx
+}
+
+// inspectedTLSConnKey stores the TLS connection of an inspected connection
+// in its context.
+type inspectedTLSConnKey struct{}
+
+// restoreInspectedTLS sets the TLS state of r if it was read from an
+// inspected TLS connection, which the HTTP server served as a plain one.
+func restoreInspectedTLS(r *http.Request) {
+	if r.TLS != nil {
+		return
+	}
+	if tlsConn, ok := r.Context().Value(inspectedTLSConnKey{}).(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		r.TLS = &state
+	}
+}
+
+// serveInspectedHTTP2 serves the HTTP/2 connection negotiated on an
+// inspected TLS connection, whose preface the HTTP server reads as a PRI
+// request, and reports whether r was one. Unlike the h2c handler, it keeps
+// the TLS state of the connection for its requests. The connection is
+// served by h2s with the timeouts of srv, as the HTTP server would.
+func serveInspectedHTTP2(w http.ResponseWriter, r *http.Request, h http.Handler, h2s *http2.Server, srv *http.Server) bool {
+	tlsConn, ok := r.Context().Value(inspectedTLSConnKey{}).(*tls.Conn)
+	if !ok || r.Method != "PRI" || r.URL.Path != "*" || r.ProtoMajor != 2 {
+		return false
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return false
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		log.WithError(err).Error("Can't serve HTTP/2 connection")
+		return true
+	}
+	defer conn.Close()
+
+	// the server read the preface up to its body
+	const prefaceBody = "SM\r\n\r\n"
+	buf := make([]byte, len(prefaceBody))
+	if _, err := io.ReadFull(rw, buf); err != nil || string(buf) != prefaceBody {
+		return true
+	}
+	c := &inspectedHTTP2Conn{
+		Conn:   conn,
+		reader: io.MultiReader(strings.NewReader(http2.ClientPreface), rw),
+		state:  tlsConn.ConnectionState(),
+	}
+	h2s.ServeConn(c, &http2.ServeConnOpts{Handler: h, BaseConfig: srv})
+	return true
+}
+
+// inspectedHTTP2Conn is an HTTP/2 connection negotiated on an inspected TLS
+// connection.
+type inspectedHTTP2Conn struct {
+	net.Conn
+	reader io.Reader
+	state  tls.ConnectionState
+}
+
+func (c *inspectedHTTP2Conn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// ConnectionState is read by the HTTP/2 server for the TLS state of the
+// requests.
+func (c *inspectedHTTP2Conn) ConnectionState() tls.ConnectionState {
+	return c.state
+}
+
+// closeOnRefusedUpgrade closes the connection of r after its response if r
+// asks for a protocol upgrade that isn't switched to, as its connection
+// can't be inspected anymore. finish must be called once the response is
+// served.
+func closeOnRefusedUpgrade(w http.ResponseWriter, r *http.Request) (_ http.ResponseWriter, finish func()) {
+	if r.ProtoMajor != 1 || r.Header.Get(headers.Upgrade) == "" {
+		return w, func() {}
+	}
+	if _, ok := r.Context().Value(requestInspectorKey{}).(*requestInspector); !ok {
+		return w, func() {}
+	}
+	uw := &refusedUpgradeResponseWriter{ResponseWriter: w}
+	return uw, uw.finish
+}
+
+// refusedUpgradeResponseWriter asks for the connection to be closed with
+// any response but 101 Switching Protocols, which is written to the
+// hijacked connection.
+type refusedUpgradeResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	hijacked    bool
+}
+
+// finish asks for the connection to be closed if the handler returned
+// without writing the response, which the server then writes.
+func (w *refusedUpgradeResponseWriter) finish() {
+	if !w.wroteHeader && !w.hijacked {
+		w.Header().Set(headers.Connection, "close")
+	}
+}
+
+func (w *refusedUpgradeResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader && code != http.StatusSwitchingProtocols {
+		w.Header().Set(headers.Connection, "close")
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *refusedUpgradeResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *refusedUpgradeResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *refusedUpgradeResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer doesn't support hijacking")
+	}
+	w.hijacked = true
+	return hj.Hijack()
+}
+
+// requestViolations returns the violations of the hardening options by r.
+func requestViolations(r *http.Request, conf config.RequestHardeningConfig) []string {
+	var violations []string
+	if inspector, ok := r.Context().Value(requestInspectorKey{}).(*requestInspector); ok && r.ProtoMajor == 1 {
+		inspected, ok := inspector.next()
+		if !ok {
+			inspected = []string{violationUninspected}
+		}
+		violations = append(violations, inspected...)
+	}
+
+	if len(conf.AllowedMethods) > 0 {
+		allowed := false
+		for _, method := range conf.AllowedMethods {
+			if strings.EqualFold(method, r.Method) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			violations = append(violations, violationDisallowedMethod)
+		}
+	}
+	return violations
+}
+
+// rejectUnsafeRequest rejects r if it violates the hardening options, and
+// reports whether it did. The connection is closed after requests with
+// ambiguous framing, as the server and upstreams may disagree on where the
+// next request starts.
+func rejectUnsafeRequest(w http.ResponseWriter, r *http.Request, conf config.RequestHardeningConfig) bool {
+	violations := requestViolations(r, conf)
+	if len(violations) == 0 {
+		return false
+	}
+
+	job := instrument.NewJob("RequestHardening")
+	for _, violation := range violations {
+		job.Event(violation)
+	}
+	log.WithFields(logrus.Fields{
+		"prefix":     "request-hardening",
+		"origin":     request.RealIP(r),
+		"method":     r.Method,
+		"path":       r.URL.Path,
+		"violations": violations,
+	}).Warning("Rejected unsafe request")
+
+	if len(violations) == 1 && violations[0] == violationDisallowedMethod {
+		doJSONWrite(w, http.StatusMethodNotAllowed, apiError(http.StatusText(http.StatusMethodNotAllowed)))
+		return true
+	}
+	w.Header().Set(headers.Connection, "close")
+	doJSONWrite(w, http.StatusBadRequest, apiError(http.StatusText(http.StatusBadRequest)))
+	return true
+}
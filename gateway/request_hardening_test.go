@@ -0,0 +1,205 @@
+package gateway
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+func TestRequestInspector(t *testing.T) {
+	conf := config.RequestHardeningConfig{RejectConflictingFraming: true, RejectObsFold: true}
+
+	tests := []struct {
+		name     string
+		requests string
+		expected [][]string
+	}{
+		{
+			name:     "keep-alive requests with bodies",
+			requests: "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 5\r\n\r\nhello" + "GET / HTTP/1.1\r\nHost: a\r\n\r\n",
+			expected: [][]string{nil, nil},
+		},
+		{
+			name: "chunked body",
+			requests: "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n5;ext=1\r\nhello\r\n0\r\nTrailer: x\r\n\r\n" +
+				"GET / HTTP/1.1\r\nHost: a\r\n\r\n",
+			expected: [][]string{nil, nil},
+		},
+		{
+			name:     "both transfer encoding and content length",
+			requests: "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+			expected: [][]string{{violationConflictingFraming}},
+		},
+		{
+			name:     "transfer encoding in HTTP/1.0",
+			requests: "POST / HTTP/1.0\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n",
+			expected: [][]string{{violationConflictingFraming}},
+		},
+		{
+			name:     "folded header",
+			requests: "GET / HTTP/1.1\r\nHost: a\r\nX-Folded: a\r\n b\r\n\r\n",
+			expected: [][]string{{violationObsFold}},
+		},
+		{
+			name:     "inspection stops after a violation",
+			requests: "GET / HTTP/1.1\r\nX-Folded: a\r\n b\r\n\r\n" + "GET / HTTP/1.1\r\nHost: a\r\n\r\n",
+			expected: [][]string{{violationObsFold}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// feed the requests a byte at a time, as they may be split
+			// anywhere between reads
+			i := &requestInspector{conf: conf}
+			for _, b := range []byte(tc.requests) {
+				i.inspect([]byte{b})
+			}
+			assert.Equal(t, tc.expected, i.verdicts)
+		})
+	}
+}
+
+func TestRequestHardening(t *testing.T) {
+	conf := config.RequestHardeningConfig{
+		RejectConflictingFraming: true,
+		RejectObsFold:            true,
+		AllowedMethods:           []string{http.MethodGet, http.MethodPost},
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: &handleWrapper{router: router, hardening: conf}, ConnContext: connContext}
+	go server.Serve(inspectListener(l, conf))
+	defer server.Close()
+
+	send := func(requests string) []int {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, requests)
+
+		var codes []int
+		br := bufio.NewReader(conn)
+		for {
+			resp, err := http.ReadResponse(br, nil)
+			if err != nil {
+				return codes
+			}
+			resp.Body.Close()
+			codes = append(codes, resp.StatusCode)
+		}
+	}
+
+	get := "GET / HTTP/1.1\r\nHost: a\r\n\r\n"
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK}, send(get+strings.Replace(get, "\r\n\r\n", "\r\nConnection: close\r\n\r\n", 1)))
+	assert.Equal(t, []int{http.StatusBadRequest}, send("POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n"+get))
+	assert.Equal(t, []int{http.StatusBadRequest}, send("GET / HTTP/1.1\r\nHost: a\r\nX-Folded: a\r\n b\r\n\r\n"+get))
+	assert.Equal(t, []int{http.StatusMethodNotAllowed}, send("DELETE / HTTP/1.1\r\nHost: a\r\nConnection: close\r\n\r\n"))
+	// the connection is closed after a refused upgrade
+	assert.Equal(t, []int{http.StatusOK}, send("GET / HTTP/1.1\r\nHost: a\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"+get))
+}
+
+func TestRequestHardeningTLS(t *testing.T) {
+	conf := config.RequestHardeningConfig{RejectConflictingFraming: true}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+
+	_, _, _, cert := genServerCertificate()
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{http2.NextProtoTLS}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &handleWrapper{router: router, hardening: conf}
+	h2s := &http2.Server{}
+	h := &h2cWrapper{w: w, h: h2c.NewHandler(w, h2s), h2s: h2s}
+	server := &http.Server{Handler: h, ConnContext: connContext, IdleTimeout: 200 * time.Millisecond}
+	if err := http2.ConfigureServer(server, h2s); err != nil {
+		t.Fatal(err)
+	}
+	h.srv = server
+	go server.Serve(inspectListener(limitListener(l, 10), conf))
+	defer server.Close()
+
+	t.Run("HTTP/1", func(t *testing.T) {
+		conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: a\r\n\r\n"+
+			"POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n")
+
+		br := bufio.NewReader(conn)
+		for _, code := range []int{http.StatusOK, http.StatusBadRequest} {
+			resp, err := http.ReadResponse(br, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			assert.Equal(t, code, resp.StatusCode)
+		}
+	})
+
+	t.Run("HTTP/2", func(t *testing.T) {
+		client := &http.Client{Transport: &http2.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+		resp, err := client.Get("https://" + l.Addr().String() + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, 2, resp.ProtoMajor)
+	})
+
+	t.Run("HTTP/2 idle timeout", func(t *testing.T) {
+		conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{http2.NextProtoTLS}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, http2.ClientPreface)
+		framer := http2.NewFramer(conn, conn)
+		if err := framer.WriteSettings(); err != nil {
+			t.Fatal(err)
+		}
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			frame, err := framer.ReadFrame()
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					t.Fatal("Expected the idle connection to be closed")
+				}
+				return
+			}
+			if _, ok := frame.(*http2.GoAwayFrame); ok {
+				return
+			}
+		}
+	})
+}
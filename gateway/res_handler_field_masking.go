@@ -0,0 +1,297 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const (
+	maskingDefaultProfileMetadata = "masking_profile"
+	maskingDefaultVisibleChars    = 4
+	maskingRedacted               = "****"
+
+	maskingHash    = "hash"
+	maskingPartial = "partial"
+	maskingRemove  = "remove"
+)
+
+// jsonPathSegment is a step of a JSONPath: an object key, an array index,
+// or a wildcard matching every member or element.
+type jsonPathSegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseJSONPath parses the dot and bracket notations of JSONPath, such as
+// $.customer.cards[*].number or $.items[0]['name'].
+func parseJSONPath(path string) ([]jsonPathSegment, error) {
+	path = strings.TrimPrefix(strings.TrimSpace(path), "$")
+	var segs []jsonPathSegment
+	for len(path) > 0 {
+		switch path[0] {
+		case '.':
+			path = path[1:]
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			key := path[:end]
+			if key == "" {
+				return nil, fmt.Errorf("empty key in JSONPath")
+			}
+			segs = append(segs, jsonPathSegment{key: key, wildcard: key == "*"})
+			path = path[end:]
+		case '[':
+			end := strings.IndexByte(path, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated bracket in JSONPath")
+			}
+			inner := path[1:end]
+			path = path[end+1:]
+			switch {
+			case inner == "*":
+				segs = append(segs, jsonPathSegment{wildcard: true})
+			case len(inner) > 1 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				segs = append(segs, jsonPathSegment{key: inner[1 : len(inner)-1]})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid index %q in JSONPath", inner)
+				}
+				segs = append(segs, jsonPathSegment{index: index, isIndex: true})
+			}
+		default:
+			// a leading key without a dot
+			if len(segs) > 0 {
+				return nil, fmt.Errorf("unexpected %q in JSONPath", path[0])
+			}
+			path = "." + path
+		}
+	}
+	return segs, nil
+}
+
+// applyJSONPath calls fn on the values of node matching the path. fn returns
+// the new value, or false to remove it.
+func applyJSONPath(node interface{}, segs []jsonPathSegment, fn func(interface{}) (interface{}, bool)) interface{} {
+	if len(segs) == 0 {
+		return node
+	}
+	seg, rest := segs[0], segs[1:]
+
+	apply := func(value interface{}) (interface{}, bool) {
+		if len(rest) == 0 {
+			return fn(value)
+		}
+		return applyJSONPath(value, rest, fn), true
+	}
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if seg.isIndex {
+			return n
+		}
+		for key, value := range n {
+			if !seg.wildcard && key != seg.key {
+				continue
+			}
+			if masked, keep := apply(value); keep {
+				n[key] = masked
+			} else {
+				delete(n, key)
+			}
+		}
+		return n
+	case []interface{}:
+		if !seg.wildcard && !seg.isIndex {
+			return n
+		}
+		kept := n[:0]
+		for i, value := range n {
+			if seg.isIndex && i != seg.index {
+				kept = append(kept, value)
+				continue
+			}
+			if masked, keep := apply(value); keep {
+				kept = append(kept, masked)
+			}
+		}
+		return kept
+	}
+	return node
+}
+
+// maskValue masks a value following the strategy of a rule.
+func maskValue(rule apidef.FieldMaskingRule, value interface{}) (interface{}, bool) {
+	var str string
+	switch v := value.(type) {
+	case string:
+		str = v
+	case nil:
+		return nil, true
+	default:
+		raw, _ := json.Marshal(v)
+		str = string(raw)
+	}
+
+	switch rule.Strategy {
+	case maskingRemove:
+		return nil, false
+	case maskingHash:
+		sum := sha256.Sum256([]byte(str))
+		return hex.EncodeToString(sum[:]), true
+	case maskingPartial:
+		visible := rule.VisibleChars
+		if visible <= 0 {
+			visible = maskingDefaultVisibleChars
+		}
+		runes := []rune(str)
+		if len(runes) <= visible {
+			return strings.Repeat("*", len(runes)), true
+		}
+		return strings.Repeat("*", len(runes)-visible) + string(runes[len(runes)-visible:]), true
+	default:
+		return maskingRedacted, true
+	}
+}
+
+// validateFieldMasking checks the JSONPaths of the field masking rules of an
+// API, which isn't loaded if any is invalid rather than leave fields
+// unmasked.
+func validateFieldMasking(conf apidef.FieldMaskingMeta) error {
+	if !conf.Enabled {
+		return nil
+	}
+	for _, rule := range conf.Rules {
+		if _, err := parseJSONPath(rule.Path); err != nil {
+			return fmt.Errorf("field masking rule %q: %v", rule.Path, err)
+		}
+	}
+	return nil
+}
+
+type fieldMaskingRule struct {
+	apidef.FieldMaskingRule
+	segs []jsonPathSegment
+}
+
+// ResponseFieldMaskingMiddleware masks fields of JSON responses depending on
+// the masking profile of the caller.
+type ResponseFieldMaskingMiddleware struct {
+	Spec  *APISpec
+	rules []fieldMaskingRule
+}
+
+func (ResponseFieldMaskingMiddleware) Name() string {
+	return "ResponseFieldMaskingMiddleware"
+}
+
+func (h *ResponseFieldMaskingMiddleware) Init(c interface{}, spec *APISpec) error {
+	h.Spec = spec
+	h.rules = nil
+	for _, rule := range spec.FieldMasking.Rules {
+		segs, err := parseJSONPath(rule.Path)
+		if err != nil {
+			return fmt.Errorf("field masking rule %q: %v", rule.Path, err)
+		}
+		h.rules = append(h.rules, fieldMaskingRule{FieldMaskingRule: rule, segs: segs})
+	}
+	return nil
+}
+
+func (h *ResponseFieldMaskingMiddleware) HandleError(rw http.ResponseWriter, req *http.Request) {
+}
+
+// mandatory makes the masking run even when a response handler before it
+// fails, as a response that can't be masked is replaced by a 500.
+func (h *ResponseFieldMaskingMiddleware) mandatory() {}
+
+// profile returns the masking profile of the caller.
+func (h *ResponseFieldMaskingMiddleware) profile(ses *user.SessionState) string {
+	if ses == nil {
+		return ""
+	}
+	key := h.Spec.FieldMasking.ProfileMetadata
+	if key == "" {
+		key = maskingDefaultProfileMetadata
+	}
+	value, _ := ses.GetMetaDataByKey(key)
+	profile, _ := value.(string)
+	return profile
+}
+
+// matchingRules returns the rules applying to a masking profile. Callers
+// without a profile get every rule, for fields not to leak to callers whose
+// profile is missing.
+func (h *ResponseFieldMaskingMiddleware) matchingRules(profile string) []fieldMaskingRule {
+	var rules []fieldMaskingRule
+	for _, rule := range h.rules {
+		if profile == "" || len(rule.Profiles) == 0 || contains(rule.Profiles, profile) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// HandleResponse masks the fields of the response. Responses are masked
+// whatever their content type, and those that aren't JSON are blocked, for
+// an upstream not to leak fields by mislabelling its responses.
+func (h *ResponseFieldMaskingMiddleware) HandleResponse(rw http.ResponseWriter, res *http.Response, req *http.Request, ses *user.SessionState) error {
+	rules := h.matchingRules(h.profile(ses))
+	if len(rules) == 0 {
+		return nil
+	}
+
+	body := respBodyReader(req, res)
+	raw, err := ioutil.ReadAll(body)
+	body.Close()
+	if err == nil && len(bytes.TrimSpace(raw)) == 0 {
+		// nothing to mask
+		res.Header.Del(headers.ContentEncoding)
+		res.Body = ioutil.NopCloser(bytes.NewReader(raw))
+		return nil
+	}
+
+	var doc interface{}
+	if err == nil {
+		err = json.Unmarshal(raw, &doc)
+	}
+	if err != nil {
+		// the response must not reach the caller unmasked
+		res.StatusCode = http.StatusInternalServerError
+		res.Body = ioutil.NopCloser(bytes.NewReader(nil))
+		res.ContentLength = 0
+		res.Header.Set(headers.ContentLength, "0")
+		res.Header.Del(headers.ContentEncoding)
+		return fmt.Errorf("couldn't mask response fields: %v", err)
+	}
+	for _, rule := range rules {
+		rule := rule
+		doc = applyJSONPath(doc, rule.segs, func(value interface{}) (interface{}, bool) {
+			return maskValue(rule.FieldMaskingRule, value)
+		})
+	}
+
+	masked, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	res.Header.Del(headers.ContentEncoding)
+	res.Header.Set(headers.ContentLength, strconv.Itoa(len(masked)))
+	res.ContentLength = int64(len(masked))
+	res.Body = ioutil.NopCloser(bytes.NewReader(masked))
+	return nil
+}
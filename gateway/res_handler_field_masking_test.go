@@ -0,0 +1,134 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestApplyJSONPath(t *testing.T) {
+	const doc = `{"customer":{"email":"jane@example.com","cards":[{"number":"4111111111111111"},{"number":"5500000000000004"}]},"items":[1,2,3]}`
+
+	tests := []struct {
+		name     string
+		rule     apidef.FieldMaskingRule
+		expected string
+	}{
+		{"redact", apidef.FieldMaskingRule{Path: "$.customer.email"},
+			`{"customer":{"email":"****","cards":[{"number":"4111111111111111"},{"number":"5500000000000004"}]},"items":[1,2,3]}`},
+		{"partial", apidef.FieldMaskingRule{Path: "$.customer.cards[*].number", Strategy: "partial"},
+			`{"customer":{"email":"jane@example.com","cards":[{"number":"************1111"},{"number":"************0004"}]},"items":[1,2,3]}`},
+		{"remove", apidef.FieldMaskingRule{Path: "customer['cards'][0]", Strategy: "remove"},
+			`{"customer":{"email":"jane@example.com","cards":[{"number":"5500000000000004"}]},"items":[1,2,3]}`},
+		{"hash", apidef.FieldMaskingRule{Path: "$.items[1]", Strategy: "hash"},
+			`{"customer":{"email":"jane@example.com","cards":[{"number":"4111111111111111"},{"number":"5500000000000004"}]},"items":[1,"d4735e3a265e16eee03f59718b9b5d03019c07d8b6c51f90da3a666eec13ab35",3]}`},
+		{"missing", apidef.FieldMaskingRule{Path: "$.customer.phone"}, doc},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			segs, err := parseJSONPath(tc.rule.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, expected interface{}
+			json.Unmarshal([]byte(doc), &got)
+			json.Unmarshal([]byte(tc.expected), &expected)
+
+			got = applyJSONPath(got, segs, func(value interface{}) (interface{}, bool) {
+				return maskValue(tc.rule, value)
+			})
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("Expected %v, got %v", expected, got)
+			}
+		})
+	}
+
+	for _, path := range []string{"$.a[", "$.a..b", "$.a[x]"} {
+		if _, err := parseJSONPath(path); err == nil {
+			t.Errorf("Expected %q to be rejected", path)
+		}
+	}
+}
+
+func TestFieldMasking(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/mislabelled":
+			w.Header().Set("Content-Type", "text/plain")
+		case "/html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<p>jane@example.com</p>`))
+			return
+		default:
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.Write([]byte(`{"name":"Jane","email":"jane@example.com"}`))
+	}))
+	defer upstream.Close()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.FieldMasking.Enabled = true
+		spec.FieldMasking.Rules = []apidef.FieldMaskingRule{
+			{Path: "$.email", Strategy: "partial", VisibleChars: 11, Profiles: []string{"partner"}},
+		}
+	})
+
+	partnerPolicy := CreatePolicy(func(p *user.Policy) {
+		p.AccessRights = map[string]user.AccessDefinition{"test": {APIID: "test", Versions: []string{"v1"}}}
+		p.MetaData = map[string]interface{}{"masking_profile": "partner"}
+	})
+	partnerKey := CreateSession(func(s *user.SessionState) {
+		s.ApplyPolicies = []string{partnerPolicy}
+	})
+	internalKey := CreateSession(func(s *user.SessionState) {
+		s.AccessRights = map[string]user.AccessDefinition{"test": {APIID: "test", Versions: []string{"v1"}}}
+		s.MetaData = map[string]interface{}{"masking_profile": "internal"}
+	})
+	noProfileKey := CreateSession(func(s *user.SessionState) {
+		s.AccessRights = map[string]user.AccessDefinition{"test": {APIID: "test", Versions: []string{"v1"}}}
+	})
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/", Headers: map[string]string{"Authorization": partnerKey}, Code: http.StatusOK,
+			BodyMatch: `"email":"\*+example.com"`},
+		{Path: "/", Headers: map[string]string{"Authorization": internalKey}, Code: http.StatusOK,
+			BodyMatch: `"email":"jane@example.com"`},
+		// callers without a profile get every rule
+		{Path: "/", Headers: map[string]string{"Authorization": noProfileKey}, Code: http.StatusOK,
+			BodyMatch: `"email":"\*+example.com"`},
+		// responses are masked whatever their content type
+		{Path: "/mislabelled", Headers: map[string]string{"Authorization": partnerKey}, Code: http.StatusOK,
+			BodyMatch: `"email":"\*+example.com"`},
+		{Path: "/html", Headers: map[string]string{"Authorization": partnerKey}, Code: http.StatusInternalServerError,
+			BodyNotMatch: "jane@example.com"},
+		{Path: "/html", Headers: map[string]string{"Authorization": internalKey}, Code: http.StatusOK,
+			BodyMatch: "jane@example.com"},
+	}...)
+}
+
+func TestValidateFieldMasking(t *testing.T) {
+	conf := apidef.FieldMaskingMeta{
+		Enabled: true,
+		Rules:   []apidef.FieldMaskingRule{{Path: "$.email"}, {Path: "$.cards[x]"}},
+	}
+	if err := validateFieldMasking(conf); err == nil {
+		t.Error("Expected invalid JSONPaths to be rejected")
+	}
+	conf.Rules = conf.Rules[:1]
+	if err := validateFieldMasking(conf); err != nil {
+		t.Error(err)
+	}
+}
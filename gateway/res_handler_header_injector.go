@@ -6,7 +6,6 @@ import (
 	"github.com/mitchellh/mapstructure"
 
 	"github.com/TykTechnologies/tyk/apidef"
-	"github.com/TykTechnologies/tyk/config"
 	"github.com/TykTechnologies/tyk/user"
 )
 
@@ -34,7 +33,7 @@ func (h *HeaderInjector) HandleError(rw http.ResponseWriter, req *http.Request)
 func (h *HeaderInjector) HandleResponse(rw http.ResponseWriter, res *http.Response, req *http.Request, ses *user.SessionState) error {
 	// TODO: This should only target specific paths
 
-	ignoreCanonical := config.Global().IgnoreCanonicalMIMEHeaderKey
+	casing := h.Spec.headerCasing()
 	vInfo, versionPaths, _, _ := h.Spec.Version(req)
 	found, meta := h.Spec.CheckSpecMatchesStatus(req, versionPaths, HeaderInjectedResponse)
 	if found {
@@ -43,7 +42,7 @@ func (h *HeaderInjector) HandleResponse(rw http.ResponseWriter, res *http.Respon
 			res.Header.Del(dKey)
 		}
 		for nKey, nVal := range hmeta.AddHeaders {
-			setCustomHeader(res.Header, nKey, replaceTykVariables(req, nVal, false), ignoreCanonical)
+			setCustomHeader(res.Header, nKey, replaceTykVariables(req, nVal, false), casing)
 		}
 	}
 
@@ -55,7 +54,7 @@ func (h *HeaderInjector) HandleResponse(rw http.ResponseWriter, res *http.Respon
 
 	for key, val := range vInfo.GlobalResponseHeaders {
 		log.Debug("Adding: ", key)
-		setCustomHeader(res.Header, key, replaceTykVariables(req, val, false), ignoreCanonical)
+		setCustomHeader(res.Header, key, replaceTykVariables(req, val, false), casing)
 	}
 
 	// Manage global response header options with response_processors
@@ -63,7 +62,7 @@ func (h *HeaderInjector) HandleResponse(rw http.ResponseWriter, res *http.Respon
 		res.Header.Del(n)
 	}
 	for h, v := range h.config.AddHeaders {
-		setCustomHeader(res.Header, h, replaceTykVariables(req, v, false), ignoreCanonical)
+		setCustomHeader(res.Header, h, replaceTykVariables(req, v, false), casing)
 	}
 
 	return nil
@@ -7,7 +7,6 @@ import (
 
 	"github.com/mitchellh/mapstructure"
 
-	"github.com/TykTechnologies/tyk/config"
 	"github.com/TykTechnologies/tyk/user"
 )
 
@@ -48,7 +47,7 @@ func (h *HeaderTransform) HandleResponse(rw http.ResponseWriter,
 	if err != nil {
 		return err
 	}
-	ignoreCanonical := config.Global().IgnoreCanonicalMIMEHeaderKey
+	casing := h.Spec.headerCasing()
 	for _, name := range h.config.RevProxyTransform.Headers {
 		// check if header is present and its value is not empty
 		val := res.Header.Get(name)
@@ -73,7 +72,7 @@ func (h *HeaderTransform) HandleResponse(rw http.ResponseWriter,
 				val = strings.Replace(val, h.Spec.target.Path, "/", -1)
 			}
 		}
-		setCustomHeader(res.Header, name, val, ignoreCanonical)
+		setCustomHeader(res.Header, name, val, casing)
 	}
 	return nil
 }
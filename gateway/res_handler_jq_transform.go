@@ -61,9 +61,9 @@ func (h *ResponseTransformJQMiddleware) HandleResponse(rw http.ResponseWriter, r
 	res.Body = ioutil.NopCloser(bodyBuffer)
 
 	// Replace header in the response
-	ignoreCanonical := config.Global().IgnoreCanonicalMIMEHeaderKey
+	casing := h.Spec.headerCasing()
 	for hName, hValue := range jqResult.RewriteHeaders {
-		setCustomHeader(res.Header, hName, hValue, ignoreCanonical)
+		setCustomHeader(res.Header, hName, hValue, casing)
 	}
 
 	return nil
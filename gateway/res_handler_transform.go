@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/andybalholm/brotli"
 	"github.com/clbanning/mxj"
 	"github.com/sirupsen/logrus"
 
@@ -32,31 +33,19 @@ func (h *ResponseTransformMiddleware) Init(c interface{}, spec *APISpec) error {
 }
 
 func respBodyReader(req *http.Request, resp *http.Response) io.ReadCloser {
-
-	if req.Header.Get(headers.AcceptEncoding) == "" {
+	reader, err := bodyDecoder(resp.Header.Get(headers.ContentEncoding), resp.Body)
+	if err != nil {
+		log.Error("Body decompression error:", err)
+		return ioutil.NopCloser(bytes.NewReader(nil))
+	}
+	if reader == nil {
 		return resp.Body
 	}
 
-	switch resp.Header.Get(headers.ContentEncoding) {
-	case "gzip":
-		reader, err := gzip.NewReader(resp.Body)
-		if err != nil {
-			log.Error("Body decompression error:", err)
-			return ioutil.NopCloser(bytes.NewReader(nil))
-		}
-
-		// represents unknown length
-		resp.ContentLength = 0
+	// represents unknown length
+	resp.ContentLength = 0
 
-		return reader
-	case "deflate":
-		// represents unknown length
-		resp.ContentLength = 0
-
-		return flate.NewReader(resp.Body)
-	}
-
-	return resp.Body
+	return decodedBody{Reader: reader, Closer: resp.Body}
 }
 
 func compressBuffer(in bytes.Buffer, encoding string) (out bytes.Buffer) {
@@ -69,6 +58,10 @@ func compressBuffer(in bytes.Buffer, encoding string) (out bytes.Buffer) {
 		zw, _ := flate.NewWriter(&out, 1)
 		zw.Write(in.Bytes())
 		zw.Close()
+	case "br":
+		zw := brotli.NewWriter(&out)
+		zw.Write(in.Bytes())
+		zw.Close()
 	default:
 		out = in
 	}
@@ -93,7 +86,7 @@ func (h *ResponseTransformMiddleware) HandleResponse(rw http.ResponseWriter, res
 	if !found {
 		return nil
 	}
-	tmeta := meta.(*TransformSpec)
+	tmeta := meta.(*TransformSpec).forSession(ctxGetSession(req))
 
 	respBody := respBodyReader(req, res)
 	body, _ := ioutil.ReadAll(respBody)
@@ -143,12 +136,8 @@ func (h *ResponseTransformMiddleware) HandleResponse(rw http.ResponseWriter, res
 		bodyData["_tyk_context"] = ctxGetData(req)
 	}
 
-	if tmeta.TemplateData.EnableSession {
-		if session := ctxGetSession(req); session != nil {
-			bodyData["_tyk_meta"] = session.GetMetaData()
-		} else {
-			logger.Error("Session context was enabled but not found.")
-		}
+	if tmeta.TemplateData.EnableSession && !addSessionTemplateData(req, bodyData) {
+		logger.Error("Session context was enabled but not found.")
 	}
 
 	// Apply to template
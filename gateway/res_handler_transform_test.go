@@ -7,6 +7,7 @@ import (
 
 	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
 )
 
 func TestTransformResponseWithURLRewrite(t *testing.T) {
@@ -129,6 +130,51 @@ func TestTransformResponse_ContextVars(t *testing.T) {
 	})
 }
 
+func TestTransformResponse_Tiers(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	blob := func(tmpl string) apidef.TemplateData {
+		return apidef.TemplateData{
+			Mode:           "blob",
+			EnableSession:  true,
+			TemplateSource: base64.StdEncoding.EncodeToString([]byte(tmpl)),
+		}
+	}
+	transformResponseConf := apidef.TemplateMeta{
+		Path:         "get",
+		Method:       "GET",
+		TemplateData: blob(`{"tier":"{{._tyk_session.MetaData.tier}}","tags":"{{range ._tyk_session.Tags}}{{.}}{{end}}"}`),
+		TierMetadata: "tier",
+		TierTemplates: map[string]apidef.TemplateData{
+			"free": blob(`{"plan":"free"}`),
+		},
+	}
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/"
+		spec.ResponseProcessors = []apidef.ResponseProcessor{{Name: "response_body_transform"}}
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.ExtendedPaths.TransformResponse = []apidef.TemplateMeta{transformResponseConf}
+		})
+	})
+
+	tierKey := func(tier string) map[string]string {
+		key := CreateSession(func(s *user.SessionState) {
+			s.AccessRights = map[string]user.AccessDefinition{"test": {APIID: "test", Versions: []string{"v1"}}}
+			s.MetaData = map[string]interface{}{"tier": tier}
+			s.Tags = []string{"partner"}
+		})
+		return map[string]string{"Authorization": key}
+	}
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/get", Headers: tierKey("free"), Code: 200, BodyMatch: `{"plan":"free"}`},
+		{Path: "/get", Headers: tierKey("gold"), Code: 200, BodyMatch: `{"tier":"gold","tags":"partner"}`},
+	}...)
+}
+
 func TestTransformResponse_WithCache(t *testing.T) {
 	const path = "/get"
 
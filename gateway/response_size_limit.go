@@ -0,0 +1,95 @@
+package gateway
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/ctx"
+	"github.com/TykTechnologies/tyk/request"
+)
+
+// errResponseTooLarge is returned reading an upstream response past the
+// maximum size of its API.
+var errResponseTooLarge = errors.New("upstream response exceeds the maximum size")
+
+// maxResponseBodySize returns the maximum size of the upstream responses of
+// an API in bytes, or 0 if they aren't limited.
+func maxResponseBodySize(spec *APISpec) int64 {
+	switch {
+	case spec.Proxy.MaxResponseBodySize > 0:
+		return spec.Proxy.MaxResponseBodySize
+	case spec.Proxy.MaxResponseBodySize < 0:
+		return 0
+	}
+	if spec.GlobalConfig.MaxResponseBodySize > 0 {
+		return spec.GlobalConfig.MaxResponseBodySize
+	}
+	return 0
+}
+
+// limitedResponseBody fails reads of an upstream response past its maximum
+// size, and remembers it did.
+type limitedResponseBody struct {
+	io.ReadCloser
+	remaining int64
+	exceeded  bool
+}
+
+func (b *limitedResponseBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, errResponseTooLarge
+	}
+	// read a byte more than allowed to tell a body of exactly the maximum
+	// size from a larger one
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remaining {
+		n = int(b.remaining)
+		b.remaining = 0
+		b.exceeded = true
+		return n, errResponseTooLarge
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// limitResponseBody limits the size of an upstream response. It returns
+// false if the response announces a larger size, and nil if it isn't
+// limited.
+func limitResponseBody(res *http.Response, limit int64) (*limitedResponseBody, bool) {
+	if limit <= 0 || res.Body == nil {
+		return nil, true
+	}
+	if res.ContentLength > limit {
+		return nil, false
+	}
+	body := &limitedResponseBody{ReadCloser: res.Body, remaining: limit}
+	res.Body = body
+	return body, true
+}
+
+// reportResponseTooLarge logs and fires the event of an upstream response
+// larger than the maximum size of its API.
+func (p *ReverseProxy) reportResponseTooLarge(r *http.Request, limit int64) {
+	p.logger.WithFields(logrus.Fields{
+		"prefix":      "proxy",
+		"server_name": r.Host,
+		"org_id":      p.TykAPISpec.OrgID,
+		"api_id":      p.TykAPISpec.APIID,
+		"limit":       limit,
+	}).Error("Upstream response exceeds the maximum size")
+
+	ctx.AddAnalyticsTags(r, "response-size-exceeded")
+	fireEvent(EventResponseSizeExceeded, EventResponseSizeExceededMeta{
+		EventMetaDefault: EventMetaDefault{Message: "Upstream response exceeds the maximum size", OriginatingRequest: EncodeRequestToEvent(r)},
+		Path:             r.URL.Path,
+		Origin:           request.RealIP(r),
+		APIID:            p.TykAPISpec.APIID,
+		Limit:            limit,
+	}, p.TykAPISpec.EventPaths)
+}
@@ -0,0 +1,76 @@
+package gateway
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestLimitedResponseBody(t *testing.T) {
+	read := func(body string, limit int64) (string, bool) {
+		res := &http.Response{Body: ioutil.NopCloser(strings.NewReader(body)), ContentLength: -1}
+		limited, ok := limitResponseBody(res, limit)
+		assert.True(t, ok)
+		data, _ := ioutil.ReadAll(res.Body)
+		return string(data), limited.exceeded
+	}
+
+	data, exceeded := read("0123456789", 10)
+	assert.Equal(t, "0123456789", data)
+	assert.False(t, exceeded)
+
+	data, exceeded = read("0123456789", 4)
+	assert.Equal(t, "0123", data)
+	assert.True(t, exceeded)
+
+	_, ok := limitResponseBody(&http.Response{Body: ioutil.NopCloser(strings.NewReader("")), ContentLength: 11}, 10)
+	assert.False(t, ok, "Responses announcing a larger size should be rejected")
+}
+
+func TestMaxResponseBodySize(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := strings.Repeat("x", 1024)
+		if r.URL.Path == "/chunked" {
+			w.Write([]byte(body[:512]))
+			w.(http.Flusher).Flush()
+			w.Write([]byte(body[512:]))
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer upstream.Close()
+
+	globalConf := config.Global()
+	globalConf.MaxResponseBodySize = 100
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "limited"
+		spec.Proxy.ListenPath = "/limited/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.Proxy.StripListenPath = true
+	}, func(spec *APISpec) {
+		spec.APIID = "unlimited"
+		spec.Proxy.ListenPath = "/unlimited/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.Proxy.StripListenPath = true
+		spec.Proxy.MaxResponseBodySize = -1
+	})
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/limited/", Code: http.StatusBadGateway, BodyMatch: "Upstream response too large"},
+		{Path: "/limited/chunked", ErrorMatch: "EOF"},
+		{Path: "/unlimited/", Code: http.StatusOK, BodyMatch: strings.Repeat("x", 1024)},
+	}...)
+}
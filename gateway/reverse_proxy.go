@@ -35,7 +35,6 @@ import (
 	gqlhttp "github.com/jensneuse/graphql-go-tools/pkg/http"
 	"github.com/jensneuse/graphql-go-tools/pkg/subscription"
 
-	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
 	"github.com/pmylund/go-cache"
 	"github.com/sirupsen/logrus"
@@ -45,6 +44,7 @@ import (
 	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/config"
 	"github.com/TykTechnologies/tyk/ctx"
+	"github.com/TykTechnologies/tyk/dnscache"
 	"github.com/TykTechnologies/tyk/headers"
 	"github.com/TykTechnologies/tyk/regexp"
 	"github.com/TykTechnologies/tyk/trace"
@@ -61,6 +61,17 @@ var corsHeaders = []string{
 	"Access-Control-Allow-Methods",
 	"Access-Control-Allow-Headers"}
 
+// securityHeaderNames are the headers of the API security headers options,
+// which take precedence over the upstream ones.
+var securityHeaderNames = []string{
+	headers.StrictTransportSecurity,
+	headers.XContentTypeOptions,
+	headers.ContentSecurityPolicy,
+	headers.XFrameOptions,
+	headers.ReferrerPolicy,
+	headers.PermissionsPolicy,
+}
+
 var ServiceCache *cache.Cache
 var sdMu sync.RWMutex
 
@@ -233,8 +244,12 @@ func TykNewSingleHostReverseProxy(target *url.URL, spec *APISpec, logger *logrus
 
 	targetQuery := target.RawQuery
 	director := func(req *http.Request) {
+		splitTarget := trafficSplitTarget(spec, req)
 		hostList := spec.Proxy.StructuredTargetList
 		switch {
+		case splitTarget != nil:
+			// the variant replaces the targets of the API, load balanced
+			// or discovered ones included
 		case spec.Proxy.ServiceDiscovery.UseDiscoveryService:
 			var err error
 			hostList, err = urlFromService(spec)
@@ -260,7 +275,21 @@ func TykNewSingleHostReverseProxy(target *url.URL, spec *APISpec, logger *logrus
 		}
 
 		targetToUse := target
+		query := targetQuery
+		if splitTarget != nil {
+			log.Debug("Detected traffic split variant: ", ctxGetTrafficSplitVariant(req))
+			targetToUse = splitTarget
+			query = splitTarget.RawQuery
+		}
 
+		// Plugins may replace the target of a single request
+		if override := ctx.GetUpstreamTarget(req); override != nil {
+			log.Debug("Detected upstream target override")
+			targetToUse = override
+			query = override.RawQuery
+		}
+
+		hostRewritten := false
 		if spec.URLRewriteEnabled && req.Context().Value(ctx.RetainHost) == true {
 			log.Debug("Detected host rewrite, overriding target")
 			tmpTarget, err := url.Parse(req.URL.String())
@@ -269,15 +298,16 @@ func TykNewSingleHostReverseProxy(target *url.URL, spec *APISpec, logger *logrus
 			} else {
 				// Specifically override with a URL rewrite
 				targetToUse = tmpTarget
+				hostRewritten = true
 			}
 		}
 
 		// No override, and no load balancing? Use the existing target
 
-		// if this is false, there was an url rewrite, thus we
+		// if this is true, there was an url rewrite, thus we
 		// don't want to do anything to the path - req.URL is
 		// already final.
-		if targetToUse == target {
+		if !hostRewritten {
 			req.URL.Scheme = targetToUse.Scheme
 			req.URL.Host = targetToUse.Host
 			req.URL.Path = singleJoiningSlash(targetToUse.Path, req.URL.Path, spec.Proxy.DisableStripSlash)
@@ -290,10 +320,10 @@ func TykNewSingleHostReverseProxy(target *url.URL, spec *APISpec, logger *logrus
 			req.Host = targetToUse.Host
 		}
 
-		if targetQuery == "" || req.URL.RawQuery == "" {
-			req.URL.RawQuery = targetQuery + req.URL.RawQuery
+		if query == "" || req.URL.RawQuery == "" {
+			req.URL.RawQuery = query + req.URL.RawQuery
 		} else {
-			req.URL.RawQuery = targetQuery + "&" + req.URL.RawQuery
+			req.URL.RawQuery = query + "&" + req.URL.RawQuery
 		}
 		if _, ok := req.Header[headers.UserAgent]; !ok {
 			// Set Tyk's own default user agent. Without
@@ -338,12 +368,6 @@ func TykNewSingleHostReverseProxy(target *url.URL, spec *APISpec, logger *logrus
 				return true
 			},
 		},
-		sp: sync.Pool{
-			New: func() interface{} {
-				buffer := make([]byte, 32*1024)
-				return &buffer
-			},
-		},
 	}
 	proxy.ErrorHandler.BaseMiddleware = BaseMiddleware{Spec: spec, Proxy: proxy}
 	return proxy
@@ -381,33 +405,116 @@ type ReverseProxy struct {
 	ErrorHandler ErrorHandler
 
 	logger *logrus.Entry
-	sp     sync.Pool
 }
 
-func defaultTransport(dialerTimeout float64) *http.Transport {
+// proxyBuffers are the buffers bodies are copied through. They are shared by
+// the proxies of all APIs, so that they are kept across reloads.
+var proxyBuffers = sync.Pool{
+	New: func() interface{} {
+		buffer := make([]byte, 32*1024)
+		return &buffer
+	},
+}
+
+func defaultTransport(dialerTimeout float64, proxyConfig apidef.ProxyConfig, apiID string) *http.Transport {
 	timeout := 30.0
 	if dialerTimeout > 0 {
 		log.Debug("Setting timeout for outbound request to: ", dialerTimeout)
 		timeout = dialerTimeout
 	}
 
+	transportConfig := proxyConfig.Transport
+
+	keepAlive := 30 * time.Second
+	if transportConfig.TCPKeepAlive != 0 {
+		keepAlive = time.Duration(transportConfig.TCPKeepAlive) * time.Second
+	}
+
 	dialer := &net.Dialer{
 		Timeout:   time.Duration(float64(timeout) * float64(time.Second)),
-		KeepAlive: 30 * time.Second,
+		KeepAlive: keepAlive,
 		DualStack: true,
 	}
 	dialContextFunc := dialer.DialContext
-	if dnsCacheManager.IsCacheEnabled() {
+	if proxyConfig.DNS.Enabled() {
+		dialContextFunc = apiDnsCacheManager(apiID, proxyConfig.DNS, dialer).WrapDialer(dialer)
+	} else if dnsCacheManager.IsCacheEnabled() {
 		dialContextFunc = dnsCacheManager.WrapDialer(dialer)
 	}
 
-	return &http.Transport{
+	transport := &http.Transport{
 		DialContext:           dialContextFunc,
 		MaxIdleConns:          config.Global().MaxIdleConns,
 		MaxIdleConnsPerHost:   config.Global().MaxIdleConnsPerHost, // default is 100
+		MaxConnsPerHost:       transportConfig.MaxConnsPerHost,
 		ResponseHeaderTimeout: time.Duration(dialerTimeout) * time.Second,
 		TLSHandshakeTimeout:   10 * time.Second,
 	}
+
+	// API specific pool settings take precedence over the global ones
+	if transportConfig.MaxIdleConns > 0 {
+		transport.MaxIdleConns = transportConfig.MaxIdleConns
+	}
+	if transportConfig.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = transportConfig.MaxIdleConnsPerHost
+	}
+	if transportConfig.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = time.Duration(transportConfig.IdleConnTimeout) * time.Second
+	}
+
+	return transport
+}
+
+// apiDnsCacheManager returns a dns cache manager applying the API specific
+// DNS options on top of the global DNS cache configuration. Its cache is
+// listed in apiDNSCaches.
+func apiDnsCacheManager(apiID string, dnsConfig apidef.DNSConfig, dialer *net.Dialer) *dnscache.DnsCacheManager {
+	globalConf := config.Global()
+	manager := dnscache.NewDnsCacheManager(globalConf.DnsCache.MultipleIPsHandleStrategy)
+
+	overrides := make(map[string][]string, len(dnsConfig.Overrides))
+	for _, o := range dnsConfig.Overrides {
+		overrides[o.Host] = o.IPs
+	}
+	manager.SetOverrides(overrides)
+
+	var resolver *net.Resolver
+	if dnsConfig.Resolver != "" {
+		resolver = dnscache.NewResolver(dnsConfig.Resolver)
+		dialer.Resolver = resolver
+	}
+
+	if globalConf.DnsCache.Enabled || dnsConfig.TTL > 0 {
+		ttl := globalConf.DnsCache.TTL
+		if dnsConfig.TTL > 0 {
+			ttl = dnsConfig.TTL
+		}
+		checkInterval := globalConf.DnsCache.CheckInterval
+		if checkInterval <= 0 {
+			checkInterval = ttl
+		}
+		storage := dnscache.NewDnsCacheStorageWithResolver(
+			time.Duration(ttl)*time.Second,
+			time.Duration(checkInterval)*time.Second,
+			resolver,
+		)
+		negativeTTL := globalConf.DnsCache.NegativeTTL
+		if dnsConfig.NegativeTTL > 0 {
+			negativeTTL = dnsConfig.NegativeTTL
+		}
+		storage.SetNegativeTTL(time.Duration(negativeTTL) * time.Second)
+		maxEntries := globalConf.DnsCache.MaxEntries
+		if dnsConfig.MaxEntries > 0 {
+			maxEntries = dnsConfig.MaxEntries
+		}
+		storage.SetMaxEntries(maxEntries)
+		manager.SetCacheStorage(storage)
+		apiDNSCaches.Store(apiID, storage)
+	} else {
+		apiDNSCaches.Delete(apiID)
+	}
+
+	return manager
 }
 
 func singleJoiningSlash(a, b string, disableStripSlash bool) string {
@@ -431,24 +538,35 @@ func removeDuplicateCORSHeader(dst, src http.Header) {
 	}
 }
 
-func copyHeader(dst, src http.Header, ignoreCanonical bool) {
+func removeDuplicateSecurityHeaders(dst, src http.Header) {
+	for _, name := range securityHeaderNames {
+		if dst.Get(name) != "" {
+			src.Del(name)
+		}
+	}
+}
+
+func copyHeader(dst, src http.Header, casing headerCasing) {
 
 	removeDuplicateCORSHeader(dst, src)
+	removeDuplicateSecurityHeaders(dst, src)
 
 	for k, vv := range src {
-		if ignoreCanonical {
-			dst[k] = append(dst[k], vv...)
+		if name, keep := casing.key(k); keep {
+			dst[name] = append(dst[name], vv...)
 			continue
 		}
 		for _, v := range vv {
 			dst.Add(k, v)
 		}
 	}
+	casing.rename(dst)
 }
 
-func addCustomHeader(h http.Header, key string, value []string, ignoreCanonical bool) {
-	if ignoreCanonical {
-		h[key] = append(h[key], value...)
+func addCustomHeader(h http.Header, key string, value []string, casing headerCasing) {
+	if name, keep := casing.key(key); keep {
+		h[name] = append(h[name], value...)
+		casing.rename(h)
 	} else {
 		for _, v := range value {
 			h.Add(key, v)
@@ -457,20 +575,28 @@ func addCustomHeader(h http.Header, key string, value []string, ignoreCanonical
 
 }
 
-func setCustomHeader(h http.Header, key string, value string, ignoreCanonical bool) {
-	if ignoreCanonical {
-		h[key] = []string{value}
+func setCustomHeader(h http.Header, key string, value string, casing headerCasing) {
+	if name, keep := casing.key(key); keep {
+		casing.del(h, key)
+		h[name] = []string{value}
 	} else {
 		h.Set(key, value)
 	}
 }
 
+// cloneHeader copies h, its values in a single allocation.
 func cloneHeader(h http.Header) http.Header {
+	n := 0
+	for _, vv := range h {
+		n += len(vv)
+	}
+	values := make([]string, n)
 	h2 := make(http.Header, len(h))
 	for k, vv := range h {
-		vv2 := make([]string, len(vv))
-		copy(vv2, vv)
-		h2[k] = vv2
+		n = copy(values, vv)
+		// capped for appends not to overwrite the next values
+		h2[k] = values[:n:n]
+		values = values[n:]
 	}
 	return h2
 }
@@ -568,15 +694,6 @@ func (p *ReverseProxy) CheckCircuitBreakerEnforced(spec *APISpec, req *http.Requ
 	return false, nil
 }
 
-func proxyFromAPI(api *APISpec) func(*http.Request) (*url.URL, error) {
-	return func(req *http.Request) (*url.URL, error) {
-		if api != nil && api.Proxy.Transport.ProxyURL != "" {
-			return url.Parse(api.Proxy.Transport.ProxyURL)
-		}
-		return http.ProxyFromEnvironment(req)
-	}
-}
-
 func tlsClientConfig(s *APISpec) *tls.Config {
 	config := &tls.Config{}
 
@@ -620,7 +737,7 @@ func tlsClientConfig(s *APISpec) *tls.Config {
 }
 
 func httpTransport(timeOut float64, rw http.ResponseWriter, req *http.Request, p *ReverseProxy) *TykRoundTripper {
-	transport := defaultTransport(timeOut) // modifies a newly created transport
+	transport := defaultTransport(timeOut, p.TykAPISpec.Proxy, p.TykAPISpec.APIID) // modifies a newly created transport
 	transport.TLSClientConfig = &tls.Config{}
 	transport.Proxy = proxyFromAPI(p.TykAPISpec)
 
@@ -673,24 +790,37 @@ func httpTransport(timeOut float64, rw http.ResponseWriter, req *http.Request, p
 		transport.TLSClientConfig.Renegotiation = tls.RenegotiateFreelyAsClient
 	}
 
+	transport.DialTLS = proxyDialTLS(p.TykAPISpec, transport.TLSClientConfig, transport.DialContext, transport.DialTLS)
+
+	transport.DialContext = countDialContext(transport.DialContext)
+	if transport.DialTLS != nil {
+		transport.DialTLS = countDial(transport.DialTLS)
+	}
+
 	transport.DisableKeepAlives = p.TykAPISpec.GlobalConfig.ProxyCloseConnections
 
-	if config.Global().ProxyEnableHttp2 {
+	if config.Global().ProxyEnableHttp2 || p.TykAPISpec.Proxy.Transport.ForceHTTP2 {
 		http2.ConfigureTransport(transport)
 	}
 
+	// Only offer HTTP/2 during TLS negotiation, so that upstreams which don't
+	// support it fail instead of silently falling back to HTTP/1.1
+	if p.TykAPISpec.Proxy.Transport.ForceHTTP2 {
+		transport.TLSClientConfig.NextProtos = []string{http2.NextProtoTLS}
+	}
+
 	if p.TykAPISpec.Protocol == "h2c" {
 		h2t := &http2.Transport{
 			// kind of a hack, but for plaintext/H2C requests, pretend to dial TLS
 			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
-				return net.Dial(network, addr)
+				return countDial(net.Dial)(network, addr)
 			},
 			AllowHTTP: true,
 		}
-		return &TykRoundTripper{transport, h2t, p.logger}
+		return &TykRoundTripper{transport, h2t, p.logger, p.TykAPISpec}
 	}
 
-	return &TykRoundTripper{transport, nil, p.logger}
+	return &TykRoundTripper{transport, nil, p.logger, p.TykAPISpec}
 }
 
 func (p *ReverseProxy) setCommonNameVerifyPeerCertificate(tlsConfig *tls.Config, hostName string) {
@@ -746,14 +876,15 @@ type TykRoundTripper struct {
 	transport    *http.Transport
 	h2ctransport *http2.Transport
 	logger       *logrus.Entry
+	spec         *APISpec
 }
 
 func (rt *TykRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
 	if r.URL.Scheme == "tyk" {
-		handler, found := findInternalHttpHandlerByNameOrID(r.Host)
-		if !found {
-			rt.logger.WithField("looping_url", "tyk://"+r.Host).Error("Couldn't detect target")
-			return nil, errors.New("handler could")
+		handler, err := loopTarget(r, rt.spec, r.Host, 0)
+		if err != nil {
+			rt.logger.WithField("looping_url", "tyk://"+r.Host).Error(err)
+			return nil, err
 		}
 
 		r.URL.Scheme = ""
@@ -767,9 +898,9 @@ func (rt *TykRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
 	}
 
 	if rt.h2ctransport != nil {
-		return rt.h2ctransport.RoundTrip(r)
+		return countRoundTrip(r, rt.h2ctransport.RoundTrip)
 	}
-	return rt.transport.RoundTrip(r)
+	return countRoundTrip(r, rt.transport.RoundTrip)
 }
 
 func (p *ReverseProxy) handleOutboundRequest(roundTripper *TykRoundTripper, outreq *http.Request, w http.ResponseWriter) (res *http.Response, hijacked bool, latency time.Duration, err error) {
@@ -793,6 +924,10 @@ func (p *ReverseProxy) handleGraphQL(roundTripper *TykRoundTripper, outreq *http
 		return p.handleGraphQLEngineWebsocketUpgrade(roundTripper, outreq, w)
 	}
 
+	if ctxGetGraphQLIsSSE(outreq) {
+		return p.handleGraphQLEngineSSE(roundTripper, outreq, w)
+	}
+
 	gqlRequest := ctxGetGraphQLRequest(outreq)
 	if gqlRequest == nil {
 		err = errors.New("graphql request is nil")
@@ -820,7 +955,7 @@ func (p *ReverseProxy) handleGraphQL(roundTripper *TykRoundTripper, outreq *http
 }
 
 func (p *ReverseProxy) handleGraphQLIntrospection() (res *http.Response, err error) {
-	result, err := graphql.SchemaIntrospection(p.TykAPISpec.GraphQLExecutor.Schema)
+	result, err := graphql.SchemaIntrospection(p.TykAPISpec.graphQLSchema())
 	if err != nil {
 		return
 	}
@@ -863,13 +998,14 @@ func (p *ReverseProxy) handoverRequestToGraphQLExecutionEngine(roundTripper *Tyk
 		res = result.GetAsHTTPResponse()
 		return
 	case apidef.GraphQLConfigVersion2:
-		if p.TykAPISpec.GraphQLExecutor.EngineV2 == nil {
+		engine := p.TykAPISpec.graphQLEngineV2()
+		if engine == nil {
 			err = errors.New("execution engine is nil")
 			return
 		}
 
 		resultWriter := graphql.NewEngineResultWriter()
-		err = p.TykAPISpec.GraphQLExecutor.EngineV2.Execute(context.Background(), gqlRequest, &resultWriter,
+		err = engine.Execute(context.Background(), gqlRequest, &resultWriter,
 			graphql.WithBeforeFetchHook(p.TykAPISpec.GraphQLExecutor.HooksV2.BeforeFetchHook),
 			graphql.WithAfterFetchHook(p.TykAPISpec.GraphQLExecutor.HooksV2.AfterFetchHook),
 		)
@@ -900,7 +1036,7 @@ func (p *ReverseProxy) handoverWebSocketConnectionToGraphQLExecutionEngine(round
 	case apidef.GraphQLConfigVersion1:
 		executorPool = subscription.NewExecutorV1Pool(p.TykAPISpec.GraphQLExecutor.Engine.NewExecutionHandler())
 	case apidef.GraphQLConfigVersion2:
-		executorPool = subscription.NewExecutorV2Pool(p.TykAPISpec.GraphQLExecutor.EngineV2)
+		executorPool = subscription.NewExecutorV2Pool(p.TykAPISpec.graphQLEngineV2())
 	}
 
 	go gqlhttp.HandleWebsocket(done, errChan, conn, executorPool, absLogger)
@@ -987,12 +1123,10 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 	outreq = outreq.WithContext(reqCtx)
 
 	outreq.Header = cloneHeader(req.Header)
-	if trace.IsEnabled() {
-		span := opentracing.SpanFromContext(req.Context())
-		trace.Inject(p.TykAPISpec.Name, span, outreq.Header)
-	}
+	propagateTraceContext(p.TykAPISpec, req, outreq.Header)
 	p.Director(outreq)
 	outreq.Close = false
+	tagTrafficSplitVariant(outreq, req, logreq)
 
 	p.logger.Debug("Outbound request URL: ", outreq.URL.String())
 
@@ -1033,8 +1167,14 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 		outreq.Header.Set(headers.XForwardFor, addrs)
 	}
 
+	if strictHeaders := p.TykAPISpec.StrictHeaders.Request; strictHeaders.Enabled {
+		filterHeaders(outreq.Header, strictHeaders.Allowed, outReqUpgrade)
+	}
+	p.TykAPISpec.headerCasing().rename(outreq.Header)
+
 	// Circuit breaker
 	breakerEnforced, breakerConf := p.CheckCircuitBreakerEnforced(p.TykAPISpec, req)
+	fallback := p.fallbackFor(req)
 
 	// set up TLS certificates for upstream if needed
 	var tlsCertificates []tls.Certificate
@@ -1076,6 +1216,9 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 	if breakerEnforced {
 		if !breakerConf.CB.Ready() {
 			p.logger.Debug("ON REQUEST: Circuit Breaker is in OPEN state")
+			if resp, ok := p.serveInsteadOfUpstream(rw, req, fallback, true, 0, "circuit breaker open"); ok {
+				return resp
+			}
 			p.ErrorHandler.HandleError(rw, logreq, "Service temporarily unavailable.", 503, true)
 			return ProxyResponse{}
 		}
@@ -1092,6 +1235,11 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 	}
 
 	if err != nil {
+		if !strings.Contains(err.Error(), "context canceled") {
+			if resp, ok := p.serveInsteadOfUpstream(rw, req, fallback, true, upstreamLatency, err.Error()); ok {
+				return resp
+			}
+		}
 
 		token := ctxGetAuthToken(req)
 
@@ -1100,6 +1248,24 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 			alias = session.Alias
 		}
 
+		if reason, ok := upstreamProxyError(p.TykAPISpec, outreq, err); ok {
+			var proxyHost string
+			if proxyURL, err := url.Parse(p.TykAPISpec.Proxy.Transport.ProxyURL); err == nil {
+				proxyHost = proxyURL.Host
+			}
+			p.logger.WithFields(logrus.Fields{
+				"prefix":      "proxy",
+				"user_ip":     addrs,
+				"server_name": outreq.Host,
+				"proxy_host":  proxyHost,
+				"org_id":      p.TykAPISpec.OrgID,
+				"api_id":      p.TykAPISpec.APIID,
+			}).Error(reason+": ", err)
+			ctx.AddAnalyticsTags(logreq, "upstream-proxy-error")
+			p.ErrorHandler.HandleError(rw, logreq, reason, http.StatusBadGateway, true)
+			return ProxyResponse{UpstreamLatency: upstreamLatency}
+		}
+
 		p.logger.WithFields(logrus.Fields{
 			"prefix":      "proxy",
 			"user_ip":     addrs,
@@ -1126,6 +1292,11 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 			return ProxyResponse{UpstreamLatency: upstreamLatency}
 		}
 
+		if loopErr := (*loopError)(nil); errors.As(err, &loopErr) {
+			p.ErrorHandler.HandleError(rw, logreq, loopErr.Error(), http.StatusInternalServerError, true)
+			return ProxyResponse{UpstreamLatency: upstreamLatency}
+		}
+
 		if strings.Contains(err.Error(), "no such host") {
 			p.ErrorHandler.HandleError(rw, logreq, "Upstream host lookup failed", http.StatusInternalServerError, true)
 			return ProxyResponse{UpstreamLatency: upstreamLatency}
@@ -1139,6 +1310,18 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 		return ProxyResponse{UpstreamLatency: upstreamLatency}
 	}
 
+	statusFallback := fallback
+	if statusFallback != nil && !fallbackOnStatus(statusFallback, res.StatusCode) {
+		statusFallback = nil
+	}
+	if upstreamFailed := res.StatusCode/100 == 5; statusFallback != nil || upstreamFailed {
+		reason := "upstream answered with " + strconv.Itoa(res.StatusCode)
+		if resp, ok := p.serveInsteadOfUpstream(rw, req, statusFallback, upstreamFailed, upstreamLatency, reason); ok {
+			res.Body.Close()
+			return resp
+		}
+	}
+
 	upgrade, _ := IsUpgrade(req)
 	// Deal with 101 Switching Protocols responses: (WebSocket, h2c, etc)
 	if upgrade {
@@ -1157,6 +1340,32 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 	// the trick. Chain can be empty, in which case this is a no-op.
 	// abortRequest is set to true when a response hook fails
 	// For reference see "HandleError" in coprocess.go
+	if strictHeaders := p.TykAPISpec.StrictHeaders.Response; strictHeaders.Enabled {
+		filterHeaders(res.Header, strictHeaders.Allowed, upgrade)
+	}
+
+	if p.TykAPISpec.Compression.DecompressUpstream {
+		if err := decompressResponse(res); err != nil {
+			p.logger.WithError(err).Error("Failed to decompress upstream response")
+		}
+	}
+
+	responseSizeLimit := maxResponseBodySize(p.TykAPISpec)
+	var limitedBody *limitedResponseBody
+	if !upgrade {
+		var ok bool
+		if limitedBody, ok = limitResponseBody(res, responseSizeLimit); !ok {
+			res.Body.Close()
+			p.reportResponseTooLarge(logreq, responseSizeLimit)
+			p.ErrorHandler.HandleError(rw, logreq, "Upstream response too large", http.StatusBadGateway, true)
+			return ProxyResponse{UpstreamLatency: upstreamLatency}
+		}
+	}
+
+	if fallback != nil && fallback.Type == fallbackCached && !upgrade {
+		p.keepLastGoodResponse(req, res, fallback)
+	}
+
 	abortRequest, err := handleResponseChain(p.TykAPISpec.ResponseChain, rw, res, req, ses)
 	if abortRequest {
 		return ProxyResponse{UpstreamLatency: upstreamLatency}
@@ -1186,10 +1395,27 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 		}
 	}
 
+	// the response chain or the cache may have read the whole response
+	if limitedBody != nil && limitedBody.exceeded {
+		p.reportResponseTooLarge(logreq, responseSizeLimit)
+		p.ErrorHandler.HandleError(rw, logreq, "Upstream response too large", http.StatusBadGateway, true)
+		return ProxyResponse{UpstreamLatency: upstreamLatency}
+	}
+
 	// We should at least copy the status code in
 	inres.StatusCode = res.StatusCode
 	inres.ContentLength = res.ContentLength
+
+	if p.TykAPISpec.Compression.Enabled && !upgrade {
+		compressResponse(req, res, p.TykAPISpec.Compression)
+	}
+
 	p.HandleResponse(rw, res, ses)
+	if limitedBody != nil && limitedBody.exceeded {
+		p.reportResponseTooLarge(logreq, responseSizeLimit)
+		// the response is already on its way, it is aborted once recorded
+		return ProxyResponse{UpstreamLatency: upstreamLatency, Response: inres, Aborted: true}
+	}
 	return ProxyResponse{UpstreamLatency: upstreamLatency, Response: inres}
 }
 
@@ -1224,7 +1450,7 @@ func (p *ReverseProxy) HandleResponse(rw http.ResponseWriter, res *http.Response
 		res.Header.Set(headers.XRateLimitReset, strconv.Itoa(int(quotaRenews)))
 	}
 
-	copyHeader(rw.Header(), res.Header, config.Global().IgnoreCanonicalMIMEHeaderKey)
+	copyHeader(rw.Header(), res.Header, p.TykAPISpec.headerCasing())
 
 	announcedTrailers := len(res.Trailer)
 	if announcedTrailers > 0 {
@@ -1249,7 +1475,7 @@ func (p *ReverseProxy) HandleResponse(rw http.ResponseWriter, res *http.Response
 	p.CopyResponse(rw, res.Body)
 
 	if len(res.Trailer) == announcedTrailers {
-		copyHeader(rw.Header(), res.Trailer, config.Global().IgnoreCanonicalMIMEHeaderKey)
+		copyHeader(rw.Header(), res.Trailer, p.TykAPISpec.headerCasing())
 		return nil
 	}
 
@@ -1281,8 +1507,8 @@ func (p *ReverseProxy) CopyResponse(dst io.Writer, src io.Reader) {
 
 func (p *ReverseProxy) copyBuffer(dst io.Writer, src io.Reader) (int64, error) {
 
-	buf := p.sp.Get().(*[]byte)
-	defer p.sp.Put(buf)
+	buf := proxyBuffers.Get().(*[]byte)
+	defer proxyBuffers.Put(buf)
 
 	var written int64
 	for {
@@ -1320,7 +1546,7 @@ func upgradeType(h http.Header) string {
 }
 
 func (p *ReverseProxy) handleUpgradeResponse(rw http.ResponseWriter, req *http.Request, res *http.Response) error {
-	copyHeader(res.Header, rw.Header(), config.Global().IgnoreCanonicalMIMEHeaderKey)
+	copyHeader(res.Header, rw.Header(), p.TykAPISpec.headerCasing())
 
 	hj, ok := rw.(http.Hijacker)
 	if !ok {
@@ -1372,12 +1598,16 @@ type switchProtocolCopier struct {
 }
 
 func (c switchProtocolCopier) copyFromBackend(errc chan<- error) {
-	_, err := io.Copy(c.user, c.backend)
+	buf := proxyBuffers.Get().(*[]byte)
+	defer proxyBuffers.Put(buf)
+	_, err := io.CopyBuffer(c.user, c.backend, *buf)
 	errc <- err
 }
 
 func (c switchProtocolCopier) copyToBackend(errc chan<- error) {
-	_, err := io.Copy(c.backend, c.user)
+	buf := proxyBuffers.Get().(*[]byte)
+	defer proxyBuffers.Put(buf)
+	_, err := io.CopyBuffer(c.backend, c.user, *buf)
 	errc <- err
 }
 
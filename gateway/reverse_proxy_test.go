@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -24,6 +25,7 @@ import (
 	"github.com/TykTechnologies/tyk/config"
 	"github.com/TykTechnologies/tyk/ctx"
 	"github.com/TykTechnologies/tyk/dnscache"
+	"github.com/TykTechnologies/tyk/headers"
 	"github.com/TykTechnologies/tyk/request"
 	"github.com/TykTechnologies/tyk/test"
 )
@@ -55,7 +57,7 @@ func TestCopyHeader_NoDuplicateCORSHeaders(t *testing.T) {
 	}
 
 	for _, v := range tests {
-		copyHeader(v.dst, v.src, false)
+		copyHeader(v.dst, v.src, headerCasing{})
 
 		for _, vv := range corsHeaders {
 			val := v.dst[vv]
@@ -300,7 +302,7 @@ func TestReverseProxyDnsCache(t *testing.T) {
 			if tc.isCacheEnabled {
 				item, ok := storage.Get(host)
 				if !ok || !test.IsDnsRecordsAddrsEqualsTo(item.Addrs, tc.expectedIPs) {
-					t.Fatalf("got %q, but wanted %q. ok=%t", item, tc.expectedIPs, ok)
+					t.Fatalf("got %q, but wanted %q. ok=%t", item.Addrs, tc.expectedIPs, ok)
 				}
 			} else {
 				item, ok := storage.Get(host)
@@ -353,6 +355,105 @@ func testNewWrappedServeHTTP() *ReverseProxy {
 	return TykNewSingleHostReverseProxy(target, spec, nil)
 }
 
+func TestReverseProxyDNSOverrides(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	_, port, _ := net.SplitHostPort(testHttpListen)
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = "http://upstream.tyk.invalid:" + port
+		spec.Proxy.DNS.Overrides = []apidef.DNSOverride{{Host: "upstream.tyk.invalid", IPs: []string{"127.0.0.1"}}}
+	})
+
+	ts.Run(t, test.TestCase{Path: "/get", Code: http.StatusOK, BodyMatch: `"Url":"/get"`})
+}
+
+func TestDefaultTransportPoolSettings(t *testing.T) {
+	var proxyConfig apidef.ProxyConfig
+	transport := defaultTransport(0, proxyConfig, "")
+	if transport.MaxIdleConnsPerHost != config.Global().MaxIdleConnsPerHost || transport.MaxConnsPerHost != 0 {
+		t.Error("Expected global pool settings to be used by default")
+	}
+
+	proxyConfig.Transport.MaxConnsPerHost = 10
+	proxyConfig.Transport.MaxIdleConns = 20
+	proxyConfig.Transport.MaxIdleConnsPerHost = 5
+	proxyConfig.Transport.IdleConnTimeout = 30
+
+	transport = defaultTransport(0, proxyConfig, "")
+	if transport.MaxConnsPerHost != 10 || transport.MaxIdleConns != 20 || transport.MaxIdleConnsPerHost != 5 {
+		t.Errorf("API pool settings not applied: %d %d %d",
+			transport.MaxConnsPerHost, transport.MaxIdleConns, transport.MaxIdleConnsPerHost)
+	}
+	if transport.IdleConnTimeout != 30*time.Second {
+		t.Error("Expected idle connection timeout to be set, got ", transport.IdleConnTimeout)
+	}
+}
+
+func TestReverseProxyForceHTTP2(t *testing.T) {
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	upstream.EnableHTTP2 = true
+	upstream.StartTLS()
+	defer upstream.Close()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.Proxy.Transport.SSLInsecureSkipVerify = true
+	})
+
+	ts.Run(t, test.TestCase{Path: "/", Code: http.StatusOK, BodyMatch: `^HTTP/1.1$`})
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.Proxy.Transport.SSLInsecureSkipVerify = true
+		spec.Proxy.Transport.ForceHTTP2 = true
+	})
+
+	ts.Run(t, test.TestCase{Path: "/", Code: http.StatusOK, BodyMatch: `^HTTP/2.0$`})
+}
+
+func TestReverseProxyStrictHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Public", "1")
+		w.Header().Set("X-Backend-Node", "node-1")
+		w.Header().Set(headers.ContentType, headers.ApplicationJSON)
+		json.NewEncoder(w).Encode(r.Header)
+	}))
+	defer upstream.Close()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.StrictHeaders.Request = apidef.HeaderAllowList{Enabled: true, Allowed: []string{"x-allowed"}}
+		spec.StrictHeaders.Response = apidef.HeaderAllowList{Enabled: true, Allowed: []string{"X-Public"}}
+	})
+
+	ts.Run(t, test.TestCase{
+		Path:    "/",
+		Headers: map[string]string{"X-Allowed": "yes", "X-Internal-Token": "secret"},
+		Code:    http.StatusOK,
+		HeadersMatch: map[string]string{
+			"X-Public":          "1",
+			headers.ContentType: headers.ApplicationJSON,
+		},
+		HeadersNotMatch: map[string]string{"X-Backend-Node": "node-1"},
+		BodyMatch:       `"X-Allowed":\["yes"\]`,
+		BodyNotMatch:    `X-Internal-Token|X-Forwarded-For`,
+	})
+}
+
 func TestWrappedServeHTTP(t *testing.T) {
 	proxy := testNewWrappedServeHTTP()
 	recorder := httptest.NewRecorder()
@@ -867,6 +968,58 @@ func BenchmarkWrappedServeHTTP(b *testing.B) {
 	}
 }
 
+func TestCloneHeader(t *testing.T) {
+	h := http.Header{"A": {"1", "2"}, "B": {"3"}}
+	clone := cloneHeader(h)
+	require.Equal(t, h, clone)
+
+	clone.Add("A", "4")
+	clone.Set("B", "5")
+	require.Equal(t, http.Header{"A": {"1", "2"}, "B": {"3"}}, h)
+	require.Equal(t, []string{"1", "2", "4"}, clone["A"])
+	require.Equal(t, []string{"5"}, clone["B"])
+}
+
+func BenchmarkCloneHeader(b *testing.B) {
+	b.ReportAllocs()
+	h := http.Header{
+		headers.Accept:        {"application/json"},
+		headers.UserAgent:     {"benchmark"},
+		headers.Authorization: {"Bearer token"},
+		headers.XForwardFor:   {"10.0.0.1", "10.0.0.2"},
+		headers.ContentType:   {"application/json"},
+	}
+	for i := 0; i < b.N; i++ {
+		cloneHeader(h)
+	}
+}
+
+// BenchmarkProxyRequest tracks the allocations of a request proxied by the
+// gateway, with and without analytics.
+func BenchmarkProxyRequest(b *testing.B) {
+	ts := StartTest()
+	defer ts.Close()
+
+	for _, doNotTrack := range []bool{false, true} {
+		name := "analytics"
+		if doNotTrack {
+			name = "no analytics"
+		}
+		b.Run(name, func(b *testing.B) {
+			BuildAndLoadAPI(func(spec *APISpec) {
+				spec.Proxy.ListenPath = "/"
+				spec.DoNotTrack = doNotTrack
+			})
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ts.Run(b, test.TestCase{Path: "/get", Code: http.StatusOK})
+			}
+		})
+	}
+}
+
 func BenchmarkCopyRequestResponse(b *testing.B) {
 	b.ReportAllocs()
 
@@ -0,0 +1,109 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+// rewriteTestResponse describes how the URL rewrite middleware would handle a
+// request
+//
+// swagger:model rewriteTestResponse
+type rewriteTestResponse struct {
+	Version string `json:"version"`
+	// Rule is the rewrite rule matching the request path and method, if any
+	Rule *apidef.URLRewriteMeta `json:"rule,omitempty"`
+	// Matched is true when the rule match pattern matched the request URL
+	Matched bool `json:"matched"`
+	// Trigger is the index of the trigger which selected the target
+	Trigger *int `json:"trigger,omitempty"`
+	// Target is the URL the request would be sent to
+	Target string `json:"target"`
+	// Context holds the context variables populated by the triggers
+	Context map[string]interface{} `json:"context,omitempty"`
+}
+
+// Test URL rewrite rules of an API
+// Evaluates the URL rewrite rules of a loaded API against a sample request
+// without sending any upstream traffic.
+//
+//---
+// requestBody:
+//   content:
+//     application/json:
+//       schema:
+//         "$ref": "#/definitions/traceHttpRequest"
+//       examples:
+//         method: GET
+//         path: /listen-path/get
+// responses:
+//   200:
+//     description: Rewrite result
+//     schema:
+//       "$ref": "#/definitions/rewriteTestResponse"
+//   404:
+//     description: API not found
+func rewriteTestHandler(w http.ResponseWriter, r *http.Request) {
+	apiID := mux.Vars(r)["apiID"]
+
+	spec := getApiSpec(apiID)
+	if spec == nil {
+		doJSONWrite(w, http.StatusNotFound, apiError("API not found"))
+		return
+	}
+
+	var testReq traceHttpRequest
+	if err := json.NewDecoder(r.Body).Decode(&testReq); err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+		return
+	}
+	if testReq.Method == "" {
+		testReq.Method = http.MethodGet
+	}
+
+	tr, err := testReq.toRequest()
+	if err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+		return
+	}
+
+	code, resp := testURLRewrite(spec, tr)
+	doJSONWrite(w, code, resp)
+}
+
+func testURLRewrite(spec *APISpec, r *http.Request) (int, interface{}) {
+	versionInfo, versionPaths, _, status := spec.Version(r)
+	if status != StatusOk {
+		return http.StatusBadRequest, apiError(string(status))
+	}
+
+	resp := rewriteTestResponse{
+		Version: versionInfo.Name,
+		Target:  r.URL.String(),
+	}
+
+	found, meta := spec.CheckSpecMatchesStatus(r, versionPaths, URLRewrite)
+	if !found {
+		return http.StatusOK, resp
+	}
+
+	rule := meta.(*apidef.URLRewriteMeta)
+	target, trigger, err := urlRewriteWithTrigger(rule, r)
+	if err != nil {
+		return http.StatusBadRequest, apiError(err.Error())
+	}
+
+	resp.Rule = rule
+	resp.Matched = rule.MatchRegexp.MatchString(resp.Target)
+	resp.Target = target
+	if trigger >= 0 {
+		resp.Trigger = &trigger
+	}
+	resp.Context = ctxGetData(r)
+
+	return http.StatusOK, resp
+}
@@ -0,0 +1,270 @@
+package gateway
+
+import (
+	"regexp/syntax"
+	"strings"
+)
+
+// routeIndex narrows down the URL specs of a version that may match a path,
+// so that CheckSpecMatchesStatus doesn't run the regex of every one of them.
+// It is built when the API is loaded.
+//
+// Paths match anywhere in the request path, as their regexes aren't
+// anchored, so each spec is indexed by a literal its regex can't match
+// without, in a trie with failure links (Aho-Corasick) finding them all in a
+// single pass over the path. Specs whose regex is that literal need no regex
+// at all, those without any literal are checked for every request.
+type routeIndex struct {
+	// size is the number of URL specs indexed, for the index not to be used
+	// with another slice.
+	size     int
+	byStatus map[URLStatus]*statusRoutes
+}
+
+// statusRoutes are the URL specs of a status.
+type statusRoutes struct {
+	routes []indexedRoute
+	// exact and folded find the routes by literal, folded holding the
+	// lowercase literals of case insensitive regexes.
+	exact  *literalTrie
+	folded *literalTrie
+	// always are the routes without a literal.
+	always []int32
+}
+
+// indexedRoute is a URL spec of a status and how it is matched.
+type indexedRoute struct {
+	// pos is the position of the spec in the version paths.
+	pos int
+	// literal is set when the regex of the spec matches exactly the paths
+	// containing its literal.
+	literal bool
+}
+
+func newRouteIndex(rxPaths []URLSpec) *routeIndex {
+	idx := &routeIndex{size: len(rxPaths), byStatus: map[URLStatus]*statusRoutes{}}
+	for i := range rxPaths {
+		routes := idx.byStatus[rxPaths[i].Status]
+		if routes == nil {
+			routes = &statusRoutes{exact: newLiteralTrie(), folded: newLiteralTrie()}
+			idx.byStatus[rxPaths[i].Status] = routes
+		}
+		id := int32(len(routes.routes))
+
+		var lit requiredLiteral
+		if rxPaths[i].Spec != nil {
+			lit = findRequiredLiteral(rxPaths[i].Spec.String())
+		}
+		switch {
+		case lit.value == "":
+			routes.always = append(routes.always, id)
+		case lit.fold:
+			routes.folded.add(strings.ToLower(lit.value), id)
+		default:
+			routes.exact.add(lit.value, id)
+		}
+		routes.routes = append(routes.routes, indexedRoute{pos: i, literal: lit.whole})
+	}
+	for _, routes := range idx.byStatus {
+		routes.exact.build()
+		routes.folded.build()
+	}
+	return idx
+}
+
+// newRouteIndexes indexes the paths of each version of an API, by their
+// first URL spec as versions are looked up by their paths.
+func newRouteIndexes(rxPaths map[string][]URLSpec) map[*URLSpec]*routeIndex {
+	indexes := make(map[*URLSpec]*routeIndex, len(rxPaths))
+	for _, paths := range rxPaths {
+		if len(paths) > 0 {
+			indexes[&paths[0]] = newRouteIndex(paths)
+		}
+	}
+	return indexes
+}
+
+// routeIndex returns the index of the paths of a version, nil if they
+// weren't indexed.
+func (a *APISpec) routeIndex(rxPaths []URLSpec) *routeIndex {
+	if len(rxPaths) == 0 {
+		return nil
+	}
+	idx := a.routeIndexes[&rxPaths[0]]
+	if idx == nil || idx.size != len(rxPaths) {
+		return nil
+	}
+	return idx
+}
+
+// candidates returns the routes of status that may match path, in the order
+// of the version paths. Path must be ASCII, regexes folding case also
+// matching some non-ASCII letters.
+func (routes *statusRoutes) candidates(path string, buf []int32) []int32 {
+	ids := buf[:0]
+	for _, id := range routes.always {
+		ids = insertRouteID(ids, id)
+	}
+	routes.exact.find(path, func(id int32) {
+		ids = insertRouteID(ids, id)
+	})
+	if len(routes.folded.nodes) > 1 {
+		routes.folded.find(strings.ToLower(path), func(id int32) {
+			ids = insertRouteID(ids, id)
+		})
+	}
+	return ids
+}
+
+// insertRouteID adds id to the sorted ids, once. There are few candidates,
+// which are inserted in place rather than sorted.
+func insertRouteID(ids []int32, id int32) []int32 {
+	i := len(ids)
+	for i > 0 && ids[i-1] > id {
+		i--
+	}
+	if i > 0 && ids[i-1] == id {
+		return ids
+	}
+	ids = append(ids, 0)
+	copy(ids[i+1:], ids[i:])
+	ids[i] = id
+	return ids
+}
+
+// requiredLiteral is a literal that the paths matching a regex contain.
+type requiredLiteral struct {
+	value string
+	// fold is set when the literal is matched case insensitively.
+	fold bool
+	// whole is set when the regex is the literal.
+	whole bool
+}
+
+// findRequiredLiteral returns the longest literal of a regex that its matches
+// must contain, an empty one if there is none that can be looked for as is.
+func findRequiredLiteral(expr string) requiredLiteral {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return requiredLiteral{}
+	}
+	re = re.Simplify()
+
+	var lit requiredLiteral
+	switch re.Op {
+	case syntax.OpLiteral:
+		lit = literalOf(re)
+		lit.whole = true
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if sub.Op != syntax.OpLiteral {
+				continue
+			}
+			if l := literalOf(sub); len(l.value) > len(lit.value) {
+				lit = l
+			}
+		}
+	}
+	if lit.fold && !isASCII(lit.value) {
+		// folds to letters of other scripts, such as K to the Kelvin sign
+		return requiredLiteral{}
+	}
+	return lit
+}
+
+func literalOf(re *syntax.Regexp) requiredLiteral {
+	return requiredLiteral{value: string(re.Rune), fold: re.Flags&syntax.FoldCase != 0}
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// literalTrie finds all the literals contained in a string.
+type literalTrie struct {
+	nodes []literalTrieNode
+}
+
+type literalTrieNode struct {
+	next map[byte]int32
+	// fail is the node of the longest proper suffix of this node that is
+	// in the trie.
+	fail int32
+	// out are the literals ending at this node, including through fail.
+	out []int32
+}
+
+func newLiteralTrie() *literalTrie {
+	return &literalTrie{nodes: []literalTrieNode{{}}}
+}
+
+func (t *literalTrie) add(literal string, id int32) {
+	var n int32
+	for i := 0; i < len(literal); i++ {
+		next, ok := t.nodes[n].next[literal[i]]
+		if !ok {
+			next = int32(len(t.nodes))
+			t.nodes = append(t.nodes, literalTrieNode{})
+			if t.nodes[n].next == nil {
+				t.nodes[n].next = map[byte]int32{}
+			}
+			t.nodes[n].next[literal[i]] = next
+		}
+		n = next
+	}
+	t.nodes[n].out = append(t.nodes[n].out, id)
+}
+
+// build links the nodes to their failure nodes, breadth first as they are
+// shallower than the nodes.
+func (t *literalTrie) build() {
+	queue := []int32{}
+	for _, child := range t.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for c, child := range t.nodes[n].next {
+			fail := t.nodes[n].fail
+			for {
+				if next, ok := t.nodes[fail].next[c]; ok {
+					t.nodes[child].fail = next
+					break
+				}
+				if fail == 0 {
+					break
+				}
+				fail = t.nodes[fail].fail
+			}
+			failOut := t.nodes[t.nodes[child].fail].out
+			t.nodes[child].out = append(t.nodes[child].out[:len(t.nodes[child].out):len(t.nodes[child].out)], failOut...)
+			queue = append(queue, child)
+		}
+	}
+}
+
+// find calls fn with the literals found in s, as many times as they are.
+func (t *literalTrie) find(s string, fn func(id int32)) {
+	var n int32
+	for i := 0; i < len(s); i++ {
+		for {
+			if next, ok := t.nodes[n].next[s[i]]; ok {
+				n = next
+				break
+			}
+			if n == 0 {
+				break
+			}
+			n = t.nodes[n].fail
+		}
+		for _, id := range t.nodes[n].out {
+			fn(id)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+func routeIndexTestSpec(paths []string, ignoreCase bool) *APISpec {
+	loader := APIDefinitionLoader{}
+	rxPaths := make([]URLSpec, 0, len(paths))
+	for _, path := range paths {
+		urlSpec := URLSpec{IgnoreCase: ignoreCase}
+		loader.generateRegex(path, &urlSpec, HeaderInjected)
+		urlSpec.InjectHeaders = apidef.HeaderInjectionMeta{Path: path, Method: "GET"}
+		rxPaths = append(rxPaths, urlSpec)
+	}
+
+	spec := &APISpec{APIDefinition: &apidef.APIDefinition{}}
+	spec.Proxy.ListenPath = "/"
+	spec.RxPaths = map[string][]URLSpec{"Default": rxPaths}
+	return spec
+}
+
+func TestRouteIndex(t *testing.T) {
+	paths := []string{
+		"/users/{id}/posts",
+		"/users",
+		"^/exact$",
+		"/files/.*\\.json",
+		"/orders/[0-9]+",
+		"{any}",
+		"/health",
+		"/a|/b",
+		"",
+	}
+	requests := []string{
+		"/users/1/posts", "/api/users", "/exact", "/v1/exact", "/files/a/b.json",
+		"/orders/12", "/orders/x", "/health/live", "/b", "/other", "/USERS", "/ſtatus",
+	}
+
+	for _, ignoreCase := range []bool{false, true} {
+		spec := routeIndexTestSpec(paths, ignoreCase)
+		rxPaths := spec.RxPaths["Default"]
+		for _, path := range requests {
+			r := httptest.NewRequest("GET", path, nil)
+
+			spec.routeIndexes = nil
+			wantFound, wantMeta := spec.CheckSpecMatchesStatus(r, rxPaths, HeaderInjected)
+			spec.routeIndexes = newRouteIndexes(spec.RxPaths)
+			assert.NotNil(t, spec.routeIndex(rxPaths))
+			found, meta := spec.CheckSpecMatchesStatus(r, rxPaths, HeaderInjected)
+
+			assert.Equal(t, wantFound, found, "ignore case %v, path %s", ignoreCase, path)
+			assert.Equal(t, wantMeta, meta, "ignore case %v, path %s", ignoreCase, path)
+		}
+	}
+}
+
+func TestFindRequiredLiteral(t *testing.T) {
+	tests := []struct {
+		expr string
+		want requiredLiteral
+	}{
+		{"/users", requiredLiteral{value: "/users", whole: true}},
+		{"/users/([^/]*)/posts", requiredLiteral{value: "/users/"}},
+		{"(?i)/users", requiredLiteral{value: "/USERS", fold: true, whole: true}},
+		{"^/exact$", requiredLiteral{value: "/exact"}},
+		{"/a|/b", requiredLiteral{value: "/"}},
+		{"(?i)/café", requiredLiteral{}},
+		{"", requiredLiteral{}},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, findRequiredLiteral(tc.expr), tc.expr)
+	}
+}
+
+func BenchmarkCheckSpecMatchesStatus(b *testing.B) {
+	paths := make([]string, 500)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("/resource%d/{id}/items", i)
+	}
+	spec := routeIndexTestSpec(paths, false)
+	rxPaths := spec.RxPaths["Default"]
+	r := httptest.NewRequest("GET", "/resource250/1/items", nil)
+
+	b.Run("regex", func(b *testing.B) {
+		b.ReportAllocs()
+		spec.routeIndexes = nil
+		for i := 0; i < b.N; i++ {
+			spec.CheckSpecMatchesStatus(r, rxPaths, HeaderInjected)
+		}
+	})
+
+	b.Run("index", func(b *testing.B) {
+		b.ReportAllocs()
+		spec.routeIndexes = newRouteIndexes(spec.RxPaths)
+		for i := 0; i < b.N; i++ {
+			spec.CheckSpecMatchesStatus(r, rxPaths, HeaderInjected)
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/rpc"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+// rpcSyncTime records when data was last pulled successfully from the RPC
+// layer.
+type rpcSyncTime struct {
+	v atomic.Value
+}
+
+func (s *rpcSyncTime) Touch() {
+	s.v.Store(time.Now())
+}
+
+func (s *rpcSyncTime) Get() *time.Time {
+	if v, ok := s.v.Load().(time.Time); ok {
+		return &v
+	}
+	return nil
+}
+
+var (
+	lastRPCKeySync    rpcSyncTime
+	lastRPCAPISync    rpcSyncTime
+	lastRPCPolicySync rpcSyncTime
+)
+
+// apiClusterStatus represents the state of the link between a slaved gateway
+// and the RPC layer. Connected is whether the RPC layer answers at the time
+// of the request. AnalyticsBacklog is the number of analytics records
+// waiting to be sent.
+// swagger:model
+type apiClusterStatus struct {
+	Connected        bool       `json:"connected"`
+	EmergencyMode    bool       `json:"emergency_mode"`
+	LoadCount        int        `json:"load_count"`
+	LastKeySync      *time.Time `json:"last_key_sync,omitempty"`
+	LastAPISync      *time.Time `json:"last_api_sync,omitempty"`
+	LastPolicySync   *time.Time `json:"last_policy_sync,omitempty"`
+	AnalyticsBacklog int64      `json:"analytics_backlog"`
+}
+
+// analyticsBacklog counts the analytics records in Redis that have not been
+// purged yet.
+func analyticsBacklog() int64 {
+	store := storage.RedisCluster{KeyPrefix: "analytics-", IsAnalytics: true}
+
+	var backlog int64
+	for i := -1; i < 10; i++ {
+		keyName := rpc.ANALYTICS_KEYNAME
+		if i >= 0 {
+			keyName = fmt.Sprintf("%v_%v", rpc.ANALYTICS_KEYNAME, i)
+		}
+		length, err := store.GetListLength(keyName)
+		if err != nil {
+			continue
+		}
+		backlog += length
+	}
+	return backlog
+}
+
+// Get the RPC link status
+// Returns the connectivity to the RPC layer, the last successful key, API and
+// policy synchronisations and the analytics backlog of a slaved gateway.
+//
+//---
+// responses:
+//   200:
+//     description: RPC link status
+//     schema:
+//       "$ref": "#/definitions/apiClusterStatus"
+//   400:
+//     description: Gateway is not slaved
+func clusterStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if !isRPCMode() {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Gateway is not in RPC mode"))
+		return
+	}
+
+	doJSONWrite(w, http.StatusOK, apiClusterStatus{
+		Connected:        rpc.IsConnected(),
+		EmergencyMode:    rpc.IsEmergencyMode(),
+		LoadCount:        rpc.LoadCount(),
+		LastKeySync:      lastRPCKeySync.Get(),
+		LastAPISync:      lastRPCAPISync.Get(),
+		LastPolicySync:   lastRPCPolicySync.Get(),
+		AnalyticsBacklog: analyticsBacklog(),
+	})
+}
+
+// Force a resync with the RPC layer
+// Drops the locally cached keys, so that they are pulled again from the RPC
+// layer, checks for keyspace changes and reloads the API definitions and
+// policies. A gateway in emergency mode logs in again first, as it would
+// otherwise reload its backup. With `block=true` the request waits for the
+// reload to finish, and fails if the API definitions weren't pulled.
+//
+//---
+// responses:
+//   200:
+//     description: Resync started, or done with `block=true`
+//   400:
+//     description: Gateway is not slaved
+//   503:
+//     description: RPC layer unreachable
+func clusterResyncHandler(w http.ResponseWriter, r *http.Request) {
+	if !isRPCMode() {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Gateway is not in RPC mode"))
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix": "api",
+	}).Info("Forced RPC resync requested.")
+
+	if rpc.IsEmergencyMode() && !rpc.Login() {
+		doJSONWrite(w, http.StatusServiceUnavailable, apiError("Couldn't reach the RPC layer, the gateway is running from its backup"))
+		return
+	}
+
+	RPCGlobalCache.Flush()
+	SessionCache.Flush()
+	go RPCListener.CheckForKeyspaceChanges(config.Global().SlaveOptions.RPCKey)
+
+	if r.URL.Query().Get("block") != "true" {
+		reloadURLStructure(nil)
+		doJSONWrite(w, http.StatusOK, apiOk("resync started"))
+		return
+	}
+
+	before := lastRPCAPISync.Get()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	reloadURLStructure(wg.Done)
+	wg.Wait()
+
+	if after := lastRPCAPISync.Get(); after == nil || (before != nil && !after.After(*before)) {
+		doJSONWrite(w, http.StatusServiceUnavailable, apiError("Couldn't pull the API definitions from the RPC layer"))
+		return
+	}
+	doJSONWrite(w, http.StatusOK, apiOk("resynced"))
+}
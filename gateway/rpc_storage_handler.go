@@ -781,6 +781,8 @@ func (r *RPCStorageHandler) CheckForKeyspaceChanges(orgId string) {
 		return
 	}
 
+	lastRPCKeySync.Touch()
+
 	if keys == nil {
 		log.Info("Keys returned nil object, skipping check")
 		return
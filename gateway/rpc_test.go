@@ -425,6 +425,7 @@ func TestOrgSessionWithRPCDown(t *testing.T) {
 		globalConf.SlaveOptions.APIKey = ""
 		globalConf.Policies.PolicySource = ""
 		config.SetGlobal(globalConf)
+		rpc.Reset()
 	}()
 
 	ts := StartTest()
@@ -447,3 +448,72 @@ func TestOrgSessionWithRPCDown(t *testing.T) {
 		t.Fatal("org  session should be null:")
 	}
 }
+
+func TestClusterStatusAndResync(t *testing.T) {
+	t.Run("Not slaved", func(t *testing.T) {
+		ts := StartTest()
+		defer ts.Close()
+
+		ts.Run(t, []test.TestCase{
+			{Path: "/tyk/cluster/status", AdminAuth: true, Code: http.StatusBadRequest},
+			{Method: http.MethodPost, Path: "/tyk/cluster/resync", AdminAuth: true, Code: http.StatusBadRequest},
+		}...)
+	})
+
+	rpc.UseSyncLoginRPC = true
+	var getAPIDefinitionsCounter int
+	dispatcher := gorpc.NewDispatcher()
+	dispatcher.AddFunc("GetApiDefinitions", func(clientAddr string, dr *apidef.DefRequest) (string, error) {
+		getAPIDefinitionsCounter++
+		return jsonMarshalString(BuildAPI()), nil
+	})
+	dispatcher.AddFunc("GetPolicies", func(clientAddr string, orgid string) (string, error) {
+		return `[]`, nil
+	})
+	dispatcher.AddFunc("Login", func(clientAddr, userKey string) bool {
+		return true
+	})
+	dispatcher.AddFunc("GetKeySpaceUpdate", func(clientAddr, orgId string) ([]string, error) {
+		return []string{}, nil
+	})
+	dispatcher.AddFunc("Ping", func() bool {
+		return true
+	})
+
+	rpcMock := startRPCMock(dispatcher)
+	defer stopRPCMock(rpcMock)
+
+	ts := StartTest()
+	defer ts.Close()
+
+	ts.Run(t, test.TestCase{
+		Path: "/tyk/cluster/status", AdminAuth: true, Code: http.StatusOK,
+		BodyMatch: `"connected":true,"emergency_mode":false,.*"last_api_sync":".+","last_policy_sync":".+"`,
+	})
+
+	ReloadTestCase.Enable()
+	defer ReloadTestCase.Disable()
+
+	loaded := getAPIDefinitionsCounter
+	ts.Run(t, test.TestCase{
+		Method: http.MethodPost, Path: "/tyk/cluster/resync", AdminAuth: true, Code: http.StatusOK,
+	})
+	ReloadTestCase.TickOk(t)
+
+	if getAPIDefinitionsCounter <= loaded {
+		t.Error("API definitions should be pulled again on resync")
+	}
+
+	// with block the request returns once the definitions are pulled again
+	ReloadTestCase.Reset()
+	resynced := make(chan struct{})
+	go func() {
+		defer close(resynced)
+		ts.Run(t, test.TestCase{
+			Method: http.MethodPost, Path: "/tyk/cluster/resync?block=true", AdminAuth: true, Code: http.StatusOK,
+			BodyMatch: "resynced",
+		})
+	}()
+	ReloadTestCase.TickOk(t)
+	<-resynced
+}
@@ -0,0 +1,155 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gocraft/health"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+const (
+	defaultSelfProtectionInterval   = time.Second
+	defaultSelfProtectionRetryAfter = 5
+	// selfProtectionRecovery is the share of its limits usage must drop
+	// below for the node to leave self-protection mode, so that it doesn't
+	// flap around a limit.
+	selfProtectionRecovery = 0.9
+)
+
+// selfProtecting is 1 while the node is in self-protection mode.
+var selfProtecting int32
+
+// selfProtectionUsage is the resource usage self-protection mode is told
+// from.
+type selfProtectionUsage struct {
+	heapBytes  uint64
+	goroutines int
+}
+
+func readSelfProtectionUsage() selfProtectionUsage {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return selfProtectionUsage{heapBytes: stats.HeapInuse, goroutines: runtime.NumGoroutine()}
+}
+
+// exceeds reports whether usage exceeds a share of the limits of conf.
+func (u selfProtectionUsage) exceeds(conf config.SelfProtectionConfig, share float64) bool {
+	maxHeap := float64(conf.MaxHeapMB) * 1024 * 1024 * share
+	maxGoroutines := float64(conf.MaxGoroutines) * share
+	return (conf.MaxHeapMB > 0 && float64(u.heapBytes) >= maxHeap) ||
+		(conf.MaxGoroutines > 0 && float64(u.goroutines) >= maxGoroutines)
+}
+
+// trimCaches empties the in-memory caches of the node and returns the memory
+// freed to the OS. They refill from Redis and upstreams as needed.
+func trimCaches() {
+	SessionCache.Flush()
+	ExpiryCache.Flush()
+	RPCGlobalCache.Flush()
+	basicAuthCache.Flush()
+	lastGoodResponses.flush()
+	debug.FreeOSMemory()
+}
+
+// checkSelfProtection enters self-protection mode when usage exceeds the
+// limits of conf, and leaves it once usage drops back.
+func checkSelfProtection(conf config.SelfProtectionConfig, usage selfProtectionUsage) {
+	job := instrument.NewJob("SelfProtection")
+	metadata := health.Kvs{"host": hostDetails.Hostname}
+	job.GaugeKv("heap_bytes", float64(usage.heapBytes), metadata)
+	job.GaugeKv("goroutines", float64(usage.goroutines), metadata)
+
+	engaged := atomic.LoadInt32(&selfProtecting) == 1
+	changed := false
+	switch {
+	case !engaged && usage.exceeds(conf, 1):
+		engaged, changed = true, true
+	case engaged && !usage.exceeds(conf, selfProtectionRecovery):
+		engaged, changed = false, true
+	}
+	gauge := 0.0
+	if engaged {
+		gauge = 1
+	}
+	job.GaugeKv("engaged", gauge, metadata)
+	if !changed {
+		return
+	}
+
+	message := "Self-protection mode released"
+	if engaged {
+		message = "Self-protection mode engaged, rejecting new requests"
+		atomic.StoreInt32(&selfProtecting, 1)
+		job.Event("engaged")
+		trimCaches()
+	} else {
+		atomic.StoreInt32(&selfProtecting, 0)
+		job.Event("released")
+	}
+	log.WithFields(logrus.Fields{
+		"prefix":     "self-protection",
+		"heap_bytes": usage.heapBytes,
+		"goroutines": usage.goroutines,
+	}).Warning(message)
+
+	FireSystemEvent(EventSelfProtection, EventSelfProtectionMeta{
+		EventMetaDefault: EventMetaDefault{Message: message},
+		Engaged:          engaged,
+		HeapBytes:        usage.heapBytes,
+		Goroutines:       usage.goroutines,
+	})
+}
+
+// selfProtectionLoop checks the usage of the node every interval until ctx
+// is done.
+func selfProtectionLoop(ctx context.Context, conf config.SelfProtectionConfig) {
+	interval := defaultSelfProtectionInterval
+	if conf.CheckInterval > 0 {
+		interval = time.Duration(conf.CheckInterval) * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkSelfProtection(conf, readSelfProtectionUsage())
+		}
+	}
+}
+
+// rejectInSelfProtection rejects r while the node is in self-protection mode,
+// closing its connection so that the client retries on another node, and
+// reports whether it did. The control API and the health check stay
+// available, for the node to be watched and operated.
+func rejectInSelfProtection(w http.ResponseWriter, r *http.Request) bool {
+	if atomic.LoadInt32(&selfProtecting) == 0 {
+		return false
+	}
+	healthCheck := config.Global().HealthCheckEndpointName
+	if strings.HasPrefix(r.URL.Path, "/tyk/") || (healthCheck != "" && r.URL.Path == "/"+healthCheck) {
+		return false
+	}
+
+	instrument.NewJob("SelfProtection").Event("rejected")
+
+	retryAfter := config.Global().SelfProtection.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = defaultSelfProtectionRetryAfter
+	}
+	w.Header().Set(headers.RetryAfter, strconv.Itoa(retryAfter))
+	w.Header().Set(headers.Connection, "close")
+	doJSONWrite(w, http.StatusServiceUnavailable, apiError(http.StatusText(http.StatusServiceUnavailable)))
+	return true
+}
@@ -0,0 +1,67 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+func TestSelfProtectionUsageExceeds(t *testing.T) {
+	conf := config.SelfProtectionConfig{MaxHeapMB: 100, MaxGoroutines: 1000}
+
+	assert.False(t, selfProtectionUsage{heapBytes: 50 << 20, goroutines: 500}.exceeds(conf, 1))
+	assert.True(t, selfProtectionUsage{heapBytes: 100 << 20}.exceeds(conf, 1))
+	assert.True(t, selfProtectionUsage{goroutines: 1000}.exceeds(conf, 1))
+	assert.True(t, selfProtectionUsage{heapBytes: 95 << 20}.exceeds(conf, selfProtectionRecovery))
+
+	// limits left at 0 are disabled
+	assert.False(t, selfProtectionUsage{heapBytes: 1 << 40, goroutines: 1 << 20}.exceeds(config.SelfProtectionConfig{}, 1))
+}
+
+func TestSelfProtection(t *testing.T) {
+	defer atomic.StoreInt32(&selfProtecting, 0)
+	conf := config.SelfProtectionConfig{MaxGoroutines: 1000}
+
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		if !rejectInSelfProtection(w, httptest.NewRequest(http.MethodGet, "/", nil)) {
+			w.WriteHeader(http.StatusOK)
+		}
+		return w
+	}
+
+	checkSelfProtection(conf, selfProtectionUsage{goroutines: 500})
+	assert.Equal(t, http.StatusOK, serve().Code)
+
+	SessionCache.Set("self-protection", true, 0)
+	checkSelfProtection(conf, selfProtectionUsage{goroutines: 1200})
+	w := serve()
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "5", w.Header().Get(headers.RetryAfter))
+	assert.Equal(t, "close", w.Header().Get(headers.Connection))
+	_, found := SessionCache.Get("self-protection")
+	assert.False(t, found, "caches should be trimmed")
+
+	// still above the recovery threshold
+	checkSelfProtection(conf, selfProtectionUsage{goroutines: 950})
+	assert.Equal(t, http.StatusServiceUnavailable, serve().Code)
+
+	// the control API and the health check are exempt
+	globalConf := config.Global()
+	globalConf.HealthCheckEndpointName = "hello"
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+	for _, path := range []string{"/tyk/health", "/hello"} {
+		w := httptest.NewRecorder()
+		assert.False(t, rejectInSelfProtection(w, httptest.NewRequest(http.MethodGet, path, nil)), path)
+	}
+
+	checkSelfProtection(conf, selfProtectionUsage{goroutines: 800})
+	assert.Equal(t, http.StatusOK, serve().Code)
+}
@@ -71,8 +71,11 @@ var (
 	CertificateManager   *certs.CertificateManager
 	NewRelicApplication  newrelic.Application
 
-	apisMu          sync.RWMutex
-	apiSpecs        []*APISpec
+	apisMu   sync.RWMutex
+	apiSpecs []*APISpec
+	// invalidAPISpecs are the specs that failed validation on the last
+	// sync, reported in the load statuses.
+	invalidAPISpecs []*APISpec
 	apisByID        = map[string]*APISpec{}
 	apisHandlesByID = new(sync.Map)
 
@@ -168,6 +171,10 @@ func setupGlobals(ctx context.Context) {
 		dnsCacheManager.InitDNSCaching(
 			time.Duration(config.Global().DnsCache.TTL)*time.Second,
 			time.Duration(config.Global().DnsCache.CheckInterval)*time.Second)
+		if storage, ok := dnsCacheManager.CacheStorage().(*dnscache.DnsCacheStorage); ok {
+			storage.SetNegativeTTL(time.Duration(config.Global().DnsCache.NegativeTTL) * time.Second)
+			storage.SetMaxEntries(config.Global().DnsCache.MaxEntries)
+		}
 	}
 
 	if config.Global().EnableAnalytics && config.Global().Storage.Type != "redis" {
@@ -322,15 +329,17 @@ func syncAPISpecs() (int, error) {
 			s[i].SessionProvider = config.Global().AuthOverride.SessionProvider
 		}
 	}
-	var filter []*APISpec
+	var filter, invalid []*APISpec
 	for _, v := range s {
 		if err := v.Validate(); err != nil {
 			mainLog.Infof("Skipping loading spec:%q because it failed validation with error:%v", v.Name, err)
+			invalid = append(invalid, v)
 			continue
 		}
 		filter = append(filter, v)
 	}
 	apiSpecs = filter
+	invalidAPISpecs = invalid
 
 	tlsConfigCache.Flush()
 
@@ -428,7 +437,7 @@ func loadControlAPIEndpoints(muxer *mux.Router) {
 
 	r := mux.NewRouter()
 	muxer.PathPrefix("/tyk/").Handler(http.StripPrefix("/tyk",
-		stripSlashes(checkIsAPIOwner(controlAPICheckClientCertificate("/gateway/client", InstrumentationMW(r)))),
+		stripSlashes(checkControlAPIAllowList(checkIsAPIOwner(controlAPICheckClientCertificate("/gateway/client", InstrumentationMW(r))))),
 	))
 
 	if hostname != "" {
@@ -448,34 +457,74 @@ func loadControlAPIEndpoints(muxer *mux.Router) {
 	// set up main API handlers
 	r.HandleFunc("/reload/group", groupResetHandler).Methods("GET")
 	r.HandleFunc("/reload", resetHandler(nil)).Methods("GET")
+	r.HandleFunc("/node/segments", nodeSegmentsHandler).Methods("GET", "PUT")
+	r.HandleFunc("/cluster/status", clusterStatusHandler).Methods("GET")
+	r.HandleFunc("/cluster/resync", clusterResyncHandler).Methods("POST")
+	r.HandleFunc("/stats/{apiID}", apiStatsHandler).Methods("GET")
+	r.HandleFunc("/slo/{apiID}", apiSLOHandler).Methods("GET")
+	r.HandleFunc("/load", loadStatusHandler).Methods("GET")
+	r.HandleFunc("/dns-cache", dnsCacheHandler).Methods("GET", "DELETE")
+	r.HandleFunc("/connections", upstreamConnectionsHandler).Methods("GET")
+	r.HandleFunc("/apis/status", apiLoadStatusHandler).Methods("GET")
+	r.HandleFunc("/redis/stats", redisStatsHandler).Methods("GET")
 
 	if !isRPCMode() {
 		r.HandleFunc("/org/keys", orgHandler).Methods("GET")
 		r.HandleFunc("/org/keys/{keyName:[^/]*}", orgHandler).Methods("POST", "PUT", "GET", "DELETE")
+		r.HandleFunc("/org/keys/{keyName}/usage", orgUsageHandler).Methods("GET")
+		r.HandleFunc("/org/keys/{keyName}/reset_quota", orgResetQuotaHandler).Methods("POST")
 		r.HandleFunc("/keys/policy/{keyName}", policyUpdateHandler).Methods("POST")
 		r.HandleFunc("/keys/create", createKeyHandler).Methods("POST")
+		r.HandleFunc("/keys/expiring", expiringKeysHandler).Methods("GET")
+		r.HandleFunc("/keys/rehash", keysRehashHandler).Methods("POST")
+		r.HandleFunc("/keys/rehash", keysRehashStatusHandler).Methods("GET")
 		r.HandleFunc("/apis", apiHandler).Methods("GET", "POST", "PUT", "DELETE")
+		r.HandleFunc("/apis/categories", apiCategoriesHandler).Methods("GET")
 		r.HandleFunc("/apis/{apiID}", apiHandler).Methods("GET", "POST", "PUT", "DELETE")
+		r.HandleFunc("/apis/{apiID}/uptime_tests", uptimeTestsHandler).Methods("GET", "POST", "PUT")
+		r.HandleFunc("/apis/{apiID}/uptime_tests/{index}", uptimeTestsHandler).Methods("GET", "PUT", "DELETE")
 		r.HandleFunc("/health", healthCheckhandler).Methods("GET")
 		r.HandleFunc("/oauth/clients/create", createOauthClient).Methods("POST")
 		r.HandleFunc("/oauth/clients/{apiID}/{keyName:[^/]*}", oAuthClientHandler).Methods("PUT")
 		r.HandleFunc("/oauth/clients/{apiID}/{keyName:[^/]*}/rotate", rotateOauthClientHandler).Methods("PUT")
 		r.HandleFunc("/oauth/clients/apis/{appID}", getApisForOauthApp).Queries("orgID", "{[0-9]*?}").Methods("GET")
+		r.HandleFunc("/oauth/clients/{apiID}/import", importOauthClientsHandler).Methods("POST")
 		r.HandleFunc("/oauth/refresh/{keyName}", invalidateOauthRefresh).Methods("DELETE")
 		r.HandleFunc("/oauth/revoke", RevokeTokenHandler).Methods("POST")
 		r.HandleFunc("/oauth/revoke_all", RevokeAllTokensHandler).Methods("POST")
+		r.HandleFunc("/oauth/tokens/purge", oauthTokenPurgeStatusHandler).Methods("GET")
 
 	} else {
 		mainLog.Info("Node is slaved, REST API minimised")
 	}
 
+	r.HandleFunc("/info", buildInfoHandler).Methods("GET")
 	r.HandleFunc("/debug", traceHandler).Methods("POST")
+	r.HandleFunc("/debug/{apiID}", apiTraceHandler).Methods("POST")
+	r.HandleFunc("/apis/{apiID}/log_level", apiLogLevelHandler).Methods("GET", "PUT", "DELETE")
+	r.HandleFunc("/apis/{apiID}/rewrite-test", rewriteTestHandler).Methods("POST")
+	r.HandleFunc("/apis/{apiID}/graphql", graphQLUpdateHandler).Methods("PUT")
+	r.HandleFunc("/cache", invalidateTaggedCacheHandler).Methods("DELETE")
 	r.HandleFunc("/cache/{apiID}", invalidateCacheHandler).Methods("DELETE")
 	r.HandleFunc("/keys", keyHandler).Methods("POST", "PUT", "GET", "DELETE")
 	r.HandleFunc("/keys/preview", previewKeyHandler).Methods("POST")
+	r.HandleFunc("/backup", backupHandler).Methods("POST")
+	r.HandleFunc("/restore", restoreHandler).Methods("POST")
+	r.HandleFunc("/config/validate", validateConfigHandler).Methods("GET")
+	r.HandleFunc("/policies/export", exportPoliciesHandler).Methods("GET")
+	r.HandleFunc("/policies/import", importPoliciesHandler).Methods("POST")
+	r.HandleFunc("/policies/throttle/validate", validatePolicyThrottleHandler).Methods("POST")
+	r.HandleFunc("/policies/{polID}/throttle", policyThrottleHandler).Methods("GET")
+	r.HandleFunc("/keys/by-alias/{alias}", keyByAliasHandler).Methods("GET")
+	r.HandleFunc("/keys/{keyName}/allowed-ips", keyAllowedIPsHandler).Methods("PATCH")
+	r.HandleFunc("/keys/{keyName}/override", keyLimitOverrideHandler).Methods("PATCH", "DELETE")
+	r.HandleFunc("/keys/{keyName}/effective", keyEffectiveHandler).Methods("GET")
 	r.HandleFunc("/keys/{keyName:[^/]*}", keyHandler).Methods("POST", "PUT", "GET", "DELETE")
 	r.HandleFunc("/certs", certHandler).Methods("POST", "GET")
-	r.HandleFunc("/certs/{certID:[^/]*}", certHandler).Methods("POST", "GET", "DELETE")
+	r.HandleFunc("/certs/expiring", expiringCertsHandler).Methods("GET")
+	r.HandleFunc("/certs/server/reload", serverCertsReloadHandler).Methods("POST")
+	r.HandleFunc("/certs/{certID:[^/]*}", certHandler).Methods("POST", "PUT", "GET", "DELETE")
+	r.HandleFunc("/oauth/clients/{apiID}/export", exportOauthClientsHandler).Methods("GET")
 	r.HandleFunc("/oauth/clients/{apiID}", oAuthClientHandler).Methods("GET", "DELETE")
 	r.HandleFunc("/oauth/clients/{apiID}/{keyName:[^/]*}", oAuthClientHandler).Methods("GET", "DELETE")
 	r.HandleFunc("/oauth/clients/{apiID}/{keyName}/tokens", oAuthClientTokensHandler).Methods("GET")
@@ -487,13 +536,37 @@ func loadControlAPIEndpoints(muxer *mux.Router) {
 // correct security credentials - this is a shared secret between the
 // client and the owner and is set in the tyk.conf file. This should
 // never be made public!
+//
+// Clients exceeding the control API rate limit, or failing to authorize too
+// often, are rejected before their key is checked.
 func checkIsAPIOwner(next http.Handler) http.Handler {
 	secret := config.Global().Secret
+	guard := controlAPIProtection
+	guard.configure(config.Global().Security.ControlAPIProtection)
+	allowList := newControlAPIAllowList(config.Global().Security.ControlAPIAllowList)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := controlAPIClientIP(r, allowList)
+		if guard.enabled() {
+			switch guard.allow(ip) {
+			case http.StatusTooManyRequests:
+				reportControlAPIAccess(EventControlAPIRateLimitExceeded, "Control API rate limit exceeded", r, ip, 0)
+				doJSONWrite(w, http.StatusTooManyRequests, apiError("Control API rate limit exceeded"))
+				return
+			case http.StatusForbidden:
+				doJSONWrite(w, http.StatusForbidden, apiError("Too many failed attempts, try again later"))
+				return
+			}
+		}
+
 		tykAuthKey := r.Header.Get(headers.XTykAuthorization)
 		if tykAuthKey != secret {
 			// Error
-			mainLog.Warning("Attempted administrative access with invalid or missing key!")
+			failures, lockedOut := guard.fail(ip)
+			if lockedOut {
+				reportControlAPIAccess(EventControlAPILockout, "Control API client locked out after failed authorization attempts", r, ip, failures)
+			} else {
+				reportControlAPIAccess(EventControlAPIAuthFailure, "Attempted administrative access with invalid or missing key!", r, ip, failures)
+			}
 
 			doJSONWrite(w, http.StatusForbidden, apiError("Attempted administrative access with invalid or missing key!"))
 			return
@@ -530,14 +603,27 @@ func addOAuthHandlers(spec *APISpec, muxer *mux.Router) *OAuthManager {
 	prefix := generateOAuthPrefix(spec.APIID)
 	storageManager := getGlobalStorageHandler(prefix, false)
 	storageManager.Connect()
-	osinStorage := &RedisOsinStorageInterface{storageManager, GlobalSessionManager, &storage.RedisCluster{KeyPrefix: prefix, HashKeys: false}, spec.OrgID}
+	osinStorage := &RedisOsinStorageInterface{storageManager, GlobalSessionManager, &storage.RedisCluster{KeyPrefix: prefix, HashKeys: false}, spec.OrgID, spec}
 
 	osinServer := TykOsinNewServer(serverConfig, osinStorage)
 
+	if spec.Oauth2Meta.AccessTokenFormat == OAuthTokenFormatJWT {
+		tokenGen, err := newJWTAccessTokenGen(spec, storageManager)
+		if err != nil {
+			mainLog.WithError(err).Error("Couldn't set up JWT access tokens, issuing opaque tokens for API: ", spec.APIID)
+		} else {
+			osinServer.AccessTokenGen = tokenGen
+			osinServer.Server.AccessTokenGen = tokenGen
+			if tokenGen.publishesKey() {
+				muxer.Handle("/oauth/jwks{_:/?}", allowMethods(tokenGen.ServeHTTP, "GET"))
+			}
+		}
+	}
+
 	oauthManager := OAuthManager{spec, osinServer}
 	oauthHandlers := OAuthHandlers{oauthManager}
 
-	muxer.Handle(apiAuthorizePath, checkIsAPIOwner(allowMethods(oauthHandlers.HandleGenerateAuthCodeData, "POST")))
+	muxer.Handle(apiAuthorizePath, checkControlAPIAllowList(checkIsAPIOwner(allowMethods(oauthHandlers.HandleGenerateAuthCodeData, "POST"))))
 	muxer.HandleFunc(clientAuthPath, allowMethods(oauthHandlers.HandleAuthorizePassthrough, "GET", "POST"))
 	muxer.HandleFunc(clientAccessPath, addSecureAndCacheHeaders(allowMethods(oauthHandlers.HandleAccessRequest, "GET", "POST")))
 	muxer.HandleFunc(revokeToken, oauthHandlers.HandleRevokeToken)
@@ -681,6 +767,21 @@ func createResponseMiddlewareChain(spec *APISpec, responseFuncs []apidef.Middlew
 		responseChain = append(responseChain, processor)
 	}
 
+	if spec.FieldMasking.Enabled && len(spec.FieldMasking.Rules) > 0 {
+		processor := &ResponseFieldMaskingMiddleware{}
+		if err := processor.Init(nil, spec); err != nil {
+			mainLog.WithError(err).Error("Failed to init field masking")
+		}
+		responseChain = append(responseChain, processor)
+	}
+
+	// responses are encrypted last, once transformed
+	if spec.JWE.Enabled && spec.JWE.ResponseKeyMetadata != "" {
+		processor := &ResponseJWEEncryptMiddleware{}
+		processor.Init(nil, spec)
+		responseChain = append(responseChain, processor)
+	}
+
 	spec.ResponseChain = responseChain
 }
 
@@ -688,19 +789,137 @@ func handleCORS(router *mux.Router, spec *APISpec) {
 
 	if spec.CORS.Enable {
 		mainLog.Debug("CORS ENABLED")
-		c := cors.New(cors.Options{
-			AllowedOrigins:     spec.CORS.AllowedOrigins,
-			AllowedMethods:     spec.CORS.AllowedMethods,
-			AllowedHeaders:     spec.CORS.AllowedHeaders,
-			ExposedHeaders:     spec.CORS.ExposedHeaders,
-			AllowCredentials:   spec.CORS.AllowCredentials,
-			MaxAge:             spec.CORS.MaxAge,
-			OptionsPassthrough: spec.CORS.OptionsPassthrough,
-			Debug:              spec.CORS.Debug,
+		c := cors.New(corsOptions(spec.CORS, apidef.CORSMeta{}))
+
+		endpointCORS := spec.CORS.DeriveAllowedMethods
+		for _, version := range spec.VersionData.Versions {
+			if len(version.ExtendedPaths.CORS) > 0 {
+				endpointCORS = true
+			}
+		}
+		if !endpointCORS {
+			router.Use(c.Handler)
+			return
+		}
+
+		router.Use(func(next http.Handler) http.Handler {
+			apiHandler := c.Handler(next)
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// endpoint specific options take precedence
+				if _, versionPaths, _, status := spec.Version(r); status == StatusOk {
+					if found, meta := spec.CheckSpecMatchesStatus(r, versionPaths, CORSEndpoint); found {
+						meta.(*EndpointCORSSpec).Cors.Handler(next).ServeHTTP(w, r)
+						return
+					}
+				}
+				apiHandler.ServeHTTP(w, r)
+			})
 		})
+	}
+}
 
-		router.Use(c.Handler)
+// handleSecurityHeaders sets the security headers of an API on all its
+// responses, including the ones written by the gateway itself.
+func handleSecurityHeaders(router *mux.Router, spec *APISpec) {
+	secHeaders := securityHeaders(config.Global().SecurityHeaders, spec.SecurityHeaders)
+	if len(secHeaders) == 0 {
+		return
 	}
+
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for name, value := range secHeaders {
+				w.Header().Set(name, value)
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+}
+
+// securityHeaders returns the security headers of an API, with its non empty
+// options overriding the gateway ones.
+func securityHeaders(conf, override apidef.SecurityHeadersConfig) map[string]string {
+	if !conf.Enabled && !override.Enabled {
+		return nil
+	}
+
+	if override.HSTS.MaxAge > 0 {
+		conf.HSTS = override.HSTS
+	}
+	conf.ContentTypeOptions = conf.ContentTypeOptions || override.ContentTypeOptions
+	for _, opt := range []struct{ value, override *string }{
+		{&conf.ContentSecurityPolicy, &override.ContentSecurityPolicy},
+		{&conf.FrameOptions, &override.FrameOptions},
+		{&conf.ReferrerPolicy, &override.ReferrerPolicy},
+		{&conf.PermissionsPolicy, &override.PermissionsPolicy},
+	} {
+		if *opt.override != "" {
+			*opt.value = *opt.override
+		}
+	}
+
+	secHeaders := map[string]string{}
+	if conf.HSTS.MaxAge > 0 {
+		hsts := "max-age=" + strconv.FormatInt(conf.HSTS.MaxAge, 10)
+		if conf.HSTS.IncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if conf.HSTS.Preload {
+			hsts += "; preload"
+		}
+		secHeaders[headers.StrictTransportSecurity] = hsts
+	}
+	if conf.ContentTypeOptions {
+		secHeaders[headers.XContentTypeOptions] = "nosniff"
+	}
+	for name, value := range map[string]string{
+		headers.ContentSecurityPolicy: conf.ContentSecurityPolicy,
+		headers.XFrameOptions:         conf.FrameOptions,
+		headers.ReferrerPolicy:        conf.ReferrerPolicy,
+		headers.PermissionsPolicy:     conf.PermissionsPolicy,
+	} {
+		if value != "" {
+			secHeaders[name] = value
+		}
+	}
+
+	return secHeaders
+}
+
+// corsOptions returns the CORS options of an API, with the non empty options
+// of the endpoint override applied.
+func corsOptions(conf apidef.CORSConfig, override apidef.CORSMeta) cors.Options {
+	opts := cors.Options{
+		AllowedOrigins:     conf.AllowedOrigins,
+		AllowedMethods:     conf.AllowedMethods,
+		AllowedHeaders:     conf.AllowedHeaders,
+		ExposedHeaders:     conf.ExposedHeaders,
+		AllowCredentials:   conf.AllowCredentials,
+		MaxAge:             conf.MaxAge,
+		OptionsPassthrough: conf.OptionsPassthrough,
+		Debug:              conf.Debug,
+	}
+
+	if len(override.AllowedOrigins) > 0 {
+		opts.AllowedOrigins = override.AllowedOrigins
+	}
+	if len(override.AllowedMethods) > 0 {
+		opts.AllowedMethods = override.AllowedMethods
+	}
+	if len(override.AllowedHeaders) > 0 {
+		opts.AllowedHeaders = override.AllowedHeaders
+	}
+	if len(override.ExposedHeaders) > 0 {
+		opts.ExposedHeaders = override.ExposedHeaders
+	}
+	if override.AllowCredentials != nil {
+		opts.AllowCredentials = *override.AllowCredentials
+	}
+	if override.MaxAge > 0 {
+		opts.MaxAge = override.MaxAge
+	}
+
+	return opts
 }
 
 func isRPCMode() bool {
@@ -730,6 +949,7 @@ func DoReload() {
 		mainLog.Error("Error during syncing policies:", err.Error())
 		return
 	}
+	syncKeyTemplates()
 
 	// load the specs
 	if count, err := syncAPISpecs(); err != nil {
@@ -982,10 +1202,23 @@ func initialiseSystem(ctx context.Context) error {
 		}
 	}
 
+	switch strings.ToLower(config.Global().LogFormat) {
+	case "", "text":
+		// default, do nothing
+	case "json":
+		log.Formatter = &logrus.JSONFormatter{}
+	default:
+		mainLog.Fatalf("Invalid log format %q specified in config, must be text or json. ", config.Global().LogFormat)
+	}
+
 	if config.Global().Storage.Type != "redis" {
 		mainLog.Fatal("Redis connection details not set, please ensure that the storage type is set to Redis and that the connection parameters are correct.")
 	}
 
+	if protection := config.Global().Security.ControlAPIProtection; protection.RateLimit > 0 && protection.RateLimitPer <= 0 {
+		mainLog.Fatal("The control API rate limit requires a positive rate_limit_per.")
+	}
+
 	// suply rpc client globals to join it main loging and instrumentation sub systems
 	rpc.Log = log
 	rpc.Instrument = instrument
@@ -1253,6 +1486,17 @@ func Start() {
 		os.Exit(0)
 	}
 
+	if *cli.ValidateConfig {
+		paths := confPaths
+		if *cli.Conf != "" {
+			paths = []string{*cli.Conf}
+		}
+		if !runConfigValidation(paths) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	SetNodeID("solo-" + uuid.NewV4().String())
 
 	if err := initialiseSystem(ctx); err != nil {
@@ -1339,6 +1583,7 @@ func Start() {
 	if err := defaultProxyMux.again.Close(); err != nil {
 		mainLog.Error("Closing listeners: ", err)
 	}
+	stopControlSocket()
 	// stop analytics workers
 	if config.Global().EnableAnalytics && analytics.Store == nil {
 		analytics.Stop()
@@ -1413,6 +1658,37 @@ func start(ctx context.Context) {
 	// interval counts from the start of one reload to the next.
 	go reloadLoop(ctx, time.Tick(time.Second))
 	go reloadQueueLoop(ctx)
+
+	if conf := config.Global().KeyExpiryAudit; conf.EnableWebhook && !isRPCMode() {
+		go keyExpiryAuditLoop(ctx, conf)
+	}
+
+	if conf := config.Global().CertificateExpiry; conf.Enabled {
+		go certExpiryLoop(ctx, conf)
+	}
+
+	go sloMonitorLoop(ctx)
+
+	if conf := config.Global().SelfProtection; conf.Enabled {
+		go selfProtectionLoop(ctx, conf)
+	}
+
+	if config.Global().SessionFallback.Enabled {
+		go sessionFallbackLoop(ctx)
+	}
+
+	if interval := config.Global().HttpServerOptions.CertificateReloadInterval; interval > 0 {
+		go serverCertReloadLoop(ctx, time.Duration(interval)*time.Second)
+	}
+
+	if conf := config.Global().OauthTokenPurge; conf.Enabled && !isRPCMode() {
+		go oauthTokenPurgeLoop(ctx, conf)
+	}
+
+	if conf := config.Global().KeyspaceEvents; conf.Enabled {
+		keyspaceEvents = newKeyspaceEventStream(conf)
+		go keyspaceEvents.Run(ctx)
+	}
 }
 
 func dashboardServiceInit() {
@@ -1480,7 +1756,7 @@ func startServer() {
 	muxer := &proxyMux{}
 
 	router := mux.NewRouter()
-	loadControlAPIEndpoints(router)
+	loadNetworkControlAPIEndpoints(router)
 	muxer.setRouter(config.Global().ControlAPIPort, "", router)
 
 	if muxer.router(config.Global().ListenPort, "") == nil {
@@ -1488,6 +1764,7 @@ func startServer() {
 	}
 
 	defaultProxyMux.swap(muxer)
+	startControlSocket()
 
 	// handle dashboard registration and nonces if available
 	handleDashboardRegistration()
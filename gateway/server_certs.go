@@ -0,0 +1,176 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk/certs"
+	"github.com/TykTechnologies/tyk/config"
+)
+
+// serverCertificates are the certificates served on the TLS listeners of the
+// gateway, as set in http_server_options. Names maps the names of the
+// certificates loaded from files to them.
+type serverCertificates struct {
+	certs []tls.Certificate
+	names map[string]*tls.Certificate
+}
+
+var (
+	serverCertsMu sync.RWMutex
+	serverCerts   *serverCertificates
+	// serverCertFiles are the modification times of the certificate and
+	// key files when they were last loaded.
+	serverCertFiles map[string]time.Time
+)
+
+// loadServerCertificates loads the certificates set in http_server_options.
+// Certificates that fail to load are skipped, and the first error returned.
+func loadServerCertificates() (*serverCertificates, error) {
+	loaded := &serverCertificates{names: map[string]*tls.Certificate{}}
+
+	var firstErr error
+	for _, certData := range config.Global().HttpServerOptions.Certificates {
+		cert, err := tls.LoadX509KeyPair(certData.CertFile, certData.KeyFile)
+		if err != nil {
+			log.Errorf("Server error: loadkeys: %s", err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %v", certData.CertFile, err)
+			}
+			continue
+		}
+		loaded.certs = append(loaded.certs, cert)
+		loaded.names[certData.Name] = &cert
+	}
+
+	for _, cert := range CertificateManager.List(config.Global().HttpServerOptions.SSLCertificates, certs.CertificatePrivate) {
+		if cert != nil {
+			loaded.certs = append(loaded.certs, *cert)
+		}
+	}
+
+	return loaded, firstErr
+}
+
+// serverCertFileTimes returns the modification times of the certificate and
+// key files set in http_server_options.
+func serverCertFileTimes() map[string]time.Time {
+	times := map[string]time.Time{}
+	for _, certData := range config.Global().HttpServerOptions.Certificates {
+		for _, path := range []string{certData.CertFile, certData.KeyFile} {
+			if info, err := os.Stat(path); err == nil {
+				times[path] = info.ModTime()
+			}
+		}
+	}
+	return times
+}
+
+// initServerCertificates loads the certificates to serve, as a TLS listener
+// is started.
+func initServerCertificates() {
+	times := serverCertFileTimes()
+	loaded, _ := loadServerCertificates()
+
+	serverCertsMu.Lock()
+	serverCerts = loaded
+	serverCertFiles = times
+	serverCertsMu.Unlock()
+}
+
+// getServerCertificates returns the certificates to serve.
+func getServerCertificates() *serverCertificates {
+	serverCertsMu.RLock()
+	defer serverCertsMu.RUnlock()
+	return serverCerts
+}
+
+// reloadServerCertificates re-reads the certificates to serve. New TLS
+// connections get them, established ones are kept. If one fails to load,
+// the certificates being served are kept.
+func reloadServerCertificates() error {
+	times := serverCertFileTimes()
+	CertificateManager.FlushCache()
+	loaded, err := loadServerCertificates()
+	if err != nil {
+		return err
+	}
+
+	serverCertsMu.Lock()
+	serverCerts = loaded
+	serverCertFiles = times
+	serverCertsMu.Unlock()
+
+	tlsConfigCache.Flush()
+	mainLog.Info("Reloaded server certificates")
+	return nil
+}
+
+// serverCertFilesChanged reports whether a certificate or key file changed
+// since the certificates were last loaded.
+func serverCertFilesChanged() bool {
+	times := serverCertFileTimes()
+
+	serverCertsMu.RLock()
+	defer serverCertsMu.RUnlock()
+	if len(times) != len(serverCertFiles) {
+		return true
+	}
+	for path, modTime := range times {
+		if !modTime.Equal(serverCertFiles[path]) {
+			return true
+		}
+	}
+	return false
+}
+
+// serverCertReloadLoop reloads the certificates to serve when their files
+// change.
+func serverCertReloadLoop(ctx context.Context, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+
+		if !serverCertFilesChanged() {
+			continue
+		}
+		if err := reloadServerCertificates(); err != nil {
+			mainLog.WithError(err).Error("Can't reload server certificates, keeping the current ones")
+		}
+	}
+}
+
+// Reload server certificates
+// Re-reads the certificates served on the TLS listeners of the gateway, from
+// their files and the certificate store. New connections are served the new
+// certificates, established ones are kept. If one fails to load, the current
+// certificates are kept.
+//
+//---
+// responses:
+//   200:
+//     description: Certificates reloaded
+//     schema:
+//       "$ref": "#/definitions/apiStatusMessage"
+//   500:
+//     description: A certificate failed to load
+//     schema:
+//       "$ref": "#/definitions/apiStatusMessage"
+func serverCertsReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if err := reloadServerCertificates(); err != nil {
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Can't reload server certificates: "+err.Error()))
+		return
+	}
+	doJSONWrite(w, http.StatusOK, apiOk("server certificates reloaded"))
+}
@@ -0,0 +1,97 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestServerCertificatesReload(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "certs")
+	defer os.RemoveAll(dir)
+
+	certFilePath := filepath.Join(dir, "server.crt")
+	certKeyPath := filepath.Join(dir, "server.key")
+	writeCert := func(certPem, keyPem []byte) {
+		ioutil.WriteFile(certFilePath, certPem, 0666)
+		ioutil.WriteFile(certKeyPath, keyPem, 0666)
+	}
+
+	firstCert, firstKey, _, _ := genServerCertificate()
+	writeCert(firstCert, firstKey)
+
+	globalConf := config.Global()
+	globalConf.HttpServerOptions.Certificates = []config.CertData{{
+		Name:     "localhost",
+		CertFile: certFilePath,
+		KeyFile:  certKeyPath,
+	}}
+	globalConf.HttpServerOptions.UseSSL = true
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	servedCert := func() []byte {
+		conn, err := tls.Dial("tcp", strings.TrimPrefix(ts.URL, "https://"), &tls.Config{
+			ServerName:         "localhost",
+			InsecureSkipVerify: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Raw
+	}
+	derBytes := func(certPem []byte) []byte {
+		block, _ := pem.Decode(certPem)
+		return block.Bytes
+	}
+	assert.Equal(t, derBytes(firstCert), servedCert())
+
+	secondCert, secondKey, _, _ := genServerCertificate()
+	writeCert(secondCert, secondKey)
+
+	_, _ = ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/tyk/certs/server/reload", AdminAuth: true, Code: http.StatusOK})
+	assert.Equal(t, derBytes(secondCert), servedCert())
+
+	// a broken certificate keeps the current one
+	writeCert([]byte("garbage"), secondKey)
+	_, _ = ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/tyk/certs/server/reload", AdminAuth: true, Code: http.StatusInternalServerError})
+	assert.Equal(t, derBytes(secondCert), servedCert())
+}
+
+func TestServerCertFilesChanged(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "certs")
+	defer os.RemoveAll(dir)
+
+	certFilePath := filepath.Join(dir, "server.crt")
+	certKeyPath := filepath.Join(dir, "server.key")
+	certPem, keyPem, _, _ := genServerCertificate()
+	ioutil.WriteFile(certFilePath, certPem, 0666)
+	ioutil.WriteFile(certKeyPath, keyPem, 0666)
+
+	globalConf := config.Global()
+	globalConf.HttpServerOptions.Certificates = []config.CertData{{CertFile: certFilePath, KeyFile: certKeyPath}}
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	initServerCertificates()
+	assert.False(t, serverCertFilesChanged())
+
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFilePath, later, later)
+	assert.True(t, serverCertFilesChanged())
+}
@@ -0,0 +1,189 @@
+package gateway
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const (
+	defaultSessionFallbackTTL     = 300
+	defaultSessionFallbackMaxSize = 10000
+	sessionFallbackInterval       = time.Second
+)
+
+// sessionFallbackEngaged is 1 while Redis is unavailable and sessions are
+// read from the session fallback.
+var sessionFallbackEngaged int32
+
+var sessionFallback = newSessionFallbackCache()
+
+// sessionFallbackEntry is a session validated by the node.
+type sessionFallbackEntry struct {
+	key     string
+	session *user.SessionState
+	expires time.Time
+}
+
+// sessionFallbackCache is an LRU of the sessions recently validated, from
+// which keys are authorized while Redis is unavailable.
+type sessionFallbackCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+func newSessionFallbackCache() *sessionFallbackCache {
+	return &sessionFallbackCache{entries: map[string]*list.Element{}, lru: list.New()}
+}
+
+func sessionFallbackLimits(conf config.SessionFallbackConfig) (time.Duration, int) {
+	ttl, maxSize := conf.TTL, conf.MaxSize
+	if ttl <= 0 {
+		ttl = defaultSessionFallbackTTL
+	}
+	if maxSize <= 0 {
+		maxSize = defaultSessionFallbackMaxSize
+	}
+	return time.Duration(ttl) * time.Second, maxSize
+}
+
+// set keeps a copy of a session validated while Redis is available. As it is
+// called on every request, the copy of a session is only refreshed once it
+// is past half its TTL, changes to the key removing it from the cache.
+func (c *sessionFallbackCache) set(key string, session *user.SessionState, conf config.SessionFallbackConfig) {
+	ttl, maxSize := sessionFallbackLimits(conf)
+	now := time.Now()
+	if c.touch(key, now.Add(ttl/2)) {
+		return
+	}
+
+	clone := session.Clone()
+	entry := &sessionFallbackEntry{key: key, session: &clone, expires: now.Add(ttl)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > maxSize {
+		c.remove(c.lru.Back())
+	}
+}
+
+// touch marks the session of key as the most recently used, and reports
+// whether it expires after refreshAfter.
+func (c *sessionFallbackCache) touch(key string, refreshAfter time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return false
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*sessionFallbackEntry).expires.After(refreshAfter)
+}
+
+// get returns a copy of the session of key, if it was validated within the
+// TTL.
+func (c *sessionFallbackCache) get(key string) (user.SessionState, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return user.SessionState{}, false
+	}
+	entry := elem.Value.(*sessionFallbackEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(elem)
+		return user.SessionState{}, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry.session.Clone(), true
+}
+
+func (c *sessionFallbackCache) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+}
+
+// remove must be called with c.mu held.
+func (c *sessionFallbackCache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*sessionFallbackEntry).key)
+}
+
+func (c *sessionFallbackCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// sessionFallbackActive reports whether sessions are to be read from the
+// session fallback.
+func sessionFallbackActive() bool {
+	return atomic.LoadInt32(&sessionFallbackEngaged) == 1
+}
+
+// checkSessionFallback engages the session fallback when Redis becomes
+// unavailable, and disengages it once Redis is back.
+func checkSessionFallback(redisUp bool) {
+	engaged := !redisUp
+	var want, old int32
+	if engaged {
+		want = 1
+	} else {
+		old = 1
+	}
+	if !atomic.CompareAndSwapInt32(&sessionFallbackEngaged, old, want) {
+		return
+	}
+
+	sessions := sessionFallback.len()
+	job := instrument.NewJob("SessionFallback")
+	message := "Redis is back, session fallback disengaged"
+	if engaged {
+		message = "Redis is unavailable, session fallback engaged: only recently validated keys are authorized"
+		job.Event("engaged")
+	} else {
+		job.Event("disengaged")
+	}
+	log.WithFields(logrus.Fields{
+		"prefix":   "session-fallback",
+		"sessions": sessions,
+	}).Warning(message)
+
+	FireSystemEvent(EventSessionFallback, EventSessionFallbackMeta{
+		EventMetaDefault: EventMetaDefault{Message: message},
+		Engaged:          engaged,
+		Sessions:         sessions,
+	})
+}
+
+// sessionFallbackLoop checks whether Redis is available until ctx is done.
+func sessionFallbackLoop(ctx context.Context) {
+	ticker := time.NewTicker(sessionFallbackInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkSessionFallback(storage.Connected())
+		}
+	}
+}
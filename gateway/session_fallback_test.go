@@ -0,0 +1,81 @@
+package gateway
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestSessionFallbackCache(t *testing.T) {
+	conf := config.SessionFallbackConfig{Enabled: true, MaxSize: 2}
+
+	t.Run("evicts the least recently used", func(t *testing.T) {
+		c := newSessionFallbackCache()
+		for i := 0; i < 3; i++ {
+			c.set(strconv.Itoa(i), &user.SessionState{Alias: strconv.Itoa(i)}, conf)
+			if i == 1 {
+				// keeps 0 from being the least recently used
+				_, found := c.get("0")
+				assert.True(t, found)
+			}
+		}
+
+		assert.Equal(t, 2, c.len())
+		_, found := c.get("1")
+		assert.False(t, found)
+		session, found := c.get("0")
+		assert.True(t, found)
+		assert.Equal(t, "0", session.Alias)
+	})
+
+	t.Run("expires sessions", func(t *testing.T) {
+		c := newSessionFallbackCache()
+		c.set("key", &user.SessionState{}, conf)
+		c.lru.Front().Value.(*sessionFallbackEntry).expires = time.Now().Add(-time.Second)
+
+		_, found := c.get("key")
+		assert.False(t, found)
+		assert.Equal(t, 0, c.len())
+	})
+
+	t.Run("refreshes sessions near expiry", func(t *testing.T) {
+		c := newSessionFallbackCache()
+		c.set("key", &user.SessionState{Alias: "first"}, conf)
+		c.set("key", &user.SessionState{Alias: "second"}, conf)
+		session, _ := c.get("key")
+		assert.Equal(t, "first", session.Alias)
+
+		c.lru.Front().Value.(*sessionFallbackEntry).expires = time.Now().Add(time.Second)
+		c.set("key", &user.SessionState{Alias: "second"}, conf)
+		session, _ = c.get("key")
+		assert.Equal(t, "second", session.Alias)
+	})
+
+	t.Run("deletes sessions", func(t *testing.T) {
+		c := newSessionFallbackCache()
+		c.set("key", &user.SessionState{}, conf)
+		c.delete("key")
+
+		_, found := c.get("key")
+		assert.False(t, found)
+	})
+}
+
+func TestCheckSessionFallback(t *testing.T) {
+	defer atomic.StoreInt32(&sessionFallbackEngaged, 0)
+
+	checkSessionFallback(true)
+	assert.False(t, sessionFallbackActive())
+
+	checkSessionFallback(false)
+	assert.True(t, sessionFallbackActive())
+
+	checkSessionFallback(true)
+	assert.False(t, sessionFallbackActive())
+}
@@ -3,6 +3,7 @@ package gateway
 import (
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"time"
 
@@ -61,7 +62,7 @@ func (l *SessionLimiter) doRollingWindowWrite(key, rateLimiterKey, rateLimiterSe
 	if dryRun {
 		ratePerPeriodNow, _ = store.GetRollingWindow(rateLimiterKey, int64(per), pipeline)
 	} else {
-		ratePerPeriodNow, _ = store.SetRollingWindow(rateLimiterKey, int64(per), "-1", pipeline)
+		ratePerPeriodNow = setRateLimitWindow(store, rateLimiterKey, int64(per), pipeline)
 	}
 
 	//log.Info("Num Requests: ", ratePerPeriodNow)
@@ -163,6 +164,122 @@ func (l *SessionLimiter) limitDRL(currentSession *user.SessionState, key string,
 	return false
 }
 
+// limit counts a request against a rate limit counter of a session, with the
+// configured limiter. It returns true if the limit is exceeded.
+func (l *SessionLimiter) limit(currentSession *user.SessionState, key string, rateScope string, store storage.Handler,
+	globalConf *config.Config, apiLimit *user.APILimit, dryRun bool) bool {
+
+	if globalConf.EnableSentinelRateLimiter {
+		return l.limitSentinel(currentSession, key, rateScope, store, globalConf, apiLimit, dryRun)
+	}
+	if useDRL(globalConf, apiLimit) {
+		return l.limitDRL(currentSession, key, rateScope, apiLimit, dryRun)
+	}
+	return l.limitRedis(currentSession, key, rateScope, store, globalConf, apiLimit, dryRun)
+}
+
+// useDRL reports whether the rate limit is enforced by the in-memory DRL
+// limiter rather than by the Redis rolling window.
+func useDRL(globalConf *config.Config, apiLimit *user.APILimit) bool {
+	if globalConf.EnableSentinelRateLimiter || globalConf.EnableRedisRollingLimiter {
+		return false
+	}
+
+	var n float64
+	if DRLManager.Servers != nil {
+		n = float64(DRLManager.Servers.Count())
+	}
+	rate := apiLimit.Rate / apiLimit.Per
+	c := globalConf.DRLThreshold
+	if c == 0 {
+		// defaults to 5
+		c = 5
+	}
+
+	// If we have 1 server, there is no need to strain redis at all the leaky
+	// bucket algorithm will suffice.
+	return n <= 1 || n*c < rate
+}
+
+// rateLimitStatus is the state of the rate limit of a session. Reset is the
+// number of seconds until the limit is fully available again.
+type rateLimitStatus struct {
+	Limit     int64
+	Remaining int64
+	Reset     int64
+}
+
+// RateLimitStatus reads, without counting a request, the state of the rate
+// limit that applies to the session for the API. It returns false if the
+// session is not rate limited.
+func (l *SessionLimiter) RateLimitStatus(r *http.Request, currentSession *user.SessionState, key string, store storage.Handler, globalConf *config.Config, api *APISpec) (rateLimitStatus, bool) {
+	accessDef, allowanceScope, err := GetAccessDefinitionByAPIIDOrSession(currentSession, api)
+	if err != nil || accessDef.Limit.Rate <= 0 || accessDef.Limit.Per <= 0 {
+		return rateLimitStatus{}, false
+	}
+
+	rateScope := ""
+	if allowanceScope != "" {
+		rateScope = allowanceScope + "-"
+	}
+	status := l.rateLimitStatusOf(currentSession, key, rateScope, store, globalConf, accessDef.Limit)
+	// the lowest of the limits of the key and of its scope applies
+	if keyScope, _ := rateLimitKeyScope(r, api); keyScope != "" {
+		scoped := l.rateLimitStatusOf(currentSession, key, rateScope+keyScope, store, globalConf, rateLimitKeyLimit(api, accessDef.Limit))
+		if scoped.Remaining < status.Remaining {
+			status = scoped
+		}
+	}
+	return status, true
+}
+
+// rateLimitStatusOf reads the state of a rate limit counter of a session.
+func (l *SessionLimiter) rateLimitStatusOf(currentSession *user.SessionState, key, rateScope string, store storage.Handler, globalConf *config.Config, limit *user.APILimit) rateLimitStatus {
+	status := rateLimitStatus{
+		Limit: int64(limit.Rate),
+		Reset: int64(limit.Per),
+	}
+
+	if !globalConf.EnableSentinelRateLimiter && useDRL(globalConf, limit) {
+		if l.bucketStore == nil {
+			l.bucketStore = memorycache.New()
+		}
+
+		bucketKey := key + ":" + rateScope + currentSession.LastUpdated
+		rate := uint(limit.Rate * float64(DRLManager.RequestTokenValue))
+		if rate < uint(DRLManager.CurrentTokenValue()) {
+			rate = uint(DRLManager.CurrentTokenValue())
+		}
+		bucket, err := l.bucketStore.Create(bucketKey, rate, time.Duration(limit.Per)*time.Second)
+		if err != nil {
+			return status
+		}
+
+		status.Remaining = int64(bucket.Remaining())
+		if tokenValue := DRLManager.CurrentTokenValue(); tokenValue > 0 {
+			status.Remaining /= int64(tokenValue)
+		}
+		if reset := time.Until(bucket.Reset()); reset > 0 {
+			status.Reset = int64(math.Ceil(reset.Seconds()))
+		}
+	} else {
+		// The rolling window frees requests as they age, the window length
+		// is the longest wait.
+		rateLimiterKey := RateLimitKeyPrefix + rateScope + currentSession.GetKeyHash()
+		count, _ := store.GetRollingWindow(rateLimiterKey, int64(limit.Per), globalConf.EnableNonTransactionalRateLimiter)
+		status.Remaining = status.Limit - int64(count)
+	}
+
+	if status.Remaining < 0 {
+		status.Remaining = 0
+	}
+	if status.Remaining > status.Limit {
+		status.Remaining = status.Limit
+	}
+
+	return status
+}
+
 func (sfr sessionFailReason) String() string {
 	switch sfr {
 	case sessionFailNone:
@@ -194,37 +311,20 @@ func (l *SessionLimiter) ForwardMessage(r *http.Request, currentSession *user.Se
 		if allowanceScope != "" {
 			rateScope = allowanceScope + "-"
 		}
-		if globalConf.EnableSentinelRateLimiter {
-			if l.limitSentinel(currentSession, key, rateScope, store, globalConf, accessDef.Limit, dryRun) {
+		// the key of the request may also be limited per tenant, unlike
+		// its organisation. The tenant is counted first, so that a tenant
+		// over its limit doesn't use up the limit of the key.
+		if key == ctxGetAuthToken(r) {
+			keyScope, ok := rateLimitKeyScope(r, api)
+			if !ok {
 				return sessionFailRateLimit
 			}
-		} else if globalConf.EnableRedisRollingLimiter {
-			if l.limitRedis(currentSession, key, rateScope, store, globalConf, accessDef.Limit, dryRun) {
+			if keyScope != "" && l.limit(currentSession, key, rateScope+keyScope, store, globalConf, rateLimitKeyLimit(api, accessDef.Limit), dryRun) {
 				return sessionFailRateLimit
 			}
-		} else {
-			var n float64
-			if DRLManager.Servers != nil {
-				n = float64(DRLManager.Servers.Count())
-			}
-			rate := accessDef.Limit.Rate / accessDef.Limit.Per
-			c := globalConf.DRLThreshold
-			if c == 0 {
-				// defaults to 5
-				c = 5
-			}
-
-			if n <= 1 || n*c < rate {
-				// If we have 1 server, there is no need to strain redis at all the leaky
-				// bucket algorithm will suffice.
-				if l.limitDRL(currentSession, key, rateScope, accessDef.Limit, dryRun) {
-					return sessionFailRateLimit
-				}
-			} else {
-				if l.limitRedis(currentSession, key, rateScope, store, globalConf, accessDef.Limit, dryRun) {
-					return sessionFailRateLimit
-				}
-			}
+		}
+		if l.limit(currentSession, key, rateScope, store, globalConf, accessDef.Limit, dryRun) {
+			return sessionFailRateLimit
 		}
 	}
 
@@ -260,9 +360,23 @@ func (l *SessionLimiter) RedisQuotaExceeded(r *http.Request, currentSession *use
 	quotaMax := limit.QuotaMax
 
 	log.Debug("[QUOTA] Quota limiter key is: ", rawKey)
+
+	if start, end, ok := quotaPeriod(limit, time.Now()); ok {
+		qInt, renewed := incrementCalendarQuota(store, rawKey, limit, start, end)
+		if qInt-1 >= quotaMax {
+			return true
+		}
+		if renewed {
+			ctxScheduleSessionUpdate(r)
+		}
+
+		setSessionQuota(currentSession, scope, quotaMax-qInt, end.Unix())
+		return false
+	}
+
 	log.Debug("Renewing with TTL: ", quotaRenewalRate)
 	// INCR the key (If it equals 1 - set EXPIRE)
-	qInt := store.IncrememntWithExpire(rawKey, quotaRenewalRate)
+	qInt := incrementQuotaCounter(store, rawKey, quotaRenewalRate)
 	// if the returned val is >= quota: block
 	if qInt-1 >= quotaMax {
 		renewalDate := time.Unix(quotaRenews, 0)
@@ -295,7 +409,46 @@ func (l *SessionLimiter) RedisQuotaExceeded(r *http.Request, currentSession *use
 	}
 
 	// If not, pass and set the values of the session to quotamax - counter
-	remaining := quotaMax - qInt
+	setSessionQuota(currentSession, scope, quotaMax-qInt, quotaRenews)
+
+	return false
+}
+
+// quotaCounterStore buffers the quota counter increments failing while the
+// store is unavailable.
+type quotaCounterStore interface {
+	IncrementCounterWithExpire(keyName string, expire int64) int64
+}
+
+// incrementQuotaCounter counts a request against a quota counter, with the
+// buffered increment of the store when it has one.
+func incrementQuotaCounter(store storage.Handler, rawKey string, expire int64) int64 {
+	if counterStore, ok := store.(quotaCounterStore); ok {
+		return counterStore.IncrementCounterWithExpire(rawKey, expire)
+	}
+	return store.IncrememntWithExpire(rawKey, expire)
+}
+
+// rateLimitWindowStore buffers the rate limiter window writes failing while
+// the store is unavailable.
+type rateLimitWindowStore interface {
+	SetRateLimitWindow(keyName string, per int64, val string, pipeline bool) (int, []interface{})
+}
+
+// setRateLimitWindow counts a request in a rate limiter window, with the
+// buffered write of the store when it has one.
+func setRateLimitWindow(store storage.Handler, rateLimiterKey string, per int64, pipeline bool) int {
+	if windowStore, ok := store.(rateLimitWindowStore); ok {
+		count, _ := windowStore.SetRateLimitWindow(rateLimiterKey, per, "-1", pipeline)
+		return count
+	}
+	count, _ := store.SetRollingWindow(rateLimiterKey, per, "-1", pipeline)
+	return count
+}
+
+// setSessionQuota reports the quota left to the session, for the access
+// rights sharing the allowance scope.
+func setSessionQuota(currentSession *user.SessionState, scope string, remaining, quotaRenews int64) {
 	if remaining < 0 {
 		remaining = 0
 	}
@@ -316,8 +469,6 @@ func (l *SessionLimiter) RedisQuotaExceeded(r *http.Request, currentSession *use
 		currentSession.QuotaRemaining = remaining
 		currentSession.QuotaRenews = quotaRenews
 	}
-
-	return false
 }
 
 func GetAccessDefinitionByAPIIDOrSession(currentSession *user.SessionState, api *APISpec) (accessDef *user.AccessDefinition, allowanceScope string, err error) {
@@ -337,6 +488,9 @@ func GetAccessDefinitionByAPIIDOrSession(currentSession *user.SessionState, api
 			Limit: &user.APILimit{
 				QuotaMax:           currentSession.QuotaMax,
 				QuotaRenewalRate:   currentSession.QuotaRenewalRate,
+				QuotaRenewalPeriod: currentSession.QuotaRenewalPeriod,
+				QuotaTimezone:      currentSession.QuotaTimezone,
+				QuotaCarryOver:     currentSession.QuotaCarryOver,
 				QuotaRenews:        currentSession.QuotaRenews,
 				Rate:               currentSession.Rate,
 				Per:                currentSession.Per,
@@ -347,5 +501,9 @@ func GetAccessDefinitionByAPIIDOrSession(currentSession *user.SessionState, api
 		}
 	}
 
+	if currentSession.LimitOverride.Active(time.Now().Unix()) {
+		accessDef.Limit = currentSession.LimitOverride.Apply(accessDef.Limit)
+	}
+
 	return accessDef, allowanceScope, nil
 }
@@ -0,0 +1,212 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+// defaultSLOWindow is the window of objectives, in seconds, when it isn't
+// set.
+const defaultSLOWindow = 5 * 60
+
+// SLOCompliance is how an API does against one of its objectives. Latency
+// compliance is the percentage of requests under the latency threshold, if
+// any, the error rate the percentage of requests answered with a 5xx status.
+// Objectives are only evaluated once their window has enough requests.
+// swagger:model
+type SLOCompliance struct {
+	Name              string  `json:"name"`
+	Window            int64   `json:"window"`
+	Requests          uint64  `json:"requests"`
+	LatencyThreshold  int64   `json:"latency_threshold"`
+	LatencyTarget     float64 `json:"latency_target"`
+	LatencyCompliance float64 `json:"latency_compliance"`
+	MaxErrorRate      float64 `json:"max_error_rate"`
+	ErrorRate         float64 `json:"error_rate"`
+	Evaluated         bool    `json:"evaluated"`
+	Breached          bool    `json:"breached"`
+}
+
+// SLOReport is how an API does against its objectives.
+// swagger:model
+type SLOReport struct {
+	APIID      string          `json:"api_id"`
+	Objectives []SLOCompliance `json:"objectives"`
+}
+
+type sloKey struct {
+	apiID, objective string
+}
+
+var (
+	// sloBreachesMu guards sloBreaches, the objectives breached at the
+	// last check, to only fire events when an objective gets breached.
+	sloBreachesMu sync.Mutex
+	sloBreaches   = map[sloKey]bool{}
+)
+
+// evaluateSLO checks the traffic stats of an API against its objectives.
+func evaluateSLO(spec *APISpec, now time.Time) []SLOCompliance {
+	if !spec.SLO.Enabled {
+		return []SLOCompliance{}
+	}
+
+	v, _ := trafficStats.Load(spec.APIID)
+	stats, _ := v.(*apiTrafficStats)
+
+	report := make([]SLOCompliance, 0, len(spec.SLO.Objectives))
+	for i, objective := range spec.SLO.Objectives {
+		window := objective.Window
+		if window <= 0 {
+			window = defaultSLOWindow
+		}
+		if max := int64(trafficStatsBuckets * trafficStatsBucketSeconds); window > max {
+			window = max
+		}
+
+		var totals trafficStatsTotals
+		if stats != nil {
+			totals = stats.totals(window, now)
+		}
+
+		c := SLOCompliance{
+			Name:             sloName(i, objective),
+			Window:           window,
+			Requests:         totals.requests,
+			LatencyThreshold: objective.LatencyThreshold,
+			LatencyTarget:    objective.LatencyTarget,
+			MaxErrorRate:     objective.MaxErrorRate,
+			Evaluated:        totals.requests > 0 && totals.requests >= objective.MinRequests,
+		}
+		if objective.LatencyThreshold > 0 {
+			c.LatencyCompliance = 100 * latencyShareUnder(totals.latencies[:], totals.requests, float64(objective.LatencyThreshold))
+		}
+		if totals.requests > 0 {
+			c.ErrorRate = 100 * float64(totals.errors) / float64(totals.requests)
+		}
+		if c.Evaluated {
+			latencyBreached := objective.LatencyThreshold > 0 && objective.LatencyTarget > 0 &&
+				c.LatencyCompliance < objective.LatencyTarget
+			errorsBreached := objective.MaxErrorRate > 0 && c.ErrorRate > objective.MaxErrorRate
+			c.Breached = latencyBreached || errorsBreached
+		}
+		report = append(report, c)
+	}
+	return report
+}
+
+// sloName names an objective by its position when it has no name.
+func sloName(i int, objective apidef.SLObjective) string {
+	if objective.Name != "" {
+		return objective.Name
+	}
+	return fmt.Sprintf("objective-%d", i)
+}
+
+// checkSLOs evaluates the objectives of the loaded APIs, and fires an
+// SLABreach event for each of those breached since the last check.
+func checkSLOs(now time.Time) {
+	apisMu.RLock()
+	specs := make([]*APISpec, 0, len(apisByID))
+	for _, spec := range apisByID {
+		if spec.SLO.Enabled {
+			specs = append(specs, spec)
+		}
+	}
+	apisMu.RUnlock()
+
+	breaches := map[sloKey]bool{}
+	for _, spec := range specs {
+		for _, c := range evaluateSLO(spec, now) {
+			key := sloKey{apiID: spec.APIID, objective: c.Name}
+
+			sloBreachesMu.Lock()
+			wasBreached := sloBreaches[key]
+			sloBreachesMu.Unlock()
+
+			if c.Breached {
+				breaches[key] = true
+			}
+			if c.Breached == wasBreached {
+				continue
+			}
+
+			logger := log.WithFields(logrus.Fields{
+				"prefix":             "slo",
+				"api_id":             spec.APIID,
+				"org_id":             spec.OrgID,
+				"objective":          c.Name,
+				"requests":           c.Requests,
+				"latency_compliance": c.LatencyCompliance,
+				"error_rate":         c.ErrorRate,
+			})
+			if !c.Breached {
+				logger.Info("Service level objective met again")
+				continue
+			}
+			logger.Warning("Service level objective breached")
+
+			fireEvent(EventSLABreach, EventSLABreachMeta{
+				EventMetaDefault: EventMetaDefault{Message: "Service level objective breached"},
+				APIID:            spec.APIID,
+				Objective:        c,
+			}, spec.EventPaths)
+		}
+	}
+
+	sloBreachesMu.Lock()
+	sloBreaches = breaches
+	sloBreachesMu.Unlock()
+}
+
+// sloMonitorLoop checks the objectives of the loaded APIs each time the
+// traffic stats move on to a new bucket.
+func sloMonitorLoop(ctx context.Context) {
+	ticker := time.NewTicker(trafficStatsBucketSeconds * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			checkSLOs(now)
+		}
+	}
+}
+
+// Get the service level objectives compliance of an API
+// Returns how the API currently does against each of its objectives, as seen
+// by this gateway.
+//
+//---
+// parameters:
+// - name: apiID
+//   in: path
+//   required: true
+//   type: string
+// responses:
+//   200:
+//     description: Compliance of the API
+//     schema:
+//       "$ref": "#/definitions/SLOReport"
+//   404:
+//     description: API not found
+//     schema:
+//       "$ref": "#/definitions/apiStatusMessage"
+func apiSLOHandler(w http.ResponseWriter, r *http.Request) {
+	apiID := mux.Vars(r)["apiID"]
+	spec := getApiSpec(apiID)
+	if spec == nil {
+		doJSONWrite(w, http.StatusNotFound, apiError("API not found"))
+		return
+	}
+	doJSONWrite(w, http.StatusOK, SLOReport{APIID: apiID, Objectives: evaluateSLO(spec, time.Now())})
+}
@@ -0,0 +1,71 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestSLO(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	spec := BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "slo"
+		spec.Proxy.ListenPath = "/"
+		spec.SLO = apidef.SLOMeta{
+			Enabled: true,
+			Objectives: []apidef.SLObjective{
+				{Name: "latency", LatencyThreshold: 100, LatencyTarget: 99},
+				{Name: "errors", MaxErrorRate: 10},
+				{MaxErrorRate: 1, MinRequests: 1000},
+			},
+		}
+	})[0]
+	defer trafficStats.Delete(spec.APIID)
+
+	events := make(chan EventSLABreachMeta, 4)
+	spec.EventPaths = map[apidef.TykEvent][]config.TykEventHandler{
+		EventSLABreach: {&testEventHandler{func(em config.EventMessage) {
+			events <- em.Meta.(EventSLABreachMeta)
+		}}},
+	}
+
+	now := time.Now()
+	for i := 0; i < 95; i++ {
+		recordTraffic(spec.APIID, http.StatusOK, 50*time.Millisecond, now)
+	}
+	for i := 0; i < 5; i++ {
+		recordTraffic(spec.APIID, http.StatusInternalServerError, 500*time.Millisecond, now)
+	}
+
+	report := evaluateSLO(spec, now)
+	assert.Len(t, report, 3)
+	assert.True(t, report[0].Breached)
+	assert.InDelta(t, 95, report[0].LatencyCompliance, 0.001)
+	assert.Equal(t, int64(defaultSLOWindow), report[0].Window)
+	assert.False(t, report[1].Breached)
+	assert.InDelta(t, 5, report[1].ErrorRate, 0.001)
+	assert.Equal(t, "objective-2", report[2].Name)
+	assert.False(t, report[2].Evaluated)
+	assert.False(t, report[2].Breached)
+
+	// only fired when the objective gets breached
+	checkSLOs(now)
+	checkSLOs(now)
+	assert.Len(t, events, 1)
+	breach := <-events
+	assert.Equal(t, spec.APIID, breach.APIID)
+	assert.Equal(t, "latency", breach.Objective.Name)
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/tyk/slo/slo", AdminAuth: true, Code: http.StatusOK, BodyMatch: `"name":"latency".*"breached":true`},
+		{Path: "/tyk/slo/unknown", AdminAuth: true, Code: http.StatusNotFound},
+	}...)
+}
@@ -0,0 +1,83 @@
+package gateway
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/request"
+)
+
+// requestTiming collects the time a request spent waiting on its upstream,
+// as measured by the proxy, and the status it was answered with. Shed tells
+// requests shed under load.
+type requestTiming struct {
+	Upstream time.Duration
+	Status   int
+	Shed     bool
+}
+
+// withRequestTiming returns the timing of a request, adding it to the request
+// context if it isn't there yet.
+func withRequestTiming(r *http.Request) *requestTiming {
+	if timing := ctxGetRequestTiming(r); timing != nil {
+		return timing
+	}
+	timing := &requestTiming{}
+	ctxSetRequestTiming(r, timing)
+	return timing
+}
+
+// slowRequestHandler times the requests of an API and reports those slower
+// than its thresholds.
+func slowRequestHandler(spec *APISpec, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timing := withRequestTiming(r)
+
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		reportSlowRequest(spec, r, time.Since(start), timing.Upstream)
+	})
+}
+
+// reportSlowRequest logs a warning and fires a SlowRequest event if a request
+// exceeded a threshold of its API.
+func reportSlowRequest(spec *APISpec, r *http.Request, total, upstream time.Duration) {
+	conf := spec.SlowRequests
+	totalMs := int64(DurationToMillisecond(total))
+	upstreamMs := int64(DurationToMillisecond(upstream))
+
+	slow := conf.Threshold > 0 && totalMs > conf.Threshold
+	slowUpstream := conf.UpstreamThreshold > 0 && upstreamMs > conf.UpstreamThreshold
+	if !slow && !slowUpstream {
+		return
+	}
+
+	gatewayMs := totalMs - upstreamMs
+	if gatewayMs < 0 {
+		gatewayMs = 0
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix":      "slow-request",
+		"api_id":      spec.APIID,
+		"org_id":      spec.OrgID,
+		"method":      r.Method,
+		"path":        r.URL.Path,
+		"total_ms":    totalMs,
+		"upstream_ms": upstreamMs,
+		"gateway_ms":  gatewayMs,
+	}).Warning("Request exceeded the latency threshold")
+
+	fireEvent(EventSlowRequest, EventSlowRequestMeta{
+		EventMetaDefault: EventMetaDefault{Message: "Request exceeded the latency threshold", OriginatingRequest: EncodeRequestToEvent(r)},
+		Path:             r.URL.Path,
+		Method:           r.Method,
+		Origin:           request.RealIP(r),
+		APIID:            spec.APIID,
+		Total:            totalMs,
+		Upstream:         upstreamMs,
+		Gateway:          gatewayMs,
+	}, spec.EventPaths)
+}
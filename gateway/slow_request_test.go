@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestSlowRequests(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+	defer upstream.Close()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	spec := BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "slow"
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.SlowRequests = apidef.SlowRequestsMeta{
+			Enabled:           true,
+			UpstreamThreshold: 20,
+		}
+	})[0]
+
+	events := make(chan EventSlowRequestMeta, 4)
+	spec.EventPaths = map[apidef.TykEvent][]config.TykEventHandler{
+		EventSlowRequest: {&testEventHandler{func(em config.EventMessage) {
+			events <- em.Meta.(EventSlowRequestMeta)
+		}}},
+	}
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/fast", Code: http.StatusOK},
+		{Path: "/slow", Code: http.StatusOK},
+	}...)
+
+	select {
+	case meta := <-events:
+		if meta.Path != "/slow" || meta.APIID != "slow" {
+			t.Errorf("Expected the event of the slow request, got: %+v", meta)
+		}
+		if meta.Upstream < 50 || meta.Total < meta.Upstream || meta.Gateway != meta.Total-meta.Upstream {
+			t.Errorf("Wrong timing breakdown: %+v", meta)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a SlowRequest event")
+	}
+	select {
+	case meta := <-events:
+		t.Errorf("Expected a single event, got one for: %s", meta.Path)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,41 @@
+package gateway
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+// strictHeadersExempt reports whether a header is required to proxy the
+// message and must be kept regardless of the allow list.
+func strictHeadersExempt(name string, upgrade bool) bool {
+	for _, h := range hopHeaders {
+		if name == h {
+			return true
+		}
+	}
+
+	switch name {
+	case headers.ContentType, headers.ContentLength, headers.ContentEncoding:
+		return true
+	}
+
+	return upgrade && strings.HasPrefix(name, "Sec-Websocket-")
+}
+
+// filterHeaders removes the headers which are neither allowed nor exempt.
+func filterHeaders(h http.Header, allowed []string, upgrade bool) {
+	keep := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		keep[http.CanonicalHeaderKey(name)] = true
+	}
+
+	for name := range h {
+		canonical := http.CanonicalHeaderKey(name)
+		if keep[canonical] || strictHeadersExempt(canonical, upgrade) {
+			continue
+		}
+		delete(h, name)
+	}
+}
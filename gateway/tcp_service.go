@@ -0,0 +1,133 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	cache "github.com/pmylund/go-cache"
+
+	"github.com/TykTechnologies/tyk/tcp"
+)
+
+// ipListContains reports whether ip matches one of the IPs or CIDR ranges of
+// list.
+func ipListContains(list []string, ip net.IP) bool {
+	for _, entry := range list {
+		// Might be CIDR, try this one first then fallback to IP parsing later
+		listedIP, listedNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			listedIP = net.ParseIP(entry)
+		}
+
+		if listedNet != nil && listedNet.Contains(ip) {
+			return true
+		}
+		if listedIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeTCPClient applies the access rules of a TCP or TLS service to a
+// client connection: the IP whitelist and blacklist, and the client
+// certificates if mutual TLS is enabled. The source of the connection is the
+// one given by the PROXY protocol header if the service accepts it.
+func authorizeTCPClient(spec *APISpec, conn net.Conn) error {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+	remoteIP := net.ParseIP(host)
+
+	if spec.EnableIpWhiteListing && len(spec.AllowedIPs) > 0 && !ipListContains(spec.AllowedIPs, remoteIP) {
+		return errors.New("Access from this IP has been disallowed: " + host)
+	}
+	if spec.EnableIpBlacklisting && ipListContains(spec.BlacklistedIPs, remoteIP) {
+		return errors.New("Access from this IP has been disallowed: " + host)
+	}
+
+	if spec.UseMutualTLSAuth {
+		tlsConn, ok := conn.(*tls.Conn)
+		if !ok {
+			return errors.New("TLS not enabled")
+		}
+		state := tlsConn.ConnectionState()
+		certIDs := append(spec.ClientCertificates, spec.GlobalConfig.Security.Certificates.API...)
+		if err := CertificateManager.ValidateConnectionCertificate(certIDs, &state); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tcpServiceTarget returns how a TCP, TLS or UDP service picks the target of
+// each new connection when load balancing or service discovery is enabled,
+// and nil otherwise. As for HTTP services, load balanced targets are picked
+// round robin, skipping the ones failing uptime tests if
+// check_host_against_uptime_tests is enabled; a target listed several times
+// gets as many shares of the connections. Targets without a scheme use the
+// one of the service: tcp for TCP and TLS services, udp for UDP services.
+func tcpServiceTarget(spec *APISpec) func() (string, error) {
+	if !spec.Proxy.EnableLoadBalancing && !spec.Proxy.ServiceDiscovery.UseDiscoveryService {
+		return nil
+	}
+
+	if spec.Proxy.ServiceDiscovery.UseDiscoveryService {
+		log.Debug("[PROXY] Service discovery enabled")
+		if ServiceCache == nil {
+			log.Debug("[PROXY] Service cache initialising")
+			expiry := 120
+			if spec.Proxy.ServiceDiscovery.CacheTimeout > 0 {
+				expiry = int(spec.Proxy.ServiceDiscovery.CacheTimeout)
+			} else if spec.GlobalConfig.ServiceDiscovery.DefaultCacheTimeout > 0 {
+				expiry = spec.GlobalConfig.ServiceDiscovery.DefaultCacheTimeout
+			}
+			ServiceCache = cache.New(time.Duration(expiry)*time.Second, 15*time.Second)
+		}
+	}
+
+	scheme := "tcp"
+	if spec.Protocol == "udp" {
+		scheme = "udp"
+	}
+
+	return func() (string, error) {
+		hostList := spec.Proxy.StructuredTargetList
+		if spec.Proxy.ServiceDiscovery.UseDiscoveryService {
+			var err error
+			hostList, err = urlFromService(spec)
+			if err != nil {
+				log.Error("[PROXY] [SERVICE DISCOVERY] Failed target lookup: ", err)
+				return "", err
+			}
+			log.Debug("[PROXY] [SERVICE DISCOVERY] received host list ", hostList.All())
+		}
+
+		host, err := nextTarget(hostList, spec)
+		if err != nil {
+			log.Error("[PROXY] [LOAD BALANCING] ", err)
+			return "", err
+		}
+		if !strings.Contains(host, "://") {
+			host = scheme + "://" + host
+		}
+		return host, nil
+	}
+}
+
+// tcpServiceModifier returns the access rules, upstream PROXY protocol
+// settings and target selection of a TCP, TLS or UDP service.
+func tcpServiceModifier(spec *APISpec) *tcp.Modifier {
+	return &tcp.Modifier{
+		Authorize: func(conn net.Conn) error {
+			return authorizeTCPClient(spec, conn)
+		},
+		ProxyProtocol: spec.Proxy.UpstreamProxyProtocol,
+		Target:        tcpServiceTarget(spec),
+	}
+}
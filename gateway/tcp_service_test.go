@@ -0,0 +1,328 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	proxyproto "github.com/pires/go-proxyproto"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+// listenSourceIP replies to each message with the source IP of the
+// connection, read from the PROXY protocol header if there is one.
+func listenSourceIP(ls net.Listener) {
+	for {
+		raw, err := ls.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			conn := proxyproto.NewConn(raw, time.Second)
+			defer conn.Close()
+
+			recv := make([]byte, 4)
+			if _, err := conn.Read(recv); err != nil {
+				return
+			}
+			host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+			conn.Write([]byte(host))
+		}()
+	}
+}
+
+// dialTCPService sends ping to a TCP or TLS service, preceded by a PROXY
+// protocol header with the given source IP, and returns the reply.
+func dialTCPService(t *testing.T, addr, sourceIP string, tlsConfig *tls.Config) string {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+
+	header := &proxyproto.Header{
+		Version:            1,
+		Command:            proxyproto.PROXY,
+		TransportProtocol:  proxyproto.TCPv4,
+		SourceAddress:      net.ParseIP(sourceIP).To4(),
+		SourcePort:         1234,
+		DestinationAddress: net.ParseIP("127.0.0.1").To4(),
+		DestinationPort:    443,
+	}
+	if _, err := header.WriteTo(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	if tlsConfig != nil {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		return err.Error()
+	}
+	recv := make([]byte, 64)
+	// The reply may come along with the end of the stream
+	n, err := conn.Read(recv)
+	if n == 0 && err != nil {
+		return err.Error()
+	}
+	return string(recv[:n])
+}
+
+func TestTCPServiceProxyProtocol(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	go listenSourceIP(upstream)
+
+	ts := StartTest()
+	defer ts.Close()
+
+	port, err := getUnusedPort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	EnablePort(port, "tcp")
+	defer ResetTestConfig()
+	addr := "127.0.0.1:" + strconv.Itoa(port)
+
+	loadService := func(modify func(spec *APISpec)) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/"
+			spec.Protocol = "tcp"
+			spec.ListenPort = port
+			spec.EnableProxyProtocol = true
+			spec.Proxy.TargetURL = upstream.Addr().String()
+			spec.Proxy.UpstreamProxyProtocol = 2
+			if modify != nil {
+				modify(spec)
+			}
+		})
+	}
+
+	loadService(nil)
+	if got := dialTCPService(t, addr, "10.1.2.3", nil); got != "10.1.2.3" {
+		t.Errorf("Expected the upstream to see the client IP, got: %s", got)
+	}
+
+	loadService(func(spec *APISpec) {
+		spec.EnableIpBlacklisting = true
+		spec.BlacklistedIPs = []string{"10.1.0.0/16"}
+	})
+	if got := dialTCPService(t, addr, "10.1.2.3", nil); got == "10.1.2.3" {
+		t.Error("Expected blacklisted IP to be rejected")
+	}
+	if got := dialTCPService(t, addr, "10.2.2.3", nil); got != "10.2.2.3" {
+		t.Errorf("Expected IP outside of the blacklist to be allowed, got: %s", got)
+	}
+
+	loadService(func(spec *APISpec) {
+		spec.EnableIpWhiteListing = true
+		spec.AllowedIPs = []string{"10.1.2.3"}
+	})
+	if got := dialTCPService(t, addr, "10.1.2.3", nil); got != "10.1.2.3" {
+		t.Errorf("Expected whitelisted IP to be allowed, got: %s", got)
+	}
+	if got := dialTCPService(t, addr, "10.1.2.4", nil); got == "10.1.2.4" {
+		t.Error("Expected IP outside of the whitelist to be rejected")
+	}
+}
+
+func TestTLSServiceMutualTLS(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	go listenSourceIP(upstream)
+
+	_, _, combinedPEM, _ := genServerCertificate()
+	serverCertID, _ := CertificateManager.Add(combinedPEM, "")
+	defer CertificateManager.Delete(serverCertID, "")
+
+	clientCertPem, _, _, clientCert := genCertificate(&x509.Certificate{})
+	clientCertID, _ := CertificateManager.Add(clientCertPem, "")
+	defer CertificateManager.Delete(clientCertID, "")
+	_, _, _, otherCert := genCertificate(&x509.Certificate{})
+
+	port, err := getUnusedPort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	globalConf := config.Global()
+	globalConf.HttpServerOptions.SSLCertificates = []string{serverCertID}
+	config.SetGlobal(globalConf)
+	EnablePort(port, "tls")
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Protocol = "tls"
+		spec.ListenPort = port
+		spec.EnableProxyProtocol = true
+		spec.UseMutualTLSAuth = true
+		spec.ClientCertificates = []string{clientCertID}
+		spec.Proxy.TargetURL = upstream.Addr().String()
+		spec.Proxy.UpstreamProxyProtocol = 1
+	})
+	addr := "127.0.0.1:" + strconv.Itoa(port)
+
+	tlsConfig := func(cert tls.Certificate) *tls.Config {
+		return &tls.Config{
+			Certificates:       []tls.Certificate{cert},
+			InsecureSkipVerify: true,
+			MaxVersion:         tls.VersionTLS12,
+		}
+	}
+
+	if got := dialTCPService(t, addr, "10.1.2.3", tlsConfig(clientCert)); got != "10.1.2.3" {
+		t.Errorf("Expected allowed client certificate to connect, got: %s", got)
+	}
+	if got := dialTCPService(t, addr, "10.1.2.3", tlsConfig(otherCert)); got == "10.1.2.3" {
+		t.Error("Expected unknown client certificate to be rejected")
+	}
+}
+
+// pingService sends ping to a TCP or UDP service and returns the reply.
+func pingService(t *testing.T, network, addr string) string {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		return err.Error()
+	}
+	recv := make([]byte, 64)
+	n, err := conn.Read(recv)
+	if n == 0 && err != nil {
+		return err.Error()
+	}
+	return string(recv[:n])
+}
+
+func TestTCPServiceLoadBalancing(t *testing.T) {
+	first := test.TcpMock(false, func(in []byte, err error) (out []byte) {
+		return []byte("first")
+	})
+	defer first.Close()
+	second := test.TcpMock(false, func(in []byte, err error) (out []byte) {
+		return []byte("second")
+	})
+	defer second.Close()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	port, err := getUnusedPort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	EnablePort(port, "tcp")
+	defer ResetTestConfig()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Protocol = "tcp"
+		spec.ListenPort = port
+		spec.Proxy.EnableLoadBalancing = true
+		// The first target gets twice as many connections
+		spec.Proxy.Targets = []string{
+			first.Addr().String(),
+			"tcp://" + first.Addr().String(),
+			second.Addr().String(),
+		}
+	})
+
+	addr := "127.0.0.1:" + strconv.Itoa(port)
+	var result []string
+	for i := 0; i < 6; i++ {
+		result = append(result, pingService(t, "tcp", addr))
+	}
+	expect := []string{"first", "first", "second", "first", "first", "second"}
+	if !reflect.DeepEqual(result, expect) {
+		t.Errorf("Expected %v, got %v", expect, result)
+	}
+}
+
+// listenUDP replies to each datagram with the given payload
+func listenUDP(t *testing.T, reply string) net.PacketConn {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			_, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo([]byte(reply), addr)
+		}
+	}()
+	return pc
+}
+
+func TestUDPService(t *testing.T) {
+	first := listenUDP(t, "first")
+	defer first.Close()
+	second := listenUDP(t, "second")
+	defer second.Close()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	port, err := getUnusedPort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	EnablePort(port, "udp")
+	defer ResetTestConfig()
+	addr := "127.0.0.1:" + strconv.Itoa(port)
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Protocol = "udp"
+		spec.ListenPort = port
+		spec.Proxy.TargetURL = first.LocalAddr().String()
+	})
+
+	if got := pingService(t, "udp", addr); got != "first" {
+		t.Errorf("Expected the target to reply, got: %s", got)
+	}
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Protocol = "udp"
+		spec.ListenPort = port
+		spec.Proxy.EnableLoadBalancing = true
+		spec.Proxy.Targets = []string{
+			"udp://" + first.LocalAddr().String(),
+			second.LocalAddr().String(),
+		}
+	})
+
+	var result []string
+	for i := 0; i < 4; i++ {
+		result = append(result, pingService(t, "udp", addr))
+	}
+	expect := []string{"first", "second", "first", "second"}
+	if !reflect.DeepEqual(result, expect) {
+		t.Errorf("Expected %v, got %v", expect, result)
+	}
+}
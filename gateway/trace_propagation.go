@@ -0,0 +1,68 @@
+package gateway
+
+import (
+	"net/http"
+	"sync"
+
+	opentracing "github.com/opentracing/opentracing-go"
+
+	"github.com/TykTechnologies/tyk/trace"
+)
+
+// tracePropagationFormats returns the trace context formats of names, nil if
+// one of them is not supported.
+func tracePropagationFormats(names []string) []trace.Format {
+	formats, ok := trace.ParseFormats(names)
+	if !ok {
+		log.WithField("formats", names).Warning("Unsupported trace propagation format, using the format of the tracer")
+		return nil
+	}
+	return formats
+}
+
+// traceHeaders are the headers the context of a span is injected in before
+// converting it to the outbound formats of an API.
+var traceHeaders = sync.Pool{
+	New: func() interface{} {
+		return http.Header{}
+	},
+}
+
+// propagateTraceContext sets the trace context headers of the upstream request
+// of req. With tracing enabled, the context of the span of req is sent in the
+// outbound formats of the API, or in the format of the tracer if there are
+// none. Otherwise, the context received in one of the inbound formats is
+// converted to the outbound ones.
+func propagateTraceContext(spec *APISpec, req *http.Request, h http.Header) {
+	outbound := tracePropagationFormats(spec.TracePropagation.Outbound)
+
+	if trace.IsEnabled() {
+		span := opentracing.SpanFromContext(req.Context())
+		if len(outbound) == 0 {
+			trace.Inject(spec.Name, span, h)
+			return
+		}
+
+		native := traceHeaders.Get().(http.Header)
+		trace.Inject(spec.Name, span, native)
+		pc, ok := trace.ExtractFormat(native, trace.Formats...)
+		for k := range native {
+			delete(native, k)
+		}
+		traceHeaders.Put(native)
+		if ok {
+			trace.ClearFormats(h)
+			trace.InjectFormat(h, pc, outbound...)
+			return
+		}
+	}
+
+	if len(outbound) == 0 {
+		return
+	}
+	inbound := tracePropagationFormats(spec.TracePropagation.Inbound)
+	if len(inbound) == 0 {
+		inbound = trace.Formats
+	}
+	trace.ConvertFormat(h, inbound, outbound)
+}
@@ -0,0 +1,42 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestTracePropagationConversion(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	b3Headers := map[string]string{
+		"X-B3-TraceId": "463ac35c9f6413ad48485a3953bb6124",
+		"X-B3-SpanId":  "a2fb4a1d1a96d312",
+		"X-B3-Sampled": "1",
+	}
+	traceparent := `"Traceparent":"00-463ac35c9f6413ad48485a3953bb6124-a2fb4a1d1a96d312-01"`
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "converted"
+		spec.Proxy.ListenPath = "/converted/"
+		spec.TracePropagation.Inbound = []string{"b3"}
+		spec.TracePropagation.Outbound = []string{"w3c"}
+	}, func(spec *APISpec) {
+		spec.APIID = "forwarded"
+		spec.Proxy.ListenPath = "/forwarded/"
+	}, func(spec *APISpec) {
+		spec.APIID = "other-inbound"
+		spec.Proxy.ListenPath = "/other-inbound/"
+		spec.TracePropagation.Inbound = []string{"jaeger"}
+		spec.TracePropagation.Outbound = []string{"w3c"}
+	})
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/converted/", Headers: b3Headers, Code: 200, BodyMatch: traceparent},
+		{Path: "/converted/", Headers: b3Headers, Code: 200, BodyNotMatch: `X-B3-`},
+		{Path: "/forwarded/", Headers: b3Headers, Code: 200, BodyMatch: `"X-B3-Traceid":"463ac35c9f6413ad48485a3953bb6124"`},
+		{Path: "/forwarded/", Headers: b3Headers, Code: 200, BodyNotMatch: `Traceparent`},
+		{Path: "/other-inbound/", Headers: b3Headers, Code: 200, BodyMatch: `"X-B3-Traceid":"463ac35c9f6413ad48485a3953bb6124"`},
+	}...)
+}
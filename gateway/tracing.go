@@ -3,6 +3,7 @@ package gateway
 import (
 	"bytes"
 	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/http/httputil"
@@ -12,7 +13,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/TykTechnologies/tyk/apidef"
-	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
 )
 
 type traceHttpRequest struct {
@@ -28,9 +29,9 @@ func (tr *traceHttpRequest) toRequest() (*http.Request, error) {
 		return nil, err
 	}
 
-	ignoreCanonical := config.Global().IgnoreCanonicalMIMEHeaderKey
+	casing := globalHeaderCasing()
 	for key, values := range tr.Headers {
-		addCustomHeader(r.Header, key, values, ignoreCanonical)
+		addCustomHeader(r.Header, key, values, casing)
 	}
 
 	ctxSetTrace(r)
@@ -45,12 +46,30 @@ type traceRequest struct {
 	Spec    *apidef.APIDefinition `json:"spec"`
 }
 
+// apiTraceRequest is for tracing an HTTP request against a loaded API
+// swagger:model apiTraceRequest
+type apiTraceRequest struct {
+	traceHttpRequest
+	// Key is sent in the auth header configured for the API
+	Key string `json:"key"`
+}
+
 // TraceResponse is for tracing an HTTP response
 // swagger:model TraceResponse
 type traceResponse struct {
-	Message  string `json:"message"`
-	Response string `json:"response"`
-	Logs     string `json:"logs"`
+	Message  string      `json:"message"`
+	Response string      `json:"response"`
+	Logs     string      `json:"logs"`
+	Steps    []traceStep `json:"steps,omitempty"`
+}
+
+// traceStep describes the outcome of a single middleware
+type traceStep struct {
+	Middleware string `json:"middleware"`
+	Code       int    `json:"code"`
+	Error      string `json:"error,omitempty"`
+	// Duration of the middleware execution in nanoseconds
+	Duration int64 `json:"ns"`
 }
 
 // Tracing request
@@ -105,6 +124,125 @@ func traceHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tr, err := traceReq.Request.toRequest()
+	if err != nil {
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Unexpected failure: "+err.Error()))
+		return
+	}
+
+	code, resp := runTrace(traceReq.Spec, tr, false)
+	doJSONWrite(w, code, resp)
+}
+
+// Tracing request against a loaded API
+// Sends a synthetic request through the middleware chain of a loaded API,
+// replacing its upstream with a stub which echoes the proxied request.
+// Rate limits and quotas aren't counted.
+//
+//---
+// requestBody:
+//   content:
+//     application/json:
+//       schema:
+//         "$ref": "#/definitions/apiTraceRequest"
+//       examples:
+//         method: GET
+//         path: /get
+//         key: my-key
+// responses:
+//   200:
+//     description: Success tracing request
+//     schema:
+//       "$ref": "#/definitions/traceResponse"
+//   404:
+//     description: API not found
+func apiTraceHandler(w http.ResponseWriter, r *http.Request) {
+	apiID := mux.Vars(r)["apiID"]
+
+	spec := getApiSpec(apiID)
+	if spec == nil {
+		doJSONWrite(w, http.StatusNotFound, apiError("API not found"))
+		return
+	}
+
+	var traceReq apiTraceRequest
+	if err := json.NewDecoder(r.Body).Decode(&traceReq); err != nil {
+		log.Error("Couldn't decode trace request: ", err)
+
+		doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+		return
+	}
+
+	// work on a copy so the loaded API is left untouched, made from the
+	// definition as it was loaded as the spec may be updated meanwhile
+	var def apidef.APIDefinition
+	defBytes, err := json.Marshal(spec.storedDefinition())
+	if err == nil {
+		err = json.Unmarshal(defBytes, &def)
+	}
+	if err != nil {
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Unexpected failure: "+err.Error()))
+		return
+	}
+
+	upstream := httptest.NewServer(http.HandlerFunc(traceUpstreamHandler))
+	defer upstream.Close()
+
+	def.Proxy.TargetURL = upstream.URL
+	def.Proxy.EnableLoadBalancing = false
+	def.Proxy.ServiceDiscovery.UseDiscoveryService = false
+	// the copy keeps the ID of the API, so it mustn't write to its cache,
+	// analytics or stored responses
+	def.CacheOptions.EnableCache = false
+	def.DoNotTrack = true
+	for name, version := range def.VersionData.Versions {
+		version.OverrideTarget = ""
+		version.ExtendedPaths.Cached = nil
+		version.ExtendedPaths.AdvanceCacheConfig = nil
+		version.ExtendedPaths.Idempotency = nil
+		version.ExtendedPaths.Fallback = nil
+		def.VersionData.Versions[name] = version
+	}
+	// the key is a real one, whose allowance isn't used up by tracing
+	def.DisableRateLimit = true
+	def.DisableQuota = true
+
+	tr, err := traceReq.toRequest()
+	if err != nil {
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Unexpected failure: "+err.Error()))
+		return
+	}
+
+	if traceReq.Key != "" {
+		authHeader := def.AuthConfigs[authTokenType].AuthHeaderName
+		if authHeader == "" {
+			authHeader = def.Auth.AuthHeaderName
+		}
+		if authHeader == "" {
+			authHeader = headers.Authorization
+		}
+		tr.Header.Set(authHeader, traceReq.Key)
+	}
+
+	code, resp := runTrace(&def, tr, true)
+	doJSONWrite(w, code, resp)
+}
+
+// traceUpstreamHandler stands in for the upstream of a traced API and
+// responds with the request it received.
+func traceUpstreamHandler(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	doJSONWrite(w, http.StatusOK, traceHttpRequest{
+		Method:  r.Method,
+		Path:    r.URL.RequestURI(),
+		Body:    string(body),
+		Headers: r.Header,
+	})
+}
+
+// runTrace sends tr through the middleware chain of def. With
+// skipOrgQuota, the quota of the organisation isn't counted.
+func runTrace(def *apidef.APIDefinition, tr *http.Request, skipOrgQuota bool) (int, traceResponse) {
 	var logStorage bytes.Buffer
 	logger := logrus.New()
 	logger.Formatter = &logrus.JSONFormatter{}
@@ -115,22 +253,20 @@ func traceHandler(w http.ResponseWriter, r *http.Request) {
 	subrouter := mux.NewRouter()
 
 	loader := &APIDefinitionLoader{}
-	spec := loader.MakeSpec(traceReq.Spec, logrus.NewEntry(logger))
+	spec := loader.MakeSpec(def, logrus.NewEntry(logger))
+	spec.tracing = true
+	if skipOrgQuota {
+		spec.GlobalConfig.EnforceOrgQuotas = false
+	}
 
 	chainObj := processSpec(spec, nil, &gs, subrouter, logrus.NewEntry(logger))
 	spec.middlewareChain = chainObj
 
 	if chainObj.ThisHandler == nil {
-		doJSONWrite(w, http.StatusBadRequest, traceResponse{Message: "error", Logs: logStorage.String()})
-		return
+		return http.StatusBadRequest, traceResponse{Message: "error", Logs: logStorage.String()}
 	}
 
 	wr := httptest.NewRecorder()
-	tr, err := traceReq.Request.toRequest()
-	if err != nil {
-		doJSONWrite(w, http.StatusInternalServerError, apiError("Unexpected failure: "+err.Error()))
-		return
-	}
 	nopCloseRequestBody(tr)
 	chainObj.ThisHandler.ServeHTTP(wr, tr)
 
@@ -150,5 +286,42 @@ func traceHandler(w http.ResponseWriter, r *http.Request) {
 
 	requestDump := "====== Request ======\n" + request + "\n====== Response ======\n" + response
 
-	doJSONWrite(w, http.StatusOK, traceResponse{Message: "ok", Response: requestDump, Logs: logStorage.String()})
+	return http.StatusOK, traceResponse{
+		Message:  "ok",
+		Response: requestDump,
+		Logs:     logStorage.String(),
+		Steps:    traceSteps(logStorage.Bytes()),
+	}
+}
+
+// traceSteps extracts the outcome of every executed middleware from the
+// JSON formatted trace logs.
+func traceSteps(logs []byte) []traceStep {
+	var steps []traceStep
+
+	dec := json.NewDecoder(bytes.NewReader(logs))
+	for dec.More() {
+		var entry struct {
+			Middleware string  `json:"mw"`
+			Message    string  `json:"msg"`
+			Code       int     `json:"code"`
+			Error      string  `json:"error"`
+			Duration   float64 `json:"ns"`
+		}
+		if err := dec.Decode(&entry); err != nil {
+			break
+		}
+		if entry.Middleware == "" || entry.Message != "Finished" {
+			continue
+		}
+
+		steps = append(steps, traceStep{
+			Middleware: entry.Middleware,
+			Code:       entry.Code,
+			Error:      entry.Error,
+			Duration:   int64(entry.Duration),
+		})
+	}
+
+	return steps
 }
@@ -0,0 +1,76 @@
+package gateway
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/url"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/ctx"
+)
+
+// parseTrafficSplitTarget parses the upstream URL of a traffic split rule.
+func parseTrafficSplitTarget(target string) (*url.URL, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, errors.New("target must be an absolute URL")
+	}
+	return u, nil
+}
+
+// trafficSplitMatches reports whether a request matches the conditions of a
+// traffic split rule.
+func trafficSplitMatches(rule *apidef.TrafficSplitRule, r *http.Request) bool {
+	if rule.Header != "" {
+		value := r.Header.Get(rule.Header)
+		if value == "" || (rule.Value != "" && value != rule.Value) {
+			return false
+		}
+	}
+	if rule.Cookie != "" {
+		cookie, err := r.Cookie(rule.Cookie)
+		if err != nil || (rule.Value != "" && cookie.Value != rule.Value) {
+			return false
+		}
+	}
+	if rule.Percentage > 0 && rand.Float64()*100 >= rule.Percentage {
+		return false
+	}
+	return true
+}
+
+// trafficSplitTarget returns the upstream of the first traffic split rule of
+// an API matching a request, nil if none does. The variant of the rule is
+// set on the request. The rules whose target couldn't be parsed when the API
+// was loaded are left out.
+func trafficSplitTarget(spec *APISpec, r *http.Request) *url.URL {
+	for i := range spec.TrafficSplit {
+		rule := &spec.TrafficSplit[i]
+		var target *url.URL
+		if i < len(spec.trafficSplitTargets) {
+			target = spec.trafficSplitTargets[i]
+		}
+		if target == nil || !trafficSplitMatches(rule, r) {
+			continue
+		}
+		ctxSetTrafficSplitVariant(r, rule.Variant)
+		return target
+	}
+	return nil
+}
+
+// tagTrafficSplitVariant tags the analytics of a request with the traffic
+// split variant the director chose for its outbound request.
+func tagTrafficSplitVariant(outreq *http.Request, requests ...*http.Request) {
+	variant := ctxGetTrafficSplitVariant(outreq)
+	if variant == "" {
+		return
+	}
+	for _, r := range requests {
+		ctx.AddAnalyticsTags(r, "variant-"+variant)
+	}
+}
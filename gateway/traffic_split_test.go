@@ -0,0 +1,106 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/ctx"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestTrafficSplitMatches(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Beta", "true")
+	r.AddCookie(&http.Cookie{Name: "group", Value: "b"})
+
+	tests := []struct {
+		rule    apidef.TrafficSplitRule
+		matches bool
+	}{
+		{apidef.TrafficSplitRule{}, true},
+		{apidef.TrafficSplitRule{Header: "X-Beta"}, true},
+		{apidef.TrafficSplitRule{Header: "X-Beta", Value: "true"}, true},
+		{apidef.TrafficSplitRule{Header: "X-Beta", Value: "false"}, false},
+		{apidef.TrafficSplitRule{Header: "X-Other"}, false},
+		{apidef.TrafficSplitRule{Cookie: "group", Value: "b"}, true},
+		{apidef.TrafficSplitRule{Cookie: "group", Value: "a"}, false},
+		{apidef.TrafficSplitRule{Cookie: "other"}, false},
+		{apidef.TrafficSplitRule{Percentage: 100}, true},
+		{apidef.TrafficSplitRule{Header: "X-Other", Percentage: 100}, false},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.matches, trafficSplitMatches(&tc.rule, r), "%+v", tc.rule)
+	}
+
+	matched := 0
+	for i := 0; i < 1000; i++ {
+		if trafficSplitMatches(&apidef.TrafficSplitRule{Percentage: 10}, r) {
+			matched++
+		}
+	}
+	assert.InDelta(t, 100, matched, 60)
+}
+
+func TestTrafficSplitVariantTag(t *testing.T) {
+	outreq := httptest.NewRequest(http.MethodGet, "/", nil)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	tagTrafficSplitVariant(outreq, r)
+	assert.Empty(t, ctx.GetAnalyticsTags(r))
+
+	ctxSetTrafficSplitVariant(outreq, "beta")
+	tagTrafficSplitVariant(outreq, r)
+	assert.Equal(t, []string{"variant-beta"}, ctx.GetAnalyticsTags(r))
+}
+
+func TestTrafficSplit(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	upstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s", name, r.URL.Path)
+		}))
+	}
+	stable, beta, canary := upstream("stable"), upstream("beta"), upstream("canary")
+	defer stable.Close()
+	defer beta.Close()
+	defer canary.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = stable.URL
+		spec.TrafficSplit = []apidef.TrafficSplitRule{
+			{Variant: "beta", Target: beta.URL + "/v2", Header: "X-Beta", Value: "true"},
+			{Variant: "canary", Target: canary.URL, Cookie: "canary"},
+		}
+	})
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/users", Code: http.StatusOK, BodyMatch: "^stable /users$"},
+		{Path: "/users", Headers: map[string]string{"X-Beta": "true"}, Code: http.StatusOK, BodyMatch: "^beta /v2/users$"},
+		{Path: "/users", Headers: map[string]string{"X-Beta": "false"}, Code: http.StatusOK, BodyMatch: "^stable /users$"},
+		{Path: "/users", Headers: map[string]string{"Cookie": "canary=1"}, Code: http.StatusOK, BodyMatch: "^canary /users$"},
+	}...)
+}
+
+func TestTrafficSplitTargets(t *testing.T) {
+	loader := APIDefinitionLoader{}
+	spec := loader.MakeSpec(&apidef.APIDefinition{TrafficSplit: []apidef.TrafficSplitRule{
+		{Variant: "relative", Target: "beta/v2"},
+		{Variant: "beta", Target: "http://beta/v2"},
+	}}, nil)
+
+	assert.Nil(t, spec.trafficSplitTargets[0])
+	assert.Equal(t, []string{`traffic split variant "relative" left out: target must be an absolute URL`}, spec.loadWarnings)
+
+	// the rule left out matches no requests
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Equal(t, "http://beta/v2", trafficSplitTarget(spec, r).String())
+	assert.Equal(t, "beta", ctxGetTrafficSplitVariant(r))
+}
@@ -0,0 +1,263 @@
+package gateway
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// trafficStatsBucketSeconds is the time span of each bucket of the
+	// sliding windows.
+	trafficStatsBucketSeconds = 10
+	// trafficStatsBuckets covers the longest window, 15 minutes.
+	trafficStatsBuckets = 15 * 60 / trafficStatsBucketSeconds
+)
+
+// trafficStatsLatencyBounds are the upper bounds, in milliseconds, of the
+// latency histogram buckets. Latencies above the last one go to an extra
+// bucket.
+var trafficStatsLatencyBounds = [...]float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000, 30000, 60000}
+
+// trafficStatsWindows are the windows reported, in seconds.
+var trafficStatsWindows = []struct {
+	name    string
+	seconds int64
+}{{"1m", 60}, {"5m", 5 * 60}, {"15m", 15 * 60}}
+
+// apiTrafficStats is the traffic of an API, in buckets of a few seconds
+// kept in a ring.
+type apiTrafficStats struct {
+	mu      sync.Mutex
+	buckets [trafficStatsBuckets]trafficStatsBucket
+}
+
+type trafficStatsBucket struct {
+	epoch        int64
+	requests     uint32
+	clientErrors uint32
+	errors       uint32
+	latencies    [len(trafficStatsLatencyBounds) + 1]uint32
+}
+
+// trafficStats holds the apiTrafficStats of APIs by ID.
+var trafficStats sync.Map
+
+// TrafficStatsWindow is the traffic of an API over a window. Rates are per
+// second, the error rate is the share of requests answered with a 5xx
+// status. Latencies are in milliseconds, approximated from a histogram.
+// swagger:model
+type TrafficStatsWindow struct {
+	Requests     uint64  `json:"requests"`
+	RequestRate  float64 `json:"request_rate"`
+	ClientErrors uint64  `json:"client_errors"`
+	Errors       uint64  `json:"errors"`
+	ErrorRate    float64 `json:"error_rate"`
+	P50          float64 `json:"p50"`
+	P95          float64 `json:"p95"`
+	P99          float64 `json:"p99"`
+}
+
+// TrafficStats is the traffic of an API over the 1m, 5m and 15m windows.
+// swagger:model
+type TrafficStats struct {
+	APIID   string                        `json:"api_id"`
+	Windows map[string]TrafficStatsWindow `json:"windows"`
+}
+
+// recordTraffic counts a request of an API answered with status after
+// latency.
+func recordTraffic(apiID string, status int, latency time.Duration, now time.Time) {
+	v, ok := trafficStats.Load(apiID)
+	if !ok {
+		v, _ = trafficStats.LoadOrStore(apiID, &apiTrafficStats{})
+	}
+	stats := v.(*apiTrafficStats)
+
+	ms := DurationToMillisecond(latency)
+	histogram := len(trafficStatsLatencyBounds)
+	for i, bound := range trafficStatsLatencyBounds {
+		if ms <= bound {
+			histogram = i
+			break
+		}
+	}
+
+	epoch := now.Unix() / trafficStatsBucketSeconds
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	b := &stats.buckets[epoch%trafficStatsBuckets]
+	if b.epoch != epoch {
+		*b = trafficStatsBucket{epoch: epoch}
+	}
+	b.requests++
+	switch {
+	case status >= 500:
+		b.errors++
+	case status >= 400:
+		b.clientErrors++
+	}
+	b.latencies[histogram]++
+}
+
+// trafficStatsTotals are the buckets of a window summed up.
+type trafficStatsTotals struct {
+	requests     uint64
+	clientErrors uint64
+	errors       uint64
+	latencies    [len(trafficStatsLatencyBounds) + 1]uint64
+}
+
+// totals sums the buckets of the last seconds.
+func (s *apiTrafficStats) totals(seconds int64, now time.Time) trafficStatsTotals {
+	epoch := now.Unix() / trafficStatsBucketSeconds
+	oldest := epoch - seconds/trafficStatsBucketSeconds
+
+	var t trafficStatsTotals
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.buckets {
+		b := &s.buckets[i]
+		if b.epoch <= oldest || b.epoch > epoch {
+			continue
+		}
+		t.requests += uint64(b.requests)
+		t.clientErrors += uint64(b.clientErrors)
+		t.errors += uint64(b.errors)
+		for j, n := range b.latencies {
+			t.latencies[j] += uint64(n)
+		}
+	}
+	return t
+}
+
+// window reports the traffic of the last seconds.
+func (s *apiTrafficStats) window(seconds int64, now time.Time) TrafficStatsWindow {
+	t := s.totals(seconds, now)
+	w := TrafficStatsWindow{
+		Requests:     t.requests,
+		RequestRate:  float64(t.requests) / float64(seconds),
+		ClientErrors: t.clientErrors,
+		Errors:       t.errors,
+		P50:          latencyPercentile(t.latencies[:], t.requests, 0.50),
+		P95:          latencyPercentile(t.latencies[:], t.requests, 0.95),
+		P99:          latencyPercentile(t.latencies[:], t.requests, 0.99),
+	}
+	if t.requests > 0 {
+		w.ErrorRate = float64(t.errors) / float64(t.requests)
+	}
+	return w
+}
+
+// latencyShareUnder estimates the share of the requests of a latency
+// histogram faster than a threshold, in milliseconds, by interpolating
+// within the bucket it falls in.
+func latencyShareUnder(histogram []uint64, total uint64, threshold float64) float64 {
+	if total == 0 {
+		return 1
+	}
+	var under float64
+	lower := 0.0
+	for i, n := range histogram {
+		if i == len(trafficStatsLatencyBounds) {
+			break
+		}
+		upper := trafficStatsLatencyBounds[i]
+		if threshold >= upper {
+			under += float64(n)
+			lower = upper
+			continue
+		}
+		under += float64(n) * (threshold - lower) / (upper - lower)
+		break
+	}
+	return under / float64(total)
+}
+
+// latencyPercentile estimates a percentile of a latency histogram, by
+// interpolating within the bucket it falls in.
+func latencyPercentile(histogram []uint64, total uint64, percentile float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	rank := percentile * float64(total)
+	var seen uint64
+	for i, n := range histogram {
+		if n == 0 || float64(seen+n) < rank {
+			seen += n
+			continue
+		}
+		if i == len(trafficStatsLatencyBounds) {
+			return trafficStatsLatencyBounds[i-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = trafficStatsLatencyBounds[i-1]
+		}
+		upper := trafficStatsLatencyBounds[i]
+		return lower + (upper-lower)*(rank-float64(seen))/float64(n)
+	}
+	return trafficStatsLatencyBounds[len(trafficStatsLatencyBounds)-1]
+}
+
+// getTrafficStats returns the traffic of an API over the reported windows.
+func getTrafficStats(apiID string, now time.Time) TrafficStats {
+	report := TrafficStats{APIID: apiID, Windows: map[string]TrafficStatsWindow{}}
+	v, ok := trafficStats.Load(apiID)
+	for _, window := range trafficStatsWindows {
+		if !ok {
+			report.Windows[window.name] = TrafficStatsWindow{}
+			continue
+		}
+		report.Windows[window.name] = v.(*apiTrafficStats).window(window.seconds, now)
+	}
+	return report
+}
+
+// trafficStatsHandler counts the requests of an API in its traffic stats.
+func trafficStatsHandler(spec *APISpec, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timing := withRequestTiming(r)
+
+		start := time.Now()
+		next.ServeHTTP(w, r)
+
+		status := timing.Status
+		if status == 0 {
+			// answered by a middleware, such as the cache or a mock
+			status = http.StatusOK
+		}
+		recordTraffic(spec.APIID, status, time.Since(start), time.Now())
+	})
+}
+
+// Get the traffic stats of an API
+// Returns the request and error rates, and latency percentiles of an API
+// over the last 1, 5 and 15 minutes, as seen by this gateway.
+//
+//---
+// parameters:
+// - name: apiID
+//   in: path
+//   required: true
+//   type: string
+// responses:
+//   200:
+//     description: Traffic stats of the API
+//     schema:
+//       "$ref": "#/definitions/TrafficStats"
+//   404:
+//     description: API not found
+//     schema:
+//       "$ref": "#/definitions/apiStatusMessage"
+func apiStatsHandler(w http.ResponseWriter, r *http.Request) {
+	apiID := mux.Vars(r)["apiID"]
+	if getApiSpec(apiID) == nil {
+		doJSONWrite(w, http.StatusNotFound, apiError("API not found"))
+		return
+	}
+	doJSONWrite(w, http.StatusOK, getTrafficStats(apiID, time.Now()))
+}
@@ -0,0 +1,107 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestTrafficStatsWindows(t *testing.T) {
+	const apiID = "traffic-stats-windows"
+	defer trafficStats.Delete(apiID)
+
+	now := time.Unix(1600000000, 0)
+	// 14 minutes ago, only in the 15m window
+	for i := 0; i < 10; i++ {
+		recordTraffic(apiID, http.StatusInternalServerError, 3*time.Second, now.Add(-14*time.Minute))
+	}
+	// 3 minutes ago, in the 5m and 15m windows
+	for i := 0; i < 10; i++ {
+		recordTraffic(apiID, http.StatusNotFound, 15*time.Millisecond, now.Add(-3*time.Minute))
+	}
+	// in all windows
+	for i := 0; i < 100; i++ {
+		recordTraffic(apiID, http.StatusOK, 15*time.Millisecond, now.Add(-10*time.Second))
+	}
+	// too old to be in any window
+	recordTraffic(apiID, http.StatusOK, time.Millisecond, now.Add(-20*time.Minute))
+
+	stats := getTrafficStats(apiID, now)
+
+	oneMinute := stats.Windows["1m"]
+	assert.Equal(t, uint64(100), oneMinute.Requests)
+	assert.InDelta(t, 100.0/60, oneMinute.RequestRate, 0.001)
+	assert.Zero(t, oneMinute.Errors)
+	assert.Zero(t, oneMinute.ErrorRate)
+	assert.InDelta(t, 15, oneMinute.P50, 0.001)
+
+	fiveMinutes := stats.Windows["5m"]
+	assert.Equal(t, uint64(110), fiveMinutes.Requests)
+	assert.Equal(t, uint64(10), fiveMinutes.ClientErrors)
+	assert.Zero(t, fiveMinutes.Errors)
+
+	fifteenMinutes := stats.Windows["15m"]
+	assert.Equal(t, uint64(120), fifteenMinutes.Requests)
+	assert.Equal(t, uint64(10), fifteenMinutes.Errors)
+	assert.InDelta(t, 10.0/120, fifteenMinutes.ErrorRate, 0.001)
+	assert.True(t, fifteenMinutes.P50 > 10 && fifteenMinutes.P50 <= 20)
+	assert.True(t, fifteenMinutes.P99 > 2000 && fifteenMinutes.P99 <= 5000)
+
+	assert.Equal(t, TrafficStatsWindow{}, getTrafficStats("unknown", now).Windows["1m"])
+}
+
+func TestLatencyPercentile(t *testing.T) {
+	histogram := make([]uint64, len(trafficStatsLatencyBounds)+1)
+	assert.Zero(t, latencyPercentile(histogram, 0, 0.5))
+
+	// all of them between 100 and 200ms
+	histogram[7] = 100
+	assert.InDelta(t, 150, latencyPercentile(histogram, 100, 0.5), 0.001)
+	assert.InDelta(t, 199, latencyPercentile(histogram, 100, 0.99), 0.001)
+
+	// above the last bound
+	histogram[len(trafficStatsLatencyBounds)] = 100
+	assert.Equal(t, trafficStatsLatencyBounds[len(trafficStatsLatencyBounds)-1], latencyPercentile(histogram, 200, 0.99))
+}
+
+func TestLatencyShareUnder(t *testing.T) {
+	histogram := make([]uint64, len(trafficStatsLatencyBounds)+1)
+	assert.Equal(t, 1.0, latencyShareUnder(histogram, 0, 100))
+
+	// all of them between 100 and 200ms
+	histogram[7] = 100
+	assert.InDelta(t, 0, latencyShareUnder(histogram, 100, 100), 0.001)
+	assert.InDelta(t, 0.5, latencyShareUnder(histogram, 100, 150), 0.001)
+	assert.InDelta(t, 1, latencyShareUnder(histogram, 100, 1000), 0.001)
+}
+
+func TestTrafficStatsEndpoint(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	spec := BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "traffic-stats"
+		spec.Proxy.ListenPath = "/"
+		spec.UseKeylessAccess = true
+	})[0]
+	defer trafficStats.Delete(spec.APIID)
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/", Code: http.StatusOK},
+		{Path: "/", Code: http.StatusOK},
+		{Path: "/tyk/stats/unknown", AdminAuth: true, Code: http.StatusNotFound},
+	}...)
+
+	resp, _ := ts.Run(t, test.TestCase{Path: "/tyk/stats/traffic-stats", AdminAuth: true, Code: http.StatusOK})
+	var stats TrafficStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint64(2), stats.Windows["1m"].Requests)
+	assert.Equal(t, uint64(2), stats.Windows["15m"].Requests)
+}
@@ -0,0 +1,68 @@
+package gateway
+
+import (
+	"net/http"
+
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// templateSession is the session of the caller, as exposed to body
+// transform templates under _tyk_session, such as
+// {{._tyk_session.MetaData.tier}} or {{range ._tyk_session.Tags}}.
+type templateSession struct {
+	MetaData map[string]interface{}
+	Tags     []string
+	Policies []string
+	OrgID    string
+	Alias    string
+}
+
+func newTemplateSession(session *user.SessionState) templateSession {
+	return templateSession{
+		MetaData: session.GetMetaData(),
+		Tags:     session.Tags,
+		Policies: session.GetPolicyIDs(),
+		OrgID:    session.OrgID,
+		Alias:    session.Alias,
+	}
+}
+
+// sessionVars are the fields of the session of the caller URL rewrites and
+// other string templates can refer to, such as $tyk_session.tags.
+func sessionVars(session *user.SessionState) map[string]interface{} {
+	if session == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"tags":     session.Tags,
+		"policies": session.GetPolicyIDs(),
+		"org_id":   session.OrgID,
+		"alias":    session.Alias,
+	}
+}
+
+// addSessionTemplateData exposes the session of the caller to a transform
+// template.
+func addSessionTemplateData(r *http.Request, bodyData map[string]interface{}) bool {
+	session := ctxGetSession(r)
+	if session == nil {
+		return false
+	}
+	bodyData["_tyk_meta"] = session.GetMetaData()
+	bodyData["_tyk_session"] = newTemplateSession(session)
+	return true
+}
+
+// forSession returns the transform for the tier of the caller, read from its
+// session metadata, or the default transform.
+func (t *TransformSpec) forSession(session *user.SessionState) *TransformSpec {
+	if len(t.Tiers) == 0 || t.TierMetadata == "" || session == nil {
+		return t
+	}
+	value, _ := session.GetMetaDataByKey(t.TierMetadata)
+	tier, _ := value.(string)
+	if tierSpec, ok := t.Tiers[tier]; ok {
+		return tierSpec
+	}
+	return t
+}
@@ -0,0 +1,85 @@
+package gateway
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+// Actions taken on requests matching no API, as reported to instrumentation.
+const (
+	unmatchedNotFound = "not_found"
+	unmatchedRespond  = "respond"
+	unmatchedRedirect = "redirect"
+	unmatchedForward  = "forward"
+)
+
+// unmatchedRequestConfig returns the response configured for requests to a
+// host matching no API, and the domain it is configured for.
+func unmatchedRequestConfig(host string) (config.UnmatchedRequestConfig, string, bool) {
+	unmatched := config.Global().UnmatchedRequests
+	if len(unmatched) == 0 {
+		return config.UnmatchedRequestConfig{}, "", false
+	}
+
+	host = strings.ToLower(host)
+	if conf, ok := unmatched[host]; ok {
+		return conf, host, true
+	}
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		if conf, ok := unmatched[hostname]; ok {
+			return conf, hostname, true
+		}
+	}
+	conf, ok := unmatched[""]
+	return conf, "", ok
+}
+
+// handleUnmatchedRequest responds to a request matching no API as configured
+// for its domain. It returns the action taken, or an empty one if there is
+// nothing configured.
+func handleUnmatchedRequest(w http.ResponseWriter, r *http.Request) (action, domain string) {
+	conf, domain, ok := unmatchedRequestConfig(r.Host)
+	if !ok {
+		return "", domain
+	}
+
+	if conf.APIID != "" {
+		if handler, found := apisHandlesByID.Load(conf.APIID); found {
+			handler.(http.Handler).ServeHTTP(w, r)
+			return unmatchedForward, domain
+		}
+		log.WithField("api_id", conf.APIID).Error("Catch-all API of unmatched requests not found")
+	}
+
+	for name, value := range conf.Headers {
+		w.Header().Set(name, value)
+	}
+
+	if conf.RedirectURL != "" {
+		code := conf.StatusCode
+		if code < 300 || code > 399 {
+			code = http.StatusFound
+		}
+		http.Redirect(w, r, conf.RedirectURL, code)
+		return unmatchedRedirect, domain
+	}
+
+	code := conf.StatusCode
+	if code == 0 {
+		code = http.StatusNotFound
+	}
+	if conf.Body == "" {
+		w.WriteHeader(code)
+		_, _ = fmt.Fprint(w, http.StatusText(code))
+		return unmatchedRespond, domain
+	}
+	w.Header().Set(headers.ContentType, headers.ApplicationJSON)
+	w.WriteHeader(code)
+	_, _ = fmt.Fprint(w, conf.Body)
+	return unmatchedRespond, domain
+}
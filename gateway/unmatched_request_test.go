@@ -0,0 +1,59 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestUnmatchedRequests(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.EnableCustomDomains = true
+	globalConf.UnmatchedRequests = map[string]config.UnmatchedRequestConfig{
+		"retired.example.com": {
+			StatusCode: http.StatusGone,
+			Body:       `{"error":"this API has been retired"}`,
+		},
+		"docs.example.com": {
+			RedirectURL: "https://example.com/docs",
+		},
+		"": {
+			APIID: "catch-all",
+		},
+	}
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "catch-all"
+		spec.Domain = "catch-all.example.com"
+		spec.Proxy.ListenPath = "/"
+	})
+
+	noRedirect := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	ts.Run(t, []test.TestCase{
+		{Domain: "retired.example.com", Path: "/v1/orders", Code: http.StatusGone,
+			BodyMatch: `this API has been retired`, HeadersMatch: map[string]string{"Content-Type": "application/json"}},
+		{Domain: "docs.example.com", Path: "/v1/orders", Code: http.StatusFound, Client: noRedirect,
+			HeadersMatch: map[string]string{"Location": "https://example.com/docs"}},
+		{Domain: "other.example.com", Path: "/v1/orders", Code: http.StatusOK, BodyMatch: `"Url":"/v1/orders"`},
+	}...)
+
+	t.Run("without configuration", func(t *testing.T) {
+		globalConf := config.Global()
+		globalConf.UnmatchedRequests = nil
+		config.SetGlobal(globalConf)
+
+		_, _ = ts.Run(t, test.TestCase{Domain: "retired.example.com", Path: "/v1/orders", Code: http.StatusNotFound})
+	})
+}
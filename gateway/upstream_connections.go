@@ -0,0 +1,186 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// upstreamConnStats counts the connections of the reverse proxy transports
+// to an upstream address, and the requests sent over them.
+type upstreamConnStats struct {
+	open              int64
+	active            int64
+	opened            int64
+	dialFailures      int64
+	handshakeFailures int64
+	http1Requests     int64
+	http2Requests     int64
+}
+
+// upstreamConns holds the upstreamConnStats of upstreams by host:port.
+var upstreamConns sync.Map
+
+func upstreamConnStatsFor(addr string) *upstreamConnStats {
+	v, ok := upstreamConns.Load(addr)
+	if !ok {
+		v, _ = upstreamConns.LoadOrStore(addr, &upstreamConnStats{})
+	}
+	return v.(*upstreamConnStats)
+}
+
+// upstreamAddr returns the host:port requests to u are sent to.
+func upstreamAddr(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	port := "80"
+	if u.Scheme == "https" || u.Scheme == "wss" {
+		port = "443"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// countedConn is an upstream connection counted as open until closed.
+type countedConn struct {
+	net.Conn
+	stats     *upstreamConnStats
+	closeOnce sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.closeOnce.Do(func() {
+		atomic.AddInt64(&c.stats.open, -1)
+	})
+	return c.Conn.Close()
+}
+
+// countConn counts the outcome of dialing addr. Errors other than dial ones
+// are from the TLS handshake.
+func countConn(addr string, conn net.Conn, err error) (net.Conn, error) {
+	stats := upstreamConnStatsFor(addr)
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			atomic.AddInt64(&stats.dialFailures, 1)
+		} else {
+			atomic.AddInt64(&stats.handshakeFailures, 1)
+		}
+		return conn, err
+	}
+	atomic.AddInt64(&stats.open, 1)
+	atomic.AddInt64(&stats.opened, 1)
+	return &countedConn{Conn: conn, stats: stats}, nil
+}
+
+// countDialContext counts the connections dialed by dial.
+func countDialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		return countConn(addr, conn, err)
+	}
+}
+
+// countDial counts the connections dialed by dial, which may include a TLS
+// handshake.
+func countDial(dial func(network, addr string) (net.Conn, error)) func(network, addr string) (net.Conn, error) {
+	return func(network, addr string) (net.Conn, error) {
+		conn, err := dial(network, addr)
+		return countConn(addr, conn, err)
+	}
+}
+
+// countRoundTrip sends r with roundTrip, counting it against its upstream
+// along with the failed TLS handshakes the transport does itself.
+func countRoundTrip(r *http.Request, roundTrip func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	stats := upstreamConnStatsFor(upstreamAddr(r.URL))
+	trace := &httptrace.ClientTrace{
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err != nil {
+				atomic.AddInt64(&stats.handshakeFailures, 1)
+			}
+		},
+	}
+	r = r.WithContext(httptrace.WithClientTrace(r.Context(), trace))
+
+	atomic.AddInt64(&stats.active, 1)
+	res, err := roundTrip(r)
+	atomic.AddInt64(&stats.active, -1)
+	if err != nil {
+		return res, err
+	}
+	if res.ProtoMajor == 2 {
+		atomic.AddInt64(&stats.http2Requests, 1)
+	} else {
+		atomic.AddInt64(&stats.http1Requests, 1)
+	}
+	return res, nil
+}
+
+// UpstreamConnections summarizes the connections of the reverse proxy
+// transports of this node to an upstream host. Idle is an estimate, the open
+// connections less the requests awaiting a response, as HTTP/2 ones share a
+// connection.
+// swagger:model
+type UpstreamConnections struct {
+	Host              string `json:"host"`
+	Open              int64  `json:"open"`
+	Idle              int64  `json:"idle"`
+	Active            int64  `json:"active"`
+	Opened            int64  `json:"opened"`
+	DialFailures      int64  `json:"dial_failures"`
+	HandshakeFailures int64  `json:"handshake_failures"`
+	HTTP1Requests     int64  `json:"http1_requests"`
+	HTTP2Requests     int64  `json:"http2_requests"`
+}
+
+// getUpstreamConnections returns the connections to upstreams by host.
+func getUpstreamConnections() []UpstreamConnections {
+	report := []UpstreamConnections{}
+	upstreamConns.Range(func(k, v interface{}) bool {
+		stats := v.(*upstreamConnStats)
+		c := UpstreamConnections{
+			Host:              k.(string),
+			Open:              atomic.LoadInt64(&stats.open),
+			Active:            atomic.LoadInt64(&stats.active),
+			Opened:            atomic.LoadInt64(&stats.opened),
+			DialFailures:      atomic.LoadInt64(&stats.dialFailures),
+			HandshakeFailures: atomic.LoadInt64(&stats.handshakeFailures),
+			HTTP1Requests:     atomic.LoadInt64(&stats.http1Requests),
+			HTTP2Requests:     atomic.LoadInt64(&stats.http2Requests),
+		}
+		if c.Idle = c.Open - c.Active; c.Idle < 0 {
+			c.Idle = 0
+		}
+		report = append(report, c)
+		return true
+	})
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Host < report[j].Host
+	})
+	return report
+}
+
+// Get the upstream connections
+// Returns the open and idle connections of the reverse proxy to each
+// upstream host, failed dials and TLS handshakes, and the requests sent over
+// HTTP/1 and HTTP/2, since the node started.
+//
+//---
+// responses:
+//   200:
+//     description: Connections by upstream host
+//     schema:
+//       type: array
+//       items:
+//         "$ref": "#/definitions/UpstreamConnections"
+func upstreamConnectionsHandler(w http.ResponseWriter, r *http.Request) {
+	doJSONWrite(w, http.StatusOK, getUpstreamConnections())
+}
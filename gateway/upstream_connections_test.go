@@ -0,0 +1,88 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestUpstreamAddr(t *testing.T) {
+	for raw, addr := range map[string]string{
+		"http://upstream":       "upstream:80",
+		"https://upstream":      "upstream:443",
+		"wss://upstream":        "upstream:443",
+		"http://upstream:8080":  "upstream:8080",
+		"https://[::1]/path":    "[::1]:443",
+		"https://[::1]:8443/pa": "[::1]:8443",
+	} {
+		u, _ := url.Parse(raw)
+		assert.Equal(t, addr, upstreamAddr(u), raw)
+	}
+}
+
+func TestCountConn(t *testing.T) {
+	const addr = "count-conn:443"
+	defer upstreamConns.Delete(addr)
+	stats := upstreamConnStatsFor(addr)
+
+	_, _ = countConn(addr, nil, &net.OpError{Op: "dial", Err: errors.New("connection refused")})
+	_, _ = countConn(addr, nil, errors.New("tls: handshake failure"))
+	assert.Equal(t, int64(1), stats.dialFailures)
+	assert.Equal(t, int64(1), stats.handshakeFailures)
+
+	client, server := net.Pipe()
+	defer server.Close()
+	conn, err := countConn(addr, client, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), stats.open)
+
+	conn.Close()
+	conn.Close()
+	assert.Equal(t, int64(0), stats.open)
+	assert.Equal(t, int64(1), stats.opened)
+}
+
+func TestUpstreamConnectionsEndpoint(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+	defer upstreamConns.Delete(u.Host)
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream.URL
+	})
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/", Code: http.StatusOK},
+		{Path: "/", Code: http.StatusOK},
+	}...)
+
+	resp, _ := ts.Run(t, test.TestCase{Path: "/tyk/connections", AdminAuth: true, Code: http.StatusOK})
+	var report []UpstreamConnections
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range report {
+		if c.Host != u.Host {
+			continue
+		}
+		assert.Equal(t, int64(1), c.Opened, "the connection should be kept alive")
+		assert.Equal(t, int64(1), c.Idle)
+		assert.Equal(t, int64(2), c.HTTP1Requests)
+		assert.Zero(t, c.HTTP2Requests)
+		return
+	}
+	t.Fatalf("%s not in %+v", u.Host, report)
+}
@@ -9,6 +9,10 @@ import (
 )
 
 func GetHandler(path string, symbol string) (http.HandlerFunc, error) {
+	if handler, ok := registeredHandler(path, symbol); ok {
+		return handler, nil
+	}
+
 	// try to load plugin
 	loadedPlugin, err := plugin.Open(path)
 	if err != nil {
@@ -31,6 +35,10 @@ func GetHandler(path string, symbol string) (http.HandlerFunc, error) {
 }
 
 func GetResponseHandler(path string, symbol string) (func(rw http.ResponseWriter, res *http.Response, req *http.Request), error) {
+	if handler, ok := registeredResponseHandler(path, symbol); ok {
+		return handler, nil
+	}
+
 	// try to load plugin
 	loadedPlugin, err := plugin.Open(path)
 	if err != nil {
@@ -8,9 +8,15 @@ import (
 )
 
 func GetHandler(path string, symbol string) (http.HandlerFunc, error) {
+	if handler, ok := registeredHandler(path, symbol); ok {
+		return handler, nil
+	}
 	return nil, fmt.Errorf("goplugin.GetHandler is disabled, please disable build flag 'nogoplugin'")
 }
 
 func GetResponseHandler(path string, symbol string) (func(rw http.ResponseWriter, res *http.Response, req *http.Request), error) {
+	if handler, ok := registeredResponseHandler(path, symbol); ok {
+		return handler, nil
+	}
 	return nil, fmt.Errorf("goplugin.GetResponseHandler is disabled, please disable build flag 'nogoplugin'")
 }
@@ -0,0 +1,51 @@
+package goplugin
+
+import (
+	"net/http"
+	"sync"
+)
+
+var (
+	registryMu       sync.RWMutex
+	handlers         = map[string]http.HandlerFunc{}
+	responseHandlers = map[string]func(rw http.ResponseWriter, res *http.Response, req *http.Request){}
+)
+
+func registryKey(path, symbol string) string {
+	return path + ":" + symbol
+}
+
+// RegisterHandler makes handler the function symbol of the plugin at path,
+// so that it runs in-process instead of being loaded from a plugin file, e.g.
+// in the tests of a plugin.
+func RegisterHandler(path, symbol string, handler http.HandlerFunc) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	handlers[registryKey(path, symbol)] = handler
+}
+
+// RegisterResponseHandler makes handler the response function symbol of the
+// plugin at path, as RegisterHandler does for request functions.
+func RegisterResponseHandler(path, symbol string, handler func(rw http.ResponseWriter, res *http.Response, req *http.Request)) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	responseHandlers[registryKey(path, symbol)] = handler
+}
+
+func registeredHandler(path, symbol string) (http.HandlerFunc, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	handler, ok := handlers[registryKey(path, symbol)]
+	return handler, ok
+}
+
+func registeredResponseHandler(path, symbol string) (func(rw http.ResponseWriter, res *http.Response, req *http.Request), bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	handler, ok := responseHandlers[registryKey(path, symbol)]
+	return handler, ok
+}
@@ -0,0 +1,78 @@
+// Package sdk gives native Go plugins access to the state the gateway keeps
+// on each request: the session, the API definition, the context variables,
+// the analytics tags and the upstream target. Plugins should use it rather
+// than the context keys of the ctx package, which may change between
+// releases.
+package sdk
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/ctx"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// Session returns the session of the key the request was authenticated with,
+// nil before authentication or for keyless APIs.
+func Session(r *http.Request) *user.SessionState {
+	return ctx.GetSession(r)
+}
+
+// SetSession sets the session of the request, e.g. from an auth_check
+// plugin, along with the key it belongs to. If scheduleUpdate is true, the
+// session is saved once the request is processed.
+func SetSession(r *http.Request, session *user.SessionState, token string, scheduleUpdate bool) {
+	ctx.SetSession(r, session, token, scheduleUpdate)
+}
+
+// ScheduleSessionUpdate saves the session of the request once the request is
+// processed, e.g. after a plugin changed its metadata.
+func ScheduleSessionUpdate(r *http.Request) {
+	if session := ctx.GetSession(r); session != nil {
+		ctx.SetSession(r, session, ctx.GetAuthToken(r), true)
+	}
+}
+
+// AuthToken returns the key the request was authenticated with.
+func AuthToken(r *http.Request) string {
+	return ctx.GetAuthToken(r)
+}
+
+// APIDefinition returns the definition of the API serving the request.
+func APIDefinition(r *http.Request) *apidef.APIDefinition {
+	return ctx.GetDefinition(r)
+}
+
+// ContextVariables returns the context variables of the request, nil if they
+// are not enabled for the API.
+func ContextVariables(r *http.Request) map[string]interface{} {
+	if v := r.Context().Value(ctx.ContextData); v != nil {
+		return v.(map[string]interface{})
+	}
+	return nil
+}
+
+// AnalyticsTags returns the tags plugins added to the analytics record of the
+// request.
+func AnalyticsTags(r *http.Request) []string {
+	return ctx.GetAnalyticsTags(r)
+}
+
+// AddAnalyticsTags adds tags to the analytics record of the request.
+func AddAnalyticsTags(r *http.Request, tags ...string) {
+	ctx.AddAnalyticsTags(r, tags...)
+}
+
+// UpstreamTarget returns the target replacing the one of the API for the
+// request, nil if it is not replaced.
+func UpstreamTarget(r *http.Request) *url.URL {
+	return ctx.GetUpstreamTarget(r)
+}
+
+// SetUpstreamTarget sends the request to target instead of the target of the
+// API. The path of the request is appended to the path of target.
+func SetUpstreamTarget(r *http.Request, target *url.URL) {
+	ctx.SetUpstreamTarget(r, target)
+}
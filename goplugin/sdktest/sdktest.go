@@ -0,0 +1,101 @@
+// Package sdktest runs native Go plugins against an in-process gateway, so
+// that plugin authors can test their middleware without building the plugin
+// file:
+//
+//	func TestMain(m *testing.M) {
+//		os.Exit(sdktest.Main(m))
+//	}
+//
+//	func TestMyPlugin(t *testing.T) {
+//		ts := sdktest.StartGateway()
+//		defer ts.Close()
+//
+//		sdktest.LoadAPI(sdktest.Plugin{Pre: []http.HandlerFunc{MyPluginPre}})
+//		ts.Run(t, test.TestCase{Path: "/", Code: http.StatusOK})
+//	}
+package sdktest
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/gateway"
+	"github.com/TykTechnologies/tyk/goplugin"
+)
+
+// Plugin lists the plugin functions run by each hook of an API, as the
+// custom_middleware section of its definition does for a plugin file.
+type Plugin struct {
+	Pre         []http.HandlerFunc
+	AuthCheck   http.HandlerFunc
+	PostKeyAuth []http.HandlerFunc
+	Post        []http.HandlerFunc
+	Response    []func(rw http.ResponseWriter, res *http.Response, req *http.Request)
+}
+
+var pluginCount uint64
+
+// Main sets up the gateway for the tests of m and runs them. It must be
+// called from TestMain, and returns the exit code of the tests.
+func Main(m *testing.M) int {
+	return gateway.InitTestMain(context.Background(), m)
+}
+
+// StartGateway starts an in-process gateway. The upstream of the APIs it
+// serves is a mock echoing the requests it receives.
+func StartGateway(config ...gateway.TestConfig) *gateway.Test {
+	return gateway.StartTest(config...)
+}
+
+// LoadAPI loads an API running the functions of plugin, with the settings of
+// the gateway tests changed by setup. The API is keyless and listens on /,
+// unless plugin has an AuthCheck function, in which case the key is checked
+// by that function.
+func LoadAPI(plugin Plugin, setup ...func(spec *gateway.APISpec)) *gateway.APISpec {
+	// Each API gets its own plugin, as the gateway caches the functions of
+	// a plugin path
+	path := "sdktest-" + strconv.FormatUint(atomic.AddUint64(&pluginCount, 1), 10) + ".so"
+
+	definitions := func(prefix string, handlers []http.HandlerFunc) []apidef.MiddlewareDefinition {
+		var defs []apidef.MiddlewareDefinition
+		for i, handler := range handlers {
+			symbol := prefix + strconv.Itoa(i)
+			goplugin.RegisterHandler(path, symbol, handler)
+			defs = append(defs, apidef.MiddlewareDefinition{Name: symbol, Path: path})
+		}
+		return defs
+	}
+
+	middleware := apidef.MiddlewareSection{
+		Driver:      apidef.GoPluginDriver,
+		Pre:         definitions("Pre", plugin.Pre),
+		PostKeyAuth: definitions("PostKeyAuth", plugin.PostKeyAuth),
+		Post:        definitions("Post", plugin.Post),
+	}
+	for i, handler := range plugin.Response {
+		symbol := "Response" + strconv.Itoa(i)
+		goplugin.RegisterResponseHandler(path, symbol, handler)
+		middleware.Response = append(middleware.Response, apidef.MiddlewareDefinition{Name: symbol, Path: path})
+	}
+	if plugin.AuthCheck != nil {
+		goplugin.RegisterHandler(path, "AuthCheck", plugin.AuthCheck)
+		middleware.AuthCheck = apidef.MiddlewareDefinition{Name: "AuthCheck", Path: path}
+	}
+
+	specs := gateway.BuildAndLoadAPI(func(spec *gateway.APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.CustomMiddleware = middleware
+		if plugin.AuthCheck != nil {
+			spec.UseKeylessAccess = false
+			spec.UseGoPluginAuth = true
+		}
+		for _, s := range setup {
+			s(spec)
+		}
+	})
+	return specs[0]
+}
@@ -0,0 +1,88 @@
+package sdktest_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/goplugin/sdk"
+	"github.com/TykTechnologies/tyk/goplugin/sdktest"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(sdktest.Main(m))
+}
+
+func TestPluginHooks(t *testing.T) {
+	ts := sdktest.StartGateway()
+	defer ts.Close()
+
+	sdktest.LoadAPI(sdktest.Plugin{
+		Pre: []http.HandlerFunc{func(rw http.ResponseWriter, r *http.Request) {
+			sdk.AddAnalyticsTags(r, "pre")
+			rw.Header().Set("X-API-ID", sdk.APIDefinition(r).APIID)
+		}},
+		AuthCheck: func(rw http.ResponseWriter, r *http.Request) {
+			token := r.Header.Get("Authorization")
+			if token != "abc" {
+				rw.WriteHeader(http.StatusForbidden)
+				return
+			}
+			sdk.SetSession(r, &user.SessionState{OrgID: "default", Alias: "abc-session"}, token, false)
+		},
+		PostKeyAuth: []http.HandlerFunc{func(rw http.ResponseWriter, r *http.Request) {
+			sdk.AddAnalyticsTags(r, "post-key-auth")
+			rw.Header().Set("X-Session-Alias", sdk.Session(r).Alias)
+			rw.Header().Set("X-Auth-Token", sdk.AuthToken(r))
+		}},
+		Post: []http.HandlerFunc{func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("X-Tags", strings.Join(sdk.AnalyticsTags(r), ","))
+		}},
+		Response: []func(rw http.ResponseWriter, res *http.Response, req *http.Request){
+			func(rw http.ResponseWriter, res *http.Response, req *http.Request) {
+				res.Header.Set("X-Response-Plugin", "done")
+			},
+		},
+	})
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/", Headers: map[string]string{"Authorization": "invalid"}, Code: http.StatusForbidden},
+		{Path: "/", Headers: map[string]string{"Authorization": "abc"}, Code: http.StatusOK, HeadersMatch: map[string]string{
+			"X-API-ID":          "test",
+			"X-Session-Alias":   "abc-session",
+			"X-Auth-Token":      "abc",
+			"X-Tags":            "pre,post-key-auth",
+			"X-Response-Plugin": "done",
+		}},
+	}...)
+}
+
+func TestUpstreamTarget(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("overridden " + r.URL.RequestURI()))
+	}))
+	defer upstream.Close()
+
+	target, _ := url.Parse(upstream.URL + "/base?env=test")
+
+	ts := sdktest.StartGateway()
+	defer ts.Close()
+
+	sdktest.LoadAPI(sdktest.Plugin{
+		Pre: []http.HandlerFunc{func(rw http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Override") != "" {
+				sdk.SetUpstreamTarget(r, target)
+			}
+		}},
+	})
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/path?a=1", Headers: map[string]string{"X-Override": "1"}, Code: http.StatusOK, BodyMatch: "overridden /base/path\\?env=test&a=1"},
+		{Path: "/path", Code: http.StatusOK, BodyNotMatch: "overridden"},
+	}...)
+}
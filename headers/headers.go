@@ -2,8 +2,10 @@ package headers
 
 const (
 	UserAgent               = "User-Agent"
+	Referer                 = "Referer"
 	ContentType             = "Content-Type"
 	ContentLength           = "Content-Length"
+	TransferEncoding        = "Transfer-Encoding"
 	Authorization           = "Authorization"
 	ContentEncoding         = "Content-Encoding"
 	Accept                  = "Accept"
@@ -14,6 +16,12 @@ const (
 	Expires                 = "Expires"
 	Connection              = "Connection"
 	WWWAuthenticate         = "WWW-Authenticate"
+	Vary                    = "Vary"
+	ContentSecurityPolicy   = "Content-Security-Policy"
+	ReferrerPolicy          = "Referrer-Policy"
+	PermissionsPolicy       = "Permissions-Policy"
+	Warning                 = "Warning"
+	SetCookie               = "Set-Cookie"
 )
 
 const (
@@ -26,6 +34,7 @@ const (
 const (
 	XRealIP             = "X-Real-IP"
 	XForwardFor         = "X-Forwarded-For"
+	Forwarded           = "Forwarded"
 	XAuthResult         = "X-Auth-Result"
 	XSessionAlias       = "X-Session-Alias"
 	XInitialURI         = "X-Initial-URI"
@@ -38,6 +47,9 @@ const (
 	XTykHostname        = "x-tyk-hostname"
 	XGenerator          = "X-Generator"
 	XTykAuthorization   = "X-Tyk-Authorization"
+	XTykExportKey       = "X-Tyk-Export-Key"
+	IdempotencyKey      = "Idempotency-Key"
+	IdempotentReplayed  = "Idempotent-Replayed"
 )
 
 // upgrade and websocket
@@ -53,4 +65,15 @@ const (
 	XRateLimitLimit     = "X-RateLimit-Limit"
 	XRateLimitRemaining = "X-RateLimit-Remaining"
 	XRateLimitReset     = "X-RateLimit-Reset"
+	// XThrottledRetries is the number of times a rate limited request was
+	// retried by throttling.
+	XThrottledRetries = "X-Tyk-Throttled-Retries"
+)
+
+// Rate limit headers as described by the IETF RateLimit header fields draft
+const (
+	RateLimitLimit     = "RateLimit-Limit"
+	RateLimitRemaining = "RateLimit-Remaining"
+	RateLimitReset     = "RateLimit-Reset"
+	RetryAfter         = "Retry-After"
 )
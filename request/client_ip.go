@@ -0,0 +1,203 @@
+package request
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+	logger "github.com/TykTechnologies/tyk/log"
+)
+
+var log = logger.Get()
+
+// DefaultClientIPHeader is the forwarding header looked at when the
+// client_ip configuration doesn't name one.
+const DefaultClientIPHeader = headers.XForwardFor
+
+// ClientIPResolver finds the IP of the client of a request sent through
+// proxies. Forwarding headers are only honored on requests from trusted
+// proxies, and are traced back from the closest hop to the first one that
+// isn't a trusted proxy, so that clients can't spoof their IP.
+type ClientIPResolver struct {
+	TrustedProxies []*net.IPNet
+	// Header is the forwarding header set by the trusted proxies. Other
+	// forwarding headers are ignored, as clients may send them as they like.
+	Header string
+}
+
+// ParseIPNet parses a CIDR, or a single IP.
+func ParseIPNet(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		if strings.Contains(s, ":") {
+			s += "/128"
+		} else {
+			s += "/32"
+		}
+	}
+	_, ipNet, err := net.ParseCIDR(s)
+	return ipNet, err
+}
+
+func (c *ClientIPResolver) trusted(ip net.IP) bool {
+	for _, ipNet := range c.TrustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP of the client of r, nil if r didn't come over IP.
+func (c *ClientIPResolver) ClientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !c.trusted(ip) {
+		return ip
+	}
+
+	hops := forwardedHops(r.Header, c.Header)
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseHop(hops[i])
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !c.trusted(ip) {
+			break
+		}
+	}
+	return ip
+}
+
+// Scheme returns the scheme clients sent r with, as forwarded by the
+// closest trusted proxy in the X-Forwarded-Proto header, or the proto of the
+// Forwarded header when it is the one set by the proxies.
+func (c *ClientIPResolver) Scheme(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip == nil || !c.trusted(ip) {
+		return scheme
+	}
+
+	var forwarded string
+	if strings.EqualFold(c.Header, headers.Forwarded) {
+		values := r.Header.Values(headers.Forwarded)
+		if len(values) == 0 {
+			return scheme
+		}
+		elems := strings.Split(values[len(values)-1], ",")
+		for _, pair := range strings.Split(elems[len(elems)-1], ";") {
+			pair = strings.TrimSpace(pair)
+			if len(pair) > 6 && strings.EqualFold(pair[:6], "proto=") {
+				forwarded = strings.Trim(pair[6:], `"`)
+			}
+		}
+	} else if values := r.Header.Values(headers.XForwardProto); len(values) > 0 {
+		elems := strings.Split(values[len(values)-1], ",")
+		forwarded = strings.TrimSpace(elems[len(elems)-1])
+	}
+
+	switch forwarded = strings.ToLower(forwarded); forwarded {
+	case "http", "https":
+		return forwarded
+	}
+	return scheme
+}
+
+// forwardedHops returns the addresses a request went through according to a
+// forwarding header, from the client to the closest proxy.
+func forwardedHops(h http.Header, name string) []string {
+	values := h.Values(name)
+	if len(values) == 0 {
+		return nil
+	}
+
+	var hops []string
+	for _, value := range values {
+		for _, elem := range strings.Split(value, ",") {
+			if !strings.EqualFold(name, headers.Forwarded) {
+				hops = append(hops, elem)
+				continue
+			}
+			// Forwarded: for=192.0.2.60;proto=http, for="[2001:db8::1]:4711"
+			for _, pair := range strings.Split(elem, ";") {
+				pair = strings.TrimSpace(pair)
+				if len(pair) > 4 && strings.EqualFold(pair[:4], "for=") {
+					hops = append(hops, pair[4:])
+				}
+			}
+		}
+	}
+	return hops
+}
+
+// parseHop parses an address of a forwarding header, which may be quoted and
+// have a port.
+func parseHop(s string) net.IP {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	if ip := net.ParseIP(s); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	return net.ParseIP(strings.Trim(s, "[]"))
+}
+
+// configuredResolver caches the resolver of the client_ip configuration,
+// rebuilt when the configuration changes.
+var configuredResolver struct {
+	sync.RWMutex
+	key      string
+	resolver *ClientIPResolver
+}
+
+// ConfiguredClientIPResolver returns the resolver of the client_ip
+// configuration, nil if it isn't enabled.
+func ConfiguredClientIPResolver() *ClientIPResolver {
+	conf := config.Global().ClientIP
+	if !conf.Enabled {
+		return nil
+	}
+	key := strings.Join(conf.TrustedProxies, ",") + "|" + conf.Header
+
+	configuredResolver.RLock()
+	resolver := configuredResolver.resolver
+	cached := resolver != nil && configuredResolver.key == key
+	configuredResolver.RUnlock()
+	if cached {
+		return resolver
+	}
+
+	resolver = &ClientIPResolver{Header: conf.Header}
+	if resolver.Header == "" {
+		resolver.Header = DefaultClientIPHeader
+	}
+	for _, s := range conf.TrustedProxies {
+		ipNet, err := ParseIPNet(s)
+		if err != nil {
+			log.WithError(err).Error("Invalid trusted proxy in client_ip: ", s)
+			continue
+		}
+		resolver.TrustedProxies = append(resolver.TrustedProxies, ipNet)
+	}
+
+	configuredResolver.Lock()
+	configuredResolver.key = key
+	configuredResolver.resolver = resolver
+	configuredResolver.Unlock()
+	return resolver
+}
@@ -0,0 +1,113 @@
+package request
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	cdn, _ := ParseIPNet("10.0.0.0/8")
+	lb, _ := ParseIPNet("192.168.1.1")
+	trusted := []*net.IPNet{cdn, lb}
+
+	tests := []struct {
+		name       string
+		header     string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{"untrusted peer", DefaultClientIPHeader, "203.0.113.9:1234", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "203.0.113.9"},
+		{"no headers", DefaultClientIPHeader, "192.168.1.1:1234", nil, "192.168.1.1"},
+		{"X-Forwarded-For", DefaultClientIPHeader, "192.168.1.1:1234", map[string]string{"X-Forwarded-For": "6.6.6.6, 1.2.3.4, 10.1.1.1"}, "1.2.3.4"},
+		{"other headers ignored", DefaultClientIPHeader, "192.168.1.1:1234", map[string]string{
+			"X-Real-IP": "6.6.6.6",
+			"Forwarded": "for=6.6.6.6",
+		}, "192.168.1.1"},
+		{"X-Real-IP", "X-Real-IP", "192.168.1.1:1234", map[string]string{"X-Real-IP": "1.2.3.4"}, "1.2.3.4"},
+		{"Forwarded", "Forwarded", "192.168.1.1:1234", map[string]string{
+			"Forwarded":       `for=6.6.6.6, for="[2001:db8::1]:4711";proto=https, for=10.2.2.2`,
+			"X-Forwarded-For": "1.2.3.4",
+		}, "2001:db8::1"},
+		{"invalid hop", DefaultClientIPHeader, "192.168.1.1:1234", map[string]string{"X-Forwarded-For": "1.2.3.4, unknown, 10.1.1.1"}, "10.1.1.1"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resolver := &ClientIPResolver{TrustedProxies: trusted, Header: tc.header}
+			r, _ := http.NewRequest(http.MethodGet, "http://abc.com:8080", nil)
+			r.RemoteAddr = tc.remoteAddr
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+			if ip := resolver.ClientIP(r); ip.String() != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, ip)
+			}
+		})
+	}
+}
+
+func TestRealIPClientIPConfig(t *testing.T) {
+	globalConf := config.Global()
+	defer config.SetGlobal(globalConf)
+
+	conf := globalConf
+	conf.ClientIP = config.ClientIPConfig{
+		Enabled:        true,
+		TrustedProxies: []string{"10.0.0.0/8"},
+		Header:         "X-Real-IP",
+	}
+	config.SetGlobal(conf)
+
+	r, _ := http.NewRequest(http.MethodGet, "http://abc.com:8080", nil)
+	r.RemoteAddr = "203.0.113.9:1234"
+	r.Header.Set("X-Real-IP", "1.2.3.4")
+	if ip := RealIP(r); ip != "203.0.113.9" {
+		t.Errorf("Expected the headers of untrusted clients to be ignored, got %s", ip)
+	}
+
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "5.6.7.8")
+	if ip := RealIP(r); ip != "1.2.3.4" {
+		t.Errorf("Expected the configured header of trusted proxies to be honored, got %s", ip)
+	}
+}
+
+func TestClientIPResolverScheme(t *testing.T) {
+	lb, _ := ParseIPNet("192.168.1.1")
+	resolver := &ClientIPResolver{TrustedProxies: []*net.IPNet{lb}, Header: DefaultClientIPHeader}
+
+	tests := []struct {
+		name       string
+		header     string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{"untrusted peer", DefaultClientIPHeader, "203.0.113.9:1234", map[string]string{"X-Forwarded-Proto": "https"}, "http"},
+		{"X-Forwarded-Proto", DefaultClientIPHeader, "192.168.1.1:1234", map[string]string{"X-Forwarded-Proto": "https"}, "https"},
+		{"closest proxy", DefaultClientIPHeader, "192.168.1.1:1234", map[string]string{"X-Forwarded-Proto": "https, http"}, "http"},
+		{"invalid proto", DefaultClientIPHeader, "192.168.1.1:1234", map[string]string{"X-Forwarded-Proto": "gopher"}, "http"},
+		{"Forwarded", "Forwarded", "192.168.1.1:1234", map[string]string{
+			"Forwarded":         `for=6.6.6.6;proto=http, for=10.2.2.2;proto=https`,
+			"X-Forwarded-Proto": "http",
+		}, "https"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resolver.Header = tc.header
+			r, _ := http.NewRequest(http.MethodGet, "http://abc.com:8080", nil)
+			r.RemoteAddr = tc.remoteAddr
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+			if scheme := resolver.Scheme(r); scheme != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, scheme)
+			}
+		})
+	}
+}
@@ -9,12 +9,22 @@ import (
 )
 
 // RealIP takes a request object, and returns the real Client IP address.
+// When client_ip is enabled in the configuration, forwarding headers are
+// only honored on requests from its trusted proxies.
 func RealIP(r *http.Request) string {
 
 	if contextIp := r.Context().Value("remote_addr"); contextIp != nil {
 		return contextIp.(string)
 	}
 
+	if resolver := ConfiguredClientIPResolver(); resolver != nil {
+		if ip := resolver.ClientIP(r); ip != nil {
+			return ip.String()
+		}
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		return host
+	}
+
 	if realIP := r.Header.Get(headers.XRealIP); realIP != "" {
 		return realIP
 	}
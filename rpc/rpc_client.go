@@ -155,6 +155,17 @@ func LoadCount() int {
 	return values.GetLoadCounts()
 }
 
+// IsConnected reports whether the RPC layer currently answers. The client
+// is only marked as disconnected when it is stopped, so the RPC layer is
+// pinged.
+func IsConnected() bool {
+	if !values.ClientIsConnected() {
+		return false
+	}
+	_, err := FuncClientSingleton("Ping", nil)
+	return err == nil
+}
+
 func Reset() {
 	clientSingleton.Stop()
 	clientSingleton = nil
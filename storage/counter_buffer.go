@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+// bufferedIncr are quota counter increments that couldn't be written.
+type bufferedIncr struct {
+	store  RedisCluster
+	count  int64
+	expire int64
+}
+
+// bufferedHit is a rate limiter hit that couldn't be written.
+type bufferedHit struct {
+	store  RedisCluster
+	key    string
+	member string
+	at     time.Time
+	per    int64
+}
+
+// counterBuffer keeps the rate limit and quota counter updates failing
+// while Redis is unavailable, so that the requests let through meanwhile
+// still count once it recovers.
+type counterBuffer struct {
+	mu      sync.Mutex
+	pending int64
+	incrs   map[string]*bufferedIncr
+	hits    []bufferedHit
+	flushed uint64
+	dropped uint64
+
+	flushing int32
+}
+
+var counters = &counterBuffer{incrs: map[string]*bufferedIncr{}}
+
+// CounterBufferStats are the counter updates buffered while Redis is
+// unavailable.
+type CounterBufferStats struct {
+	Pending int64  `json:"pending"`
+	Flushed uint64 `json:"flushed"`
+	Dropped uint64 `json:"dropped"`
+}
+
+// reserve reports whether n updates fit in the buffer, counting them as
+// dropped if they don't. It must be called with b.mu held.
+func (b *counterBuffer) reserve(n int64) bool {
+	size := int64(config.Global().Storage.CounterBufferSize)
+	if size <= 0 {
+		return false
+	}
+	if b.pending+n > size {
+		b.dropped += uint64(n)
+		return false
+	}
+	b.pending += n
+	return true
+}
+
+func (b *counterBuffer) incrBy(store RedisCluster, key string, n, expire int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.reserve(n) {
+		return
+	}
+	if incr, ok := b.incrs[key]; ok {
+		incr.count += n
+		return
+	}
+	b.incrs[key] = &bufferedIncr{store: store, count: n, expire: expire}
+}
+
+func (b *counterBuffer) hit(hit bufferedHit) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.reserve(1) {
+		return
+	}
+	b.hits = append(b.hits, hit)
+}
+
+func (b *counterBuffer) stats() CounterBufferStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return CounterBufferStats{Pending: b.pending, Flushed: b.flushed, Dropped: b.dropped}
+}
+
+// flush writes the buffered updates. Those failing again are buffered
+// again, rate limiter hits older than their window are left out.
+func (b *counterBuffer) flush() {
+	if !atomic.CompareAndSwapInt32(&b.flushing, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&b.flushing, 0)
+
+	b.mu.Lock()
+	incrs, hits := b.incrs, b.hits
+	if len(incrs) == 0 && len(hits) == 0 {
+		b.mu.Unlock()
+		return
+	}
+	b.incrs, b.hits, b.pending = map[string]*bufferedIncr{}, nil, 0
+	b.mu.Unlock()
+
+	var flushed uint64
+	for key, incr := range incrs {
+		client := incr.store.singleton()
+		val, err := client.IncrBy(ctx, key, incr.count).Result()
+		if err != nil {
+			b.incrBy(incr.store, key, incr.count, incr.expire)
+			continue
+		}
+		if val == incr.count && incr.expire > 0 {
+			client.Expire(ctx, key, time.Duration(incr.expire)*time.Second)
+		}
+		flushed += uint64(incr.count)
+	}
+
+	now := time.Now()
+	for _, hit := range hits {
+		window := time.Duration(hit.per) * time.Second
+		if now.Sub(hit.at) > window {
+			continue
+		}
+		_, err := hit.store.singleton().Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.ZAdd(ctx, hit.key, &redis.Z{Score: float64(hit.at.UnixNano()), Member: hit.member})
+			pipe.Expire(ctx, hit.key, window)
+			return nil
+		})
+		if err != nil {
+			b.hit(hit)
+			continue
+		}
+		flushed++
+	}
+
+	b.mu.Lock()
+	b.flushed += flushed
+	b.mu.Unlock()
+	log.WithField("updates", flushed).Info("Wrote the counter updates buffered while Redis was unavailable")
+}
+
+// CounterBuffer returns the state of the buffer of counter updates kept
+// while Redis is unavailable.
+func CounterBuffer() CounterBufferStats {
+	return counters.stats()
+}
+
+// windowMember is the member of a rate limiter hit in its sorted set.
+func windowMember(at time.Time, valueOverride string) string {
+	if valueOverride != "-1" {
+		return valueOverride
+	}
+	return strconv.Itoa(int(at.UnixNano()))
+}
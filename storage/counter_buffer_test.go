@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+func TestCounterBuffer(t *testing.T) {
+	globalConf := config.Global()
+	defer config.SetGlobal(globalConf)
+
+	r := RedisCluster{KeyPrefix: "test-buffer"}
+
+	t.Run("disabled", func(t *testing.T) {
+		conf := config.Global()
+		conf.Storage.CounterBufferSize = 0
+		config.SetGlobal(conf)
+
+		b := &counterBuffer{incrs: map[string]*bufferedIncr{}}
+		b.incrBy(r, "quota", 1, 60)
+		assert.Equal(t, CounterBufferStats{}, b.stats())
+	})
+
+	t.Run("buffers up to its size", func(t *testing.T) {
+		conf := config.Global()
+		conf.Storage.CounterBufferSize = 3
+		config.SetGlobal(conf)
+
+		b := &counterBuffer{incrs: map[string]*bufferedIncr{}}
+		b.incrBy(r, "quota", 1, 60)
+		b.incrBy(r, "quota", 1, 60)
+		b.hit(bufferedHit{store: r, key: "rate", member: "1", at: time.Now(), per: 60})
+		b.incrBy(r, "quota", 1, 60)
+
+		assert.Equal(t, CounterBufferStats{Pending: 3, Dropped: 1}, b.stats())
+		assert.Equal(t, int64(2), b.incrs["quota"].count)
+		assert.Len(t, b.hits, 1)
+	})
+
+	t.Run("only counters are buffered", func(t *testing.T) {
+		conf := config.Global()
+		conf.Storage.CounterBufferSize = 10
+		config.SetGlobal(conf)
+
+		up := Connected()
+		redisUp.Store(false)
+		defer redisUp.Store(up)
+		buffer := counters
+		counters = &counterBuffer{incrs: map[string]*bufferedIncr{}}
+		defer func() { counters = buffer }()
+
+		assert.Equal(t, int64(0), r.IncrememntWithExpire("lock", 60))
+		assert.Equal(t, CounterBufferStats{}, counters.stats())
+		assert.Equal(t, int64(0), r.IncrementCounterWithExpire("quota", 60))
+		assert.Equal(t, CounterBufferStats{Pending: 1}, counters.stats())
+	})
+
+	t.Run("flush", func(t *testing.T) {
+		conf := config.Global()
+		conf.Storage.CounterBufferSize = 10
+		config.SetGlobal(conf)
+
+		r.DeleteRawKey("buffered-quota")
+		r.DeleteRawKey("buffered-rate")
+
+		b := &counterBuffer{incrs: map[string]*bufferedIncr{}}
+		b.incrBy(r, "buffered-quota", 2, 60)
+		b.hit(bufferedHit{store: r, key: "buffered-rate", member: "1", at: time.Now(), per: 60})
+		// outside of its window
+		b.hit(bufferedHit{store: r, key: "buffered-rate", member: "2", at: time.Now().Add(-time.Minute), per: 1})
+		b.flush()
+
+		assert.Equal(t, CounterBufferStats{Flushed: 3}, b.stats())
+		assert.Equal(t, int64(3), r.IncrememntWithExpire("buffered-quota", 60))
+		hits, _ := r.GetRollingWindow("buffered-rate", 60, false)
+		assert.Equal(t, 1, hits)
+	})
+}
+
+func TestWindowMember(t *testing.T) {
+	at := time.Unix(0, 42)
+	assert.Equal(t, "42", windowMember(at, "-1"))
+	assert.Equal(t, "override", windowMember(at, "override"))
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -181,6 +182,9 @@ func ConnectToRedis(ctx context.Context, onConnect func()) {
 					onConnect()
 				}
 			}
+			if ok {
+				go counters.flush()
+			}
 		}
 	}
 }
@@ -245,6 +249,10 @@ func NewRedisClusterPool(isCache, isAnalytics bool) redis.UniversalClient {
 		IdleTimeout:      240 * timeout,
 		PoolSize:         poolSize,
 		TLSConfig:        tlsConfig,
+		MaxRetries:       cfg.MaxRetries,
+		MinRetryBackoff:  retryBackoff(cfg.MinRetryBackoff),
+		MaxRetryBackoff:  retryBackoff(cfg.MaxRetryBackoff),
+		MaxRedirects:     cfg.MaxRedirects,
 	}
 
 	if opts.MasterName != "" {
@@ -257,10 +265,20 @@ func NewRedisClusterPool(isCache, isAnalytics bool) redis.UniversalClient {
 		log.Info("--> [REDIS] Creating single-node client")
 		client = redis.NewClient(opts.Simple())
 	}
+	client.AddHook(redisStatsHook{pool: redisPoolName(isCache, isAnalytics)})
 
 	return client
 }
 
+// retryBackoff converts a retry backoff in milliseconds, keeping -1 which
+// disables it.
+func retryBackoff(ms int) time.Duration {
+	if ms < 0 {
+		return -1
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
 func getRedisAddrs(config config.StorageOptionsConf) (addrs []string) {
 	if len(config.Addrs) != 0 {
 		addrs = config.Addrs
@@ -453,6 +471,51 @@ func (r *RedisCluster) SetKey(keyName, session string, timeout int64) error {
 	return nil
 }
 
+// SetKeyIfAbsent sets a key unless it exists, and reports whether it was set.
+func (r *RedisCluster) SetKeyIfAbsent(keyName, value string, timeout int64) (bool, error) {
+	if err := r.up(); err != nil {
+		return false, err
+	}
+	set, err := r.singleton().SetNX(ctx, r.fixKey(keyName), value, time.Duration(timeout)*time.Second).Result()
+	if err != nil {
+		log.Error("Error trying to set value: ", err)
+		return false, err
+	}
+	return set, nil
+}
+
+// DeleteKeyIfEqual deletes a key if its value is value, in a watched
+// transaction, and reports whether it was deleted.
+func (r *RedisCluster) DeleteKeyIfEqual(keyName, value string) (bool, error) {
+	if err := r.up(); err != nil {
+		return false, err
+	}
+	fixedKey := r.fixKey(keyName)
+
+	var deleted bool
+	err := r.singleton().Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, fixedKey).Result()
+		if err == redis.Nil || (err == nil && current != value) {
+			deleted = false
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, fixedKey)
+			return nil
+		})
+		deleted = err == nil
+		return err
+	}, fixedKey)
+	if err == redis.TxFailedErr {
+		// changed meanwhile
+		return false, nil
+	}
+	return deleted, err
+}
+
 func (r *RedisCluster) SetRawKey(keyName, session string, timeout int64) error {
 	if err := r.up(); err != nil {
 		return err
@@ -481,10 +544,34 @@ func (r *RedisCluster) Decrement(keyName string) {
 
 // IncrementWithExpire will increment a key in redis
 func (r *RedisCluster) IncrememntWithExpire(keyName string, expire int64) int64 {
+	val, _ := r.incrementWithExpire(keyName, expire)
+	return val
+}
+
+// IncrementRawKey increments a raw key like IncrememntWithExpire, failing
+// when Redis is unavailable, for locks and nonces not to take the failure
+// for a key already taken.
+func (r *RedisCluster) IncrementRawKey(keyName string, expire int64) (int64, error) {
+	return r.incrementWithExpire(keyName, expire)
+}
+
+// IncrementCounterWithExpire increments a raw quota counter key like
+// IncrememntWithExpire, buffering the increment while Redis is unavailable
+// for the request to still count once it recovers. Locks and nonces must
+// not be buffered, as they would be taken again once it does.
+func (r *RedisCluster) IncrementCounterWithExpire(keyName string, expire int64) int64 {
+	val, err := r.incrementWithExpire(keyName, expire)
+	if err != nil {
+		counters.incrBy(*r, keyName, 1, expire)
+	}
+	return val
+}
+
+func (r *RedisCluster) incrementWithExpire(keyName string, expire int64) (int64, error) {
 	// log.Debug("Incrementing raw key: ", keyName)
 	if err := r.up(); err != nil {
 		log.Debug(err)
-		return 0
+		return 0, err
 	}
 	// This function uses a raw key, so we shouldn't call fixKey
 	fixedKey := keyName
@@ -492,6 +579,7 @@ func (r *RedisCluster) IncrememntWithExpire(keyName string, expire int64) int64
 
 	if err != nil {
 		log.Error("Error trying to increment value:", err)
+		return 0, err
 	} else {
 		log.Debug("Incremented key: ", fixedKey, ", val is: ", val)
 	}
@@ -501,7 +589,66 @@ func (r *RedisCluster) IncrememntWithExpire(keyName string, expire int64) int64
 		r.singleton().Expire(ctx, fixedKey, time.Duration(expire)*time.Second)
 	}
 
-	return val
+	return val, nil
+}
+
+// periodCounterRetries is how many times a period counter is incremented
+// again when its period changed meanwhile.
+const periodCounterRetries = 10
+
+// IncrementPeriodCounter increments the raw counter key of the period ending
+// at periodEnd, which periodKey stores. The first increment of a later period
+// sets the counter to what renew returns, from the end of the last period and
+// its counter. The period is watched, for two requests not to renew the
+// counter, so periodKey must be in the hash slot of counterKey. It reports
+// whether the counter was renewed.
+func (r *RedisCluster) IncrementPeriodCounter(counterKey, periodKey string, periodEnd, expire int64,
+	renew func(lastPeriodEnd, last int64) int64) (count int64, renewed bool, err error) {
+	if err := r.up(); err != nil {
+		return 0, false, err
+	}
+	ttl := time.Duration(expire) * time.Second
+
+	txf := func(tx *redis.Tx) error {
+		lastPeriodEnd, err := tx.Get(ctx, periodKey).Int64()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+
+		if lastPeriodEnd >= periodEnd {
+			var incr *redis.IntCmd
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				incr = pipe.Incr(ctx, counterKey)
+				pipe.Expire(ctx, counterKey, ttl)
+				return nil
+			})
+			count, renewed = incr.Val(), false
+			return err
+		}
+
+		last, err := tx.Get(ctx, counterKey).Int64()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		count, renewed = renew(lastPeriodEnd, last), true
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, counterKey, count, ttl)
+			pipe.Set(ctx, periodKey, periodEnd, ttl)
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < periodCounterRetries; i++ {
+		err = r.singleton().Watch(ctx, txf, periodKey)
+		if err != redis.TxFailedErr {
+			break
+		}
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return count, renewed, nil
 }
 
 // GetKeys will return all keys according to the filter (filter is a prefix - e.g. tyk.keys.*)
@@ -573,6 +720,123 @@ func (r *RedisCluster) GetKeys(filter string) []string {
 	return sessions
 }
 
+// ScanKeys calls fn with each key matching the filter as it is scanned,
+// instead of collecting them all first like GetKeys. Scanning stops at the
+// first error returned by fn. Calls to fn are never concurrent.
+func (r *RedisCluster) ScanKeys(filter string, fn func(key string) error) error {
+	if err := r.up(); err != nil {
+		return err
+	}
+	client := r.singleton()
+
+	filterHash := ""
+	if filter != "" {
+		filterHash = r.hashKey(filter)
+	}
+	searchStr := r.KeyPrefix + filterHash + "*"
+	log.Debug("[STORE] Scanning keys by: ", searchStr)
+
+	var mu sync.Mutex
+	fnScanKeys := func(client *redis.Client) error {
+		iter := client.Scan(ctx, 0, searchStr, 0).Iterator()
+		for iter.Next(ctx) {
+			mu.Lock()
+			err := fn(r.cleanKey(iter.Val()))
+			mu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+		return iter.Err()
+	}
+
+	switch v := client.(type) {
+	case *redis.ClusterClient:
+		return v.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return fnScanKeys(client)
+		})
+	case *redis.Client:
+		return fnScanKeys(v)
+	}
+	return nil
+}
+
+// scanValuesBatchSize is the number of keys whose values and TTLs are read
+// in a pipeline by ScanKeysValuesAndTTLs.
+const scanValuesBatchSize = 500
+
+// KeyValueTTL is the value of a key, and the seconds left before it expires
+// or -1 if it doesn't.
+type KeyValueTTL struct {
+	Value string
+	TTL   int64
+}
+
+// ScanKeysValuesAndTTLs calls fn with the values and TTLs of the keys kept
+// by keep, read in pipelines as they are scanned, so that they are never all
+// held in memory. Keys that aren't strings are skipped and logged, as are
+// keys removed meanwhile. Other errors, and the first error returned by fn,
+// are returned.
+func (r *RedisCluster) ScanKeysValuesAndTTLs(keep func(key string) bool, fn func(key string, value KeyValueTTL) error) error {
+	var batch []string
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		pipe := r.singleton().Pipeline()
+		gets := make([]*redis.StringCmd, len(batch))
+		ttls := make([]*redis.DurationCmd, len(batch))
+		for i, key := range batch {
+			gets[i] = pipe.Get(ctx, r.KeyPrefix+key)
+			ttls[i] = pipe.TTL(ctx, r.KeyPrefix+key)
+		}
+		// the errors are those of the commands, checked below
+		_, _ = pipe.Exec(ctx)
+
+		for i, key := range batch {
+			value, err := gets[i].Result()
+			switch {
+			case err == redis.Nil:
+				continue
+			case err != nil && strings.HasPrefix(err.Error(), "WRONGTYPE"):
+				log.WithField("key", key).Warning("Skipping key that isn't a string: ", err)
+				continue
+			case err != nil:
+				return err
+			}
+			ttl, err := ttls[i].Result()
+			if err != nil {
+				return err
+			}
+			// since redis-go v8.3.1, keys without expiry have a TTL of -1ns
+			seconds := int64(ttl.Seconds())
+			if ttl < 0 {
+				seconds = -1
+			}
+			if err := fn(key, KeyValueTTL{Value: value, TTL: seconds}); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	err := r.ScanKeys("", func(key string) error {
+		if keep != nil && !keep(key) {
+			return nil
+		}
+		batch = append(batch, key)
+		if len(batch) < scanValuesBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	return err
+}
+
 // GetKeysAndValuesWithFilter will return all keys and their values with a filter
 func (r *RedisCluster) GetKeysAndValuesWithFilter(filter string) map[string]string {
 	if err := r.up(); err != nil {
@@ -936,6 +1200,21 @@ func (r *RedisCluster) RemoveFromList(keyName, value string) error {
 	return nil
 }
 
+// GetListLength returns the number of elements of the list identified by keyName
+func (r *RedisCluster) GetListLength(keyName string) (int64, error) {
+	if err := r.up(); err != nil {
+		return 0, err
+	}
+
+	length, err := r.singleton().LLen(ctx, r.fixKey(keyName)).Result()
+	if err != nil {
+		log.WithField("keyName", keyName).WithError(err).Error("LLEN command failed")
+		return 0, err
+	}
+
+	return length, nil
+}
+
 // GetListRange gets range of elements of list identified by keyName
 func (r *RedisCluster) GetListRange(keyName string, from, to int64) ([]string, error) {
 	fixedKey := r.fixKey(keyName)
@@ -1043,13 +1322,30 @@ func (r *RedisCluster) IsMemberOfSet(keyName, value string) bool {
 
 // SetRollingWindow will append to a sorted set in redis and extract a timed window of values
 func (r *RedisCluster) SetRollingWindow(keyName string, per int64, value_override string, pipeline bool) (int, []interface{}) {
+	intVal, result, _ := r.setRollingWindow(keyName, per, value_override, pipeline, time.Now())
+	return intVal, result
+}
+
+// SetRateLimitWindow adds a request to a rate limiter window like
+// SetRollingWindow, buffering it while Redis is unavailable for the request
+// to still count once it recovers. Windows only read through their sample,
+// such as the health checks, must not be buffered.
+func (r *RedisCluster) SetRateLimitWindow(keyName string, per int64, value_override string, pipeline bool) (int, []interface{}) {
+	now := time.Now()
+	intVal, result, err := r.setRollingWindow(keyName, per, value_override, pipeline, now)
+	if err != nil {
+		counters.hit(bufferedHit{store: *r, key: keyName, member: windowMember(now, value_override), at: now, per: per})
+	}
+	return intVal, result
+}
+
+func (r *RedisCluster) setRollingWindow(keyName string, per int64, value_override string, pipeline bool, now time.Time) (int, []interface{}, error) {
 	log.Debug("Incrementing raw key: ", keyName)
 	if err := r.up(); err != nil {
 		log.Debug(err)
-		return 0, nil
+		return 0, nil, err
 	}
 	log.Debug("keyName is: ", keyName)
-	now := time.Now()
 	log.Debug("Now is:", now)
 	onePeriodAgo := now.Add(time.Duration(-1*per) * time.Second)
 	log.Debug("Then is: ", onePeriodAgo)
@@ -1062,13 +1358,8 @@ func (r *RedisCluster) SetRollingWindow(keyName string, per int64, value_overrid
 		zrange = pipe.ZRange(ctx, keyName, 0, -1)
 
 		element := redis.Z{
-			Score: float64(now.UnixNano()),
-		}
-
-		if value_override != "-1" {
-			element.Member = value_override
-		} else {
-			element.Member = strconv.Itoa(int(now.UnixNano()))
+			Score:  float64(now.UnixNano()),
+			Member: windowMember(now, value_override),
 		}
 
 		pipe.ZAdd(ctx, keyName, &element)
@@ -1086,14 +1377,14 @@ func (r *RedisCluster) SetRollingWindow(keyName string, per int64, value_overrid
 
 	if err != nil {
 		log.Error("Multi command failed: ", err)
-		return 0, nil
+		return 0, nil, err
 	}
 
 	values := zrange.Val()
 
 	// Check actual value
 	if values == nil {
-		return 0, nil
+		return 0, nil, nil
 	}
 
 	intVal := len(values)
@@ -1105,7 +1396,7 @@ func (r *RedisCluster) SetRollingWindow(keyName string, per int64, value_overrid
 
 	log.Debug("Returned: ", intVal)
 
-	return intVal, result
+	return intVal, result, nil
 }
 
 func (r RedisCluster) GetRollingWindow(keyName string, per int64, pipeline bool) (int, []interface{}) {
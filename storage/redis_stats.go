@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisOpStats are the calls of a Redis command on a connection pool, and
+// how many of them failed after their retries.
+type RedisOpStats struct {
+	Pool        string     `json:"pool"`
+	Op          string     `json:"op"`
+	Calls       uint64     `json:"calls"`
+	Errors      uint64     `json:"errors"`
+	ErrorRate   float64    `json:"error_rate"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+type redisOpCounters struct {
+	calls  uint64
+	errors uint64
+
+	mu          sync.Mutex
+	lastError   string
+	lastErrorAt time.Time
+}
+
+type redisOpKey struct {
+	pool, op string
+}
+
+var redisOps sync.Map // redisOpKey to *redisOpCounters
+
+func redisPoolName(cache, analytics bool) string {
+	switch {
+	case cache:
+		return "cache"
+	case analytics:
+		return "analytics"
+	}
+	return "default"
+}
+
+func recordRedisCmd(pool string, cmd redis.Cmder) {
+	key := redisOpKey{pool: pool, op: cmd.Name()}
+	v, ok := redisOps.Load(key)
+	if !ok {
+		v, _ = redisOps.LoadOrStore(key, &redisOpCounters{})
+	}
+	counters := v.(*redisOpCounters)
+
+	atomic.AddUint64(&counters.calls, 1)
+	// a missing key isn't a failure
+	if err := cmd.Err(); err != nil && err != redis.Nil {
+		atomic.AddUint64(&counters.errors, 1)
+		counters.mu.Lock()
+		counters.lastError = err.Error()
+		counters.lastErrorAt = time.Now()
+		counters.mu.Unlock()
+	}
+}
+
+// redisStatsHook counts the commands of a connection pool and their errors.
+type redisStatsHook struct {
+	pool string
+}
+
+func (h redisStatsHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h redisStatsHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	recordRedisCmd(h.pool, cmd)
+	return nil
+}
+
+func (h redisStatsHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h redisStatsHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		recordRedisCmd(h.pool, cmd)
+	}
+	return nil
+}
+
+// RedisStats returns the calls and errors of the Redis commands run since
+// the gateway started, by connection pool and command.
+func RedisStats() []RedisOpStats {
+	stats := []RedisOpStats{}
+	redisOps.Range(func(k, v interface{}) bool {
+		key, counters := k.(redisOpKey), v.(*redisOpCounters)
+		s := RedisOpStats{
+			Pool:   key.pool,
+			Op:     key.op,
+			Calls:  atomic.LoadUint64(&counters.calls),
+			Errors: atomic.LoadUint64(&counters.errors),
+		}
+		if s.Calls > 0 {
+			s.ErrorRate = float64(s.Errors) / float64(s.Calls)
+		}
+		counters.mu.Lock()
+		if s.LastError = counters.lastError; s.LastError != "" {
+			at := counters.lastErrorAt
+			s.LastErrorAt = &at
+		}
+		counters.mu.Unlock()
+
+		stats = append(stats, s)
+		return true
+	})
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Pool != stats[j].Pool {
+			return stats[i].Pool < stats[j].Pool
+		}
+		return stats[i].Op < stats[j].Op
+	})
+	return stats
+}
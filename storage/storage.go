@@ -2,15 +2,18 @@ package storage
 
 import (
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"hash"
 	"strings"
+	"sync"
 
 	"github.com/buger/jsonparser"
 	uuid "github.com/satori/go.uuid"
+	"lukechampine.com/blake3"
 
 	"github.com/TykTechnologies/murmur3"
 	"github.com/TykTechnologies/tyk/config"
@@ -122,26 +125,58 @@ func TokenOrg(token string) string {
 	return ""
 }
 
+// TokenID returns the ID a key in the JSON format was generated from.
+func TokenID(token string) (string, error) {
+	jsonToken, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return "", err
+	}
+	return jsonparser.GetString(jsonToken, "id")
+}
+
 var (
-	HashSha256    = "sha256"
-	HashMurmur32  = "murmur32"
-	HashMurmur64  = "murmur64"
-	HashMurmur128 = "murmur128"
+	HashSha256     = "sha256"
+	HashSha512_256 = "sha512-256"
+	HashBlake3     = "blake3"
+	HashMurmur32   = "murmur32"
+	HashMurmur64   = "murmur64"
+	HashMurmur128  = "murmur128"
 )
 
+var (
+	hashFunctionsMu sync.RWMutex
+	hashFunctions   = map[string]func() hash.Hash{
+		HashSha256:     sha256.New,
+		HashSha512_256: sha512.New512_256,
+		HashBlake3:     func() hash.Hash { return blake3.New(32, nil) },
+		HashMurmur32:   func() hash.Hash { return murmur3.New32() },
+		HashMurmur64:   func() hash.Hash { return murmur3.New64() },
+		HashMurmur128:  func() hash.Hash { return murmur3.New128() },
+	}
+)
+
+// RegisterHashFunction makes a key hash algorithm available under a name, to
+// be used as hash_key_function. Keys embed the name of the algorithm they are
+// hashed with, so it must be registered on all gateways, before any key is
+// looked up. Registering an existing name replaces its algorithm.
+func RegisterHashFunction(name string, newHash func() hash.Hash) {
+	hashFunctionsMu.Lock()
+	hashFunctions[name] = newHash
+	hashFunctionsMu.Unlock()
+}
+
 func hashFunction(algorithm string) (hash.Hash, error) {
-	switch algorithm {
-	case HashSha256:
-		return sha256.New(), nil
-	case HashMurmur64:
-		return murmur3.New64(), nil
-	case HashMurmur128:
-		return murmur3.New128(), nil
-	case "", HashMurmur32:
-		return murmur3.New32(), nil
-	default:
+	if algorithm == "" {
+		algorithm = HashMurmur32
+	}
+
+	hashFunctionsMu.RLock()
+	newHash, ok := hashFunctions[algorithm]
+	hashFunctionsMu.RUnlock()
+	if !ok {
 		return murmur3.New32(), fmt.Errorf("Unknown key hash function: %s. Falling back to murmur32.", algorithm)
 	}
+	return newHash(), nil
 }
 
 func HashStr(in string, withAlg ...string) string {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"net/url"
@@ -12,6 +13,8 @@ import (
 	"sync/atomic"
 	"time"
 
+	proxyproto "github.com/pires/go-proxyproto"
+
 	logger "github.com/TykTechnologies/tyk/log"
 )
 
@@ -31,6 +34,20 @@ const (
 type Modifier struct {
 	ModifyRequest  func(src, dst net.Conn, data []byte) ([]byte, error)
 	ModifyResponse func(src, dst net.Conn, data []byte) ([]byte, error)
+
+	// Authorize is called with the client connection before connecting to
+	// the target, after the TLS handshake if any. To close connection,
+	// return error
+	Authorize func(conn net.Conn) error
+
+	// ProxyProtocol is the version, 1 or 2, of the PROXY protocol header
+	// sent to the target before any data. No header is sent when it is 0.
+	ProxyProtocol int
+
+	// Target returns the target of each new connection, in place of the
+	// one the handler was added with, e.g. to balance connections across
+	// several targets. To close connection, return error
+	Target func() (string, error)
 }
 
 type targetConfig struct {
@@ -205,9 +222,22 @@ func (p *Proxy) handleConn(conn net.Conn) error {
 		conn.Close()
 		return err
 	}
-	u, uErr := url.Parse(config.target)
+	if config.modifier.Authorize != nil {
+		if err := config.modifier.Authorize(conn); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	target := config.target
+	if config.modifier.Target != nil {
+		if target, err = config.modifier.Target(); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	u, uErr := url.Parse(target)
 	if uErr != nil {
-		u, uErr = url.Parse("tcp://" + config.target)
+		u, uErr = url.Parse("tcp://" + target)
 
 		if uErr != nil {
 			conn.Close()
@@ -241,6 +271,11 @@ func (p *Proxy) handleConn(conn net.Conn) error {
 		conn.Close()
 		rconn.Close()
 	}()
+	if config.modifier.ProxyProtocol != 0 {
+		if err := writeProxyHeader(rconn, conn, config.modifier.ProxyProtocol); err != nil {
+			return err
+		}
+	}
 	var wg sync.WaitGroup
 	wg.Add(2)
 
@@ -306,6 +341,38 @@ func (p *Proxy) handleConn(conn net.Conn) error {
 	return nil
 }
 
+// writeProxyHeader sends to the target the PROXY protocol header describing
+// the client connection.
+func writeProxyHeader(rconn, conn net.Conn, version int) error {
+	if version != 1 && version != 2 {
+		return fmt.Errorf("Unsupported PROXY protocol version: %d", version)
+	}
+
+	src, srcOk := conn.RemoteAddr().(*net.TCPAddr)
+	dst, dstOk := conn.LocalAddr().(*net.TCPAddr)
+	if !srcOk || !dstOk {
+		return errors.New("PROXY protocol header requires a TCP client connection")
+	}
+
+	header := &proxyproto.Header{
+		Version:            byte(version),
+		Command:            proxyproto.PROXY,
+		TransportProtocol:  proxyproto.TCPv4,
+		SourceAddress:      src.IP.To4(),
+		SourcePort:         uint16(src.Port),
+		DestinationAddress: dst.IP.To4(),
+		DestinationPort:    uint16(dst.Port),
+	}
+	if src.IP.To4() == nil || dst.IP.To4() == nil {
+		header.TransportProtocol = proxyproto.TCPv6
+		header.SourceAddress = src.IP.To16()
+		header.DestinationAddress = dst.IP.To16()
+	}
+
+	_, err := header.WriteTo(rconn)
+	return err
+}
+
 func upstreamConn(c net.Conn) string {
 	return formatAddress(c.LocalAddr(), c.RemoteAddr())
 }
@@ -2,9 +2,13 @@ package tcp
 
 import (
 	"crypto/tls"
+	"errors"
 	"net"
 	"reflect"
 	"testing"
+	"time"
+
+	proxyproto "github.com/pires/go-proxyproto"
 
 	"github.com/TykTechnologies/tyk/test"
 )
@@ -54,6 +58,84 @@ func TestProxyModifier(t *testing.T) {
 		}...)
 	})
 }
+
+func TestProxyAuthorize(t *testing.T) {
+	upstream := test.TcpMock(false, func(in []byte, err error) (out []byte) {
+		return in
+	})
+	defer upstream.Close()
+
+	for _, useSSL := range []bool{false, true} {
+		proxy := &Proxy{}
+		proxy.AddDomainHandler("", upstream.Addr().String(), &Modifier{
+			Authorize: func(conn net.Conn) error {
+				if _, ok := conn.(*tls.Conn); ok != useSSL {
+					t.Error("Expected the client connection, got: ", conn)
+				}
+				return errors.New("Denied")
+			},
+		})
+
+		// Writing first could reset the connection closed with unread data
+		testRunner(t, proxy, "", useSSL, []test.TCPTestCase{
+			{Action: "read", ErrorMatch: "EOF"},
+		}...)
+	}
+}
+
+// proxyProtocolMock replies whether the connection it receives carries a
+// PROXY protocol header, that is whether its source differs from the peer.
+func proxyProtocolMock() net.Listener {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+
+	go func() {
+		for {
+			raw, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn := proxyproto.NewConn(raw, time.Second)
+				defer conn.Close()
+
+				buf := make([]byte, 65535)
+				if _, err := conn.Read(buf); err != nil {
+					return
+				}
+				if conn.RemoteAddr().String() == raw.RemoteAddr().String() {
+					conn.Write([]byte("direct"))
+				} else {
+					conn.Write([]byte("proxied"))
+				}
+			}()
+		}
+	}()
+
+	return l
+}
+
+func TestProxyProtocolHeader(t *testing.T) {
+	upstream := proxyProtocolMock()
+	defer upstream.Close()
+
+	for _, tc := range []struct {
+		version int
+		expect  string
+	}{
+		{0, "direct"},
+		{1, "proxied"},
+		{2, "proxied"},
+	} {
+		proxy := &Proxy{}
+		proxy.AddDomainHandler("", upstream.Addr().String(), &Modifier{ProxyProtocol: tc.version})
+
+		testRunner(t, proxy, "", false, []test.TCPTestCase{
+			{Action: "write", Payload: "ping"},
+			{Action: "read", Payload: tc.expect},
+		}...)
+	}
+}
+
 func TestProxySyncStats(t *testing.T) {
 	t.Skip()
 	// Echoing
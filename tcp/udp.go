@@ -0,0 +1,293 @@
+package tcp
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// UDPProxy forwards datagrams between clients and a target. Each client
+// address gets its own socket to the target, so that replies can be sent
+// back to it, which is closed once idle.
+//
+// UDP forwarding is experimental: only the Authorize and Target of the
+// modifier are used, Authorize being called with the client of each new
+// session.
+type UDPProxy struct {
+	sync.RWMutex
+
+	Dial func(network, addr string) (net.Conn, error)
+
+	// IdleTimeout is how long the socket of a client is kept without
+	// datagrams from either side. Defaults to one minute.
+	IdleTimeout time.Duration
+
+	// MaxSessions is the number of clients served at once, the datagrams of
+	// new clients being dropped beyond it. Defaults to 10000.
+	MaxSessions int
+
+	target   string
+	modifier *Modifier
+
+	sessionsMu sync.Mutex
+	sessions   map[string]*udpSession
+	// connecting is the number of sessions being authorized and dialed,
+	// which count towards MaxSessions.
+	connecting int
+}
+
+type udpSession struct {
+	conn net.Conn
+	// lastActive is the time of the last datagram, in Unix nanoseconds
+	lastActive int64
+}
+
+func (s *udpSession) touch() {
+	atomic.StoreInt64(&s.lastActive, time.Now().UnixNano())
+}
+
+func (s *udpSession) idleSince() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&s.lastActive)))
+}
+
+func (p *UDPProxy) SetTarget(target string, modifier *Modifier) {
+	p.Lock()
+	defer p.Unlock()
+
+	if modifier == nil {
+		modifier = &Modifier{}
+	}
+
+	p.target = target
+	p.modifier = modifier
+}
+
+func (p *UDPProxy) Swap(new *UDPProxy) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.target = new.target
+	p.modifier = new.modifier
+}
+
+func (p *UDPProxy) idleTimeout() time.Duration {
+	if p.IdleTimeout == 0 {
+		return time.Minute
+	}
+	return p.IdleTimeout
+}
+
+func (p *UDPProxy) maxSessions() int {
+	if p.MaxSessions <= 0 {
+		return 10000
+	}
+	return p.MaxSessions
+}
+
+func (p *UDPProxy) Serve(pc net.PacketConn) error {
+	buf := make([]byte, 65535)
+
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			log.WithError(err).Warning("Can't read datagram")
+			return err
+		}
+
+		if session, ok := p.session(addr); ok {
+			session.touch()
+			if _, err := session.conn.Write(buf[:n]); err != nil {
+				log.WithError(err).Info("Failed to write to upstream socket")
+			}
+			continue
+		}
+
+		// new clients are authorized and connected without holding up the
+		// datagrams of the others
+		datagram := append([]byte(nil), buf[:n]...)
+		go func(addr net.Addr) {
+			session, err := p.getSession(pc, addr)
+			if err != nil {
+				log.WithError(err).WithField("conn", addr.String()).Warning("Can't handle datagram")
+				return
+			}
+			session.touch()
+			if _, err := session.conn.Write(datagram); err != nil {
+				log.WithError(err).Info("Failed to write to upstream socket")
+			}
+		}(addr)
+	}
+}
+
+// session returns the session of the client at addr, if it has one.
+func (p *UDPProxy) session(addr net.Addr) (*udpSession, bool) {
+	p.sessionsMu.Lock()
+	defer p.sessionsMu.Unlock()
+	session, ok := p.sessions[addr.String()]
+	return session, ok
+}
+
+// getSession returns the socket to the target of the client at addr,
+// connecting it if it is a new client. The client is authorized and the
+// target dialed without the lock, the session slot being reserved meanwhile.
+func (p *UDPProxy) getSession(pc net.PacketConn, addr net.Addr) (*udpSession, error) {
+	key := addr.String()
+
+	p.sessionsMu.Lock()
+	if session, ok := p.sessions[key]; ok {
+		p.sessionsMu.Unlock()
+		return session, nil
+	}
+	if len(p.sessions)+p.connecting >= p.maxSessions() {
+		p.sessionsMu.Unlock()
+		return nil, errors.New("Too many UDP sessions")
+	}
+	p.connecting++
+	p.sessionsMu.Unlock()
+
+	conn, err := p.connect(pc, addr)
+
+	p.sessionsMu.Lock()
+	defer p.sessionsMu.Unlock()
+	p.connecting--
+	if err != nil {
+		return nil, err
+	}
+	// another datagram of the client may have connected it meanwhile
+	if session, ok := p.sessions[key]; ok {
+		conn.Close()
+		return session, nil
+	}
+
+	if p.sessions == nil {
+		p.sessions = make(map[string]*udpSession)
+	}
+	session := &udpSession{conn: conn}
+	session.touch()
+	p.sessions[key] = session
+
+	go p.reply(pc, addr, session)
+
+	return session, nil
+}
+
+// connect authorizes the client at addr and dials the target for it.
+func (p *UDPProxy) connect(pc net.PacketConn, addr net.Addr) (net.Conn, error) {
+	p.RLock()
+	modifier := p.modifier
+	p.RUnlock()
+	if modifier != nil && modifier.Authorize != nil {
+		if err := modifier.Authorize(&udpClientConn{pc: pc, addr: addr}); err != nil {
+			return nil, err
+		}
+	}
+	return p.dialTarget()
+}
+
+func (p *UDPProxy) dialTarget() (net.Conn, error) {
+	p.RLock()
+	target, modifier := p.target, p.modifier
+	p.RUnlock()
+
+	if target == "" && modifier == nil {
+		return nil, errors.New("No services defined")
+	}
+	if modifier != nil && modifier.Target != nil {
+		var err error
+		if target, err = modifier.Target(); err != nil {
+			return nil, err
+		}
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		if u, err = url.Parse("udp://" + target); err != nil {
+			return nil, err
+		}
+	}
+	if u.Scheme != "udp" {
+		return nil, errors.New("Unsupported protocol. Should be empty or `udp`")
+	}
+
+	if p.Dial != nil {
+		return p.Dial("udp", u.Host)
+	}
+	return net.Dial("udp", u.Host)
+}
+
+// reply sends the datagrams of the target back to the client, until the
+// session is idle.
+func (p *UDPProxy) reply(pc net.PacketConn, addr net.Addr, session *udpSession) {
+	defer func() {
+		p.sessionsMu.Lock()
+		delete(p.sessions, addr.String())
+		p.sessionsMu.Unlock()
+		session.conn.Close()
+	}()
+
+	buf := make([]byte, 65535)
+	idleTimeout := p.idleTimeout()
+
+	for {
+		session.conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		n, err := session.conn.Read(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() && session.idleSince() < idleTimeout {
+				// The client is still sending datagrams
+				continue
+			}
+			if !IsSocketClosed(err) {
+				log.WithError(err).WithField("conn", addr.String()).Debug("Closing upstream socket")
+			}
+			return
+		}
+
+		session.touch()
+		if _, err := pc.WriteTo(buf[:n], addr); err != nil {
+			log.WithError(err).Info("Failed to write to client")
+			return
+		}
+	}
+}
+
+// udpClientConn is the client of a UDP session, as given to the Authorize of
+// the modifier. It can only be written to.
+type udpClientConn struct {
+	pc   net.PacketConn
+	addr net.Addr
+}
+
+func (c *udpClientConn) Read(b []byte) (int, error) {
+	return 0, errors.New("UDP client can't be read from")
+}
+
+func (c *udpClientConn) Write(b []byte) (int, error) {
+	return c.pc.WriteTo(b, c.addr)
+}
+
+func (c *udpClientConn) Close() error {
+	return nil
+}
+
+func (c *udpClientConn) LocalAddr() net.Addr {
+	return c.pc.LocalAddr()
+}
+
+func (c *udpClientConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+func (c *udpClientConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *udpClientConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *udpClientConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
@@ -0,0 +1,201 @@
+package tcp
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// udpMock replies to each datagram with the given payload
+func udpMock(reply string) net.PacketConn {
+	pc, _ := net.ListenPacket("udp", "127.0.0.1:0")
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			_, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo([]byte(reply), addr)
+		}
+	}()
+
+	return pc
+}
+
+func udpRunner(t *testing.T, proxy *UDPProxy, expect ...string) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	go proxy.Serve(pc)
+
+	for i, e := range expect {
+		// Each client gets its own upstream socket
+		client, err := net.Dial("udp", pc.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.SetDeadline(time.Now().Add(time.Second))
+
+		for j := 0; j < 2; j++ {
+			if _, err := client.Write([]byte("ping")); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 64)
+			n, err := client.Read(buf)
+			if err != nil {
+				t.Fatalf("[%d] Unexpected error: %s", i, err)
+			}
+			if string(buf[:n]) != e {
+				t.Errorf("[%d] Expected read %s, got %s", i, e, buf[:n])
+			}
+		}
+		client.Close()
+	}
+}
+
+// udpDenied checks that the datagrams of a client get no reply
+func udpDenied(t *testing.T, proxy *UDPProxy) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	go proxy.Serve(pc)
+
+	client, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(100 * time.Millisecond))
+
+	if _, err := client.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := client.Read(make([]byte, 64)); err == nil {
+		t.Errorf("Expected no reply, got %d bytes", n)
+	}
+}
+
+func TestUDPProxy(t *testing.T) {
+	target1 := udpMock("first")
+	defer target1.Close()
+
+	target2 := udpMock("second")
+	defer target2.Close()
+
+	t.Run("Single target", func(t *testing.T) {
+		proxy := &UDPProxy{}
+		proxy.SetTarget(target1.LocalAddr().String(), nil)
+
+		udpRunner(t, proxy, "first", "first")
+	})
+
+	t.Run("Target per client", func(t *testing.T) {
+		targets := []string{"udp://" + target1.LocalAddr().String(), target2.LocalAddr().String()}
+		var next int32 = -1
+
+		proxy := &UDPProxy{}
+		proxy.SetTarget("", &Modifier{
+			Target: func() (string, error) {
+				return targets[int(atomic.AddInt32(&next, 1))%len(targets)], nil
+			},
+		})
+
+		udpRunner(t, proxy, "first", "second", "first")
+	})
+
+	t.Run("Unauthorized client", func(t *testing.T) {
+		proxy := &UDPProxy{}
+		proxy.SetTarget(target1.LocalAddr().String(), &Modifier{
+			Authorize: func(conn net.Conn) error {
+				if _, ok := conn.RemoteAddr().(*net.UDPAddr); !ok {
+					t.Errorf("Expected the address of the client, got %v", conn.RemoteAddr())
+				}
+				return errors.New("denied")
+			},
+		})
+
+		udpDenied(t, proxy)
+	})
+
+	t.Run("Too many sessions", func(t *testing.T) {
+		proxy := &UDPProxy{MaxSessions: 1}
+		proxy.SetTarget(target1.LocalAddr().String(), nil)
+		proxy.sessions = map[string]*udpSession{"other": {}}
+
+		udpDenied(t, proxy)
+	})
+
+	t.Run("Slow authorization", func(t *testing.T) {
+		var authorizing int32
+		release := make(chan struct{})
+		defer close(release)
+
+		proxy := &UDPProxy{}
+		proxy.SetTarget(target1.LocalAddr().String(), &Modifier{
+			Authorize: func(conn net.Conn) error {
+				// the first client is authorized once released
+				if atomic.CompareAndSwapInt32(&authorizing, 0, 1) {
+					<-release
+				}
+				return nil
+			},
+		})
+
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pc.Close()
+		go proxy.Serve(pc)
+
+		slow, err := net.Dial("udp", pc.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer slow.Close()
+		if _, err := slow.Write([]byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+		for atomic.LoadInt32(&authorizing) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		client, err := net.Dial("udp", pc.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		client.SetDeadline(time.Now().Add(time.Second))
+		if _, err := client.Write([]byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 64)
+		if n, err := client.Read(buf); err != nil || string(buf[:n]) != "first" {
+			t.Errorf("Expected the other clients to be served meanwhile, got %q: %v", buf[:n], err)
+		}
+	})
+
+	t.Run("Idle session", func(t *testing.T) {
+		proxy := &UDPProxy{IdleTimeout: 50 * time.Millisecond}
+		proxy.SetTarget(target1.LocalAddr().String(), nil)
+
+		udpRunner(t, proxy, "first")
+		time.Sleep(200 * time.Millisecond)
+
+		proxy.sessionsMu.Lock()
+		defer proxy.sessionsMu.Unlock()
+		if len(proxy.sessions) != 0 {
+			t.Errorf("Expected idle sessions to be closed, got %d", len(proxy.sessions))
+		}
+	})
+}
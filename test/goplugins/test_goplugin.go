@@ -6,7 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 
-	"github.com/TykTechnologies/tyk/ctx"
+	"github.com/TykTechnologies/tyk/goplugin/sdk"
 	"github.com/TykTechnologies/tyk/headers"
 	"github.com/TykTechnologies/tyk/user"
 )
@@ -14,7 +14,7 @@ import (
 // MyPluginPre checks if session is NOT present, adds custom header
 // with initial URI path and will be used as "pre" custom MW
 func MyPluginPre(rw http.ResponseWriter, r *http.Request) {
-	session := ctx.GetSession(r)
+	session := sdk.Session(r)
 	if session != nil {
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
@@ -39,7 +39,7 @@ func MyPluginAuthCheck(rw http.ResponseWriter, r *http.Request) {
 		OrgID: "default",
 		Alias: "abc-session",
 	}
-	ctx.SetSession(r, session, token, true)
+	sdk.SetSession(r, session, token, true)
 
 	rw.Header().Add(headers.XAuthResult, "OK")
 }
@@ -47,7 +47,7 @@ func MyPluginAuthCheck(rw http.ResponseWriter, r *http.Request) {
 // MyPluginPostKeyAuth checks if session is present, adds custom header with session-alias
 // and will be used as "post_key_auth" custom MW
 func MyPluginPostKeyAuth(rw http.ResponseWriter, r *http.Request) {
-	session := ctx.GetSession(r)
+	session := sdk.Session(r)
 	if session == nil {
 		rw.Header().Add(headers.XSessionAlias, "not found")
 		rw.WriteHeader(http.StatusInternalServerError)
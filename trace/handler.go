@@ -3,10 +3,10 @@ package trace
 import "net/http"
 
 // Handle returns a http.Handler with root opentracting setup. This should be
-// the topmost handler.
-func Handle(service string, h http.Handler) http.Handler {
+// the topmost handler. The inbound formats are passed to Root.
+func Handle(service string, h http.Handler, inbound ...Format) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		span, req := Root(service, r)
+		span, req := Root(service, r, inbound...)
 		defer span.Finish()
 		h.ServeHTTP(w, req)
 	})
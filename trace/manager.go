@@ -153,9 +153,21 @@ func SetupTracing(name string, opts map[string]interface{}) {
 	enabled.Store(true)
 }
 
-func Root(service string, r *http.Request) (opentracing.Span, *http.Request) {
+// Root starts the root span of the request, as a child of the trace context
+// the request carries. If inbound formats are given, the trace context is
+// only read from headers in these formats, whatever the format of the tracer.
+func Root(service string, r *http.Request, inbound ...Format) (opentracing.Span, *http.Request) {
 	tr := Get(service)
-	mainCtx, err := Extract(tr, r.Header)
+	h := r.Header
+	if len(inbound) > 0 {
+		// Present the trace context to the tracer in all formats, so that
+		// it finds it in its own
+		h = http.Header{}
+		if pc, ok := ExtractFormat(r.Header, inbound...); ok {
+			InjectFormat(h, pc, Formats...)
+		}
+	}
+	mainCtx, err := Extract(tr, h)
 	tags := opentracing.Tags{
 		"from_ip":  request.RealIP(r),
 		"method":   r.Method,
@@ -0,0 +1,292 @@
+package trace
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Format is a way of carrying the trace context in HTTP headers.
+type Format string
+
+const (
+	// FormatW3C is the traceparent header of the W3C Trace Context
+	// specification.
+	FormatW3C Format = "w3c"
+	// FormatB3 is the multiple X-B3-* headers used by Zipkin.
+	FormatB3 Format = "b3"
+	// FormatB3Single is the single b3 header used by Zipkin.
+	FormatB3Single Format = "b3-single"
+	// FormatJaeger is the uber-trace-id header used by Jaeger.
+	FormatJaeger Format = "jaeger"
+)
+
+// Formats lists the supported formats.
+var Formats = []Format{FormatW3C, FormatB3, FormatB3Single, FormatJaeger}
+
+const (
+	headerTraceParent = "Traceparent"
+	headerB3TraceID   = "X-B3-Traceid"
+	headerB3SpanID    = "X-B3-Spanid"
+	headerB3ParentID  = "X-B3-Parentspanid"
+	headerB3Sampled   = "X-B3-Sampled"
+	headerB3Flags     = "X-B3-Flags"
+	headerB3Single    = "B3"
+	headerJaegerTrace = "Uber-Trace-Id"
+	traceIDLength     = 32
+	spanIDLength      = 16
+)
+
+var formatHeaders = map[Format][]string{
+	FormatW3C:      {headerTraceParent},
+	FormatB3:       {headerB3TraceID, headerB3SpanID, headerB3ParentID, headerB3Sampled, headerB3Flags},
+	FormatB3Single: {headerB3Single},
+	FormatJaeger:   {headerJaegerTrace},
+}
+
+// PropagatedContext is the trace context carried by headers, whatever their
+// format. IDs are lowercase hex strings.
+type PropagatedContext struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Sampled      bool
+	Debug        bool
+}
+
+// ParseFormats returns the formats of names, and false if one of them is not
+// supported.
+func ParseFormats(names []string) ([]Format, bool) {
+	formats := make([]Format, 0, len(names))
+	for _, name := range names {
+		format := Format(strings.ToLower(name))
+		if _, ok := formatHeaders[format]; !ok {
+			return nil, false
+		}
+		formats = append(formats, format)
+	}
+	return formats, true
+}
+
+// ExtractFormat reads the trace context from h, trying formats in order. It
+// returns false if none of them carries a valid trace context.
+func ExtractFormat(h http.Header, formats ...Format) (PropagatedContext, bool) {
+	for _, format := range formats {
+		var pc PropagatedContext
+		var ok bool
+		switch format {
+		case FormatW3C:
+			pc, ok = extractW3C(h)
+		case FormatB3:
+			pc, ok = extractB3(h)
+		case FormatB3Single:
+			pc, ok = extractB3Single(h)
+		case FormatJaeger:
+			pc, ok = extractJaeger(h)
+		}
+		if ok {
+			return pc, true
+		}
+	}
+	return PropagatedContext{}, false
+}
+
+// InjectFormat writes the trace context to h in each of formats.
+func InjectFormat(h http.Header, pc PropagatedContext, formats ...Format) {
+	for _, format := range formats {
+		switch format {
+		case FormatW3C:
+			flags := "00"
+			if pc.Sampled {
+				flags = "01"
+			}
+			h.Set(headerTraceParent, "00-"+padID(pc.TraceID, traceIDLength)+"-"+padID(pc.SpanID, spanIDLength)+"-"+flags)
+		case FormatB3:
+			h.Set(headerB3TraceID, pc.TraceID)
+			h.Set(headerB3SpanID, pc.SpanID)
+			if pc.ParentSpanID != "" {
+				h.Set(headerB3ParentID, pc.ParentSpanID)
+			}
+			if pc.Debug {
+				h.Set(headerB3Flags, "1")
+			} else {
+				h.Set(headerB3Sampled, sampledFlag(pc.Sampled))
+			}
+		case FormatB3Single:
+			value := pc.TraceID + "-" + pc.SpanID + "-"
+			if pc.Debug {
+				value += "d"
+			} else {
+				value += sampledFlag(pc.Sampled)
+			}
+			if pc.ParentSpanID != "" {
+				value += "-" + pc.ParentSpanID
+			}
+			h.Set(headerB3Single, value)
+		case FormatJaeger:
+			var flags uint64
+			if pc.Sampled {
+				flags |= 1
+			}
+			if pc.Debug {
+				flags |= 2
+			}
+			parent := pc.ParentSpanID
+			if parent == "" {
+				parent = "0"
+			}
+			h.Set(headerJaegerTrace, pc.TraceID+":"+pc.SpanID+":"+parent+":"+strconv.FormatUint(flags, 16))
+		}
+	}
+}
+
+// ClearFormats removes the headers of all the supported formats from h.
+func ClearFormats(h http.Header) {
+	for _, names := range formatHeaders {
+		for _, name := range names {
+			h.Del(name)
+		}
+	}
+}
+
+// ConvertFormat rewrites the trace context of h, read from one of from, in
+// the formats to only. It returns false, leaving h unchanged, if h carries no
+// trace context in the formats from.
+func ConvertFormat(h http.Header, from, to []Format) bool {
+	pc, ok := ExtractFormat(h, from...)
+	if !ok {
+		return false
+	}
+	ClearFormats(h)
+	InjectFormat(h, pc, to...)
+	return true
+}
+
+func sampledFlag(sampled bool) string {
+	if sampled {
+		return "1"
+	}
+	return "0"
+}
+
+// padID left pads a hex ID with zeros up to length.
+func padID(id string, length int) string {
+	if len(id) >= length {
+		return id
+	}
+	return strings.Repeat("0", length-len(id)) + id
+}
+
+// validID reports whether id is a non zero hex ID of at most maxLength
+// characters.
+func validID(id string, maxLength int) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	nonZero := false
+	for _, c := range id {
+		switch {
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'f':
+		default:
+			return false
+		}
+		if c != '0' {
+			nonZero = true
+		}
+	}
+	return nonZero
+}
+
+func extractW3C(h http.Header) (PropagatedContext, bool) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(h.Get(headerTraceParent))), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != traceIDLength || !validID(parts[1], traceIDLength) ||
+		len(parts[2]) != spanIDLength || !validID(parts[2], spanIDLength) {
+		return PropagatedContext{}, false
+	}
+	// Versions after 00 may add fields, which are ignored
+	if parts[0] == "00" && len(parts) != 4 {
+		return PropagatedContext{}, false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil || len(parts[3]) != 2 {
+		return PropagatedContext{}, false
+	}
+	return PropagatedContext{
+		TraceID: parts[1],
+		SpanID:  parts[2],
+		Sampled: flags&1 == 1,
+	}, true
+}
+
+func extractB3(h http.Header) (PropagatedContext, bool) {
+	pc := PropagatedContext{
+		TraceID:      strings.ToLower(h.Get(headerB3TraceID)),
+		SpanID:       strings.ToLower(h.Get(headerB3SpanID)),
+		ParentSpanID: strings.ToLower(h.Get(headerB3ParentID)),
+		Debug:        h.Get(headerB3Flags) == "1",
+	}
+	if !validID(pc.TraceID, traceIDLength) || !validID(pc.SpanID, spanIDLength) {
+		return PropagatedContext{}, false
+	}
+	if pc.ParentSpanID != "" && !validID(pc.ParentSpanID, spanIDLength) {
+		return PropagatedContext{}, false
+	}
+	switch strings.ToLower(h.Get(headerB3Sampled)) {
+	case "1", "true":
+		pc.Sampled = true
+	}
+	pc.Sampled = pc.Sampled || pc.Debug
+	return pc, true
+}
+
+func extractB3Single(h http.Header) (PropagatedContext, bool) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(h.Get(headerB3Single))), "-")
+	// A lone sampling state carries no trace context
+	if len(parts) < 2 || len(parts) > 4 {
+		return PropagatedContext{}, false
+	}
+	pc := PropagatedContext{TraceID: parts[0], SpanID: parts[1]}
+	if !validID(pc.TraceID, traceIDLength) || !validID(pc.SpanID, spanIDLength) {
+		return PropagatedContext{}, false
+	}
+	if len(parts) > 2 {
+		switch parts[2] {
+		case "1":
+			pc.Sampled = true
+		case "d":
+			pc.Sampled, pc.Debug = true, true
+		case "0":
+		default:
+			return PropagatedContext{}, false
+		}
+	}
+	if len(parts) > 3 {
+		if !validID(parts[3], spanIDLength) {
+			return PropagatedContext{}, false
+		}
+		pc.ParentSpanID = parts[3]
+	}
+	return pc, true
+}
+
+func extractJaeger(h http.Header) (PropagatedContext, bool) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(h.Get(headerJaegerTrace))), ":")
+	if len(parts) != 4 || !validID(parts[0], traceIDLength) || !validID(parts[1], spanIDLength) {
+		return PropagatedContext{}, false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return PropagatedContext{}, false
+	}
+	pc := PropagatedContext{
+		TraceID: parts[0],
+		SpanID:  parts[1],
+		Sampled: flags&1 == 1,
+		Debug:   flags&2 == 2,
+	}
+	if parts[2] != "0" && validID(parts[2], spanIDLength) {
+		pc.ParentSpanID = parts[2]
+	}
+	return pc, true
+}
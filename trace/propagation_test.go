@@ -0,0 +1,98 @@
+package trace
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestPropagationFormats(t *testing.T) {
+	pc := PropagatedContext{
+		TraceID:      "463ac35c9f6413ad48485a3953bb6124",
+		SpanID:       "a2fb4a1d1a96d312",
+		ParentSpanID: "0020000000000001",
+		Sampled:      true,
+	}
+
+	expect := map[Format]http.Header{
+		FormatW3C: {
+			"Traceparent": {"00-463ac35c9f6413ad48485a3953bb6124-a2fb4a1d1a96d312-01"},
+		},
+		FormatB3: {
+			"X-B3-Traceid":      {"463ac35c9f6413ad48485a3953bb6124"},
+			"X-B3-Spanid":       {"a2fb4a1d1a96d312"},
+			"X-B3-Parentspanid": {"0020000000000001"},
+			"X-B3-Sampled":      {"1"},
+		},
+		FormatB3Single: {
+			"B3": {"463ac35c9f6413ad48485a3953bb6124-a2fb4a1d1a96d312-1-0020000000000001"},
+		},
+		FormatJaeger: {
+			"Uber-Trace-Id": {"463ac35c9f6413ad48485a3953bb6124:a2fb4a1d1a96d312:0020000000000001:1"},
+		},
+	}
+
+	for _, format := range Formats {
+		t.Run(string(format), func(t *testing.T) {
+			h := http.Header{}
+			InjectFormat(h, pc, format)
+			if !reflect.DeepEqual(h, expect[format]) {
+				t.Fatalf("Expected headers %v, got %v", expect[format], h)
+			}
+
+			got, ok := ExtractFormat(h, Formats...)
+			if !ok {
+				t.Fatal("Expected to extract the trace context")
+			}
+			want := pc
+			if format == FormatW3C {
+				// traceparent carries no parent span
+				want.ParentSpanID = ""
+			}
+			if got != want {
+				t.Errorf("Expected %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestExtractFormatInvalid(t *testing.T) {
+	for name, h := range map[string]http.Header{
+		"empty":             {},
+		"zero trace id":     {"Traceparent": {"00-00000000000000000000000000000000-a2fb4a1d1a96d312-01"}},
+		"short trace id":    {"Traceparent": {"00-463ac35c9f6413ad-a2fb4a1d1a96d312-01"}},
+		"invalid version":   {"Traceparent": {"ff-463ac35c9f6413ad48485a3953bb6124-a2fb4a1d1a96d312-01"}},
+		"sampling only":     {"B3": {"1"}},
+		"non hex span id":   {"X-B3-Traceid": {"463ac35c9f6413ad"}, "X-B3-Spanid": {"not-hex"}},
+		"missing jaeger id": {"Uber-Trace-Id": {"463ac35c9f6413ad::0:1"}},
+	} {
+		if pc, ok := ExtractFormat(h, Formats...); ok {
+			t.Errorf("%s: expected no trace context, got %+v", name, pc)
+		}
+	}
+}
+
+func TestConvertFormat(t *testing.T) {
+	h := http.Header{
+		"X-B3-Traceid": {"463ac35c9f6413ad"},
+		"X-B3-Spanid":  {"a2fb4a1d1a96d312"},
+		"X-B3-Sampled": {"0"},
+		"Other":        {"kept"},
+	}
+
+	if ConvertFormat(h, []Format{FormatW3C}, []Format{FormatJaeger}) {
+		t.Fatal("Expected no trace context in a format not accepted")
+	}
+
+	if !ConvertFormat(h, []Format{FormatW3C, FormatB3}, []Format{FormatW3C, FormatJaeger}) {
+		t.Fatal("Expected the trace context to be converted")
+	}
+	expect := http.Header{
+		"Traceparent":   {"00-0000000000000000463ac35c9f6413ad-a2fb4a1d1a96d312-00"},
+		"Uber-Trace-Id": {"463ac35c9f6413ad:a2fb4a1d1a96d312:0:0"},
+		"Other":         {"kept"},
+	}
+	if !reflect.DeepEqual(h, expect) {
+		t.Errorf("Expected headers %v, got %v", expect, h)
+	}
+}
@@ -0,0 +1,23 @@
+package user
+
+// KeyTemplate holds the defaults of the keys created from it, so that only
+// their variable parts need to be sent.
+type KeyTemplate struct {
+	ID            string   `bson:"id" json:"id"`
+	OrgID         string   `bson:"org_id" json:"org_id"`
+	ApplyPolicies []string `bson:"apply_policies" json:"apply_policies"`
+	Tags          []string `bson:"tags" json:"tags"`
+	// MetaData is merged into that of keys, which take precedence.
+	MetaData map[string]interface{} `bson:"meta_data" json:"meta_data"`
+	// MetaDataSchema describes the metadata keys must have, by name.
+	MetaDataSchema map[string]KeyTemplateMetaField `bson:"meta_data_schema" json:"meta_data_schema"`
+	// KeyExpiresIn is how long, in seconds, keys without an expiry last.
+	KeyExpiresIn int64 `bson:"key_expires_in" json:"key_expires_in"`
+}
+
+// KeyTemplateMetaField describes a metadata field of keys.
+type KeyTemplateMetaField struct {
+	// Type is string, number, boolean, object or array, any if empty.
+	Type     string `bson:"type" json:"type"`
+	Required bool   `bson:"required" json:"required"`
+}
@@ -14,6 +14,9 @@ type Policy struct {
 	Per                           float64                          `bson:"per" json:"per"`
 	QuotaMax                      int64                            `bson:"quota_max" json:"quota_max"`
 	QuotaRenewalRate              int64                            `bson:"quota_renewal_rate" json:"quota_renewal_rate"`
+	QuotaRenewalPeriod            string                           `bson:"quota_renewal_period" json:"quota_renewal_period"`
+	QuotaTimezone                 string                           `bson:"quota_timezone" json:"quota_timezone"`
+	QuotaCarryOver                int64                            `bson:"quota_carry_over" json:"quota_carry_over"`
 	ThrottleInterval              float64                          `bson:"throttle_interval" json:"throttle_interval"`
 	ThrottleRetryLimit            int                              `bson:"throttle_retry_limit" json:"throttle_retry_limit"`
 	MaxQueryDepth                 int                              `bson:"max_query_depth" json:"max_query_depth"`
@@ -28,6 +31,9 @@ type Policy struct {
 	LastUpdated                   string                           `bson:"last_updated" json:"last_updated"`
 	MetaData                      map[string]interface{}           `bson:"meta_data" json:"meta_data"`
 	GraphQL                       map[string]GraphAccessDefinition `bson:"graphql_access_rights" json:"graphql_access_rights"`
+	// Priority is the priority class of the requests of keys with the
+	// policy when the gateway sheds load: high, normal or low.
+	Priority string `bson:"priority" json:"priority"`
 }
 
 type PolicyPartitions struct {
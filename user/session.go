@@ -38,9 +38,50 @@ type APILimit struct {
 	QuotaRenews        int64   `json:"quota_renews" msg:"quota_renews"`
 	QuotaRemaining     int64   `json:"quota_remaining" msg:"quota_remaining"`
 	QuotaRenewalRate   int64   `json:"quota_renewal_rate" msg:"quota_renewal_rate"`
+	QuotaRenewalPeriod string  `json:"quota_renewal_period" msg:"quota_renewal_period"`
+	QuotaTimezone      string  `json:"quota_timezone" msg:"quota_timezone"`
+	QuotaCarryOver     int64   `json:"quota_carry_over" msg:"quota_carry_over"`
 	SetBy              string  `json:"-" msg:"-"`
 }
 
+// LimitOverride temporarily changes the rate limit and quota of a key, on top
+// of those of its policies, until Expires. Multipliers scale the limits,
+// while Rate, Per and QuotaMax replace them when set.
+type LimitOverride struct {
+	RateMultiplier  float64 `json:"rate_multiplier,omitempty" msg:"rate_multiplier"`
+	QuotaMultiplier float64 `json:"quota_multiplier,omitempty" msg:"quota_multiplier"`
+	Rate            float64 `json:"rate,omitempty" msg:"rate"`
+	Per             float64 `json:"per,omitempty" msg:"per"`
+	QuotaMax        int64   `json:"quota_max,omitempty" msg:"quota_max"`
+	Expires         int64   `json:"expires" msg:"expires"`
+	Reason          string  `json:"reason,omitempty" msg:"reason"`
+}
+
+// Active reports whether the override applies at now, a Unix timestamp.
+func (o *LimitOverride) Active(now int64) bool {
+	return o != nil && now < o.Expires
+}
+
+// Apply returns a copy of limit with the override applied. Unlimited rates
+// and quotas stay unlimited.
+func (o *LimitOverride) Apply(limit *APILimit) *APILimit {
+	l := *limit
+	if o.Rate > 0 {
+		l.Rate = o.Rate
+		if o.Per > 0 {
+			l.Per = o.Per
+		}
+	} else if o.RateMultiplier > 0 && l.Rate > 0 {
+		l.Rate *= o.RateMultiplier
+	}
+	if o.QuotaMax != 0 {
+		l.QuotaMax = o.QuotaMax
+	} else if o.QuotaMultiplier > 0 && l.QuotaMax > 0 {
+		l.QuotaMax = int64(float64(l.QuotaMax) * o.QuotaMultiplier)
+	}
+	return &l
+}
+
 // AccessDefinition defines which versions of an API a key has access to
 // NOTE: when adding new fields it is required to map them from DBAccessDefinition
 // in the gateway/policy.go:19
@@ -99,6 +140,9 @@ type SessionState struct {
 	QuotaRenews                   int64                       `json:"quota_renews" msg:"quota_renews"`
 	QuotaRemaining                int64                       `json:"quota_remaining" msg:"quota_remaining"`
 	QuotaRenewalRate              int64                       `json:"quota_renewal_rate" msg:"quota_renewal_rate"`
+	QuotaRenewalPeriod            string                      `json:"quota_renewal_period" msg:"quota_renewal_period"`
+	QuotaTimezone                 string                      `json:"quota_timezone" msg:"quota_timezone"`
+	QuotaCarryOver                int64                       `json:"quota_carry_over" msg:"quota_carry_over"`
 	AccessRights                  map[string]AccessDefinition `json:"access_rights" msg:"access_rights"`
 	OrgID                         string                      `json:"org_id" msg:"org_id"`
 	OauthClientID                 string                      `json:"oauth_client_id" msg:"oauth_client_id"`
@@ -125,6 +169,8 @@ type SessionState struct {
 	LastUpdated             string                 `json:"last_updated" msg:"last_updated"`
 	IdExtractorDeadline     int64                  `json:"id_extractor_deadline" msg:"id_extractor_deadline"`
 	SessionLifetime         int64                  `bson:"session_lifetime" json:"session_lifetime"`
+	AllowedIPs              []string               `json:"allowed_ips" msg:"allowed_ips"`
+	LimitOverride           *LimitOverride         `json:"limit_override,omitempty" msg:"limit_override"`
 
 	// Used to store token hash
 	keyHash string
@@ -151,6 +197,9 @@ func (s *SessionState) Clone() SessionState {
 		QuotaRenews:                   s.QuotaRenews,
 		QuotaRemaining:                s.QuotaRemaining,
 		QuotaRenewalRate:              s.QuotaRenewalRate,
+		QuotaRenewalPeriod:            s.QuotaRenewalPeriod,
+		QuotaTimezone:                 s.QuotaTimezone,
+		QuotaCarryOver:                s.QuotaCarryOver,
 		AccessRights:                  cloneAccess(s.AccessRights),
 		OrgID:                         s.OrgID,
 		OauthClientID:                 s.OauthClientID,
@@ -175,12 +224,22 @@ func (s *SessionState) Clone() SessionState {
 		LastUpdated:                   s.LastUpdated,
 		IdExtractorDeadline:           s.IdExtractorDeadline,
 		SessionLifetime:               s.SessionLifetime,
+		AllowedIPs:                    cloneSlice(s.AllowedIPs),
+		LimitOverride:                 cloneLimitOverride(s.LimitOverride),
 		// Used to store token hash
 		keyHash: s.keyHash,
 		KeyID:   s.KeyID,
 	}
 }
 
+func cloneLimitOverride(o *LimitOverride) *LimitOverride {
+	if o == nil {
+		return nil
+	}
+	x := *o
+	return &x
+}
+
 func cloneSlice(s []string) []string {
 	if s == nil {
 		return nil